@@ -51,9 +51,12 @@ import (
 	"syscall"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/audit"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/common/tracing"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 
 	"github.com/sevlyar/go-daemon"
 	"github.com/spf13/cobra"
@@ -66,25 +69,45 @@ type LogOptions struct {
 	MaxLogFileSize uint64 `config:"max-file-size-mb" yaml:"max-file-size-mb,omitempty"`
 	LogFileCount   uint64 `config:"file-count" yaml:"file-count,omitempty"`
 	TimeTracker    bool   `config:"track-time" yaml:"track-time,omitempty"`
+
+	ComponentLevels map[string]string `config:"component-levels" yaml:"component-levels,omitempty"`
+}
+
+// parseComponentLevels : Convert the log levels given per component, e.g. azstorage: LOG_DEBUG
+func parseComponentLevels(levels map[string]string) (map[string]common.LogLevel, error) {
+	parsed := make(map[string]common.LogLevel, len(levels))
+	for name, level := range levels {
+		var logLevel common.LogLevel
+		err := logLevel.Parse(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %s for component %s [%s]", level, name, err.Error())
+		}
+		parsed[name] = logLevel
+	}
+	return parsed, nil
 }
 
 type mountOptions struct {
 	MountPath  string
 	ConfigFile string
 
-	Logging           LogOptions     `config:"logging"`
-	Components        []string       `config:"components"`
-	Foreground        bool           `config:"foreground"`
-	NonEmpty          bool           `config:"nonempty"`
-	DefaultWorkingDir string         `config:"default-working-dir"`
-	CPUProfile        string         `config:"cpu-profile"`
-	MemProfile        string         `config:"mem-profile"`
-	PassPhrase        string         `config:"passphrase"`
-	SecureConfig      bool           `config:"secure-config"`
-	DynamicProfiler   bool           `config:"dynamic-profile"`
-	ProfilerPort      int            `config:"profiler-port"`
-	ProfilerIP        string         `config:"profiler-ip"`
-	MonitorOpt        monitorOptions `config:"health_monitor"`
+	Logging           LogOptions       `config:"logging"`
+	Components        []string         `config:"components"`
+	Foreground        bool             `config:"foreground"`
+	NonEmpty          bool             `config:"nonempty"`
+	DefaultWorkingDir string           `config:"default-working-dir"`
+	CPUProfile        string           `config:"cpu-profile"`
+	MemProfile        string           `config:"mem-profile"`
+	PassPhrase        string           `config:"passphrase"`
+	SecureKey         secureKeyOptions `config:"secure"`
+	SecureConfig      bool             `config:"secure-config"`
+	DynamicProfiler   bool             `config:"dynamic-profile"`
+	ProfilerPort      int              `config:"profiler-port"`
+	ProfilerIP        string           `config:"profiler-ip"`
+	MonitorOpt        monitorOptions   `config:"health_monitor"`
+	MetricsOpt        metricsOptions   `config:"metrics"`
+	TracingOpt        tracingOptions   `config:"tracing"`
+	AuditOpt          auditOptions     `config:"audit"`
 
 	// v1 support
 	Streaming      bool     `config:"streaming"`
@@ -92,6 +115,32 @@ type mountOptions struct {
 	LibfuseOptions []string `config:"libfuse-options"`
 }
 
+// metricsOptions : http listener serving the stats of the mount in OpenMetrics format
+type metricsOptions struct {
+	Enable  bool   `config:"enable-metrics"`
+	Address string `config:"listen-address"`
+}
+
+// tracingOptions : spans recorded for a sample of the FUSE operations and where they are exported to
+type tracingOptions struct {
+	Enable     bool    `config:"enable-tracing"`
+	Exporter   string  `config:"exporter"`
+	Endpoint   string  `config:"endpoint"`
+	FilePath   string  `config:"file-path"`
+	SampleRate float64 `config:"sample-rate"`
+}
+
+// auditOptions : record of the mutating operations done through the mount and the processes which asked for them
+type auditOptions struct {
+	Enable      bool   `config:"enable-audit"`
+	Type        string `config:"type"`
+	FilePath    string `config:"file-path"`
+	MaxFileSize uint64 `config:"max-file-size-mb"`
+	FileCount   uint64 `config:"file-count"`
+	Facility    string `config:"syslog-facility"`
+	DropOnFull  bool   `config:"drop-on-full"`
+}
+
 var options mountOptions
 
 func (opt *mountOptions) validate(skipEmptyMount bool) error {
@@ -111,6 +160,10 @@ func (opt *mountOptions) validate(skipEmptyMount bool) error {
 		return fmt.Errorf("invalid log level [%s]", err.Error())
 	}
 
+	if _, err := parseComponentLevels(opt.Logging.ComponentLevels); err != nil {
+		return err
+	}
+
 	if opt.DefaultWorkingDir != "" {
 		common.DefaultWorkDir = opt.DefaultWorkingDir
 
@@ -152,6 +205,26 @@ func (opt *mountOptions) validate(skipEmptyMount bool) error {
 		opt.Logging.LogFileCount = common.DefaultLogFileCount
 	}
 
+	if opt.TracingOpt.Enable {
+		if !config.IsSet("tracing.sample-rate") {
+			opt.TracingOpt.SampleRate = tracing.DefaultSampleRate
+		}
+		if opt.TracingOpt.SampleRate < 0 || opt.TracingOpt.SampleRate > 1 {
+			return fmt.Errorf("invalid tracing sample-rate %v, shall be between 0 and 1", opt.TracingOpt.SampleRate)
+		}
+		opt.TracingOpt.FilePath = common.ExpandPath(opt.TracingOpt.FilePath)
+	}
+
+	if opt.AuditOpt.Enable && opt.AuditOpt.Type != audit.TypeSyslog {
+		if opt.AuditOpt.FilePath == "" {
+			opt.AuditOpt.FilePath = filepath.Join(common.DefaultWorkDir, "blobfuse2-audit.log")
+		}
+		opt.AuditOpt.FilePath = common.ExpandPath(opt.AuditOpt.FilePath)
+		if opt.AuditOpt.FilePath == common.ExpandPath(opt.Logging.LogFilePath) {
+			return fmt.Errorf("audit file-path shall be different from the log file")
+		}
+	}
+
 	return nil
 }
 
@@ -168,12 +241,19 @@ func OnConfigChange() {
 		log.Err("Mount::OnConfigChange : Invalid log level [%s]", newLogOptions.LogLevel)
 	}
 
+	componentLevels, err := parseComponentLevels(newLogOptions.ComponentLevels)
+	if err != nil {
+		// Components keep logging at their current levels till the config is corrected
+		log.Err("Mount::OnConfigChange : Invalid component log levels [%s]", err.Error())
+	}
+
 	err = log.SetConfig(common.LogConfig{
-		Level:       logLevel,
-		FilePath:    common.ExpandPath(newLogOptions.LogFilePath),
-		MaxFileSize: newLogOptions.MaxLogFileSize,
-		FileCount:   newLogOptions.LogFileCount,
-		TimeTracker: newLogOptions.TimeTracker,
+		Level:           logLevel,
+		FilePath:        common.ExpandPath(newLogOptions.LogFilePath),
+		MaxFileSize:     newLogOptions.MaxLogFileSize,
+		FileCount:       newLogOptions.LogFileCount,
+		TimeTracker:     newLogOptions.TimeTracker,
+		ComponentLevels: componentLevels,
 	})
 
 	if err != nil {
@@ -190,12 +270,14 @@ func parseConfig() error {
 		filepath.Ext(options.ConfigFile) == SecureConfigExtension {
 
 		// Validate config is to be secured on write or not
-		if options.PassPhrase == "" {
-			options.PassPhrase = os.Getenv(SecureConfigEnvName)
+		var err error
+		options.PassPhrase, err = getSecurePassphrase(options.PassPhrase, options.SecureKey)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase to decrypt the config file [%s]", err.Error())
 		}
 
 		if options.PassPhrase == "" {
-			return fmt.Errorf("no passphrase provided to decrypt the config file.\n Either use --passphrase cli option or store passphrase in BLOBFUSE2_SECURE_CONFIG_PASSPHRASE environment variable")
+			return fmt.Errorf("no passphrase provided to decrypt the config file.\n Either use --passphrase, --key-file, --key-credential or --key-command cli option or store passphrase in BLOBFUSE2_SECURE_CONFIG_PASSPHRASE environment variable")
 		}
 
 		cipherText, err := ioutil.ReadFile(options.ConfigFile)
@@ -203,7 +285,7 @@ func parseConfig() error {
 			return fmt.Errorf("failed to read encrypted config file %s [%s]", options.ConfigFile, err.Error())
 		}
 
-		plainText, err := common.DecryptData(cipherText, []byte(options.PassPhrase))
+		plainText, err := common.DecryptSecureConfig(cipherText, []byte(options.PassPhrase))
 		if err != nil {
 			return fmt.Errorf("failed to decrypt config file %s [%s]", options.ConfigFile, err.Error())
 		}
@@ -276,6 +358,11 @@ var mountCmd = &cobra.Command{
 				pipeline = append(pipeline, "attr_cache")
 			}
 
+			// encryption is engaged as soon as a master key is given on command line
+			if config.IsSet("encryption.key-file") {
+				pipeline = append(pipeline, "encryption")
+			}
+
 			pipeline = append(pipeline, "azstorage")
 			options.Components = pipeline
 		}
@@ -338,12 +425,18 @@ var mountCmd = &cobra.Command{
 			return fmt.Errorf("invalid log level [%s]", err.Error())
 		}
 
+		componentLevels, err := parseComponentLevels(options.Logging.ComponentLevels)
+		if err != nil {
+			return err
+		}
+
 		err = log.SetDefaultLogger(options.Logging.Type, common.LogConfig{
-			FilePath:    options.Logging.LogFilePath,
-			MaxFileSize: options.Logging.MaxLogFileSize,
-			FileCount:   options.Logging.LogFileCount,
-			Level:       logLevel,
-			TimeTracker: options.Logging.TimeTracker,
+			FilePath:        options.Logging.LogFilePath,
+			MaxFileSize:     options.Logging.MaxLogFileSize,
+			FileCount:       options.Logging.LogFileCount,
+			Level:           logLevel,
+			TimeTracker:     options.Logging.TimeTracker,
+			ComponentLevels: componentLevels,
 		})
 
 		if err != nil {
@@ -368,6 +461,7 @@ var mountCmd = &cobra.Command{
 		}
 
 		common.EnableMonitoring = options.MonitorOpt.EnableMon
+		common.EnableMetrics = options.MetricsOpt.Enable
 
 		// check if blobfuse stats monitor is added in the disable list
 		for _, mon := range options.MonitorOpt.DisableList {
@@ -478,6 +572,39 @@ func runPipeline(pipeline *internal.Pipeline, ctx context.Context) error {
 
 	go startMonitor(os.Getpid())
 
+	if common.EnableMetrics {
+		stats_manager.StartMetricsServer(options.MetricsOpt.Address)
+		defer stats_manager.StopMetricsServer()
+	}
+
+	if options.TracingOpt.Enable {
+		err := tracing.Setup(tracing.Config{
+			Exporter:   options.TracingOpt.Exporter,
+			Endpoint:   options.TracingOpt.Endpoint,
+			FilePath:   options.TracingOpt.FilePath,
+			SampleRate: options.TracingOpt.SampleRate,
+		})
+		if err != nil {
+			log.Err("mount: error unable to setup tracing [%s]", err.Error())
+			return Destroy(fmt.Sprintf("unable to setup tracing [%s]", err.Error()))
+		}
+	}
+
+	if options.AuditOpt.Enable {
+		err := audit.Setup(audit.Config{
+			Type:        options.AuditOpt.Type,
+			FilePath:    options.AuditOpt.FilePath,
+			MaxFileSize: options.AuditOpt.MaxFileSize,
+			FileCount:   options.AuditOpt.FileCount,
+			Facility:    options.AuditOpt.Facility,
+			DropOnFull:  options.AuditOpt.DropOnFull,
+		})
+		if err != nil {
+			log.Err("mount: error unable to setup audit log [%s]", err.Error())
+			return Destroy(fmt.Sprintf("unable to setup audit log [%s]", err.Error()))
+		}
+	}
+
 	err := pipeline.Start(ctx)
 	if err != nil {
 		log.Err("mount: error unable to start pipeline [%s]", err.Error())
@@ -490,6 +617,9 @@ func runPipeline(pipeline *internal.Pipeline, ctx context.Context) error {
 		return Destroy(fmt.Sprintf("unable to stop pipeline [%s]", err.Error()))
 	}
 
+	// Spans and audit events still queued are written out before the logger goes away, failures are logged
+	tracing.Destroy()
+	audit.Destroy()
 	_ = log.Destroy()
 	return nil
 }
@@ -516,7 +646,14 @@ func sigusrHandler(pipeline *internal.Pipeline, ctx context.Context) daemon.Sign
 		var err error
 		if sig == syscall.SIGUSR1 {
 			log.Crit("Mount::sigusrHandler : SIGUSR1 received")
-			config.OnConfigChange()
+
+			// Pick up changes to the config file, e.g. new log levels, before notifying the components
+			err = config.ReloadConfig()
+			if err != nil {
+				log.Err("Mount::sigusrHandler : Failed to reload config file, applying current config [%s]", err.Error())
+				config.OnConfigChange()
+				err = nil
+			}
 		}
 
 		return err
@@ -582,12 +719,25 @@ func init() {
 		"Encrypt auto generated config file for each container")
 
 	mountCmd.PersistentFlags().StringVar(&options.PassPhrase, "passphrase", "",
-		"Key to decrypt config file. Can also be specified by env-variable BLOBFUSE2_SECURE_CONFIG_PASSPHRASE.\nKey length shall be 16 (AES-128), 24 (AES-192), or 32 (AES-256) bytes in length.")
+		"Passphrase to decrypt config file. Can also be specified by env-variable BLOBFUSE2_SECURE_CONFIG_PASSPHRASE.")
+
+	mountCmd.PersistentFlags().StringVar(&options.SecureKey.KeyFile, "key-file", "",
+		"File holding the passphrase to decrypt config file, used when --passphrase is not given.")
+	config.BindPFlag("secure.key-file", mountCmd.PersistentFlags().Lookup("key-file"))
+	_ = mountCmd.MarkPersistentFlagFilename("key-file")
+
+	mountCmd.PersistentFlags().StringVar(&options.SecureKey.KeyCredential, "key-credential", "",
+		"Name of the systemd credential holding the passphrase to decrypt config file, used when --passphrase is not given.")
+	config.BindPFlag("secure.key-credential", mountCmd.PersistentFlags().Lookup("key-credential"))
+
+	mountCmd.PersistentFlags().StringVar(&options.SecureKey.KeyCommand, "key-command", "",
+		"Command printing the passphrase to decrypt config file on its output, used when --passphrase is not given.")
+	config.BindPFlag("secure.key-command", mountCmd.PersistentFlags().Lookup("key-command"))
 
-	mountCmd.PersistentFlags().String("log-type", "syslog", "Type of logger to be used by the system. Set to syslog by default. Allowed values are silent|syslog|base.")
+	mountCmd.PersistentFlags().String("log-type", "syslog", "Type of logger to be used by the system. Set to syslog by default. Allowed values are silent|syslog|base|json.")
 	config.BindPFlag("logging.type", mountCmd.PersistentFlags().Lookup("log-type"))
 	_ = mountCmd.RegisterFlagCompletionFunc("log-type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"silent", "base", "syslog"}, cobra.ShellCompDirectiveNoFileComp
+		return []string{"silent", "base", "syslog", "json"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
 	mountCmd.PersistentFlags().String("log-level", "LOG_WARNING",
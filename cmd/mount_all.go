@@ -127,12 +127,18 @@ func processCommand() error {
 		return fmt.Errorf("invalid log level [%s]", err.Error())
 	}
 
+	componentLevels, err := parseComponentLevels(options.Logging.ComponentLevels)
+	if err != nil {
+		return err
+	}
+
 	err = log.SetDefaultLogger(options.Logging.Type, common.LogConfig{
-		FilePath:    options.Logging.LogFilePath,
-		MaxFileSize: options.Logging.MaxLogFileSize,
-		FileCount:   options.Logging.LogFileCount,
-		Level:       logLevel,
-		TimeTracker: options.Logging.TimeTracker,
+		FilePath:        options.Logging.LogFilePath,
+		MaxFileSize:     options.Logging.MaxLogFileSize,
+		FileCount:       options.Logging.LogFileCount,
+		Level:           logLevel,
+		TimeTracker:     options.Logging.TimeTracker,
+		ComponentLevels: componentLevels,
 	})
 
 	if err != nil {
@@ -162,12 +168,15 @@ func processCommand() error {
 	}
 
 	// Validate config is to be secured on write or not
-	if options.PassPhrase == "" {
-		options.PassPhrase = os.Getenv(SecureConfigEnvName)
-	}
+	if options.SecureConfig {
+		options.PassPhrase, err = getSecurePassphrase(options.PassPhrase, options.SecureKey)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase to encrypt config file [%s]", err.Error())
+		}
 
-	if options.SecureConfig && options.PassPhrase == "" {
-		return fmt.Errorf("key not provided to decrypt config file")
+		if options.PassPhrase == "" {
+			return fmt.Errorf("key not provided to decrypt config file")
+		}
 	}
 
 	containerList, err := getContainerList()
@@ -271,6 +280,19 @@ func mountAllContainers(containerList []string, configFile string, mountPath str
 	// Generate slice containing all the argument which we need to pass to each mount command
 	cliParams := buildCliParamForMount()
 
+	// Mounts of the containers decrypt their config with the same passphrase, its source may be in the config file alone
+	if options.SecureConfig {
+		if options.SecureKey.KeyFile != "" {
+			updateCliParams(&cliParams, "key-file", options.SecureKey.KeyFile)
+		}
+		if options.SecureKey.KeyCredential != "" {
+			updateCliParams(&cliParams, "key-credential", options.SecureKey.KeyCredential)
+		}
+		if options.SecureKey.KeyCommand != "" {
+			updateCliParams(&cliParams, "key-command", options.SecureKey.KeyCommand)
+		}
+	}
+
 	// Change the config file name per container
 	ext := filepath.Ext(configFile)
 	if ext == SecureConfigExtension {
@@ -358,7 +380,7 @@ func writeConfigFile(contConfigFile string) error {
 			return fmt.Errorf("failed to marshall yaml content")
 		}
 
-		cipherText, err := common.EncryptData(confStream, []byte(options.PassPhrase))
+		cipherText, err := common.EncryptSecureConfig(confStream, []byte(options.PassPhrase), common.DefaultKDF)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt yaml content [%s]", err.Error())
 		}
@@ -34,11 +34,15 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
 
@@ -52,11 +56,25 @@ type secureOptions struct {
 	OutputFile string
 	Key        string
 	Value      string
+	KDF        string
+	KeySource  secureKeyOptions
+}
+
+// secureKeyOptions : sources the passphrase of the secure config can be taken from instead of --passphrase
+type secureKeyOptions struct {
+	KeyFile       string `config:"key-file"`
+	KeyCredential string `config:"key-credential"`
+	KeyCommand    string `config:"key-command"`
 }
 
 const SecureConfigEnvName string = "BLOBFUSE2_SECURE_CONFIG_PASSPHRASE"
 const SecureConfigExtension string = ".azsec"
 
+// Systemd credential used for the passphrase when no other source is given
+const SecureConfigCredentialName string = "blobfuse2-passphrase"
+
+const secureKeyCommandTimeout = 30 * time.Second
+
 var secOpts secureOptions
 
 //     Section defining all the command that we have in secure feature
@@ -124,10 +142,6 @@ var decryptCmd = &cobra.Command{
 //--------------- command section ends
 
 func validateOptions() error {
-	if secOpts.PassPhrase == "" {
-		secOpts.PassPhrase = os.Getenv(SecureConfigEnvName)
-	}
-
 	if secOpts.ConfigFile == "" {
 		return errors.New("config file not provided, check usage")
 	}
@@ -136,13 +150,95 @@ func validateOptions() error {
 		return errors.New("config file does not exist")
 	}
 
+	var err error
+	secOpts.PassPhrase, err = getSecurePassphrase(secOpts.PassPhrase, secOpts.KeySource)
+	if err != nil {
+		return err
+	}
+
 	if secOpts.PassPhrase == "" {
-		return errors.New("provide the passphrase as a cli parameter or configure the BLOBFUSE2_SECURE_CONFIG_PASSPHRASE environment variable")
+		return errors.New("provide the passphrase as a cli parameter, through --key-file, --key-credential or --key-command or configure the BLOBFUSE2_SECURE_CONFIG_PASSPHRASE environment variable")
 	}
 
 	return nil
 }
 
+// getSecurePassphrase : Passphrase of the secure config, looked up in this order :
+// --passphrase, key file, named systemd credential, key command, environment variable and the default systemd credential.
+// Returns an empty passphrase if none of the sources is configured.
+func getSecurePassphrase(passphrase string, src secureKeyOptions) (string, error) {
+	if passphrase != "" {
+		return passphrase, nil
+	}
+
+	if src.KeyFile != "" {
+		data, err := ioutil.ReadFile(common.ExpandPath(src.KeyFile))
+		if err != nil {
+			return "", fmt.Errorf("failed to read key file %s [%s]", src.KeyFile, err.Error())
+		}
+		return trimPassphrase(data, "key file "+src.KeyFile)
+	}
+
+	if src.KeyCredential != "" {
+		data, err := readSystemdCredential(src.KeyCredential)
+		if err != nil {
+			return "", err
+		}
+		return trimPassphrase(data, "credential "+src.KeyCredential)
+	}
+
+	if src.KeyCommand != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), secureKeyCommandTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", src.KeyCommand)
+		cmd.Stderr = os.Stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("key command failed [%s]", err.Error())
+		}
+		return trimPassphrase(data, "key command")
+	}
+
+	if env := os.Getenv(SecureConfigEnvName); env != "" {
+		return env, nil
+	}
+
+	// Unit files can hand over the passphrase with LoadCredential=blobfuse2-passphrase:<path>
+	if data, err := readSystemdCredential(SecureConfigCredentialName); err == nil {
+		return trimPassphrase(data, "credential "+SecureConfigCredentialName)
+	}
+
+	return "", nil
+}
+
+// readSystemdCredential : Contents of a credential passed by systemd to the service
+func readSystemdCredential(name string) ([]byte, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, fmt.Errorf("credential %s requested but CREDENTIALS_DIRECTORY is not set, blobfuse2 is not run by systemd with credentials", name)
+	}
+
+	if strings.ContainsRune(name, '/') {
+		return nil, fmt.Errorf("invalid credential name %s", name)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential %s [%s]", name, err.Error())
+	}
+	return data, nil
+}
+
+// trimPassphrase : drop the line ending files and commands usually end with
+func trimPassphrase(data []byte, source string) (string, error) {
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("empty passphrase from %s", source)
+	}
+	return passphrase, nil
+}
+
 // encryptConfigFile: Encrypt config file using the passphrase provided by user
 func encryptConfigFile(saveConfig bool) ([]byte, error) {
 	plaintext, err := ioutil.ReadFile(secOpts.ConfigFile)
@@ -150,7 +246,7 @@ func encryptConfigFile(saveConfig bool) ([]byte, error) {
 		return nil, err
 	}
 
-	cipherText, err := common.EncryptData(plaintext, []byte(secOpts.PassPhrase))
+	cipherText, err := common.EncryptSecureConfig(plaintext, []byte(secOpts.PassPhrase), secOpts.KDF)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +273,7 @@ func decryptConfigFile(saveConfig bool) ([]byte, error) {
 		return nil, err
 	}
 
-	plainText, err := common.DecryptData(cipherText, []byte(secOpts.PassPhrase))
+	plainText, err := common.DecryptSecureConfig(cipherText, []byte(secOpts.PassPhrase))
 	if err != nil {
 		return nil, err
 	}
@@ -236,7 +332,23 @@ func init() {
 		"Configuration file to be encrypted / decrypted")
 
 	secureCmd.PersistentFlags().StringVar(&secOpts.PassPhrase, "passphrase", "",
-		"Key to be used for encryption / decryption. Can also be specified by env-variable BLOBFUSE2_SECURE_CONFIG_PASSPHRASE.\nKey length shall be 16 (AES-128), 24 (AES-192), or 32 (AES-256) bytes in length.")
+		"Passphrase to be used for encryption / decryption. Can also be specified by env-variable BLOBFUSE2_SECURE_CONFIG_PASSPHRASE.\nPassphrase shall be at least 8 characters long, the key is derived from it.")
+
+	secureCmd.PersistentFlags().StringVar(&secOpts.KeySource.KeyFile, "key-file", "",
+		"File holding the passphrase, used when --passphrase is not given.")
+	_ = secureCmd.MarkPersistentFlagFilename("key-file")
+
+	secureCmd.PersistentFlags().StringVar(&secOpts.KeySource.KeyCredential, "key-credential", "",
+		"Name of the systemd credential holding the passphrase, used when --passphrase is not given.")
+
+	secureCmd.PersistentFlags().StringVar(&secOpts.KeySource.KeyCommand, "key-command", "",
+		"Command printing the passphrase on its output, used when --passphrase is not given.")
+
+	secureCmd.PersistentFlags().StringVar(&secOpts.KDF, "kdf", "",
+		"Key derivation function used to encrypt the config. Allowed values are argon2id|scrypt. Default is argon2id, set keeps the one the file was encrypted with.")
+	_ = secureCmd.RegisterFlagCompletionFunc("kdf", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{common.KDFArgon2id, common.KDFScrypt}, cobra.ShellCompDirectiveNoFileComp
+	})
 
 	secureCmd.PersistentFlags().StringVar(&secOpts.OutputFile, "output-file", "",
 		"Path and name for the output file")
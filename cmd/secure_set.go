@@ -36,6 +36,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strings"
 
@@ -92,7 +93,15 @@ var setKeyCmd = &cobra.Command{
 			return fmt.Errorf("failed to marshal config [%s]", err.Error())
 		}
 
-		cipherText, err := common.EncryptData(confStream, []byte(secOpts.PassPhrase))
+		// Keep the KDF the file was encrypted with, files of the original format are moved to the current one
+		kdf := secOpts.KDF
+		if kdf == "" {
+			if current, err := ioutil.ReadFile(secOpts.ConfigFile); err == nil {
+				kdf = common.SecureConfigKDF(current)
+			}
+		}
+
+		cipherText, err := common.EncryptSecureConfig(confStream, []byte(secOpts.PassPhrase), kdf)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt config [%s]", err.Error())
 		}
@@ -38,6 +38,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
@@ -64,6 +65,7 @@ func (suite *secureConfigTestSuite) SetupTest() {
 
 func (suite *secureConfigTestSuite) cleanupTest() {
 	resetSecureCLIFlags()
+	secOpts = secureOptions{}
 }
 
 func executeCommandSecure(root *cobra.Command, args ...string) (output string, err error) {
@@ -278,3 +280,131 @@ func (suite *secureConfigTestSuite) TestSecureConfigSet() {
 	_, err = executeCommandSecure(rootCmd, "secure", "get", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=123123123123123123123123", "--key=logging.level")
 	suite.assert.Nil(err)
 }
+
+func (suite *secureConfigTestSuite) TestSecureConfigKeyFile() {
+	defer suite.cleanupTest()
+	confFile, _ := ioutil.TempFile("", "conf*.yaml")
+	outFile, _ := ioutil.TempFile("", "conf*.yaml")
+	keyFile, _ := ioutil.TempFile("", "key*")
+
+	defer os.Remove(confFile.Name())
+	defer os.Remove(outFile.Name())
+	defer os.Remove(keyFile.Name())
+
+	_, err := confFile.WriteString(testPlainTextConfig)
+	suite.assert.Nil(err)
+	_, err = keyFile.WriteString("passphrase from file\n")
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "encrypt", fmt.Sprintf("--config-file=%s", confFile.Name()), fmt.Sprintf("--key-file=%s", keyFile.Name()), fmt.Sprintf("--output-file=%s", outFile.Name()))
+	suite.assert.Nil(err)
+
+	// Line ending of the file is not part of the passphrase
+	_, err = executeCommandSecure(rootCmd, "secure", "get", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=passphrase from file", "--key=logging.level")
+	suite.assert.Nil(err)
+}
+
+func (suite *secureConfigTestSuite) TestSecureConfigKeyCommand() {
+	defer suite.cleanupTest()
+	confFile, _ := ioutil.TempFile("", "conf*.yaml")
+	outFile, _ := ioutil.TempFile("", "conf*.yaml")
+
+	defer os.Remove(confFile.Name())
+	defer os.Remove(outFile.Name())
+
+	_, err := confFile.WriteString(testPlainTextConfig)
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "encrypt", fmt.Sprintf("--config-file=%s", confFile.Name()), "--passphrase=passphrase from command", fmt.Sprintf("--output-file=%s", outFile.Name()))
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "get", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=", "--key-command=echo passphrase from command", "--key=logging.level")
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "get", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=", "--key-command=exit 1", "--key=logging.level")
+	suite.assert.NotNil(err)
+}
+
+func (suite *secureConfigTestSuite) TestSecureConfigCredential() {
+	defer suite.cleanupTest()
+	credDir, err := ioutil.TempDir("", "credentials")
+	suite.assert.Nil(err)
+	defer os.RemoveAll(credDir)
+
+	os.Setenv("CREDENTIALS_DIRECTORY", credDir)
+	defer os.Unsetenv("CREDENTIALS_DIRECTORY")
+
+	err = ioutil.WriteFile(filepath.Join(credDir, SecureConfigCredentialName), []byte("default credential"), 0600)
+	suite.assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(credDir, "custom"), []byte("custom credential\n"), 0600)
+	suite.assert.Nil(err)
+
+	passphrase, err := getSecurePassphrase("", secureKeyOptions{})
+	suite.assert.Nil(err)
+	suite.assert.Equal("default credential", passphrase)
+
+	passphrase, err = getSecurePassphrase("", secureKeyOptions{KeyCredential: "custom"})
+	suite.assert.Nil(err)
+	suite.assert.Equal("custom credential", passphrase)
+
+	_, err = getSecurePassphrase("", secureKeyOptions{KeyCredential: "missing"})
+	suite.assert.NotNil(err)
+
+	_, err = getSecurePassphrase("", secureKeyOptions{KeyCredential: "../custom"})
+	suite.assert.NotNil(err)
+
+	// Explicit passphrase wins over every other source
+	passphrase, err = getSecurePassphrase("explicit", secureKeyOptions{KeyCredential: "custom", KeyCommand: "echo command"})
+	suite.assert.Nil(err)
+	suite.assert.Equal("explicit", passphrase)
+}
+
+func (suite *secureConfigTestSuite) TestSecureConfigLegacyFormat() {
+	defer suite.cleanupTest()
+	outFile, _ := ioutil.TempFile("", "conf*.yaml")
+	defer os.Remove(outFile.Name())
+
+	// Config encrypted by earlier versions with the passphrase as the key
+	cipherText, err := common.EncryptData([]byte(testPlainTextConfig), []byte("123123123123123123123123"))
+	suite.assert.Nil(err)
+	err = ioutil.WriteFile(outFile.Name(), cipherText, 0644)
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "get", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=123123123123123123123123", "--key=logging.level")
+	suite.assert.Nil(err)
+
+	// Set writes the file back in the current format
+	_, err = executeCommandSecure(rootCmd, "secure", "set", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=123123123123123123123123", "--key=logging.level", "--value=log_err")
+	suite.assert.Nil(err)
+
+	cipherText, err = ioutil.ReadFile(outFile.Name())
+	suite.assert.Nil(err)
+	suite.assert.Equal(common.DefaultKDF, common.SecureConfigKDF(cipherText))
+
+	plainText, err := common.DecryptSecureConfig(cipherText, []byte("123123123123123123123123"))
+	suite.assert.Nil(err)
+	suite.assert.Contains(string(plainText), "log_err")
+}
+
+func (suite *secureConfigTestSuite) TestSecureConfigSetKeepsKDF() {
+	defer suite.cleanupTest()
+	confFile, _ := ioutil.TempFile("", "conf*.yaml")
+	outFile, _ := ioutil.TempFile("", "conf*.yaml")
+
+	defer os.Remove(confFile.Name())
+	defer os.Remove(outFile.Name())
+
+	_, err := confFile.WriteString(testPlainTextConfig)
+	suite.assert.Nil(err)
+
+	_, err = executeCommandSecure(rootCmd, "secure", "encrypt", fmt.Sprintf("--config-file=%s", confFile.Name()), "--passphrase=123123123123123123123123", "--kdf=scrypt", fmt.Sprintf("--output-file=%s", outFile.Name()))
+	suite.assert.Nil(err)
+	suite.cleanupTest()
+
+	_, err = executeCommandSecure(rootCmd, "secure", "set", fmt.Sprintf("--config-file=%s", outFile.Name()), "--passphrase=123123123123123123123123", "--key=logging.level", "--value=log_err")
+	suite.assert.Nil(err)
+
+	cipherText, err := ioutil.ReadFile(outFile.Name())
+	suite.assert.Nil(err)
+	suite.assert.Equal(common.KDFScrypt, common.SecureConfigKDF(cipherText))
+}
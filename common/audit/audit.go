@@ -0,0 +1,280 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+)
+
+// Operations recorded in the audit log
+const (
+	OpCreate     = "create"
+	OpWriteClose = "write-close"
+	OpRename     = "rename"
+	OpUnlink     = "unlink"
+	OpRmdir      = "rmdir"
+	OpChmod      = "chmod"
+	OpChown      = "chown"
+	OpTruncate   = "truncate"
+	OpCopyRange  = "copy-range"
+)
+
+// Outcome of the operation as returned to the kernel
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Destinations the audit log can be written to
+const (
+	TypeFile   = "file"
+	TypeSyslog = "syslog"
+)
+
+const (
+	DefaultMaxFileSize = 512 // in MB
+	DefaultFileCount   = 10
+	DefaultFacility    = "authpriv"
+	DefaultTag         = "blobfuse2-audit"
+)
+
+// Events waiting to be written, beyond this callers wait for the writer unless dropping is allowed
+const queueSize = 16384
+
+// Config : where the audit log is written to
+type Config struct {
+	Type        string
+	FilePath    string // audit log file for file type
+	MaxFileSize uint64 // size in MB after which the file is rotated
+	FileCount   uint64 // number of rotated files to keep
+	Facility    string // syslog facility for syslog type
+	Tag         string // syslog tag for syslog type
+	DropOnFull  bool   // drop events rather than hold up file system calls when the writer can not keep up
+}
+
+// Event : one mutating operation done through the mount
+type Event struct {
+	Timestamp string `json:"timestamp"`
+	Operation string `json:"operation"`
+	Path      string `json:"path,omitempty"`
+	Target    string `json:"target,omitempty"` // destination of a rename or copy-range
+	Mode      string `json:"mode,omitempty"`   // mode asked for by create and chmod
+	Owner     string `json:"owner,omitempty"`  // uid:gid asked for by chown
+	Offset    string `json:"offset,omitempty"` // offset in the target where copy-range wrote
+	Size      string `json:"size,omitempty"`   // size asked for by truncate, bytes written by copy-range
+	UID       uint32 `json:"uid"`              // identity of the process which asked for the operation
+	GID       uint32 `json:"gid"`
+	PID       int32  `json:"pid"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	Dropped   uint64 `json:"dropped,omitempty"` // events lost before this one as the queue was full, only with DropOnFull
+}
+
+// sink : destination of the encoded events
+type sink interface {
+	write(data []byte) error
+	close() error
+}
+
+type auditor struct {
+	sink       sink
+	events     chan Event
+	done       chan bool
+	wg         sync.WaitGroup
+	dropOnFull bool
+	dropped    uint64
+}
+
+var defaultAuditor *auditor
+
+// Setup : Start writing the audit log, nothing is recorded till this is called
+func Setup(cfg Config) error {
+	var s sink
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeFile:
+		if cfg.FilePath == "" {
+			return fmt.Errorf("file-path is required for file based audit log")
+		}
+		if cfg.MaxFileSize == 0 {
+			cfg.MaxFileSize = DefaultMaxFileSize
+		}
+		if cfg.FileCount == 0 {
+			cfg.FileCount = DefaultFileCount
+		}
+
+		fileOut, err := newFileSink(cfg.FilePath, cfg.MaxFileSize*1024*1024, cfg.FileCount)
+		if err != nil {
+			return err
+		}
+		s = fileOut
+
+	case TypeSyslog:
+		if cfg.Facility == "" {
+			cfg.Facility = DefaultFacility
+		}
+		if cfg.Tag == "" {
+			cfg.Tag = DefaultTag
+		}
+
+		syslogOut, err := newSyslogSink(cfg.Facility, cfg.Tag)
+		if err != nil {
+			return err
+		}
+		s = syslogOut
+
+	default:
+		return fmt.Errorf("invalid audit log type %s", cfg.Type)
+	}
+
+	log.Info("audit::Setup : Recording mutating operations to %s audit log", cfg.Type)
+	defaultAuditor = newAuditor(s)
+	defaultAuditor.dropOnFull = cfg.DropOnFull
+	return nil
+}
+
+// Destroy : Write the events still queued and stop recording
+func Destroy() {
+	if defaultAuditor == nil {
+		return
+	}
+
+	defaultAuditor.close()
+	defaultAuditor = nil
+}
+
+// Enabled : Check whether operations are being recorded
+func Enabled() bool {
+	return defaultAuditor != nil
+}
+
+// Record : Queue the event to be written. When the writer can not keep up the caller waits for room in the queue,
+// unless dropping is allowed, then the event is dropped and the count of dropped events is written with the next one.
+func Record(ev Event) {
+	a := defaultAuditor
+	if a == nil {
+		return
+	}
+
+	if ev.Timestamp == "" {
+		ev.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+	if ev.Result == "" {
+		ev.Result = ResultSuccess
+	}
+
+	a.queue(ev)
+}
+
+func newAuditor(s sink) *auditor {
+	a := &auditor{
+		sink:   s,
+		events: make(chan Event, queueSize),
+		done:   make(chan bool),
+	}
+
+	a.wg.Add(1)
+	go a.worker()
+	return a
+}
+
+func (a *auditor) queue(ev Event) {
+	select {
+	case a.events <- ev:
+		return
+	default:
+	}
+
+	if a.dropOnFull {
+		if atomic.AddUint64(&a.dropped, 1) == 1 {
+			log.Err("audit::Record : Audit log can not keep up, dropping events")
+		}
+		return
+	}
+
+	select {
+	case a.events <- ev:
+	case <-a.done:
+		log.Err("audit::Record : Audit log closed, %s of %s not recorded", ev.Operation, ev.Path)
+	}
+}
+
+func (a *auditor) close() {
+	close(a.done)
+	a.wg.Wait()
+
+	err := a.sink.close()
+	if err != nil {
+		log.Err("audit::close : Failed to close audit log [%s]", err.Error())
+	}
+}
+
+func (a *auditor) worker() {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case ev := <-a.events:
+			a.write(ev)
+
+		case <-a.done:
+			for {
+				select {
+				case ev := <-a.events:
+					a.write(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *auditor) write(ev Event) {
+	ev.Dropped = atomic.SwapUint64(&a.dropped, 0)
+
+	data, err := json.Marshal(ev)
+	if err == nil {
+		err = a.sink.write(data)
+	}
+	if err != nil {
+		log.Err("audit::write : Failed to record %s of %s [%s]", ev.Operation, ev.Path, err.Error())
+	}
+}
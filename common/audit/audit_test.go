@@ -0,0 +1,248 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type auditTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+	dir    string
+}
+
+func (suite *auditTestSuite) SetupTest() {
+	err := log.SetDefaultLogger("silent", common.LogConfig{Level: common.ELogLevel.LOG_DEBUG()})
+	if err != nil {
+		panic("Unable to set silent logger as default.")
+	}
+	suite.assert = assert.New(suite.T())
+
+	suite.dir, err = ioutil.TempDir("", "audit")
+	suite.assert.Nil(err)
+}
+
+func (suite *auditTestSuite) TearDownTest() {
+	Destroy()
+	os.RemoveAll(suite.dir)
+}
+
+func readEvents(suite *auditTestSuite, path string) []Event {
+	f, err := os.Open(path)
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	events := make([]Event, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ev := Event{}
+		suite.assert.Nil(json.Unmarshal(scanner.Bytes(), &ev), scanner.Text())
+		events = append(events, ev)
+	}
+	return events
+}
+
+// blockingSink : holds up writes till released, to fill the queue
+type blockingSink struct {
+	release chan bool
+	written int
+	dropped uint64
+}
+
+func (s *blockingSink) write(data []byte) error {
+	<-s.release
+	s.written++
+
+	ev := Event{}
+	if err := json.Unmarshal(data, &ev); err == nil {
+		s.dropped += ev.Dropped
+	}
+	return nil
+}
+
+func (s *blockingSink) close() error {
+	return nil
+}
+
+func (suite *auditTestSuite) TestDisabled() {
+	suite.assert.False(Enabled())
+
+	// Nothing to record to, shall not fail
+	Record(Event{Operation: OpUnlink, Path: "a.txt"})
+}
+
+func (suite *auditTestSuite) TestInvalidConfig() {
+	err := Setup(Config{Type: "invalid"})
+	suite.assert.NotNil(err)
+
+	err = Setup(Config{Type: TypeFile})
+	suite.assert.NotNil(err)
+
+	err = Setup(Config{Type: TypeSyslog, Facility: "invalid"})
+	suite.assert.NotNil(err)
+
+	suite.assert.False(Enabled())
+}
+
+func (suite *auditTestSuite) TestFile() {
+	path := filepath.Join(suite.dir, "audit.log")
+	err := Setup(Config{Type: TypeFile, FilePath: path})
+	suite.assert.Nil(err)
+	suite.assert.True(Enabled())
+
+	Record(Event{Operation: OpCreate, Path: "dir/a.txt", Mode: "0644", UID: 1000, GID: 1000, PID: 42})
+	Record(Event{Operation: OpRename, Path: "dir/a.txt", Target: "dir/b.txt", UID: 1000, GID: 1000, PID: 42})
+	Record(Event{Operation: OpUnlink, Path: "dir/c.txt", UID: 0, GID: 0, PID: 7, Result: ResultFailure, Error: "no such file or directory"})
+	Destroy()
+	suite.assert.False(Enabled())
+
+	fi, err := os.Stat(path)
+	suite.assert.Nil(err)
+	suite.assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	events := readEvents(suite, path)
+	suite.assert.Len(events, 3)
+
+	suite.assert.Equal(OpCreate, events[0].Operation)
+	suite.assert.Equal("dir/a.txt", events[0].Path)
+	suite.assert.Equal("0644", events[0].Mode)
+	suite.assert.Equal(uint32(1000), events[0].UID)
+	suite.assert.Equal(int32(42), events[0].PID)
+	suite.assert.Equal(ResultSuccess, events[0].Result)
+	suite.assert.NotEmpty(events[0].Timestamp)
+
+	suite.assert.Equal(OpRename, events[1].Operation)
+	suite.assert.Equal("dir/b.txt", events[1].Target)
+
+	suite.assert.Equal(ResultFailure, events[2].Result)
+	suite.assert.Equal("no such file or directory", events[2].Error)
+
+	// Reopening appends to the same file
+	err = Setup(Config{Type: TypeFile, FilePath: path})
+	suite.assert.Nil(err)
+	Record(Event{Operation: OpRmdir, Path: "dir"})
+	Destroy()
+
+	events = readEvents(suite, path)
+	suite.assert.Len(events, 4)
+	suite.assert.Equal(OpRmdir, events[3].Operation)
+}
+
+func (suite *auditTestSuite) TestFileRotation() {
+	path := filepath.Join(suite.dir, "audit.log")
+	s, err := newFileSink(path, 1024, 3)
+	suite.assert.Nil(err)
+
+	defaultAuditor = newAuditor(s)
+	for i := 0; i < 100; i++ {
+		Record(Event{Operation: OpChmod, Path: "dir/a.txt", Mode: "0755"})
+	}
+	Destroy()
+
+	files, err := ioutil.ReadDir(suite.dir)
+	suite.assert.Nil(err)
+	suite.assert.Len(files, 3)
+	for _, fi := range files {
+		suite.assert.LessOrEqual(fi.Size(), int64(2048))
+	}
+
+	_, err = os.Stat(path + ".3")
+	suite.assert.True(os.IsNotExist(err))
+}
+
+func (suite *auditTestSuite) TestQueueFull() {
+	s := &blockingSink{release: make(chan bool)}
+	defaultAuditor = newAuditor(s)
+
+	// Worker holds one event and the queue the rest, the next caller waits for room instead of losing its event
+	for i := 0; i < queueSize+1; i++ {
+		Record(Event{Operation: OpChown, Path: "a.txt", Owner: "0:0"})
+	}
+
+	recorded := make(chan bool)
+	go func() {
+		Record(Event{Operation: OpUnlink, Path: "last.txt"})
+		close(recorded)
+	}()
+
+	select {
+	case <-recorded:
+		suite.Fail("event queued while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(s.release)
+	<-recorded
+	Destroy()
+
+	suite.assert.Equal(queueSize+2, s.written)
+	suite.assert.EqualValues(0, s.dropped)
+}
+
+func (suite *auditTestSuite) TestQueueFullDrop() {
+	s := &blockingSink{release: make(chan bool)}
+	defaultAuditor = newAuditor(s)
+	defaultAuditor.dropOnFull = true
+
+	// Worker holds one event, the queue the rest, Record shall return right away for the ones beyond
+	for i := 0; i < queueSize+10; i++ {
+		Record(Event{Operation: OpChown, Path: "a.txt", Owner: "0:0"})
+	}
+	close(s.release)
+
+	Record(Event{Operation: OpUnlink, Path: "last.txt"})
+	Destroy()
+
+	// Every event is either written or counted as dropped
+	suite.assert.Less(s.written, queueSize+11)
+	suite.assert.Greater(s.dropped, uint64(0))
+	suite.assert.Equal(uint64(queueSize+11), uint64(s.written)+s.dropped)
+}
+
+func TestAudit(t *testing.T) {
+	suite.Run(t, new(auditTestSuite))
+}
@@ -0,0 +1,153 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package audit
+
+import (
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+)
+
+// fileSink : appends one event per line to a file, rotated the same way as the base logger
+type fileSink struct {
+	path        string
+	maxSize     uint64
+	fileCount   uint64
+	currentSize uint64
+	f           *os.File
+}
+
+func newFileSink(path string, maxSize uint64, fileCount uint64) (*fileSink, error) {
+	s := &fileSink{
+		path:      path,
+		maxSize:   maxSize,
+		fileCount: fileCount,
+	}
+
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	// Audit log tells who touched what, keep it to the owner of the mount
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s [%s]", s.path, err.Error())
+	}
+
+	s.currentSize = 0
+	if fi, err := f.Stat(); err == nil {
+		s.currentSize = uint64(fi.Size())
+	}
+	s.f = f
+	return nil
+}
+
+func (s *fileSink) write(data []byte) error {
+	n, err := s.f.Write(append(data, '\n'))
+	s.currentSize += uint64(n)
+	if err != nil {
+		return err
+	}
+
+	if s.currentSize > s.maxSize {
+		return s.rotate()
+	}
+	return nil
+}
+
+// rotate : shift <path>.1 ... <path>.<count-1> by one, dropping the oldest, and start a new file
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.fileCount-1))
+	for i := int64(s.fileCount) - 2; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	_ = os.Rename(s.path, s.path+".1")
+
+	return s.open()
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+// syslogSink : sends each event to syslog under the given facility
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+func newSyslogSink(facility string, tag string) (*syslogSink, error) {
+	priority, found := syslogFacilities[strings.ToLower(facility)]
+	if !found {
+		return nil, fmt.Errorf("invalid syslog facility %s", facility)
+	}
+
+	w, err := syslog.New(priority|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog [%s]", err.Error())
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) write(data []byte) error {
+	return s.w.Notice(string(data))
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
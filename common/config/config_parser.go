@@ -137,24 +137,13 @@ func WatchConfig() {
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		log.Crit("WatchConfig : Config change detected")
 		if userOptions.secureConfig {
-			cipherText, err := ioutil.ReadFile(userOptions.path)
+			loaded, err := readSecureConfigFile()
 			if err != nil {
-				log.Err("WatchConfig : Failed to read encrypted config file [%s]", err.Error())
+				log.Err("WatchConfig : %s", err.Error())
 				return
 			}
 
-			if len(cipherText) == 0 {
-				return
-			}
-
-			plainText, err := common.DecryptData(cipherText, []byte(userOptions.passphrase))
-			if err != nil {
-				log.Err("WatchConfig : Failed to decrypt config file [%s]", err.Error())
-				return
-			}
-			err = loadConfigFromBufferToViper(plainText)
-			if err != nil {
-				log.Err("WatchConfig : Failed to load decrypted config file [%s]", err.Error())
+			if !loaded {
 				return
 			}
 		}
@@ -162,6 +151,55 @@ func WatchConfig() {
 	})
 }
 
+// readSecureConfigFile : decrypt the config file and load it, an empty file is skipped as it is being rewritten
+func readSecureConfigFile() (bool, error) {
+	cipherText, err := ioutil.ReadFile(userOptions.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read encrypted config file [%s]", err.Error())
+	}
+
+	if len(cipherText) == 0 {
+		return false, nil
+	}
+
+	plainText, err := common.DecryptSecureConfig(cipherText, []byte(userOptions.passphrase))
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt config file [%s]", err.Error())
+	}
+	err = loadConfigFromBufferToViper(plainText)
+	if err != nil {
+		return false, fmt.Errorf("failed to load decrypted config file [%s]", err.Error())
+	}
+
+	return true, nil
+}
+
+// ReloadConfig : Read the config file again and notify the listeners.
+// Used to apply changes on demand, e.g. on SIGUSR1, where the file watcher did not pick them up.
+func ReloadConfig() error {
+	if userOptions.path == "" {
+		return fmt.Errorf("no config file to reload")
+	}
+
+	if userOptions.secureConfig {
+		loaded, err := readSecureConfigFile()
+		if err != nil {
+			return err
+		}
+		if !loaded {
+			return fmt.Errorf("config file %s is empty", userOptions.path)
+		}
+	} else {
+		err := viper.ReadInConfig()
+		if err != nil {
+			return err
+		}
+	}
+
+	OnConfigChange()
+	return nil
+}
+
 func ReadConfigFromReader(reader io.Reader) error {
 	viper.SetConfigType("yaml")
 	err := viper.ReadConfig(reader)
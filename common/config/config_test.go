@@ -34,7 +34,9 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -406,6 +408,53 @@ func (suite *ConfigTestSuite) TestFlagShadowedConfigReader() {
 
 }
 
+func (suite *ConfigTestSuite) TestReloadConfig() {
+	defer suite.cleanupTest()
+	assert := assert.New(suite.T())
+
+	err := ReloadConfig()
+	assert.NotNil(err)
+
+	dir, err := ioutil.TempDir("", "reloadconfig")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(path, []byte("name: default\nlabels:\n  app: web\n"), 0644)
+	assert.Nil(err)
+
+	SetConfigFile(path)
+	changes := 0
+	AddConfigChangeEventListener(ConfigChangeEventHandlerFunc(func() { changes++ }))
+
+	err = ReloadConfig()
+	assert.Nil(err)
+	assert.Equal(1, changes)
+
+	metaOpts := &Metadata{}
+	err = Unmarshal(metaOpts)
+	assert.Nil(err)
+	assert.Equal("web", metaOpts.Label.App)
+
+	// Changes to the file are picked up on reload
+	err = ioutil.WriteFile(path, []byte("name: default\nlabels:\n  app: db\n"), 0644)
+	assert.Nil(err)
+
+	err = ReloadConfig()
+	assert.Nil(err)
+	assert.Equal(2, changes)
+
+	err = Unmarshal(metaOpts)
+	assert.Nil(err)
+	assert.Equal("db", metaOpts.Label.App)
+
+	// Listeners are not notified of a file that cannot be read
+	os.Remove(path)
+	err = ReloadConfig()
+	assert.NotNil(err)
+	assert.Equal(2, changes)
+}
+
 func (suite *ConfigTestSuite) cleanupTest() {
 	ResetConfig()
 }
@@ -65,11 +65,15 @@ type BaseLogger struct {
 	logFileHandle io.WriteCloser
 	procPID       int
 
+	// format turns an event into the line written to the log file
+	format func(lvl string, file string, line int, msg string) string
+
 	fileConfig LogFileConfig
 }
 
 func newBaseLogger(config LogFileConfig) (*BaseLogger, error) {
 	l := &BaseLogger{fileConfig: config}
+	l.format = l.textFormat
 	err := l.init()
 	if err != nil {
 		return nil, err
@@ -219,15 +223,19 @@ func (l *BaseLogger) logEvent(lvl string, format string, args ...interface{}) {
 	// Only log if the log level matches the log request
 	_, fn, ln, _ := runtime.Caller(3)
 	msg := fmt.Sprintf(format, args...)
-	msg = fmt.Sprintf("%s : %s[%d] : %s [%s (%d)]: %s",
+
+	l.channel <- l.format(lvl, filepath.Base(fn), ln, msg)
+}
+
+// textFormat : free form log line, "<time> : <tag>[<pid>] : <level> [<file> (<line>)]: <msg>"
+func (l *BaseLogger) textFormat(lvl string, file string, line int, msg string) string {
+	return fmt.Sprintf("%s : %s[%d] : %s [%s (%d)]: %s",
 		time.Now().Format(time.UnixDate),
 		l.fileConfig.LogTag,
 		l.procPID,
 		lvl,
-		filepath.Base(fn), ln,
+		file, line,
 		msg)
-
-	l.channel <- msg
 }
 
 // logDumper : logEvent just enqueues an event in the channel, this thread dumps that log to the file
@@ -0,0 +1,130 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package log
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+)
+
+// JsonLogger : File based logger writing one JSON object per line for log shippers to ingest without parsing.
+// Files are rotated the same way as the base logger.
+type JsonLogger struct {
+	*BaseLogger
+}
+
+// jsonLogEntry : fields of one line, component, operation, path and error are filled when they can be told from the message
+type jsonLogEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Pid       int    `json:"pid"`
+	Tag       string `json:"tag"`
+	Component string `json:"component,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+}
+
+var (
+	// Messages start with "Component::Operation : ", e.g. "FileCache::OpenFile : name=a.txt"
+	logPrefixRegex = regexp.MustCompile(`^\s*([\w.-]+)::([\w.-]+)\s*:\s*`)
+
+	// Path given as name=, path= or file=
+	logPathRegex = regexp.MustCompile(`\b(?:name|path|file)\s*[=:]\s*([^\s,\]]+)`)
+
+	// Errors are appended to the message in brackets, e.g. "Failed to open file [no such file or directory]"
+	logErrorRegex = regexp.MustCompile(`\[([^\[\]]+)\]\s*$`)
+)
+
+func newJsonLogger(config LogFileConfig) (*JsonLogger, error) {
+	l := &JsonLogger{BaseLogger: &BaseLogger{fileConfig: config}}
+	l.format = l.jsonFormat
+
+	err := l.init()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *JsonLogger) GetType() string {
+	return "json"
+}
+
+// jsonFormat : encode the event as a JSON object, level names are reported without the LOG_ prefix in lower case
+func (l *JsonLogger) jsonFormat(lvl string, file string, line int, msg string) string {
+	entry := jsonLogEntry{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Level:     strings.ToLower(strings.TrimPrefix(lvl, "LOG_")),
+		Pid:       l.procPID,
+		Tag:       l.fileConfig.LogTag,
+		Message:   msg,
+		File:      file,
+		Line:      line,
+	}
+
+	body := msg
+	if match := logPrefixRegex.FindStringSubmatch(msg); match != nil {
+		entry.Component = match[1]
+		entry.Operation = match[2]
+		body = msg[len(match[0]):]
+	}
+
+	if match := logPathRegex.FindStringSubmatch(body); match != nil {
+		entry.Path = match[1]
+	} else if entry.Operation != "" && body != "" && !strings.ContainsAny(body, " \t[") {
+		// Message made of nothing but the path the operation is called on, e.g. "AzStorage::DeleteDir : dir1"
+		entry.Path = body
+	}
+
+	switch lvl {
+	case common.ELogLevel.LOG_WARNING().String(), common.ELogLevel.LOG_ERR().String(), common.ELogLevel.LOG_CRIT().String():
+		if match := logErrorRegex.FindStringSubmatch(body); match != nil {
+			entry.Error = match[1]
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return l.textFormat(lvl, file, line, msg)
+	}
+	return string(data)
+}
@@ -35,8 +35,13 @@ package log
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
@@ -84,6 +89,18 @@ func NewLogger(name string, config common.LogConfig) (Logger, error) {
 			return nil, err
 		}
 		return baseLogger, nil
+	} else if name == "json" {
+		jsonLogger, err := newJsonLogger(LogFileConfig{
+			LogFile:      config.FilePath,
+			LogLevel:     config.Level,
+			LogSize:      config.MaxFileSize * 1024 * 1024,
+			LogFileCount: int(config.FileCount),
+			LogTag:       config.Tag,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jsonLogger, nil
 	} else if name == "silent" {
 		silentLogger := &SilentLogger{}
 		return silentLogger, nil
@@ -105,6 +122,19 @@ func NewLogger(name string, config common.LogConfig) (Logger, error) {
 var logObj Logger
 var timeTracker bool
 
+// componentLevels : Log levels of the components which do not log at the default level.
+// The logger itself is set to the most verbose of these levels and events of the other components are filtered here.
+type componentLevels struct {
+	defaultLevel common.LogLevel
+	levels       map[string]common.LogLevel
+}
+
+// Holds *componentLevels, nil when all components log at the default level
+var levelOverrides atomic.Value
+
+// Component name of each call site logging an event, keyed by program counter
+var callerComponents sync.Map
+
 // ------------------ Public methods to use logging lib ------------------
 
 func GetLoggerObj() *log.Logger {
@@ -129,6 +159,11 @@ func SetDefaultLogger(name string, config common.LogConfig) error {
 	if err != nil || logObj == nil {
 		return err
 	}
+
+	levelOverrides.Store((*componentLevels)(nil))
+	if len(config.ComponentLevels) > 0 {
+		setLevels(config.Level, config.ComponentLevels)
+	}
 	return nil
 }
 
@@ -142,8 +177,15 @@ func SetConfig(config common.LogConfig) error {
 				return err
 			}
 		}
-		if config.Level != common.ELogLevel.INVALID() {
-			logObj.SetLogLevel(config.Level)
+		if config.ComponentLevels != nil {
+			// Components not listed in the new config go back to the default level
+			defaultLevel := GetDefaultLogLevel()
+			if config.Level != common.ELogLevel.INVALID() {
+				defaultLevel = config.Level
+			}
+			setLevels(defaultLevel, config.ComponentLevels)
+		} else if config.Level != common.ELogLevel.INVALID() {
+			setDefaultLevel(config.Level)
 		}
 		if config.MaxFileSize != 0 {
 			logObj.SetMaxLogSize(int(config.MaxFileSize))
@@ -178,11 +220,120 @@ func SetLogFileCount(count int) {
 // SetLogLevel : Reset the log level
 func SetLogLevel(lvl common.LogLevel) {
 	if logObj != nil {
-		logObj.SetLogLevel(lvl)
+		setDefaultLevel(lvl)
 		Crit("SetLogLevel : Log level reset to : %s", lvl.String())
 	}
 }
 
+// setDefaultLevel : Reset the level of the components which do not have one of their own
+func setDefaultLevel(lvl common.LogLevel) {
+	if overrides := getLevelOverrides(); overrides != nil {
+		setLevels(lvl, overrides.levels)
+	} else {
+		logObj.SetLogLevel(lvl)
+	}
+}
+
+// SetComponentLogLevels : Reset the levels of the components which shall not log at the default level.
+// Components are named after their package e.g. azstorage, file_cache or libfuse, an empty map clears all overrides.
+func SetComponentLogLevels(levels map[string]common.LogLevel) {
+	if logObj != nil {
+		setLevels(GetDefaultLogLevel(), levels)
+	}
+}
+
+// GetDefaultLogLevel : Level of the components which do not have a level of their own
+func GetDefaultLogLevel() common.LogLevel {
+	if overrides := getLevelOverrides(); overrides != nil {
+		return overrides.defaultLevel
+	}
+	return logObj.GetLogLevel()
+}
+
+func getLevelOverrides() *componentLevels {
+	overrides, _ := levelOverrides.Load().(*componentLevels)
+	return overrides
+}
+
+// setLevels : Set the logger to the most verbose level asked for and record the levels to filter events on
+func setLevels(defaultLevel common.LogLevel, levels map[string]common.LogLevel) {
+	if len(levels) == 0 {
+		levelOverrides.Store((*componentLevels)(nil))
+		if logObj.GetLogLevel() != defaultLevel {
+			logObj.SetLogLevel(defaultLevel)
+		}
+		return
+	}
+
+	overrides := &componentLevels{
+		defaultLevel: defaultLevel,
+		levels:       make(map[string]common.LogLevel, len(levels)),
+	}
+
+	maxLevel := defaultLevel
+	names := make([]string, 0, len(levels))
+	for name, lvl := range levels {
+		name = strings.ToLower(strings.TrimSpace(name))
+		overrides.levels[name] = lvl
+		names = append(names, fmt.Sprintf("%s=%s", name, lvl.String()))
+		if lvl > maxLevel {
+			maxLevel = lvl
+		}
+	}
+	sort.Strings(names)
+
+	levelOverrides.Store(overrides)
+	if logObj.GetLogLevel() != maxLevel {
+		logObj.SetLogLevel(maxLevel)
+	}
+	logObj.Crit("SetComponentLogLevels : Default level %s, component levels %s", defaultLevel.String(), strings.Join(names, " "))
+}
+
+// componentEnabled : Check the event against the level of the component logging it, when components have levels of their own.
+func componentEnabled(lvl common.LogLevel) bool {
+	overrides := getLevelOverrides()
+	if overrides == nil {
+		return true
+	}
+
+	// Cheaper check first, nothing above the level of the logger is written anyway
+	if lvl > logObj.GetLogLevel() {
+		return false
+	}
+
+	// Skip runtime.Callers, componentEnabled and the public logging method
+	var pc [1]uintptr
+	if runtime.Callers(3, pc[:]) == 0 {
+		return lvl <= overrides.defaultLevel
+	}
+
+	componentLevel, found := overrides.levels[callerComponent(pc[0])]
+	if !found {
+		componentLevel = overrides.defaultLevel
+	}
+	return lvl <= componentLevel
+}
+
+// callerComponent : Package name of the function logging the event, e.g. azstorage for
+// github.com/Azure/azure-storage-fuse/v2/component/azstorage.(*BlockBlob).List
+func callerComponent(pc uintptr) string {
+	if name, found := callerComponents.Load(pc); found {
+		return name.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := frame.Function
+	if idx := strings.LastIndex(name, "/"); idx != -1 {
+		name = name[idx+1:]
+	}
+	if idx := strings.Index(name, "."); idx != -1 {
+		name = name[:idx]
+	}
+
+	callerComponents.Store(pc, name)
+	return name
+}
+
 // Destroy : DeInitialize the logging library
 func Destroy() error {
 	return logObj.Destroy()
@@ -192,31 +343,49 @@ func Destroy() error {
 
 // Debug : Debug message logging
 func Debug(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_DEBUG()) {
+		return
+	}
 	logObj.Debug(msg, args...)
 }
 
 // Trace : Trace message logging
 func Trace(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_TRACE()) {
+		return
+	}
 	logObj.Trace(msg, args...)
 }
 
 // Info : Info message logging
 func Info(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_INFO()) {
+		return
+	}
 	logObj.Info(msg, args...)
 }
 
 // Warn : Warning message logging
 func Warn(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_WARNING()) {
+		return
+	}
 	logObj.Warn(msg, args...)
 }
 
 // Err : Error message logging
 func Err(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_ERR()) {
+		return
+	}
 	logObj.Err(msg, args...)
 }
 
 // Crit : Critical message logging
 func Crit(msg string, args ...interface{}) {
+	if !componentEnabled(common.ELogLevel.LOG_CRIT()) {
+		return
+	}
 	logObj.Crit(msg, args...)
 }
 
@@ -34,6 +34,14 @@
 package log
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
@@ -110,6 +118,164 @@ func (lts *LoggerTestSuite) TestBaseLogger() {
 	assert.Nil(err, "Failed to release base logger")
 }
 
+func (lts *LoggerTestSuite) TestJsonLogger() {
+	assert := assert.New(lts.T())
+
+	dir, err := ioutil.TempDir("", "jsonlogger")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	cfg := common.LogConfig{
+		FilePath:    filepath.Join(dir, "logfile.json"),
+		MaxFileSize: 1,
+		FileCount:   3,
+		Level:       common.ELogLevel.LOG_DEBUG(),
+		Tag:         "blobfuse2",
+	}
+	err = SetDefaultLogger("json", cfg)
+	assert.Nil(err, "Failed to set json logger")
+	assert.Equal("json", GetType())
+
+	Err("FileCache::OpenFile : Failed to open file name=dir/a.txt [no such file or directory]")
+	Info("Libfuse::libfuse_rmdir : dir1")
+
+	SetLogLevel(common.ELogLevel.LOG_DEBUG())
+	fastTestDebug(lts)
+
+	err = Destroy()
+	assert.Nil(err, "Failed to release json logger")
+
+	// Rotation keeps at most file-count files
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.LessOrEqual(len(files), 3)
+	assert.Greater(len(files), 1)
+
+	// Every line of the rotated files is a complete JSON object
+	for _, fi := range files {
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		assert.Nil(err)
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			entry := jsonLogEntry{}
+			assert.Nil(json.Unmarshal(scanner.Bytes(), &entry), scanner.Text())
+			assert.Equal("blobfuse2", entry.Tag)
+			assert.Equal(os.Getpid(), entry.Pid)
+			assert.NotEmpty(entry.Timestamp)
+		}
+		f.Close()
+	}
+}
+
+func (lts *LoggerTestSuite) TestJsonFormat() {
+	assert := assert.New(lts.T())
+
+	l := &JsonLogger{BaseLogger: &BaseLogger{fileConfig: LogFileConfig{LogTag: "blobfuse2"}, procPID: 10}}
+
+	entry := jsonLogEntry{}
+	err := json.Unmarshal([]byte(l.jsonFormat("LOG_ERR", "file_cache.go", 20, "FileCache::OpenFile : Failed to open file name=dir/a.txt [no such file or directory]")), &entry)
+	assert.Nil(err)
+	assert.Equal("err", entry.Level)
+	assert.Equal(10, entry.Pid)
+	assert.Equal("blobfuse2", entry.Tag)
+	assert.Equal("FileCache", entry.Component)
+	assert.Equal("OpenFile", entry.Operation)
+	assert.Equal("dir/a.txt", entry.Path)
+	assert.Equal("no such file or directory", entry.Error)
+	assert.Equal("file_cache.go", entry.File)
+	assert.Equal(20, entry.Line)
+
+	// Path given as the whole message
+	entry = jsonLogEntry{}
+	err = json.Unmarshal([]byte(l.jsonFormat("LOG_TRACE", "azstorage.go", 30, "AzStorage::DeleteDir : dir1")), &entry)
+	assert.Nil(err)
+	assert.Equal("trace", entry.Level)
+	assert.Equal("AzStorage", entry.Component)
+	assert.Equal("DeleteDir", entry.Operation)
+	assert.Equal("dir1", entry.Path)
+	assert.Empty(entry.Error)
+
+	// Brackets are not taken as error below warning level
+	entry = jsonLogEntry{}
+	err = json.Unmarshal([]byte(l.jsonFormat("LOG_DEBUG", "block_blob.go", 40, "BlockBlob::List : prefix [dir1]")), &entry)
+	assert.Nil(err)
+	assert.Empty(entry.Error)
+	assert.Empty(entry.Path)
+
+	// Free form message
+	entry = jsonLogEntry{}
+	err = json.Unmarshal([]byte(l.jsonFormat("LOG_CRIT", "mount.go", 50, "Starting Blobfuse2 Mount : 2.0.0")), &entry)
+	assert.Nil(err)
+	assert.Equal("crit", entry.Level)
+	assert.Empty(entry.Component)
+	assert.Empty(entry.Operation)
+	assert.Equal("Starting Blobfuse2 Mount : 2.0.0", entry.Message)
+}
+
+func (lts *LoggerTestSuite) TestComponentLogLevels() {
+	assert := assert.New(lts.T())
+
+	dir, err := ioutil.TempDir("", "componentlevels")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	cfg := common.LogConfig{
+		FilePath:        filepath.Join(dir, "logfile.txt"),
+		MaxFileSize:     10,
+		FileCount:       2,
+		Level:           common.ELogLevel.LOG_WARNING(),
+		ComponentLevels: map[string]common.LogLevel{"azstorage": common.ELogLevel.LOG_DEBUG()},
+	}
+	err = SetDefaultLogger("base", cfg)
+	assert.Nil(err, "Failed to set base logger")
+
+	// Logger runs at the most verbose level, events of this package are held to the default one
+	assert.Equal(common.ELogLevel.LOG_DEBUG(), GetLogLevel())
+	assert.Equal(common.ELogLevel.LOG_WARNING(), GetDefaultLogLevel())
+	Debug("component test 1")
+	Warn("component test 2")
+
+	SetComponentLogLevels(map[string]common.LogLevel{"log": common.ELogLevel.LOG_TRACE()})
+	assert.Equal(common.ELogLevel.LOG_TRACE(), GetLogLevel())
+	Debug("component test 3")
+	Trace("component test 4")
+
+	// Default level changes leave the component levels in place
+	SetLogLevel(common.ELogLevel.LOG_ERR())
+	assert.Equal(common.ELogLevel.LOG_ERR(), GetDefaultLogLevel())
+	Trace("component test 5")
+
+	// Reload without component levels keeps them, an empty set clears them
+	err = SetConfig(common.LogConfig{Level: common.ELogLevel.LOG_INFO()})
+	assert.Nil(err)
+	Trace("component test 6")
+
+	err = SetConfig(common.LogConfig{Level: common.ELogLevel.LOG_INFO(), ComponentLevels: map[string]common.LogLevel{}})
+	assert.Nil(err)
+	assert.Equal(common.ELogLevel.LOG_INFO(), GetLogLevel())
+	Trace("component test 7")
+	Info("component test 8")
+
+	err = Destroy()
+	assert.Nil(err, "Failed to release base logger")
+
+	data, err := ioutil.ReadFile(cfg.FilePath)
+	assert.Nil(err)
+	logs := string(data)
+	for i, logged := range []bool{false, true, false, true, true, true, false, true} {
+		assert.Equal(logged, strings.Contains(logs, fmt.Sprintf("component test %d\n", i+1)), i+1)
+	}
+}
+
+func (lts *LoggerTestSuite) TestCallerComponent() {
+	assert := assert.New(lts.T())
+
+	pc, _, _, _ := runtime.Caller(0)
+	assert.Equal("log", callerComponent(pc))
+	assert.Equal("log", callerComponent(pc))
+}
+
 func (lts *LoggerTestSuite) TestSilentLogger() {
 	assert := assert.New(lts.T())
 
@@ -0,0 +1,231 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions turning the passphrase into the key of the secure config
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+const DefaultKDF = KDFArgon2id
+
+// Shortest passphrase accepted to encrypt a config, older files encrypted with the passphrase as key still decrypt
+const MinPassphraseLength = 8
+
+// Secure config format, all integers are big endian :
+//
+//	magic "BFSC" | version (1 byte) | kdf (1 byte) | kdf params (3 x uint32) | salt (16 bytes) | nonce (12 bytes) | AES-256-GCM sealed config
+//
+// The header is authenticated as additional data of the GCM seal. Files without the magic are of the original
+// format, AES-GCM with the passphrase used as the key and the nonce prepended.
+const (
+	secureConfigMagic   = "BFSC"
+	secureConfigVersion = 1
+	secureConfigSalt    = 16
+	secureConfigKeySize = 32
+	secureConfigHeader  = len(secureConfigMagic) + 2 + 3*4 + secureConfigSalt
+)
+
+const (
+	kdfIDArgon2id byte = 1
+	kdfIDScrypt   byte = 2
+)
+
+// Cost of the KDFs for newly encrypted configs, recorded in the header so they can be raised later
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // in KiB
+	argon2Threads = 4
+
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+var ErrSecureConfigFormat = errors.New("invalid secure config format")
+
+// EncryptSecureConfig : Encrypt the config with a key derived from the passphrase using the given KDF
+func EncryptSecureConfig(plainData []byte, passphrase []byte, kdf string) ([]byte, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return nil, fmt.Errorf("passphrase shall be at least %d characters long", MinPassphraseLength)
+	}
+
+	header := bytes.NewBuffer(make([]byte, 0, secureConfigHeader))
+	header.WriteString(secureConfigMagic)
+	header.WriteByte(secureConfigVersion)
+
+	var params [3]uint32
+	switch strings.ToLower(kdf) {
+	case "", KDFArgon2id:
+		header.WriteByte(kdfIDArgon2id)
+		params = [3]uint32{argon2Time, argon2Memory, argon2Threads}
+	case KDFScrypt:
+		header.WriteByte(kdfIDScrypt)
+		params = [3]uint32{scryptLogN, scryptR, scryptP}
+	default:
+		return nil, fmt.Errorf("invalid kdf %s", kdf)
+	}
+
+	for _, p := range params {
+		_ = binary.Write(header, binary.BigEndian, p)
+	}
+
+	salt := make([]byte, secureConfigSalt)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	header.Write(salt)
+
+	key, err := deriveSecureConfigKey(header.Bytes(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, header.Len()+len(nonce)+len(plainData)+gcm.Overhead())
+	out = append(out, header.Bytes()...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plainData, header.Bytes()), nil
+}
+
+// DecryptSecureConfig : Decrypt a config encrypted by EncryptSecureConfig or by older versions with the passphrase as key
+func DecryptSecureConfig(cipherData []byte, passphrase []byte) ([]byte, error) {
+	if SecureConfigKDF(cipherData) == "" {
+		return DecryptData(cipherData, passphrase)
+	}
+
+	header := cipherData[:secureConfigHeader]
+	key, err := deriveSecureConfigKey(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cipherData) < secureConfigHeader+gcm.NonceSize() {
+		return nil, ErrSecureConfigFormat
+	}
+
+	nonce := cipherData[secureConfigHeader : secureConfigHeader+gcm.NonceSize()]
+	plainText, err := gcm.Open(nil, nonce, cipherData[secureConfigHeader+gcm.NonceSize():], header)
+	if err != nil {
+		// Original format data may start with the magic by chance
+		if legacy, legacyErr := DecryptData(cipherData, passphrase); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, err
+	}
+
+	return plainText, nil
+}
+
+// SecureConfigKDF : KDF the config was encrypted with, empty for the original format
+func SecureConfigKDF(cipherData []byte) string {
+	if len(cipherData) < secureConfigHeader ||
+		string(cipherData[:len(secureConfigMagic)]) != secureConfigMagic ||
+		cipherData[len(secureConfigMagic)] != secureConfigVersion {
+		return ""
+	}
+
+	switch cipherData[len(secureConfigMagic)+1] {
+	case kdfIDArgon2id:
+		return KDFArgon2id
+	case kdfIDScrypt:
+		return KDFScrypt
+	}
+	return ""
+}
+
+// deriveSecureConfigKey : run the KDF recorded in the header over the passphrase
+func deriveSecureConfigKey(header []byte, passphrase []byte) ([]byte, error) {
+	offset := len(secureConfigMagic) + 2
+	var params [3]uint32
+	for i := range params {
+		params[i] = binary.BigEndian.Uint32(header[offset+4*i:])
+	}
+	salt := header[offset+12 : offset+12+secureConfigSalt]
+
+	// Costs come from the file, bound them so a crafted file can not exhaust the memory
+	switch header[len(secureConfigMagic)+1] {
+	case kdfIDArgon2id:
+		if params[0] == 0 || params[0] > 16 || params[1] < 8*1024 || params[1] > 1024*1024 || params[2] == 0 || params[2] > 255 {
+			return nil, ErrSecureConfigFormat
+		}
+		return argon2.IDKey(passphrase, salt, params[0], params[1], uint8(params[2]), secureConfigKeySize), nil
+
+	case kdfIDScrypt:
+		if params[0] < 10 || params[0] > 20 || params[1] == 0 || params[1] > 32 || params[2] == 0 || params[2] > 16 {
+			return nil, ErrSecureConfigFormat
+		}
+		return scrypt.Key(passphrase, salt, 1<<params[0], int(params[1]), int(params[2]), secureConfigKeySize)
+	}
+
+	return nil, ErrSecureConfigFormat
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,134 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package common
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type secureConfigTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+}
+
+func (suite *secureConfigTestSuite) SetupTest() {
+	suite.assert = assert.New(suite.T())
+}
+
+func TestSecureConfig(t *testing.T) {
+	suite.Run(t, new(secureConfigTestSuite))
+}
+
+func (suite *secureConfigTestSuite) TestEncryptDecrypt() {
+	data := []byte("logging:\n  level: log_debug\n")
+
+	for _, kdf := range []string{KDFArgon2id, KDFScrypt, ""} {
+		cipherText, err := EncryptSecureConfig(data, []byte("a passphrase of any length"), kdf)
+		suite.assert.Nil(err)
+
+		expected := kdf
+		if expected == "" {
+			expected = DefaultKDF
+		}
+		suite.assert.Equal(expected, SecureConfigKDF(cipherText))
+
+		plainText, err := DecryptSecureConfig(cipherText, []byte("a passphrase of any length"))
+		suite.assert.Nil(err)
+		suite.assert.EqualValues(data, plainText)
+
+		_, err = DecryptSecureConfig(cipherText, []byte("another passphrase"))
+		suite.assert.NotNil(err)
+	}
+}
+
+func (suite *secureConfigTestSuite) TestRandomSalt() {
+	data := []byte("logging:\n  level: log_debug\n")
+
+	first, err := EncryptSecureConfig(data, []byte("passphrase"), KDFScrypt)
+	suite.assert.Nil(err)
+	second, err := EncryptSecureConfig(data, []byte("passphrase"), KDFScrypt)
+	suite.assert.Nil(err)
+
+	suite.assert.NotEqual(first[:secureConfigHeader], second[:secureConfigHeader])
+}
+
+func (suite *secureConfigTestSuite) TestInvalidOptions() {
+	_, err := EncryptSecureConfig([]byte("data"), []byte("short"), KDFArgon2id)
+	suite.assert.NotNil(err)
+
+	_, err = EncryptSecureConfig([]byte("data"), []byte("passphrase"), "pbkdf2")
+	suite.assert.NotNil(err)
+}
+
+func (suite *secureConfigTestSuite) TestLegacyFormat() {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	data := []byte("logging:\n  level: log_debug\n")
+	cipherText, err := EncryptData(data, key)
+	suite.assert.Nil(err)
+	suite.assert.Equal("", SecureConfigKDF(cipherText))
+
+	plainText, err := DecryptSecureConfig(cipherText, key)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(data, plainText)
+}
+
+func (suite *secureConfigTestSuite) TestTamperedHeader() {
+	data := []byte("logging:\n  level: log_debug\n")
+	cipherText, err := EncryptSecureConfig(data, []byte("passphrase"), KDFScrypt)
+	suite.assert.Nil(err)
+
+	// Header is authenticated, a changed salt fails to decrypt
+	tampered := append([]byte{}, cipherText...)
+	tampered[secureConfigHeader-1] ^= 0xff
+	_, err = DecryptSecureConfig(tampered, []byte("passphrase"))
+	suite.assert.NotNil(err)
+
+	// Costs beyond the bounds are rejected before running the KDF
+	tampered = append([]byte{}, cipherText...)
+	tampered[len(secureConfigMagic)+2] = 0xff
+	_, err = DecryptSecureConfig(tampered, []byte("passphrase"))
+	suite.assert.NotNil(err)
+
+	// Truncated data
+	_, err = DecryptSecureConfig(cipherText[:secureConfigHeader+4], []byte("passphrase"))
+	suite.assert.NotNil(err)
+	_, err = DecryptSecureConfig([]byte("short"), []byte("passphrase123456"))
+	suite.assert.NotNil(err)
+}
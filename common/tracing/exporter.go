@@ -0,0 +1,168 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	exportBatchSize = 512
+	exportQueueSize = 8192
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+	otlpTracesPath  = "/v1/traces"
+)
+
+// newOTLPClient : Client sending the spans to an OpenTelemetry collector over http.
+// Endpoint is the base url of the collector, the traces path is added unless it is already there.
+func newOTLPClient(endpoint string) (otlptrace.Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %s", endpoint)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, otlpTracesPath) {
+		path += otlpTracesPath
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid endpoint %s, scheme shall be http or https", endpoint)
+	}
+
+	return otlptracehttp.NewClient(opts...), nil
+}
+
+// fileClient : appends the spans to a local file as OTLP JSON, one export request per line
+type fileClient struct {
+	sync.Mutex
+	f *os.File
+}
+
+func newFileClient(path string) (*fileClient, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file %s [%s]", path, err.Error())
+	}
+
+	return &fileClient{f: f}, nil
+}
+
+func (c *fileClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *fileClient) Stop(ctx context.Context) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.f.Close()
+}
+
+func (c *fileClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	data, err := otlpJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	_, err = c.f.Write(append(data, '\n'))
+	return err
+}
+
+// otlpJSON : Encode the export request in OTLP JSON, which is the protobuf JSON mapping with two exceptions.
+// Enums are numbers and trace and span ids are hex strings instead of base64.
+func otlpJSON(req *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	hexIDs(doc)
+	return json.Marshal(doc)
+}
+
+// hexIDs : Re-encode the base64 trace and span ids found in the decoded JSON as hex
+func hexIDs(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			id, ok := value.(string)
+			if ok && (key == "traceId" || key == "spanId" || key == "parentSpanId") {
+				raw, err := base64.StdEncoding.DecodeString(id)
+				if err == nil {
+					v[key] = hex.EncodeToString(raw)
+				}
+				continue
+			}
+			hexIDs(value)
+		}
+
+	case []interface{}:
+		for _, value := range v {
+			hexIDs(value)
+		}
+	}
+}
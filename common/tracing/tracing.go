@@ -0,0 +1,284 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters the spans can be sent to
+const (
+	ExporterOTLP = "otlp" // OTLP over http, as accepted by the OpenTelemetry collector
+	ExporterFile = "file" // OTLP JSON, one export request per line, as read by the collector's otlpjsonfile receiver
+)
+
+const (
+	DefaultServiceName  = "blobfuse2"
+	DefaultOTLPEndpoint = "http://localhost:4318"
+	DefaultSampleRate   = 0.01
+)
+
+// Config : how spans are sampled and where they are exported to
+type Config struct {
+	Exporter    string
+	Endpoint    string  // base url of the collector for otlp exporter
+	FilePath    string  // output file of the file exporter
+	SampleRate  float64 // fraction of FUSE operations traced, 0 to 1
+	ServiceName string
+}
+
+// Attribute : key value pair describing a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span : one timed operation of a trace.
+// Methods are safe to call on a nil span, which is what operations that are not sampled get.
+type Span struct {
+	span trace.Span
+}
+
+type spanKey struct{}
+
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+var defaultTracer *tracer
+
+// Setup : Start exporting spans, tracing stays disabled till this is called.
+// Spans are exported in batches from the background and dropped when the queue is full,
+// so that a slow collector never holds up file system operations.
+func Setup(cfg Config) error {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return fmt.Errorf("invalid sample-rate %v, shall be between 0 and 1", cfg.SampleRate)
+	}
+
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+
+	var client otlptrace.Client
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterOTLP:
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = DefaultOTLPEndpoint
+		}
+		c, err := newOTLPClient(cfg.Endpoint)
+		if err != nil {
+			return err
+		}
+		client = c
+
+	case ExporterFile:
+		if cfg.FilePath == "" {
+			return fmt.Errorf("file-path is required for file exporter")
+		}
+		c, err := newFileClient(cfg.FilePath)
+		if err != nil {
+			return err
+		}
+		client = c
+
+	default:
+		return fmt.Errorf("invalid exporter %s", cfg.Exporter)
+	}
+
+	exp, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return fmt.Errorf("failed to start %s exporter [%s]", cfg.Exporter, err.Error())
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRate))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithBatcher(exp,
+			sdktrace.WithMaxQueueSize(exportQueueSize),
+			sdktrace.WithMaxExportBatchSize(exportBatchSize),
+			sdktrace.WithBatchTimeout(exportInterval),
+			sdktrace.WithExportTimeout(exportTimeout)),
+	)
+
+	log.Info("tracing::Setup : Exporting %v of the operations through %s exporter", cfg.SampleRate, cfg.Exporter)
+	defaultTracer = &tracer{
+		provider: provider,
+		tracer:   provider.Tracer(cfg.ServiceName),
+	}
+	return nil
+}
+
+// Destroy : Export the spans still queued and stop tracing
+func Destroy() {
+	if defaultTracer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	err := defaultTracer.provider.Shutdown(ctx)
+	if err != nil {
+		log.Err("tracing::Destroy : Failed to export queued spans [%s]", err.Error())
+	}
+	defaultTracer = nil
+}
+
+// Enabled : Check whether spans are being collected
+func Enabled() bool {
+	return defaultTracer != nil
+}
+
+// StartTrace : Start the root span of an operation if it is picked by the sampler.
+// Nothing is recorded for operations which are not picked and the returned span is nil.
+func StartTrace(name string, attrs ...Attribute) (context.Context, *Span) {
+	t := defaultTracer
+	if t == nil {
+		return nil, nil
+	}
+
+	ctx, span := t.tracer.Start(context.Background(), name, trace.WithAttributes(convertAttributes(attrs)...))
+	if !span.IsRecording() {
+		return nil, nil
+	}
+
+	s := &Span{span: span}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartSpan : Start a span as a child of the span carried by ctx.
+// Sampling is decided once per trace by StartTrace, if ctx does not carry a span nothing is recorded and ctx is returned as is.
+func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	t := defaultTracer
+	if SpanFromContext(ctx) == nil || t == nil {
+		return ctx, nil
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(convertAttributes(attrs)...))
+	s := &Span{span: span}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext : Span carried by the context, nil if the operation is not traced
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+func convertAttributes(attrs []Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		case int32:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v)))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case uint64:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v)))
+		case float64:
+			kvs = append(kvs, attribute.Float64(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprintf("%v", v)))
+		}
+	}
+	return kvs
+}
+
+// SetAttributes : Add attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.span.SetAttributes(convertAttributes(attrs)...)
+}
+
+// SetError : Mark the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End : Complete the span and queue it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.span.End()
+}
+
+// TraceParent : W3C trace context header identifying the span, so the service can correlate its logs with it
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+
+	sc := s.span.SpanContext()
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// TraceID : Hex encoded id of the trace the span belongs to
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.span.SpanContext().TraceID().String()
+}
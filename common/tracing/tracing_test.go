@@ -0,0 +1,273 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP JSON export request as specified by opentelemetry-proto, fields not listed here fail the decoding
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	ParentSpanID           string         `json:"parentSpanId"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount"`
+	Status                 struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"scope"`
+			Spans     []otlpSpan `json:"spans"`
+			SchemaURL string     `json:"schemaUrl"`
+		} `json:"scopeSpans"`
+		SchemaURL string `json:"schemaUrl"`
+	} `json:"resourceSpans"`
+}
+
+type tracingTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+	dir    string
+}
+
+func (suite *tracingTestSuite) SetupTest() {
+	suite.assert = assert.New(suite.T())
+	suite.dir, _ = ioutil.TempDir("", "tracing_test")
+}
+
+func (suite *tracingTestSuite) TearDownTest() {
+	Destroy()
+	os.RemoveAll(suite.dir)
+}
+
+// readExports : export requests written by the file exporter, one per line
+func (suite *tracingTestSuite) readExports(path string) []otlpTraces {
+	f, err := os.Open(path)
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	exports := make([]otlpTraces, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var export otlpTraces
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		suite.assert.Nil(decoder.Decode(&export))
+		exports = append(exports, export)
+	}
+	return exports
+}
+func (suite *tracingTestSuite) TestDisabled() {
+	suite.assert.False(Enabled())
+
+	ctx, span := StartTrace("libfuse.read")
+	suite.assert.Nil(ctx)
+	suite.assert.Nil(span)
+
+	// Methods of a span which is not recorded are no-ops
+	span.SetAttributes(Attribute{Key: "path", Value: "a"})
+	span.SetError(errors.New("failed"))
+	span.End()
+	suite.assert.Equal("", span.TraceParent())
+}
+
+func (suite *tracingTestSuite) TestInvalidConfig() {
+	err := Setup(Config{Exporter: ExporterFile, SampleRate: 1.5, FilePath: filepath.Join(suite.dir, "traces")})
+	suite.assert.NotNil(err)
+
+	err = Setup(Config{Exporter: ExporterFile, SampleRate: 1})
+	suite.assert.NotNil(err)
+
+	err = Setup(Config{Exporter: "zipkin", SampleRate: 1})
+	suite.assert.NotNil(err)
+
+	err = Setup(Config{Exporter: ExporterOTLP, SampleRate: 1, Endpoint: "localhost:4318"})
+	suite.assert.NotNil(err)
+	suite.assert.False(Enabled())
+}
+
+func (suite *tracingTestSuite) TestSampling() {
+	err := Setup(Config{Exporter: ExporterFile, SampleRate: 0, FilePath: filepath.Join(suite.dir, "traces")})
+	suite.assert.Nil(err)
+
+	for i := 0; i < 100; i++ {
+		_, span := StartTrace("libfuse.read")
+		suite.assert.Nil(span)
+	}
+	Destroy()
+
+	err = Setup(Config{Exporter: ExporterFile, SampleRate: 1, FilePath: filepath.Join(suite.dir, "traces")})
+	suite.assert.Nil(err)
+	_, span := StartTrace("libfuse.read")
+	suite.assert.NotNil(span)
+	Destroy()
+
+	err = Setup(Config{Exporter: ExporterFile, SampleRate: 0.5, FilePath: filepath.Join(suite.dir, "traces")})
+	suite.assert.Nil(err)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if _, span := StartTrace("libfuse.read"); span != nil {
+			sampled++
+		}
+	}
+	suite.assert.InDelta(500, sampled, 150)
+}
+
+func (suite *tracingTestSuite) TestChildWithoutParent() {
+	err := Setup(Config{Exporter: ExporterFile, SampleRate: 1, FilePath: filepath.Join(suite.dir, "traces")})
+	suite.assert.Nil(err)
+
+	// Calls made outside of a traced operation do not start traces of their own
+	ctx, span := StartSpan(nil, "attr_cache.miss")
+	suite.assert.Nil(ctx)
+	suite.assert.Nil(span)
+}
+
+func (suite *tracingTestSuite) TestFileExporter() {
+	path := filepath.Join(suite.dir, "traces")
+	err := Setup(Config{Exporter: ExporterFile, SampleRate: 1, FilePath: path})
+	suite.assert.Nil(err)
+
+	ctx, root := StartTrace("libfuse.open")
+	suite.assert.NotNil(root)
+	suite.assert.Regexp(regexp.MustCompile("^00-[0-9a-f]{32}-[0-9a-f]{16}-01$"), root.TraceParent())
+
+	_, child := StartSpan(ctx, "file_cache.download", Attribute{Key: "path", Value: "dir/file"})
+	suite.assert.NotNil(child)
+	suite.assert.Equal(root.TraceID(), child.TraceID())
+	child.SetAttributes(Attribute{Key: "size", Value: int64(10)}, Attribute{Key: "cached", Value: true})
+	child.SetError(errors.New("download failed"))
+	child.End()
+	root.End()
+
+	Destroy()
+
+	exports := suite.readExports(path)
+	suite.assert.Len(exports, 1)
+	suite.assert.Equal("service.name", exports[0].ResourceSpans[0].Resource.Attributes[0].Key)
+	suite.assert.Equal("blobfuse2", exports[0].ResourceSpans[0].Resource.Attributes[0].Value["stringValue"])
+	suite.assert.Equal("blobfuse2", exports[0].ResourceSpans[0].ScopeSpans[0].Scope.Name)
+
+	spans := exports[0].ResourceSpans[0].ScopeSpans[0].Spans
+	suite.assert.Len(spans, 2)
+	suite.assert.Equal("file_cache.download", spans[0].Name)
+	suite.assert.Equal("libfuse.open", spans[1].Name)
+
+	// Ids are hex, not base64 as protobuf JSON would have them, enums and 64 bit integers are encoded as in OTLP JSON
+	suite.assert.Equal(root.TraceID(), spans[1].TraceID)
+	suite.assert.Regexp(regexp.MustCompile("^[0-9a-f]{32}$"), spans[0].TraceID)
+	suite.assert.Regexp(regexp.MustCompile("^[0-9a-f]{16}$"), spans[0].SpanID)
+	suite.assert.Equal(spans[1].TraceID, spans[0].TraceID)
+	suite.assert.Equal(spans[1].SpanID, spans[0].ParentSpanID)
+	suite.assert.Equal("", spans[1].ParentSpanID)
+	suite.assert.Equal(1, spans[0].Kind)
+	suite.assert.Regexp(regexp.MustCompile("^[0-9]+$"), spans[0].StartTimeUnixNano)
+	suite.assert.Regexp(regexp.MustCompile("^[0-9]+$"), spans[0].EndTimeUnixNano)
+
+	suite.assert.Equal(2, spans[0].Status.Code)
+	suite.assert.Equal("download failed", spans[0].Status.Message)
+	suite.assert.Equal(0, spans[1].Status.Code)
+
+	suite.assert.Len(spans[0].Attributes, 3)
+	suite.assert.Equal("dir/file", spans[0].Attributes[0].Value["stringValue"])
+	suite.assert.Equal("10", spans[0].Attributes[1].Value["intValue"])
+	suite.assert.Equal(true, spans[0].Attributes[2].Value["boolValue"])
+}
+
+func (suite *tracingTestSuite) TestOTLPExporter() {
+	received := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.assert.Equal("/v1/traces", r.URL.Path)
+		suite.assert.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+
+		data, err := ioutil.ReadAll(r.Body)
+		suite.assert.Nil(err)
+		export := &coltracepb.ExportTraceServiceRequest{}
+		suite.assert.Nil(proto.Unmarshal(data, export))
+		received <- export
+	}))
+	defer server.Close()
+
+	err := Setup(Config{Exporter: ExporterOTLP, SampleRate: 1, Endpoint: server.URL, ServiceName: "mount1"})
+	suite.assert.Nil(err)
+
+	_, span := StartTrace("libfuse.getattr")
+	span.End()
+	Destroy()
+
+	export := <-received
+	suite.assert.Equal("mount1", export.ResourceSpans[0].Resource.Attributes[0].Value.GetStringValue())
+	suite.assert.Equal("libfuse.getattr", export.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+}
+
+func TestTracing(t *testing.T) {
+	suite.Run(t, new(tracingTestSuite))
+}
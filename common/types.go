@@ -36,6 +36,7 @@ package common
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -85,6 +86,7 @@ var StatsConfigFilePath = filepath.Join(DefaultWorkDir, "stats_monitor.cfg")
 
 var EnableMonitoring = false
 var BfsDisabled = false
+var EnableMetrics = false
 var TransferPipe = "/tmp/transferPipe"
 var PollingPipe = "/tmp/pollPipe"
 
@@ -144,6 +146,8 @@ type LogConfig struct {
 	FilePath    string
 	TimeTracker bool
 	Tag         string // logging tag which can be either blobfuse2 or bfusemon
+
+	ComponentLevels map[string]LogLevel // levels of the components which do not log at Level, nil keeps the current ones on SetConfig
 }
 
 // Flags for blocks
@@ -151,6 +155,7 @@ const (
 	BlockFlagUnknown uint16 = iota
 	DirtyBlock
 	TruncatedBlock
+	FailedBlock
 )
 
 type Block struct {
@@ -172,6 +177,11 @@ func (block *Block) Truncated() bool {
 	return block.Flags.IsSet(TruncatedBlock)
 }
 
+// Failed : block could not be downloaded and its data is not valid
+func (block *Block) Failed() bool {
+	return block.Flags.IsSet(FailedBlock)
+}
+
 // Flags for block offset list
 const (
 	BolFlagUnknown uint16 = iota
@@ -270,6 +280,11 @@ func (u uuid) Bytes() []byte {
 	return u[:]
 }
 
+// String : canonical form of the uuid, as expected by APIs taking a GUID
+func (u uuid) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
 // NewUUIDWithLength returns a new uuid using RFC 4122 algorithm with the given length.
 func NewUUIDWithLength(length int64) []byte {
 	u := make([]byte, length)
@@ -206,6 +206,10 @@ func DecryptData(cipherData []byte, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if len(cipherData) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
 	nonce := cipherData[:gcm.NonceSize()]
 	ciphertext := cipherData[gcm.NonceSize():]
 
@@ -253,6 +257,11 @@ func MonitorBfs() bool {
 	return EnableMonitoring && !BfsDisabled
 }
 
+// check if component stats are needed, either by the health monitor or by the metrics endpoint
+func CollectStats() bool {
+	return MonitorBfs() || EnableMetrics
+}
+
 // convert ~ to $HOME in path
 func ExpandPath(path string) string {
 	if strings.HasPrefix(path, "~/") {
@@ -42,15 +42,21 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/common/tracing"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 )
 
 // By default attr cache is valid for 120 seconds
 const defaultAttrCacheTimeout uint32 = (120)
 
+// By default persisted attributes are written to disk every 5 minutes
+const defaultPersistInterval uint32 = (300)
+
 // Common structure for AttrCache Component
 type AttrCache struct {
 	internal.BaseComponent
@@ -59,6 +65,16 @@ type AttrCache struct {
 	noSymlinks   bool
 	cacheMap     map[string]*attrCacheItem
 	cacheLock    sync.RWMutex
+
+	snapshotPath     string
+	snapshotInterval uint32
+	trustWindow      uint32
+	snapshotStop     chan bool
+	snapshotWg       sync.WaitGroup
+
+	ring   clockRing
+	hits   int64
+	misses int64
 }
 
 // Structure defining your config parameters
@@ -67,16 +83,26 @@ type AttrCacheOptions struct {
 	NoCacheOnList bool   `config:"no-cache-on-list" yaml:"no-cache-on-list,omitempty"`
 	NoSymlinks    bool   `config:"no-symlinks" yaml:"no-symlinks,omitempty"`
 
+	PersistPath     string `config:"persist-path" yaml:"persist-path,omitempty"`
+	PersistInterval uint32 `config:"persist-interval-sec" yaml:"persist-interval-sec,omitempty"`
+	PersistTrust    uint32 `config:"persist-trust-sec" yaml:"persist-trust-sec,omitempty"`
+
+	MaxItems  uint64 `config:"max-items" yaml:"max-items,omitempty"`
+	MaxSizeMB uint64 `config:"max-size-mb" yaml:"max-size-mb,omitempty"`
+
 	// support v1
 	CacheOnList bool `config:"cache-on-list"`
 }
 
 const compName = "attr_cache"
 
-// for now caching only first 1 mil files in a directory
-// caching more means increased memory usage of the process
-const maxFilesPerDir = 1000000 // 1 million max files to be cached per directory
-const maxTotalFiles = 10000000 // 10 million max files overall to be cached
+// Unless a budget is configured at most 10 million items are cached,
+// least recently used items are evicted beyond that
+const defaultMaxItems = 10000000
+
+const MB = 1024 * 1024
+
+var attrCacheStatsCollector *stats_manager.StatsCollector
 
 //  Verification to check satisfaction criteria with Component Interface
 var _ internal.Component = &AttrCache{}
@@ -104,6 +130,24 @@ func (ac *AttrCache) Start(ctx context.Context) error {
 
 	// AttrCache : start code goes here
 	ac.cacheMap = make(map[string]*attrCacheItem)
+	ac.ring.keys = make([]string, 0)
+	ac.ring.hand = 0
+	ac.ring.used = 0
+	attrCacheStatsCollector = stats_manager.NewStatsCollector(ac.Name())
+
+	if ac.snapshotPath != "" {
+		// A snapshot which can not be read is not fatal, mount will just start with a cold cache
+		err := ac.loadSnapshot()
+		if err != nil {
+			log.Warn("AttrCache::Start : Failed to restore attribute cache from %s [%s]", ac.snapshotPath, err.Error())
+		}
+
+		if ac.snapshotInterval > 0 {
+			ac.snapshotStop = make(chan bool)
+			ac.snapshotWg.Add(1)
+			go ac.snapshotWorker()
+		}
+	}
 
 	return nil
 }
@@ -112,6 +156,21 @@ func (ac *AttrCache) Start(ctx context.Context) error {
 func (ac *AttrCache) Stop() error {
 	log.Trace("AttrCache::Stop : Stopping component %s", ac.Name())
 
+	if ac.snapshotPath != "" {
+		if ac.snapshotStop != nil {
+			close(ac.snapshotStop)
+			ac.snapshotWg.Wait()
+			ac.snapshotStop = nil
+		}
+
+		err := ac.saveSnapshot()
+		if err != nil {
+			log.Err("AttrCache::Stop : Failed to persist attribute cache to %s [%s]", ac.snapshotPath, err.Error())
+		}
+	}
+
+	attrCacheStatsCollector.Destroy()
+
 	return nil
 }
 
@@ -142,8 +201,49 @@ func (ac *AttrCache) Configure(_ bool) error {
 
 	ac.noSymlinks = conf.NoSymlinks
 
-	log.Info("AttrCache::Configure : cache-timeout %d, symlink %t, cache-on-list %t",
-		ac.cacheTimeout, ac.noSymlinks, ac.cacheOnList)
+	ac.snapshotPath = ""
+	if conf.PersistPath != "" {
+		ac.snapshotPath = common.ExpandPath(conf.PersistPath)
+		err = validateSnapshotPath(ac.snapshotPath)
+		if err != nil {
+			log.Err("AttrCache::Configure : config error [failed to create directory for %s]", ac.snapshotPath)
+			return fmt.Errorf("config error in %s [%s]", ac.Name(), err.Error())
+		}
+	}
+
+	if config.IsSet(compName + ".persist-interval-sec") {
+		ac.snapshotInterval = conf.PersistInterval
+	} else {
+		ac.snapshotInterval = defaultPersistInterval
+	}
+
+	// Restored attributes are trusted only as long as freshly fetched ones would be, unless configured otherwise
+	if config.IsSet(compName + ".persist-trust-sec") {
+		ac.trustWindow = conf.PersistTrust
+		if ac.trustWindow > ac.cacheTimeout {
+			ac.trustWindow = ac.cacheTimeout
+		}
+	} else {
+		ac.trustWindow = ac.cacheTimeout
+	}
+
+	// Budget can be given in items, in memory or both, whichever is hit first triggers eviction
+	maxItems := int64(conf.MaxItems)
+	maxBytes := int64(conf.MaxSizeMB * MB)
+	if !config.IsSet(compName+".max-items") && !config.IsSet(compName+".max-size-mb") {
+		maxItems = defaultMaxItems
+	}
+
+	ac.cacheLock.Lock()
+	ac.ring.maxItems = maxItems
+	ac.ring.maxBytes = maxBytes
+	if ac.cacheMap != nil && ac.ring.full() {
+		ac.evict()
+	}
+	ac.cacheLock.Unlock()
+
+	log.Info("AttrCache::Configure : cache-timeout %d, symlink %t, cache-on-list %t, persist-path %s, persist-interval %d, persist-trust %d, max-items %d, max-size-mb %d",
+		ac.cacheTimeout, ac.noSymlinks, ac.cacheOnList, ac.snapshotPath, ac.snapshotInterval, ac.trustWindow, conf.MaxItems, conf.MaxSizeMB)
 
 	return nil
 }
@@ -262,7 +362,7 @@ func (ac *AttrCache) StreamDir(options internal.StreamDirOptions) ([]*internal.O
 	log.Trace("AttrCache::ReadDir : %s", options.Name)
 
 	pathList, token, err := ac.NextComponent().StreamDir(options)
-	if err == nil && options.Offset < maxFilesPerDir {
+	if err == nil {
 		ac.cacheAttributes(pathList)
 	}
 
@@ -278,12 +378,8 @@ func (ac *AttrCache) cacheAttributes(pathList []*internal.ObjAttr) {
 		currTime := time.Now()
 
 		for _, attr := range pathList {
-			if len(ac.cacheMap) > maxTotalFiles {
-				break
-			}
-
 			ac.cacheLock.Lock()
-			ac.cacheMap[internal.TruncateDirName(attr.Path)] = newAttrCacheItem(attr, true, currTime)
+			ac.insertItem(internal.TruncateDirName(attr.Path), newAttrCacheItem(attr, true, currTime))
 			ac.cacheLock.Unlock()
 		}
 
@@ -426,6 +522,19 @@ func (ac *AttrCache) CopyFromFile(options internal.CopyFromFileOptions) error {
 	return err
 }
 
+// CopyFileRange : Target of the copy gets new contents, its cached attributes are stale
+func (ac *AttrCache) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	log.Trace("AttrCache::CopyFileRange : %s -> %s", options.SrcHandle.Path, options.DstHandle.Path)
+
+	copied, err := ac.NextComponent().CopyFileRange(options)
+	if err == nil {
+		ac.cacheLock.RLock()
+		defer ac.cacheLock.RUnlock()
+		ac.invalidatePath(options.DstHandle.Path)
+	}
+	return copied, err
+}
+
 func (ac *AttrCache) SyncFile(options internal.SyncFileOptions) error {
 	log.Trace("AttrCache::SyncFile : %s", options.Handle.Path)
 
@@ -460,10 +569,11 @@ func (ac *AttrCache) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr
 	ac.cacheLock.RUnlock()
 
 	// Try to serve the request from the attribute cache
-	if found && value.valid() && time.Since(value.cachedAt).Seconds() < float64(ac.cacheTimeout) {
+	if found && !options.Refresh && value.valid() && time.Since(value.cachedAt).Seconds() < float64(ac.cacheTimeout) {
 		if value.isDeleted() {
 			log.Debug("AttrCache::GetAttr : %s served from cache", options.Name)
 			// no entry if path does not exist
+			ac.recordHit(value)
 			return &internal.ObjAttr{}, syscall.ENOENT
 		} else {
 			// IsMetadataRetrieved is false in the case of ADLS List since the API does not support metadata.
@@ -472,25 +582,31 @@ func (ac *AttrCache) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr
 			if value.getAttr().IsMetadataRetrieved() || (ac.noSymlinks && !options.RetrieveMetadata) {
 				// path exists and we have all the metadata required or we do not care about metadata
 				log.Debug("AttrCache::GetAttr : %s served from cache", options.Name)
+				ac.recordHit(value)
 				return value.getAttr(), nil
 			}
 		}
 	}
 
 	// Get the attributes from next component and cache them
+	ac.recordMiss()
+	ctx, span := tracing.StartSpan(options.Ctx, "attr_cache.miss", tracing.Attribute{Key: "path", Value: options.Name})
+	options.Ctx = ctx
 	pathAttr, err := ac.NextComponent().GetAttr(options)
+	if err != syscall.ENOENT {
+		span.SetError(err)
+	}
+	span.End()
 
 	ac.cacheLock.Lock()
 	defer ac.cacheLock.Unlock()
 
 	if err == nil {
 		// Retrieved attributes so cache them
-		if len(ac.cacheMap) < maxTotalFiles {
-			ac.cacheMap[truncatedPath] = newAttrCacheItem(pathAttr, true, time.Now())
-		}
+		ac.insertItem(truncatedPath, newAttrCacheItem(pathAttr, true, time.Now()))
 	} else if err == syscall.ENOENT {
 		// Path does not exist so cache a no-entry item
-		ac.cacheMap[truncatedPath] = newAttrCacheItem(&internal.ObjAttr{}, false, time.Now())
+		ac.insertItem(truncatedPath, newAttrCacheItem(&internal.ObjAttr{}, false, time.Now()))
 	}
 
 	return pathAttr, err
@@ -554,6 +670,61 @@ func (ac *AttrCache) Chown(options internal.ChownOptions) error {
 	return err
 }
 
+// GetXattr : Serve user attributes from the cached metadata when possible
+func (ac *AttrCache) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	log.Trace("AttrCache::GetXattr : Get %s of %s", options.Attr, options.Name)
+
+	if strings.HasPrefix(options.Attr, internal.XattrUserPrefix) {
+		ac.cacheLock.RLock()
+		value, found := ac.cacheMap[internal.TruncateDirName(options.Name)]
+		ac.cacheLock.RUnlock()
+
+		if found && value.valid() && value.exists() && value.getAttr().IsMetadataRetrieved() &&
+			time.Since(value.cachedAt).Seconds() < float64(ac.cacheTimeout) {
+			log.Debug("AttrCache::GetXattr : %s served from cache", options.Name)
+			ac.recordHit(value)
+
+			data, found := value.getAttr().GetMetadata(strings.TrimPrefix(options.Attr, internal.XattrUserPrefix))
+			if !found {
+				return nil, syscall.ENODATA
+			}
+			return []byte(data), nil
+		}
+	}
+
+	return ac.NextComponent().GetXattr(options)
+}
+
+// SetXattr : Mark the path invalid as its metadata has changed
+func (ac *AttrCache) SetXattr(options internal.SetXattrOptions) error {
+	log.Trace("AttrCache::SetXattr : Set %s of %s", options.Attr, options.Name)
+
+	err := ac.NextComponent().SetXattr(options)
+
+	if err == nil {
+		ac.cacheLock.RLock()
+		defer ac.cacheLock.RUnlock()
+		ac.invalidatePath(options.Name)
+	}
+
+	return err
+}
+
+// RemoveXattr : Mark the path invalid as its metadata has changed
+func (ac *AttrCache) RemoveXattr(options internal.RemoveXattrOptions) error {
+	log.Trace("AttrCache::RemoveXattr : Remove %s of %s", options.Attr, options.Name)
+
+	err := ac.NextComponent().RemoveXattr(options)
+
+	if err == nil {
+		ac.cacheLock.RLock()
+		defer ac.cacheLock.RUnlock()
+		ac.invalidatePath(options.Name)
+	}
+
+	return err
+}
+
 // ------------------------- Factory -------------------------------------------
 
 // Pipeline will call this method to create your object, initialize your variables here
@@ -208,6 +208,8 @@ func (suite *attrCacheTestSuite) TestDefault() {
 	suite.assert.EqualValues(suite.attrCache.cacheTimeout, 120)
 	suite.assert.Equal(suite.attrCache.cacheOnList, true)
 	suite.assert.Equal(suite.attrCache.noSymlinks, false)
+	suite.assert.EqualValues(suite.attrCache.ring.maxItems, defaultMaxItems)
+	suite.assert.EqualValues(suite.attrCache.ring.maxBytes, 0)
 }
 
 // Tests configuration
@@ -836,6 +838,30 @@ func (suite *attrCacheTestSuite) TestCopyFromFileExists() {
 	assertInvalid(suite, path)
 }
 
+// Tests CopyFileRange
+func (suite *attrCacheTestSuite) TestCopyFileRange() {
+	defer suite.cleanupTest()
+	src := "a"
+	dst := "b"
+
+	options := internal.CopyFileRangeOptions{SrcHandle: handlemap.NewHandle(src), DstHandle: handlemap.NewHandle(dst), Size: defaultSize}
+	addPathToCache(suite.assert, suite.attrCache, src, true)
+	addPathToCache(suite.assert, suite.attrCache, dst, true)
+
+	// Error leaves the cache alone
+	suite.mock.EXPECT().CopyFileRange(options).Return(int64(0), syscall.ENOTSUP)
+	_, err := suite.attrCache.CopyFileRange(options)
+	suite.assert.Equal(syscall.ENOTSUP, err)
+	assertUntouched(suite, dst)
+
+	suite.mock.EXPECT().CopyFileRange(options).Return(int64(defaultSize), nil)
+	copied, err := suite.attrCache.CopyFileRange(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(defaultSize, copied)
+	assertUntouched(suite, src)
+	assertInvalid(suite, dst)
+}
+
 // GetAttr
 func (suite *attrCacheTestSuite) TestGetAttrExistsDeleted() {
 	defer suite.cleanupTest()
@@ -935,6 +961,24 @@ func (suite *attrCacheTestSuite) TestGetAttrExistsWithoutMetadata() {
 	}
 }
 
+func (suite *attrCacheTestSuite) TestGetAttrRefresh() {
+	defer suite.cleanupTest()
+	path := "a/c1"
+	addDirectoryToCache(suite.assert, suite.attrCache, "a", true)
+
+	// Cached attributes are skipped and replaced by the ones from storage
+	options := internal.GetAttrOptions{Name: path, Refresh: true}
+	suite.mock.EXPECT().GetAttr(options).Return(getPathAttr(path, defaultSize+1, fs.FileMode(defaultMode), true), nil)
+
+	attr, err := suite.attrCache.GetAttr(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(defaultSize+1, attr.Size)
+
+	attr, err = suite.attrCache.GetAttr(internal.GetAttrOptions{Name: path})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(defaultSize+1, attr.Size)
+}
+
 func (suite *attrCacheTestSuite) TestGetAttrDoesNotExist() {
 	defer suite.cleanupTest()
 	var paths = []string{"a", "a/", "a/c1", "a/c1/", "a/c2", "a/c1/gc1", "ab", "ab/", "ab/c1", "ac"}
@@ -1119,6 +1163,68 @@ func (suite *attrCacheTestSuite) TestChmod() {
 	}
 }
 
+// Tests GetXattr
+func (suite *attrCacheTestSuite) TestGetXattr() {
+	defer suite.cleanupTest()
+	path := "a"
+	options := internal.GetXattrOptions{Name: path, Attr: "user.source"}
+
+	// Not cached, served by next component
+	suite.mock.EXPECT().GetXattr(options).Return([]byte("pipeline"), nil)
+	value, err := suite.attrCache.GetXattr(options)
+	suite.assert.Nil(err)
+	suite.assert.Equal([]byte("pipeline"), value)
+
+	// Cached without metadata, served by next component
+	addPathToCache(suite.assert, suite.attrCache, path, false)
+	suite.mock.EXPECT().GetXattr(options).Return([]byte("pipeline"), nil)
+	_, err = suite.attrCache.GetXattr(options)
+	suite.assert.Nil(err)
+
+	// Cached with metadata, served from cache
+	addPathToCache(suite.assert, suite.attrCache, path, true)
+	suite.attrCache.cacheMap[path].attr.Metadata = map[string]string{"Source": "cached"}
+	value, err = suite.attrCache.GetXattr(options)
+	suite.assert.Nil(err)
+	suite.assert.Equal([]byte("cached"), value)
+
+	_, err = suite.attrCache.GetXattr(internal.GetXattrOptions{Name: path, Attr: "user.missing"})
+	suite.assert.Equal(syscall.ENODATA, err)
+
+	// Other namespaces always go to the next component
+	other := internal.GetXattrOptions{Name: path, Attr: "security.selinux"}
+	suite.mock.EXPECT().GetXattr(other).Return(nil, syscall.ENOTSUP)
+	_, err = suite.attrCache.GetXattr(other)
+	suite.assert.Equal(syscall.ENOTSUP, err)
+}
+
+// Tests SetXattr and RemoveXattr
+func (suite *attrCacheTestSuite) TestSetRemoveXattr() {
+	defer suite.cleanupTest()
+	path := "a"
+	setOptions := internal.SetXattrOptions{Name: path, Attr: "user.source", Value: []byte("pipeline")}
+	removeOptions := internal.RemoveXattrOptions{Name: path, Attr: "user.source"}
+
+	// Error leaves the cache as is
+	addPathToCache(suite.assert, suite.attrCache, path, true)
+	suite.mock.EXPECT().SetXattr(setOptions).Return(errors.New("Failed to set"))
+	err := suite.attrCache.SetXattr(setOptions)
+	suite.assert.NotNil(err)
+	suite.assert.True(suite.attrCache.cacheMap[path].valid())
+
+	// Success invalidates the entry so that metadata is fetched again
+	suite.mock.EXPECT().SetXattr(setOptions).Return(nil)
+	err = suite.attrCache.SetXattr(setOptions)
+	suite.assert.Nil(err)
+	suite.assert.False(suite.attrCache.cacheMap[path].valid())
+
+	addPathToCache(suite.assert, suite.attrCache, path, true)
+	suite.mock.EXPECT().RemoveXattr(removeOptions).Return(nil)
+	err = suite.attrCache.RemoveXattr(removeOptions)
+	suite.assert.Nil(err)
+	suite.assert.False(suite.attrCache.cacheMap[path].valid())
+}
+
 // Tests Chown
 func (suite *attrCacheTestSuite) TestChown() {
 	defer suite.cleanupTest()
@@ -1161,6 +1267,163 @@ func (suite *attrCacheTestSuite) TestChown() {
 	}
 }
 
+// Tests least recently used items are evicted once the item budget is exceeded
+func (suite *attrCacheTestSuite) TestEvictMaxItems() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	config := "attr_cache:\n  max-items: 2"
+	suite.setupTestHelper(config)
+
+	suite.assert.EqualValues(suite.attrCache.ring.maxItems, 2)
+	suite.assert.EqualValues(suite.attrCache.ring.maxBytes, 0)
+
+	for _, path := range []string{"a", "b"} {
+		options := internal.GetAttrOptions{Name: path}
+		suite.mock.EXPECT().GetAttr(options).Return(getPathAttr(path, defaultSize, fs.FileMode(defaultMode), true), nil)
+		_, err := suite.attrCache.GetAttr(options)
+		suite.assert.Nil(err)
+	}
+
+	// hit a so that b is the eviction candidate
+	_, err := suite.attrCache.GetAttr(internal.GetAttrOptions{Name: "a"})
+	suite.assert.Nil(err)
+
+	options := internal.GetAttrOptions{Name: "c"}
+	suite.mock.EXPECT().GetAttr(options).Return(&internal.ObjAttr{}, syscall.ENOENT)
+	_, err = suite.attrCache.GetAttr(options)
+	suite.assert.Equal(syscall.ENOENT, err)
+
+	suite.assert.Len(suite.attrCache.cacheMap, 2)
+	suite.assert.Len(suite.attrCache.ring.keys, 2)
+	assertUntouched(suite, "a")
+	assertDeleted(suite, "c")
+	suite.assert.NotContains(suite.attrCache.cacheMap, "b")
+
+	suite.assert.EqualValues(1, suite.attrCache.hits)
+	suite.assert.EqualValues(3, suite.attrCache.misses)
+}
+
+// Tests listing more items than the memory budget allows keeps the cache within the budget
+func (suite *attrCacheTestSuite) TestEvictMaxSize() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	config := "attr_cache:\n  max-size-mb: 1"
+	suite.setupTestHelper(config)
+
+	suite.assert.EqualValues(suite.attrCache.ring.maxItems, 0)
+	suite.assert.EqualValues(suite.attrCache.ring.maxBytes, MB)
+
+	pathList := make([]*internal.ObjAttr, 0)
+	for i := 0; i < 10000; i++ {
+		pathList = append(pathList, getPathAttr(fmt.Sprintf("dir/file%d", i), defaultSize, fs.FileMode(defaultMode), true))
+	}
+
+	options := internal.ReadDirOptions{Name: "dir"}
+	suite.mock.EXPECT().ReadDir(options).Return(pathList, nil)
+	_, err := suite.attrCache.ReadDir(options)
+	suite.assert.Nil(err)
+
+	suite.assert.LessOrEqual(suite.attrCache.ring.used, int64(MB))
+	suite.assert.Less(len(suite.attrCache.cacheMap), 10000)
+	suite.assert.Equal(len(suite.attrCache.cacheMap), len(suite.attrCache.ring.keys))
+
+	// most recently listed items are still cached
+	assertUntouched(suite, "dir/file9999")
+}
+
+// Tests attributes persisted on Stop are served from cache after restart
+func (suite *attrCacheTestSuite) TestPersistRestore() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	snapshot := filepath.Join(suite.T().TempDir(), "attr_cache.snap")
+	config := fmt.Sprintf("attr_cache:\n  timeout-sec: 60\n  persist-path: %s\n  persist-interval-sec: 0", snapshot)
+	suite.setupTestHelper(config)
+
+	suite.assert.EqualValues(suite.attrCache.snapshotPath, snapshot)
+	suite.assert.EqualValues(suite.attrCache.trustWindow, 60)
+
+	addPathToCache(suite.assert, suite.attrCache, "a", true)
+	addPathToCache(suite.assert, suite.attrCache, "b", true)
+	suite.attrCache.cacheMap["b"].invalidate()
+	suite.attrCache.cacheMap["c"] = newAttrCacheItem(&internal.ObjAttr{}, false, time.Now())
+
+	suite.cleanupTest()
+	suite.assert.FileExists(snapshot)
+	suite.setupTestHelper(config)
+
+	// existing and negative entries are restored, invalid ones are not
+	suite.assert.NotContains(suite.attrCache.cacheMap, "b")
+	assertUntouched(suite, "a")
+	assertDeleted(suite, "c")
+
+	// served from cache without calling the next component
+	result, err := suite.attrCache.GetAttr(internal.GetAttrOptions{Name: "a"})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues("a", result.Path)
+
+	_, err = suite.attrCache.GetAttr(internal.GetAttrOptions{Name: "c"})
+	suite.assert.Equal(syscall.ENOENT, err)
+}
+
+// Tests restored attributes are revalidated once the trust window is over
+func (suite *attrCacheTestSuite) TestPersistTrustExpired() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	snapshot := filepath.Join(suite.T().TempDir(), "attr_cache.snap")
+	config := fmt.Sprintf("attr_cache:\n  persist-path: %s\n  persist-interval-sec: 0\n  persist-trust-sec: 0", snapshot)
+	suite.setupTestHelper(config)
+
+	addPathToCache(suite.assert, suite.attrCache, "a", true)
+	suite.cleanupTest()
+	suite.setupTestHelper(config)
+
+	suite.assert.Contains(suite.attrCache.cacheMap, "a")
+
+	options := internal.GetAttrOptions{Name: "a"}
+	suite.mock.EXPECT().GetAttr(options).Return(getPathAttr("a", 10, fs.FileMode(defaultMode), true), nil)
+
+	result, err := suite.attrCache.GetAttr(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(10, result.Size)
+}
+
+// Tests items keep their age across a restart and expired ones are not persisted
+func (suite *attrCacheTestSuite) TestPersistKeepsAge() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	snapshot := filepath.Join(suite.T().TempDir(), "attr_cache.snap")
+	config := fmt.Sprintf("attr_cache:\n  timeout-sec: 60\n  persist-path: %s\n  persist-interval-sec: 0", snapshot)
+	suite.setupTestHelper(config)
+
+	old := time.Now().Add(-50 * time.Second)
+	suite.attrCache.cacheMap["old"] = newAttrCacheItem(getPathAttr("old", 10, fs.FileMode(defaultMode), true), true, old)
+	suite.attrCache.cacheMap["expired"] = newAttrCacheItem(&internal.ObjAttr{}, false, time.Now().Add(-2*time.Minute))
+
+	suite.cleanupTest()
+	suite.setupTestHelper(config)
+
+	// expired negative entry is not served as fresh after the restart
+	suite.assert.NotContains(suite.attrCache.cacheMap, "expired")
+
+	// entry older than the trust window expires when it would have without the restart
+	suite.assert.Contains(suite.attrCache.cacheMap, "old")
+	suite.assert.WithinDuration(old, suite.attrCache.cacheMap["old"].cachedAt, time.Second)
+}
+
+// Tests a corrupt snapshot does not fail the mount
+func (suite *attrCacheTestSuite) TestPersistCorrupt() {
+	defer suite.cleanupTest()
+	suite.cleanupTest() // clean up the default attr cache generated
+	snapshot := filepath.Join(suite.T().TempDir(), "attr_cache.snap")
+	err := os.WriteFile(snapshot, []byte("not a snapshot"), 0600)
+	suite.assert.Nil(err)
+
+	config := fmt.Sprintf("attr_cache:\n  persist-path: %s\n  persist-interval-sec: 0", snapshot)
+	suite.setupTestHelper(config)
+
+	suite.assert.Empty(suite.attrCache.cacheMap)
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestAttrCacheTestSuite(t *testing.T) {
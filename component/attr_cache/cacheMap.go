@@ -53,6 +53,10 @@ type attrCacheItem struct {
 	attr     *internal.ObjAttr
 	cachedAt time.Time
 	attrFlag common.BitMap16
+
+	referenced uint32 // set on cache hit, cleared by the eviction sweep
+	tracked    bool   // item is accounted in the eviction ring
+	cost       int64  // approximate bytes accounted for this item
 }
 
 func newAttrCacheItem(attr *internal.ObjAttr, exists bool, cachedAt time.Time) *attrCacheItem {
@@ -0,0 +1,151 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package attr_cache
+
+import (
+	"sync/atomic"
+
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
+)
+
+// Approximate bytes held by one cached item apart from its strings: map bucket, item, ObjAttr and md5 slice
+const itemBaseCost int64 = 256
+
+// clockRing : CLOCK approximation of LRU over the keys of the cache map.
+// Items get their reference bit set on every cache hit without taking the write lock,
+// the hand clears the bits while sweeping and evicts the first item found unreferenced.
+// All methods shall be called with the cache write lock held.
+type clockRing struct {
+	keys     []string
+	hand     int
+	maxItems int64
+	maxBytes int64
+	used     int64
+}
+
+// itemCost : approximate memory consumed by caching this item under the given key
+func itemCost(key string, attr *internal.ObjAttr) int64 {
+	cost := itemBaseCost + int64(len(key))
+	if attr != nil {
+		cost += int64(len(attr.Path) + len(attr.Name) + len(attr.MD5) + len(attr.ETag))
+		for k, v := range attr.Metadata {
+			cost += int64(len(k) + len(v))
+		}
+	}
+	return cost
+}
+
+// full : check whether the cache is beyond its configured budget
+func (ring *clockRing) full() bool {
+	if ring.maxItems > 0 && int64(len(ring.keys)) > ring.maxItems {
+		return true
+	}
+	return ring.maxBytes > 0 && ring.used > ring.maxBytes
+}
+
+// insertItem : add or replace an item in the cache and evict others if the budget is exceeded
+func (ac *AttrCache) insertItem(key string, item *attrCacheItem) {
+	item.cost = itemCost(key, item.attr)
+
+	old, found := ac.cacheMap[key]
+	if found && old.tracked {
+		ac.ring.used -= old.cost
+	} else {
+		ac.ring.keys = append(ac.ring.keys, key)
+	}
+
+	item.tracked = true
+	ac.ring.used += item.cost
+	ac.cacheMap[key] = item
+
+	if ac.ring.full() {
+		ac.evict()
+	}
+}
+
+// evict : sweep the clock hand till the cache is back within its budget
+func (ac *AttrCache) evict() {
+	evicted := int64(0)
+
+	for ac.ring.full() && len(ac.ring.keys) > 0 {
+		if ac.ring.hand >= len(ac.ring.keys) {
+			ac.ring.hand = 0
+		}
+
+		key := ac.ring.keys[ac.ring.hand]
+		item, found := ac.cacheMap[key]
+		if found && item.valid() && atomic.CompareAndSwapUint32(&item.referenced, 1, 0) {
+			// Recently used, give it a second chance
+			ac.ring.hand++
+			continue
+		}
+
+		if found {
+			ac.ring.used -= item.cost
+			delete(ac.cacheMap, key)
+			evicted++
+		}
+
+		// Move the last key into this slot, hand stays so that the moved key is examined next
+		last := len(ac.ring.keys) - 1
+		ac.ring.keys[ac.ring.hand] = ac.ring.keys[last]
+		ac.ring.keys = ac.ring.keys[:last]
+	}
+
+	if evicted > 0 {
+		attrCacheStatsCollector.UpdateStats(stats_manager.Increment, evictions, evicted)
+	}
+	attrCacheStatsCollector.UpdateStats(stats_manager.Replace, cachedItems, int64(len(ac.ring.keys)))
+	attrCacheStatsCollector.UpdateStats(stats_manager.Replace, memUsage, ac.ring.used)
+}
+
+// recordHit : mark the item recently used and publish the hit ratio, this is called holding only the read lock
+func (ac *AttrCache) recordHit(item *attrCacheItem) {
+	atomic.StoreUint32(&item.referenced, 1)
+	hits := atomic.AddInt64(&ac.hits, 1)
+	misses := atomic.LoadInt64(&ac.misses)
+
+	attrCacheStatsCollector.UpdateStats(stats_manager.Increment, cacheHits, (int64)(1))
+	attrCacheStatsCollector.UpdateStats(stats_manager.Replace, hitRatio, (hits*100)/(hits+misses))
+}
+
+// recordMiss : count a lookup which had to go to the next component and publish the hit ratio
+func (ac *AttrCache) recordMiss() {
+	misses := atomic.AddInt64(&ac.misses, 1)
+	hits := atomic.LoadInt64(&ac.hits)
+
+	attrCacheStatsCollector.UpdateStats(stats_manager.Increment, cacheMisses, (int64)(1))
+	attrCacheStatsCollector.UpdateStats(stats_manager.Replace, hitRatio, (hits*100)/(hits+misses))
+}
@@ -0,0 +1,206 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package attr_cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+)
+
+// Version of the on disk snapshot format, bump it whenever snapshotEntry changes
+const snapshotVersion = 2
+
+// snapshotHeader : first record of a snapshot file
+type snapshotHeader struct {
+	Version   int
+	CreatedAt time.Time
+}
+
+// snapshotEntry : one attribute cache item as stored on disk
+type snapshotEntry struct {
+	Path     string
+	Attr     internal.ObjAttr
+	Exists   bool
+	CachedAt time.Time
+}
+
+// saveSnapshot : write all valid items of the cache to the snapshot file.
+// Data is written to a temp file first and then renamed so a crash never leaves a partial snapshot behind.
+func (ac *AttrCache) saveSnapshot() error {
+	tmpPath := ac.snapshotPath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Err("AttrCache::saveSnapshot : Failed to create %s [%s]", tmpPath, err.Error())
+		return err
+	}
+
+	writer := bufio.NewWriter(f)
+	encoder := gob.NewEncoder(writer)
+
+	err = encoder.Encode(snapshotHeader{Version: snapshotVersion, CreatedAt: time.Now()})
+	if err == nil {
+		count := 0
+		ac.cacheLock.RLock()
+		for path, item := range ac.cacheMap {
+			// Invalid and expired items carry no information, negative items are kept so lookups of missing paths stay cheap
+			if !item.valid() || time.Since(item.cachedAt).Seconds() >= float64(ac.cacheTimeout) {
+				continue
+			}
+
+			err = encoder.Encode(snapshotEntry{Path: path, Attr: *item.getAttr(), Exists: item.exists(), CachedAt: item.cachedAt})
+			if err != nil {
+				break
+			}
+			count++
+		}
+		ac.cacheLock.RUnlock()
+		log.Debug("AttrCache::saveSnapshot : %d items written to %s", count, ac.snapshotPath)
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+
+	if err != nil {
+		log.Err("AttrCache::saveSnapshot : Failed to write %s [%s]", tmpPath, err.Error())
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, ac.snapshotPath)
+	if err != nil {
+		log.Err("AttrCache::saveSnapshot : Failed to rename %s [%s]", tmpPath, err.Error())
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// loadSnapshot : populate the cache from the snapshot file.
+// Restored items are served from cache for the trust window only, after that they are revalidated on next access.
+func (ac *AttrCache) loadSnapshot() error {
+	f, err := os.Open(ac.snapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Info("AttrCache::loadSnapshot : No snapshot found at %s", ac.snapshotPath)
+			return nil
+		}
+		log.Err("AttrCache::loadSnapshot : Failed to open %s [%s]", ac.snapshotPath, err.Error())
+		return err
+	}
+	defer f.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(f))
+
+	header := snapshotHeader{}
+	err = decoder.Decode(&header)
+	if err != nil {
+		log.Err("AttrCache::loadSnapshot : Failed to read header of %s [%s]", ac.snapshotPath, err.Error())
+		return err
+	}
+
+	if header.Version != snapshotVersion {
+		log.Warn("AttrCache::loadSnapshot : Ignoring snapshot %s with version %d", ac.snapshotPath, header.Version)
+		return nil
+	}
+
+	// Backdate the items so that they expire once the trust window is over, items cached earlier keep their age
+	trustedAt := time.Now().Add(time.Duration(ac.trustWindow)*time.Second - time.Duration(ac.cacheTimeout)*time.Second)
+
+	count := 0
+	ac.cacheLock.Lock()
+	defer ac.cacheLock.Unlock()
+
+	for {
+		entry := snapshotEntry{}
+		err = decoder.Decode(&entry)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			log.Err("AttrCache::loadSnapshot : Snapshot %s is corrupt, %d items restored [%s]", ac.snapshotPath, count, err.Error())
+			return err
+		}
+
+		attr := entry.Attr
+		if !entry.Exists {
+			attr = internal.ObjAttr{}
+		}
+		cachedAt := trustedAt
+		if entry.CachedAt.Before(cachedAt) {
+			cachedAt = entry.CachedAt
+		}
+		ac.insertItem(entry.Path, newAttrCacheItem(&attr, entry.Exists, cachedAt))
+		count++
+	}
+
+	log.Info("AttrCache::loadSnapshot : %d items restored from %s created at %s",
+		count, ac.snapshotPath, header.CreatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// snapshotWorker : periodically persist the cache till the component is stopped
+func (ac *AttrCache) snapshotWorker() {
+	defer ac.snapshotWg.Done()
+
+	ticker := time.NewTicker(time.Duration(ac.snapshotInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ac.snapshotStop:
+			return
+		case <-ticker.C:
+			_ = ac.saveSnapshot()
+		}
+	}
+}
+
+// validateSnapshotPath : make sure the directory holding the snapshot exists
+func validateSnapshotPath(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
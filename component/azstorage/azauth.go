@@ -40,10 +40,11 @@ import (
 // AzAuthConfig : Config to authenticate to storage
 type azAuthConfig struct {
 	// Account
-	AccountName string
-	UseHTTP     bool
-	AccountType AccountType
-	AuthMode    AuthType
+	AccountName  string
+	UseHTTP      bool
+	UsePathStyle bool // account name is in the endpoint path, blob and dfs apis are served from the same url
+	AccountType  AccountType
+	AuthMode     AuthType
 
 	// Key config
 	AccountKey string
@@ -62,6 +63,13 @@ type azAuthConfig struct {
 	ClientSecret            string
 	ActiveDirectoryEndpoint string
 
+	// SPN certificate config
+	ClientCertPath     string
+	ClientCertPassword string
+
+	// Client assertion config
+	FederatedTokenFile string
+
 	Endpoint     string
 	AuthResource string
 }
@@ -115,12 +123,18 @@ func getAzAuthBlob(config azAuthConfig) azAuth {
 				azAuthBase: base,
 			},
 		}
-	} else if config.AuthMode == EAuthType.SPN() {
+	} else if config.AuthMode == EAuthType.SPN() || config.AuthMode == EAuthType.SPNCERT() || config.AuthMode == EAuthType.CLIENTASSERTION() {
 		return &azAuthBlobSPN{
 			azAuthSPN{
 				azAuthBase: base,
 			},
 		}
+	} else if config.AuthMode == EAuthType.AZCLI() {
+		return &azAuthBlobCLI{
+			azAuthCLI{
+				azAuthBase: base,
+			},
+		}
 	} else {
 		log.Crit("azAuth::getAzAuthBlob : Auth type %s not supported. Failed to create Auth object", config.AuthMode)
 	}
@@ -147,12 +161,18 @@ func getAzAuthBfs(config azAuthConfig) azAuth {
 				azAuthBase: base,
 			},
 		}
-	} else if config.AuthMode == EAuthType.SPN() {
+	} else if config.AuthMode == EAuthType.SPN() || config.AuthMode == EAuthType.SPNCERT() || config.AuthMode == EAuthType.CLIENTASSERTION() {
 		return &azAuthBfsSPN{
 			azAuthSPN{
 				azAuthBase: base,
 			},
 		}
+	} else if config.AuthMode == EAuthType.AZCLI() {
+		return &azAuthBfsCLI{
+			azAuthCLI{
+				azAuthBase: base,
+			},
+		}
 	} else {
 		log.Crit("azAuth::getAzAuthBfs : Auth type %s not supported. Failed to create Auth object", config.AuthMode)
 	}
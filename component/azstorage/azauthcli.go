@@ -0,0 +1,181 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+
+	"github.com/Azure/azure-storage-azcopy/v10/azbfs"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Verify that the Auth implement the correct AzAuth interfaces
+var _ azAuth = &azAuthBlobCLI{}
+var _ azAuth = &azAuthBfsCLI{}
+
+// Command used to get tokens of the user logged in with 'az login', a variable so tests can replace it
+var azCLICommand = "az"
+
+const azCLITimeout = 30 * time.Second
+
+type azAuthCLI struct {
+	azAuthBase
+}
+
+// cliToken : Output of 'az account get-access-token'
+type cliToken struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresOn   string `json:"expiresOn"`  // local time, e.g. "2023-01-01 10:00:00.000000"
+	ExpiresUnix int64  `json:"expires_on"` // only reported by newer versions of the CLI
+}
+
+// fetchToken : Ask the Azure CLI for a token of the logged in user
+func (azcli *azAuthCLI) fetchToken() (string, time.Time, error) {
+	args := []string{"account", "get-access-token", "--output", "json", "--resource", azcli.getEndpoint()}
+	if azcli.config.TenantID != "" {
+		args = append(args, "--tenant", azcli.config.TenantID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), azCLITimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, azCLICommand, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", time.Time{}, fmt.Errorf("az account get-access-token failed, run 'az login' first [%s]", msg)
+	}
+
+	return parseCLIToken(out)
+}
+
+// parseCLIToken : Extract the token and its expiry from the output of the CLI
+func parseCLIToken(out []byte) (string, time.Time, error) {
+	token := cliToken{}
+	err := json.Unmarshal(out, &token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("no access token in the output of az")
+	}
+
+	if token.ExpiresUnix != 0 {
+		return token.AccessToken, time.Unix(token.ExpiresUnix, 0), nil
+	}
+
+	expires, err := time.ParseInLocation("2006-01-02 15:04:05.999999", token.ExpiresOn, time.Local)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid token expiry %s", token.ExpiresOn)
+	}
+
+	return token.AccessToken, expires, nil
+}
+
+type azAuthBlobCLI struct {
+	azAuthCLI
+}
+
+// GetCredential : Get Azure CLI based credentials for blob
+func (azcli *azAuthBlobCLI) getCredential() interface{} {
+	token, expires, err := azcli.fetchToken()
+	if err != nil {
+		log.Err("azAuthBlobCLI::getCredential : Failed to get token from Azure CLI [%s]", err.Error())
+		return nil
+	}
+
+	// Using token create the credential object, here also register a call back which refreshes the token
+	tc := azblob.NewTokenCredential(token, func(tc azblob.TokenCredential) time.Duration {
+		token, expires, err = azcli.fetchToken()
+		if err != nil {
+			log.Err("azAuthBlobCLI::getCredential : Failed to refresh token from Azure CLI [%s]", err.Error())
+			return 0
+		}
+
+		// set the new token value
+		tc.SetToken(token)
+		log.Debug("azAuthBlobCLI::getCredential : Azure CLI Token retrieved, expires %s", expires)
+
+		// Get the next token slightly before the current one expires
+		return time.Until(expires) - 10*time.Second
+	})
+
+	return tc
+}
+
+type azAuthBfsCLI struct {
+	azAuthCLI
+}
+
+// GetCredential : Get Azure CLI based credentials for datalake
+func (azcli *azAuthBfsCLI) getCredential() interface{} {
+	token, expires, err := azcli.fetchToken()
+	if err != nil {
+		log.Err("azAuthBfsCLI::getCredential : Failed to get token from Azure CLI [%s]", err.Error())
+		return nil
+	}
+
+	// Using token create the credential object, here also register a call back which refreshes the token
+	tc := azbfs.NewTokenCredential(token, func(tc azbfs.TokenCredential) time.Duration {
+		token, expires, err = azcli.fetchToken()
+		if err != nil {
+			log.Err("azAuthBfsCLI::getCredential : Failed to refresh token from Azure CLI [%s]", err.Error())
+			return 0
+		}
+
+		// set the new token value
+		tc.SetToken(token)
+		log.Debug("azAuthBfsCLI::getCredential : Azure CLI Token retrieved, expires %s", expires)
+
+		// Get the next token slightly before the current one expires
+		return time.Until(expires) - 10*time.Second
+	})
+
+	return tc
+}
@@ -34,6 +34,14 @@
 package azstorage
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
@@ -68,17 +76,124 @@ func (azspn *azAuthSPN) fetchToken() (*adal.ServicePrincipalToken, error) {
 		return nil, err
 	}
 
-	//  Generate the SPN token
+	//  Generate the SPN token, the application proves its identity with a secret, a certificate or a federated token
 	resourceURL := azspn.getEndpoint()
-	spt, err := adal.NewServicePrincipalToken(*config, azspn.config.ClientID, azspn.config.ClientSecret, resourceURL)
-	if err != nil {
-		log.Err("AzAuthSPN::fetchToken : Failed to generate token for SPN [%s]", err.Error())
-		return nil, err
+	var spt *adal.ServicePrincipalToken
+	switch azspn.config.AuthMode {
+	case EAuthType.SPNCERT():
+		cert, key, err := readClientCertificate(azspn.config.ClientCertPath, azspn.config.ClientCertPassword)
+		if err != nil {
+			log.Err("AzAuthSPN::fetchToken : Failed to read client certificate %s [%s]", azspn.config.ClientCertPath, err.Error())
+			return nil, err
+		}
+		spt, err = adal.NewServicePrincipalTokenFromCertificate(*config, azspn.config.ClientID, cert, key, resourceURL)
+		if err != nil {
+			log.Err("AzAuthSPN::fetchToken : Failed to generate token for SPN with certificate [%s]", err.Error())
+			return nil, err
+		}
+
+	case EAuthType.CLIENTASSERTION():
+		secret := &federatedTokenFileSecret{path: azspn.config.FederatedTokenFile}
+		spt, err = adal.NewServicePrincipalTokenWithSecret(*config, azspn.config.ClientID, resourceURL, secret)
+		if err != nil {
+			log.Err("AzAuthSPN::fetchToken : Failed to generate token for client assertion [%s]", err.Error())
+			return nil, err
+		}
+
+	default:
+		spt, err = adal.NewServicePrincipalToken(*config, azspn.config.ClientID, azspn.config.ClientSecret, resourceURL)
+		if err != nil {
+			log.Err("AzAuthSPN::fetchToken : Failed to generate token for SPN [%s]", err.Error())
+			return nil, err
+		}
 	}
 
 	return spt, nil
 }
 
+// federatedTokenFileSecret : Client assertion read from a file every time a token is requested.
+// Workload identity rotates the projected token in the file, so it can not be read once at mount.
+type federatedTokenFileSecret struct {
+	path string
+}
+
+// SetAuthenticationValues : Add the current federated token to the token request
+func (secret *federatedTokenFileSecret) SetAuthenticationValues(_ *adal.ServicePrincipalToken, v *url.Values) error {
+	jwt, err := ioutil.ReadFile(secret.path)
+	if err != nil {
+		log.Err("federatedTokenFileSecret::SetAuthenticationValues : Failed to read federated token %s [%s]", secret.path, err.Error())
+		return err
+	}
+
+	assertion := strings.TrimSpace(string(jwt))
+	if assertion == "" {
+		return fmt.Errorf("federated token file %s is empty", secret.path)
+	}
+
+	v.Set("client_assertion", assertion)
+	v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	return nil
+}
+
+// readClientCertificate : Load the certificate and RSA private key of the application from a PEM or PKCS#12 file
+func readClientCertificate(path string, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !strings.Contains(string(data), "-----BEGIN") {
+		return adal.DecodePfxCertificateData(data, password)
+	}
+
+	var certs []*x509.Certificate
+	var key *rsa.PrivateKey
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			var ok bool
+			key, ok = parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, errors.New("private key is not an RSA key")
+			}
+
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, nil, errors.New("encrypted PEM private keys are not supported, use a PKCS#12 file with a password")
+		}
+	}
+
+	if key == nil {
+		return nil, nil, errors.New("no private key found")
+	}
+
+	// Chain may hold more than one certificate, pick the one matching the key
+	for _, cert := range certs {
+		if public, ok := cert.PublicKey.(*rsa.PublicKey); ok && public.E == key.E && public.N.Cmp(key.N) == 0 {
+			return cert, key, nil
+		}
+	}
+
+	return nil, nil, errors.New("no certificate matching the private key found")
+}
+
 type azAuthBlobSPN struct {
 	azAuthSPN
 }
@@ -36,6 +36,8 @@ package azstorage
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -57,6 +59,12 @@ type AzStorage struct {
 	stConfig    AzStorageConfig
 	startTime   time.Time
 	listBlocked bool
+	locker      *leaseLocker
+	readOnly    bool
+
+	// Recovery of interrupted directory renames running in the background after mount
+	stopRecovery context.CancelFunc
+	recoveryDone chan struct{}
 }
 
 const compName = "azstorage"
@@ -95,6 +103,12 @@ func (az *AzStorage) Configure(isParent bool) error {
 		return fmt.Errorf("config error in %s [%s]", az.Name(), err.Error())
 	}
 
+	err = config.UnmarshalKey("read-only", &az.readOnly)
+	if err != nil {
+		log.Err("AzStorage::Configure : config error [unable to obtain read-only]")
+		return fmt.Errorf("config error in %s [%s]", az.Name(), err.Error())
+	}
+
 	err = az.configureAndTest(isParent)
 	if err != nil {
 		log.Err("AzStorage::Configure : Failed to validate storage account [%s]", err.Error())
@@ -168,13 +182,47 @@ func (az *AzStorage) Start(ctx context.Context) error {
 
 	// create stats collector for azstorage
 	azStatsCollector = stats_manager.NewStatsCollector(az.Name())
+	// Open handles go down as well, which makes the stat a gauge from the start
+	azStatsCollector.UpdateStats(stats_manager.Replace, openHandles, (int64)(0))
+
+	// A directory rename cut short by the last unmount leaves the tree half moved, sort it out in the background
+	// as there may be many blobs to move. Read-only mounts leave it to the next mount which can write.
+	if !az.readOnly {
+		var recoveryCtx context.Context
+		recoveryCtx, az.stopRecovery = context.WithCancel(context.Background())
+		az.recoveryDone = make(chan struct{})
+		go az.recoverRenames(recoveryCtx)
+	}
+
+	az.locker = newLeaseLocker(az.storage, az.stConfig.leaseDuration)
+	az.locker.start()
 
 	return nil
 }
 
+// recoverRenames : Resume or roll back directory renames the last unmount did not finish
+func (az *AzStorage) recoverRenames(ctx context.Context) {
+	defer close(az.recoveryDone)
+
+	err := az.storage.RecoverRenames(ctx)
+	if err != nil && err != context.Canceled {
+		log.Err("AzStorage::recoverRenames : Failed to recover interrupted directory renames [%s]", err.Error())
+	}
+}
+
 // Stop : Disconnect all running operations here
 func (az *AzStorage) Stop() error {
 	log.Trace("AzStorage::Stop : Stopping component %s", az.Name())
+	if az.stopRecovery != nil {
+		// Journal of a rename cut short here stays for the next mount
+		az.stopRecovery()
+		<-az.recoveryDone
+		az.stopRecovery, az.recoveryDone = nil, nil
+	}
+	if az.locker != nil {
+		az.locker.close()
+		az.locker = nil
+	}
 	azStatsCollector.Destroy()
 	return nil
 }
@@ -189,8 +237,13 @@ func (az *AzStorage) ListContainers() ([]string, error) {
 // Directory operations
 func (az *AzStorage) CreateDir(options internal.CreateDirOptions) error {
 	log.Trace("AzStorage::CreateDir : %s", options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
 
-	err := az.storage.CreateDirectory(internal.TruncateDirName(options.Name))
+	err := az.storage.CreateDirectory(ctx, internal.TruncateDirName(options.Name))
 
 	if err == nil {
 		azStatsCollector.PushEvents(createDir, options.Name, map[string]interface{}{mode: options.Mode.String()})
@@ -202,8 +255,13 @@ func (az *AzStorage) CreateDir(options internal.CreateDirOptions) error {
 
 func (az *AzStorage) DeleteDir(options internal.DeleteDirOptions) error {
 	log.Trace("AzStorage::DeleteDir : %s", options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
 
-	err := az.storage.DeleteDirectory(internal.TruncateDirName(options.Name))
+	err := az.storage.DeleteDirectory(ctx, internal.TruncateDirName(options.Name))
 
 	if err == nil {
 		azStatsCollector.PushEvents(deleteDir, options.Name, nil)
@@ -226,7 +284,11 @@ func formatListDirName(path string) string {
 
 func (az *AzStorage) IsDirEmpty(options internal.IsDirEmptyOptions) bool {
 	log.Trace("AzStorage::IsDirEmpty : %s", options.Name)
-	list, _, err := az.storage.List(formatListDirName(options.Name), nil, 1)
+	ctx := requestContext(options.Ctx)
+	if az.isVirtualPath(options.Name) {
+		return false
+	}
+	list, _, err := az.storage.List(ctx, formatListDirName(options.Name), nil, 1)
 	if err != nil {
 		log.Err("AzStorage::IsDirEmpty : error listing [%s]", err)
 		return false
@@ -239,6 +301,7 @@ func (az *AzStorage) IsDirEmpty(options internal.IsDirEmptyOptions) bool {
 
 func (az *AzStorage) ReadDir(options internal.ReadDirOptions) ([]*internal.ObjAttr, error) {
 	log.Trace("AzStorage::ReadDir : %s", options.Name)
+	ctx := requestContext(options.Ctx)
 	blobList := make([]*internal.ObjAttr, 0)
 
 	if az.listBlocked {
@@ -252,11 +315,25 @@ func (az *AzStorage) ReadDir(options internal.ReadDirOptions) ([]*internal.ObjAt
 		}
 	}
 
+	if az.isVirtualPath(options.Name) {
+		for token := ""; ; {
+			list, marker, err := az.StreamDir(internal.StreamDirOptions{Name: options.Name, Token: token})
+			if err != nil {
+				return blobList, err
+			}
+			blobList = append(blobList, list...)
+			if marker == "" {
+				return blobList, nil
+			}
+			token = marker
+		}
+	}
+
 	path := formatListDirName(options.Name)
 	var iteration int = 0
 	var marker *string = nil
 	for {
-		new_list, new_marker, err := az.storage.List(path, marker, common.MaxDirListCount)
+		new_list, new_marker, err := az.storage.List(ctx, path, marker, common.MaxDirListCount)
 		if err != nil {
 			log.Err("AzStorage::ReadDir : Failed to read dir [%s]", err)
 			return blobList, err
@@ -276,6 +353,7 @@ func (az *AzStorage) ReadDir(options internal.ReadDirOptions) ([]*internal.ObjAt
 
 func (az *AzStorage) StreamDir(options internal.StreamDirOptions) ([]*internal.ObjAttr, string, error) {
 	log.Trace("AzStorage::StreamDir : Path %s, offset %d, count %d", options.Name, options.Offset, options.Count)
+	ctx := requestContext(options.Ctx)
 
 	if az.listBlocked {
 		diff := time.Since(az.startTime)
@@ -288,9 +366,15 @@ func (az *AzStorage) StreamDir(options internal.StreamDirOptions) ([]*internal.O
 		}
 	}
 
+	if az.isVersionsPath(options.Name) {
+		return az.streamVersionsDir(options)
+	} else if az.isTrashPath(options.Name) {
+		return az.streamTrashDir(options)
+	}
+
 	path := formatListDirName(options.Name)
 
-	new_list, new_marker, err := az.storage.List(path, &options.Token, options.Count)
+	new_list, new_marker, err := az.storage.List(ctx, path, &options.Token, options.Count)
 	if err != nil {
 		log.Err("AzStorage::StreamDir : Failed to read dir [%s]", err)
 		return new_list, "", err
@@ -327,10 +411,16 @@ func (az *AzStorage) StreamDir(options internal.StreamDirOptions) ([]*internal.O
 
 func (az *AzStorage) RenameDir(options internal.RenameDirOptions) error {
 	log.Trace("AzStorage::RenameDir : %s to %s", options.Src, options.Dst)
+	ctx := requestContext(options.Ctx)
+	if az.isTrashPath(options.Src) && !az.isVirtualPath(options.Dst) {
+		return az.restoreDir(ctx, options.Src, options.Dst)
+	} else if az.isVirtualPath(options.Src) || az.isVirtualPath(options.Dst) {
+		return syscall.EROFS
+	}
 	options.Src = internal.TruncateDirName(options.Src)
 	options.Dst = internal.TruncateDirName(options.Dst)
 
-	err := az.storage.RenameDirectory(options.Src, options.Dst)
+	err := az.storage.RenameDirectory(ctx, options.Src, options.Dst)
 
 	if err == nil {
 		azStatsCollector.PushEvents(renameDir, options.Src, map[string]interface{}{src: options.Src, dest: options.Dst})
@@ -342,6 +432,11 @@ func (az *AzStorage) RenameDir(options internal.RenameDirOptions) error {
 // File operations
 func (az *AzStorage) CreateFile(options internal.CreateFileOptions) (*handlemap.Handle, error) {
 	log.Trace("AzStorage::CreateFile : %s", options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return nil, syscall.EROFS
+	}
 
 	// Create a handle object for the file being created
 	// This handle will be added to handlemap by the first component in pipeline
@@ -351,7 +446,7 @@ func (az *AzStorage) CreateFile(options internal.CreateFileOptions) (*handlemap.
 		return nil, syscall.EFAULT
 	}
 
-	err := az.storage.CreateFile(options.Name, options.Mode)
+	err := az.storage.CreateFile(ctx, options.Name, options.Mode)
 	if err != nil {
 		return nil, err
 	}
@@ -367,8 +462,19 @@ func (az *AzStorage) CreateFile(options internal.CreateFileOptions) (*handlemap.
 
 func (az *AzStorage) OpenFile(options internal.OpenFileOptions) (*handlemap.Handle, error) {
 	log.Trace("AzStorage::OpenFile : %s", options.Name)
+	ctx := requestContext(options.Ctx)
 
-	attr, err := az.storage.GetAttr(options.Name)
+	if az.isVersionsPath(options.Name) {
+		handle, err := az.openVersion(options)
+		if err == nil {
+			azStatsCollector.UpdateStats(stats_manager.Increment, openHandles, (int64)(1))
+		}
+		return handle, err
+	} else if az.isTrashPath(options.Name) {
+		return nil, az.trashNotReadable(options.Name)
+	}
+
+	attr, err := az.storage.GetAttr(ctx, options.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -392,6 +498,11 @@ func (az *AzStorage) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 func (az *AzStorage) CloseFile(options internal.CloseFileOptions) error {
 	log.Trace("AzStorage::CloseFile : %s", options.Handle.Path)
 
+	// Locks go away with the handle, let other mounts have the blob
+	if az.locker != nil {
+		az.locker.unlockHandle(options.Handle)
+	}
+
 	// decrement open file handles count
 	azStatsCollector.UpdateStats(stats_manager.Decrement, openHandles, (int64)(1))
 
@@ -400,8 +511,13 @@ func (az *AzStorage) CloseFile(options internal.CloseFileOptions) error {
 
 func (az *AzStorage) DeleteFile(options internal.DeleteFileOptions) error {
 	log.Trace("AzStorage::DeleteFile : %s", options.Name)
+	ctx := requestContext(options.Ctx)
 
-	err := az.storage.DeleteFile(options.Name)
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+
+	err := az.storage.DeleteFile(ctx, options.Name)
 
 	if err == nil {
 		azStatsCollector.PushEvents(deleteFile, options.Name, nil)
@@ -413,8 +529,14 @@ func (az *AzStorage) DeleteFile(options internal.DeleteFileOptions) error {
 
 func (az *AzStorage) RenameFile(options internal.RenameFileOptions) error {
 	log.Trace("AzStorage::RenameFile : %s to %s", options.Src, options.Dst)
+	ctx := requestContext(options.Ctx)
+	if az.isTrashPath(options.Src) && !az.isVirtualPath(options.Dst) {
+		return az.restoreFile(ctx, options.Src, options.Dst)
+	} else if az.isVirtualPath(options.Src) || az.isVirtualPath(options.Dst) {
+		return syscall.EROFS
+	}
 
-	err := az.storage.RenameFile(options.Src, options.Dst)
+	err := az.storage.RenameFile(ctx, options.Src, options.Dst)
 
 	if err == nil {
 		azStatsCollector.PushEvents(renameFile, options.Src, map[string]interface{}{src: options.Src, dest: options.Dst})
@@ -424,11 +546,17 @@ func (az *AzStorage) RenameFile(options internal.RenameFileOptions) error {
 }
 
 func (az *AzStorage) ReadFile(options internal.ReadFileOptions) (data []byte, err error) {
+	ctx := requestContext(options.Ctx)
 	//log.Trace("AzStorage::ReadFile : Read %s", h.Path)
-	return az.storage.ReadBuffer(options.Handle.Path, 0, 0)
+	if az.isVersionsPath(options.Handle.Path) {
+		data = make([]byte, atomic.LoadInt64(&options.Handle.Size))
+		return data, az.readVersion(ctx, options.Handle.Path, 0, data)
+	}
+	return az.storage.ReadBuffer(ctx, options.Handle.Path, 0, 0)
 }
 
 func (az *AzStorage) ReadInBuffer(options internal.ReadInBufferOptions) (length int, err error) {
+	ctx := requestContext(options.Ctx)
 	//log.Trace("AzStorage::ReadInBuffer : Read %s from %d offset", h.Path, offset)
 
 	if options.Offset > atomic.LoadInt64(&options.Handle.Size) {
@@ -444,7 +572,11 @@ func (az *AzStorage) ReadInBuffer(options internal.ReadInBufferOptions) (length
 		return 0, nil
 	}
 
-	err = az.storage.ReadInBuffer(options.Handle.Path, options.Offset, dataLen, options.Data)
+	if az.isVersionsPath(options.Handle.Path) {
+		err = az.readVersion(ctx, options.Handle.Path, options.Offset, options.Data[:dataLen])
+	} else {
+		err = az.storage.ReadInBuffer(ctx, options.Handle.Path, options.Offset, dataLen, options.Data)
+	}
 	if err != nil {
 		log.Err("AzStorage::ReadInBuffer : Failed to read %s [%s]", options.Handle.Path, err.Error())
 	}
@@ -454,18 +586,30 @@ func (az *AzStorage) ReadInBuffer(options internal.ReadInBufferOptions) (length
 }
 
 func (az *AzStorage) WriteFile(options internal.WriteFileOptions) (int, error) {
+	if az.isVirtualPath(options.Handle.Path) {
+		return 0, syscall.EROFS
+	}
 	err := az.storage.Write(options)
 	return len(options.Data), err
 }
 
 func (az *AzStorage) GetFileBlockOffsets(options internal.GetFileBlockOffsetsOptions) (*common.BlockOffsetList, error) {
-	return az.storage.GetFileBlockOffsets(options.Name)
+	ctx := requestContext(options.Ctx)
+	if az.isVirtualPath(options.Name) {
+		return nil, syscall.EROFS
+	}
+	return az.storage.GetFileBlockOffsets(ctx, options.Name)
 
 }
 
 func (az *AzStorage) TruncateFile(options internal.TruncateFileOptions) error {
 	log.Trace("AzStorage::TruncateFile : %s to %d bytes", options.Name, options.Size)
-	err := az.storage.TruncateFile(options.Name, options.Size)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+	err := az.storage.TruncateFile(ctx, options.Name, options.Size)
 
 	if err == nil {
 		azStatsCollector.PushEvents(truncateFile, options.Name, map[string]interface{}{size: options.Size})
@@ -476,18 +620,107 @@ func (az *AzStorage) TruncateFile(options internal.TruncateFileOptions) error {
 
 func (az *AzStorage) CopyToFile(options internal.CopyToFileOptions) error {
 	log.Trace("AzStorage::CopyToFile : Read file %s", options.Name)
-	return az.storage.ReadToFile(options.Name, options.Offset, options.Count, options.File)
+	ctx := requestContext(options.Ctx)
+	if az.isVersionsPath(options.Name) {
+		return az.copyVersionToFile(options)
+	} else if az.isTrashPath(options.Name) {
+		return az.trashNotReadable(options.Name)
+	}
+	return az.storage.ReadToFile(ctx, options.Name, options.Offset, options.Count, options.File)
 }
 
 func (az *AzStorage) CopyFromFile(options internal.CopyFromFileOptions) error {
 	log.Trace("AzStorage::CopyFromFile : Upload file %s", options.Name)
-	return az.storage.WriteFromFile(options.Name, options.Metadata, options.File)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+
+	var etag string
+	var err error
+	if options.Reader != nil {
+		etag, err = az.storage.WriteFromReader(ctx, options.Name, options.Metadata, options.Reader, options.Size, options.ETag)
+	} else if options.ETag != "" {
+		etag, err = az.storage.WriteFromFileIfMatch(ctx, options.Name, options.Metadata, options.File, options.ETag)
+	} else {
+		etag, err = az.storage.WriteFromFile(ctx, options.Name, options.Metadata, options.File)
+	}
+
+	if err == nil && options.Handle != nil {
+		options.Handle.ETag = etag
+	}
+	return err
+}
+
+// CopyFileRange : Copy a range of a blob on the service. A range covering all of the source that replaces the target
+// is a blob copy, other ranges are staged as blocks from the source and the rest of the target.
+func (az *AzStorage) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	ctx := requestContext(options.Ctx)
+	srcName := options.SrcHandle.Path
+	dstName := options.DstHandle.Path
+	log.Trace("AzStorage::CopyFileRange : %s offset %d -> %s offset %d, size %d", srcName, options.SrcOffset, dstName, options.DstOffset, options.Size)
+
+	if az.isVirtualPath(dstName) {
+		return 0, syscall.EROFS
+	} else if az.isVirtualPath(srcName) || srcName == dstName {
+		return 0, syscall.ENOTSUP
+	}
+
+	srcAttr, err := az.storage.GetAttr(ctx, srcName)
+	if err != nil {
+		return 0, err
+	}
+
+	if options.SrcOffset >= srcAttr.Size {
+		// Nothing left to copy past the end of the source
+		return 0, nil
+	}
+
+	count := srcAttr.Size - options.SrcOffset
+	if options.Size < count {
+		count = options.Size
+	}
+
+	dstAttr, err := az.storage.GetAttr(ctx, dstName)
+	if err != nil && err != syscall.ENOENT {
+		return 0, err
+	}
+	dstSize := int64(0)
+	if err == nil {
+		dstSize = dstAttr.Size
+	}
+
+	if options.SrcOffset == 0 && options.DstOffset == 0 && count == srcAttr.Size && dstSize <= srcAttr.Size {
+		err = az.storage.CopyFile(ctx, srcName, dstName)
+	} else {
+		err = az.storage.CopyRange(ctx, srcName, options.SrcOffset, dstName, options.DstOffset, count)
+	}
+	if err != nil {
+		log.Err("AzStorage::CopyFileRange : Failed to copy %s to %s [%s]", srcName, dstName, err.Error())
+		return 0, err
+	}
+
+	if end := options.DstOffset + count; end > dstSize {
+		dstSize = end
+	}
+	options.DstHandle.Size = dstSize
+
+	azStatsCollector.PushEvents(copyFile, srcName, map[string]interface{}{src: srcName, dest: dstName, size: count})
+	azStatsCollector.UpdateStats(stats_manager.Increment, copyFile, (int64)(1))
+
+	return count, nil
 }
 
 // Symlink operations
 func (az *AzStorage) CreateLink(options internal.CreateLinkOptions) error {
 	log.Trace("AzStorage::CreateLink : Create symlink %s -> %s", options.Name, options.Target)
-	err := az.storage.CreateLink(options.Name, options.Target)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+	err := az.storage.CreateLink(ctx, options.Name, options.Target)
 
 	if err == nil {
 		azStatsCollector.PushEvents(createLink, options.Name, map[string]interface{}{target: options.Target})
@@ -499,7 +732,8 @@ func (az *AzStorage) CreateLink(options internal.CreateLinkOptions) error {
 
 func (az *AzStorage) ReadLink(options internal.ReadLinkOptions) (string, error) {
 	log.Trace("AzStorage::ReadLink : Read symlink %s", options.Name)
-	data, err := az.storage.ReadBuffer(options.Name, 0, 0)
+	ctx := requestContext(options.Ctx)
+	data, err := az.storage.ReadBuffer(ctx, options.Name, 0, 0)
 
 	if err != nil {
 		azStatsCollector.PushEvents(readLink, options.Name, nil)
@@ -511,13 +745,24 @@ func (az *AzStorage) ReadLink(options internal.ReadLinkOptions) (string, error)
 
 // Attribute operations
 func (az *AzStorage) GetAttr(options internal.GetAttrOptions) (attr *internal.ObjAttr, err error) {
+	ctx := requestContext(options.Ctx)
 	//log.Trace("AzStorage::GetAttr : Get attributes of file %s", name)
-	return az.storage.GetAttr(options.Name)
+	if az.isVersionsPath(options.Name) {
+		return az.getVersionsAttr(ctx, options.Name)
+	} else if az.isTrashPath(options.Name) {
+		return az.getTrashAttr(ctx, options.Name)
+	}
+	return az.storage.GetAttr(ctx, options.Name)
 }
 
 func (az *AzStorage) Chmod(options internal.ChmodOptions) error {
 	log.Trace("AzStorage::Chmod : Change mod of file %s", options.Name)
-	err := az.storage.ChangeMod(options.Name, options.Mode)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+	err := az.storage.ChangeMod(ctx, options.Name, options.Mode)
 
 	if err == nil {
 		azStatsCollector.PushEvents(chmod, options.Name, map[string]interface{}{mode: options.Mode.String()})
@@ -529,12 +774,211 @@ func (az *AzStorage) Chmod(options internal.ChmodOptions) error {
 
 func (az *AzStorage) Chown(options internal.ChownOptions) error {
 	log.Trace("AzStorage::Chown : Change ownership of file %s to %d-%d", options.Name, options.Owner, options.Group)
-	return az.storage.ChangeOwner(options.Name, options.Owner, options.Group)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+	return az.storage.ChangeOwner(ctx, options.Name, options.Owner, options.Group)
+}
+
+func (az *AzStorage) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	log.Trace("AzStorage::GetXattr : Get %s of %s", options.Attr, options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return nil, syscall.ENODATA
+	}
+
+	if isVirtualXattr(options.Attr) {
+		return az.getVirtualXattr(ctx, options.Name, options.Attr)
+	}
+
+	key, err := xattrToMetadataKey(options.Attr)
+	if err != nil {
+		return nil, err
+	}
+
+	attr, err := az.storage.GetAttr(ctx, options.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found := attr.GetMetadata(key)
+	if !found {
+		return nil, syscall.ENODATA
+	}
+	return []byte(value), nil
+}
+
+func (az *AzStorage) ListXattr(options internal.ListXattrOptions) ([]string, error) {
+	log.Trace("AzStorage::ListXattr : List attributes of %s", options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return []string{}, nil
+	}
+
+	attr, err := az.storage.GetAttr(ctx, options.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(attr.Metadata))
+	for k := range attr.Metadata {
+		if !isReservedMetadataKey(k) {
+			names = append(names, internal.XattrUserPrefix+k)
+		}
+	}
+	sort.Strings(names)
+	return append(names, az.listVirtualXattr(ctx, options.Name, attr)...), nil
+}
+
+func (az *AzStorage) SetXattr(options internal.SetXattrOptions) error {
+	log.Trace("AzStorage::SetXattr : Set %s of %s", options.Attr, options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+
+	if isVirtualXattr(options.Attr) {
+		return az.setVirtualXattr(options)
+	}
+
+	key, err := xattrToMetadataKey(options.Attr)
+	if err != nil {
+		return err
+	}
+
+	if isReservedMetadataKey(key) {
+		return syscall.EPERM
+	}
+
+	if !isValidMetadataValue(options.Value) {
+		log.Err("AzStorage::SetXattr : Value of %s for %s is not printable ascii", options.Attr, options.Name)
+		return syscall.EINVAL
+	}
+
+	err = az.updateMetadata(ctx, options.Name, key, func(metadata map[string]string, found bool) error {
+		if found && options.Flags&internal.XattrCreate != 0 {
+			return syscall.EEXIST
+		} else if !found && options.Flags&internal.XattrReplace != 0 {
+			return syscall.ENODATA
+		}
+
+		metadata[key] = string(options.Value)
+		return nil
+	})
+	if err == nil {
+		az.recordXattrChange(setXattr, options.Name, options.Attr)
+	}
+
+	return err
+}
+
+func (az *AzStorage) RemoveXattr(options internal.RemoveXattrOptions) error {
+	log.Trace("AzStorage::RemoveXattr : Remove %s of %s", options.Attr, options.Name)
+	ctx := requestContext(options.Ctx)
+
+	if az.isVirtualPath(options.Name) {
+		return syscall.EROFS
+	}
+
+	if isVirtualXattr(options.Attr) {
+		return az.removeVirtualXattr(options)
+	}
+
+	key, err := xattrToMetadataKey(options.Attr)
+	if err != nil {
+		return err
+	}
+
+	if isReservedMetadataKey(key) {
+		return syscall.EPERM
+	}
+
+	err = az.updateMetadata(ctx, options.Name, key, func(metadata map[string]string, found bool) error {
+		if !found {
+			return syscall.ENODATA
+		}
+		return nil
+	})
+	if err == nil {
+		az.recordXattrChange(removeXattr, options.Name, options.Attr)
+	}
+
+	return err
+}
+
+// Attempts at updating metadata changed by someone else between reading and writing it back
+const metadataUpdateRetries = 5
+
+// updateMetadata : Read-modify-write of the metadata of a path.
+// update gets a copy of the metadata leaving out the given key and whether the key was present, the result is written back
+// only if the path has not changed since it was read, else it is read again so that concurrent changes to other keys are kept.
+func (az *AzStorage) updateMetadata(ctx context.Context, name string, key string, update func(map[string]string, bool) error) error {
+	for attempt := 1; ; attempt++ {
+		attr, err := az.storage.GetAttr(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		metadata := make(map[string]string, len(attr.Metadata)+1)
+		for k, v := range attr.Metadata {
+			if strings.EqualFold(k, key) {
+				found = true
+				continue
+			}
+			metadata[k] = v
+		}
+
+		err = update(metadata, found)
+		if err != nil {
+			return err
+		}
+
+		err = az.storage.SetMetadata(ctx, name, metadata, attr.ETag)
+		if err != syscall.ESTALE || attempt == metadataUpdateRetries {
+			return err
+		}
+		log.Debug("AzStorage::updateMetadata : %s changed while updating %s, retrying", name, key)
+	}
+}
+
+// recordXattrChange : Push the stats of a successful set or remove of an extended attribute
+func (az *AzStorage) recordXattrChange(op string, name string, xattrName string) {
+	azStatsCollector.PushEvents(op, name, map[string]interface{}{xattr: xattrName})
+	azStatsCollector.UpdateStats(stats_manager.Increment, op, (int64)(1))
 }
 
 func (az *AzStorage) FlushFile(options internal.FlushFileOptions) error {
 	log.Trace("AzStorage::FlushFile : Flush file %s", options.Handle.Path)
-	return az.storage.StageAndCommit(options.Handle.Path, options.Handle.CacheObj.BlockOffsetList)
+	ctx := requestContext(options.Ctx)
+	if az.isVirtualPath(options.Handle.Path) {
+		return syscall.EROFS
+	}
+	return az.storage.StageAndCommit(ctx, options.Handle.Path, options.Handle.CacheObj.BlockOffsetList)
+}
+
+// LockFile : Exclusive locks are backed by a lease on the blob so that they hold across every mount of the container
+func (az *AzStorage) LockFile(options internal.LockFileOptions) error {
+	log.Trace("AzStorage::LockFile : %s, type %d, wait %v", options.Handle.Path, options.Type, options.Wait)
+
+	if az.isVirtualPath(options.Handle.Path) {
+		return syscall.ENOTSUP
+	}
+
+	if az.locker == nil {
+		return syscall.ENOTSUP
+	}
+
+	err := az.locker.lock(options)
+	if err == nil && options.Type == internal.LockExclusive && !options.Test {
+		azStatsCollector.UpdateStats(stats_manager.Increment, fileLocks, (int64)(1))
+	}
+	return err
 }
 
 // TODO : Below methods are pending to be implemented
@@ -552,6 +996,8 @@ func NewazstorageComponent() internal.Component {
 		stConfig: AzStorageConfig{
 			blockSize:      0,
 			maxConcurrency: 32,
+			renameWorkers:  defaultRenameWorkers,
+			leaseDuration:  defaultLeaseDuration,
 			defaultTier:    getAccessTierType("none"),
 			authConfig: azAuthConfig{
 				AuthMode: EAuthType.KEY(),
@@ -47,10 +47,19 @@ const (
 	createFile   = "CreateFile"
 	deleteFile   = "DeleteFile"
 	renameFile   = "RenameFile"
+	copyFile     = "CopyFileRange"
 	truncateFile = "TruncateFile"
 	createLink   = "CreateLink"
 	readLink     = "ReadLink"
 	chmod        = "Chmod"
+	setXattr     = "SetXattr"
+	removeXattr  = "RemoveXattr"
+	undelete     = "Undelete"
+	fileLocks    = "FileLocks"
+
+	storageRequests = "StorageRequests"
+	storageRetries  = "StorageRetries"
+	storageErrors   = "StorageErrors"
 
 	openHandles = "OpenFileHandles"
 	mode        = "Mode"
@@ -59,4 +68,5 @@ const (
 	dest        = "Dest"
 	size        = "Size"
 	target      = "Target"
+	xattr       = "Xattr"
 )
@@ -38,12 +38,14 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"io"
 	"math"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -72,6 +74,7 @@ type BlockBlob struct {
 	downloadOptions azblob.DownloadFromBlobOptions
 	listDetails     azblob.BlobListingDetails
 	blockLocks      common.KeyedMutex
+	leases          sync.Map // Lease ids held by this mount, keyed by blob name
 }
 
 // Verify that BlockBlob implements AzConnection interface
@@ -81,6 +84,15 @@ const (
 	MaxBlocksSize = azblob.BlockBlobMaxStageBlockBytes * azblob.BlockBlobMaxBlocks
 )
 
+const (
+	// Largest block staged from a url in one request
+	copyRangeBlockSize = 100 * 1024 * 1024
+	// Blocks of zeros filling a gap left by a copied range are uploaded from memory
+	copyRangeZeroBlockSize = 4 * 1024 * 1024
+	// Validity of the SAS given to the service to read the source of a copied range
+	copySourceSASExpiry = time.Hour
+)
+
 func (bb *BlockBlob) Configure(cfg AzStorageConfig) error {
 	bb.Config = cfg
 
@@ -107,6 +119,7 @@ func (bb *BlockBlob) UpdateConfig(cfg AzStorageConfig) error {
 	bb.Config.maxConcurrency = cfg.maxConcurrency
 	bb.Config.defaultTier = cfg.defaultTier
 	bb.Config.ignoreAccessModifiers = cfg.ignoreAccessModifiers
+	bb.Config.renameWorkers = cfg.renameWorkers
 	return nil
 }
 
@@ -155,7 +168,11 @@ func NewBlobPipeline(c azblob.Credential, o azblob.PipelineOptions, ro ste.XferR
 	f := []pipeline.Factory{
 		azblob.NewTelemetryPolicyFactory(o.Telemetry),
 		azblob.NewUniqueRequestIDPolicyFactory(),
+		newRequestTracingPolicyFactory(),
+		newRequestStatsPolicyFactory(),
 		ste.NewBlobXferRetryPolicyFactory(ro),
+		newTryStatsPolicyFactory(),
+		newTryTracingPolicyFactory(),
 	}
 	f = append(f, c)
 	f = append(f,
@@ -263,38 +280,38 @@ func (bb *BlockBlob) SetPrefixPath(path string) error {
 }
 
 // CreateFile : Create a new file in the container/virtual directory
-func (bb *BlockBlob) CreateFile(name string, mode os.FileMode) error {
+func (bb *BlockBlob) CreateFile(ctx context.Context, name string, mode os.FileMode) error {
 	log.Trace("BlockBlob::CreateFile : name %s", name)
 	var data []byte
-	return bb.WriteFromBuffer(name, nil, data)
+	return bb.WriteFromBuffer(ctx, name, nil, data)
 }
 
 // CreateDirectory : Create a new directory in the container/virtual directory
-func (bb *BlockBlob) CreateDirectory(name string) error {
+func (bb *BlockBlob) CreateDirectory(ctx context.Context, name string) error {
 	log.Trace("BlockBlob::CreateDirectory : name %s", name)
 
 	var data []byte
 	metadata := make(azblob.Metadata)
 	metadata[folderKey] = "true"
 
-	return bb.WriteFromBuffer(name, metadata, data)
+	return bb.WriteFromBuffer(ctx, name, metadata, data)
 }
 
 // CreateLink : Create a symlink in the container/virtual directory
-func (bb *BlockBlob) CreateLink(source string, target string) error {
+func (bb *BlockBlob) CreateLink(ctx context.Context, source string, target string) error {
 	log.Trace("BlockBlob::CreateLink : %s -> %s", source, target)
 	data := []byte(target)
 	metadata := make(azblob.Metadata)
 	metadata[symlinkKey] = "true"
-	return bb.WriteFromBuffer(source, metadata, data)
+	return bb.WriteFromBuffer(ctx, source, metadata, data)
 }
 
 // DeleteFile : Delete a blob in the container/virtual directory
-func (bb *BlockBlob) DeleteFile(name string) (err error) {
+func (bb *BlockBlob) DeleteFile(ctx context.Context, name string) (err error) {
 	log.Trace("BlockBlob::DeleteFile : name %s", name)
 
 	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
-	_, err = blobURL.Delete(context.Background(), azblob.DeleteSnapshotsOptionInclude, bb.blobAccCond)
+	_, err = blobURL.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, bb.accessConditions(name))
 	if err != nil {
 		serr := storeBlobErrToErr(err)
 		if serr == ErrFileNotFound {
@@ -313,11 +330,11 @@ func (bb *BlockBlob) DeleteFile(name string) (err error) {
 }
 
 // DeleteDirectory : Delete a virtual directory in the container/virtual directory
-func (bb *BlockBlob) DeleteDirectory(name string) (err error) {
+func (bb *BlockBlob) DeleteDirectory(ctx context.Context, name string) (err error) {
 	log.Trace("BlockBlob::DeleteDirectory : name %s", name)
 
 	for marker := (azblob.Marker{}); marker.NotDone(); {
-		listBlob, err := bb.Container.ListBlobsFlatSegment(context.Background(), marker,
+		listBlob, err := bb.Container.ListBlobsFlatSegment(ctx, marker,
 			azblob.ListBlobsSegmentOptions{MaxResults: common.MaxDirListCount,
 				Prefix: filepath.Join(bb.Config.prefixPath, name) + "/",
 			})
@@ -330,108 +347,283 @@ func (bb *BlockBlob) DeleteDirectory(name string) (err error) {
 
 		// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
 		for _, blobInfo := range listBlob.Segment.BlobItems {
-			err = bb.DeleteFile(split(bb.Config.prefixPath, blobInfo.Name))
+			err = bb.DeleteFile(ctx, split(bb.Config.prefixPath, blobInfo.Name))
 			if err != nil {
 				log.Err("BlockBlob::DeleteDirectory : Failed to delete file %s [%s]", blobInfo.Name, err.Error)
 			}
 		}
 	}
-	return bb.DeleteFile(name)
+	return bb.DeleteFile(ctx, name)
 }
 
 // RenameFile : Rename the file
-func (bb *BlockBlob) RenameFile(source string, target string) error {
+func (bb *BlockBlob) RenameFile(ctx context.Context, source string, target string) error {
 	log.Trace("BlockBlob::RenameFile : %s -> %s", source, target)
 
+	err := bb.copyBlob(ctx, source, target)
+	if err != nil {
+		return err
+	}
+
+	log.Trace("BlockBlob::RenameFile : %s -> %s done", source, target)
+
+	// Copy of the file is done so now delete the older file
+	err = bb.DeleteFile(ctx, source)
+	for retry := 0; retry < 3 && err == syscall.ENOENT; retry++ {
+		// Sometimes backend is able to copy source file to destination but when we try to delete the
+		// source files it returns back with ENOENT. If file was just created on backend it might happen
+		// that it has not been synced yet at all layers and hence delete is not able to find the source file
+		log.Trace("BlockBlob::RenameFile : %s -> %s, unable to find source. Retrying %d", source, target, retry)
+		time.Sleep(1 * time.Second)
+		err = bb.DeleteFile(ctx, source)
+	}
+
+	if err == syscall.ENOENT {
+		// Even after 3 retries, 1 second apart if server returns 404 then source file no longer
+		// exists on the backend and its safe to assume rename was successful
+		err = nil
+	}
+
+	return err
+}
+
+// CopyFile : Copy a blob to a new name within the container, data does not leave the service
+func (bb *BlockBlob) CopyFile(ctx context.Context, source string, target string) error {
+	log.Trace("BlockBlob::CopyFile : %s -> %s", source, target)
+	return bb.copyBlob(ctx, source, target)
+}
+
+// copyBlob : Start a server side copy of the blob along with its metadata and wait for it to complete
+func (bb *BlockBlob) copyBlob(ctx context.Context, source string, target string) error {
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, source))
 	newBlob := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, target))
 
-	prop, err := blobURL.GetProperties(context.Background(), bb.blobAccCond, bb.blobCPKOpt)
+	prop, err := blobURL.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
 	if err != nil {
 		serr := storeBlobErrToErr(err)
 		if serr == ErrFileNotFound {
-			log.Err("BlockBlob::RenameFile : %s does not exist", source)
+			log.Err("BlockBlob::copyBlob : %s does not exist", source)
 			return syscall.ENOENT
 		} else {
-			log.Err("BlockBlob::RenameFile : Failed to get blob properties for %s [%s]", source, err.Error())
+			log.Err("BlockBlob::copyBlob : Failed to get blob properties for %s [%s]", source, err.Error())
 			return err
 		}
 	}
 
-	startCopy, err := newBlob.StartCopyFromURL(context.Background(), blobURL.URL(),
+	startCopy, err := newBlob.StartCopyFromURL(ctx, blobURL.URL(),
 		prop.NewMetadata(), azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, bb.Config.defaultTier, nil)
 
 	if err != nil {
-		log.Err("BlockBlob::RenameFile : Failed to start copy of file %s [%s]", source, err.Error())
+		log.Err("BlockBlob::copyBlob : Failed to start copy of file %s [%s]", source, err.Error())
 		return err
 	}
 
 	copyStatus := startCopy.CopyStatus()
 	for copyStatus == azblob.CopyStatusPending {
 		time.Sleep(time.Second * 1)
-		prop, err = newBlob.GetProperties(context.Background(), bb.blobAccCond, bb.blobCPKOpt)
+		prop, err = newBlob.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
 		if err != nil {
-			log.Err("BlockBlob::RenameFile : CopyStats : Failed to get blob properties for %s [%s]", source, err.Error())
+			log.Err("BlockBlob::copyBlob : CopyStats : Failed to get blob properties for %s [%s]", source, err.Error())
 		}
 		copyStatus = prop.CopyStatus()
 	}
 
-	log.Trace("BlockBlob::RenameFile : %s -> %s done", source, target)
-
-	// Copy of the file is done so now delete the older file
-	err = bb.DeleteFile(source)
-	for retry := 0; retry < 3 && err == syscall.ENOENT; retry++ {
-		// Sometimes backend is able to copy source file to destination but when we try to delete the
-		// source files it returns back with ENOENT. If file was just created on backend it might happen
-		// that it has not been synced yet at all layers and hence delete is not able to find the source file
-		log.Trace("BlockBlob::RenameFile : %s -> %s, unable to find source. Retrying %d", source, target, retry)
-		time.Sleep(1 * time.Second)
-		err = bb.DeleteFile(source)
+	if copyStatus != azblob.CopyStatusSuccess {
+		log.Err("BlockBlob::copyBlob : Copy of %s to %s ended with status %s", source, target, copyStatus)
+		return syscall.EIO
 	}
 
-	if err == syscall.ENOENT {
-		// Even after 3 retries, 1 second apart if server returns 404 then source file no longer
-		// exists on the backend and its safe to assume rename was successful
-		err = nil
+	return nil
+}
+
+// CopyRange : Copy a range of a blob into another one, data does not leave the service.
+// Target is rebuilt out of blocks staged from its own data and from the source, a gap past its end is filled with zeros.
+func (bb *BlockBlob) CopyRange(ctx context.Context, source string, srcOffset int64, target string, dstOffset int64, count int64) error {
+	log.Trace("BlockBlob::CopyRange : %s offset %d -> %s offset %d, count %d", source, srcOffset, target, dstOffset, count)
+
+	if bb.blobCPKOpt.EncryptionKey != nil {
+		// Staging from a url does not pass the key of the source
+		return syscall.ENOTSUP
 	}
 
-	return err
-}
+	srcURL, err := bb.copySourceURL(source)
+	if err != nil {
+		return err
+	}
 
-// RenameDirectory : Rename the directory
-func (bb *BlockBlob) RenameDirectory(source string, target string) error {
-	log.Trace("BlockBlob::RenameDirectory : %s -> %s", source, target)
+	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, target))
+	accCond := bb.accessConditions(target)
+	headers := azblob.BlobHTTPHeaders{ContentType: getContentType(target)}
+	var metadata azblob.Metadata
+	var dstSize int64
+	var dstURL url.URL
 
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		listBlob, err := bb.Container.ListBlobsFlatSegment(context.Background(), marker,
-			azblob.ListBlobsSegmentOptions{MaxResults: common.MaxDirListCount,
-				Prefix: filepath.Join(bb.Config.prefixPath, source) + "/",
-			})
+	prop, err := blobURL.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
+	if err == nil {
+		dstSize = prop.ContentLength()
+		headers = prop.NewHTTPHeaders()
+		metadata = prop.NewMetadata()
 
+		// Blocks taken from the target have to come from the version read here, and nothing may change it till the commit
+		accCond.ModifiedAccessConditions.IfMatch = prop.ETag()
+		dstURL, err = bb.copySourceURL(target)
 		if err != nil {
-			log.Err("BlockBlob::RenameDirectory : Failed to get list of blobs %s", err.Error)
 			return err
 		}
-		marker = listBlob.NextMarker
+	} else if storeBlobErrToErr(err) != ErrFileNotFound {
+		log.Err("BlockBlob::CopyRange : Failed to get blob properties for %s [%s]", target, err.Error())
+		return err
+	}
 
-		// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
-		for _, blobInfo := range listBlob.Segment.BlobItems {
-			srcPath := split(bb.Config.prefixPath, blobInfo.Name)
-			err = bb.RenameFile(srcPath, strings.Replace(srcPath, source, target, 1))
+	// Ranges the target is made of, in order. Ones without a url are zeros.
+	type copySegment struct {
+		from   *url.URL
+		offset int64
+		count  int64
+	}
+	var segments []copySegment
+	if dstOffset > 0 && dstSize > 0 {
+		segments = append(segments, copySegment{from: &dstURL, offset: 0, count: minInt64(dstOffset, dstSize)})
+	}
+	if dstOffset > dstSize {
+		segments = append(segments, copySegment{offset: dstSize, count: dstOffset - dstSize})
+	}
+	segments = append(segments, copySegment{from: &srcURL, offset: srcOffset, count: count})
+	if end := dstOffset + count; dstSize > end {
+		segments = append(segments, copySegment{from: &dstURL, offset: end, count: dstSize - end})
+	}
+
+	var blockIDs []string
+	var zeros []byte
+	for _, seg := range segments {
+		blockSize := int64(copyRangeBlockSize)
+		if seg.from == nil {
+			blockSize = copyRangeZeroBlockSize
+		}
+
+		for offset := int64(0); offset < seg.count; offset += blockSize {
+			length := minInt64(blockSize, seg.count-offset)
+			id := base64.StdEncoding.EncodeToString(common.NewUUIDWithLength(16))
+
+			if seg.from == nil {
+				if zeros == nil {
+					zeros = make([]byte, copyRangeZeroBlockSize)
+				}
+				_, err = blobURL.StageBlock(ctx, id, bytes.NewReader(zeros[:length]), accCond.LeaseAccessConditions, nil, bb.blobCPKOpt)
+			} else {
+				srcCond := azblob.ModifiedAccessConditions{}
+				if seg.from == &dstURL {
+					srcCond.IfMatch = accCond.ModifiedAccessConditions.IfMatch
+				}
+				_, err = blobURL.StageBlockFromURL(ctx, id, *seg.from, seg.offset+offset, length, accCond.LeaseAccessConditions, srcCond, bb.blobCPKOpt)
+			}
 			if err != nil {
-				log.Err("BlockBlob::RenameDirectory : Failed to rename file %s [%s]", srcPath, err.Error)
+				log.Err("BlockBlob::CopyRange : Failed to stage block of %s at %d [%s]", target, seg.offset+offset, err.Error())
+				return err
 			}
+			blockIDs = append(blockIDs, id)
+		}
+	}
+
+	_, err = blobURL.CommitBlockList(ctx, blockIDs, headers, metadata, accCond, bb.Config.defaultTier, nil, bb.blobCPKOpt)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ConditionNotMet {
+			log.Err("BlockBlob::CopyRange : %s was modified by someone else during the copy [%s]", target, err.Error())
+			return syscall.ESTALE
 		}
+		log.Err("BlockBlob::CopyRange : Failed to commit block list of %s [%s]", target, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// copySourceURL : Url the service reads a blob from when staging blocks out of it.
+// Unlike the destination, the source of Put Block From URL is not authorized by the credential of the request,
+// it needs a SAS: the one of the mount, or one signed here with the account key. Other auth modes can not copy ranges.
+func (bb *BlockBlob) copySourceURL(name string) (url.URL, error) {
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	parts := azblob.NewBlobURLParts(blobURL.URL())
+	if parts.SAS.Signature() != "" {
+		return blobURL.URL(), nil
+	}
+
+	if bb.Config.authConfig.AuthMode != EAuthType.KEY() {
+		log.Debug("BlockBlob::copySourceURL : Ranges can not be copied with %s auth", bb.Config.authConfig.AuthMode.String())
+		return url.URL{}, syscall.ENOTSUP
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(bb.Config.authConfig.AccountName, bb.Config.authConfig.AccountKey)
+	if err != nil {
+		log.Err("BlockBlob::copySourceURL : Failed to create shared key credential [%s]", err.Error())
+		return url.URL{}, err
+	}
+
+	parts.SAS, err = azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPSandHTTP,
+		ExpiryTime:    time.Now().UTC().Add(copySourceSASExpiry),
+		ContainerName: parts.ContainerName,
+		BlobName:      parts.BlobName,
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(cred)
+	if err != nil {
+		log.Err("BlockBlob::copySourceURL : Failed to sign url of %s [%s]", name, err.Error())
+		return url.URL{}, err
 	}
 
-	return bb.RenameFile(source, target)
+	return parts.URL(), nil
 }
 
-func (bb *BlockBlob) getAttrUsingRest(name string) (attr *internal.ObjAttr, err error) {
+// RenameDirectory : Rename the directory by moving its blobs in parallel
+func (bb *BlockBlob) RenameDirectory(ctx context.Context, source string, target string) error {
+	log.Trace("BlockBlob::RenameDirectory : %s -> %s", source, target)
+
+	err := newDirRenamer(bb, bb.Config).rename(ctx, source, target)
+	if err != nil {
+		log.Err("BlockBlob::RenameDirectory : Failed to rename %s to %s [%s]", source, target, err.Error())
+	}
+	return err
+}
+
+// RecoverRenames : Resume or roll back directory renames which did not complete before the last unmount
+func (bb *BlockBlob) RecoverRenames(ctx context.Context) error {
+	log.Trace("BlockBlob::RecoverRenames : recovery %s", bb.Config.renameRecovery)
+	return newDirRenamer(bb, bb.Config).recover(ctx)
+}
+
+// listTree : List names of all blobs under the directory
+func (bb *BlockBlob) listTree(ctx context.Context, dir string, marker *string) ([]string, *string, error) {
+	listBlob, err := bb.Container.ListBlobsFlatSegment(ctx, azblob.Marker{Val: marker},
+		azblob.ListBlobsSegmentOptions{MaxResults: common.MaxDirListCount,
+			Prefix: filepath.Join(bb.Config.prefixPath, dir) + "/",
+		})
+
+	if err != nil {
+		log.Err("BlockBlob::listTree : Failed to get list of blobs under %s [%s]", dir, err.Error())
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(listBlob.Segment.BlobItems))
+	for _, blobInfo := range listBlob.Segment.BlobItems {
+		names = append(names, split(bb.Config.prefixPath, blobInfo.Name))
+	}
+
+	return names, listBlob.NextMarker.Val, nil
+}
+
+func (bb *BlockBlob) getAttrUsingRest(ctx context.Context, name string) (attr *internal.ObjAttr, err error) {
 	log.Trace("BlockBlob::getAttrUsingRest : name %s", name)
 
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
-	prop, err := blobURL.GetProperties(context.Background(), bb.blobAccCond, bb.blobCPKOpt)
+	prop, err := blobURL.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
 
 	if err != nil {
 		e := storeBlobErrToErr(err)
@@ -455,6 +647,7 @@ func (bb *BlockBlob) getAttrUsingRest(name string) (attr *internal.ObjAttr, err
 		Crtime: prop.CreationTime(),
 		Flags:  internal.NewFileBitMap(),
 		MD5:    prop.ContentMD5(),
+		ETag:   string(prop.ETag()),
 	}
 
 	parseMetadata(attr, prop.NewMetadata())
@@ -465,7 +658,7 @@ func (bb *BlockBlob) getAttrUsingRest(name string) (attr *internal.ObjAttr, err
 	return attr, nil
 }
 
-func (bb *BlockBlob) getAttrUsingList(name string) (attr *internal.ObjAttr, err error) {
+func (bb *BlockBlob) getAttrUsingList(ctx context.Context, name string) (attr *internal.ObjAttr, err error) {
 	log.Trace("BlockBlob::getAttrUsingList : name %s", name)
 
 	const maxFailCount = 20
@@ -476,7 +669,7 @@ func (bb *BlockBlob) getAttrUsingList(name string) (attr *internal.ObjAttr, err
 	blobsRead := 0
 
 	for failCount < maxFailCount {
-		blobs, new_marker, err := bb.List(name, marker, common.MaxDirListCount)
+		blobs, new_marker, err := bb.List(ctx, name, marker, common.MaxDirListCount)
 		if err != nil {
 			e := storeBlobErrToErr(err)
 			if e == ErrFileNotFound {
@@ -518,21 +711,21 @@ func (bb *BlockBlob) getAttrUsingList(name string) (attr *internal.ObjAttr, err
 }
 
 // GetAttr : Retrieve attributes of the blob
-func (bb *BlockBlob) GetAttr(name string) (attr *internal.ObjAttr, err error) {
+func (bb *BlockBlob) GetAttr(ctx context.Context, name string) (attr *internal.ObjAttr, err error) {
 	log.Trace("BlockBlob::GetAttr : name %s", name)
 
 	// To support virtual directories with no marker blob, we call list instead of get properties since list will not return a 404
 	if bb.Config.virtualDirectory {
-		return bb.getAttrUsingList(name)
+		return bb.getAttrUsingList(ctx, name)
 	}
 
-	return bb.getAttrUsingRest(name)
+	return bb.getAttrUsingRest(ctx, name)
 }
 
 // List : Get a list of blobs matching the given prefix
 // This fetches the list using a marker so the caller code should handle marker logic
 // If count=0 - fetch max entries
-func (bb *BlockBlob) List(prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+func (bb *BlockBlob) List(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
 	log.Trace("BlockBlob::List : prefix %s, marker %s", prefix, func(marker *string) string {
 		if marker != nil {
 			return *marker
@@ -553,7 +746,7 @@ func (bb *BlockBlob) List(prefix string, marker *string, count int32) ([]*intern
 	}
 
 	// Get a result segment starting with the blob indicated by the current Marker.
-	listBlob, err := bb.Container.ListBlobsHierarchySegment(context.Background(), azblob.Marker{Val: marker}, "/",
+	listBlob, err := bb.Container.ListBlobsHierarchySegment(ctx, azblob.Marker{Val: marker}, "/",
 		azblob.ListBlobsSegmentOptions{MaxResults: count,
 			Prefix:  listPath,
 			Details: bb.listDetails,
@@ -594,6 +787,7 @@ func (bb *BlockBlob) List(prefix string, marker *string, count int32) ([]*intern
 			Crtime: dereferenceTime(blobInfo.Properties.CreationTime, blobInfo.Properties.LastModified),
 			Flags:  internal.NewFileBitMap(),
 			MD5:    blobInfo.Properties.ContentMD5,
+			ETag:   string(blobInfo.Properties.Etag),
 		}
 
 		parseMetadata(attr, blobInfo.Metadata)
@@ -619,7 +813,7 @@ func (bb *BlockBlob) List(prefix string, marker *string, count int32) ([]*intern
 			continue
 		} else {
 			// marker file not found in current iteration, so we need to manually check attributes via REST
-			_, err := bb.getAttrUsingRest(blobInfo.Name)
+			_, err := bb.getAttrUsingRest(ctx, blobInfo.Name)
 			// marker file also not found via manual check, safe to add to list
 			if err == syscall.ENOENT {
 				// For these dirs we get only the name and no other properties so hardcoding time to current time
@@ -650,6 +844,211 @@ func (bb *BlockBlob) List(prefix string, marker *string, count int32) ([]*intern
 	return blobList, listBlob.NextMarker.Val, nil
 }
 
+// ListVersions : List all versions and snapshots of a blob including its current version.
+// Attributes carry the path of the blob and are named after the version id, or the snapshot time prefixed with snapshotPrefix.
+func (bb *BlockBlob) ListVersions(ctx context.Context, name string) ([]*internal.ObjAttr, error) {
+	log.Trace("BlockBlob::ListVersions : name %s", name)
+
+	blobName := filepath.Join(bb.Config.prefixPath, name)
+	versions := make([]*internal.ObjAttr, 0)
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		listBlob, err := bb.Container.ListBlobsFlatSegment(ctx, marker,
+			azblob.ListBlobsSegmentOptions{
+				MaxResults: common.MaxDirListCount,
+				Prefix:     blobName,
+				Details:    azblob.BlobListingDetails{Metadata: true, Versions: true, Snapshots: true},
+			})
+		if err != nil {
+			log.Err("BlockBlob::ListVersions : Failed to list versions of %s [%s]", name, err.Error())
+			return versions, err
+		}
+		marker = listBlob.NextMarker
+
+		for _, blobInfo := range listBlob.Segment.BlobItems {
+			// Listing can only filter on a prefix, but it is sorted by name so the exact name comes before
+			// every longer one and the rest of the listing is not needed
+			if blobInfo.Name != blobName {
+				return versions, nil
+			}
+
+			var id string
+			if blobInfo.Snapshot != "" {
+				id = snapshotPrefix + blobInfo.Snapshot
+			} else if blobInfo.VersionID != nil {
+				id = *blobInfo.VersionID
+			} else {
+				// Base blob in an account without versioning
+				continue
+			}
+
+			attr := &internal.ObjAttr{
+				Path:   name,
+				Name:   id,
+				Size:   *blobInfo.Properties.ContentLength,
+				Mtime:  blobInfo.Properties.LastModified,
+				Atime:  blobInfo.Properties.LastModified,
+				Ctime:  blobInfo.Properties.LastModified,
+				Crtime: blobInfo.Properties.LastModified,
+				Flags:  internal.NewFileBitMap(),
+				MD5:    blobInfo.Properties.ContentMD5,
+				ETag:   string(blobInfo.Properties.Etag),
+			}
+			if blobInfo.Properties.CreationTime != nil {
+				attr.Crtime = *blobInfo.Properties.CreationTime
+			}
+
+			parseMetadata(attr, blobInfo.Metadata)
+			attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+			versions = append(versions, attr)
+		}
+	}
+
+	return versions, nil
+}
+
+// GetVersionAttr : Get the attributes of one version, or of a snapshot named with snapshotPrefix, of a blob
+func (bb *BlockBlob) GetVersionAttr(ctx context.Context, name string, version string) (*internal.ObjAttr, error) {
+	log.Trace("BlockBlob::GetVersionAttr : name %s, version %s", name, version)
+
+	prop, err := bb.versionURL(name, version).GetProperties(ctx, azblob.BlobAccessConditions{}, bb.blobCPKOpt)
+	if err != nil {
+		e := storeBlobErrToErr(err)
+		if e == ErrFileNotFound {
+			return nil, syscall.ENOENT
+		}
+		log.Err("BlockBlob::GetVersionAttr : Failed to get properties of version %s of %s [%s]", version, name, err.Error())
+		return nil, err
+	}
+
+	attr := &internal.ObjAttr{
+		Path:   name,
+		Name:   version,
+		Size:   prop.ContentLength(),
+		Mtime:  prop.LastModified(),
+		Atime:  prop.LastModified(),
+		Ctime:  prop.LastModified(),
+		Crtime: prop.CreationTime(),
+		Flags:  internal.NewFileBitMap(),
+		MD5:    prop.ContentMD5(),
+		ETag:   string(prop.ETag()),
+	}
+
+	parseMetadata(attr, prop.NewMetadata())
+	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+	return attr, nil
+}
+
+// versionURL : Url of a version of a blob, or of a snapshot when the version is named with snapshotPrefix
+func (bb *BlockBlob) versionURL(name string, version string) azblob.BlobURL {
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	if strings.HasPrefix(version, snapshotPrefix) {
+		return blobURL.WithSnapshot(strings.TrimPrefix(version, snapshotPrefix))
+	}
+	return blobURL.WithVersionID(version)
+}
+
+// ListDeleted : List soft deleted blobs at one level of the hierarchy.
+// Every prefix is returned as a directory, the service does not tell apart prefixes which hold only live blobs.
+func (bb *BlockBlob) ListDeleted(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+	log.Trace("BlockBlob::ListDeleted : prefix %s", prefix)
+
+	blobList := make([]*internal.ObjAttr, 0)
+
+	if count == 0 {
+		count = common.MaxDirListCount
+	}
+
+	listPath := filepath.Join(bb.Config.prefixPath, prefix)
+	if (prefix != "" && prefix[len(prefix)-1] == '/') || (prefix == "" && bb.Config.prefixPath != "") {
+		listPath += "/"
+	}
+
+	listBlob, err := bb.Container.ListBlobsHierarchySegment(ctx, azblob.Marker{Val: marker}, "/",
+		azblob.ListBlobsSegmentOptions{MaxResults: count,
+			Prefix:  listPath,
+			Details: azblob.BlobListingDetails{Metadata: true, Deleted: true},
+		})
+	if err != nil {
+		log.Err("BlockBlob::ListDeleted : Failed to list deleted blobs with the prefix %s [%s]", prefix, err.Error())
+		return blobList, nil, err
+	}
+
+	dirList := make(map[string]bool)
+	for _, blobInfo := range listBlob.Segment.BlobItems {
+		if !blobInfo.Deleted {
+			continue
+		}
+
+		mtime := blobInfo.Properties.LastModified
+		if blobInfo.Properties.DeletedTime != nil {
+			mtime = *blobInfo.Properties.DeletedTime
+		}
+
+		attr := &internal.ObjAttr{
+			Path:   split(bb.Config.prefixPath, blobInfo.Name),
+			Name:   filepath.Base(blobInfo.Name),
+			Size:   *blobInfo.Properties.ContentLength,
+			Mtime:  mtime,
+			Atime:  mtime,
+			Ctime:  mtime,
+			Crtime: blobInfo.Properties.LastModified,
+			Flags:  internal.NewFileBitMap(),
+			MD5:    blobInfo.Properties.ContentMD5,
+		}
+
+		parseMetadata(attr, blobInfo.Metadata)
+		attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+		if attr.IsDir() {
+			dirList[blobInfo.Name+"/"] = true
+			attr.Size = 4096
+		}
+		blobList = append(blobList, attr)
+	}
+
+	for _, blobInfo := range listBlob.Segment.BlobPrefixes {
+		if dirList[blobInfo.Name] {
+			// Deleted marker blob of this directory is already in the list
+			continue
+		}
+
+		name := strings.TrimSuffix(blobInfo.Name, "/")
+		attr := &internal.ObjAttr{
+			Path:  split(bb.Config.prefixPath, name),
+			Name:  filepath.Base(name),
+			Size:  4096,
+			Mode:  os.ModeDir,
+			Mtime: time.Now(),
+			Flags: internal.NewDirBitMap(),
+		}
+		attr.Atime = attr.Mtime
+		attr.Crtime = attr.Mtime
+		attr.Ctime = attr.Mtime
+		attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+		blobList = append(blobList, attr)
+	}
+
+	return blobList, listBlob.NextMarker.Val, nil
+}
+
+// Undelete : Restore a soft deleted blob along with its soft deleted snapshots
+func (bb *BlockBlob) Undelete(ctx context.Context, name string) error {
+	log.Trace("BlockBlob::Undelete : name %s", name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.Undelete(ctx)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		}
+		log.Err("BlockBlob::Undelete : Failed to undelete %s [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
 // track the progress of download of blobs where every 100MB of data downloaded is being tracked. It also tracks the completion of download
 func trackDownload(name string, bytesTransferred int64, count int64, downloadPtr *int64) {
 	if bytesTransferred >= (*downloadPtr)*100*common.MbToBytes || bytesTransferred == count {
@@ -662,7 +1061,7 @@ func trackDownload(name string, bytesTransferred int64, count int64, downloadPtr
 }
 
 // ReadToFile : Download a blob to a local file
-func (bb *BlockBlob) ReadToFile(name string, offset int64, count int64, fi *os.File) (err error) {
+func (bb *BlockBlob) ReadToFile(ctx context.Context, name string, offset int64, count int64, fi *os.File) (err error) {
 	log.Trace("BlockBlob::ReadToFile : name %s, offset : %d, count %d", name, offset, count)
 	//defer exectime.StatTimeCurrentBlock("BlockBlob::ReadToFile")()
 
@@ -678,7 +1077,7 @@ func (bb *BlockBlob) ReadToFile(name string, offset int64, count int64, fi *os.F
 	}
 
 	defer log.TimeTrack(time.Now(), "BlockBlob::ReadToFile", name)
-	err = azblob.DownloadBlobToFile(context.Background(), blobURL, offset, count, fi, bb.downloadOptions)
+	err = azblob.DownloadBlobToFile(ctx, blobURL, offset, count, fi, bb.downloadOptions)
 
 	if err != nil {
 		e := storeBlobErrToErr(err)
@@ -702,7 +1101,7 @@ func (bb *BlockBlob) ReadToFile(name string, offset int64, count int64, fi *os.F
 			log.Warn("BlockBlob::ReadToFile : Failed to generate MD5 Sum for %s", name)
 		} else {
 			// Get latest properties from container to get the md5 of blob
-			prop, err := blobURL.GetProperties(context.Background(), bb.blobAccCond, bb.blobCPKOpt)
+			prop, err := blobURL.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
 			if err != nil {
 				log.Warn("BlockBlob::ReadToFile : Failed to get properties of blob %s [%s]", name, err.Error())
 			} else {
@@ -724,12 +1123,12 @@ func (bb *BlockBlob) ReadToFile(name string, offset int64, count int64, fi *os.F
 }
 
 // ReadBuffer : Download a specific range from a blob to a buffer
-func (bb *BlockBlob) ReadBuffer(name string, offset int64, len int64) ([]byte, error) {
+func (bb *BlockBlob) ReadBuffer(ctx context.Context, name string, offset int64, len int64) ([]byte, error) {
 	log.Trace("BlockBlob::ReadBuffer : name %s", name)
 	var buff []byte
 	if len == 0 {
 		len = azblob.CountToEnd
-		attr, err := bb.GetAttr(name)
+		attr, err := bb.GetAttr(ctx, name)
 		if err != nil {
 			return buff, err
 		}
@@ -739,7 +1138,7 @@ func (bb *BlockBlob) ReadBuffer(name string, offset int64, len int64) ([]byte, e
 	}
 
 	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
-	err := azblob.DownloadBlobToBuffer(context.Background(), blobURL, offset, len, buff, bb.downloadOptions)
+	err := azblob.DownloadBlobToBuffer(ctx, blobURL, offset, len, buff, bb.downloadOptions)
 
 	if err != nil {
 		e := storeBlobErrToErr(err)
@@ -757,10 +1156,19 @@ func (bb *BlockBlob) ReadBuffer(name string, offset int64, len int64) ([]byte, e
 }
 
 // ReadInBuffer : Download specific range from a file to a user provided buffer
-func (bb *BlockBlob) ReadInBuffer(name string, offset int64, len int64, data []byte) error {
+func (bb *BlockBlob) ReadInBuffer(ctx context.Context, name string, offset int64, len int64, data []byte) error {
 	// log.Trace("BlockBlob::ReadInBuffer : name %s", name)
 	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
-	err := azblob.DownloadBlobToBuffer(context.Background(), blobURL, offset, len, data, bb.downloadOptions)
+	return bb.readInBuffer(ctx, blobURL, name, offset, len, data)
+}
+
+// ReadVersionInBuffer : Download specific range from a version or snapshot of a blob to a user provided buffer
+func (bb *BlockBlob) ReadVersionInBuffer(ctx context.Context, name string, version string, offset int64, len int64, data []byte) error {
+	return bb.readInBuffer(ctx, bb.versionURL(name, version), name, offset, len, data)
+}
+
+func (bb *BlockBlob) readInBuffer(ctx context.Context, blobURL azblob.BlobURL, name string, offset int64, len int64, data []byte) error {
+	err := azblob.DownloadBlobToBuffer(ctx, blobURL, offset, len, data, bb.downloadOptions)
 
 	if err != nil {
 		e := storeBlobErrToErr(err)
@@ -828,10 +1236,49 @@ func trackUpload(name string, bytesTransferred int64, count int64, uploadPtr *in
 }
 
 // WriteFromFile : Upload local file to blob
-func (bb *BlockBlob) WriteFromFile(name string, metadata map[string]string, fi *os.File) (err error) {
+func (bb *BlockBlob) WriteFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File) (string, error) {
 	log.Trace("BlockBlob::WriteFromFile : name %s", name)
+	return bb.writeFromFile(ctx, name, metadata, fi, bb.accessConditions(name))
+}
+
+// WriteFromFileIfMatch : Upload local file to blob only if the blob in container still has the given etag.
+// Returns ESTALE if the blob was modified or deleted by someone else since the etag was read.
+func (bb *BlockBlob) WriteFromFileIfMatch(ctx context.Context, name string, metadata map[string]string, fi *os.File, etag string) (string, error) {
+	log.Trace("BlockBlob::WriteFromFileIfMatch : name %s, etag %s", name, etag)
+
+	accCond := bb.accessConditions(name)
+	accCond.ModifiedAccessConditions.IfMatch = azblob.ETag(etag)
+	return bb.writeFromFile(ctx, name, metadata, fi, accCond)
+}
+
+// writeFromFile : Upload local file to blob with the given access conditions
+func (bb *BlockBlob) writeFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File, accCond azblob.BlobAccessConditions) (string, error) {
 	//defer exectime.StatTimeCurrentBlock("WriteFromFile::WriteFromFile")()
 
+	// get the size of the file
+	stat, err := fi.Stat()
+	if err != nil {
+		log.Err("BlockBlob::WriteFromFile : Failed to get file size %s [%s]", name, err.Error())
+		return "", err
+	}
+
+	return bb.writeFromReader(ctx, name, metadata, fi, stat.Size(), accCond)
+}
+
+// WriteFromReader : Upload size bytes of data read from r to blob, only if the blob still has the given etag unless it is empty.
+// Data is read one block at a time, for data which is not held in a local file as it is.
+func (bb *BlockBlob) WriteFromReader(ctx context.Context, name string, metadata map[string]string, r io.ReaderAt, size int64, etag string) (string, error) {
+	log.Trace("BlockBlob::WriteFromReader : name %s, size %d, etag %s", name, size, etag)
+
+	accCond := bb.accessConditions(name)
+	if etag != "" {
+		accCond.ModifiedAccessConditions.IfMatch = azblob.ETag(etag)
+	}
+	return bb.writeFromReader(ctx, name, metadata, r, size, accCond)
+}
+
+// writeFromReader : Upload local data to blob with the given access conditions, returns the etag of the new blob
+func (bb *BlockBlob) writeFromReader(ctx context.Context, name string, metadata map[string]string, r io.ReaderAt, size int64, accCond azblob.BlobAccessConditions) (etag string, err error) {
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
 	defer log.TimeTrack(time.Now(), "BlockBlob::WriteFromFile", name)
 
@@ -839,19 +1286,13 @@ func (bb *BlockBlob) WriteFromFile(name string, metadata map[string]string, fi *
 	*uploadPtr = 1
 
 	blockSize := bb.Config.blockSize
-	// get the size of the file
-	stat, err := fi.Stat()
-	if err != nil {
-		log.Err("BlockBlob::WriteFromFile : Failed to get file size %s [%s]", name, err.Error())
-		return err
-	}
 
 	// if the block size is not set then we configure it based on file size
 	if blockSize == 0 {
 		// based on file-size calculate block size
-		blockSize, err = bb.calculateBlockSize(name, stat.Size())
+		blockSize, err = bb.calculateBlockSize(name, size)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
@@ -859,8 +1300,8 @@ func (bb *BlockBlob) WriteFromFile(name string, metadata map[string]string, fi *
 	// If file is uploaded in one shot (no blocks created) then server is populating md5 on upload automatically.
 	// hence we take cost of calculating md5 only for files which are bigger in size and which will be converted to blocks.
 	md5sum := []byte{}
-	if bb.Config.updateMD5 && stat.Size() >= azblob.BlockBlobMaxUploadBlobBytes {
-		md5sum, err = getMD5(fi)
+	if bb.Config.updateMD5 && size >= azblob.BlockBlobMaxUploadBlobBytes {
+		md5sum, err = getMD5(io.NewSectionReader(r, 0, size))
 		if err != nil {
 			// Md5 sum generation failed so set nil while uploading
 			log.Warn("BlockBlob::WriteFromFile : Failed to generate md5 of %s", name)
@@ -877,43 +1318,60 @@ func (bb *BlockBlob) WriteFromFile(name string, metadata map[string]string, fi *
 			ContentType: getContentType(name),
 			ContentMD5:  md5sum,
 		},
+		AccessConditions: accCond,
 	}
-	if common.MonitorBfs() && stat.Size() > 0 {
+	if common.MonitorBfs() && size > 0 {
 		uploadOptions.Progress = func(bytesTransferred int64) {
-			trackUpload(name, bytesTransferred, stat.Size(), uploadPtr)
+			trackUpload(name, bytesTransferred, size, uploadPtr)
 		}
 	}
 
-	_, err = azblob.UploadFileToBlockBlob(context.Background(), fi, blobURL, uploadOptions)
+	var resp azblob.CommonResponse
+	if fi, ok := r.(*os.File); ok {
+		resp, err = azblob.UploadFileToBlockBlob(ctx, fi, blobURL, uploadOptions)
+	} else {
+		// Only a few blocks of the data are held in memory at a time
+		resp, err = azblob.UploadStreamToBlockBlob(ctx, io.NewSectionReader(r, 0, size), blobURL, azblob.UploadStreamToBlockBlobOptions{
+			BufferSize:       int(blockSize),
+			MaxBuffers:       int(bb.Config.maxConcurrency),
+			BlobHTTPHeaders:  uploadOptions.BlobHTTPHeaders,
+			Metadata:         uploadOptions.Metadata,
+			AccessConditions: uploadOptions.AccessConditions,
+			BlobAccessTier:   uploadOptions.BlobAccessTier,
+		})
+	}
 
 	if err != nil {
 		serr := storeBlobErrToErr(err)
 		if serr == BlobIsUnderLease {
 			log.Err("BlockBlob::WriteFromFile : %s is under a lease, can not update file [%s]", name, err.Error())
-			return syscall.EIO
+			return "", syscall.EIO
+		} else if serr == ConditionNotMet {
+			log.Err("BlockBlob::WriteFromFile : %s was modified by someone else, can not update file [%s]", name, err.Error())
+			return "", syscall.ESTALE
 		} else {
 			log.Err("BlockBlob::WriteFromFile : Failed to upload blob %s [%s]", name, err.Error())
 		}
-		return err
+		return "", err
 	} else {
 		log.Debug("BlockBlob::WriteFromFile : Upload complete of blob %v", name)
 
 		// store total bytes uploaded so far
-		if stat.Size() > 0 {
-			azStatsCollector.UpdateStats(stats_manager.Increment, bytesUploaded, stat.Size())
+		if size > 0 {
+			azStatsCollector.UpdateStats(stats_manager.Increment, bytesUploaded, size)
 		}
 	}
 
-	return nil
+	return string(resp.ETag()), nil
 }
 
 // WriteFromBuffer : Upload from a buffer to a blob
-func (bb *BlockBlob) WriteFromBuffer(name string, metadata map[string]string, data []byte) error {
+func (bb *BlockBlob) WriteFromBuffer(ctx context.Context, name string, metadata map[string]string, data []byte) error {
 	log.Trace("BlockBlob::WriteFromBuffer : name %s", name)
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
 
 	defer log.TimeTrack(time.Now(), "BlockBlob::WriteFromBuffer", name)
-	_, err := azblob.UploadBufferToBlockBlob(context.Background(), data, blobURL, azblob.UploadToBlockBlobOptions{
+	_, err := azblob.UploadBufferToBlockBlob(ctx, data, blobURL, azblob.UploadToBlockBlobOptions{
 		BlockSize:      bb.Config.blockSize,
 		Parallelism:    bb.Config.maxConcurrency,
 		Metadata:       metadata,
@@ -921,6 +1379,7 @@ func (bb *BlockBlob) WriteFromBuffer(name string, metadata map[string]string, da
 		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
 			ContentType: getContentType(name),
 		},
+		AccessConditions: bb.accessConditions(name),
 	})
 
 	if err != nil {
@@ -932,12 +1391,12 @@ func (bb *BlockBlob) WriteFromBuffer(name string, metadata map[string]string, da
 }
 
 // GetFileBlockOffsets: store blocks ids and corresponding offsets
-func (bb *BlockBlob) GetFileBlockOffsets(name string) (*common.BlockOffsetList, error) {
+func (bb *BlockBlob) GetFileBlockOffsets(ctx context.Context, name string) (*common.BlockOffsetList, error) {
 	var blockOffset int64 = 0
 	blockList := common.BlockOffsetList{}
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
 	storageBlockList, err := blobURL.GetBlockList(
-		context.Background(), azblob.BlockListCommitted, bb.blobAccCond.LeaseAccessConditions)
+		ctx, azblob.BlockListCommitted, bb.blobAccCond.LeaseAccessConditions)
 	if err != nil {
 		log.Err("BlockBlob::GetFileBlockOffsets : Failed to get block list %s ", name, err.Error())
 		return &common.BlockOffsetList{}, err
@@ -993,7 +1452,7 @@ func (bb *BlockBlob) createNewBlocks(blockList *common.BlockOffsetList, offset,
 	return bufferSize
 }
 
-func (bb *BlockBlob) removeBlocks(blockList *common.BlockOffsetList, size int64, name string) *common.BlockOffsetList {
+func (bb *BlockBlob) removeBlocks(ctx context.Context, blockList *common.BlockOffsetList, size int64, name string) *common.BlockOffsetList {
 	_, index := blockList.BinarySearch(size)
 	// if the start index is equal to new size - block should be removed - move one index back
 	if blockList.BlockList[index].StartIndex == size {
@@ -1006,7 +1465,7 @@ func (bb *BlockBlob) removeBlocks(blockList *common.BlockOffsetList, size int64,
 		blk.Data = make([]byte, blk.EndIndex-blk.StartIndex)
 		blk.Flags.Set(common.DirtyBlock)
 
-		err := bb.ReadInBuffer(name, blk.StartIndex, blk.EndIndex-blk.StartIndex, blk.Data)
+		err := bb.ReadInBuffer(ctx, name, blk.StartIndex, blk.EndIndex-blk.StartIndex, blk.Data)
 		if err != nil {
 			log.Err("BlockBlob::removeBlocks : Failed to remove blocks %s [%s]", name, err.Error())
 		}
@@ -1017,9 +1476,9 @@ func (bb *BlockBlob) removeBlocks(blockList *common.BlockOffsetList, size int64,
 	return blockList
 }
 
-func (bb *BlockBlob) TruncateFile(name string, size int64) error {
+func (bb *BlockBlob) TruncateFile(ctx context.Context, name string, size int64) error {
 	// log.Trace("BlockBlob::TruncateFile : name=%s, size=%d", name, size)
-	attr, err := bb.GetAttr(name)
+	attr, err := bb.GetAttr(ctx, name)
 	if err != nil {
 		log.Err("BlockBlob::TruncateFile : Failed to get attributes of file %s [%s]", name, err.Error())
 		if err == syscall.ENOENT {
@@ -1028,13 +1487,13 @@ func (bb *BlockBlob) TruncateFile(name string, size int64) error {
 	}
 	//TODO: the resize might be very big - need to allocate in chunks
 	if size == 0 || attr.Size == 0 {
-		err := bb.WriteFromBuffer(name, nil, make([]byte, size))
+		err := bb.WriteFromBuffer(ctx, name, nil, make([]byte, size))
 		if err != nil {
 			log.Err("BlockBlob::TruncateFile : Failed to set the %s to 0 bytes [%s]", name, err.Error())
 		}
 		return err
 	}
-	bol, err := bb.GetFileBlockOffsets(name)
+	bol, err := bb.GetFileBlockOffsets(ctx, name)
 	if err != nil {
 		log.Err("BlockBlob::TruncateFile : Failed to get block list of file %s [%s]", name, err.Error())
 		return err
@@ -1044,16 +1503,16 @@ func (bb *BlockBlob) TruncateFile(name string, size int64) error {
 		if size > attr.Size {
 			bb.createNewBlocks(bol, bol.BlockList[len(bol.BlockList)-1].EndIndex, size-attr.Size)
 		} else if size < attr.Size {
-			bol = bb.removeBlocks(bol, size, name)
+			bol = bb.removeBlocks(ctx, bol, size, name)
 		}
-		err = bb.StageAndCommit(name, bol)
+		err = bb.StageAndCommit(ctx, name, bol)
 		if err != nil {
 			log.Err("BlockBlob::TruncateFile : Failed to truncate file %s", name, err.Error())
 			return err
 		}
 	} else {
 		// if its a small file (no blocks)
-		data, err := bb.ReadBuffer(name, 0, 0)
+		data, err := bb.ReadBuffer(ctx, name, 0, 0)
 		if err != nil {
 			log.Err("BlockBlob::TruncateFile : Failed to read small file %s", name, err.Error())
 			return err
@@ -1075,9 +1534,9 @@ func (bb *BlockBlob) TruncateFile(name string, size int64) error {
 		} else if size < attr.Size {
 			// if shrinking just adjust the size
 			data = data[0:size]
-			return bb.WriteFromBuffer(name, nil, data)
+			return bb.WriteFromBuffer(ctx, name, nil, data)
 		}
-		err = bb.StageAndCommit(name, bol)
+		err = bb.StageAndCommit(ctx, name, bol)
 		if err != nil {
 			log.Err("BlockBlob::TruncateFile : Failed to truncate file %s", name, err.Error())
 			return err
@@ -1088,6 +1547,7 @@ func (bb *BlockBlob) TruncateFile(name string, size int64) error {
 
 // Write : write data at given offset to a blob
 func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
+	ctx := requestContext(options.Ctx)
 	name := options.Handle.Path
 	offset := options.Offset
 	defer log.TimeTrack(time.Now(), "BlockBlob::Write", options.Handle.Path)
@@ -1095,7 +1555,7 @@ func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
 	// tracks the case where our offset is great than our current file size (appending only - not modifying pre-existing data)
 	var dataBuffer *[]byte
 	// when the file offset mapping is cached we don't need to make a get block list call
-	fileOffsets, err := bb.GetFileBlockOffsets(name)
+	fileOffsets, err := bb.GetFileBlockOffsets(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -1104,7 +1564,7 @@ func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
 	// case 1: file consists of no blocks (small file)
 	if fileOffsets.SmallFile() {
 		// get all the data
-		oldData, _ := bb.ReadBuffer(name, 0, 0)
+		oldData, _ := bb.ReadBuffer(ctx, name, 0, 0)
 		// update the data with the new data
 		// if we're only overwriting existing data
 		if int64(len(oldData)) >= offset+length {
@@ -1130,7 +1590,7 @@ func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
 			}
 		}
 		// WriteFromBuffer should be able to handle the case where now the block is too big and gets split into multiple blocks
-		err := bb.WriteFromBuffer(name, options.Metadata, *dataBuffer)
+		err := bb.WriteFromBuffer(ctx, name, options.Metadata, *dataBuffer)
 		if err != nil {
 			log.Err("BlockBlob::Write : Failed to upload to blob %s ", name, err.Error())
 			return err
@@ -1149,7 +1609,7 @@ func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
 		oldDataBuffer := make([]byte, oldDataSize+newBufferSize)
 		if !appendOnly {
 			// fetch the blocks that will be impacted by the new changes so we can overwrite them
-			err = bb.ReadInBuffer(name, fileOffsets.BlockList[index].StartIndex, oldDataSize, oldDataBuffer)
+			err = bb.ReadInBuffer(ctx, name, fileOffsets.BlockList[index].StartIndex, oldDataSize, oldDataBuffer)
 			if err != nil {
 				log.Err("BlockBlob::Write : Failed to read data in buffer %s [%s]", name, err.Error())
 			}
@@ -1157,24 +1617,24 @@ func (bb *BlockBlob) Write(options internal.WriteFileOptions) error {
 		// this gives us where the offset with respect to the buffer that holds our old data - so we can start writing the new data
 		blockOffset := offset - fileOffsets.BlockList[index].StartIndex
 		copy(oldDataBuffer[blockOffset:], data)
-		err := bb.stageAndCommitModifiedBlocks(name, oldDataBuffer, fileOffsets)
+		err := bb.stageAndCommitModifiedBlocks(ctx, name, oldDataBuffer, fileOffsets)
 		return err
 	}
 	return nil
 }
 
 // TODO: make a similar method facing stream that would enable us to write to cached blocks then stage and commit
-func (bb *BlockBlob) stageAndCommitModifiedBlocks(name string, data []byte, offsetList *common.BlockOffsetList) error {
+func (bb *BlockBlob) stageAndCommitModifiedBlocks(ctx context.Context, name string, data []byte, offsetList *common.BlockOffsetList) error {
 	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
 	blockOffset := int64(0)
 	var blockIDList []string
 	for _, blk := range offsetList.BlockList {
 		blockIDList = append(blockIDList, blk.Id)
 		if blk.Dirty() {
-			_, err := blobURL.StageBlock(context.Background(),
+			_, err := blobURL.StageBlock(ctx,
 				blk.Id,
 				bytes.NewReader(data[blockOffset:(blk.EndIndex-blk.StartIndex)+blockOffset]),
-				bb.blobAccCond.LeaseAccessConditions,
+				bb.accessConditions(name).LeaseAccessConditions,
 				nil,
 				bb.downloadOptions.ClientProvidedKeyOptions)
 			if err != nil {
@@ -1184,11 +1644,11 @@ func (bb *BlockBlob) stageAndCommitModifiedBlocks(name string, data []byte, offs
 			blockOffset = (blk.EndIndex - blk.StartIndex) + blockOffset
 		}
 	}
-	_, err := blobURL.CommitBlockList(context.Background(),
+	_, err := blobURL.CommitBlockList(ctx,
 		blockIDList,
 		azblob.BlobHTTPHeaders{ContentType: getContentType(name)},
 		nil,
-		bb.blobAccCond,
+		bb.accessConditions(name),
 		bb.Config.defaultTier,
 		nil, // datalake doesn't support tags here
 		bb.downloadOptions.ClientProvidedKeyOptions)
@@ -1199,7 +1659,7 @@ func (bb *BlockBlob) stageAndCommitModifiedBlocks(name string, data []byte, offs
 	return nil
 }
 
-func (bb *BlockBlob) StageAndCommit(name string, bol *common.BlockOffsetList) error {
+func (bb *BlockBlob) StageAndCommit(ctx context.Context, name string, bol *common.BlockOffsetList) error {
 	// lock on the blob name so that no stage and commit race condition occur causing failure
 	blobMtx := bb.blockLocks.GetLock(name)
 	blobMtx.Lock()
@@ -1217,10 +1677,10 @@ func (bb *BlockBlob) StageAndCommit(name string, bol *common.BlockOffsetList) er
 			data = blk.Data
 		}
 		if blk.Dirty() {
-			_, err := blobURL.StageBlock(context.Background(),
+			_, err := blobURL.StageBlock(ctx,
 				blk.Id,
 				bytes.NewReader(data),
-				bb.blobAccCond.LeaseAccessConditions,
+				bb.accessConditions(name).LeaseAccessConditions,
 				nil,
 				bb.downloadOptions.ClientProvidedKeyOptions)
 			if err != nil {
@@ -1232,11 +1692,11 @@ func (bb *BlockBlob) StageAndCommit(name string, bol *common.BlockOffsetList) er
 		}
 	}
 	if staged {
-		_, err := blobURL.CommitBlockList(context.Background(),
+		_, err := blobURL.CommitBlockList(ctx,
 			blockIDList,
 			azblob.BlobHTTPHeaders{ContentType: getContentType(name)},
 			nil,
-			bb.blobAccCond,
+			bb.accessConditions(name),
 			// azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: bol.Etag}},
 			bb.Config.defaultTier,
 			nil, // datalake doesn't support tags here
@@ -1252,7 +1712,7 @@ func (bb *BlockBlob) StageAndCommit(name string, bol *common.BlockOffsetList) er
 }
 
 // ChangeMod : Change mode of a blob
-func (bb *BlockBlob) ChangeMod(name string, _ os.FileMode) error {
+func (bb *BlockBlob) ChangeMod(ctx context.Context, name string, _ os.FileMode) error {
 	log.Trace("BlockBlob::ChangeMod : name %s", name)
 
 	if bb.Config.ignoreAccessModifiers {
@@ -1266,7 +1726,7 @@ func (bb *BlockBlob) ChangeMod(name string, _ os.FileMode) error {
 }
 
 // ChangeOwner : Change owner of a blob
-func (bb *BlockBlob) ChangeOwner(name string, _ int, _ int) error {
+func (bb *BlockBlob) ChangeOwner(ctx context.Context, name string, _ int, _ int) error {
 	log.Trace("BlockBlob::ChangeOwner : name %s", name)
 
 	if bb.Config.ignoreAccessModifiers {
@@ -1278,3 +1738,201 @@ func (bb *BlockBlob) ChangeOwner(name string, _ int, _ int) error {
 	// This is not currently supported for a flat namespace account
 	return syscall.ENOTSUP
 }
+
+// SetMetadata : Replace the user defined metadata of a blob, only if it still has the given etag unless it is empty
+func (bb *BlockBlob) SetMetadata(ctx context.Context, name string, metadata map[string]string, etag string) error {
+	log.Trace("BlockBlob::SetMetadata : name %s, etag %s", name, etag)
+
+	accCond := bb.accessConditions(name)
+	if etag != "" {
+		accCond.ModifiedAccessConditions.IfMatch = azblob.ETag(etag)
+	}
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.SetMetadata(ctx, metadata, accCond, bb.blobCPKOpt)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		} else if serr == ConditionNotMet {
+			log.Warn("BlockBlob::SetMetadata : %s was modified by someone else since %s", name, etag)
+			return syscall.ESTALE
+		}
+		log.Err("BlockBlob::SetMetadata : Failed to set metadata of %s [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// accessConditions : Conditions for requests updating a blob, carries the lease id if this mount holds a lease on it
+func (bb *BlockBlob) accessConditions(name string) azblob.BlobAccessConditions {
+	accCond := bb.blobAccCond
+	if leaseID, found := bb.leases.Load(name); found {
+		accCond.LeaseAccessConditions.LeaseID = leaseID.(string)
+	}
+	return accCond
+}
+
+// AcquireLease : Take a lease with the given id on a blob, fails with EWOULDBLOCK if someone else holds a lease on it
+func (bb *BlockBlob) AcquireLease(ctx context.Context, name string, leaseID string, duration int32) error {
+	log.Trace("BlockBlob::AcquireLease : name %s, duration %d", name, duration)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.AcquireLease(ctx, leaseID, duration, bb.blobAccCond.ModifiedAccessConditions)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		} else if serr == LeaseAlreadyPresent {
+			return syscall.EWOULDBLOCK
+		}
+		log.Err("BlockBlob::AcquireLease : Failed to acquire lease on %s [%s]", name, err.Error())
+		return err
+	}
+
+	bb.leases.Store(name, leaseID)
+	return nil
+}
+
+// CreateFileIfNotExists : Create an empty blob unless one exists already, a blob created meanwhile by someone else is kept
+func (bb *BlockBlob) CreateFileIfNotExists(ctx context.Context, name string) error {
+	log.Trace("BlockBlob::CreateFileIfNotExists : name %s", name)
+	blobURL := bb.Container.NewBlockBlobURL(filepath.Join(bb.Config.prefixPath, name))
+
+	_, err := azblob.UploadBufferToBlockBlob(ctx, nil, blobURL, azblob.UploadToBlockBlobOptions{
+		BlockSize:      bb.Config.blockSize,
+		BlobAccessTier: bb.Config.defaultTier,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType: getContentType(name),
+		},
+		AccessConditions: azblob.BlobAccessConditions{
+			ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny},
+		},
+	})
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileAlreadyExists || serr == ConditionNotMet {
+			return nil
+		}
+		log.Err("BlockBlob::CreateFileIfNotExists : Failed to create blob %s [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RenewLease : Extend a lease held by this mount, fails if the lease has expired and was taken by someone else
+func (bb *BlockBlob) RenewLease(ctx context.Context, name string, leaseID string) error {
+	log.Trace("BlockBlob::RenewLease : name %s", name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.RenewLease(ctx, leaseID, bb.blobAccCond.ModifiedAccessConditions)
+	if err != nil {
+		bb.leases.Delete(name)
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		}
+		log.Err("BlockBlob::RenewLease : Failed to renew lease on %s [%s]", name, err.Error())
+		return syscall.ENOLCK
+	}
+
+	return nil
+}
+
+// ReleaseLease : Give up a lease held by this mount so that others can lease the blob right away
+func (bb *BlockBlob) ReleaseLease(ctx context.Context, name string, leaseID string) error {
+	log.Trace("BlockBlob::ReleaseLease : name %s", name)
+
+	bb.leases.Delete(name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.ReleaseLease(ctx, leaseID, bb.blobAccCond.ModifiedAccessConditions)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return nil
+		}
+		log.Err("BlockBlob::ReleaseLease : Failed to release lease on %s [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetTier : Get the access tier of a blob and its rehydration status while it is moving out of the archive tier
+func (bb *BlockBlob) GetTier(ctx context.Context, name string) (string, string, error) {
+	log.Trace("BlockBlob::GetTier : name %s", name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	prop, err := blobURL.GetProperties(ctx, bb.blobAccCond, bb.blobCPKOpt)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return "", "", syscall.ENOENT
+		}
+		log.Err("BlockBlob::GetTier : Failed to get properties of %s [%s]", name, err.Error())
+		return "", "", err
+	}
+
+	return prop.AccessTier(), prop.ArchiveStatus(), nil
+}
+
+// SetTier : Move a blob to the given access tier, moving out of archive starts a rehydration which completes later
+func (bb *BlockBlob) SetTier(ctx context.Context, name string, tier string) error {
+	log.Trace("BlockBlob::SetTier : name %s, tier %s", name, tier)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.SetTier(ctx, azblob.AccessTierType(tier), azblob.LeaseAccessConditions{})
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		}
+		log.Err("BlockBlob::SetTier : Failed to set tier of %s to %s [%s]", name, tier, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetTags : Get the index tags of a blob
+func (bb *BlockBlob) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	log.Trace("BlockBlob::GetTags : name %s", name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	resp, err := blobURL.GetTags(ctx, nil)
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return nil, syscall.ENOENT
+		}
+		log.Err("BlockBlob::GetTags : Failed to get tags of %s [%s]", name, err.Error())
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(resp.BlobTagSet))
+	for _, tag := range resp.BlobTagSet {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+// SetTags : Replace the index tags of a blob
+func (bb *BlockBlob) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	log.Trace("BlockBlob::SetTags : name %s", name)
+
+	blobURL := bb.Container.NewBlobURL(filepath.Join(bb.Config.prefixPath, name))
+	_, err := blobURL.SetTags(ctx, nil, nil, nil, azblob.BlobTagsMap(tags))
+	if err != nil {
+		serr := storeBlobErrToErr(err)
+		if serr == ErrFileNotFound {
+			return syscall.ENOENT
+		}
+		log.Err("BlockBlob::SetTags : Failed to set tags of %s [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
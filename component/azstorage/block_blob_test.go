@@ -2257,7 +2257,7 @@ func (s *blockBlobTestSuite) TestFlushFileUpdateChunkedFile() {
 	updatedBlock := make([]byte, 2*MB)
 	rand.Read(updatedBlock)
 	h.CacheObj.BlockOffsetList.BlockList[1].Data = make([]byte, blockSize)
-	s.az.storage.ReadInBuffer(name, int64(blockSize), int64(blockSize), h.CacheObj.BlockOffsetList.BlockList[1].Data)
+	s.az.storage.ReadInBuffer(context.Background(), name, int64(blockSize), int64(blockSize), h.CacheObj.BlockOffsetList.BlockList[1].Data)
 	copy(h.CacheObj.BlockOffsetList.BlockList[1].Data[MB:2*MB+MB], updatedBlock)
 	h.CacheObj.BlockOffsetList.BlockList[1].Flags.Set(common.DirtyBlock)
 
@@ -2294,7 +2294,7 @@ func (s *blockBlobTestSuite) TestFlushFileTruncateUpdateChunkedFile() {
 	// truncate block
 	h.CacheObj.BlockOffsetList.BlockList[1].Data = make([]byte, blockSize/2)
 	h.CacheObj.BlockOffsetList.BlockList[1].EndIndex = int64(blockSize + blockSize/2)
-	s.az.storage.ReadInBuffer(name, int64(blockSize), int64(blockSize)/2, h.CacheObj.BlockOffsetList.BlockList[1].Data)
+	s.az.storage.ReadInBuffer(context.Background(), name, int64(blockSize), int64(blockSize)/2, h.CacheObj.BlockOffsetList.BlockList[1].Data)
 	h.CacheObj.BlockOffsetList.BlockList[1].Flags.Set(common.DirtyBlock)
 
 	// remove 2 blocks
@@ -2697,10 +2697,10 @@ func (s *blockBlobTestSuite) TestMD5SetOnUpload() {
 			s.assert.EqualValues(n, azblob.BlockBlobMaxUploadBlobBytes+1)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -2709,7 +2709,7 @@ func (s *blockBlobTestSuite) TestMD5SetOnUpload() {
 			s.assert.Nil(err)
 			s.assert.EqualValues(localMD5, prop.MD5)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = f.Close()
 			_ = os.Remove(name)
 		})
@@ -2750,14 +2750,14 @@ func (s *blockBlobTestSuite) TestMD5NotSetOnUpload() {
 			s.assert.EqualValues(n, azblob.BlockBlobMaxUploadBlobBytes+1)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.Empty(prop.MD5)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = f.Close()
 			_ = os.Remove(name)
 		})
@@ -2798,10 +2798,10 @@ func (s *blockBlobTestSuite) TestMD5AutoSetOnUpload() {
 			s.assert.EqualValues(n, 100)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -2810,7 +2810,7 @@ func (s *blockBlobTestSuite) TestMD5AutoSetOnUpload() {
 			s.assert.Nil(err)
 			s.assert.EqualValues(localMD5, prop.MD5)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = f.Close()
 			_ = os.Remove(name)
 		})
@@ -2851,13 +2851,13 @@ func (s *blockBlobTestSuite) TestInvalidateMD5PostUpload() {
 			s.assert.EqualValues(n, 100)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 
 			blobURL := s.containerUrl.NewBlobURL(name)
 			_, _ = blobURL.SetHTTPHeaders(context.Background(), azblob.BlobHTTPHeaders{ContentMD5: []byte("blobfuse")}, azblob.BlobAccessConditions{})
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -2866,7 +2866,7 @@ func (s *blockBlobTestSuite) TestInvalidateMD5PostUpload() {
 			s.assert.Nil(err)
 			s.assert.NotEqualValues(localMD5, prop.MD5)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = f.Close()
 			_ = os.Remove(name)
 		})
@@ -2907,12 +2907,12 @@ func (s *blockBlobTestSuite) TestValidateAutoMD5OnRead() {
 			s.assert.EqualValues(n, 100)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 			_ = f.Close()
 			_ = os.Remove(name)
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -2920,10 +2920,10 @@ func (s *blockBlobTestSuite) TestValidateAutoMD5OnRead() {
 			s.assert.Nil(err)
 			s.assert.NotNil(f)
 
-			err = s.az.storage.ReadToFile(name, 0, 100, f)
+			err = s.az.storage.ReadToFile(context.Background(), name, 0, 100, f)
 			s.assert.Nil(err)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = os.Remove(name)
 		})
 	}
@@ -2963,12 +2963,12 @@ func (s *blockBlobTestSuite) TestValidateManualMD5OnRead() {
 			s.assert.EqualValues(n, azblob.BlockBlobMaxUploadBlobBytes+1)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 			_ = f.Close()
 			_ = os.Remove(name)
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -2976,10 +2976,10 @@ func (s *blockBlobTestSuite) TestValidateManualMD5OnRead() {
 			s.assert.Nil(err)
 			s.assert.NotNil(f)
 
-			err = s.az.storage.ReadToFile(name, 0, azblob.BlockBlobMaxUploadBlobBytes+1, f)
+			err = s.az.storage.ReadToFile(context.Background(), name, 0, azblob.BlockBlobMaxUploadBlobBytes+1, f)
 			s.assert.Nil(err)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = os.Remove(name)
 		})
 	}
@@ -3019,7 +3019,7 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnRead() {
 			s.assert.EqualValues(n, 100)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 			_ = f.Close()
 			_ = os.Remove(name)
@@ -3027,7 +3027,7 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnRead() {
 			blobURL := s.containerUrl.NewBlobURL(name)
 			_, _ = blobURL.SetHTTPHeaders(context.Background(), azblob.BlobHTTPHeaders{ContentMD5: []byte("blobfuse")}, azblob.BlobAccessConditions{})
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -3035,11 +3035,11 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnRead() {
 			s.assert.Nil(err)
 			s.assert.NotNil(f)
 
-			err = s.az.storage.ReadToFile(name, 0, 100, f)
+			err = s.az.storage.ReadToFile(context.Background(), name, 0, 100, f)
 			s.assert.NotNil(err)
 			s.assert.Contains(err.Error(), "md5 sum mismatch on download")
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = os.Remove(name)
 		})
 	}
@@ -3079,7 +3079,7 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnReadNoVaildate() {
 			s.assert.EqualValues(n, 100)
 			_, _ = f.Seek(0, 0)
 
-			err = s.az.storage.WriteFromFile(name, nil, f)
+			_, err = s.az.storage.WriteFromFile(context.Background(), name, nil, f)
 			s.assert.Nil(err)
 			_ = f.Close()
 			_ = os.Remove(name)
@@ -3087,7 +3087,7 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnReadNoVaildate() {
 			blobURL := s.containerUrl.NewBlobURL(name)
 			_, _ = blobURL.SetHTTPHeaders(context.Background(), azblob.BlobHTTPHeaders{ContentMD5: []byte("blobfuse")}, azblob.BlobAccessConditions{})
 
-			prop, err := s.az.storage.GetAttr(name)
+			prop, err := s.az.storage.GetAttr(context.Background(), name)
 			s.assert.Nil(err)
 			s.assert.NotEmpty(prop.MD5)
 
@@ -3095,10 +3095,10 @@ func (s *blockBlobTestSuite) TestInvalidMD5OnReadNoVaildate() {
 			s.assert.Nil(err)
 			s.assert.NotNil(f)
 
-			err = s.az.storage.ReadToFile(name, 0, 100, f)
+			err = s.az.storage.ReadToFile(context.Background(), name, 0, 100, f)
 			s.assert.Nil(err)
 
-			_ = s.az.storage.DeleteFile(name)
+			_ = s.az.storage.DeleteFile(context.Background(), name)
 			_ = os.Remove(name)
 		})
 	}
@@ -36,9 +36,14 @@ package azstorage
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
+	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 
@@ -71,6 +76,18 @@ func (AuthType) MSI() AuthType {
 	return AuthType(4)
 }
 
+func (AuthType) SPNCERT() AuthType {
+	return AuthType(5)
+}
+
+func (AuthType) CLIENTASSERTION() AuthType {
+	return AuthType(6)
+}
+
+func (AuthType) AZCLI() AuthType {
+	return AuthType(7)
+}
+
 func (a AuthType) String() string {
 	return enum.StringInt(a, reflect.TypeOf(a))
 }
@@ -100,6 +117,10 @@ func (AccountType) ADLS() AccountType {
 	return AccountType(2)
 }
 
+func (AccountType) MEMORY() AccountType {
+	return AccountType(3)
+}
+
 func (f AccountType) String() string {
 	return enum.StringInt(f, reflect.TypeOf(f))
 }
@@ -127,6 +148,12 @@ const (
 	EnvAzStorageSpnTenantId        = "AZURE_STORAGE_SPN_TENANT_ID"
 	EnvAzStorageSpnClientId        = "AZURE_STORAGE_SPN_CLIENT_ID"
 	EnvAzStorageSpnClientSecret    = "AZURE_STORAGE_SPN_CLIENT_SECRET"
+	EnvAzStorageSpnCertPath        = "AZURE_STORAGE_SPN_CLIENT_CERT_PATH"
+	EnvAzStorageSpnCertPassword    = "AZURE_STORAGE_SPN_CLIENT_CERT_PASSWORD"
+	EnvAzFederatedTokenFile        = "AZURE_FEDERATED_TOKEN_FILE"
+	EnvAzClientId                  = "AZURE_CLIENT_ID"
+	EnvAzTenantId                  = "AZURE_TENANT_ID"
+	EnvAzAuthorityHost             = "AZURE_AUTHORITY_HOST"
 	EnvAzStorageAadEndpoint        = "AZURE_STORAGE_AAD_ENDPOINT"
 	EnvAzStorageAuthType           = "AZURE_STORAGE_AUTH_TYPE"
 	EnvAzStorageBlobEndpoint       = "AZURE_STORAGE_BLOB_ENDPOINT"
@@ -135,6 +162,14 @@ const (
 	EnvAzStorageAccountContainer   = "AZURE_STORAGE_ACCOUNT_CONTAINER"
 )
 
+// Well known account, key and endpoint of the local storage emulator (Azurite).
+// These are publicly documented development credentials and not secrets.
+const (
+	emulatorAccountName = "devstoreaccount1"
+	emulatorAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	emulatorBlobHost    = "127.0.0.1:10000"
+)
+
 type AzStorageOptions struct {
 	AccountType             string `config:"type" yaml:"type,omitempty"`
 	UseHTTP                 bool   `config:"use-http" yaml:"use-http,omitempty"`
@@ -147,6 +182,9 @@ type AzStorageOptions struct {
 	TenantID                string `config:"tenantid" yaml:"tenantid,omitempty"`
 	ClientID                string `config:"clientid" yaml:"clientid,omitempty"`
 	ClientSecret            string `config:"clientsecret" yaml:"clientsecret,omitempty"`
+	ClientCertPath          string `config:"clientcertpath" yaml:"clientcertpath,omitempty"`
+	ClientCertPassword      string `config:"clientcertpassword" yaml:"clientcertpassword,omitempty"`
+	FederatedTokenFile      string `config:"federatedtokenfile" yaml:"federatedtokenfile,omitempty"`
 	ActiveDirectoryEndpoint string `config:"aadendpoint" yaml:"aadendpoint,omitempty"`
 	Endpoint                string `config:"endpoint" yaml:"endpoint,omitempty"`
 	AuthMode                string `config:"mode" yaml:"mode,omitempty"`
@@ -168,6 +206,17 @@ type AzStorageOptions struct {
 	UpdateMD5               bool   `config:"update-md5" yaml:"update-md5"`
 	ValidateMD5             bool   `config:"validate-md5" yaml:"validate-md5"`
 	VirtualDirectory        bool   `config:"virtual-directory" yaml:"virtual-directory"`
+	MemoryHNS               bool   `config:"memory-hns" yaml:"memory-hns,omitempty"`
+	MemoryVersioning        bool   `config:"memory-versioning" yaml:"memory-versioning,omitempty"`
+	ShowVersions            bool   `config:"show-versions" yaml:"show-versions,omitempty"`
+	MemorySoftDelete        bool   `config:"memory-soft-delete" yaml:"memory-soft-delete,omitempty"`
+	ShowTrash               bool   `config:"show-trash" yaml:"show-trash,omitempty"`
+	Emulator                bool   `config:"emulator" yaml:"emulator,omitempty"`
+	UsePathStyle            bool   `config:"use-path-style" yaml:"use-path-style,omitempty"`
+	RenameWorkers           uint16 `config:"rename-workers" yaml:"rename-workers,omitempty"`
+	RenameJournalPath       string `config:"rename-journal-path" yaml:"rename-journal-path,omitempty"`
+	RenameRecovery          string `config:"rename-recovery" yaml:"rename-recovery,omitempty"`
+	LeaseDuration           int32  `config:"lease-duration-sec" yaml:"lease-duration-sec,omitempty"`
 
 	// v1 support
 	UseAdls        bool   `config:"use-adls" yaml:"-"`
@@ -191,6 +240,9 @@ func RegisterEnvVariables() {
 	config.BindEnv("azstorage.tenantid", EnvAzStorageSpnTenantId)
 	config.BindEnv("azstorage.clientid", EnvAzStorageSpnClientId)
 	config.BindEnv("azstorage.clientsecret", EnvAzStorageSpnClientSecret)
+	config.BindEnv("azstorage.clientcertpath", EnvAzStorageSpnCertPath)
+	config.BindEnv("azstorage.clientcertpassword", EnvAzStorageSpnCertPassword)
+	config.BindEnv("azstorage.federatedtokenfile", EnvAzFederatedTokenFile)
 	config.BindEnv("azstorage.objid", EnvAzStorageIdentityObjectId)
 
 	config.BindEnv("azstorage.aadendpoint", EnvAzStorageAadEndpoint)
@@ -231,10 +283,29 @@ func formatEndpointProtocol(endpoint string, http bool) string {
 	return correctedEndpoint
 }
 
+// isPathStyleEndpoint : check whether the account name is part of the endpoint path instead of the host name.
+// This is detected only for endpoints addressed by IP or localhost, e.g. http://127.0.0.1:10000/devstoreaccount1,
+// other hosts need use-path-style as a path is also valid on account and private endpoints.
+func isPathStyleEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	host := u.Hostname()
+	return net.ParseIP(host) != nil || strings.EqualFold(host, "localhost")
+}
+
 // formatEndpointAccountType : format the endpoint to match the account type
 func formatEndpointAccountType(endpoint string, account AccountType) string {
 	// TODO : Modify this method when file share support is merged
 	correctedEndpoint := endpoint
+
+	// Path style endpoints serve blob and dfs apis from the same url, there is nothing to switch
+	if isPathStyleEndpoint(correctedEndpoint) {
+		return correctedEndpoint
+	}
+
 	if strings.Contains(correctedEndpoint, ".blob.") {
 		if account == EAccountType.ADLS() {
 			correctedEndpoint = strings.Replace(correctedEndpoint, ".blob.", ".dfs.", 1)
@@ -269,8 +340,12 @@ func validateMsiConfig(opt AzStorageOptions) error {
 func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 	log.Trace("ParseAndValidateConfig : Parsing config")
 
-	// Validate account name is present or not
-	if opt.AccountName == "" {
+	if opt.Emulator {
+		applyEmulatorDefaults(&opt)
+	}
+
+	// Validate account name is present or not, in memory store does not need one
+	if opt.AccountName == "" && !strings.EqualFold(opt.AccountType, EAccountType.MEMORY().String()) {
 		return errors.New("account name not provided")
 	}
 	az.stConfig.authConfig.AccountName = opt.AccountName
@@ -302,6 +377,23 @@ func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 		az.stConfig.authConfig.AccountType = accountType
 	}
 
+	err := parseRenameConfig(az, opt)
+	if err != nil {
+		return err
+	}
+
+	if opt.LeaseDuration != 0 {
+		if opt.LeaseDuration < minLeaseDuration || opt.LeaseDuration > maxLeaseDuration {
+			log.Err("ParseAndValidateConfig : Invalid lease duration %d", opt.LeaseDuration)
+			return fmt.Errorf("invalid lease-duration-sec, it has to be between %d and %d", minLeaseDuration, maxLeaseDuration)
+		}
+		az.stConfig.leaseDuration = opt.LeaseDuration
+	}
+
+	if az.stConfig.authConfig.AccountType == EAccountType.MEMORY() {
+		return parseMemoryConfig(az, opt)
+	}
+
 	if opt.BlockSize != 0 {
 		if opt.BlockSize > azblob.BlockBlobMaxStageBlockBytes {
 			log.Err("block size is too large. Block size has to be smaller than %s Bytes", azblob.BlockBlobMaxStageBlockBytes)
@@ -311,7 +403,7 @@ func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 	}
 
 	// Validate container name is present or not
-	err := config.UnmarshalKey("mount-all-containers", &az.stConfig.mountAllContainers)
+	err = config.UnmarshalKey("mount-all-containers", &az.stConfig.mountAllContainers)
 	if err != nil {
 		log.Err("ParseAndValidateConfig : Failed to detect mount-all-container")
 	}
@@ -337,7 +429,10 @@ func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 	}
 	az.stConfig.authConfig.Endpoint = opt.Endpoint
 	az.stConfig.authConfig.Endpoint = formatEndpointProtocol(az.stConfig.authConfig.Endpoint, opt.UseHTTP)
-	az.stConfig.authConfig.Endpoint = formatEndpointAccountType(az.stConfig.authConfig.Endpoint, az.stConfig.authConfig.AccountType)
+	az.stConfig.authConfig.UsePathStyle = opt.UsePathStyle
+	if !opt.UsePathStyle {
+		az.stConfig.authConfig.Endpoint = formatEndpointAccountType(az.stConfig.authConfig.Endpoint, az.stConfig.authConfig.AccountType)
+	}
 
 	az.stConfig.authConfig.ActiveDirectoryEndpoint = opt.ActiveDirectoryEndpoint
 	az.stConfig.authConfig.ActiveDirectoryEndpoint = formatEndpointProtocol(az.stConfig.authConfig.ActiveDirectoryEndpoint, false)
@@ -426,6 +521,39 @@ func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 		az.stConfig.authConfig.ClientID = opt.ClientID
 		az.stConfig.authConfig.ClientSecret = opt.ClientSecret
 		az.stConfig.authConfig.TenantID = opt.TenantID
+	case EAuthType.SPNCERT():
+		az.stConfig.authConfig.AuthMode = EAuthType.SPNCERT()
+		if opt.ClientID == "" || opt.ClientCertPath == "" || opt.TenantID == "" {
+			//lint:ignore ST1005 ignore
+			return errors.New("Client ID, Tenant ID or Client Certificate not provided")
+		}
+		az.stConfig.authConfig.ClientID = opt.ClientID
+		az.stConfig.authConfig.ClientCertPath = common.ExpandPath(opt.ClientCertPath)
+		az.stConfig.authConfig.ClientCertPassword = opt.ClientCertPassword
+		az.stConfig.authConfig.TenantID = opt.TenantID
+	case EAuthType.CLIENTASSERTION():
+		az.stConfig.authConfig.AuthMode = EAuthType.CLIENTASSERTION()
+		// Workload identity injects the identity of the pod along with the token file
+		if opt.ClientID == "" {
+			opt.ClientID = os.Getenv(EnvAzClientId)
+		}
+		if opt.TenantID == "" {
+			opt.TenantID = os.Getenv(EnvAzTenantId)
+		}
+		if opt.ActiveDirectoryEndpoint == "" && os.Getenv(EnvAzAuthorityHost) != "" {
+			az.stConfig.authConfig.ActiveDirectoryEndpoint = formatEndpointProtocol(os.Getenv(EnvAzAuthorityHost), false)
+		}
+		if opt.ClientID == "" || opt.FederatedTokenFile == "" || opt.TenantID == "" {
+			//lint:ignore ST1005 ignore
+			return errors.New("Client ID, Tenant ID or Federated Token File not provided")
+		}
+		az.stConfig.authConfig.ClientID = opt.ClientID
+		az.stConfig.authConfig.FederatedTokenFile = common.ExpandPath(opt.FederatedTokenFile)
+		az.stConfig.authConfig.TenantID = opt.TenantID
+	case EAuthType.AZCLI():
+		az.stConfig.authConfig.AuthMode = EAuthType.AZCLI()
+		// Tenant is optional, by default the CLI uses the tenant of the logged in account
+		az.stConfig.authConfig.TenantID = opt.TenantID
 
 	default:
 		log.Err("ParseAndValidateConfig : Invalid auth mode %s", opt.AuthMode)
@@ -474,6 +602,83 @@ func ParseAndValidateConfig(az *AzStorage, opt AzStorageOptions) error {
 	return nil
 }
 
+// applyEmulatorDefaults : fill in the well known emulator account, key and path style endpoint for whatever is not configured
+func applyEmulatorDefaults(opt *AzStorageOptions) {
+	if opt.AccountName == "" {
+		opt.AccountName = emulatorAccountName
+	}
+
+	// Use the well known key only when no other credential is configured
+	if opt.AuthMode == "" && opt.AccountKey == "" && opt.SaSKey == "" && opt.AccountName == emulatorAccountName {
+		opt.AccountKey = emulatorAccountKey
+	}
+
+	// Emulator listens on plain http unless told otherwise
+	if !config.IsSet(compName+".use-http") && !config.IsSet(compName+".use-https") {
+		opt.UseHTTP = true
+	}
+
+	if opt.Endpoint == "" {
+		opt.Endpoint = fmt.Sprintf("%s/%s", emulatorBlobHost, opt.AccountName)
+	}
+
+	// Emulator takes the account from the path whatever host it is reached by
+	opt.UsePathStyle = true
+
+	log.Info("ParseAndValidateConfig : Emulator mode, account %s, endpoint %s", opt.AccountName, opt.Endpoint)
+}
+
+// parseRenameConfig : Parse config of directory rename on flat namespace.
+// Journal is kept under the default work directory, in memory store has nothing to recover after a restart so it journals only on request.
+func parseRenameConfig(az *AzStorage, opt AzStorageOptions) error {
+	az.stConfig.renameJournalPath = opt.RenameJournalPath
+	if az.stConfig.renameJournalPath == "" && az.stConfig.authConfig.AccountType != EAccountType.MEMORY() {
+		az.stConfig.renameJournalPath = filepath.Join(common.DefaultWorkDir, renameJournalDirName)
+	}
+	az.stConfig.renameJournalPath = common.ExpandPath(az.stConfig.renameJournalPath)
+
+	switch opt.RenameRecovery {
+	case "":
+		az.stConfig.renameRecovery = renameRecoveryResume
+	case renameRecoveryResume, renameRecoveryRollback, renameRecoveryNone:
+		az.stConfig.renameRecovery = opt.RenameRecovery
+	default:
+		log.Err("ParseAndValidateConfig : Invalid rename recovery policy %s", opt.RenameRecovery)
+		return errors.New("invalid rename-recovery, valid values are resume, rollback and none")
+	}
+
+	return nil
+}
+
+// parseMemoryConfig : Parse config for the in memory store, there is no endpoint, auth or retry policy to configure
+func parseMemoryConfig(az *AzStorage, opt AzStorageOptions) error {
+	if opt.BlockSize > azblob.BlockBlobMaxStageBlockBytes {
+		log.Err("block size is too large. Block size has to be smaller than %s Bytes", azblob.BlockBlobMaxStageBlockBytes)
+		return errors.New("block size is too large")
+	}
+
+	az.stConfig.container = opt.Container
+	if az.stConfig.container == "" {
+		az.stConfig.container = "memory"
+	}
+
+	az.stConfig.prefixPath = opt.PrefixPath
+	az.stConfig.cancelListForSeconds = opt.CancelListForSeconds
+	az.stConfig.memoryHNS = opt.MemoryHNS
+	az.stConfig.memoryVersioning = opt.MemoryVersioning
+	az.stConfig.memorySoftDelete = opt.MemorySoftDelete
+
+	err := ParseAndReadDynamicConfig(az, opt, false)
+	if err != nil {
+		return err
+	}
+
+	log.Info("ParseAndValidateConfig : AccountType: %s, Container: %s, Prefix: %s, Hierarchical Namespace: %v, Virtual Directory: %v",
+		az.stConfig.authConfig.AccountType, az.stConfig.container, az.stConfig.prefixPath, az.stConfig.memoryHNS, az.stConfig.virtualDirectory)
+
+	return nil
+}
+
 // ParseAndReadDynamicConfig : On config change read only the required config
 func ParseAndReadDynamicConfig(az *AzStorage, opt AzStorageOptions, reload bool) error {
 	log.Trace("ParseAndReadDynamicConfig : Reparsing config")
@@ -488,6 +693,10 @@ func ParseAndReadDynamicConfig(az *AzStorage, opt AzStorageOptions, reload bool)
 		az.stConfig.maxConcurrency = opt.MaxConcurrency
 	}
 
+	if opt.RenameWorkers != 0 {
+		az.stConfig.renameWorkers = opt.RenameWorkers
+	}
+
 	// Populate default tier
 	if opt.DefaultTier != "" {
 		az.stConfig.defaultTier = getAccessTierType(opt.DefaultTier)
@@ -503,6 +712,9 @@ func ParseAndReadDynamicConfig(az *AzStorage, opt AzStorageOptions, reload bool)
 		az.stConfig.virtualDirectory = true
 	}
 
+	az.stConfig.showVersions = opt.ShowVersions
+	az.stConfig.showTrash = opt.ShowTrash
+
 	// Auth related reconfig
 	switch opt.AuthMode {
 	case "sas":
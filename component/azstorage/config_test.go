@@ -34,6 +34,7 @@
 package azstorage
 
 import (
+	"os"
 	"testing"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -157,6 +158,81 @@ func (s *configTestSuite) TestProtoType() {
 	assert.Equal(az.stConfig.authConfig.UseHTTP, true)
 }
 
+func (s *configTestSuite) TestEmulator() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.Container = "abcd"
+	opt.Emulator = true
+
+	err := ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.AccountName, emulatorAccountName)
+	assert.Equal(az.stConfig.authConfig.AccountKey, emulatorAccountKey)
+	assert.Equal(az.stConfig.authConfig.AuthMode, EAuthType.KEY())
+	assert.Equal(az.stConfig.authConfig.UseHTTP, true)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "http://127.0.0.1:10000/devstoreaccount1/")
+
+	// dfs apis are served from the same path style url
+	az = &AzStorage{}
+	opt.AccountType = "adls"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "http://127.0.0.1:10000/devstoreaccount1/")
+	assert.Equal(transformConfig(az.stConfig).authConfig.Endpoint, "http://127.0.0.1:10000/devstoreaccount1/")
+
+	// User provided values win over the defaults
+	az = &AzStorage{}
+	opt = AzStorageOptions{}
+	opt.Container = "abcd"
+	opt.Emulator = true
+	opt.AccountName = "myaccount"
+	opt.SaSKey = "?sv=xyz"
+	opt.Endpoint = "https://localhost:10000/myaccount"
+	config.SetBool(compName+".use-http", false)
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.AccountName, "myaccount")
+	assert.Equal(az.stConfig.authConfig.AuthMode, EAuthType.SAS())
+	assert.Equal(az.stConfig.authConfig.AccountKey, "")
+	assert.Equal(az.stConfig.authConfig.UseHTTP, false)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "https://localhost:10000/myaccount/")
+
+	// Emulator reached by a host name is path style as well
+	az = &AzStorage{}
+	opt.AccountType = "adls"
+	opt.Endpoint = "https://azurite.blob.local:10000/myaccount"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "https://azurite.blob.local:10000/myaccount/")
+}
+
+func (s *configTestSuite) TestUsePathStyle() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.AccountName = "myaccount"
+	opt.AccountKey = "key"
+	opt.Container = "abcd"
+	opt.AccountType = "adls"
+	opt.Endpoint = "https://storage.blob.contoso.com/myaccount"
+
+	// Named host with a path is not taken for path style
+	err := ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "https://storage.dfs.contoso.com/myaccount/")
+
+	az = &AzStorage{}
+	opt.UsePathStyle = true
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.True(az.stConfig.authConfig.UsePathStyle)
+	assert.Equal(az.stConfig.authConfig.Endpoint, "https://storage.blob.contoso.com/myaccount/")
+	assert.Equal(transformConfig(az.stConfig).authConfig.Endpoint, "https://storage.blob.contoso.com/myaccount/")
+}
+
 func (s *configTestSuite) TestProxyConfig() {
 	defer config.ResetConfig()
 	assert := assert.New(s.T())
@@ -313,6 +389,116 @@ func (s *configTestSuite) TestAuthModeSPN() {
 	assert.Equal(az.stConfig.authConfig.TenantID, opt.TenantID)
 }
 
+func (s *configTestSuite) TestAuthModeSPNCert() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.AccountName = "abcd"
+	opt.Container = "abcd"
+	opt.AuthMode = "spncert"
+
+	err := ParseAndValidateConfig(az, opt)
+	assert.NotNil(err)
+	assert.Equal(az.stConfig.authConfig.AuthMode, EAuthType.SPNCERT())
+	assert.Contains(err.Error(), "Client ID, Tenant ID or Client Certificate not provided")
+
+	opt.ClientID = "abc"
+	opt.TenantID = "xyz"
+	err = ParseAndValidateConfig(az, opt)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Client ID, Tenant ID or Client Certificate not provided")
+
+	opt.ClientCertPath = "/etc/blobfuse2/spn.pem"
+	opt.ClientCertPassword = "123"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.ClientID, opt.ClientID)
+	assert.Equal(az.stConfig.authConfig.TenantID, opt.TenantID)
+	assert.Equal(az.stConfig.authConfig.ClientCertPath, opt.ClientCertPath)
+	assert.Equal(az.stConfig.authConfig.ClientCertPassword, opt.ClientCertPassword)
+}
+
+func (s *configTestSuite) TestAuthModeClientAssertion() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.AccountName = "abcd"
+	opt.Container = "abcd"
+	opt.AuthMode = "clientassertion"
+
+	err := ParseAndValidateConfig(az, opt)
+	assert.NotNil(err)
+	assert.Equal(az.stConfig.authConfig.AuthMode, EAuthType.CLIENTASSERTION())
+	assert.Contains(err.Error(), "Client ID, Tenant ID or Federated Token File not provided")
+
+	opt.ClientID = "abc"
+	opt.TenantID = "xyz"
+	opt.FederatedTokenFile = "/var/run/secrets/azure/tokens/azure-identity-token"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.ClientID, opt.ClientID)
+	assert.Equal(az.stConfig.authConfig.TenantID, opt.TenantID)
+	assert.Equal(az.stConfig.authConfig.FederatedTokenFile, opt.FederatedTokenFile)
+}
+
+func (s *configTestSuite) TestAuthModeClientAssertionEnv() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+
+	// Variables injected in the pod by workload identity
+	for key, value := range map[string]string{
+		EnvAzClientId:      "abc",
+		EnvAzTenantId:      "xyz",
+		EnvAzAuthorityHost: "https://login.microsoftonline.us/",
+	} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.AccountName = "abcd"
+	opt.Container = "abcd"
+	opt.AuthMode = "clientassertion"
+	opt.FederatedTokenFile = "/var/run/secrets/azure/tokens/azure-identity-token"
+
+	err := ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.ClientID, "abc")
+	assert.Equal(az.stConfig.authConfig.TenantID, "xyz")
+	assert.Equal(az.stConfig.authConfig.ActiveDirectoryEndpoint, "https://login.microsoftonline.us/")
+
+	// Configured values take precedence
+	opt.ClientID = "def"
+	opt.ActiveDirectoryEndpoint = "login.chinacloudapi.cn"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.ClientID, "def")
+	assert.Equal(az.stConfig.authConfig.ActiveDirectoryEndpoint, "https://login.chinacloudapi.cn/")
+}
+
+func (s *configTestSuite) TestAuthModeAzCLI() {
+	defer config.ResetConfig()
+	assert := assert.New(s.T())
+	az := &AzStorage{}
+	opt := AzStorageOptions{}
+	opt.AccountName = "abcd"
+	opt.Container = "abcd"
+	opt.AuthMode = "azcli"
+
+	err := ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.AuthMode, EAuthType.AZCLI())
+	assert.Empty(az.stConfig.authConfig.TenantID)
+
+	opt.TenantID = "xyz"
+	err = ParseAndValidateConfig(az, opt)
+	assert.Nil(err)
+	assert.Equal(az.stConfig.authConfig.TenantID, opt.TenantID)
+}
+
 func (s *configTestSuite) TestOtherFlags() {
 	defer config.ResetConfig()
 	assert := assert.New(s.T())
@@ -34,6 +34,8 @@
 package azstorage
 
 import (
+	"context"
+	"io"
 	"net/url"
 	"os"
 
@@ -74,6 +76,29 @@ type AzStorageConfig struct {
 	updateMD5        bool
 	validateMD5      bool
 	virtualDirectory bool
+
+	// expose versions and snapshots of blobs read only under the versions directory
+	showVersions bool
+
+	// expose soft deleted blobs under the trash directory
+	showTrash bool
+
+	// hierarchical namespace semantics for the in memory store
+	memoryHNS bool
+
+	// retain previous versions of blobs in the in memory store
+	memoryVersioning bool
+
+	// retain deleted blobs in the in memory store till they are undeleted
+	memorySoftDelete bool
+
+	// directory rename on flat namespace: parallel moves, journal of in flight renames and what to do with those on mount
+	renameWorkers     uint16
+	renameJournalPath string
+	renameRecovery    string
+
+	// duration of the blob leases backing exclusive file locks, renewed while the lock is held
+	leaseDuration int32
 }
 
 type AzStorageConnection struct {
@@ -96,34 +121,64 @@ type AzConnection interface {
 	// This is just for test, shall not be used otherwise
 	SetPrefixPath(string) error
 
-	CreateFile(name string, mode os.FileMode) error
-	CreateDirectory(name string) error
-	CreateLink(source string, target string) error
+	CreateFile(ctx context.Context, name string, mode os.FileMode) error
+	CreateDirectory(ctx context.Context, name string) error
+	CreateLink(ctx context.Context, source string, target string) error
 
-	DeleteFile(name string) error
-	DeleteDirectory(name string) error
+	DeleteFile(ctx context.Context, name string) error
+	DeleteDirectory(ctx context.Context, name string) error
 
-	RenameFile(string, string) error
-	RenameDirectory(string, string) error
+	RenameFile(ctx context.Context, source string, target string) error
+	RenameDirectory(ctx context.Context, source string, target string) error
+	CopyFile(ctx context.Context, source string, target string) error
+	// Copy count bytes of the source at srcOffset into the target at dstOffset, the rest of the target is kept
+	CopyRange(ctx context.Context, source string, srcOffset int64, target string, dstOffset int64, count int64) error
 
-	GetAttr(name string) (attr *internal.ObjAttr, err error)
+	GetAttr(ctx context.Context, name string) (attr *internal.ObjAttr, err error)
 
 	// Standard operations to be supported by any account type
-	List(prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error)
+	List(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error)
 
-	ReadToFile(name string, offset int64, count int64, fi *os.File) error
-	ReadBuffer(name string, offset int64, len int64) ([]byte, error)
-	ReadInBuffer(name string, offset int64, len int64, data []byte) error
+	// Versions and snapshots of a blob, each attribute is named after its version id or snapshot
+	ListVersions(ctx context.Context, name string) ([]*internal.ObjAttr, error)
+	GetVersionAttr(ctx context.Context, name string, version string) (*internal.ObjAttr, error)
 
-	WriteFromFile(name string, metadata map[string]string, fi *os.File) error
-	WriteFromBuffer(name string, metadata map[string]string, data []byte) error
-	Write(options internal.WriteFileOptions) error
-	GetFileBlockOffsets(name string) (*common.BlockOffsetList, error)
+	// Soft deleted blobs at one level of the hierarchy, and restoring them
+	ListDeleted(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error)
+	Undelete(ctx context.Context, name string) error
+
+	// Finish directory renames interrupted by an earlier unmount, as configured by the rename recovery policy
+	RecoverRenames(ctx context.Context) error
+
+	ReadToFile(ctx context.Context, name string, offset int64, count int64, fi *os.File) error
+	ReadBuffer(ctx context.Context, name string, offset int64, len int64) ([]byte, error)
+	ReadInBuffer(ctx context.Context, name string, offset int64, len int64, data []byte) error
+	ReadVersionInBuffer(ctx context.Context, name string, version string, offset int64, len int64, data []byte) error
 
-	ChangeMod(string, os.FileMode) error
-	ChangeOwner(string, int, int) error
-	TruncateFile(string, int64) error
-	StageAndCommit(name string, bol *common.BlockOffsetList) error
+	// Uploads return the etag of the blob they created
+	WriteFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File) (string, error)
+	WriteFromFileIfMatch(ctx context.Context, name string, metadata map[string]string, fi *os.File, etag string) (string, error)
+	WriteFromBuffer(ctx context.Context, name string, metadata map[string]string, data []byte) error
+	WriteFromReader(ctx context.Context, name string, metadata map[string]string, r io.ReaderAt, size int64, etag string) (string, error)
+	Write(options internal.WriteFileOptions) error
+	GetFileBlockOffsets(ctx context.Context, name string) (*common.BlockOffsetList, error)
+
+	ChangeMod(ctx context.Context, name string, mode os.FileMode) error
+	ChangeOwner(ctx context.Context, name string, uid int, gid int) error
+	SetMetadata(ctx context.Context, name string, metadata map[string]string, etag string) error
+	GetTier(ctx context.Context, name string) (tier string, archiveStatus string, err error)
+	SetTier(ctx context.Context, name string, tier string) error
+	GetTags(ctx context.Context, name string) (map[string]string, error)
+	SetTags(ctx context.Context, name string, tags map[string]string) error
+	TruncateFile(ctx context.Context, name string, size int64) error
+	StageAndCommit(ctx context.Context, name string, bol *common.BlockOffsetList) error
+
+	// Leases backing exclusive file locks, updates made by this mount carry the lease id of the blob once acquired
+	AcquireLease(ctx context.Context, name string, leaseID string, duration int32) error
+	RenewLease(ctx context.Context, name string, leaseID string) error
+	ReleaseLease(ctx context.Context, name string, leaseID string) error
+	// Put an empty blob in place of a file not uploaded yet so that it can be leased, an existing blob is left as is
+	CreateFileIfNotExists(ctx context.Context, name string) error
 
 	NewCredentialKey(_, _ string) error
 }
@@ -140,6 +195,10 @@ func NewAzStorageConnection(cfg AzStorageConfig) AzConnection {
 		stg := &Datalake{}
 		_ = stg.Configure(cfg)
 		return stg
+	} else if cfg.authConfig.AccountType == EAccountType.MEMORY() {
+		stg := &MemoryStore{}
+		_ = stg.Configure(cfg)
+		return stg
 	}
 
 	return nil
@@ -36,6 +36,7 @@ package azstorage
 import (
 	"context"
 	"errors"
+	"io"
 	"io/fs"
 	"net/url"
 	"os"
@@ -71,8 +72,11 @@ var _ AzConnection = &Datalake{}
 // We can handle case 1 by simply replacing the .dfs. to .blob. and blobfuse will work fine.
 // However, case 2 will not work since the endpoint likely only redirects to the dfs endpoint and not the blob endpoint, so we don't know what endpoint to use when we call blob endpoints.
 // This is also a known problem with the SDKs.
+// Path style endpoints of storage emulators serve both the apis from the same url so they are used as is.
 func transformAccountEndpoint(potentialDfsEndpoint string) string {
-	if strings.Contains(potentialDfsEndpoint, ".dfs.") {
+	if isPathStyleEndpoint(potentialDfsEndpoint) {
+		return potentialDfsEndpoint
+	} else if strings.Contains(potentialDfsEndpoint, ".dfs.") {
 		return strings.Replace(potentialDfsEndpoint, ".dfs.", ".blob.", -1)
 	} else {
 		// Should we just throw here?
@@ -85,7 +89,9 @@ func transformAccountEndpoint(potentialDfsEndpoint string) string {
 func transformConfig(dlConfig AzStorageConfig) AzStorageConfig {
 	bbConfig := dlConfig
 	bbConfig.authConfig.AccountType = EAccountType.BLOCK()
-	bbConfig.authConfig.Endpoint = transformAccountEndpoint(dlConfig.authConfig.Endpoint)
+	if !dlConfig.authConfig.UsePathStyle {
+		bbConfig.authConfig.Endpoint = transformAccountEndpoint(dlConfig.authConfig.Endpoint)
+	}
 	return bbConfig
 }
 
@@ -148,8 +154,12 @@ func NewBfsPipeline(c azbfs.Credential, o azbfs.PipelineOptions, ro ste.XferRetr
 	f := []pipeline.Factory{
 		azbfs.NewTelemetryPolicyFactory(o.Telemetry),
 		azbfs.NewUniqueRequestIDPolicyFactory(),
+		newRequestTracingPolicyFactory(),
+		newRequestStatsPolicyFactory(),
 		// ste.NewBlobXferRetryPolicyFactory(ro),
 		ste.NewBFSXferRetryPolicyFactory(ro),
+		newTryStatsPolicyFactory(),
+		newTryTracingPolicyFactory(),
 	}
 	f = append(f, c)
 	f = append(f,
@@ -242,14 +252,14 @@ func (dl *Datalake) SetPrefixPath(path string) error {
 }
 
 // CreateFile : Create a new file in the filesystem/directory
-func (dl *Datalake) CreateFile(name string, mode os.FileMode) error {
+func (dl *Datalake) CreateFile(ctx context.Context, name string, mode os.FileMode) error {
 	log.Trace("Datalake::CreateFile : name %s", name)
-	err := dl.BlockBlob.CreateFile(name, mode)
+	err := dl.BlockBlob.CreateFile(ctx, name, mode)
 	if err != nil {
 		log.Err("Datalake::CreateFile : Failed to create file %s [%s]", name, err.Error())
 		return err
 	}
-	err = dl.ChangeMod(name, mode)
+	err = dl.ChangeMod(ctx, name, mode)
 	if err != nil {
 		log.Err("Datalake::CreateFile : Failed to set permissions on file %s [%s]", name, err.Error())
 		return err
@@ -259,11 +269,11 @@ func (dl *Datalake) CreateFile(name string, mode os.FileMode) error {
 }
 
 // CreateDirectory : Create a new directory in the filesystem/directory
-func (dl *Datalake) CreateDirectory(name string) error {
+func (dl *Datalake) CreateDirectory(ctx context.Context, name string) error {
 	log.Trace("Datalake::CreateDirectory : name %s", name)
 
 	directoryURL := dl.Filesystem.NewDirectoryURL(filepath.Join(dl.Config.prefixPath, name))
-	_, err := directoryURL.Create(context.Background(), false)
+	_, err := directoryURL.Create(ctx, false)
 
 	if err != nil {
 		log.Err("Datalake::CreateDirectory : Failed to create directory %s [%s]", name, err.Error())
@@ -274,17 +284,17 @@ func (dl *Datalake) CreateDirectory(name string) error {
 }
 
 // CreateLink : Create a symlink in the filesystem/directory
-func (dl *Datalake) CreateLink(source string, target string) error {
+func (dl *Datalake) CreateLink(ctx context.Context, source string, target string) error {
 	log.Trace("Datalake::CreateLink : %s -> %s", source, target)
-	return dl.BlockBlob.CreateLink(source, target)
+	return dl.BlockBlob.CreateLink(ctx, source, target)
 }
 
 // DeleteFile : Delete a file in the filesystem/directory
-func (dl *Datalake) DeleteFile(name string) (err error) {
+func (dl *Datalake) DeleteFile(ctx context.Context, name string) (err error) {
 	log.Trace("Datalake::DeleteFile : name %s", name)
 
 	fileURL := dl.Filesystem.NewRootDirectoryURL().NewFileURL(filepath.Join(dl.Config.prefixPath, name))
-	_, err = fileURL.Delete(context.Background())
+	_, err = fileURL.Delete(ctx)
 	if err != nil {
 		serr := storeDatalakeErrToErr(err)
 		if serr == ErrFileNotFound {
@@ -303,11 +313,11 @@ func (dl *Datalake) DeleteFile(name string) (err error) {
 }
 
 // DeleteDirectory : Delete a directory in the filesystem/directory
-func (dl *Datalake) DeleteDirectory(name string) (err error) {
+func (dl *Datalake) DeleteDirectory(ctx context.Context, name string) (err error) {
 	log.Trace("Datalake::DeleteDirectory : name %s", name)
 
 	directoryURL := dl.Filesystem.NewDirectoryURL(filepath.Join(dl.Config.prefixPath, name))
-	_, err = directoryURL.Delete(context.Background(), nil, true)
+	_, err = directoryURL.Delete(ctx, nil, true)
 	// TODO : There is an ability to pass a continuation token here for recursive delete, should we implement this logic to follow continuation token? The SDK does not currently do this.
 	if err != nil {
 		serr := storeDatalakeErrToErr(err)
@@ -323,13 +333,23 @@ func (dl *Datalake) DeleteDirectory(name string) (err error) {
 	return nil
 }
 
+// CopyFile : Copy a file within the filesystem, data does not leave the service
+func (dl *Datalake) CopyFile(ctx context.Context, source string, target string) error {
+	return dl.BlockBlob.CopyFile(ctx, source, target)
+}
+
+// CopyRange : Copy a range of a file into another one through the blob endpoint, data does not leave the service
+func (dl *Datalake) CopyRange(ctx context.Context, source string, srcOffset int64, target string, dstOffset int64, count int64) error {
+	return dl.BlockBlob.CopyRange(ctx, source, srcOffset, target, dstOffset, count)
+}
+
 // RenameFile : Rename the file
-func (dl *Datalake) RenameFile(source string, target string) error {
+func (dl *Datalake) RenameFile(ctx context.Context, source string, target string) error {
 	log.Trace("Datalake::RenameFile : %s -> %s", source, target)
 
 	fileURL := dl.Filesystem.NewRootDirectoryURL().NewFileURL(url.PathEscape(filepath.Join(dl.Config.prefixPath, source)))
 
-	_, err := fileURL.Rename(context.Background(),
+	_, err := fileURL.Rename(ctx,
 		azbfs.RenameFileOptions{
 			DestinationPath: filepath.Join(dl.Config.prefixPath, target),
 		})
@@ -348,12 +368,12 @@ func (dl *Datalake) RenameFile(source string, target string) error {
 }
 
 // RenameDirectory : Rename the directory
-func (dl *Datalake) RenameDirectory(source string, target string) error {
+func (dl *Datalake) RenameDirectory(ctx context.Context, source string, target string) error {
 	log.Trace("Datalake::RenameDirectory : %s -> %s", source, target)
 
 	directoryURL := dl.Filesystem.NewDirectoryURL(url.PathEscape(filepath.Join(dl.Config.prefixPath, source)))
 
-	_, err := directoryURL.Rename(context.Background(),
+	_, err := directoryURL.Rename(ctx,
 		azbfs.RenameDirectoryOptions{
 			DestinationPath: filepath.Join(dl.Config.prefixPath, target),
 		})
@@ -372,11 +392,11 @@ func (dl *Datalake) RenameDirectory(source string, target string) error {
 }
 
 // GetAttr : Retrieve attributes of the path
-func (dl *Datalake) GetAttr(name string) (attr *internal.ObjAttr, err error) {
+func (dl *Datalake) GetAttr(ctx context.Context, name string) (attr *internal.ObjAttr, err error) {
 	log.Trace("Datalake::GetAttr : name %s", name)
 
 	pathURL := dl.Filesystem.NewRootDirectoryURL().NewFileURL(filepath.Join(dl.Config.prefixPath, name))
-	prop, err := pathURL.GetProperties(context.Background())
+	prop, err := pathURL.GetProperties(ctx)
 
 	if err != nil {
 		e := storeDatalakeErrToErr(err)
@@ -411,6 +431,8 @@ func (dl *Datalake) GetAttr(name string) (attr *internal.ObjAttr, err error) {
 		Ctime:  lastModified,
 		Crtime: lastModified,
 		Flags:  internal.NewFileBitMap(),
+		MD5:    prop.ContentMD5(),
+		ETag:   prop.ETag(),
 	}
 	parseProperties(attr, prop.XMsProperties())
 	if azbfs.PathResourceDirectory == azbfs.PathResourceType(prop.XMsResourceType()) {
@@ -425,7 +447,7 @@ func (dl *Datalake) GetAttr(name string) (attr *internal.ObjAttr, err error) {
 // List : Get a list of path matching the given prefix
 // This fetches the list using a marker so the caller code should handle marker logic
 // If count=0 - fetch max entries
-func (dl *Datalake) List(prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+func (dl *Datalake) List(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
 	log.Trace("Datalake::List : prefix %s, marker %s", prefix, func(marker *string) string {
 		if marker != nil {
 			return *marker
@@ -446,7 +468,7 @@ func (dl *Datalake) List(prefix string, marker *string, count int32) ([]*interna
 	}
 
 	// Get a result segment starting with the path indicated by the current Marker.
-	listPath, err := dl.Filesystem.ListPaths(context.Background(),
+	listPath, err := dl.Filesystem.ListPaths(ctx,
 		azbfs.ListPathsFilesystemOptions{
 			Path:              &prefixPath,
 			Recursive:         false,
@@ -498,6 +520,9 @@ func (dl *Datalake) List(prefix string, marker *string, count int32) ([]*interna
 			attr.Flags = internal.NewDirBitMap()
 			attr.Mode = attr.Mode | os.ModeDir
 		}
+		if pathInfo.ETag != nil {
+			attr.ETag = *pathInfo.ETag
+		}
 
 		// Note: Datalake list paths does not return metadata/properties.
 		// To account for this and accurately return attributes when needed,
@@ -512,29 +537,69 @@ func (dl *Datalake) List(prefix string, marker *string, count int32) ([]*interna
 	return pathList, &m, nil
 }
 
+// GetVersionAttr : Versions are served by the blob endpoint for accounts with hierarchical namespace as well
+func (dl *Datalake) GetVersionAttr(ctx context.Context, name string, version string) (*internal.ObjAttr, error) {
+	return dl.BlockBlob.GetVersionAttr(ctx, name, version)
+}
+
+// ListVersions : Versions are served by the blob endpoint for accounts with hierarchical namespace as well
+func (dl *Datalake) ListVersions(ctx context.Context, name string) ([]*internal.ObjAttr, error) {
+	return dl.BlockBlob.ListVersions(ctx, name)
+}
+
+// ListDeleted : Soft deleted paths are listed by the blob endpoint for accounts with hierarchical namespace as well
+func (dl *Datalake) ListDeleted(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+	return dl.BlockBlob.ListDeleted(ctx, prefix, marker, count)
+}
+
+// Undelete : Restore a soft deleted path, for a directory this restores everything that was under it
+func (dl *Datalake) Undelete(ctx context.Context, name string) error {
+	return dl.BlockBlob.Undelete(ctx, name)
+}
+
+// RecoverRenames : Directory renames are atomic here, only journals left behind while the account was mounted as block blob exist
+func (dl *Datalake) RecoverRenames(ctx context.Context) error {
+	return dl.BlockBlob.RecoverRenames(ctx)
+}
+
 // ReadToFile : Download a file to a local file
-func (dl *Datalake) ReadToFile(name string, offset int64, count int64, fi *os.File) (err error) {
-	return dl.BlockBlob.ReadToFile(name, offset, count, fi)
+func (dl *Datalake) ReadToFile(ctx context.Context, name string, offset int64, count int64, fi *os.File) (err error) {
+	return dl.BlockBlob.ReadToFile(ctx, name, offset, count, fi)
 }
 
 // ReadBuffer : Download a specific range from a file to a buffer
-func (dl *Datalake) ReadBuffer(name string, offset int64, len int64) ([]byte, error) {
-	return dl.BlockBlob.ReadBuffer(name, offset, len)
+func (dl *Datalake) ReadBuffer(ctx context.Context, name string, offset int64, len int64) ([]byte, error) {
+	return dl.BlockBlob.ReadBuffer(ctx, name, offset, len)
 }
 
 // ReadInBuffer : Download specific range from a file to a user provided buffer
-func (dl *Datalake) ReadInBuffer(name string, offset int64, len int64, data []byte) error {
-	return dl.BlockBlob.ReadInBuffer(name, offset, len, data)
+func (dl *Datalake) ReadInBuffer(ctx context.Context, name string, offset int64, len int64, data []byte) error {
+	return dl.BlockBlob.ReadInBuffer(ctx, name, offset, len, data)
+}
+
+// ReadVersionInBuffer : Download specific range from a version or snapshot of a file to a user provided buffer
+func (dl *Datalake) ReadVersionInBuffer(ctx context.Context, name string, version string, offset int64, len int64, data []byte) error {
+	return dl.BlockBlob.ReadVersionInBuffer(ctx, name, version, offset, len, data)
 }
 
 // WriteFromFile : Upload local file to file
-func (dl *Datalake) WriteFromFile(name string, metadata map[string]string, fi *os.File) (err error) {
-	return dl.BlockBlob.WriteFromFile(name, metadata, fi)
+func (dl *Datalake) WriteFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File) (string, error) {
+	return dl.BlockBlob.WriteFromFile(ctx, name, metadata, fi)
+}
+
+// WriteFromFileIfMatch : Upload local file to file only if it still has the given etag
+func (dl *Datalake) WriteFromFileIfMatch(ctx context.Context, name string, metadata map[string]string, fi *os.File, etag string) (string, error) {
+	return dl.BlockBlob.WriteFromFileIfMatch(ctx, name, metadata, fi, etag)
+}
+
+// WriteFromReader : Upload data read from r to file, only if it still has the given etag unless it is empty
+func (dl *Datalake) WriteFromReader(ctx context.Context, name string, metadata map[string]string, r io.ReaderAt, size int64, etag string) (string, error) {
+	return dl.BlockBlob.WriteFromReader(ctx, name, metadata, r, size, etag)
 }
 
 // WriteFromBuffer : Upload from a buffer to a file
-func (dl *Datalake) WriteFromBuffer(name string, metadata map[string]string, data []byte) error {
-	return dl.BlockBlob.WriteFromBuffer(name, metadata, data)
+func (dl *Datalake) WriteFromBuffer(ctx context.Context, name string, metadata map[string]string, data []byte) error {
+	return dl.BlockBlob.WriteFromBuffer(ctx, name, metadata, data)
 }
 
 // Write : Write to a file at given offset
@@ -542,20 +607,20 @@ func (dl *Datalake) Write(options internal.WriteFileOptions) error {
 	return dl.BlockBlob.Write(options)
 }
 
-func (dl *Datalake) StageAndCommit(name string, bol *common.BlockOffsetList) error {
-	return dl.BlockBlob.StageAndCommit(name, bol)
+func (dl *Datalake) StageAndCommit(ctx context.Context, name string, bol *common.BlockOffsetList) error {
+	return dl.BlockBlob.StageAndCommit(ctx, name, bol)
 }
 
-func (dl *Datalake) GetFileBlockOffsets(name string) (*common.BlockOffsetList, error) {
-	return dl.BlockBlob.GetFileBlockOffsets(name)
+func (dl *Datalake) GetFileBlockOffsets(ctx context.Context, name string) (*common.BlockOffsetList, error) {
+	return dl.BlockBlob.GetFileBlockOffsets(ctx, name)
 }
 
-func (dl *Datalake) TruncateFile(name string, size int64) error {
-	return dl.BlockBlob.TruncateFile(name, size)
+func (dl *Datalake) TruncateFile(ctx context.Context, name string, size int64) error {
+	return dl.BlockBlob.TruncateFile(ctx, name, size)
 }
 
 // ChangeMod : Change mode of a path
-func (dl *Datalake) ChangeMod(name string, mode os.FileMode) error {
+func (dl *Datalake) ChangeMod(ctx context.Context, name string, mode os.FileMode) error {
 	log.Trace("Datalake::ChangeMod : Change mode of file %s to %s", name, mode)
 	fileURL := dl.Filesystem.NewRootDirectoryURL().NewFileURL(filepath.Join(dl.Config.prefixPath, name))
 
@@ -564,7 +629,7 @@ func (dl *Datalake) ChangeMod(name string, mode os.FileMode) error {
 		// and create new string with the username included in the string
 		// Keeping this code here so in future if its required we can get the string and manipulate
 
-		currPerm, err := fileURL.GetAccessControl(context.Background())
+		currPerm, err := fileURL.GetAccessControl(ctx)
 		e := storeDatalakeErrToErr(err)
 		if e == ErrFileNotFound {
 			return syscall.ENOENT
@@ -575,7 +640,7 @@ func (dl *Datalake) ChangeMod(name string, mode os.FileMode) error {
 	*/
 
 	newPerm := getACLPermissions(mode)
-	_, err := fileURL.SetAccessControl(context.Background(), azbfs.BlobFSAccessControl{Permissions: newPerm})
+	_, err := fileURL.SetAccessControl(ctx, azbfs.BlobFSAccessControl{Permissions: newPerm})
 	e := storeDatalakeErrToErr(err)
 	if e == ErrFileNotFound {
 		return syscall.ENOENT
@@ -588,7 +653,7 @@ func (dl *Datalake) ChangeMod(name string, mode os.FileMode) error {
 }
 
 // ChangeOwner : Change owner of a path
-func (dl *Datalake) ChangeOwner(name string, _ int, _ int) error {
+func (dl *Datalake) ChangeOwner(ctx context.Context, name string, _ int, _ int) error {
 	log.Trace("Datalake::ChangeOwner : name %s", name)
 
 	if dl.Config.ignoreAccessModifiers {
@@ -601,7 +666,7 @@ func (dl *Datalake) ChangeOwner(name string, _ int, _ int) error {
 	// fileURL := dl.Filesystem.NewRootDirectoryURL().NewFileURL(filepath.Join(dl.Config.prefixPath, name))
 	// group := strconv.Itoa(gid)
 	// owner := strconv.Itoa(uid)
-	// _, err := fileURL.SetAccessControl(context.Background(), azbfs.BlobFSAccessControl{Group: group, Owner: owner})
+	// _, err := fileURL.SetAccessControl(ctx, azbfs.BlobFSAccessControl{Group: group, Owner: owner})
 	// e := storeDatalakeErrToErr(err)
 	// if e == ErrFileNotFound {
 	// 	return syscall.ENOENT
@@ -611,3 +676,49 @@ func (dl *Datalake) ChangeOwner(name string, _ int, _ int) error {
 	// }
 	return syscall.ENOTSUP
 }
+
+// SetMetadata : Replace the user defined metadata of a path.
+// Path properties of a hierarchical namespace account are the blob metadata, so the blob endpoint serves files and directories alike.
+func (dl *Datalake) SetMetadata(ctx context.Context, name string, metadata map[string]string, etag string) error {
+	return dl.BlockBlob.SetMetadata(ctx, name, metadata, etag)
+}
+
+// AcquireLease : Take a lease on a file, the blob endpoint serves leases for hierarchical namespace accounts as well
+func (dl *Datalake) AcquireLease(ctx context.Context, name string, leaseID string, duration int32) error {
+	return dl.BlockBlob.AcquireLease(ctx, name, leaseID, duration)
+}
+
+// RenewLease : Extend a lease held by this mount
+func (dl *Datalake) RenewLease(ctx context.Context, name string, leaseID string) error {
+	return dl.BlockBlob.RenewLease(ctx, name, leaseID)
+}
+
+// ReleaseLease : Give up a lease held by this mount
+func (dl *Datalake) ReleaseLease(ctx context.Context, name string, leaseID string) error {
+	return dl.BlockBlob.ReleaseLease(ctx, name, leaseID)
+}
+
+// CreateFileIfNotExists : Create an empty file unless it exists already
+func (dl *Datalake) CreateFileIfNotExists(ctx context.Context, name string) error {
+	return dl.BlockBlob.CreateFileIfNotExists(ctx, name)
+}
+
+// GetTier : Get the access tier of a file and its rehydration status
+func (dl *Datalake) GetTier(ctx context.Context, name string) (string, string, error) {
+	return dl.BlockBlob.GetTier(ctx, name)
+}
+
+// SetTier : Move a file to the given access tier
+func (dl *Datalake) SetTier(ctx context.Context, name string, tier string) error {
+	return dl.BlockBlob.SetTier(ctx, name, tier)
+}
+
+// GetTags : Blob index tags are not available on accounts with hierarchical namespace
+func (dl *Datalake) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	return nil, syscall.ENOTSUP
+}
+
+// SetTags : Blob index tags are not available on accounts with hierarchical namespace
+func (dl *Datalake) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	return syscall.ENOTSUP
+}
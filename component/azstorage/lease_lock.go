@@ -0,0 +1,327 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+)
+
+// Duration of the lease backing an exclusive lock, the service accepts 15 to 60 seconds
+const (
+	defaultLeaseDuration = 30
+	minLeaseDuration     = 15
+	maxLeaseDuration     = 60
+)
+
+// Interval at which a lock request waiting for another holder is retried
+const lockRetryInterval = time.Second
+
+// fileLock : locks held on one file through handles of this mount.
+// Its mutex serialises lock changes of the file and is held across the lease requests they make,
+// so that a slow request to storage only holds up the file it is for.
+type fileLock struct {
+	sync.Mutex
+	refs      int               // requests working on the entry, it is dropped once unused and nothing is locked
+	exclusive *handlemap.Handle // handle holding the exclusive lock, nil if there is none
+	leaseID   string            // lease on the blob backing the exclusive lock
+	shared    map[*handlemap.Handle]bool
+}
+
+// leaseLocker : Maps flock and fcntl locks on to blob leases.
+// An exclusive lock holds a lease on the blob so that other mounts can neither lock nor update it till the lock is released.
+// Shared locks do not have a lease to map to, those only exclude exclusive locks taken through this mount.
+type leaseLocker struct {
+	sync.Mutex // guards the map only, never held while talking to storage
+	storage    AzConnection
+	duration   int32
+	files      map[string]*fileLock
+
+	stop chan bool
+	wg   sync.WaitGroup
+}
+
+func newLeaseLocker(storage AzConnection, duration int32) *leaseLocker {
+	return &leaseLocker{
+		storage:  storage,
+		duration: duration,
+		files:    make(map[string]*fileLock),
+		stop:     make(chan bool),
+	}
+}
+
+// start : begin renewing the leases held by this mount
+func (l *leaseLocker) start() {
+	l.wg.Add(1)
+	go l.renewWorker()
+}
+
+// close : stop renewing and release every lease so that other mounts do not have to wait for them to expire
+func (l *leaseLocker) close() {
+	close(l.stop)
+	l.wg.Wait()
+
+	for name, fl := range l.held() {
+		fl.Lock()
+		if fl.exclusive != nil {
+			l.release(name, fl)
+		}
+		fl.Unlock()
+		l.put(name, fl)
+	}
+
+	l.Lock()
+	l.files = make(map[string]*fileLock)
+	l.Unlock()
+}
+
+// lock : apply a lock request, a blocking request is retried till the lock is granted or the caller gives up
+func (l *leaseLocker) lock(options internal.LockFileOptions) error {
+	ctx := requestContext(options.Ctx)
+
+	for {
+		err := l.tryLock(options)
+		if err != syscall.EWOULDBLOCK || !options.Wait || options.Test {
+			return err
+		}
+
+		if options.Interrupted != nil && options.Interrupted() {
+			log.Debug("leaseLocker::lock : Wait for lock on %s interrupted", options.Handle.Path)
+			return syscall.EINTR
+		}
+
+		select {
+		case <-ctx.Done():
+			return syscall.EINTR
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// get : entry of the file with a reference held on it, created if asked for
+func (l *leaseLocker) get(name string, create bool) *fileLock {
+	l.Lock()
+	defer l.Unlock()
+
+	fl, found := l.files[name]
+	if !found {
+		if !create {
+			return nil
+		}
+		fl = &fileLock{shared: make(map[*handlemap.Handle]bool)}
+		l.files[name] = fl
+	}
+	fl.refs++
+	return fl
+}
+
+// put : drop the reference taken by get, the entry goes once no one works on it and it holds no lock
+func (l *leaseLocker) put(name string, fl *fileLock) {
+	l.Lock()
+	defer l.Unlock()
+
+	fl.refs--
+	if fl.refs == 0 && fl.exclusive == nil && len(fl.shared) == 0 && l.files[name] == fl {
+		delete(l.files, name)
+	}
+}
+
+// held : entries of every file locked through this mount, with a reference held on each
+func (l *leaseLocker) held() map[string]*fileLock {
+	l.Lock()
+	defer l.Unlock()
+
+	files := make(map[string]*fileLock, len(l.files))
+	for name, fl := range l.files {
+		fl.refs++
+		files[name] = fl
+	}
+	return files
+}
+
+// tryLock : apply a lock request once, fails with EWOULDBLOCK if the lock is held by someone else
+func (l *leaseLocker) tryLock(options internal.LockFileOptions) error {
+	name := options.Handle.Path
+	handle := options.Handle
+	ctx := requestContext(options.Ctx)
+
+	fl := l.get(name, options.Type != internal.LockUnlock)
+	if fl == nil {
+		return nil
+	}
+	defer l.put(name, fl)
+
+	fl.Lock()
+	defer fl.Unlock()
+
+	switch options.Type {
+	case internal.LockUnlock:
+		l.unlock(name, fl, handle)
+		return nil
+
+	case internal.LockShared:
+		if fl.exclusive != nil && fl.exclusive != handle {
+			return syscall.EWOULDBLOCK
+		}
+		if options.Test {
+			return nil
+		}
+
+		// Lock of this handle turns from exclusive to shared, other mounts may lock the file again
+		if fl.exclusive == handle {
+			l.release(name, fl)
+		}
+		fl.shared[handle] = true
+
+	case internal.LockExclusive:
+		if fl.exclusive == handle {
+			return nil
+		}
+		if fl.exclusive != nil {
+			return syscall.EWOULDBLOCK
+		}
+		for holder := range fl.shared {
+			if holder != handle {
+				return syscall.EWOULDBLOCK
+			}
+		}
+
+		leaseID := common.NewUUID().String()
+		err := l.storage.AcquireLease(ctx, name, leaseID, l.duration)
+		if err == syscall.ENOENT {
+			if options.Test {
+				// No one can hold a lease on a blob which does not exist
+				return nil
+			}
+
+			// File created through this mount may not be uploaded yet, an empty blob takes its place to carry the lease
+			err = l.storage.CreateFileIfNotExists(ctx, name)
+			if err == nil {
+				err = l.storage.AcquireLease(ctx, name, leaseID, l.duration)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if options.Test {
+			_ = l.storage.ReleaseLease(ctx, name, leaseID)
+			return nil
+		}
+
+		log.Debug("leaseLocker::tryLock : Exclusive lock on %s backed by lease %s", name, leaseID)
+		fl.exclusive = handle
+		fl.leaseID = leaseID
+		delete(fl.shared, handle)
+
+	default:
+		return syscall.EINVAL
+	}
+
+	return nil
+}
+
+// unlockHandle : drop every lock held through the handle, called when it is closed
+func (l *leaseLocker) unlockHandle(handle *handlemap.Handle) {
+	fl := l.get(handle.Path, false)
+	if fl == nil {
+		return
+	}
+	defer l.put(handle.Path, fl)
+
+	fl.Lock()
+	defer fl.Unlock()
+	l.unlock(handle.Path, fl, handle)
+}
+
+// unlock : drop the lock of the handle on the file, caller shall hold the lock of the file
+func (l *leaseLocker) unlock(name string, fl *fileLock, handle *handlemap.Handle) {
+	delete(fl.shared, handle)
+	if fl.exclusive == handle {
+		l.release(name, fl)
+	}
+}
+
+// release : give up the lease backing the exclusive lock, caller shall hold the lock of the file
+func (l *leaseLocker) release(name string, fl *fileLock) {
+	err := l.storage.ReleaseLease(context.Background(), name, fl.leaseID)
+	if err != nil {
+		// Lease expires on its own, other mounts only have to wait till then
+		log.Err("leaseLocker::release : Failed to release lease on %s [%s]", name, err.Error())
+	}
+	fl.exclusive = nil
+	fl.leaseID = ""
+}
+
+// renewWorker : keep the leases alive while their locks are held
+func (l *leaseLocker) renewWorker() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(l.duration) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+// renew : extend every lease held by this mount
+func (l *leaseLocker) renew() {
+	for name, fl := range l.held() {
+		fl.Lock()
+		if fl.exclusive != nil {
+			err := l.storage.RenewLease(context.Background(), name, fl.leaseID)
+			if err != nil {
+				// Lease has expired and may be with someone else by now, the lock is gone and writes will fail
+				log.Err("leaseLocker::renew : Lost the lock on %s [%s]", name, err.Error())
+				fl.exclusive = nil
+				fl.leaseID = ""
+			}
+		}
+		fl.Unlock()
+		l.put(name, fl)
+	}
+}
@@ -0,0 +1,1522 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Default permissions assigned by a hierarchical namespace account to new paths
+const (
+	memoryDefaultFileMode os.FileMode = 0644
+	memoryDefaultDirMode  os.FileMode = 0755
+)
+
+// memoryBlock : a committed block of a block blob
+type memoryBlock struct {
+	id   string
+	data []byte
+}
+
+// memoryBlob : a blob, or a directory when the namespace is hierarchical
+type memoryBlob struct {
+	data     []byte
+	blocks   []memoryBlock // committed block list, empty for blobs uploaded in one shot
+	metadata map[string]string
+	mode     os.FileMode
+	isDir    bool
+	mtime    time.Time
+	crtime   time.Time
+	md5      []byte
+	etag     string
+	tier     string
+	tags     map[string]string
+	version  string // version id, assigned only when versioning is enabled
+
+	leaseID       string // lease taken on the blob, by this or any other client
+	leaseDuration time.Duration
+	leaseExpiry   time.Time
+}
+
+// MemoryStore : in process implementation of AzConnection for testing without a storage account.
+// With hierarchical namespace disabled it behaves like a block blob container where directories are
+// either marker blobs or just prefixes, with it enabled directories are real entries like in ADLS Gen2.
+type MemoryStore struct {
+	AzStorageConnection
+	sync.RWMutex
+	hns    bool
+	blobs  map[string]*memoryBlob
+	staged map[string]map[string][]byte
+	seq    uint64 // source of etags, bumped on every modification
+
+	versioning  bool
+	versions    map[string][]*memoryBlob // previous versions of each blob, oldest first
+	lastVersion time.Time
+
+	softDelete bool
+	deleted    map[string]*memoryBlob // last deleted state of each path
+
+	leases map[string]string // lease ids this client presents on updates, like the ones held by BlockBlob
+}
+
+// Verify that MemoryStore implements AzConnection interface
+var _ AzConnection = &MemoryStore{}
+
+func (ms *MemoryStore) Configure(cfg AzStorageConfig) error {
+	ms.Config = cfg
+	ms.hns = cfg.memoryHNS
+	ms.versioning = cfg.memoryVersioning
+	ms.blobs = make(map[string]*memoryBlob)
+	ms.staged = make(map[string]map[string][]byte)
+	ms.versions = make(map[string][]*memoryBlob)
+	ms.softDelete = cfg.memorySoftDelete
+	ms.deleted = make(map[string]*memoryBlob)
+	ms.leases = make(map[string]string)
+	return nil
+}
+
+// For dynamic config update the config here
+func (ms *MemoryStore) UpdateConfig(cfg AzStorageConfig) error {
+	ms.Config.blockSize = cfg.blockSize
+	ms.Config.maxConcurrency = cfg.maxConcurrency
+	ms.Config.defaultTier = cfg.defaultTier
+	ms.Config.ignoreAccessModifiers = cfg.ignoreAccessModifiers
+	ms.Config.renameWorkers = cfg.renameWorkers
+	return nil
+}
+
+// NewCredentialKey : There are no credentials to update
+func (ms *MemoryStore) NewCredentialKey(_, _ string) error {
+	return nil
+}
+
+// SetupPipeline : There is no pipeline to setup
+func (ms *MemoryStore) SetupPipeline() error {
+	log.Trace("MemoryStore::SetupPipeline : Setting up")
+	return nil
+}
+
+// TestPipeline : There are no credentials to validate
+func (ms *MemoryStore) TestPipeline() error {
+	log.Trace("MemoryStore::TestPipeline : Validating")
+	return nil
+}
+
+func (ms *MemoryStore) ListContainers() ([]string, error) {
+	log.Trace("MemoryStore::ListContainers : Listing containers")
+	return []string{ms.Config.container}, nil
+}
+
+func (ms *MemoryStore) SetPrefixPath(path string) error {
+	log.Trace("MemoryStore::SetPrefixPath : path %s", path)
+	ms.Config.prefixPath = path
+	return nil
+}
+
+// key : name of the blob in the container for the given path
+func (ms *MemoryStore) key(name string) string {
+	return internal.TruncateDirName(filepath.Join(ms.Config.prefixPath, name))
+}
+
+// createParents : hierarchical namespace implicitly creates all missing parent directories of a path.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) createParents(key string) {
+	if !ms.hns {
+		return
+	}
+
+	now := time.Now()
+	for dir := filepath.Dir(key); dir != "." && dir != "/" && dir != ""; dir = filepath.Dir(dir) {
+		if _, found := ms.blobs[dir]; found {
+			break
+		}
+		ms.blobs[dir] = &memoryBlob{
+			metadata: make(map[string]string),
+			mode:     memoryDefaultDirMode,
+			isDir:    true,
+			mtime:    now,
+			crtime:   now,
+			etag:     ms.newETag(),
+		}
+	}
+}
+
+// newETag : generate an etag for a blob being created or modified.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) newETag() string {
+	ms.seq++
+	return fmt.Sprintf("\"0x%X\"", ms.seq)
+}
+
+// newVersionID : generate a version id for a blob being created or modified, in the timestamp format used by the service.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) newVersionID() string {
+	if !ms.versioning {
+		return ""
+	}
+
+	// Service timestamps have a resolution of 100ns, ids have to be unique even if they are generated within that
+	now := time.Now().UTC().Truncate(100 * time.Nanosecond)
+	if !now.After(ms.lastVersion) {
+		now = ms.lastVersion.Add(100 * time.Nanosecond)
+	}
+	ms.lastVersion = now
+	return now.Format("2006-01-02T15:04:05.0000000Z")
+}
+
+// keepVersion : with versioning enabled retain the current state of a blob before it is modified or deleted.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) keepVersion(key string) {
+	blob, found := ms.blobs[key]
+	if !ms.versioning || !found || blob.isDir {
+		return
+	}
+
+	version := *blob
+	ms.versions[key] = append(ms.versions[key], &version)
+}
+
+// keepDeleted : with soft delete enabled retain a path which is about to be deleted.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) keepDeleted(key string) {
+	if blob, found := ms.blobs[key]; ms.softDelete && found {
+		deleted := *blob
+		ms.deleted[key] = &deleted
+	}
+}
+
+// defaultTier : tier assigned to a blob on upload
+func (ms *MemoryStore) defaultTier() string {
+	if ms.Config.defaultTier == azblob.AccessTierNone {
+		return string(azblob.AccessTierHot)
+	}
+	return string(ms.Config.defaultTier)
+}
+
+// put : store a blob uploaded in one shot, this replaces the data, block list and metadata of an existing blob.
+// Caller shall hold the write lock.
+func (ms *MemoryStore) put(key string, metadata map[string]string, data []byte) {
+	now := time.Now()
+	blob := &memoryBlob{
+		data:     make([]byte, len(data)),
+		metadata: make(map[string]string),
+		mode:     memoryDefaultFileMode,
+		mtime:    now,
+		crtime:   now,
+		etag:     ms.newETag(),
+		tier:     ms.defaultTier(),
+	}
+	copy(blob.data, data)
+
+	for k, v := range metadata {
+		blob.metadata[k] = v
+	}
+
+	if old, found := ms.blobs[key]; found {
+		blob.crtime = old.crtime
+		blob.mode = old.mode
+		blob.leaseID = old.leaseID
+		blob.leaseDuration = old.leaseDuration
+		blob.leaseExpiry = old.leaseExpiry
+	}
+
+	// Service computes the md5 only for blobs which are uploaded in one shot
+	if int64(len(data)) > azblob.BlockBlobMaxUploadBlobBytes {
+		blockSize := ms.Config.blockSize
+		if blockSize == 0 {
+			blockSize = azblob.BlockBlobMaxStageBlockBytes
+		}
+		for offset := int64(0); offset < int64(len(data)); offset += blockSize {
+			end := offset + blockSize
+			if end > int64(len(data)) {
+				end = int64(len(data))
+			}
+			blob.blocks = append(blob.blocks, memoryBlock{
+				id:   base64.StdEncoding.EncodeToString(common.NewUUIDWithLength(16)),
+				data: blob.data[offset:end],
+			})
+		}
+	} else {
+		sum := md5.Sum(blob.data)
+		blob.md5 = sum[:]
+	}
+
+	ms.keepVersion(key)
+	blob.version = ms.newVersionID()
+
+	ms.createParents(key)
+	ms.blobs[key] = blob
+	delete(ms.staged, key)
+}
+
+// attr : convert a stored blob to attributes the way the respective service would report them
+func (ms *MemoryStore) attr(key string, blob *memoryBlob) *internal.ObjAttr {
+	attr := &internal.ObjAttr{
+		Path:   split(ms.Config.prefixPath, key),
+		Name:   filepath.Base(key),
+		Size:   int64(len(blob.data)),
+		Mtime:  blob.mtime,
+		Atime:  blob.mtime,
+		Ctime:  blob.mtime,
+		Crtime: blob.crtime,
+		Flags:  internal.NewFileBitMap(),
+		MD5:    blob.md5,
+		ETag:   blob.etag,
+	}
+
+	metadata := make(map[string]string)
+	for k, v := range blob.metadata {
+		metadata[k] = v
+	}
+	parseMetadata(attr, metadata)
+
+	if ms.hns {
+		attr.Mode = attr.Mode | blob.mode
+		if blob.isDir {
+			attr.Flags = internal.NewDirBitMap()
+			attr.Mode = attr.Mode | os.ModeDir
+		}
+	} else {
+		// Since block blob does not support acls, we set mode to 0 and FlagModeDefault to true so the fuse layer can return the default permission.
+		attr.Flags.Set(internal.PropFlagModeDefault)
+	}
+	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+
+	return attr
+}
+
+// virtualDirAttr : attributes of a directory which exists only as a prefix of other blobs
+func (ms *MemoryStore) virtualDirAttr(key string) *internal.ObjAttr {
+	attr := &internal.ObjAttr{
+		Path:  split(ms.Config.prefixPath, key),
+		Name:  filepath.Base(key),
+		Size:  4096,
+		Mode:  os.ModeDir,
+		Mtime: time.Now(),
+		Flags: internal.NewDirBitMap(),
+	}
+	attr.Atime = attr.Mtime
+	attr.Crtime = attr.Mtime
+	attr.Ctime = attr.Mtime
+	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+	attr.Flags.Set(internal.PropFlagModeDefault)
+	return attr
+}
+
+// hasChildren : check whether any blob exists under the given directory. Caller shall hold the lock.
+func (ms *MemoryStore) hasChildren(key string) bool {
+	prefix := key + "/"
+	for k := range ms.blobs {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateFile : Create a new file in the container/virtual directory
+func (ms *MemoryStore) CreateFile(ctx context.Context, name string, mode os.FileMode) error {
+	log.Trace("MemoryStore::CreateFile : name %s", name)
+	err := ms.WriteFromBuffer(ctx, name, nil, []byte{})
+	if err != nil {
+		return err
+	}
+
+	if ms.hns {
+		return ms.ChangeMod(ctx, name, mode)
+	}
+	return nil
+}
+
+// CreateDirectory : Create a new directory in the container/virtual directory
+func (ms *MemoryStore) CreateDirectory(ctx context.Context, name string) error {
+	log.Trace("MemoryStore::CreateDirectory : name %s", name)
+
+	if !ms.hns {
+		return ms.WriteFromBuffer(ctx, name, map[string]string{folderKey: "true"}, []byte{})
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	if _, found := ms.blobs[key]; found {
+		log.Err("MemoryStore::CreateDirectory : %s already exists", name)
+		return syscall.EEXIST
+	}
+
+	now := time.Now()
+	ms.createParents(key)
+	ms.blobs[key] = &memoryBlob{
+		metadata: make(map[string]string),
+		mode:     memoryDefaultDirMode,
+		isDir:    true,
+		mtime:    now,
+		crtime:   now,
+		etag:     ms.newETag(),
+	}
+	return nil
+}
+
+// CreateLink : Create a symlink in the container/virtual directory
+func (ms *MemoryStore) CreateLink(ctx context.Context, source string, target string) error {
+	log.Trace("MemoryStore::CreateLink : %s -> %s", source, target)
+	return ms.WriteFromBuffer(ctx, source, map[string]string{symlinkKey: "true"}, []byte(target))
+}
+
+// DeleteFile : Delete a blob in the container/virtual directory
+func (ms *MemoryStore) DeleteFile(ctx context.Context, name string) error {
+	log.Trace("MemoryStore::DeleteFile : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	if _, found := ms.blobs[key]; !found {
+		log.Err("MemoryStore::DeleteFile : %s does not exist", name)
+		return syscall.ENOENT
+	}
+
+	if ms.leasedByOther(key) {
+		log.Err("MemoryStore::DeleteFile : %s is under lease", name)
+		return syscall.EIO
+	}
+	delete(ms.leases, key)
+
+	ms.keepVersion(key)
+	ms.keepDeleted(key)
+	delete(ms.blobs, key)
+	delete(ms.staged, key)
+	return nil
+}
+
+// DeleteDirectory : Delete a directory and everything under it
+func (ms *MemoryStore) DeleteDirectory(ctx context.Context, name string) error {
+	log.Trace("MemoryStore::DeleteDirectory : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	if _, found := ms.blobs[key]; !found && ms.hns {
+		log.Err("MemoryStore::DeleteDirectory : %s does not exist", name)
+		return syscall.ENOENT
+	}
+
+	prefix := key + "/"
+	for k := range ms.blobs {
+		if strings.HasPrefix(k, prefix) {
+			ms.keepVersion(k)
+			ms.keepDeleted(k)
+			delete(ms.blobs, k)
+			delete(ms.staged, k)
+		}
+	}
+
+	// Flat namespace deletes the children one by one and fails at the end if there was no marker blob
+	if _, found := ms.blobs[key]; !found {
+		log.Err("MemoryStore::DeleteDirectory : %s does not exist", name)
+		return syscall.ENOENT
+	}
+	ms.keepDeleted(key)
+	delete(ms.blobs, key)
+	return nil
+}
+
+// move : move a single blob to a new key. Caller shall hold the write lock.
+func (ms *MemoryStore) move(src string, dst string) {
+	// Flat namespace renames by copy and delete, so both source and a replaced target leave a version behind
+	ms.keepVersion(src)
+	ms.keepVersion(dst)
+	if !ms.hns {
+		ms.keepDeleted(src)
+	}
+
+	blob := ms.blobs[src]
+	delete(ms.blobs, src)
+	delete(ms.staged, src)
+	if !blob.isDir {
+		blob.version = ms.newVersionID()
+	}
+	ms.createParents(dst)
+	ms.blobs[dst] = blob
+}
+
+// RenameFile : Rename the file
+func (ms *MemoryStore) RenameFile(ctx context.Context, source string, target string) error {
+	log.Trace("MemoryStore::RenameFile : %s -> %s", source, target)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	src := ms.key(source)
+	if _, found := ms.blobs[src]; !found {
+		log.Err("MemoryStore::RenameFile : %s does not exist", source)
+		return syscall.ENOENT
+	}
+
+	ms.move(src, ms.key(target))
+	return nil
+}
+
+// CopyFile : Copy the data and metadata of a blob to a new name
+func (ms *MemoryStore) CopyFile(ctx context.Context, source string, target string) error {
+	log.Trace("MemoryStore::CopyFile : %s -> %s", source, target)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	blob, found := ms.blobs[ms.key(source)]
+	if !found || blob.isDir {
+		log.Err("MemoryStore::CopyFile : %s does not exist", source)
+		return syscall.ENOENT
+	}
+
+	ms.put(ms.key(target), blob.metadata, blob.data)
+	return nil
+}
+
+// CopyRange : Copy a range of a blob into another one, a gap past the end of the target is filled with zeros
+func (ms *MemoryStore) CopyRange(ctx context.Context, source string, srcOffset int64, target string, dstOffset int64, count int64) error {
+	log.Trace("MemoryStore::CopyRange : %s offset %d -> %s offset %d, count %d", source, srcOffset, target, dstOffset, count)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	src, found := ms.blobs[ms.key(source)]
+	if !found || src.isDir {
+		log.Err("MemoryStore::CopyRange : %s does not exist", source)
+		return syscall.ENOENT
+	} else if srcOffset+count > int64(len(src.data)) {
+		log.Err("MemoryStore::CopyRange : Range %d+%d is past the end of %s", srcOffset, count, source)
+		return syscall.EINVAL
+	}
+
+	key := ms.key(target)
+	if ms.leasedByOther(key) {
+		log.Err("MemoryStore::CopyRange : %s is under a lease, can not update file", target)
+		return syscall.EIO
+	}
+
+	var data []byte
+	var metadata map[string]string
+	if dst, found := ms.blobs[key]; found {
+		data = dst.data
+		metadata = dst.metadata
+	}
+	if end := dstOffset + count; end > int64(len(data)) {
+		grown := make([]byte, end)
+		copy(grown, data)
+		data = grown
+	} else {
+		data = append([]byte{}, data...)
+	}
+	copy(data[dstOffset:], src.data[srcOffset:srcOffset+count])
+
+	ms.put(key, metadata, data)
+	return nil
+}
+
+// RenameDirectory : Rename the directory, flat namespace moves blob by blob the same way block blob accounts do
+func (ms *MemoryStore) RenameDirectory(ctx context.Context, source string, target string) error {
+	log.Trace("MemoryStore::RenameDirectory : %s -> %s", source, target)
+
+	if !ms.hns {
+		return newDirRenamer(ms, ms.Config).rename(ctx, source, target)
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	src := ms.key(source)
+	dst := ms.key(target)
+	if _, found := ms.blobs[src]; !found {
+		log.Err("MemoryStore::RenameDirectory : %s does not exist", source)
+		return syscall.ENOENT
+	}
+
+	prefix := src + "/"
+	children := make([]string, 0)
+	for k := range ms.blobs {
+		if strings.HasPrefix(k, prefix) {
+			children = append(children, k)
+		}
+	}
+	for _, k := range children {
+		ms.move(k, dst+"/"+strings.TrimPrefix(k, prefix))
+	}
+	ms.move(src, dst)
+	return nil
+}
+
+// RecoverRenames : Resume or roll back directory renames found in the journal, if one is configured
+func (ms *MemoryStore) RecoverRenames(ctx context.Context) error {
+	return newDirRenamer(ms, ms.Config).recover(ctx)
+}
+
+// listTree : List names of all blobs under the directory
+func (ms *MemoryStore) listTree(ctx context.Context, dir string, marker *string) ([]string, *string, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	prefix := ms.key(dir) + "/"
+	start := ""
+	if marker != nil {
+		start = *marker
+	}
+
+	keys := make([]string, 0)
+	for k := range ms.blobs {
+		if strings.HasPrefix(k, prefix) && k > start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var next *string = nil
+	if len(keys) > common.MaxDirListCount {
+		keys = keys[:common.MaxDirListCount]
+		next = &keys[len(keys)-1]
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, split(ms.Config.prefixPath, k))
+	}
+	return names, next, nil
+}
+
+// allVersions : previous versions of a blob followed by its current version. Caller shall hold the read lock.
+func (ms *MemoryStore) allVersions(key string) []*memoryBlob {
+	versions := ms.versions[key]
+	if blob, found := ms.blobs[key]; found && blob.version != "" {
+		versions = append(versions[:len(versions):len(versions)], blob)
+	}
+	return versions
+}
+
+// ListVersions : List all versions of a blob including its current version, snapshots are not supported
+func (ms *MemoryStore) ListVersions(ctx context.Context, name string) ([]*internal.ObjAttr, error) {
+	log.Trace("MemoryStore::ListVersions : name %s", name)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	key := ms.key(name)
+	versions := make([]*internal.ObjAttr, 0)
+	for _, blob := range ms.allVersions(key) {
+		attr := ms.attr(key, blob)
+		attr.Path = name
+		attr.Name = blob.version
+		versions = append(versions, attr)
+	}
+	return versions, nil
+}
+
+// GetVersionAttr : Get the attributes of one version of a blob
+func (ms *MemoryStore) GetVersionAttr(ctx context.Context, name string, version string) (*internal.ObjAttr, error) {
+	log.Trace("MemoryStore::GetVersionAttr : name %s, version %s", name, version)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	key := ms.key(name)
+	for _, blob := range ms.allVersions(key) {
+		if blob.version == version {
+			attr := ms.attr(key, blob)
+			attr.Path = name
+			attr.Name = version
+			return attr, nil
+		}
+	}
+	return nil, syscall.ENOENT
+}
+
+// ListDeleted : List deleted paths at one level of the hierarchy, deeper paths are collapsed to their directory
+func (ms *MemoryStore) ListDeleted(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+	log.Trace("MemoryStore::ListDeleted : prefix %s", prefix)
+
+	blobList := make([]*internal.ObjAttr, 0)
+	done := ""
+
+	if count == 0 {
+		count = common.MaxDirListCount
+	}
+
+	listPath := filepath.Join(ms.Config.prefixPath, prefix)
+	if (prefix != "" && prefix[len(prefix)-1] == '/') || (prefix == "" && ms.Config.prefixPath != "") {
+		listPath += "/"
+	}
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	names := make(map[string]bool)
+	for k := range ms.deleted {
+		if !strings.HasPrefix(k, listPath) {
+			continue
+		}
+
+		rest := k[len(listPath):]
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			names[listPath+rest[:idx]] = true
+		} else {
+			names[k] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		if marker == nil || *marker == "" || k > *marker {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	for i, k := range sorted {
+		if int32(i) >= count {
+			next := sorted[i-1]
+			return blobList, &next, nil
+		}
+
+		blob, found := ms.deleted[k]
+		if !found {
+			blobList = append(blobList, ms.virtualDirAttr(k))
+			continue
+		}
+
+		attr := ms.attr(k, blob)
+		if attr.IsDir() {
+			attr.Size = 4096
+		}
+		blobList = append(blobList, attr)
+	}
+
+	return blobList, &done, nil
+}
+
+// Undelete : Restore a deleted path, a path which exists again keeps its current state
+func (ms *MemoryStore) Undelete(ctx context.Context, name string) error {
+	log.Trace("MemoryStore::Undelete : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	blob, found := ms.deleted[key]
+	if !found {
+		return syscall.ENOENT
+	}
+
+	delete(ms.deleted, key)
+	if _, found = ms.blobs[key]; !found {
+		ms.createParents(key)
+		ms.blobs[key] = blob
+	}
+	return nil
+}
+
+// GetAttr : Retrieve attributes of the blob
+func (ms *MemoryStore) GetAttr(ctx context.Context, name string) (*internal.ObjAttr, error) {
+	log.Trace("MemoryStore::GetAttr : name %s", name)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	key := ms.key(name)
+	blob, found := ms.blobs[key]
+	if found {
+		return ms.attr(key, blob), nil
+	}
+
+	// To support virtual directories with no marker blob, block blob lists the parent instead of reading properties
+	if !ms.hns && ms.Config.virtualDirectory && ms.hasChildren(key) {
+		return ms.virtualDirAttr(key), nil
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// List : Get a list of blobs matching the given prefix
+// This fetches the list using a marker so the caller code should handle marker logic
+// If count=0 - fetch max entries
+func (ms *MemoryStore) List(ctx context.Context, prefix string, marker *string, count int32) ([]*internal.ObjAttr, *string, error) {
+	log.Trace("MemoryStore::List : prefix %s, marker %s", prefix, func(marker *string) string {
+		if marker != nil {
+			return *marker
+		} else {
+			return ""
+		}
+	}(marker))
+
+	blobList := make([]*internal.ObjAttr, 0)
+	done := ""
+
+	if count == 0 {
+		count = common.MaxDirListCount
+	}
+
+	listPath := filepath.Join(ms.Config.prefixPath, prefix)
+	if (prefix != "" && prefix[len(prefix)-1] == '/') || (prefix == "" && ms.Config.prefixPath != "") {
+		listPath += "/"
+	}
+	if ms.hns && listPath != "" && !strings.HasSuffix(listPath, "/") {
+		// Datalake always lists the contents of the directory
+		listPath += "/"
+	}
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	// Hierarchical namespace lists only existing directories, listing a missing one fails
+	if ms.hns && strings.HasSuffix(listPath, "/") && listPath != "/" {
+		dir, found := ms.blobs[strings.TrimSuffix(listPath, "/")]
+		if !found || !dir.isDir {
+			log.Err("MemoryStore::List : %s does not exist", prefix)
+			return blobList, &done, syscall.ENOENT
+		}
+	}
+
+	// Collect the items directly at this level, deeper paths are collapsed to their directory
+	names := make(map[string]bool)
+	for k := range ms.blobs {
+		if !strings.HasPrefix(k, listPath) {
+			continue
+		}
+
+		rest := k[len(listPath):]
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			names[listPath+rest[:idx]] = true
+		} else {
+			names[k] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		if marker == nil || *marker == "" || k > *marker {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	for i, k := range sorted {
+		if int32(i) >= count {
+			next := sorted[i-1]
+			return blobList, &next, nil
+		}
+
+		blob, found := ms.blobs[k]
+		if !found {
+			blobList = append(blobList, ms.virtualDirAttr(k))
+			continue
+		}
+
+		attr := ms.attr(k, blob)
+		if ms.hns {
+			// Datalake list paths does not return metadata
+			attr.Metadata = nil
+			attr.Flags.Clear(internal.PropFlagMetadataRetrieved)
+		} else if attr.IsDir() {
+			attr.Size = 4096
+		}
+		blobList = append(blobList, attr)
+	}
+
+	return blobList, &done, nil
+}
+
+// read : get a range of data of a blob, count 0 reads till the end
+func (ms *MemoryStore) read(name string, offset int64, count int64) ([]byte, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found {
+		return nil, syscall.ENOENT
+	}
+	return readBlob(blob, offset, count)
+}
+
+// readBlob : copy a range of data out of a blob or one of its versions. Caller shall hold the read lock.
+func readBlob(blob *memoryBlob, offset int64, count int64) ([]byte, error) {
+	size := int64(len(blob.data))
+	if offset < 0 || (offset >= size && !(offset == 0 && size == 0)) {
+		return nil, syscall.ERANGE
+	}
+
+	end := size
+	if count > 0 && offset+count < size {
+		end = offset + count
+	}
+
+	data := make([]byte, end-offset)
+	copy(data, blob.data[offset:end])
+	return data, nil
+}
+
+// ReadToFile : Download a blob to a local file
+func (ms *MemoryStore) ReadToFile(ctx context.Context, name string, offset int64, count int64, fi *os.File) error {
+	log.Trace("MemoryStore::ReadToFile : name %s, offset : %d, count %d", name, offset, count)
+
+	data, err := ms.read(name, offset, count)
+	if err != nil {
+		return err
+	}
+
+	err = fi.Truncate(int64(len(data)))
+	if err == nil {
+		_, err = fi.WriteAt(data, 0)
+	}
+	if err != nil {
+		log.Err("MemoryStore::ReadToFile : Failed to write %s to local file [%s]", name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadBuffer : Download a specific range from a blob to a buffer
+func (ms *MemoryStore) ReadBuffer(ctx context.Context, name string, offset int64, len int64) ([]byte, error) {
+	log.Trace("MemoryStore::ReadBuffer : name %s", name)
+	return ms.read(name, offset, len)
+}
+
+// ReadInBuffer : Download specific range from a file to a user provided buffer
+func (ms *MemoryStore) ReadInBuffer(ctx context.Context, name string, offset int64, len int64, data []byte) error {
+	buff, err := ms.read(name, offset, len)
+	if err != nil {
+		return err
+	}
+
+	copy(data, buff)
+	return nil
+}
+
+// ReadVersionInBuffer : Download specific range from a version of a blob to a user provided buffer
+func (ms *MemoryStore) ReadVersionInBuffer(ctx context.Context, name string, version string, offset int64, len int64, data []byte) error {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	for _, blob := range ms.allVersions(ms.key(name)) {
+		if blob.version == version {
+			buff, err := readBlob(blob, offset, len)
+			if err != nil {
+				return err
+			}
+			copy(data, buff)
+			return nil
+		}
+	}
+	return syscall.ENOENT
+}
+
+// WriteFromFile : Upload local file to blob
+func (ms *MemoryStore) WriteFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File) (string, error) {
+	log.Trace("MemoryStore::WriteFromFile : name %s", name)
+	return ms.writeFromFile(ctx, name, metadata, fi, "")
+}
+
+// WriteFromFileIfMatch : Upload local file to blob only if the blob still has the given etag
+func (ms *MemoryStore) WriteFromFileIfMatch(ctx context.Context, name string, metadata map[string]string, fi *os.File, etag string) (string, error) {
+	log.Trace("MemoryStore::WriteFromFileIfMatch : name %s, etag %s", name, etag)
+	return ms.writeFromFile(ctx, name, metadata, fi, etag)
+}
+
+// writeFromFile : Read the local file and store it as the blob
+func (ms *MemoryStore) writeFromFile(ctx context.Context, name string, metadata map[string]string, fi *os.File, etag string) (string, error) {
+	stat, err := fi.Stat()
+	if err != nil {
+		log.Err("MemoryStore::WriteFromFile : Failed to get file size %s [%s]", name, err.Error())
+		return "", err
+	}
+
+	return ms.WriteFromReader(ctx, name, metadata, fi, stat.Size(), etag)
+}
+
+// WriteFromReader : Store size bytes read from r as the blob, only if it still has the given etag unless it is empty
+func (ms *MemoryStore) WriteFromReader(ctx context.Context, name string, metadata map[string]string, r io.ReaderAt, size int64, etag string) (string, error) {
+	data := make([]byte, size)
+	_, err := r.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		log.Err("MemoryStore::WriteFromFile : Failed to read file %s [%s]", name, err.Error())
+		return "", err
+	}
+
+	return ms.writeBuffer(name, metadata, data, etag)
+}
+
+// WriteFromBuffer : Upload from a buffer to a blob
+func (ms *MemoryStore) WriteFromBuffer(ctx context.Context, name string, metadata map[string]string, data []byte) error {
+	log.Trace("MemoryStore::WriteFromBuffer : name %s", name)
+	_, err := ms.writeBuffer(name, metadata, data, "")
+	return err
+}
+
+// writeBuffer : Store the data as the blob, a non empty etag has to match the current blob like an If-Match condition.
+// Returns the etag of the new blob.
+func (ms *MemoryStore) writeBuffer(name string, metadata map[string]string, data []byte, etag string) (string, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	blob, found := ms.blobs[key]
+	if found && ms.hns && blob.isDir {
+		log.Err("MemoryStore::WriteFromBuffer : %s is a directory", name)
+		return "", syscall.EISDIR
+	}
+
+	if ms.leasedByOther(key) {
+		log.Err("MemoryStore::WriteFromBuffer : %s is under a lease, can not update file", name)
+		return "", syscall.EIO
+	}
+
+	if etag != "" && (!found || blob.etag != etag) {
+		log.Err("MemoryStore::WriteFromBuffer : %s was modified by someone else, can not update file", name)
+		return "", syscall.ESTALE
+	}
+
+	ms.put(key, metadata, data)
+	return ms.blobs[key].etag, nil
+}
+
+// Write : write data at given offset to a blob
+func (ms *MemoryStore) Write(options internal.WriteFileOptions) error {
+	ctx := requestContext(options.Ctx)
+	name := options.Handle.Path
+	offset := options.Offset
+	log.Trace("MemoryStore::Write : name %s offset %v", name, offset)
+
+	bol, err := ms.GetFileBlockOffsets(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	length := int64(len(options.Data))
+
+	// case 1: file consists of no blocks (small file), rewrite the whole blob
+	if bol.SmallFile() {
+		oldData, _ := ms.ReadBuffer(ctx, name, 0, 0)
+		if int64(len(oldData)) < offset+length {
+			newData := make([]byte, offset+length)
+			copy(newData, oldData)
+			oldData = newData
+		}
+		copy(oldData[offset:], options.Data)
+		return ms.WriteFromBuffer(ctx, name, options.Metadata, oldData)
+	}
+
+	// case 2: overwrite the blocks within the blob
+	for _, blk := range bol.BlockList {
+		if blk.EndIndex <= offset || blk.StartIndex >= offset+length {
+			continue
+		}
+
+		blk.Data = make([]byte, blk.EndIndex-blk.StartIndex)
+		err = ms.ReadInBuffer(ctx, name, blk.StartIndex, blk.EndIndex-blk.StartIndex, blk.Data)
+		if err != nil {
+			log.Err("MemoryStore::Write : Failed to read data in buffer %s [%s]", name, err.Error())
+			return err
+		}
+		blk.Flags.Set(common.DirtyBlock)
+	}
+
+	// case 3: new blocks need to be added
+	blockSize := ms.Config.blockSize
+	if blockSize == 0 {
+		blockSize = (16 * 1024 * 1024)
+	}
+	for start := bol.BlockList[len(bol.BlockList)-1].EndIndex; start < offset+length; start += blockSize {
+		end := start + blockSize
+		if end > offset+length {
+			end = offset + length
+		}
+		blk := &common.Block{
+			Id:         base64.StdEncoding.EncodeToString(common.NewUUIDWithLength(bol.BlockIdLength)),
+			StartIndex: start,
+			EndIndex:   end,
+			Data:       make([]byte, end-start),
+		}
+		blk.Flags.Set(common.DirtyBlock)
+		bol.BlockList = append(bol.BlockList, blk)
+	}
+
+	for _, blk := range bol.BlockList {
+		if !blk.Dirty() {
+			continue
+		}
+		from := offset
+		if from < blk.StartIndex {
+			from = blk.StartIndex
+		}
+		to := offset + length
+		if to > blk.EndIndex {
+			to = blk.EndIndex
+		}
+		if from < to {
+			copy(blk.Data[from-blk.StartIndex:], options.Data[from-offset:to-offset])
+		}
+	}
+
+	return ms.StageAndCommit(ctx, name, bol)
+}
+
+// GetFileBlockOffsets: store blocks ids and corresponding offsets
+func (ms *MemoryStore) GetFileBlockOffsets(ctx context.Context, name string) (*common.BlockOffsetList, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	blockList := common.BlockOffsetList{}
+	blob, found := ms.blobs[ms.key(name)]
+	if !found {
+		log.Err("MemoryStore::GetFileBlockOffsets : Failed to get block list %s", name)
+		return &common.BlockOffsetList{}, syscall.ENOENT
+	}
+
+	// if block list empty its a small file
+	if len(blob.blocks) == 0 {
+		blockList.Flags.Set(common.SmallFile)
+		return &blockList, nil
+	}
+
+	var blockOffset int64 = 0
+	for _, block := range blob.blocks {
+		blk := &common.Block{
+			Id:         block.id,
+			StartIndex: blockOffset,
+			EndIndex:   blockOffset + int64(len(block.data)),
+		}
+		blockOffset += int64(len(block.data))
+		blockList.BlockList = append(blockList.BlockList, blk)
+	}
+	blockList.BlockIdLength = common.GetIdLength(blockList.BlockList[0].Id)
+	return &blockList, nil
+}
+
+// TruncateFile : resize a blob, the way block blob does it this drops the metadata of the blob
+func (ms *MemoryStore) TruncateFile(ctx context.Context, name string, size int64) error {
+	bol, err := ms.GetFileBlockOffsets(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	data, err := ms.ReadBuffer(ctx, name, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 || len(data) == 0 || bol.SmallFile() {
+		newData := make([]byte, size)
+		copy(newData, data)
+		return ms.WriteFromBuffer(ctx, name, nil, newData)
+	}
+
+	// if the file consists of blocks, shrink or extend the block list
+	newList := make([]*common.Block, 0)
+	for _, blk := range bol.BlockList {
+		if blk.StartIndex >= size {
+			break
+		}
+		if blk.EndIndex > size {
+			blk.EndIndex = size
+			blk.Data = make([]byte, size-blk.StartIndex)
+			copy(blk.Data, data[blk.StartIndex:size])
+			blk.Flags.Set(common.DirtyBlock)
+		}
+		newList = append(newList, blk)
+	}
+
+	if end := newList[len(newList)-1].EndIndex; end < size {
+		blk := &common.Block{
+			Id:         base64.StdEncoding.EncodeToString(common.NewUUIDWithLength(bol.BlockIdLength)),
+			StartIndex: end,
+			EndIndex:   size,
+		}
+		blk.Flags.Set(common.TruncatedBlock)
+		blk.Flags.Set(common.DirtyBlock)
+		newList = append(newList, blk)
+	}
+
+	bol.BlockList = newList
+	return ms.StageAndCommit(ctx, name, bol)
+}
+
+// StageAndCommit : stage the dirty blocks and commit the given block list, blocks which are neither staged
+// nor part of the current committed list fail the commit the same way the service rejects them
+func (ms *MemoryStore) StageAndCommit(ctx context.Context, name string, bol *common.BlockOffsetList) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	if ms.leasedByOther(key) {
+		log.Err("MemoryStore::StageAndCommit : %s is under a lease, can not update file", name)
+		return syscall.EIO
+	}
+	staged, found := ms.staged[key]
+	if !found {
+		staged = make(map[string][]byte)
+		ms.staged[key] = staged
+	}
+
+	stagedAny := false
+	for _, blk := range bol.BlockList {
+		if !blk.Dirty() {
+			continue
+		}
+
+		var data []byte
+		if blk.Truncated() {
+			data = make([]byte, blk.EndIndex-blk.StartIndex)
+			blk.Flags.Clear(common.TruncatedBlock)
+		} else {
+			data = make([]byte, len(blk.Data))
+			copy(data, blk.Data)
+		}
+		staged[blk.Id] = data
+		stagedAny = true
+		blk.Flags.Clear(common.DirtyBlock)
+	}
+
+	if !stagedAny {
+		return nil
+	}
+
+	committed := make(map[string][]byte)
+	blob, exists := ms.blobs[key]
+	if exists {
+		for _, block := range blob.blocks {
+			committed[block.id] = block.data
+		}
+	}
+
+	blocks := make([]memoryBlock, 0, len(bol.BlockList))
+	data := make([]byte, 0)
+	for _, blk := range bol.BlockList {
+		blockData, found := staged[blk.Id]
+		if !found {
+			blockData, found = committed[blk.Id]
+		}
+		if !found {
+			log.Err("MemoryStore::StageAndCommit : Failed to commit block list to blob %s [invalid block %s]", name, blk.Id)
+			return errors.New("invalid block list")
+		}
+		blocks = append(blocks, memoryBlock{id: blk.Id, data: blockData})
+		data = append(data, blockData...)
+	}
+
+	now := time.Now()
+	newBlob := &memoryBlob{
+		data:     data,
+		blocks:   blocks,
+		metadata: make(map[string]string),
+		mode:     memoryDefaultFileMode,
+		mtime:    now,
+		crtime:   now,
+		etag:     ms.newETag(),
+		tier:     ms.defaultTier(),
+	}
+	if exists {
+		newBlob.crtime = blob.crtime
+		newBlob.mode = blob.mode
+		newBlob.leaseID = blob.leaseID
+		newBlob.leaseDuration = blob.leaseDuration
+		newBlob.leaseExpiry = blob.leaseExpiry
+	}
+
+	ms.keepVersion(key)
+	newBlob.version = ms.newVersionID()
+
+	ms.createParents(key)
+	ms.blobs[key] = newBlob
+	delete(ms.staged, key)
+	return nil
+}
+
+// ChangeMod : Change mode of a path
+func (ms *MemoryStore) ChangeMod(ctx context.Context, name string, mode os.FileMode) error {
+	log.Trace("MemoryStore::ChangeMod : name %s", name)
+
+	if !ms.hns {
+		if ms.Config.ignoreAccessModifiers {
+			return nil
+		}
+		// This is not currently supported for a flat namespace account
+		return syscall.ENOTSUP
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found {
+		return syscall.ENOENT
+	}
+	blob.mode = mode.Perm()
+	blob.etag = ms.newETag()
+	return nil
+}
+
+// ChangeOwner : Change owner of a path
+func (ms *MemoryStore) ChangeOwner(ctx context.Context, name string, _ int, _ int) error {
+	log.Trace("MemoryStore::ChangeOwner : name %s", name)
+
+	if ms.Config.ignoreAccessModifiers {
+		return nil
+	}
+	return syscall.ENOTSUP
+}
+
+// SetMetadata : Replace the user defined metadata of a path, only if it still has the given etag unless it is empty
+func (ms *MemoryStore) SetMetadata(ctx context.Context, name string, metadata map[string]string, etag string) error {
+	log.Trace("MemoryStore::SetMetadata : name %s, etag %s", name, etag)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	blob, found := ms.blobs[key]
+	if !found {
+		return syscall.ENOENT
+	}
+
+	if ms.leasedByOther(key) {
+		log.Err("MemoryStore::SetMetadata : %s is under a lease, can not update metadata", name)
+		return syscall.EIO
+	}
+
+	if etag != "" && blob.etag != etag {
+		log.Warn("MemoryStore::SetMetadata : %s was modified by someone else since %s", name, etag)
+		return syscall.ESTALE
+	}
+
+	// Setting metadata creates a new version of the blob
+	ms.keepVersion(key)
+	if !blob.isDir {
+		blob.version = ms.newVersionID()
+	}
+
+	blob.metadata = make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		blob.metadata[k] = v
+	}
+	blob.etag = ms.newETag()
+	return nil
+}
+
+// leasedByOther : blob has an active lease whose id this client does not present, updates are refused like the service does
+func (ms *MemoryStore) leasedByOther(key string) bool {
+	blob, found := ms.blobs[key]
+	if !found || blob.leaseID == "" || time.Now().After(blob.leaseExpiry) {
+		return false
+	}
+	return ms.leases[key] != blob.leaseID
+}
+
+// AcquireLease : Take a lease on a blob, an expired lease may be taken over by anyone
+func (ms *MemoryStore) AcquireLease(ctx context.Context, name string, leaseID string, duration int32) error {
+	log.Trace("MemoryStore::AcquireLease : name %s, duration %d", name, duration)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	blob, found := ms.blobs[key]
+	if !found || blob.isDir {
+		return syscall.ENOENT
+	}
+
+	if blob.leaseID != leaseID && time.Now().Before(blob.leaseExpiry) {
+		return syscall.EWOULDBLOCK
+	}
+
+	blob.leaseID = leaseID
+	blob.leaseDuration = time.Duration(duration) * time.Second
+	blob.leaseExpiry = time.Now().Add(blob.leaseDuration)
+	ms.leases[key] = leaseID
+	return nil
+}
+
+// CreateFileIfNotExists : Create an empty blob unless one exists already
+func (ms *MemoryStore) CreateFileIfNotExists(ctx context.Context, name string) error {
+	log.Trace("MemoryStore::CreateFileIfNotExists : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	if _, found := ms.blobs[key]; !found {
+		ms.put(key, nil, []byte{})
+	}
+	return nil
+}
+
+// RenewLease : Extend a lease, fails once it has been taken over by someone else
+func (ms *MemoryStore) RenewLease(ctx context.Context, name string, leaseID string) error {
+	log.Trace("MemoryStore::RenewLease : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	blob, found := ms.blobs[key]
+	if !found {
+		delete(ms.leases, key)
+		return syscall.ENOENT
+	}
+
+	if blob.leaseID != leaseID {
+		delete(ms.leases, key)
+		return syscall.ENOLCK
+	}
+
+	blob.leaseExpiry = time.Now().Add(blob.leaseDuration)
+	return nil
+}
+
+// ReleaseLease : Give up a lease so that others can take it right away
+func (ms *MemoryStore) ReleaseLease(ctx context.Context, name string, leaseID string) error {
+	log.Trace("MemoryStore::ReleaseLease : name %s", name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	key := ms.key(name)
+	delete(ms.leases, key)
+
+	blob, found := ms.blobs[key]
+	if !found {
+		return nil
+	}
+
+	if blob.leaseID != leaseID {
+		return syscall.ENOLCK
+	}
+
+	blob.leaseID = ""
+	blob.leaseExpiry = time.Time{}
+	return nil
+}
+
+// GetTier : Get the access tier of a blob, rehydration is instant here so there is never an archive status
+func (ms *MemoryStore) GetTier(ctx context.Context, name string) (string, string, error) {
+	log.Trace("MemoryStore::GetTier : name %s", name)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found || blob.isDir {
+		return "", "", syscall.ENOENT
+	}
+	return blob.tier, "", nil
+}
+
+// SetTier : Move a blob to the given access tier, this does not modify the etag like the service
+func (ms *MemoryStore) SetTier(ctx context.Context, name string, tier string) error {
+	log.Trace("MemoryStore::SetTier : name %s, tier %s", name, tier)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found || blob.isDir {
+		return syscall.ENOENT
+	}
+	blob.tier = tier
+	return nil
+}
+
+// GetTags : Get the index tags of a blob
+func (ms *MemoryStore) GetTags(ctx context.Context, name string) (map[string]string, error) {
+	log.Trace("MemoryStore::GetTags : name %s", name)
+
+	if ms.hns {
+		return nil, syscall.ENOTSUP
+	}
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found {
+		return nil, syscall.ENOENT
+	}
+
+	tags := make(map[string]string, len(blob.tags))
+	for k, v := range blob.tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// SetTags : Replace the index tags of a blob, this does not modify the etag like the service
+func (ms *MemoryStore) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	log.Trace("MemoryStore::SetTags : name %s", name)
+
+	if ms.hns {
+		return syscall.ENOTSUP
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	blob, found := ms.blobs[ms.key(name)]
+	if !found {
+		return syscall.ENOENT
+	}
+
+	blob.tags = make(map[string]string, len(tags))
+	for k, v := range tags {
+		blob.tags[k] = v
+	}
+	return nil
+}
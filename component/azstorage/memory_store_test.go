@@ -0,0 +1,1257 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type memoryStoreTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+	az     *AzStorage
+}
+
+func (s *memoryStoreTestSuite) SetupTest() {
+	_ = log.SetDefaultLogger("silent", common.LogConfig{})
+	s.setupTestHelper("azstorage:\n  type: memory\n  container: test")
+}
+
+func (s *memoryStoreTestSuite) setupTestHelper(configuration string) {
+	s.assert = assert.New(s.T())
+
+	var err error
+	s.az, err = newTestAzStorage(configuration)
+	s.assert.Nil(err)
+	_ = s.az.Start(ctx)
+}
+
+func (s *memoryStoreTestSuite) cleanupTest() {
+	_ = s.az.Stop()
+}
+
+func (s *memoryStoreTestSuite) TestDefault() {
+	defer s.cleanupTest()
+	s.assert.Equal(EAccountType.MEMORY(), s.az.stConfig.authConfig.AccountType)
+	s.assert.Equal("test", s.az.stConfig.container)
+	s.assert.False(s.az.stConfig.memoryHNS)
+	s.assert.True(s.az.stConfig.virtualDirectory)
+	s.assert.IsType(&MemoryStore{}, s.az.storage)
+}
+
+func (s *memoryStoreTestSuite) TestCreateReadDeleteFile() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.NotNil(h)
+
+	data := []byte("test data")
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: data})
+	s.assert.Nil(err)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.EqualValues(len(data), attr.Size)
+	s.assert.True(attr.IsModeDefault())
+
+	output, err := s.az.ReadFile(internal.ReadFileOptions{Handle: h})
+	s.assert.Nil(err)
+	s.assert.EqualValues(data, output)
+
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.Nil(err)
+
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+func (s *memoryStoreTestSuite) TestVirtualDirectory() {
+	defer s.cleanupTest()
+	dir := generateDirectoryName()
+
+	_, err := s.az.CreateFile(internal.CreateFileOptions{Name: dir + "/a"})
+	s.assert.Nil(err)
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: dir + "/sub/b"})
+	s.assert.Nil(err)
+
+	// no marker blob, still reported as directory when listing the parent
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+
+	entries, err := s.az.ReadDir(internal.ReadDirOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.Len(entries, 2)
+	s.assert.Equal(dir+"/a", entries[0].Path)
+	s.assert.False(entries[0].IsDir())
+	s.assert.Equal(dir+"/sub", entries[1].Path)
+	s.assert.True(entries[1].IsDir())
+
+	// without a marker blob the last delete fails the way block blob does
+	err = s.az.DeleteDir(internal.DeleteDirOptions{Name: dir})
+	s.assert.Equal(syscall.ENOENT, err)
+	s.assert.True(s.az.IsDirEmpty(internal.IsDirEmptyOptions{Name: dir}))
+}
+
+func (s *memoryStoreTestSuite) TestRenameDir() {
+	defer s.cleanupTest()
+	src := generateDirectoryName()
+	dst := generateDirectoryName()
+
+	err := s.az.CreateDir(internal.CreateDirOptions{Name: src})
+	s.assert.Nil(err)
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: src + "/file"})
+	s.assert.Nil(err)
+
+	err = s.az.RenameDir(internal.RenameDirOptions{Src: src, Dst: dst})
+	s.assert.Nil(err)
+
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: src + "/file"})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dst})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: dst + "/file"})
+	s.assert.Nil(err)
+}
+
+func (s *memoryStoreTestSuite) TestCopyFileRange() {
+	defer s.cleanupTest()
+	src := generateFileName()
+	dst := generateFileName()
+	data := []byte("server side copy")
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: src})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: data, Metadata: map[string]string{"owner": "etl"}})
+	s.assert.Nil(err)
+	dh, err := s.az.CreateFile(internal.CreateFileOptions{Name: dst})
+	s.assert.Nil(err)
+
+	options := internal.CopyFileRangeOptions{SrcHandle: h, SrcOffset: int64(len(data)), DstHandle: dh, Size: 1 << 20}
+	copied, err := s.az.CopyFileRange(options)
+	s.assert.Nil(err)
+	s.assert.EqualValues(0, copied)
+
+	options.SrcOffset = 0
+	copied, err = s.az.CopyFileRange(options)
+	s.assert.Nil(err)
+	s.assert.EqualValues(len(data), copied)
+	s.assert.EqualValues(len(data), dh.Size)
+
+	output, err := s.az.ReadFile(internal.ReadFileOptions{Handle: dh})
+	s.assert.Nil(err)
+	s.assert.Equal(data, output)
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dst})
+	s.assert.Nil(err)
+	s.assert.Equal("etl", attr.Metadata["owner"])
+
+	// File can not be copied over itself
+	options.SrcHandle = dh
+	_, err = s.az.CopyFileRange(options)
+	s.assert.Equal(syscall.ENOTSUP, err)
+}
+
+func (s *memoryStoreTestSuite) TestCopyFileRangePartial() {
+	defer s.cleanupTest()
+	src := generateFileName()
+	dst := generateFileName()
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: src})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("0123456789")})
+	s.assert.Nil(err)
+	dh, err := s.az.CreateFile(internal.CreateFileOptions{Name: dst})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: dh, Offset: 0, Data: []byte("abcdefgh"), Metadata: map[string]string{"owner": "etl"}})
+	s.assert.Nil(err)
+
+	// Range inside the target keeps its head and tail
+	copied, err := s.az.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: h, SrcOffset: 2, DstHandle: dh, DstOffset: 3, Size: 3})
+	s.assert.Nil(err)
+	s.assert.EqualValues(3, copied)
+	s.assert.EqualValues(8, dh.Size)
+	output, err := s.az.ReadFile(internal.ReadFileOptions{Handle: dh})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("abc234gh"), output)
+
+	// Range past the end of the target leaves a hole of zeros and is cut at the end of the source
+	copied, err = s.az.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: h, SrcOffset: 8, DstHandle: dh, DstOffset: 10, Size: 1 << 20})
+	s.assert.Nil(err)
+	s.assert.EqualValues(2, copied)
+	s.assert.EqualValues(12, dh.Size)
+	output, err = s.az.ReadFile(internal.ReadFileOptions{Handle: dh})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("abc234gh\x00\x0089"), output)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dst})
+	s.assert.Nil(err)
+	s.assert.Equal("etl", attr.Metadata["owner"])
+
+	// Whole source over a larger target only replaces its head
+	copied, err = s.az.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: h, DstHandle: dh, Size: 1 << 20})
+	s.assert.Nil(err)
+	s.assert.EqualValues(10, copied)
+	s.assert.EqualValues(12, dh.Size)
+	output, err = s.az.ReadFile(internal.ReadFileOptions{Handle: dh})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("012345678989"), output)
+}
+
+func (s *memoryStoreTestSuite) TestCopyFromFileIfMatch() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	err := s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("first"))
+	s.assert.Nil(err)
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.NotEmpty(attr.ETag)
+
+	f, err := os.CreateTemp("", name)
+	s.assert.Nil(err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.WriteString("second")
+	s.assert.Nil(err)
+
+	// Another writer changes the blob, upload with the old etag is refused
+	err = s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("other"))
+	s.assert.Nil(err)
+	err = s.az.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f, ETag: attr.ETag})
+	s.assert.Equal(syscall.ESTALE, err)
+
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+	err = s.az.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f, ETag: attr.ETag})
+	s.assert.Nil(err)
+
+	data := make([]byte, 6)
+	err = s.az.storage.ReadInBuffer(context.Background(), name, 0, 6, data)
+	s.assert.Nil(err)
+	s.assert.Equal("second", string(data))
+
+	// Deleted blob does not match any etag
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.Nil(err)
+	err = s.az.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f, ETag: attr.ETag})
+	s.assert.Equal(syscall.ESTALE, err)
+}
+
+func (s *memoryStoreTestSuite) TestCopyFromReader() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	err := s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("first"))
+	s.assert.Nil(err)
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+
+	// Only the first Size bytes of the reader are uploaded
+	reader := strings.NewReader("second and more")
+	err = s.az.CopyFromFile(internal.CopyFromFileOptions{Name: name, Reader: reader, Size: 6, ETag: attr.ETag})
+	s.assert.Nil(err)
+
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.EqualValues(6, attr.Size)
+	data := make([]byte, 6)
+	err = s.az.storage.ReadInBuffer(context.Background(), name, 0, 6, data)
+	s.assert.Nil(err)
+	s.assert.Equal("second", string(data))
+
+	err = s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("other"))
+	s.assert.Nil(err)
+	err = s.az.CopyFromFile(internal.CopyFromFileOptions{Name: name, Reader: reader, Size: 6, ETag: attr.ETag})
+	s.assert.Equal(syscall.ESTALE, err)
+}
+
+func (s *memoryStoreTestSuite) TestLockFile() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	err := s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("data"))
+	s.assert.Nil(err)
+	h1, err := s.az.OpenFile(internal.OpenFileOptions{Name: name})
+	s.assert.Nil(err)
+	h2, err := s.az.OpenFile(internal.OpenFileOptions{Name: name})
+	s.assert.Nil(err)
+
+	// Exclusive lock leases the blob, updates from this mount carry the lease
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h1, Type: internal.LockExclusive})
+	s.assert.Nil(err)
+	ms := s.az.storage.(*MemoryStore)
+	s.assert.NotEmpty(ms.blobs[ms.key(name)].leaseID)
+	err = s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("mine"))
+	s.assert.Nil(err)
+
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockExclusive})
+	s.assert.Equal(syscall.EWOULDBLOCK, err)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockShared, Test: true})
+	s.assert.Equal(syscall.EWOULDBLOCK, err)
+
+	// Closing the handle gives up the lease
+	err = s.az.CloseFile(internal.CloseFileOptions{Handle: h1})
+	s.assert.Nil(err)
+	s.assert.Empty(ms.blobs[ms.key(name)].leaseID)
+
+	// Lease taken by another mount blocks both locks and updates from this one
+	err = ms.AcquireLease(context.Background(), name, "other-mount", defaultLeaseDuration)
+	s.assert.Nil(err)
+	delete(ms.leases, ms.key(name))
+
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockExclusive})
+	s.assert.Equal(syscall.EWOULDBLOCK, err)
+	err = s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("blocked"))
+	s.assert.Equal(syscall.EIO, err)
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.NotNil(err)
+
+	err = ms.ReleaseLease(context.Background(), name, "other-mount")
+	s.assert.Nil(err)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockExclusive, Test: true})
+	s.assert.Nil(err)
+	s.assert.Empty(ms.blobs[ms.key(name)].leaseID)
+
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockExclusive})
+	s.assert.Nil(err)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: h2, Type: internal.LockUnlock})
+	s.assert.Nil(err)
+	s.assert.Empty(ms.blobs[ms.key(name)].leaseID)
+}
+
+func (s *memoryStoreTestSuite) TestLockFileNotUploaded() {
+	defer s.cleanupTest()
+	name := generateFileName()
+	ms := s.az.storage.(*MemoryStore)
+
+	// File created by a cache above is not in storage yet, testing for a lock leaves it that way
+	handle := handlemap.NewHandle(name)
+	err := s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Test: true})
+	s.assert.Nil(err)
+	_, found := ms.blobs[ms.key(name)]
+	s.assert.False(found)
+
+	// Locking it puts an empty blob in place to carry the lease
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive})
+	s.assert.Nil(err)
+	s.assert.NotEmpty(ms.blobs[ms.key(name)].leaseID)
+	s.assert.Empty(ms.blobs[ms.key(name)].data)
+
+	// Upload of the file goes through the lease
+	err = s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("data"))
+	s.assert.Nil(err)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock})
+	s.assert.Nil(err)
+}
+
+func (s *memoryStoreTestSuite) TestLockFileWaitInterrupted() {
+	defer s.cleanupTest()
+	name := generateFileName()
+	ms := s.az.storage.(*MemoryStore)
+
+	err := s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("data"))
+	s.assert.Nil(err)
+	err = ms.AcquireLease(context.Background(), name, "other-mount", defaultLeaseDuration)
+	s.assert.Nil(err)
+	delete(ms.leases, ms.key(name))
+
+	// Caller is checked between retries
+	checks := 0
+	interrupted := func() bool {
+		checks++
+		return checks == 2
+	}
+	start := time.Now()
+	handle := handlemap.NewHandle(name)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true, Interrupted: interrupted})
+	s.assert.Equal(syscall.EINTR, err)
+	s.assert.Equal(2, checks)
+	s.assert.Less(time.Since(start), 3*lockRetryInterval)
+
+	// Cancelled request stops waiting as well
+	reqCtx, cancel := context.WithTimeout(context.Background(), lockRetryInterval/2)
+	defer cancel()
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true, Ctx: reqCtx})
+	s.assert.Equal(syscall.EINTR, err)
+
+	// Wait ends once the other mount lets go
+	go func() {
+		time.Sleep(lockRetryInterval / 2)
+		_ = ms.ReleaseLease(context.Background(), name, "other-mount")
+	}()
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true})
+	s.assert.Nil(err)
+	err = s.az.LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock})
+	s.assert.Nil(err)
+}
+
+func (s *memoryStoreTestSuite) TestLeaseDurationConfig() {
+	defer s.cleanupTest()
+	s.assert.EqualValues(defaultLeaseDuration, s.az.stConfig.leaseDuration)
+
+	_, err := newTestAzStorage("azstorage:\n  type: memory\n  container: test\n  lease-duration-sec: 10")
+	s.assert.NotNil(err)
+
+	az, err := newTestAzStorage("azstorage:\n  type: memory\n  container: test\n  lease-duration-sec: 60")
+	s.assert.Nil(err)
+	s.assert.EqualValues(60, az.stConfig.leaseDuration)
+}
+
+func (s *memoryStoreTestSuite) TestMetadataAndSymlink() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	err := s.az.CreateLink(internal.CreateLinkOptions{Name: name, Target: "target"})
+	s.assert.Nil(err)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsSymlink())
+	s.assert.Equal("true", attr.Metadata[symlinkKey])
+
+	target, err := s.az.ReadLink(internal.ReadLinkOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Equal("target", target)
+}
+
+func (s *memoryStoreTestSuite) TestStageAndCommit() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+
+	bol, err := s.az.GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.True(bol.SmallFile())
+
+	// convert the blob to two blocks
+	ids := []string{"QUFBQUFBQUFBQUFBQUFBQQ==", "QkJCQkJCQkJCQkJCQkJCQg=="}
+	bol = &common.BlockOffsetList{BlockIdLength: 16}
+	for i, id := range ids {
+		blk := &common.Block{Id: id, StartIndex: int64(i * 4), EndIndex: int64(i*4 + 4), Data: []byte("abcd")}
+		blk.Flags.Set(common.DirtyBlock)
+		bol.BlockList = append(bol.BlockList, blk)
+	}
+	h.CacheObj = &handlemap.Cache{BlockOffsetList: bol}
+
+	err = s.az.FlushFile(internal.FlushFileOptions{Handle: h})
+	s.assert.Nil(err)
+	for _, blk := range bol.BlockList {
+		s.assert.False(blk.Dirty())
+	}
+
+	bol, err = s.az.GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.False(bol.SmallFile())
+	s.assert.Len(bol.BlockList, 2)
+	s.assert.Equal(ids[1], bol.BlockList[1].Id)
+	s.assert.EqualValues(16, bol.BlockIdLength)
+
+	// rewrite only the second block, first one is taken from the committed list
+	bol.BlockList[1].Data = []byte("efgh")
+	bol.BlockList[1].Flags.Set(common.DirtyBlock)
+	err = s.az.storage.StageAndCommit(context.Background(), name, bol)
+	s.assert.Nil(err)
+
+	data, err := s.az.storage.ReadBuffer(context.Background(), name, 0, 0)
+	s.assert.Nil(err)
+	s.assert.Equal("abcdefgh", string(data))
+
+	// unknown block which was never staged is rejected
+	blk := &common.Block{Id: "Q0NDQ0NDQ0NDQ0NDQ0NDQw==", StartIndex: 8, EndIndex: 12}
+	bol.BlockList = append(bol.BlockList, blk)
+	bol.BlockList[1].Flags.Set(common.DirtyBlock)
+	err = s.az.storage.StageAndCommit(context.Background(), name, bol)
+	s.assert.NotNil(err)
+
+	// write beyond the end appends a block
+	err = s.az.storage.Write(internal.WriteFileOptions{Handle: h, Offset: 10, Data: []byte("xy")})
+	s.assert.Nil(err)
+
+	data, err = s.az.storage.ReadBuffer(context.Background(), name, 0, 0)
+	s.assert.Nil(err)
+	s.assert.Equal("abcdefgh\x00\x00xy", string(data))
+
+	err = s.az.TruncateFile(internal.TruncateFileOptions{Name: name, Size: 6})
+	s.assert.Nil(err)
+
+	data, err = s.az.storage.ReadBuffer(context.Background(), name, 0, 0)
+	s.assert.Nil(err)
+	s.assert.Equal("abcdef", string(data))
+}
+
+func (s *memoryStoreTestSuite) TestReadRange() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	err := s.az.storage.WriteFromBuffer(context.Background(), name, nil, []byte("0123456789"))
+	s.assert.Nil(err)
+
+	data := make([]byte, 4)
+	err = s.az.storage.ReadInBuffer(context.Background(), name, 3, 4, data)
+	s.assert.Nil(err)
+	s.assert.Equal("3456", string(data))
+
+	err = s.az.storage.ReadInBuffer(context.Background(), name, 10, 4, data)
+	s.assert.Equal(syscall.ERANGE, err)
+
+	f, err := os.CreateTemp("", name)
+	s.assert.Nil(err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = s.az.CopyToFile(internal.CopyToFileOptions{Name: name, Offset: 5, Count: 0, File: f})
+	s.assert.Nil(err)
+
+	local, err := os.ReadFile(f.Name())
+	s.assert.Nil(err)
+	s.assert.Equal("56789", string(local))
+
+	err = s.az.CopyToFile(internal.CopyToFileOptions{Name: "missing", File: f})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+func (s *memoryStoreTestSuite) TestHierarchicalNamespace() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  memory-hns: true\n  fail-unsupported-op: true")
+
+	s.assert.Equal("memory", s.az.stConfig.container)
+	s.assert.True(s.az.stConfig.memoryHNS)
+
+	dir := generateDirectoryName()
+
+	// listing a directory which does not exist fails
+	_, _, err := s.az.storage.List(context.Background(), dir+"/", nil, 0)
+	s.assert.Equal(syscall.ENOENT, err)
+
+	// creating a file creates the parent directories
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: dir + "/sub/file", Mode: 0600})
+	s.assert.Nil(err)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dir + "/sub"})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+	s.assert.False(attr.IsModeDefault())
+	s.assert.EqualValues(0755, attr.Mode.Perm())
+
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: dir + "/sub/file"})
+	s.assert.Nil(err)
+	s.assert.EqualValues(0600, attr.Mode.Perm())
+
+	err = s.az.Chmod(internal.ChmodOptions{Name: dir + "/sub/file", Mode: 0644})
+	s.assert.Nil(err)
+
+	err = s.az.storage.CreateDirectory(context.Background(), dir)
+	s.assert.Equal(syscall.EEXIST, err)
+
+	entries, err := s.az.ReadDir(internal.ReadDirOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.Len(entries, 1)
+	s.assert.True(entries[0].IsDir())
+	s.assert.False(entries[0].IsMetadataRetrieved())
+
+	// rename moves the whole tree at once
+	err = s.az.RenameDir(internal.RenameDirOptions{Src: dir, Dst: dir + "new"})
+	s.assert.Nil(err)
+
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: dir + "new/sub/file"})
+	s.assert.Nil(err)
+	s.assert.EqualValues(0644, attr.Mode.Perm())
+
+	err = s.az.DeleteDir(internal.DeleteDirOptions{Name: dir + "new"})
+	s.assert.Nil(err)
+
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: dir + "new/sub"})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	err = s.az.DeleteDir(internal.DeleteDirOptions{Name: dir + "new"})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+func (s *memoryStoreTestSuite) TestXattr() {
+	defer s.cleanupTest()
+	name := generateFileName()
+	dir := generateDirectoryName()
+
+	_, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	err = s.az.CreateDir(internal.CreateDirOptions{Name: dir})
+	s.assert.Nil(err)
+
+	_, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: "user.source"})
+	s.assert.Equal(syscall.ENODATA, err)
+
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.source", Value: []byte("pipeline")})
+	s.assert.Nil(err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.Owner", Value: []byte("team-a")})
+	s.assert.Nil(err)
+
+	value, err := s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: "user.source"})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("pipeline"), value)
+
+	// Storage does not preserve the case of metadata keys
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: "user.owner"})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("team-a"), value)
+
+	names, err := s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{"user.Owner", "user.source", xattrETag, xattrMD5, xattrTier}, names)
+
+	// Create and replace flags
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.source", Value: []byte("x"), Flags: internal.XattrCreate})
+	s.assert.Equal(syscall.EEXIST, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.other", Value: []byte("x"), Flags: internal.XattrReplace})
+	s.assert.Equal(syscall.ENODATA, err)
+
+	// Only the user namespace with valid metadata names and values is supported
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "security.selinux", Value: []byte("x")})
+	s.assert.Equal(syscall.ENOTSUP, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.my.tag", Value: []byte("x")})
+	s.assert.Equal(syscall.EINVAL, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.tag", Value: []byte{0xff}})
+	s.assert.Equal(syscall.EINVAL, err)
+
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: name, Attr: "user.source"})
+	s.assert.Nil(err)
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: name, Attr: "user.source"})
+	s.assert.Equal(syscall.ENODATA, err)
+
+	names, err = s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{"user.Owner", xattrETag, xattrMD5, xattrTier}, names)
+
+	// Directory markers can carry attributes but the marker itself is hidden and protected
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: dir, Attr: "user.source", Value: []byte("pipeline")})
+	s.assert.Nil(err)
+	names, err = s.az.ListXattr(internal.ListXattrOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{"user.source", xattrETag}, names)
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: dir, Attr: "user." + folderKey})
+	s.assert.Equal(syscall.EPERM, err)
+
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+
+	_, err = s.az.GetXattr(internal.GetXattrOptions{Name: "missing", Attr: "user.source"})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+// racingMetadata : another writer changes the metadata right before each of the first updates of this mount
+type racingMetadata struct {
+	*MemoryStore
+	races int
+}
+
+func (r *racingMetadata) SetMetadata(ctx context.Context, name string, metadata map[string]string, etag string) error {
+	if r.races > 0 {
+		r.races--
+		attr, _ := r.MemoryStore.GetAttr(ctx, name)
+		other := map[string]string{fmt.Sprintf("other%d", r.races): "x"}
+		for k, v := range attr.Metadata {
+			other[k] = v
+		}
+		_ = r.MemoryStore.SetMetadata(ctx, name, other, "")
+	}
+	return r.MemoryStore.SetMetadata(ctx, name, metadata, etag)
+}
+
+func (s *memoryStoreTestSuite) TestXattrConcurrentUpdate() {
+	defer s.cleanupTest()
+	name := generateFileName()
+
+	_, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	racing := &racingMetadata{MemoryStore: s.az.storage.(*MemoryStore), races: 2}
+	s.az.storage = racing
+
+	// Update is retried on top of the metadata written by the other writer
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.mine", Value: []byte("v")})
+	s.assert.Nil(err)
+	names, err := s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Subset(names, []string{"user.mine", "user.other0", "user.other1"})
+
+	racing.races = 1
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: name, Attr: "user.mine"})
+	s.assert.Nil(err)
+	names, err = s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.NotContains(names, "user.mine")
+	s.assert.Contains(names, "user.other0")
+
+	// Writer changing the metadata every time wins in the end
+	racing.races = metadataUpdateRetries
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: "user.mine", Value: []byte("v")})
+	s.assert.Equal(syscall.ESTALE, err)
+}
+
+func (s *memoryStoreTestSuite) TestVirtualXattr() {
+	defer s.cleanupTest()
+	name := generateFileName()
+	dir := generateDirectoryName()
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("hello")})
+	s.assert.Nil(err)
+	err = s.az.CreateDir(internal.CreateDirOptions{Name: dir})
+	s.assert.Nil(err)
+
+	value, err := s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrMD5})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("5d41402abc4b2a76b9719d911017c592"), value)
+
+	etag, err := s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrETag})
+	s.assert.Nil(err)
+	s.assert.NotEmpty(etag)
+
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrTier})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("Hot"), value)
+	_, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrArchiveStatus})
+	s.assert.Equal(syscall.ENODATA, err)
+
+	// Tier is matched case insensitive and changing it keeps the etag
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTier, Value: []byte("cool")})
+	s.assert.Nil(err)
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrTier})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("Cool"), value)
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrETag})
+	s.assert.Nil(err)
+	s.assert.Equal(etag, value)
+
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTier, Value: []byte("lukewarm")})
+	s.assert.Equal(syscall.EINVAL, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTier, Value: []byte("none")})
+	s.assert.Equal(syscall.EINVAL, err)
+
+	// Properties maintained by the service are read only
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrETag, Value: []byte("x")})
+	s.assert.Equal(syscall.EPERM, err)
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: name, Attr: xattrTier})
+	s.assert.Equal(syscall.EPERM, err)
+
+	// Index tags
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + "project", Value: []byte("alpha")})
+	s.assert.Nil(err)
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrTagPrefix + "project"})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("alpha"), value)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + "project", Value: []byte("beta"), Flags: internal.XattrCreate})
+	s.assert.Equal(syscall.EEXIST, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + "stage", Value: []byte("a*b")})
+	s.assert.Equal(syscall.EINVAL, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix, Value: []byte("x")})
+	s.assert.Equal(syscall.EINVAL, err)
+
+	names, err := s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{xattrETag, xattrMD5, xattrTagPrefix + "project", xattrTier}, names)
+
+	err = s.az.RemoveXattr(internal.RemoveXattrOptions{Name: name, Attr: xattrTagPrefix + "project"})
+	s.assert.Nil(err)
+	_, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrTagPrefix + "project"})
+	s.assert.Equal(syscall.ENODATA, err)
+
+	for i := 0; i < maxBlobTags; i++ {
+		err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + fmt.Sprintf("t%d", i), Value: []byte("x")})
+		s.assert.Nil(err)
+	}
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + "extra", Value: []byte("x")})
+	s.assert.Equal(syscall.ENOSPC, err)
+
+	// Rewriting the blob changes its etag
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("world")})
+	s.assert.Nil(err)
+	value, err = s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrETag})
+	s.assert.Nil(err)
+	s.assert.NotEqual(etag, value)
+
+	// Directories only carry an etag
+	_, err = s.az.GetXattr(internal.GetXattrOptions{Name: dir, Attr: xattrTier})
+	s.assert.Equal(syscall.ENODATA, err)
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: dir, Attr: xattrTier, Value: []byte("cool")})
+	s.assert.Equal(syscall.ENOTSUP, err)
+	names, err = s.az.ListXattr(internal.ListXattrOptions{Name: dir})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{xattrETag}, names)
+}
+
+func (s *memoryStoreTestSuite) TestVirtualXattrHNS() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  container: test\n  memory-hns: true\n  tier: cool")
+	name := generateFileName()
+
+	_, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+
+	value, err := s.az.GetXattr(internal.GetXattrOptions{Name: name, Attr: xattrTier})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("Cool"), value)
+
+	// Index tags are not available with hierarchical namespace
+	err = s.az.SetXattr(internal.SetXattrOptions{Name: name, Attr: xattrTagPrefix + "project", Value: []byte("alpha")})
+	s.assert.Equal(syscall.ENOTSUP, err)
+	names, err := s.az.ListXattr(internal.ListXattrOptions{Name: name})
+	s.assert.Nil(err)
+	s.assert.Equal([]string{xattrETag, xattrMD5, xattrTier}, names)
+}
+
+func (s *memoryStoreTestSuite) TestVersions() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  memory-versioning: true\n  show-versions: true")
+	dir := generateDirectoryName()
+	name := dir + "/" + generateFileName()
+
+	err := s.az.CreateDir(internal.CreateDirOptions{Name: dir})
+	s.assert.Nil(err)
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("first")})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("second")})
+	s.assert.Nil(err)
+
+	// Versions directory is not listed in the root but can be browsed
+	list, _, err := s.az.StreamDir(internal.StreamDirOptions{Name: ""})
+	s.assert.Nil(err)
+	s.assert.Len(list, 1)
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+
+	list, _, err = s.az.StreamDir(internal.StreamDirOptions{Name: versionsDirName})
+	s.assert.Nil(err)
+	s.assert.Len(list, 1)
+	s.assert.Equal(versionsDirName+"/"+dir, list[0].Path)
+	s.assert.True(list[0].IsDir())
+
+	// Files show up as directories holding their versions, creating the empty blob was the first one
+	list, _, err = s.az.StreamDir(internal.StreamDirOptions{Name: versionsDirName + "/" + dir})
+	s.assert.Nil(err)
+	s.assert.Len(list, 1)
+	s.assert.True(list[0].IsDir())
+
+	list, err = s.az.ReadDir(internal.ReadDirOptions{Name: versionsDirName + "/" + name})
+	s.assert.Nil(err)
+	s.assert.Len(list, 3)
+	s.assert.EqualValues(0, list[0].Size)
+	s.assert.EqualValues(len("first"), list[1].Size)
+	s.assert.False(list[1].IsDir())
+	s.assert.Equal(os.FileMode(0444), list[1].Mode)
+
+	version := versionsDirName + "/" + name + "/" + list[1].Name
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: version})
+	s.assert.Nil(err)
+	s.assert.EqualValues(len("first"), attr.Size)
+
+	_, err = s.az.OpenFile(internal.OpenFileOptions{Name: version, Flags: os.O_RDWR})
+	s.assert.Equal(syscall.EROFS, err)
+	vh, err := s.az.OpenFile(internal.OpenFileOptions{Name: version, Flags: os.O_RDONLY})
+	s.assert.Nil(err)
+
+	data, err := s.az.ReadFile(internal.ReadFileOptions{Handle: vh})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("first"), data)
+
+	buff := make([]byte, 3)
+	n, err := s.az.ReadInBuffer(internal.ReadInBufferOptions{Handle: vh, Offset: 2, Data: buff})
+	s.assert.Nil(err)
+	s.assert.Equal(3, n)
+	s.assert.Equal([]byte("rst"), buff)
+
+	f, err := os.CreateTemp("", "version")
+	s.assert.Nil(err)
+	defer os.Remove(f.Name())
+	err = s.az.CopyToFile(internal.CopyToFileOptions{Name: version, File: f})
+	s.assert.Nil(err)
+	data, err = os.ReadFile(f.Name())
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("first"), data)
+	f.Close()
+
+	// Versions view is read only
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: version})
+	s.assert.Equal(syscall.EROFS, err)
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: versionsDirName + "/new"})
+	s.assert.Equal(syscall.EROFS, err)
+	err = s.az.RenameFile(internal.RenameFileOptions{Src: name, Dst: versionsDirName + "/new"})
+	s.assert.Equal(syscall.EROFS, err)
+
+	// Versions of a deleted blob remain reachable
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.Nil(err)
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName + "/" + name})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+	list, err = s.az.ReadDir(internal.ReadDirOptions{Name: versionsDirName + "/" + name})
+	s.assert.Nil(err)
+	s.assert.Len(list, 3)
+
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName + "/" + name + "/missing"})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+// countingVersions : count the requests made to look up versions
+type countingVersions struct {
+	*MemoryStore
+	lists   int
+	lookups int
+}
+
+func (c *countingVersions) ListVersions(ctx context.Context, name string) ([]*internal.ObjAttr, error) {
+	c.lists++
+	return c.MemoryStore.ListVersions(ctx, name)
+}
+
+func (c *countingVersions) GetVersionAttr(ctx context.Context, name string, version string) (*internal.ObjAttr, error) {
+	c.lookups++
+	return c.MemoryStore.GetVersionAttr(ctx, name, version)
+}
+
+func (s *memoryStoreTestSuite) TestVersionLookup() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  memory-versioning: true\n  show-versions: true")
+	name := generateFileName()
+
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("data")})
+	s.assert.Nil(err)
+	// Blob whose name starts with the name of the other one does not add to its versions
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: name + "x"})
+	s.assert.Nil(err)
+
+	list, err := s.az.ReadDir(internal.ReadDirOptions{Name: versionsDirName + "/" + name})
+	s.assert.Nil(err)
+	s.assert.Len(list, 2)
+
+	// Version is resolved with a single lookup, without listing the versions of the blob
+	counting := &countingVersions{MemoryStore: s.az.storage.(*MemoryStore)}
+	s.az.storage = counting
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName + "/" + name + "/" + list[1].Name})
+	s.assert.Nil(err)
+	s.assert.EqualValues(len("data"), attr.Size)
+	s.assert.Equal(0, counting.lists)
+	s.assert.Equal(1, counting.lookups)
+
+	// Unknown version of the blob
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName + "/" + name + "/2000-01-01T00:00:00.0000000Z"})
+	s.assert.Equal(syscall.ENOENT, err)
+}
+
+func (s *memoryStoreTestSuite) TestVersionsDisabled() {
+	defer s.cleanupTest()
+	_, err := s.az.GetAttr(internal.GetAttrOptions{Name: versionsDirName})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: versionsDirName + "/file"})
+	s.assert.Nil(err)
+}
+
+func (s *memoryStoreTestSuite) TestTrash() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  memory-soft-delete: true\n  show-trash: true")
+	dir := generateDirectoryName()
+	name := dir + "/" + generateFileName()
+
+	err := s.az.CreateDir(internal.CreateDirOptions{Name: dir})
+	s.assert.Nil(err)
+	h, err := s.az.CreateFile(internal.CreateFileOptions{Name: name})
+	s.assert.Nil(err)
+	_, err = s.az.WriteFile(internal.WriteFileOptions{Handle: h, Offset: 0, Data: []byte("data")})
+	s.assert.Nil(err)
+
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: name})
+	s.assert.Nil(err)
+
+	// Trash directory is not listed in the root but can be browsed
+	list, _, err := s.az.StreamDir(internal.StreamDirOptions{Name: ""})
+	s.assert.Nil(err)
+	s.assert.Len(list, 1)
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: trashDirName})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+
+	list, err = s.az.ReadDir(internal.ReadDirOptions{Name: trashDirName + "/" + dir})
+	s.assert.Nil(err)
+	s.assert.Len(list, 1)
+	s.assert.Equal(trashDirName+"/"+name, list[0].Path)
+	s.assert.EqualValues(len("data"), list[0].Size)
+	s.assert.Equal(os.FileMode(0444), list[0].Mode)
+
+	deleted := trashDirName + "/" + name
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: deleted})
+	s.assert.Nil(err)
+	s.assert.False(attr.IsDir())
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: trashDirName + "/" + dir + "/missing"})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	// Deleted blobs can not be read or modified in place
+	_, err = s.az.OpenFile(internal.OpenFileOptions{Name: deleted, Flags: os.O_RDONLY})
+	s.assert.Equal(syscall.EACCES, err)
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: deleted})
+	s.assert.Equal(syscall.EROFS, err)
+	err = s.az.RenameFile(internal.RenameFileOptions{Src: dir + "/other", Dst: deleted})
+	s.assert.Equal(syscall.EROFS, err)
+
+	// Restore under a new name
+	restored := dir + "/restored"
+	err = s.az.RenameFile(internal.RenameFileOptions{Src: deleted, Dst: restored})
+	s.assert.Nil(err)
+	data, err := s.az.ReadFile(internal.ReadFileOptions{Handle: handlemap.NewHandle(restored)})
+	s.assert.Nil(err)
+	s.assert.Equal([]byte("data"), data)
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: name})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	// Deleting a directory moves the whole tree to trash, moving it back restores everything
+	err = s.az.DeleteDir(internal.DeleteDirOptions{Name: dir})
+	s.assert.Nil(err)
+	_, err = s.az.GetAttr(internal.GetAttrOptions{Name: restored})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	err = s.az.RenameFile(internal.RenameFileOptions{Src: trashDirName + "/" + dir, Dst: dir})
+	s.assert.Equal(syscall.EISDIR, err)
+	err = s.az.RenameDir(internal.RenameDirOptions{Src: trashDirName + "/" + dir, Dst: dir})
+	s.assert.Nil(err)
+	attr, err = s.az.GetAttr(internal.GetAttrOptions{Name: restored})
+	s.assert.Nil(err)
+	s.assert.EqualValues(len("data"), attr.Size)
+
+	// A live blob at the original path blocks the restore
+	err = s.az.DeleteFile(internal.DeleteFileOptions{Name: restored})
+	s.assert.Nil(err)
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: restored})
+	s.assert.Nil(err)
+	err = s.az.RenameFile(internal.RenameFileOptions{Src: trashDirName + "/" + restored, Dst: dir + "/other"})
+	s.assert.Equal(syscall.EEXIST, err)
+}
+
+func (s *memoryStoreTestSuite) TestTrashDisabled() {
+	defer s.cleanupTest()
+	_, err := s.az.GetAttr(internal.GetAttrOptions{Name: trashDirName})
+	s.assert.Equal(syscall.ENOENT, err)
+
+	_, err = s.az.CreateFile(internal.CreateFileOptions{Name: trashDirName + "/file"})
+	s.assert.Nil(err)
+}
+
+// failingRename : Fails the rename of one blob to simulate a directory rename cut short
+type failingRename struct {
+	*MemoryStore
+	failOn string
+}
+
+func (f *failingRename) RenameFile(ctx context.Context, source string, target string) error {
+	if source == f.failOn {
+		return syscall.EIO
+	}
+	return f.MemoryStore.RenameFile(ctx, source, target)
+}
+
+// setupRenameTree : Create a directory with files at two levels and return their names
+func (s *memoryStoreTestSuite) setupRenameTree(dir string, count int) []string {
+	err := s.az.CreateDir(internal.CreateDirOptions{Name: dir})
+	s.assert.Nil(err)
+	err = s.az.CreateDir(internal.CreateDirOptions{Name: dir + "/sub"})
+	s.assert.Nil(err)
+
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if i%2 == 0 {
+			name = "sub/" + name
+		}
+		_, err = s.az.CreateFile(internal.CreateFileOptions{Name: dir + "/" + name})
+		s.assert.Nil(err)
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s *memoryStoreTestSuite) TestRenameDirParallel() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	s.setupTestHelper("azstorage:\n  type: memory\n  rename-workers: 4")
+	src := generateDirectoryName()
+	dst := generateDirectoryName()
+	names := s.setupRenameTree(src, 100)
+
+	err := s.az.RenameDir(internal.RenameDirOptions{Src: src, Dst: dst})
+	s.assert.Nil(err)
+
+	for _, name := range names {
+		_, err = s.az.GetAttr(internal.GetAttrOptions{Name: src + "/" + name})
+		s.assert.Equal(syscall.ENOENT, err)
+		_, err = s.az.GetAttr(internal.GetAttrOptions{Name: dst + "/" + name})
+		s.assert.Nil(err)
+	}
+	attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: dst + "/sub"})
+	s.assert.Nil(err)
+	s.assert.True(attr.IsDir())
+}
+
+func (s *memoryStoreTestSuite) TestRenameDirJournal() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	journalPath, err := os.MkdirTemp("", "rename_journal")
+	s.assert.Nil(err)
+	defer os.RemoveAll(journalPath)
+
+	for _, recovery := range []string{renameRecoveryResume, renameRecoveryRollback} {
+		s.setupTestHelper(fmt.Sprintf("azstorage:\n  type: memory\n  container: test\n  rename-journal-path: %s\n  rename-recovery: %s", journalPath, recovery))
+		ms := s.az.storage.(*MemoryStore)
+		src := generateDirectoryName()
+		dst := generateDirectoryName()
+		names := s.setupRenameTree(src, 20)
+
+		// Child failing to move fails the rename and keeps the journal
+		renamer := newDirRenamer(&failingRename{MemoryStore: ms, failOn: src + "/" + names[5]}, ms.Config)
+		err = renamer.rename(context.Background(), src, dst)
+		s.assert.Equal(syscall.EIO, err)
+		journals, _ := os.ReadDir(renamer.journalDir)
+		s.assert.Len(journals, 1)
+		_, err = s.az.GetAttr(internal.GetAttrOptions{Name: src + "/" + names[5]})
+		s.assert.Nil(err)
+
+		// Journal held by another process is left alone
+		held, err := os.Open(filepath.Join(renamer.journalDir, journals[0].Name()))
+		s.assert.Nil(err)
+		err = syscall.Flock(int(held.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		s.assert.Nil(err)
+		err = ms.RecoverRenames(context.Background())
+		s.assert.Nil(err)
+		journals, _ = os.ReadDir(renamer.journalDir)
+		s.assert.Len(journals, 1)
+		held.Close()
+
+		err = ms.RecoverRenames(context.Background())
+		s.assert.Nil(err)
+		journals, _ = os.ReadDir(renamer.journalDir)
+		s.assert.Len(journals, 0)
+
+		expected, gone := dst, src
+		if recovery == renameRecoveryRollback {
+			expected, gone = src, dst
+		}
+		for _, name := range names {
+			_, err = s.az.GetAttr(internal.GetAttrOptions{Name: expected + "/" + name})
+			s.assert.Nil(err)
+			_, err = s.az.GetAttr(internal.GetAttrOptions{Name: gone + "/" + name})
+			s.assert.Equal(syscall.ENOENT, err)
+		}
+		attr, err := s.az.GetAttr(internal.GetAttrOptions{Name: expected})
+		s.assert.Nil(err)
+		s.assert.True(attr.IsDir())
+
+		s.cleanupTest()
+	}
+}
+
+func (s *memoryStoreTestSuite) TestRenameRecoveryOnStart() {
+	defer s.cleanupTest()
+	s.cleanupTest()
+	journalPath, err := os.MkdirTemp("", "rename_journal")
+	s.assert.Nil(err)
+	defer os.RemoveAll(journalPath)
+
+	s.setupTestHelper(fmt.Sprintf("azstorage:\n  type: memory\n  container: test\n  rename-journal-path: %s", journalPath))
+	ms := s.az.storage.(*MemoryStore)
+	src := generateDirectoryName()
+	dst := generateDirectoryName()
+	names := s.setupRenameTree(src, 10)
+
+	renamer := newDirRenamer(&failingRename{MemoryStore: ms, failOn: src + "/" + names[3]}, ms.Config)
+	err = renamer.rename(context.Background(), src, dst)
+	s.assert.Equal(syscall.EIO, err)
+
+	// Read-only mount does not touch the journal
+	_ = s.az.Stop()
+	s.az.readOnly = true
+	_ = s.az.Start(ctx)
+	s.assert.Nil(s.az.recoveryDone)
+	journals, _ := os.ReadDir(renamer.journalDir)
+	s.assert.Len(journals, 1)
+
+	// Start returns before the recovery running in the background is done
+	_ = s.az.Stop()
+	s.az.readOnly = false
+	_ = s.az.Start(ctx)
+	s.assert.NotNil(s.az.recoveryDone)
+	<-s.az.recoveryDone
+	journals, _ = os.ReadDir(renamer.journalDir)
+	s.assert.Len(journals, 0)
+	for _, name := range names {
+		_, err = s.az.GetAttr(internal.GetAttrOptions{Name: dst + "/" + name})
+		s.assert.Nil(err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	suite.Run(t, new(memoryStoreTestSuite))
+}
@@ -0,0 +1,480 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+)
+
+const (
+	defaultRenameWorkers = 16
+	renameJournalDirName = "rename_journal"
+	renameJournalExt     = ".journal"
+	renameJournalNewExt  = ".new" // journal being created, not picked up by recovery before its header is written
+
+	// What to do with a directory rename interrupted by a crash or unmount, checked on next mount
+	renameRecoveryResume   = "resume"
+	renameRecoveryRollback = "rollback"
+	renameRecoveryNone     = "none"
+
+	// Journal record types
+	journalRename = "rename"
+	journalStart  = "start"
+	journalDone   = "done"
+)
+
+// renameBackend : Operations a directory rename on flat namespace is built from
+type renameBackend interface {
+	// listTree : names of all blobs under a directory, at any depth, in lexical order
+	listTree(ctx context.Context, dir string, marker *string) ([]string, *string, error)
+	RenameFile(ctx context.Context, source string, target string) error
+	DeleteFile(ctx context.Context, name string) error
+	GetAttr(ctx context.Context, name string) (*internal.ObjAttr, error)
+}
+
+// journalRecord : One line of the rename journal
+type journalRecord struct {
+	Op     string `json:"op"`
+	Source string `json:"src"`
+	Target string `json:"dst,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// renameJournal : Append only log of a directory rename.
+// First record names the source and target directories, then every blob gets a start record before it is copied and
+// a done record once the source is deleted. The file is removed when the rename completes.
+// Process running or recovering the rename holds an exclusive flock on the file, other mounts leave it alone.
+type renameJournal struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// dirRenamer : Renames a directory on flat namespace by moving its blobs with a pool of workers
+type dirRenamer struct {
+	backend    renameBackend
+	workers    int
+	journalDir string
+	prefix     string
+	recovery   string
+}
+
+func newDirRenamer(backend renameBackend, cfg AzStorageConfig) *dirRenamer {
+	r := &dirRenamer{
+		backend:  backend,
+		workers:  int(cfg.renameWorkers),
+		prefix:   cfg.prefixPath,
+		recovery: cfg.renameRecovery,
+	}
+
+	if r.workers <= 0 {
+		r.workers = defaultRenameWorkers
+	}
+
+	// Journals of different containers and accounts sharing the work directory are kept apart
+	if cfg.renameJournalPath != "" {
+		r.journalDir = filepath.Join(cfg.renameJournalPath, strings.Trim(cfg.authConfig.AccountName+"_"+cfg.container, "_"))
+	}
+
+	return r
+}
+
+// rename : Move all blobs of the source directory and then the directory marker
+func (r *dirRenamer) rename(ctx context.Context, source string, target string) error {
+	journal, err := r.createJournal(source, target)
+	if err != nil {
+		return err
+	}
+
+	err = r.moveChildren(ctx, journal, source, target)
+	if err != nil {
+		// Journal stays behind so the rename can be finished or undone on next mount
+		journal.close()
+		return err
+	}
+
+	// Directory may exist only virtually, in that case the children are moved but the marker rename fails
+	journal.record(journalStart, source)
+	err = r.backend.RenameFile(ctx, source, target)
+	journal.record(journalDone, source)
+	journal.remove()
+
+	return err
+}
+
+// moveChildren : Move every blob under the source directory, stops at the first failure
+func (r *dirRenamer) moveChildren(ctx context.Context, journal *renameJournal, source string, target string) error {
+	jobs := make(chan string, r.workers)
+	wg := sync.WaitGroup{}
+
+	var errLock sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		errLock.Lock()
+		defer errLock.Unlock()
+		return firstErr != nil
+	}
+
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				if failed() {
+					continue
+				}
+
+				journal.record(journalStart, name)
+				err := r.backend.RenameFile(ctx, name, target+strings.TrimPrefix(name, source))
+				if err == syscall.ENOENT {
+					// Deleted since it was listed, nothing left to move
+					err = nil
+				}
+				if err != nil {
+					log.Err("dirRenamer::moveChildren : Failed to rename %s [%s]", name, err.Error())
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+					continue
+				}
+				journal.record(journalDone, name)
+			}
+		}()
+	}
+
+	// Listing continues after the last name returned, so blobs moved away meanwhile do not make it skip any
+	var marker *string = nil
+	for !failed() {
+		names, next, err := r.backend.listTree(ctx, source, marker)
+		if err != nil {
+			log.Err("dirRenamer::moveChildren : Failed to list %s [%s]", source, err.Error())
+			errLock.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errLock.Unlock()
+			break
+		}
+
+		for _, name := range names {
+			jobs <- name
+		}
+
+		if next == nil || *next == "" {
+			break
+		}
+		marker = next
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// recover : Resume or roll back renames a previous mount did not finish.
+// Journals locked by another process belong to renames still running there and are skipped.
+func (r *dirRenamer) recover(ctx context.Context) error {
+	if r.journalDir == "" {
+		return nil
+	}
+
+	journals, err := filepath.Glob(filepath.Join(r.journalDir, "*"+renameJournalExt))
+	if err != nil || len(journals) == 0 {
+		return err
+	}
+	sort.Strings(journals)
+
+	for _, path := range journals {
+		if r.recovery == renameRecoveryNone {
+			log.Warn("dirRenamer::recover : Unfinished rename found in %s, leaving it as recovery is disabled", path)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		journal, err := lockRenameJournal(path)
+		if err == syscall.EWOULDBLOCK {
+			log.Info("dirRenamer::recover : %s is in use by another process, skipping", path)
+			continue
+		} else if os.IsNotExist(err) {
+			// Rename completed while the journal was being locked
+			continue
+		} else if err != nil {
+			log.Err("dirRenamer::recover : Failed to lock %s [%s]", path, err.Error())
+			return err
+		}
+
+		err = r.recoverJournal(ctx, journal)
+		if err != nil {
+			log.Err("dirRenamer::recover : Failed to recover rename from %s [%s]", path, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recoverJournal : Finish or undo a single interrupted rename, journal is locked by the caller and closed here
+func (r *dirRenamer) recoverJournal(ctx context.Context, journal *renameJournal) error {
+	header, moves, err := readRenameJournal(journal.path)
+	if err != nil {
+		journal.close()
+		return err
+	}
+
+	if header.Prefix != r.prefix {
+		log.Warn("dirRenamer::recoverJournal : %s belongs to subdirectory %s, skipping", journal.path, header.Prefix)
+		journal.close()
+		return nil
+	}
+
+	log.Info("dirRenamer::recoverJournal : %s of %s -> %s, %d blobs touched", r.recovery, header.Source, header.Target, len(moves))
+
+	if r.recovery == renameRecoveryRollback {
+		err = r.rollback(ctx, header, moves)
+		if err != nil {
+			journal.close()
+			return err
+		}
+		journal.remove()
+		return nil
+	}
+
+	err = r.moveChildren(ctx, journal, header.Source, header.Target)
+	if err != nil {
+		journal.close()
+		return err
+	}
+
+	err = r.backend.RenameFile(ctx, header.Source, header.Target)
+	journal.remove()
+	if err == syscall.ENOENT {
+		err = nil
+	}
+	return err
+}
+
+// rollback : Move back every blob the interrupted rename touched
+func (r *dirRenamer) rollback(ctx context.Context, header journalRecord, moves map[string]bool) error {
+	for name, done := range moves {
+		moved := header.Target + strings.TrimPrefix(name, header.Source)
+
+		if !done {
+			if _, err := r.backend.GetAttr(ctx, name); err == nil {
+				// Source is still there, any blob at the target is a copy which did not complete
+				err = r.backend.DeleteFile(ctx, moved)
+				if err != nil && err != syscall.ENOENT {
+					return err
+				}
+				continue
+			}
+		}
+
+		err := r.backend.RenameFile(ctx, moved, name)
+		if err != nil && err != syscall.ENOENT {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createJournal : Start the journal of a new rename, nil when journaling is disabled
+func (r *dirRenamer) createJournal(source string, target string) (*renameJournal, error) {
+	if r.journalDir == "" {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(r.journalDir, 0700)
+	if err != nil {
+		log.Err("dirRenamer::createJournal : Failed to create %s [%s]", r.journalDir, err.Error())
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(r.journalDir, "*"+renameJournalExt+renameJournalNewExt)
+	if err != nil {
+		log.Err("dirRenamer::createJournal : Failed to create journal in %s [%s]", r.journalDir, err.Error())
+		return nil, err
+	}
+
+	journal := &renameJournal{path: f.Name(), file: f, encoder: json.NewEncoder(f)}
+
+	// Lock is held till the rename is done, it moves along with the file when it is given its final name
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == nil {
+		err = journal.encoder.Encode(journalRecord{Op: journalRename, Source: source, Target: target, Prefix: r.prefix})
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		path := strings.TrimSuffix(journal.path, renameJournalNewExt)
+		err = os.Rename(journal.path, path)
+		if err == nil {
+			journal.path = path
+		}
+	}
+	if err != nil {
+		log.Err("dirRenamer::createJournal : Failed to write %s [%s]", journal.path, err.Error())
+		journal.remove()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// lockRenameJournal : Reopen the journal of an interrupted rename to continue it.
+// Fails with EWOULDBLOCK while another process holds the journal.
+func lockRenameJournal(path string) (*renameJournal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// Owner removes the journal before it lets go of the lock, a file which is gone now belongs to a finished rename
+	opened, err := f.Stat()
+	if err == nil {
+		var current os.FileInfo
+		current, err = os.Stat(path)
+		if err == nil && !os.SameFile(opened, current) {
+			err = os.ErrNotExist
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &renameJournal{path: path, file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+// readRenameJournal : Get the rename a journal describes and the blobs it touched, true for the ones fully moved.
+// A record cut short by a crash can only be the last one and is ignored.
+func readRenameJournal(path string) (journalRecord, map[string]bool, error) {
+	header := journalRecord{}
+	moves := make(map[string]bool)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return header, moves, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	err = decoder.Decode(&header)
+	if err != nil || header.Op != journalRename {
+		return header, moves, errors.New("invalid rename journal " + path)
+	}
+
+	for {
+		rec := journalRecord{}
+		err = decoder.Decode(&rec)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Warn("readRenameJournal : Ignoring trailing record of %s [%s]", path, err.Error())
+			break
+		}
+
+		switch rec.Op {
+		case journalStart:
+			if _, found := moves[rec.Source]; !found {
+				moves[rec.Source] = false
+			}
+		case journalDone:
+			moves[rec.Source] = true
+		}
+	}
+
+	return header, moves, nil
+}
+
+// record : Append a record, journal is best effort so a failure to write it does not fail the rename
+func (j *renameJournal) record(op string, name string) {
+	if j == nil {
+		return
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	err := j.encoder.Encode(journalRecord{Op: op, Source: name})
+	if err != nil {
+		log.Err("renameJournal::record : Failed to write %s [%s]", j.path, err.Error())
+	}
+}
+
+func (j *renameJournal) close() {
+	if j != nil {
+		_ = j.file.Close()
+	}
+}
+
+// remove : Rename is complete, drop its journal.
+// File is removed before it is closed so no other process can lock it in between and take the rename for unfinished.
+func (j *renameJournal) remove() {
+	if j == nil {
+		return
+	}
+
+	err := os.Remove(j.path)
+	if err != nil {
+		log.Err("renameJournal::remove : Failed to remove %s [%s]", j.path, err.Error())
+	}
+	j.close()
+}
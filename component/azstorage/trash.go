@@ -0,0 +1,232 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
+)
+
+// Read only view of soft deleted blobs, a deleted blob is restored by renaming it out of this directory
+const trashDirName = ".trash"
+
+// isTrashPath : Check whether a path lies in the virtual trash directory
+func (az *AzStorage) isTrashPath(name string) bool {
+	return az.stConfig.showTrash && isUnderVirtualDir(name, trashDirName)
+}
+
+// isVirtualPath : Check whether a path lies in any of the virtual directories, those can not be modified
+func (az *AzStorage) isVirtualPath(name string) bool {
+	return az.isVersionsPath(name) || az.isTrashPath(name)
+}
+
+// findDeleted : Get the attributes of a deleted blob or of a directory holding deleted blobs
+func (az *AzStorage) findDeleted(ctx context.Context, name string) (*internal.ObjAttr, error) {
+	prefix := ""
+	if parent := filepath.Dir(name); parent != "." {
+		prefix = internal.ExtendDirName(parent)
+	}
+
+	var marker *string = nil
+	for {
+		list, next, err := az.storage.ListDeleted(ctx, prefix, marker, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attr := range list {
+			if attr.Path == name {
+				return attr, nil
+			}
+		}
+
+		if next == nil || *next == "" {
+			return nil, syscall.ENOENT
+		}
+		marker = next
+	}
+}
+
+// getTrashAttr : Resolve a path of the trash view
+func (az *AzStorage) getTrashAttr(ctx context.Context, name string) (*internal.ObjAttr, error) {
+	blob := virtualTarget(name, trashDirName)
+	path := filepath.Join(trashDirName, blob)
+	if blob == "" {
+		return newVirtualDirAttr(path, time.Now()), nil
+	}
+
+	attr, err := az.findDeleted(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+
+	if attr.IsDir() {
+		return newVirtualDirAttr(path, attr.Mtime), nil
+	}
+	return toVirtualFileAttr(filepath.Dir(path), attr), nil
+}
+
+// streamTrashDir : List a directory of the trash view
+func (az *AzStorage) streamTrashDir(options internal.StreamDirOptions) ([]*internal.ObjAttr, string, error) {
+	ctx := requestContext(options.Ctx)
+	dir := virtualTarget(options.Name, trashDirName)
+
+	list, marker, err := az.storage.ListDeleted(ctx, formatListDirName(dir), &options.Token, options.Count)
+	if err != nil {
+		log.Err("AzStorage::streamTrashDir : Failed to list deleted blobs of %s [%s]", dir, err.Error())
+		return nil, "", err
+	}
+
+	entries := make([]*internal.ObjAttr, 0, len(list))
+	for _, attr := range list {
+		if attr.IsDir() {
+			entries = append(entries, newVirtualDirAttr(filepath.Join(trashDirName, attr.Path), attr.Mtime))
+		} else {
+			entries = append(entries, toVirtualFileAttr(filepath.Join(trashDirName, filepath.Dir(attr.Path)), attr))
+		}
+	}
+
+	if marker == nil {
+		return entries, "", nil
+	}
+	return entries, *marker, nil
+}
+
+// trashNotReadable : Deleted blobs can not be read till they are restored
+func (az *AzStorage) trashNotReadable(name string) error {
+	log.Err("AzStorage::trashNotReadable : %s can not be read, move it out of %s to restore it first", name, trashDirName)
+	return syscall.EACCES
+}
+
+// restoreFile : Undelete a blob and move it to the destination if that is not where it was deleted from
+func (az *AzStorage) restoreFile(ctx context.Context, src string, dst string) error {
+	blob := virtualTarget(src, trashDirName)
+	dst = internal.TruncateDirName(strings.TrimPrefix(dst, "/"))
+
+	attr, err := az.getTrashAttr(ctx, src)
+	if err != nil {
+		return err
+	} else if attr.IsDir() {
+		return syscall.EISDIR
+	}
+
+	// Undelete always restores to the original path, a new blob created there since would be kept instead
+	if _, err = az.storage.GetAttr(ctx, blob); err == nil {
+		log.Err("AzStorage::restoreFile : %s exists, move or delete it to restore the deleted blob", blob)
+		return syscall.EEXIST
+	}
+
+	err = az.storage.Undelete(ctx, blob)
+	if err != nil {
+		log.Err("AzStorage::restoreFile : Failed to undelete %s [%s]", blob, err.Error())
+		return err
+	}
+	az.recordUndelete(blob, dst)
+
+	if dst != blob {
+		return az.storage.RenameFile(ctx, blob, dst)
+	}
+	return nil
+}
+
+// restoreDir : Undelete everything under a directory and move it to the destination if that is not where it was deleted from
+func (az *AzStorage) restoreDir(ctx context.Context, src string, dst string) error {
+	dir := virtualTarget(src, trashDirName)
+	dst = internal.TruncateDirName(strings.TrimPrefix(dst, "/"))
+
+	attr, err := az.getTrashAttr(ctx, src)
+	if err != nil {
+		return err
+	} else if !attr.IsDir() {
+		return syscall.ENOTDIR
+	}
+
+	err = az.undeleteTree(ctx, dir)
+	if err != nil {
+		log.Err("AzStorage::restoreDir : Failed to undelete %s [%s]", dir, err.Error())
+		return err
+	}
+	az.recordUndelete(dir, dst)
+
+	if dst != dir {
+		return az.storage.RenameDirectory(ctx, dir, dst)
+	}
+	return nil
+}
+
+// undeleteTree : Undelete a directory and all deleted blobs under it.
+// With hierarchical namespace restoring the directory restores its children, with flat namespace every blob
+// is restored on its own and the directory itself may not have a marker blob at all.
+func (az *AzStorage) undeleteTree(ctx context.Context, dir string) error {
+	err := az.storage.Undelete(ctx, dir)
+	if err != nil && err != syscall.ENOENT {
+		return err
+	}
+
+	var marker *string = nil
+	for {
+		list, next, err := az.storage.ListDeleted(ctx, internal.ExtendDirName(dir), marker, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, attr := range list {
+			if attr.IsDir() {
+				err = az.undeleteTree(ctx, attr.Path)
+			} else {
+				err = az.storage.Undelete(ctx, attr.Path)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == nil || *next == "" {
+			return nil
+		}
+		marker = next
+	}
+}
+
+func (az *AzStorage) recordUndelete(name string, dst string) {
+	azStatsCollector.PushEvents(undelete, name, map[string]interface{}{target: dst})
+	azStatsCollector.UpdateStats(stats_manager.Increment, undelete, (int64)(1))
+}
@@ -46,12 +46,17 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/common/tracing"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 
 	"github.com/Azure/azure-storage-azcopy/v10/azbfs"
 	"github.com/Azure/azure-storage-azcopy/v10/ste"
@@ -212,6 +217,101 @@ func newBlobfuse2HTTPClientFactory(pipelineHTTPClient *http.Client) pipeline.Fac
 	})
 }
 
+// requestContext : Context the storage calls of an operation are made with.
+// Options of a traced FUSE operation carry its span, which the http pipeline picks up from here.
+func requestContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+type tryCountKey struct{}
+
+// newRequestStatsPolicyFactory : Count the requests sent to the service and those which failed after all retries.
+// Sits above the retry policy so it sees each request once, tries are counted by the policy below it.
+func newRequestStatsPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			if azStatsCollector == nil || !common.CollectStats() {
+				return next.Do(ctx, request)
+			}
+
+			tries := new(int32)
+			response, err := next.Do(context.WithValue(ctx, tryCountKey{}, tries), request)
+
+			azStatsCollector.UpdateStats(stats_manager.Increment, storageRequests, (int64)(1))
+			if retries := atomic.LoadInt32(tries) - 1; retries > 0 {
+				azStatsCollector.UpdateStats(stats_manager.Increment, storageRetries, (int64)(retries))
+			}
+			if err != nil {
+				azStatsCollector.UpdateStats(stats_manager.Increment, storageErrors, (int64)(1))
+			}
+			return response, err
+		}
+	})
+}
+
+// newTryStatsPolicyFactory : Count the tries made by the retry policy for the request above it
+func newTryStatsPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			if tries, ok := ctx.Value(tryCountKey{}).(*int32); ok {
+				atomic.AddInt32(tries, 1)
+			}
+			return next.Do(ctx, request)
+		}
+	})
+}
+
+// newRequestTracingPolicyFactory : Span covering a request to the service and all its retries, child of the traced operation
+func newRequestTracingPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			// Query string is left out as it may hold a SAS
+			ctx, span := tracing.StartSpan(ctx, "azstorage.request",
+				tracing.Attribute{Key: "http.method", Value: request.Method},
+				tracing.Attribute{Key: "url.path", Value: request.URL.Path},
+				tracing.Attribute{Key: "azure.comp", Value: request.URL.Query().Get("comp")})
+			if span == nil {
+				return next.Do(ctx, request)
+			}
+
+			response, err := next.Do(ctx, request)
+			if response != nil && response.Response() != nil {
+				span.SetAttributes(tracing.Attribute{Key: "http.status_code", Value: response.Response().StatusCode})
+			}
+			span.SetError(err)
+			span.End()
+			return response, err
+		}
+	})
+}
+
+// newTryTracingPolicyFactory : Span for each try of a request, so time lost to retries shows up in the trace.
+// Service gets the id of the try in the traceparent header.
+func newTryTracingPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			ctx, span := tracing.StartSpan(ctx, "azstorage.try")
+			if span == nil {
+				return next.Do(ctx, request)
+			}
+
+			request.Header.Set("traceparent", span.TraceParent())
+			response, err := next.Do(ctx, request)
+			if response != nil && response.Response() != nil {
+				span.SetAttributes(
+					tracing.Attribute{Key: "http.status_code", Value: response.Response().StatusCode},
+					tracing.Attribute{Key: "azure.request_id", Value: response.Response().Header.Get("x-ms-request-id")})
+			}
+			span.SetError(err)
+			span.End()
+			return response, err
+		}
+	})
+}
+
 func getLogOptions(sdkLogging bool) pipeline.LogOptions {
 	return pipeline.LogOptions{
 		Log: func(logLevel pipeline.LogLevel, message string) {
@@ -282,6 +382,8 @@ const (
 	InvalidRange
 	BlobIsUnderLease
 	InvalidPermission
+	ConditionNotMet
+	LeaseAlreadyPresent
 )
 
 // ErrStr : Store error to string mapping
@@ -304,10 +406,14 @@ func storeBlobErrToErr(err error) uint16 {
 			return ErrFileNotFound
 		case azblob.ServiceCodeInvalidRange:
 			return InvalidRange
-		case azblob.ServiceCodeLeaseIDMissing:
+		case azblob.ServiceCodeLeaseIDMissing, azblob.ServiceCodeLeaseIDMismatchWithBlobOperation:
 			return BlobIsUnderLease
 		case azblob.ServiceCodeInsufficientAccountPermissions:
 			return InvalidPermission
+		case azblob.ServiceCodeConditionNotMet:
+			return ConditionNotMet
+		case azblob.ServiceCodeLeaseAlreadyPresent:
+			return LeaseAlreadyPresent
 		default:
 			return ErrUnknown
 		}
@@ -376,6 +482,38 @@ func parseMetadata(attr *internal.ObjAttr, metadata map[string]string) {
 	}
 }
 
+// Metadata keys are sent as http header suffixes and need to be valid C# identifiers
+var metadataKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// xattrToMetadataKey : Map the name of an extended attribute to its metadata key, only the user namespace is backed by metadata
+func xattrToMetadataKey(name string) (string, error) {
+	if !strings.HasPrefix(name, internal.XattrUserPrefix) {
+		return "", syscall.ENOTSUP
+	}
+
+	key := strings.TrimPrefix(name, internal.XattrUserPrefix)
+	if !metadataKeyRegex.MatchString(key) {
+		return "", syscall.EINVAL
+	}
+	return key, nil
+}
+
+// isReservedMetadataKey : Metadata keys which blobfuse uses to mark directories and symlinks
+func isReservedMetadataKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == folderKey || key == symlinkKey
+}
+
+// isValidMetadataValue : Metadata values are sent as http header values so only printable ascii is allowed
+func isValidMetadataValue(value []byte) bool {
+	for _, c := range value {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
 //    ----------- Content-type handling  ---------------
 
 // ContentTypeMap : Store file extension to content-type mapping
@@ -571,7 +709,7 @@ func sanitizeSASKey(key string) string {
 	return key
 }
 
-func getMD5(fi *os.File) ([]byte, error) {
+func getMD5(fi io.Reader) ([]byte, error) {
 	hasher := md5.New()
 	_, err := io.Copy(hasher, fi)
 
@@ -589,9 +727,55 @@ func autoDetectAuthMode(opt AzStorageOptions) string {
 		return "key"
 	} else if opt.SaSKey != "" {
 		return "sas"
-	} else if opt.ClientID != "" || opt.ClientSecret != "" || opt.TenantID != "" {
+	} else if opt.ClientSecret != "" {
+		return "spn"
+	} else if opt.ClientCertPath != "" {
+		return "spncert"
+	} else if opt.FederatedTokenFile != "" {
+		return "clientassertion"
+	} else if opt.ClientID != "" || opt.TenantID != "" {
 		return "spn"
 	}
 
 	return "msi"
 }
+
+//    ----------- Virtual directories  ---------------
+
+// isUnderVirtualDir : Check whether a path is the given virtual directory in the root of the mount or lies in it
+func isUnderVirtualDir(name string, dir string) bool {
+	name = strings.TrimPrefix(name, "/")
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// virtualTarget : Get the real path a path of a virtual directory refers to, empty for the virtual directory itself
+func virtualTarget(name string, dir string) string {
+	name = internal.TruncateDirName(strings.TrimPrefix(name, "/"))
+	return strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+}
+
+// newVirtualDirAttr : Attributes of a read only directory in a virtual directory
+func newVirtualDirAttr(name string, mtime time.Time) *internal.ObjAttr {
+	attr := &internal.ObjAttr{
+		Path:   name,
+		Name:   filepath.Base(name),
+		Size:   4096,
+		Mode:   os.ModeDir | 0555,
+		Mtime:  mtime,
+		Atime:  mtime,
+		Ctime:  mtime,
+		Crtime: mtime,
+		Flags:  internal.NewDirBitMap(),
+	}
+	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+	return attr
+}
+
+// toVirtualFileAttr : Turn attributes returned by storage into a read only file of a virtual directory
+func toVirtualFileAttr(dir string, attr *internal.ObjAttr) *internal.ObjAttr {
+	attr.Path = filepath.Join(dir, attr.Name)
+	attr.Mode = 0444
+	attr.Flags = internal.NewFileBitMap()
+	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
+	return attr
+}
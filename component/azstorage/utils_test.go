@@ -34,9 +34,19 @@
 package azstorage
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/azure-storage-fuse/v2/common"
@@ -324,6 +334,15 @@ func (s *utilsTestSuite) TestFormatEndpointAccountType() {
 		{endpoint: "https://account.z99.blob.core.usgovcloudapi.net", account: EAccountType.ADLS(), result: "https://account.z99.dfs.core.usgovcloudapi.net"},
 		{endpoint: "https://account.z99.dfs.core.usgovcloudapi.net", account: EAccountType.BLOCK(), result: "https://account.z99.blob.core.usgovcloudapi.net"},
 		{endpoint: "https://account.z99.dfs.core.usgovcloudapi.net", account: EAccountType.ADLS(), result: "https://account.z99.dfs.core.usgovcloudapi.net"},
+
+		// Path style emulator endpoint
+		{endpoint: "http://127.0.0.1:10000/devstoreaccount1/", account: EAccountType.BLOCK(), result: "http://127.0.0.1:10000/devstoreaccount1/"},
+		{endpoint: "http://127.0.0.1:10000/devstoreaccount1/", account: EAccountType.ADLS(), result: "http://127.0.0.1:10000/devstoreaccount1/"},
+		{endpoint: "http://localhost:10000/devstoreaccount1/", account: EAccountType.ADLS(), result: "http://localhost:10000/devstoreaccount1/"},
+		{endpoint: "http://[::1]:10000/devstoreaccount1/", account: EAccountType.ADLS(), result: "http://[::1]:10000/devstoreaccount1/"},
+
+		// Path is not enough to take a named host for path style, use-path-style says so
+		{endpoint: "http://azurite.blob.local:10000/devstoreaccount1/", account: EAccountType.ADLS(), result: "http://azurite.dfs.local:10000/devstoreaccount1/"},
 	}
 	for _, i := range inputs {
 		s.Run(i.endpoint+","+i.account.String(), func() {
@@ -350,6 +369,8 @@ func (s *utilsTestSuite) TestFormatEndpointProtocol() {
 		{endpoint: "account.bl://ob.core.windows.net", result: "http://account.bl://ob.core.windows.net/", ustHttp: true},
 		{endpoint: "https://account.blob.core.windows.net/", result: "https://account.blob.core.windows.net/", ustHttp: true},
 		{endpoint: "https://account.blob.core.windows.net/abc", result: "https://account.blob.core.windows.net/abc/", ustHttp: true},
+		{endpoint: "127.0.0.1:10000/devstoreaccount1", result: "http://127.0.0.1:10000/devstoreaccount1/", ustHttp: true},
+		{endpoint: "http://127.0.0.1:10000/devstoreaccount1/", result: "http://127.0.0.1:10000/devstoreaccount1/", ustHttp: false},
 
 		// These are false positive test cases where we are forming the wrong URI and it shall fail for user when used in blobfuse
 		{endpoint: "://account.blob.core.windows.net", result: "https://://account.blob.core.windows.net/", ustHttp: false},
@@ -365,6 +386,32 @@ func (s *utilsTestSuite) TestFormatEndpointProtocol() {
 	}
 }
 
+func (s *utilsTestSuite) TestIsPathStyleEndpoint() {
+	assert := assert.New(s.T())
+	var inputs = []struct {
+		endpoint string
+		result   bool
+	}{
+		{endpoint: "https://account.blob.core.windows.net/", result: false},
+		{endpoint: "https://account.dfs.core.windows.net", result: false},
+		{endpoint: "https://myprivateendpoint.net/", result: false},
+		{endpoint: "http://127.0.0.1:10000/devstoreaccount1/", result: true},
+		{endpoint: "http://127.0.0.1:10000/", result: true},
+		{endpoint: "http://[::1]:10000/devstoreaccount1/", result: true},
+		{endpoint: "http://localhost:10000/devstoreaccount1/", result: true},
+		{endpoint: "http://azurite:10000/devstoreaccount1/", result: false},
+		{endpoint: "https://account.blob.core.windows.net/container", result: false},
+		{endpoint: "account.blob.core.windows.net", result: false},
+		{endpoint: "", result: false},
+	}
+
+	for _, i := range inputs {
+		s.Run(i.endpoint, func() {
+			assert.Equal(i.result, isPathStyleEndpoint(i.endpoint))
+		})
+	}
+}
+
 func (s *utilsTestSuite) TestAutoDetectAuthMode() {
 	assert := assert.New(s.T())
 
@@ -406,6 +453,168 @@ func (s *utilsTestSuite) TestAutoDetectAuthMode() {
 
 	authType = autoDetectAuthMode(AzStorageOptions{SaSKey: "abc", ClientID: "abc"})
 	assert.Equal(authType, "sas")
+
+	authType = autoDetectAuthMode(AzStorageOptions{ClientID: "abc", ClientCertPath: "abc"})
+	assert.Equal(authType, "spncert")
+
+	authType = autoDetectAuthMode(AzStorageOptions{ClientID: "abc", FederatedTokenFile: "abc"})
+	assert.Equal(authType, "clientassertion")
+
+	authType = autoDetectAuthMode(AzStorageOptions{ClientSecret: "abc", ClientCertPath: "abc", FederatedTokenFile: "abc"})
+	assert.Equal(authType, "spn")
+
+	authType = autoDetectAuthMode(AzStorageOptions{ClientCertPath: "abc", FederatedTokenFile: "abc"})
+	assert.Equal(authType, "spncert")
+
+	for _, mode := range []string{"spncert", "clientassertion", "azcli"} {
+		err := authType_.Parse(mode)
+		assert.Nil(err)
+	}
+}
+
+func (s *utilsTestSuite) TestFederatedTokenFileSecret() {
+	assert := assert.New(s.T())
+
+	path := filepath.Join(s.T().TempDir(), "token")
+	secret := &federatedTokenFileSecret{path: path}
+
+	v := url.Values{}
+	err := secret.SetAuthenticationValues(nil, &v)
+	assert.NotNil(err)
+
+	err = ioutil.WriteFile(path, []byte("first\n"), 0600)
+	assert.Nil(err)
+	err = secret.SetAuthenticationValues(nil, &v)
+	assert.Nil(err)
+	assert.Equal("first", v.Get("client_assertion"))
+	assert.Equal("urn:ietf:params:oauth:client-assertion-type:jwt-bearer", v.Get("client_assertion_type"))
+
+	// Token is read again on every request as it gets rotated
+	err = ioutil.WriteFile(path, []byte("second"), 0600)
+	assert.Nil(err)
+	err = secret.SetAuthenticationValues(nil, &v)
+	assert.Nil(err)
+	assert.Equal("second", v.Get("client_assertion"))
+
+	err = ioutil.WriteFile(path, []byte(" \n"), 0600)
+	assert.Nil(err)
+	err = secret.SetAuthenticationValues(nil, &v)
+	assert.NotNil(err)
+}
+
+func generateTestCertificate(assert *assert.Assertions) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "blobfuse2"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(err)
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func (s *utilsTestSuite) TestReadClientCertificate() {
+	assert := assert.New(s.T())
+	dir := s.T().TempDir()
+
+	key, certPem := generateTestCertificate(assert)
+	otherKey, otherCertPem := generateTestCertificate(assert)
+
+	// PKCS1 key after a chain holding another certificate
+	pkcs1 := filepath.Join(dir, "pkcs1.pem")
+	data := append(append([]byte{}, otherCertPem...), certPem...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	assert.Nil(ioutil.WriteFile(pkcs1, data, 0600))
+
+	cert, readKey, err := readClientCertificate(pkcs1, "")
+	assert.Nil(err)
+	assert.Equal(key.N, readKey.N)
+	assert.Equal("blobfuse2", cert.Subject.CommonName)
+	assert.Equal(key.N, cert.PublicKey.(*rsa.PublicKey).N)
+
+	// PKCS8 key before the certificate
+	pkcs8 := filepath.Join(dir, "pkcs8.pem")
+	der, err := x509.MarshalPKCS8PrivateKey(otherKey)
+	assert.Nil(err)
+	data = append(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), otherCertPem...)
+	assert.Nil(ioutil.WriteFile(pkcs8, data, 0600))
+
+	cert, readKey, err = readClientCertificate(pkcs8, "")
+	assert.Nil(err)
+	assert.Equal(otherKey.N, readKey.N)
+	assert.Equal(otherKey.N, cert.PublicKey.(*rsa.PublicKey).N)
+
+	// Key without its certificate
+	mismatch := filepath.Join(dir, "mismatch.pem")
+	data = append(append([]byte{}, certPem...), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(otherKey)})...)
+	assert.Nil(ioutil.WriteFile(mismatch, data, 0600))
+	_, _, err = readClientCertificate(mismatch, "")
+	assert.NotNil(err)
+
+	noKey := filepath.Join(dir, "nokey.pem")
+	assert.Nil(ioutil.WriteFile(noKey, certPem, 0600))
+	_, _, err = readClientCertificate(noKey, "")
+	assert.NotNil(err)
+
+	_, _, err = readClientCertificate(filepath.Join(dir, "missing.pem"), "")
+	assert.NotNil(err)
+}
+
+func (s *utilsTestSuite) TestParseCLIToken() {
+	assert := assert.New(s.T())
+
+	token, expires, err := parseCLIToken([]byte(`{"accessToken": "abc", "expiresOn": "2023-01-02 10:20:30.123456", "expires_on": 1672654830, "tokenType": "Bearer"}`))
+	assert.Nil(err)
+	assert.Equal("abc", token)
+	assert.Equal(int64(1672654830), expires.Unix())
+
+	token, expires, err = parseCLIToken([]byte(`{"accessToken": "abc", "expiresOn": "2023-01-02 10:20:30.123456"}`))
+	assert.Nil(err)
+	assert.Equal("abc", token)
+	assert.Equal(time.Date(2023, 1, 2, 10, 20, 30, 123456000, time.Local), expires)
+
+	_, _, err = parseCLIToken([]byte(`{"accessToken": "abc", "expiresOn": "tomorrow"}`))
+	assert.NotNil(err)
+
+	_, _, err = parseCLIToken([]byte(`{"expiresOn": "2023-01-02 10:20:30.123456"}`))
+	assert.NotNil(err)
+
+	_, _, err = parseCLIToken([]byte(`ERROR: Please run 'az login' to setup account.`))
+	assert.NotNil(err)
+}
+
+func (s *utilsTestSuite) TestFetchCLIToken() {
+	assert := assert.New(s.T())
+	dir := s.T().TempDir()
+
+	defer func(command string) { azCLICommand = command }(azCLICommand)
+
+	// Fake CLI which records its arguments
+	azCLICommand = filepath.Join(dir, "az")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\necho '{\"accessToken\": \"xyz\", \"expires_on\": 1672654830}'\n"
+	assert.Nil(ioutil.WriteFile(azCLICommand, []byte(script), 0700))
+
+	cli := &azAuthCLI{azAuthBase{config: azAuthConfig{AuthMode: EAuthType.AZCLI(), TenantID: "tenant", Endpoint: "https://account.blob.core.windows.net/"}}}
+	token, expires, err := cli.fetchToken()
+	assert.Nil(err)
+	assert.Equal("xyz", token)
+	assert.Equal(int64(1672654830), expires.Unix())
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.Nil(err)
+	assert.Contains(string(args), "account get-access-token --output json --resource https://account.blob.core.windows.net/ --tenant tenant")
+
+	// Errors of the CLI are reported
+	script = "#!/bin/sh\necho 'Please run az login' >&2\nexit 1\n"
+	assert.Nil(ioutil.WriteFile(azCLICommand, []byte(script), 0700))
+	_, _, err = cli.fetchToken()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Please run az login")
 }
 
 func TestUtilsTestSuite(t *testing.T) {
@@ -0,0 +1,246 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+)
+
+const (
+	// Read only view of blob versions, every blob shows up as a directory holding one file per version
+	versionsDirName = ".versions"
+
+	// Snapshots are listed next to versions with this prefix as a snapshot time can collide with a version id
+	snapshotPrefix = "snapshot-"
+
+	// Size of a single read while downloading a version to a local file
+	versionReadChunk = 16 * 1024 * 1024
+
+	// Version ids and snapshots are timestamps in this format
+	versionIDFormat = "2006-01-02T15:04:05.0000000Z"
+)
+
+// isVersionsPath : Check whether a path lies in the virtual versions directory
+func (az *AzStorage) isVersionsPath(name string) bool {
+	return az.stConfig.showVersions && isUnderVirtualDir(name, versionsDirName)
+}
+
+// listVersions : Get the versions of a blob, marker blobs of directories are versioned as well but those are left out
+func (az *AzStorage) listVersions(ctx context.Context, blob string) ([]*internal.ObjAttr, error) {
+	versions, err := az.storage.ListVersions(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*internal.ObjAttr, 0, len(versions))
+	for _, attr := range versions {
+		if !attr.IsDir() {
+			files = append(files, attr)
+		}
+	}
+	return files, nil
+}
+
+// isVersionID : Check whether the name of a path element can be a version id or a snapshot
+func isVersionID(id string) bool {
+	_, err := time.Parse(versionIDFormat, strings.TrimPrefix(id, snapshotPrefix))
+	return err == nil
+}
+
+// getVersionsAttr : Resolve a path of the versions view.
+// A last element named like a version is looked up as a version of its parent, otherwise a path naming a blob,
+// a directory or a deleted blob which still has versions is a directory.
+func (az *AzStorage) getVersionsAttr(ctx context.Context, name string) (*internal.ObjAttr, error) {
+	target := virtualTarget(name, versionsDirName)
+	path := filepath.Join(versionsDirName, target)
+	if target == "" {
+		return newVirtualDirAttr(path, time.Now()), nil
+	}
+
+	if parent := filepath.Dir(target); parent != "." && isVersionID(filepath.Base(target)) {
+		attr, err := az.storage.GetVersionAttr(ctx, parent, filepath.Base(target))
+		if err == nil {
+			if attr.IsDir() {
+				return nil, syscall.ENOENT
+			}
+			return toVirtualFileAttr(filepath.Dir(path), attr), nil
+		} else if err != syscall.ENOENT {
+			return nil, err
+		}
+	}
+
+	versions, err := az.listVersions(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		return newVirtualDirAttr(path, versions[len(versions)-1].Mtime), nil
+	}
+
+	attr, err := az.storage.GetAttr(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return newVirtualDirAttr(path, attr.Mtime), nil
+}
+
+// streamVersionsDir : List a directory of the versions view.
+// For a blob its versions are returned, for a directory its children are returned with files turned into directories.
+func (az *AzStorage) streamVersionsDir(options internal.StreamDirOptions) ([]*internal.ObjAttr, string, error) {
+	ctx := requestContext(options.Ctx)
+	target := virtualTarget(options.Name, versionsDirName)
+	path := filepath.Join(versionsDirName, target)
+
+	if target != "" && options.Token == "" {
+		versions, err := az.listVersions(ctx, target)
+		if err != nil {
+			log.Err("AzStorage::streamVersionsDir : Failed to list versions of %s [%s]", target, err.Error())
+			return nil, "", err
+		}
+
+		if len(versions) > 0 {
+			sort.Slice(versions, func(i, j int) bool { return versions[i].Name < versions[j].Name })
+			for _, attr := range versions {
+				toVirtualFileAttr(path, attr)
+			}
+			return versions, "", nil
+		}
+	}
+
+	list, marker, err := az.storage.List(ctx, formatListDirName(target), &options.Token, options.Count)
+	if err != nil {
+		log.Err("AzStorage::streamVersionsDir : Failed to list %s [%s]", target, err.Error())
+		return nil, "", err
+	}
+
+	entries := make([]*internal.ObjAttr, 0, len(list))
+	for _, attr := range list {
+		// Links have no meaningful versions to browse
+		if attr.IsSymlink() {
+			continue
+		}
+		entries = append(entries, newVirtualDirAttr(filepath.Join(versionsDirName, attr.Path), attr.Mtime))
+	}
+
+	if marker == nil {
+		return entries, "", nil
+	}
+	return entries, *marker, nil
+}
+
+// openVersion : Open a version of a blob, versions can only be read
+func (az *AzStorage) openVersion(options internal.OpenFileOptions) (*handlemap.Handle, error) {
+	ctx := requestContext(options.Ctx)
+	if options.Flags&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, syscall.EROFS
+	}
+
+	attr, err := az.getVersionsAttr(ctx, options.Name)
+	if err != nil {
+		return nil, err
+	}
+	if attr.IsDir() {
+		return nil, syscall.EISDIR
+	}
+
+	handle := handlemap.NewHandle(options.Name)
+	if handle == nil {
+		log.Err("AzStorage::openVersion : Failed to create handle for %s", options.Name)
+		return nil, syscall.EFAULT
+	}
+	handle.Size = attr.Size
+	handle.Mtime = attr.Mtime
+	return handle, nil
+}
+
+// readVersion : Read a range of a version of a blob, the path names the blob and the version as its last element
+func (az *AzStorage) readVersion(ctx context.Context, name string, offset int64, data []byte) error {
+	target := virtualTarget(name, versionsDirName)
+	return az.storage.ReadVersionInBuffer(ctx, filepath.Dir(target), filepath.Base(target), offset, int64(len(data)), data)
+}
+
+// copyVersionToFile : Download a version of a blob to a local file in chunks
+func (az *AzStorage) copyVersionToFile(options internal.CopyToFileOptions) error {
+	ctx := requestContext(options.Ctx)
+	attr, err := az.getVersionsAttr(ctx, options.Name)
+	if err != nil {
+		return err
+	}
+	if attr.IsDir() {
+		return syscall.EISDIR
+	}
+
+	end := attr.Size
+	if options.Count > 0 && options.Offset+options.Count < end {
+		end = options.Offset + options.Count
+	}
+
+	err = options.File.Truncate(end - options.Offset)
+	if err != nil {
+		log.Err("AzStorage::copyVersionToFile : Failed to truncate local file of %s [%s]", options.Name, err.Error())
+		return err
+	}
+
+	buff := make([]byte, versionReadChunk)
+	for offset := options.Offset; offset < end; offset += versionReadChunk {
+		length := end - offset
+		if length > versionReadChunk {
+			length = versionReadChunk
+		}
+
+		err = az.readVersion(ctx, options.Name, offset, buff[:length])
+		if err != nil {
+			log.Err("AzStorage::copyVersionToFile : Failed to read %s [%s]", options.Name, err.Error())
+			return err
+		}
+
+		_, err = options.File.WriteAt(buff[:length], offset-options.Offset)
+		if err != nil {
+			log.Err("AzStorage::copyVersionToFile : Failed to write %s to local file [%s]", options.Name, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
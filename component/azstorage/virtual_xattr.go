@@ -0,0 +1,283 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package azstorage
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+)
+
+// Virtual extended attributes in the system.blobfuse. namespace, these are served from blob properties and index tags
+const (
+	xattrTier          = internal.XattrBlobfusePrefix + "tier"           // access tier, writable to issue a set tier
+	xattrArchiveStatus = internal.XattrBlobfusePrefix + "archive-status" // rehydration status while moving out of archive
+	xattrETag          = internal.XattrBlobfusePrefix + "etag"
+	xattrMD5           = internal.XattrBlobfusePrefix + "md5"  // hex encoded content md5, same format as md5sum
+	xattrTagPrefix     = internal.XattrBlobfusePrefix + "tag." // one attribute per blob index tag
+
+	maxBlobTags     = 10
+	maxTagKeyLength = 128
+	maxTagValLength = 256
+)
+
+// isVirtualXattr : Check whether the extended attribute is served from blob properties instead of metadata
+func isVirtualXattr(name string) bool {
+	return strings.HasPrefix(name, internal.XattrBlobfusePrefix)
+}
+
+// isValidTagString : Tag keys and values allow alphanumerics, space and the characters + - . / : = _
+func isValidTagString(value string, maxLength int) bool {
+	if len(value) > maxLength {
+		return false
+	}
+
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune(" +-./:=_", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tagKey : Get the index tag key of a virtual extended attribute name
+func tagKey(name string) (string, error) {
+	key := strings.TrimPrefix(name, xattrTagPrefix)
+	if key == "" || !isValidTagString(key, maxTagKeyLength) {
+		return "", syscall.EINVAL
+	}
+	return key, nil
+}
+
+// getFileAttr : Get attributes of a path which shall be a file, tier and tags are not available on directories
+func (az *AzStorage) getFileAttr(ctx context.Context, name string) (*internal.ObjAttr, error) {
+	attr, err := az.storage.GetAttr(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if attr.IsDir() {
+		return nil, syscall.ENODATA
+	}
+	return attr, nil
+}
+
+func (az *AzStorage) getVirtualXattr(ctx context.Context, name string, xattrName string) ([]byte, error) {
+	switch xattrName {
+	case xattrETag:
+		attr, err := az.storage.GetAttr(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if attr.ETag == "" {
+			return nil, syscall.ENODATA
+		}
+		return []byte(attr.ETag), nil
+
+	case xattrMD5:
+		attr, err := az.getFileAttr(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(attr.MD5) == 0 {
+			return nil, syscall.ENODATA
+		}
+		return []byte(hex.EncodeToString(attr.MD5)), nil
+
+	case xattrTier, xattrArchiveStatus:
+		if _, err := az.getFileAttr(ctx, name); err != nil {
+			return nil, err
+		}
+
+		tier, archiveStatus, err := az.storage.GetTier(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		value := tier
+		if xattrName == xattrArchiveStatus {
+			value = archiveStatus
+		}
+		if value == "" {
+			return nil, syscall.ENODATA
+		}
+		return []byte(value), nil
+	}
+
+	if !strings.HasPrefix(xattrName, xattrTagPrefix) {
+		return nil, syscall.ENODATA
+	}
+
+	key, err := tagKey(xattrName)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := az.storage.GetTags(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found := tags[key]
+	if !found {
+		return nil, syscall.ENODATA
+	}
+	return []byte(value), nil
+}
+
+// listVirtualXattr : Names of the virtual attributes available on a path.
+// Index tags are listed on a best effort basis as the credentials may not be allowed to read them.
+func (az *AzStorage) listVirtualXattr(ctx context.Context, name string, attr *internal.ObjAttr) []string {
+	names := make([]string, 0)
+	if attr.ETag != "" {
+		names = append(names, xattrETag)
+	}
+
+	if attr.IsDir() {
+		return names
+	}
+
+	names = append(names, xattrTier)
+	if len(attr.MD5) != 0 {
+		names = append(names, xattrMD5)
+	}
+
+	tags, err := az.storage.GetTags(ctx, name)
+	if err != nil && err != syscall.ENOTSUP {
+		log.Warn("AzStorage::listVirtualXattr : Failed to get tags of %s [%s]", name, err.Error())
+	}
+
+	for k := range tags {
+		names = append(names, xattrTagPrefix+k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (az *AzStorage) setVirtualXattr(options internal.SetXattrOptions) error {
+	ctx := requestContext(options.Ctx)
+	if options.Attr == xattrTier {
+		tier, found := AccessTiers[strings.ToLower(strings.TrimSpace(string(options.Value)))]
+		if !found || tier == AccessTiers["none"] {
+			log.Err("AzStorage::setVirtualXattr : Invalid tier %s for %s", string(options.Value), options.Name)
+			return syscall.EINVAL
+		}
+
+		if _, err := az.getFileAttr(ctx, options.Name); err != nil {
+			if err == syscall.ENODATA {
+				return syscall.ENOTSUP
+			}
+			return err
+		}
+
+		err := az.storage.SetTier(ctx, options.Name, string(tier))
+		if err == nil {
+			az.recordXattrChange(setXattr, options.Name, options.Attr)
+		}
+		return err
+	}
+
+	if !strings.HasPrefix(options.Attr, xattrTagPrefix) {
+		// Rest of the virtual attributes are properties maintained by the service
+		return syscall.EPERM
+	}
+
+	key, err := tagKey(options.Attr)
+	if err != nil {
+		return err
+	}
+
+	value := string(options.Value)
+	if !isValidTagString(value, maxTagValLength) {
+		log.Err("AzStorage::setVirtualXattr : Invalid value of tag %s for %s", key, options.Name)
+		return syscall.EINVAL
+	}
+
+	tags, err := az.storage.GetTags(ctx, options.Name)
+	if err != nil {
+		return err
+	}
+
+	_, found := tags[key]
+	if found && options.Flags&internal.XattrCreate != 0 {
+		return syscall.EEXIST
+	} else if !found && options.Flags&internal.XattrReplace != 0 {
+		return syscall.ENODATA
+	} else if !found && len(tags) >= maxBlobTags {
+		return syscall.ENOSPC
+	}
+
+	tags[key] = value
+	err = az.storage.SetTags(ctx, options.Name, tags)
+	if err == nil {
+		az.recordXattrChange(setXattr, options.Name, options.Attr)
+	}
+	return err
+}
+
+func (az *AzStorage) removeVirtualXattr(options internal.RemoveXattrOptions) error {
+	ctx := requestContext(options.Ctx)
+	if !strings.HasPrefix(options.Attr, xattrTagPrefix) {
+		return syscall.EPERM
+	}
+
+	key, err := tagKey(options.Attr)
+	if err != nil {
+		return err
+	}
+
+	tags, err := az.storage.GetTags(ctx, options.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, found := tags[key]; !found {
+		return syscall.ENODATA
+	}
+
+	delete(tags, key)
+	err = az.storage.SetTags(ctx, options.Name, tags)
+	if err == nil {
+		az.recordXattrChange(removeXattr, options.Name, options.Attr)
+	}
+	return err
+}
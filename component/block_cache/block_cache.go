@@ -0,0 +1,738 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package block_cache
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
+
+	"github.com/pbnjay/memory"
+)
+
+// Common structure for Component
+type BlockCache struct {
+	internal.BaseComponent
+
+	blockSize int64
+	memSize   int64
+	tmpPath   string
+	diskSize  int64
+	store     *blockStore
+
+	// Dirty blocks and block lists belong to a handle, so only one handle at a time may write a file
+	writersLock sync.Mutex
+	writers     map[string]bool
+}
+
+// Structure defining your config parameters
+type BlockCacheOptions struct {
+	BlockSize float64 `config:"block-size-mb" yaml:"block-size-mb,omitempty"`
+	MemSize   uint64  `config:"mem-size-mb" yaml:"mem-size-mb,omitempty"`
+	TmpPath   string  `config:"path" yaml:"path,omitempty"`
+	DiskSize  uint64  `config:"disk-size-mb" yaml:"disk-size-mb,omitempty"`
+}
+
+const (
+	compName         = "block_cache"
+	defaultBlockSize = 16
+	defaultMemSize   = 4096
+	defaultDiskSize  = 4096
+	blockIDLength    = 16
+	restageKey       = "block_cache_restage"
+	writerKey        = "block_cache_writer"
+	MB               = 1024 * 1024
+)
+
+// Verification to check satisfaction criteria with Component Interface
+var _ internal.Component = &BlockCache{}
+
+var blockCacheStatsCollector *stats_manager.StatsCollector
+
+func (bc *BlockCache) Name() string {
+	return compName
+}
+
+func (bc *BlockCache) SetName(name string) {
+	bc.BaseComponent.SetName(name)
+}
+
+func (bc *BlockCache) SetNextComponent(nc internal.Component) {
+	bc.BaseComponent.SetNextComponent(nc)
+}
+
+func (bc *BlockCache) Priority() internal.ComponentPriority {
+	return internal.EComponentPriority.LevelMid()
+}
+
+// Start : Pipeline calls this method to start the component functionality
+//
+//	this shall not block the call otherwise pipeline will not start
+func (bc *BlockCache) Start(ctx context.Context) error {
+	log.Trace("Starting component : %s", bc.Name())
+
+	if bc.tmpPath != "" {
+		bc.TempCacheCleanup()
+	}
+
+	// create stats collector for block cache
+	blockCacheStatsCollector = stats_manager.NewStatsCollector(bc.Name())
+
+	return nil
+}
+
+// Stop : Stop the component functionality and kill all threads started
+func (bc *BlockCache) Stop() error {
+	log.Trace("Stopping component : %s", bc.Name())
+
+	handleMap := handlemap.GetHandles()
+	handleMap.Range(func(key, value interface{}) bool {
+		handle := value.(*handlemap.Handle)
+		if handle.CacheObj != nil {
+			handle.CacheObj.Lock()
+			bc.store.purge(handle.CacheObj.BlockOffsetList)
+			handle.CacheObj.Unlock()
+		}
+		return true
+	})
+
+	if bc.tmpPath != "" {
+		bc.TempCacheCleanup()
+	}
+
+	blockCacheStatsCollector.Destroy()
+
+	return nil
+}
+
+// TempCacheCleanup : Remove all the blocks spilled to local disk
+func (bc *BlockCache) TempCacheCleanup() {
+	dirents, err := os.ReadDir(bc.tmpPath)
+	if err != nil {
+		return
+	}
+
+	log.Debug("BlockCache::TempCacheCleanup : Cleaning up temp directory %s", bc.tmpPath)
+	for _, entry := range dirents {
+		os.RemoveAll(filepath.Join(bc.tmpPath, entry.Name()))
+	}
+}
+
+// Configure : Pipeline will call this method after constructor so that you can read config and initialize yourself
+//
+//	Return failure if any config is not valid to exit the process
+func (bc *BlockCache) Configure(_ bool) error {
+	log.Trace("BlockCache::Configure : %s", bc.Name())
+
+	conf := BlockCacheOptions{}
+	err := config.UnmarshalKey(compName, &conf)
+	if err != nil {
+		log.Err("BlockCache::Configure : config error [invalid config attributes]")
+		return fmt.Errorf("config error in %s [%s]", bc.Name(), err.Error())
+	}
+
+	bc.blockSize = int64(defaultBlockSize) * MB
+	if config.IsSet(compName + ".block-size-mb") {
+		bc.blockSize = int64(conf.BlockSize * MB)
+	}
+
+	if bc.blockSize <= 0 {
+		log.Err("BlockCache::Configure : config error [invalid block-size-mb]")
+		return fmt.Errorf("config error in %s [invalid block-size-mb]", bc.Name())
+	}
+
+	if config.IsSet(compName + ".mem-size-mb") {
+		bc.memSize = int64(conf.MemSize) * MB
+		if uint64(bc.memSize) > memory.FreeMemory() {
+			log.Err("BlockCache::Configure : config error, not enough free memory for provided configuration")
+			return fmt.Errorf("config error in %s [not enough free memory for mem-size-mb]", bc.Name())
+		}
+	} else {
+		// By default do not claim more than half of the free memory
+		bc.memSize = int64(defaultMemSize) * MB
+		if uint64(bc.memSize) > memory.FreeMemory()/2 {
+			bc.memSize = int64(memory.FreeMemory() / 2)
+		}
+	}
+
+	if bc.memSize < bc.blockSize {
+		log.Err("BlockCache::Configure : config error [mem-size-mb is smaller than block-size-mb]")
+		return fmt.Errorf("config error in %s [mem-size-mb is smaller than block-size-mb]", bc.Name())
+	}
+
+	bc.tmpPath = common.ExpandPath(conf.TmpPath)
+	if bc.tmpPath != "" {
+		var mountPath string
+		err = config.UnmarshalKey("mount-path", &mountPath)
+		if err == nil && mountPath == bc.tmpPath {
+			log.Err("BlockCache::Configure : config error [tmp-path is same as mount path]")
+			return fmt.Errorf("config error in %s error [tmp-path is same as mount path]", bc.Name())
+		}
+
+		err = os.MkdirAll(bc.tmpPath, os.FileMode(0755))
+		if err != nil {
+			log.Err("BlockCache::Configure : config error creating directory %s [%s]", bc.tmpPath, err.Error())
+			return fmt.Errorf("config error in %s [%s]", bc.Name(), err.Error())
+		}
+
+		if config.IsSet(compName + ".disk-size-mb") {
+			bc.diskSize = int64(conf.DiskSize) * MB
+		} else {
+			// By default do not claim more than half of the free space
+			bc.diskSize = int64(defaultDiskSize) * MB
+			free, err := freeDiskSpace(bc.tmpPath)
+			if err == nil && free/2 < bc.diskSize {
+				bc.diskSize = free / 2
+			}
+		}
+
+		if bc.diskSize < bc.blockSize {
+			log.Err("BlockCache::Configure : config error [disk-size-mb is smaller than block-size-mb]")
+			return fmt.Errorf("config error in %s [disk-size-mb is smaller than block-size-mb]", bc.Name())
+		}
+	}
+
+	bc.store = newBlockStore(bc.memSize, bc.tmpPath, bc.diskSize)
+	bc.writers = make(map[string]bool)
+
+	log.Info("BlockCache::Configure : block-size %v, mem-size %v, tmp-path %s, disk-size %v",
+		bc.blockSize, bc.memSize, bc.tmpPath, bc.diskSize)
+
+	return nil
+}
+
+// freeDiskSpace : bytes available to unprivileged users on the file system holding the given path
+func freeDiskSpace(path string) (int64, error) {
+	statfs := syscall.Statfs_t{}
+	err := syscall.Statfs(path, &statfs)
+	if err != nil {
+		return 0, err
+	}
+	return int64(statfs.Bavail) * int64(statfs.Bsize), nil
+}
+
+// CreateFile : Create the file in storage and start with an empty block list
+func (bc *BlockCache) CreateFile(options internal.CreateFileOptions) (*handlemap.Handle, error) {
+	log.Trace("BlockCache::CreateFile : name=%s, mode=%d", options.Name, options.Mode)
+
+	if !bc.claimWriter(options.Name) {
+		log.Err("BlockCache::CreateFile : %s is already open for writing", options.Name)
+		return nil, syscall.EBUSY
+	}
+
+	handle, err := bc.NextComponent().CreateFile(options)
+	if err != nil {
+		log.Err("BlockCache::CreateFile : Failed to create file %s [%s]", options.Name, err.Error())
+		bc.releaseWriter(options.Name)
+		return handle, err
+	}
+
+	handle.SetValue(writerKey, options.Name)
+	handlemap.CreateCacheObject(0, handle)
+	handle.CacheObj.BlockIdLength = blockIDLength
+
+	return handle, nil
+}
+
+// OpenFile : Open the file and retrieve its block layout from storage
+func (bc *BlockCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Handle, error) {
+	log.Trace("BlockCache::OpenFile : name=%s, flags=%d, mode=%s", options.Name, options.Flags, options.Mode)
+
+	writer := options.Flags&(os.O_WRONLY|os.O_RDWR) != 0
+	if writer && !bc.claimWriter(options.Name) {
+		log.Err("BlockCache::OpenFile : %s is already open for writing", options.Name)
+		return nil, syscall.EBUSY
+	}
+
+	handle, err := bc.NextComponent().OpenFile(options)
+	if err == nil {
+		err = bc.prepareHandle(handle)
+		if err != nil {
+			log.Err("BlockCache::OpenFile : Failed to get block list of %s [%s]", options.Name, err.Error())
+		}
+	} else {
+		log.Err("BlockCache::OpenFile : Failed to open file %s [%s]", options.Name, err.Error())
+	}
+
+	if writer {
+		if err != nil {
+			bc.releaseWriter(options.Name)
+		} else {
+			handle.SetValue(writerKey, options.Name)
+		}
+	}
+
+	return handle, err
+}
+
+// claimWriter : register a writer of the file, fails if another handle is already writing it.
+// Each handle commits its own block list, so a second writer would silently drop the writes of the first.
+func (bc *BlockCache) claimWriter(name string) bool {
+	bc.writersLock.Lock()
+	defer bc.writersLock.Unlock()
+
+	if bc.writers[name] {
+		return false
+	}
+	bc.writers[name] = true
+	return true
+}
+
+func (bc *BlockCache) releaseWriter(name string) {
+	bc.writersLock.Lock()
+	defer bc.writersLock.Unlock()
+	delete(bc.writers, name)
+}
+
+// CloseFile : Flush the dirty blocks and release everything cached for this handle
+func (bc *BlockCache) CloseFile(options internal.CloseFileOptions) error {
+	log.Trace("BlockCache::CloseFile : name=%s, handle=%d", options.Handle.Path, options.Handle.ID)
+
+	if name, found := options.Handle.GetValue(writerKey); found {
+		// Handle is gone once closed whether its last blocks made it to storage or not
+		defer bc.releaseWriter(name.(string))
+	}
+
+	err := bc.FlushFile(internal.FlushFileOptions(options))
+	if err != nil {
+		log.Err("BlockCache::CloseFile : Failed to flush file %s [%s]", options.Handle.Path, err.Error())
+		return err
+	}
+
+	if options.Handle.CacheObj != nil {
+		options.Handle.CacheObj.Lock()
+		bc.store.purge(options.Handle.CacheObj.BlockOffsetList)
+		options.Handle.CacheObj.Unlock()
+	}
+
+	return bc.NextComponent().CloseFile(options)
+}
+
+// ReadInBuffer : Serve the read from cached blocks, downloading the blocks which are not cached yet
+func (bc *BlockCache) ReadInBuffer(options internal.ReadInBufferOptions) (int, error) {
+	handle := options.Handle
+	if handle.CacheObj == nil {
+		return bc.NextComponent().ReadInBuffer(options)
+	}
+
+	handle.CacheObj.Lock()
+	defer handle.CacheObj.Unlock()
+
+	if options.Offset >= atomic.LoadInt64(&handle.Size) {
+		return 0, io.EOF
+	}
+
+	found, index := handle.CacheObj.BinarySearch(options.Offset)
+	if !found {
+		return 0, io.EOF
+	}
+
+	offset := options.Offset
+	dataRead := 0
+	for ; index < len(handle.CacheObj.BlockList) && dataRead < len(options.Data); index++ {
+		blk := handle.CacheObj.BlockList[index]
+
+		err := bc.loadBlock(handle, blk)
+		if err != nil {
+			log.Err("BlockCache::ReadInBuffer : Failed to read %s at offset %d [%s]", handle.Path, blk.StartIndex, err.Error())
+			return dataRead, err
+		}
+
+		copied := copy(options.Data[dataRead:], blk.Data[offset-blk.StartIndex:])
+		bc.store.release(blk)
+
+		dataRead += copied
+		offset += int64(copied)
+	}
+
+	return dataRead, nil
+}
+
+// CopyFileRange : Open handles may hold data in blocks not uploaded yet, so copies go through the regular data path
+func (bc *BlockCache) CopyFileRange(_ internal.CopyFileRangeOptions) (int64, error) {
+	return 0, syscall.ENOTSUP
+}
+
+// WriteFile : Apply the write on cached blocks and mark them dirty, blocks are uploaded on flush
+func (bc *BlockCache) WriteFile(options internal.WriteFileOptions) (int, error) {
+	handle := options.Handle
+	if handle.CacheObj == nil {
+		return bc.NextComponent().WriteFile(options)
+	}
+
+	handle.CacheObj.Lock()
+	defer handle.CacheObj.Unlock()
+
+	endOffset := options.Offset + int64(len(options.Data))
+	if endOffset > atomic.LoadInt64(&handle.Size) {
+		err := bc.extendFile(handle, endOffset)
+		if err != nil {
+			log.Err("BlockCache::WriteFile : Failed to extend %s to %d bytes [%s]", handle.Path, endOffset, err.Error())
+			return 0, err
+		}
+	}
+
+	found, index := handle.CacheObj.BinarySearch(options.Offset)
+	if !found {
+		return 0, nil
+	}
+
+	offset := options.Offset
+	dataWritten := 0
+	for ; index < len(handle.CacheObj.BlockList) && dataWritten < len(options.Data); index++ {
+		blk := handle.CacheObj.BlockList[index]
+
+		err := bc.loadBlock(handle, blk)
+		if err != nil {
+			log.Err("BlockCache::WriteFile : Failed to load %s at offset %d [%s]", handle.Path, blk.StartIndex, err.Error())
+			return dataWritten, err
+		}
+
+		copied := copy(blk.Data[offset-blk.StartIndex:], options.Data[dataWritten:])
+		blk.Flags.Set(common.DirtyBlock)
+		bc.store.release(blk)
+
+		dataWritten += copied
+		offset += int64(copied)
+
+		err = bc.relieve(handle)
+		if err != nil {
+			log.Err("BlockCache::WriteFile : Failed to commit dirty blocks of %s [%s]", handle.Path, err.Error())
+			return dataWritten, err
+		}
+	}
+
+	handle.Flags.Set(handlemap.HandleFlagDirty)
+	return dataWritten, nil
+}
+
+// relieve : dirty blocks can not leave memory without room on the disk tier, so once they exhaust the budget
+// the writer commits its own dirty blocks to storage, after which they are clean and can be dropped.
+// Caller shall hold the lock of the cache object.
+func (bc *BlockCache) relieve(handle *handlemap.Handle) error {
+	if !bc.store.overBudget() {
+		return nil
+	}
+
+	dirty := false
+	for _, blk := range handle.CacheObj.BlockList {
+		if blk.Dirty() && blk.Data != nil {
+			dirty = true
+			break
+		}
+	}
+	if !dirty {
+		// Budget is held by dirty blocks of other handles, they commit them when they write next
+		return nil
+	}
+
+	log.Debug("BlockCache::relieve : Memory budget exhausted, committing dirty blocks of %s", handle.Path)
+	blockCacheStatsCollector.UpdateStats(stats_manager.Increment, pressureFlushes, (int64)(1))
+	return bc.flush(handle, internal.FlushFileOptions{Handle: handle})
+}
+
+// FlushFile : Stage the dirty blocks and commit the block list through the next component
+func (bc *BlockCache) FlushFile(options internal.FlushFileOptions) error {
+	handle := options.Handle
+	if handle.CacheObj == nil {
+		return bc.NextComponent().FlushFile(options)
+	}
+
+	if !handle.Dirty() {
+		return nil
+	}
+
+	handle.CacheObj.Lock()
+	defer handle.CacheObj.Unlock()
+
+	return bc.flush(handle, options)
+}
+
+// flush : stage the dirty blocks and commit the block list, caller shall hold the lock of the cache object
+func (bc *BlockCache) flush(handle *handlemap.Handle, options internal.FlushFileOptions) error {
+	// Blocks of a file uploaded in a single shot are local only, so all of them need to be staged
+	_, restage := handle.GetValue(restageKey)
+
+	pinned := make([]*common.Block, 0)
+	defer func() {
+		for _, blk := range pinned {
+			bc.store.release(blk)
+		}
+	}()
+
+	for _, blk := range handle.CacheObj.BlockList {
+		if restage {
+			blk.Flags.Set(common.DirtyBlock)
+		}
+
+		if blk.Dirty() && !blk.Truncated() {
+			// Dirty block data may have been spilled to disk, bring it back for upload.
+			// Zeros of a block never written are staged by storage without loading them.
+			err := bc.loadBlock(handle, blk)
+			if err != nil {
+				log.Err("BlockCache::FlushFile : Failed to load %s at offset %d [%s]", handle.Path, blk.StartIndex, err.Error())
+				return err
+			}
+			pinned = append(pinned, blk)
+		}
+	}
+
+	err := bc.NextComponent().FlushFile(options)
+	if err != nil {
+		log.Err("BlockCache::FlushFile : Failed to flush %s [%s]", handle.Path, err.Error())
+		return err
+	}
+
+	handle.RemoveValue(restageKey)
+	handle.Flags.Clear(handlemap.HandleFlagDirty)
+	return nil
+}
+
+// TruncateFile : Commit pending writes of open handles before truncating and refresh their block layout after
+func (bc *BlockCache) TruncateFile(options internal.TruncateFileOptions) error {
+	log.Trace("BlockCache::TruncateFile : name=%s, size=%d", options.Name, options.Size)
+
+	handles := bc.openHandles(options.Name)
+	for _, handle := range handles {
+		err := bc.FlushFile(internal.FlushFileOptions{Handle: handle})
+		if err != nil {
+			log.Err("BlockCache::TruncateFile : Failed to flush %s [%s]", options.Name, err.Error())
+			return err
+		}
+	}
+
+	err := bc.NextComponent().TruncateFile(options)
+	if err != nil {
+		log.Err("BlockCache::TruncateFile : Failed to truncate %s [%s]", options.Name, err.Error())
+		return err
+	}
+
+	for _, handle := range handles {
+		handle.CacheObj.Lock()
+		bc.store.purge(handle.CacheObj.BlockOffsetList)
+		atomic.StoreInt64(&handle.Size, options.Size)
+		handle.CacheObj.Unlock()
+
+		err = bc.prepareHandle(handle)
+		if err != nil {
+			log.Err("BlockCache::TruncateFile : Failed to refresh block list of %s [%s]", options.Name, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openHandles : list of open handles of the given file which are managed by this component
+func (bc *BlockCache) openHandles(name string) []*handlemap.Handle {
+	handles := make([]*handlemap.Handle, 0)
+	handlemap.GetHandles().Range(func(key, value interface{}) bool {
+		handle := value.(*handlemap.Handle)
+		if handle.CacheObj != nil && handle.Path == name {
+			handles = append(handles, handle)
+		}
+		return true
+	})
+	return handles
+}
+
+// prepareHandle : retrieve the block layout of the file and attach it to the handle
+func (bc *BlockCache) prepareHandle(handle *handlemap.Handle) error {
+	offsets, err := bc.NextComponent().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: handle.Path})
+	if err != nil {
+		return err
+	}
+
+	if offsets.BlockIdLength == 0 {
+		offsets.BlockIdLength = blockIDLength
+	}
+
+	if offsets.SmallFile() {
+		// File was uploaded in a single shot so there is no block list, split it locally
+		size := atomic.LoadInt64(&handle.Size)
+		for start := int64(0); start < size; start += bc.blockSize {
+			end := start + bc.blockSize
+			if end > size {
+				end = size
+			}
+			offsets.BlockList = append(offsets.BlockList, bc.newBlock(offsets.BlockIdLength, start, end))
+		}
+
+		if size > 0 {
+			handle.SetValue(restageKey, true)
+		}
+		offsets.Flags.Clear(common.SmallFile)
+	}
+
+	if handle.CacheObj == nil {
+		handlemap.CreateCacheObject(0, handle)
+	}
+
+	handle.CacheObj.Lock()
+	handle.CacheObj.BlockOffsetList = offsets
+	handle.CacheObj.Unlock()
+
+	return nil
+}
+
+// loadBlock : make block data available in memory and pin it, caller shall release the block once done
+func (bc *BlockCache) loadBlock(handle *handlemap.Handle, blk *common.Block) error {
+	found, err := bc.store.acquire(blk)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return nil
+	}
+
+	blk.Data = make([]byte, blk.EndIndex-blk.StartIndex)
+	if blk.Truncated() {
+		// Zeros of a block which is not in storage yet, from now on its data is held till it is staged
+		blk.Flags.Clear(common.TruncatedBlock)
+		blk.Flags.Set(common.DirtyBlock)
+	} else {
+		_, err = bc.NextComponent().ReadInBuffer(internal.ReadInBufferOptions{
+			Handle: handle,
+			Offset: blk.StartIndex,
+			Data:   blk.Data,
+		})
+		if err != nil && err != io.EOF {
+			blk.Data = nil
+			return err
+		}
+		blockCacheStatsCollector.UpdateStats(stats_manager.Increment, dlBlocks, (int64)(1))
+	}
+
+	bc.store.insert(handle.ID, blk)
+	return nil
+}
+
+// extendFile : grow the block list so that it covers the given size, new bytes are zero filled
+func (bc *BlockCache) extendFile(handle *handlemap.Handle, size int64) error {
+	bol := handle.CacheObj.BlockOffsetList
+
+	for atomic.LoadInt64(&handle.Size) < size {
+		var last *common.Block
+		if len(bol.BlockList) > 0 {
+			last = bol.BlockList[len(bol.BlockList)-1]
+		}
+
+		if last != nil && last.EndIndex-last.StartIndex < bc.blockSize {
+			// Last block has room left, grow it before adding a new one
+			err := bc.loadBlock(handle, last)
+			if err != nil {
+				return err
+			}
+
+			end := last.StartIndex + bc.blockSize
+			if end > size {
+				end = size
+			}
+
+			last.Data = append(last.Data, make([]byte, end-last.EndIndex)...)
+			last.EndIndex = end
+			last.Flags.Set(common.DirtyBlock)
+			bc.store.release(last)
+		} else {
+			start := int64(0)
+			if last != nil {
+				start = last.EndIndex
+			}
+
+			end := start + bc.blockSize
+			if end > size {
+				end = size
+			}
+
+			// Data of the new block is allocated once it is accessed, so a large extension does not exhaust memory
+			last = bc.newBlock(bol.BlockIdLength, start, end)
+			last.Flags.Set(common.DirtyBlock)
+			last.Flags.Set(common.TruncatedBlock)
+			bol.BlockList = append(bol.BlockList, last)
+		}
+
+		atomic.StoreInt64(&handle.Size, last.EndIndex)
+	}
+
+	return nil
+}
+
+func (bc *BlockCache) newBlock(idLength int64, start int64, end int64) *common.Block {
+	return &common.Block{
+		Id:         base64.StdEncoding.EncodeToString(common.NewUUIDWithLength(idLength)),
+		StartIndex: start,
+		EndIndex:   end,
+	}
+}
+
+// ------------------------- Factory -------------------------------------------
+
+// Pipeline will call this method to create your object, initialize your variables here
+// << DO NOT DELETE ANY AUTO GENERATED CODE HERE >>
+func NewBlockCacheComponent() internal.Component {
+	comp := &BlockCache{}
+	comp.SetName(compName)
+	return comp
+}
+
+// On init register this component to pipeline and supply your constructor
+func init() {
+	internal.AddComponent(compName, NewBlockCacheComponent)
+
+	blockSizeMb := config.AddFloat64Flag("block-cache-block-size", 0.0, "Size (in MB) of a block to be cached by block-cache.")
+	config.BindPFlag(compName+".block-size-mb", blockSizeMb)
+
+	memSizeMb := config.AddUint64Flag("block-cache-mem-size", 0, "Amount of memory (in MB) block-cache can use to hold blocks.")
+	config.BindPFlag(compName+".mem-size-mb", memSizeMb)
+
+	tmpPath := config.AddStringFlag("block-cache-path", "", "Local disk path where block-cache spills blocks that do not fit in memory.")
+	config.BindPFlag(compName+".path", tmpPath)
+
+	diskSizeMb := config.AddUint64Flag("block-cache-disk-size", 0, "Amount of disk space (in MB) block-cache can use under its path.")
+	config.BindPFlag(compName+".disk-size-mb", diskSizeMb)
+}
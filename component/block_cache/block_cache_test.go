@@ -0,0 +1,644 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package block_cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/component/azstorage"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type blockCacheTestSuite struct {
+	suite.Suite
+	assert     *assert.Assertions
+	blockCache *BlockCache
+	mockCtrl   *gomock.Controller
+	mock       *internal.MockComponent
+	tmpPath    string
+}
+
+func newTestBlockCache(next internal.Component, configuration string) (*BlockCache, error) {
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader(configuration))
+	bc := NewBlockCacheComponent()
+	bc.SetNextComponent(next)
+	err := bc.Configure(true)
+	return bc.(*BlockCache), err
+}
+
+func (suite *blockCacheTestSuite) setupTestHelper(configuration string) {
+	var err error
+	suite.assert = assert.New(suite.T())
+	suite.mockCtrl = gomock.NewController(suite.T())
+	suite.mock = internal.NewMockComponent(suite.mockCtrl)
+	suite.blockCache, err = newTestBlockCache(suite.mock, configuration)
+	suite.assert.Nil(err)
+	_ = suite.blockCache.Start(context.Background())
+}
+
+func (suite *blockCacheTestSuite) SetupTest() {
+	err := log.SetDefaultLogger("silent", common.LogConfig{})
+	if err != nil {
+		panic("Unable to set silent logger as default.")
+	}
+	suite.tmpPath = filepath.Join(os.TempDir(), "block_cache_test")
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 2\n  path: " + suite.tmpPath + "\n")
+}
+
+func (suite *blockCacheTestSuite) cleanupTest() {
+	_ = suite.blockCache.Stop()
+	suite.mockCtrl.Finish()
+	os.RemoveAll(suite.tmpPath)
+}
+
+func getRandomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func (suite *blockCacheTestSuite) TestDefaultConfig() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  mem-size-mb: 64\n")
+
+	suite.assert.Equal("block_cache", suite.blockCache.Name())
+	suite.assert.EqualValues(defaultBlockSize*MB, suite.blockCache.blockSize)
+	suite.assert.EqualValues(64*MB, suite.blockCache.memSize)
+	suite.assert.Equal("", suite.blockCache.tmpPath)
+}
+
+func (suite *blockCacheTestSuite) TestConfig() {
+	defer suite.cleanupTest()
+
+	suite.assert.EqualValues(1*MB, suite.blockCache.blockSize)
+	suite.assert.EqualValues(2*MB, suite.blockCache.memSize)
+	suite.assert.Equal(suite.tmpPath, suite.blockCache.tmpPath)
+	suite.assert.DirExists(suite.tmpPath)
+	suite.assert.Greater(suite.blockCache.diskSize, int64(0))
+	suite.assert.LessOrEqual(suite.blockCache.diskSize, int64(defaultDiskSize*MB))
+}
+
+func (suite *blockCacheTestSuite) TestInvalidConfig() {
+	defer suite.cleanupTest()
+
+	_, err := newTestBlockCache(suite.mock, "block_cache:\n  block-size-mb: 4\n  mem-size-mb: 2\n")
+	suite.assert.NotNil(err)
+	suite.assert.Contains(err.Error(), "mem-size-mb is smaller than block-size-mb")
+
+	_, err = newTestBlockCache(suite.mock, "block_cache:\n  block-size-mb: 4\n  mem-size-mb: 8\n  disk-size-mb: 2\n  path: "+suite.tmpPath+"\n")
+	suite.assert.NotNil(err)
+	suite.assert.Contains(err.Error(), "disk-size-mb is smaller than block-size-mb")
+}
+
+func (suite *blockCacheTestSuite) TestWriteSpillFlushRead() {
+	defer suite.cleanupTest()
+
+	handle := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(handle, nil)
+
+	handle, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+	suite.assert.NotNil(handle.CacheObj)
+
+	data := getRandomData(4*MB + 10)
+	n, err := suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.EqualValues(len(data), handle.Size)
+	suite.assert.True(handle.Dirty())
+	suite.assert.Len(handle.CacheObj.BlockList, 5)
+
+	// memory budget is two blocks so rest of the dirty blocks are spilled to disk
+	memUsed, diskUsed := suite.blockCache.store.usage()
+	suite.assert.LessOrEqual(memUsed, suite.blockCache.memSize)
+	suite.assert.Greater(diskUsed, int64(0))
+
+	suite.mock.EXPECT().FlushFile(gomock.Any()).DoAndReturn(func(options internal.FlushFileOptions) error {
+		uploaded := make([]byte, 0)
+		for _, blk := range options.Handle.CacheObj.BlockList {
+			suite.assert.True(blk.Dirty())
+			suite.assert.EqualValues(blk.EndIndex-blk.StartIndex, len(blk.Data))
+			uploaded = append(uploaded, blk.Data...)
+			blk.Flags.Clear(common.DirtyBlock)
+		}
+		suite.assert.True(bytes.Equal(data, uploaded))
+		return nil
+	})
+
+	err = suite.blockCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Dirty())
+
+	// read back is served from memory and disk, no download expected
+	output := make([]byte, len(data))
+	n, err = suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.True(bytes.Equal(data, output))
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	err = suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+
+	memUsed, diskUsed = suite.blockCache.store.usage()
+	suite.assert.EqualValues(0, memUsed)
+	suite.assert.EqualValues(0, diskUsed)
+}
+
+func (suite *blockCacheTestSuite) TestReadDownloadsBlockOnce() {
+	defer suite.cleanupTest()
+
+	data := getRandomData(2 * MB)
+	handle := handlemap.NewHandle("file")
+	handle.Size = int64(len(data))
+
+	openOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY, Mode: 0777}
+	suite.mock.EXPECT().OpenFile(openOptions).Return(handle, nil)
+	suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(&common.BlockOffsetList{
+		BlockList: []*common.Block{
+			{Id: "AAAAAAAAAAAAAAAAAAAAAA==", StartIndex: 0, EndIndex: MB},
+			{Id: "BBBBBBBBBBBBBBBBBBBBBB==", StartIndex: MB, EndIndex: 2 * MB},
+		},
+		BlockIdLength: 16,
+	}, nil)
+
+	handle, err := suite.blockCache.OpenFile(openOptions)
+	suite.assert.Nil(err)
+	suite.assert.Len(handle.CacheObj.BlockList, 2)
+
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		return copy(options.Data, data[options.Offset:]), nil
+	}).Times(2)
+
+	for i := 0; i < 3; i++ {
+		output := make([]byte, 4096)
+		offset := int64(MB - 2048)
+		n, err := suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: output})
+		suite.assert.Nil(err)
+		suite.assert.Equal(len(output), n)
+		suite.assert.True(bytes.Equal(data[offset:offset+4096], output))
+	}
+
+	n, err := suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 2 * MB, Data: make([]byte, 10)})
+	suite.assert.Equal(io.EOF, err)
+	suite.assert.Equal(0, n)
+}
+
+func (suite *blockCacheTestSuite) TestCleanBlockDroppedWithoutDisk() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 1\n")
+
+	data := getRandomData(2 * MB)
+	handle := handlemap.NewHandle("file")
+	handle.Size = int64(len(data))
+
+	openOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY, Mode: 0777}
+	suite.mock.EXPECT().OpenFile(openOptions).Return(handle, nil)
+	suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(&common.BlockOffsetList{
+		BlockList: []*common.Block{
+			{Id: "AAAAAAAAAAAAAAAAAAAAAA==", StartIndex: 0, EndIndex: MB},
+			{Id: "BBBBBBBBBBBBBBBBBBBBBB==", StartIndex: MB, EndIndex: 2 * MB},
+		},
+		BlockIdLength: 16,
+	}, nil)
+
+	handle, err := suite.blockCache.OpenFile(openOptions)
+	suite.assert.Nil(err)
+
+	// first block gets dropped when second is read, so reading it again downloads it again
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		return copy(options.Data, data[options.Offset:]), nil
+	}).Times(3)
+
+	for _, offset := range []int64{0, MB, 0} {
+		output := make([]byte, 100)
+		_, err = suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: output})
+		suite.assert.Nil(err)
+		suite.assert.True(bytes.Equal(data[offset:offset+100], output))
+	}
+
+	memUsed, diskUsed := suite.blockCache.store.usage()
+	suite.assert.EqualValues(MB, memUsed)
+	suite.assert.EqualValues(0, diskUsed)
+}
+
+func (suite *blockCacheTestSuite) TestCleanBlockDroppedFromFullDisk() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 1\n  disk-size-mb: 1\n  path: " + suite.tmpPath + "\n")
+
+	data := getRandomData(3 * MB)
+	handle := handlemap.NewHandle("file")
+	handle.Size = int64(len(data))
+
+	openOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY, Mode: 0777}
+	suite.mock.EXPECT().OpenFile(openOptions).Return(handle, nil)
+	suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(&common.BlockOffsetList{
+		BlockList: []*common.Block{
+			{Id: "AAAAAAAAAAAAAAAAAAAAAA==", StartIndex: 0, EndIndex: MB},
+			{Id: "BBBBBBBBBBBBBBBBBBBBBB==", StartIndex: MB, EndIndex: 2 * MB},
+			{Id: "CCCCCCCCCCCCCCCCCCCCCC==", StartIndex: 2 * MB, EndIndex: 3 * MB},
+		},
+		BlockIdLength: 16,
+	}, nil)
+
+	handle, err := suite.blockCache.OpenFile(openOptions)
+	suite.assert.Nil(err)
+
+	// first block is spilled when the second is read and dropped from disk when the third is read
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		return copy(options.Data, data[options.Offset:]), nil
+	}).Times(4)
+
+	for _, offset := range []int64{0, MB, 2 * MB, 0} {
+		output := make([]byte, 100)
+		_, err = suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: output})
+		suite.assert.Nil(err)
+		suite.assert.True(bytes.Equal(data[offset:offset+100], output))
+
+		memUsed, diskUsed := suite.blockCache.store.usage()
+		suite.assert.LessOrEqual(memUsed, int64(MB))
+		suite.assert.LessOrEqual(diskUsed, int64(MB))
+	}
+}
+
+func (suite *blockCacheTestSuite) TestWriteBeyondFullDisk() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 1\n  disk-size-mb: 1\n  path: " + suite.tmpPath + "\n")
+
+	handle := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(handle, nil)
+
+	handle, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+
+	staged := make(map[string][]byte)
+	suite.mock.EXPECT().FlushFile(gomock.Any()).DoAndReturn(func(options internal.FlushFileOptions) error {
+		for _, blk := range options.Handle.CacheObj.BlockList {
+			if blk.Dirty() {
+				staged[blk.Id] = append([]byte{}, blk.Data...)
+				blk.Flags.Clear(common.DirtyBlock)
+			}
+		}
+		return nil
+	}).MinTimes(1)
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		for _, blk := range handle.CacheObj.BlockList {
+			if blk.StartIndex == options.Offset {
+				return copy(options.Data, staged[blk.Id]), nil
+			}
+		}
+		return 0, io.EOF
+	}).AnyTimes()
+
+	// Dirty blocks which fit neither in memory nor on disk are committed while writing
+	data := getRandomData(4 * MB)
+	n, err := suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+
+	_, diskUsed := suite.blockCache.store.usage()
+	suite.assert.LessOrEqual(diskUsed, int64(MB))
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	suite.assert.Nil(suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: handle}))
+
+	uploaded := make([]byte, 0)
+	for _, blk := range handle.CacheObj.BlockList {
+		uploaded = append(uploaded, staged[blk.Id]...)
+	}
+	suite.assert.True(bytes.Equal(data, uploaded))
+}
+
+func (suite *blockCacheTestSuite) TestWriteBeyondBudgetWithoutDisk() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 2\n")
+
+	handle := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(handle, nil)
+
+	handle, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+
+	// Blocks staged in storage by id, blocks never written are staged as zeros
+	staged := make(map[string][]byte)
+	flushes := 0
+	suite.mock.EXPECT().FlushFile(gomock.Any()).DoAndReturn(func(options internal.FlushFileOptions) error {
+		flushes++
+		for _, blk := range options.Handle.CacheObj.BlockList {
+			if !blk.Dirty() {
+				continue
+			}
+			if blk.Truncated() {
+				staged[blk.Id] = make([]byte, blk.EndIndex-blk.StartIndex)
+			} else {
+				suite.assert.EqualValues(blk.EndIndex-blk.StartIndex, len(blk.Data))
+				staged[blk.Id] = append([]byte{}, blk.Data...)
+			}
+			blk.Flags.Clear(common.DirtyBlock)
+			blk.Flags.Clear(common.TruncatedBlock)
+		}
+		return nil
+	}).MinTimes(2)
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		for _, blk := range handle.CacheObj.BlockList {
+			if blk.StartIndex == options.Offset {
+				return copy(options.Data, staged[blk.Id]), nil
+			}
+		}
+		return 0, io.EOF
+	}).AnyTimes()
+
+	// Dirty blocks can not be dropped, so once they exhaust the budget they are committed while writing
+	data := getRandomData(4*MB + 10)
+	n, err := suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.GreaterOrEqual(flushes, 1)
+	suite.assert.True(handle.Dirty())
+
+	memUsed, diskUsed := suite.blockCache.store.usage()
+	suite.assert.LessOrEqual(memUsed, suite.blockCache.memSize)
+	suite.assert.EqualValues(0, diskUsed)
+
+	err = suite.blockCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Dirty())
+
+	// Blocks committed while writing were dropped and come back from storage
+	output := make([]byte, len(data))
+	n, err = suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.True(bytes.Equal(data, output))
+
+	memUsed, _ = suite.blockCache.store.usage()
+	suite.assert.LessOrEqual(memUsed, suite.blockCache.memSize)
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	suite.assert.Nil(suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: handle}))
+}
+
+func (suite *blockCacheTestSuite) TestExtendWithoutWriting() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("block_cache:\n  block-size-mb: 1\n  mem-size-mb: 2\n")
+
+	handle := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(handle, nil)
+
+	handle, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+
+	// Writing far past the end takes memory only for the written block, the hole is staged by storage
+	_, err = suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 8 * MB, Data: []byte("end")})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(8*MB+3, handle.Size)
+	memUsed, _ := suite.blockCache.store.usage()
+	suite.assert.EqualValues(3, memUsed)
+
+	suite.mock.EXPECT().FlushFile(gomock.Any()).DoAndReturn(func(options internal.FlushFileOptions) error {
+		blocks := options.Handle.CacheObj.BlockList
+		suite.assert.Len(blocks, 9)
+		for _, blk := range blocks[:8] {
+			suite.assert.True(blk.Dirty())
+			suite.assert.True(blk.Truncated())
+			suite.assert.Nil(blk.Data)
+		}
+		suite.assert.False(blocks[8].Truncated())
+		suite.assert.Equal([]byte("end"), blocks[8].Data)
+		return nil
+	})
+	suite.assert.Nil(suite.blockCache.FlushFile(internal.FlushFileOptions{Handle: handle}))
+
+	// Hole reads back as zeros without a download
+	output := make([]byte, 10)
+	n, err := suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: MB, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(10, n)
+	suite.assert.Equal(make([]byte, 10), output)
+}
+
+func (suite *blockCacheTestSuite) TestSingleWriter() {
+	defer suite.cleanupTest()
+
+	writer := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(writer, nil)
+
+	writer, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+
+	// each handle commits its own block list, so a second writer would drop the writes of the first
+	_, err = suite.blockCache.OpenFile(internal.OpenFileOptions{Name: "file", Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Equal(syscall.EBUSY, err)
+	_, err = suite.blockCache.CreateFile(createOptions)
+	suite.assert.Equal(syscall.EBUSY, err)
+
+	// readers are still welcome
+	readOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY, Mode: 0777}
+	suite.mock.EXPECT().OpenFile(readOptions).Return(handlemap.NewHandle("file"), nil)
+	suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(&common.BlockOffsetList{}, nil).Times(2)
+	_, err = suite.blockCache.OpenFile(readOptions)
+	suite.assert.Nil(err)
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: writer}).Return(nil)
+	suite.assert.Nil(suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: writer}))
+
+	// file can be written again once the writer is closed
+	writeOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_WRONLY, Mode: 0777}
+	suite.mock.EXPECT().OpenFile(writeOptions).Return(handlemap.NewHandle("file"), nil)
+	_, err = suite.blockCache.OpenFile(writeOptions)
+	suite.assert.Nil(err)
+}
+
+func (suite *blockCacheTestSuite) TestSmallFileRestaged() {
+	defer suite.cleanupTest()
+
+	data := getRandomData(100)
+	handle := handlemap.NewHandle("file")
+	handle.Size = int64(len(data))
+
+	openOptions := internal.OpenFileOptions{Name: "file", Flags: os.O_RDWR, Mode: 0777}
+	smallFile := &common.BlockOffsetList{}
+	smallFile.Flags.Set(common.SmallFile)
+	suite.mock.EXPECT().OpenFile(openOptions).Return(handle, nil)
+	suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(smallFile, nil)
+
+	handle, err := suite.blockCache.OpenFile(openOptions)
+	suite.assert.Nil(err)
+	suite.assert.False(handle.CacheObj.SmallFile())
+	suite.assert.Len(handle.CacheObj.BlockList, 1)
+	suite.assert.EqualValues(blockIDLength, handle.CacheObj.BlockIdLength)
+
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		return copy(options.Data, data[options.Offset:]), nil
+	})
+
+	// append beyond the current size grows the only block
+	_, err = suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 200, Data: []byte("tail")})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(204, handle.Size)
+	suite.assert.Len(handle.CacheObj.BlockList, 1)
+
+	suite.mock.EXPECT().FlushFile(gomock.Any()).DoAndReturn(func(options internal.FlushFileOptions) error {
+		blk := options.Handle.CacheObj.BlockList[0]
+		suite.assert.True(blk.Dirty())
+		suite.assert.True(bytes.Equal(data, blk.Data[:100]))
+		suite.assert.True(bytes.Equal(make([]byte, 100), blk.Data[100:200]))
+		suite.assert.Equal("tail", string(blk.Data[200:]))
+		return nil
+	})
+
+	err = suite.blockCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+
+	_, found := handle.GetValue(restageKey)
+	suite.assert.False(found)
+}
+
+func (suite *blockCacheTestSuite) TestTruncateRefreshesOpenHandle() {
+	defer suite.cleanupTest()
+
+	handle := handlemap.NewHandle("file")
+	createOptions := internal.CreateFileOptions{Name: "file", Mode: 0777}
+	suite.mock.EXPECT().CreateFile(createOptions).Return(handle, nil)
+
+	handle, err := suite.blockCache.CreateFile(createOptions)
+	suite.assert.Nil(err)
+	handlemap.Add(handle)
+	defer handlemap.Delete(handle.ID)
+
+	_, err = suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: getRandomData(MB + 10)})
+	suite.assert.Nil(err)
+
+	truncateOptions := internal.TruncateFileOptions{Name: "file", Size: 10}
+	gomock.InOrder(
+		suite.mock.EXPECT().FlushFile(gomock.Any()).Return(nil),
+		suite.mock.EXPECT().TruncateFile(truncateOptions).Return(nil),
+		suite.mock.EXPECT().GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"}).Return(&common.BlockOffsetList{
+			BlockList:     []*common.Block{{Id: "AAAAAAAAAAAAAAAAAAAAAA==", StartIndex: 0, EndIndex: 10}},
+			BlockIdLength: 16,
+		}, nil),
+	)
+
+	err = suite.blockCache.TruncateFile(truncateOptions)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(10, handle.Size)
+	suite.assert.Len(handle.CacheObj.BlockList, 1)
+	suite.assert.False(handle.Dirty())
+}
+
+func (suite *blockCacheTestSuite) TestEndToEndMemoryStorage() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+
+	storage := azstorage.NewazstorageComponent()
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader("azstorage:\n  type: memory\n"))
+	suite.assert.Nil(storage.Configure(true))
+	suite.assert.Nil(storage.Start(context.Background()))
+	defer func() { _ = storage.Stop() }()
+
+	var err error
+	suite.blockCache, err = newTestBlockCache(storage, "block_cache:\n  block-size-mb: 1\n  mem-size-mb: 2\n")
+	suite.assert.Nil(err)
+	_ = suite.blockCache.Start(context.Background())
+
+	data := getRandomData(3*MB + 10)
+	handle, err := suite.blockCache.CreateFile(internal.CreateFileOptions{Name: "file", Mode: 0777})
+	suite.assert.Nil(err)
+
+	_, err = suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: handle}))
+
+	// data was committed as a block list to the storage
+	bol, err := storage.GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"})
+	suite.assert.Nil(err)
+	suite.assert.False(bol.SmallFile())
+	suite.assert.Len(bol.BlockList, 4)
+
+	handle, err = suite.blockCache.OpenFile(internal.OpenFileOptions{Name: "file", Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), handle.Size)
+
+	// overwrite across a block boundary and read everything back
+	copy(data[MB-2:], []byte("abcd"))
+	_, err = suite.blockCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: MB - 2, Data: []byte("abcd")})
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.blockCache.FlushFile(internal.FlushFileOptions{Handle: handle}))
+
+	output := make([]byte, len(data))
+	n, err := suite.blockCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.True(bytes.Equal(data, output))
+	suite.assert.Nil(suite.blockCache.CloseFile(internal.CloseFileOptions{Handle: handle}))
+
+	stored, err := storage.ReadFile(internal.ReadFileOptions{Handle: handlemap.NewHandle("file")})
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, stored))
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestBlockCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(blockCacheTestSuite))
+}
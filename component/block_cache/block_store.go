@@ -0,0 +1,306 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package block_cache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
+)
+
+// storeNode : book keeping for one block held by the store
+type storeNode struct {
+	block  *common.Block
+	handle handlemap.HandleID
+	elem   *list.Element // position in lru list, nil if data is not in memory
+	size   int64         // bytes accounted in memory for this block
+	spill  string        // local file holding the block data, empty if not spilled
+	disk   *list.Element // position in spill order, nil if not spilled
+	pinned int           // number of users currently reading or writing block data
+}
+
+// blockStore : holds the data of cached blocks within a memory budget.
+// Once the budget is exhausted least recently used blocks are moved to the disk tier if configured,
+// otherwise clean blocks are dropped and will be downloaded again on next access. The disk tier has a budget
+// of its own, clean blocks spilled first are dropped from it to make room. Dirty blocks are never dropped,
+// once they can not leave memory writers have to commit them before the store can let go of them.
+type blockStore struct {
+	sync.Mutex
+	memLimit  int64
+	memUsed   int64
+	diskLimit int64
+	diskUsed  int64
+	diskPath  string
+	lru       *list.List
+	spilled   *list.List // blocks on disk, oldest spill first
+	nodes     map[*common.Block]*storeNode
+}
+
+func newBlockStore(memLimit int64, diskPath string, diskLimit int64) *blockStore {
+	return &blockStore{
+		memLimit:  memLimit,
+		diskLimit: diskLimit,
+		diskPath:  diskPath,
+		lru:       list.New(),
+		spilled:   list.New(),
+		nodes:     make(map[*common.Block]*storeNode),
+	}
+}
+
+// acquire : pin the block data in memory, reloading it from disk if it was spilled.
+// Returns false if the store does not hold the data for this block.
+func (bs *blockStore) acquire(blk *common.Block) (bool, error) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	node, found := bs.nodes[blk]
+	if !found {
+		return false, nil
+	}
+
+	if node.elem != nil {
+		bs.lru.MoveToFront(node.elem)
+		node.pinned++
+		blockCacheStatsCollector.UpdateStats(stats_manager.Increment, memServed, (int64)(1))
+		return true, nil
+	}
+
+	if node.spill == "" {
+		// Data was dropped from memory and has to be downloaded again
+		delete(bs.nodes, blk)
+		return false, nil
+	}
+
+	data, err := os.ReadFile(node.spill)
+	if err != nil {
+		log.Err("BlockCache::acquire : Failed to read spilled block %s [%s]", node.spill, err.Error())
+		return false, err
+	}
+
+	bs.removeSpill(node)
+	blk.Data = data
+	node.size = int64(len(data))
+	node.elem = bs.lru.PushFront(node)
+	node.pinned++
+	bs.memUsed += node.size
+
+	blockCacheStatsCollector.UpdateStats(stats_manager.Increment, diskServed, (int64)(1))
+	bs.evict()
+	return true, nil
+}
+
+// insert : add a freshly populated block to the store, the block is returned pinned
+func (bs *blockStore) insert(handle handlemap.HandleID, blk *common.Block) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	node := &storeNode{
+		block:  blk,
+		handle: handle,
+		size:   int64(len(blk.Data)),
+		pinned: 1,
+	}
+	node.elem = bs.lru.PushFront(node)
+	bs.nodes[blk] = node
+	bs.memUsed += node.size
+
+	bs.evict()
+}
+
+// release : unpin the block and account for any change in its size
+func (bs *blockStore) release(blk *common.Block) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	node, found := bs.nodes[blk]
+	if !found {
+		return
+	}
+
+	if node.pinned > 0 {
+		node.pinned--
+	}
+
+	if node.elem != nil {
+		bs.memUsed += int64(len(blk.Data)) - node.size
+		node.size = int64(len(blk.Data))
+	}
+
+	bs.evict()
+}
+
+// purge : forget all blocks belonging to the given block list
+func (bs *blockStore) purge(bol *common.BlockOffsetList) {
+	if bol == nil {
+		return
+	}
+
+	bs.Lock()
+	defer bs.Unlock()
+
+	for _, blk := range bol.BlockList {
+		bs.removeNode(blk)
+	}
+}
+
+// overBudget : memory is exhausted by blocks which can only leave it once they are committed to storage.
+// Eviction runs on every change, so memory stays above the budget only when there was no room on disk.
+func (bs *blockStore) overBudget() bool {
+	bs.Lock()
+	defer bs.Unlock()
+	return bs.memUsed > bs.memLimit
+}
+
+// usage : current memory and disk usage of the store in bytes
+func (bs *blockStore) usage() (int64, int64) {
+	bs.Lock()
+	defer bs.Unlock()
+	return bs.memUsed, bs.diskUsed
+}
+
+func (bs *blockStore) removeNode(blk *common.Block) {
+	node, found := bs.nodes[blk]
+	if !found {
+		return
+	}
+
+	if node.elem != nil {
+		bs.lru.Remove(node.elem)
+		bs.memUsed -= node.size
+		node.elem = nil
+	}
+
+	bs.removeSpill(node)
+	blk.Data = nil
+	delete(bs.nodes, blk)
+}
+
+func (bs *blockStore) removeSpill(node *storeNode) {
+	if node.spill == "" {
+		return
+	}
+
+	err := os.Remove(node.spill)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn("BlockCache::removeSpill : Failed to delete spilled block %s [%s]", node.spill, err.Error())
+	}
+	bs.spilled.Remove(node.disk)
+	bs.diskUsed -= node.size
+	node.spill = ""
+	node.disk = nil
+}
+
+// evict : move least recently used blocks out of memory till usage is within the budget.
+// Caller shall hold the store lock.
+func (bs *blockStore) evict() {
+	for e := bs.lru.Back(); e != nil && bs.memUsed > bs.memLimit; {
+		prev := e.Prev()
+		node := e.Value.(*storeNode)
+
+		if node.pinned == 0 {
+			if bs.diskPath != "" {
+				bs.spill(node)
+			} else if !node.block.Dirty() {
+				bs.drop(node)
+			}
+		}
+
+		e = prev
+	}
+
+	blockCacheStatsCollector.UpdateStats(stats_manager.Replace, memUsage, bs.memUsed)
+	blockCacheStatsCollector.UpdateStats(stats_manager.Replace, diskUsage, bs.diskUsed)
+}
+
+// drop : release the memory held by a clean block, it is fetched again from storage on next access
+func (bs *blockStore) drop(node *storeNode) {
+	bs.lru.Remove(node.elem)
+	bs.memUsed -= node.size
+	node.block.Data = nil
+	delete(bs.nodes, node.block)
+}
+
+// reserveDisk : make room for the given number of bytes on the disk tier, dropping clean blocks spilled first.
+// Returns false if the disk tier is full of dirty blocks.
+func (bs *blockStore) reserveDisk(size int64) bool {
+	for e := bs.spilled.Front(); e != nil && bs.diskUsed+size > bs.diskLimit; {
+		next := e.Next()
+		node := e.Value.(*storeNode)
+
+		if !node.block.Dirty() {
+			// Clean block can be fetched again from storage
+			bs.removeSpill(node)
+			delete(bs.nodes, node.block)
+		}
+
+		e = next
+	}
+
+	return bs.diskUsed+size <= bs.diskLimit
+}
+
+// spill : write the block data to the disk tier and release the memory held by it
+func (bs *blockStore) spill(node *storeNode) {
+	if !bs.reserveDisk(node.size) {
+		if !node.block.Dirty() {
+			bs.drop(node)
+		}
+		return
+	}
+
+	fileName := filepath.Join(bs.diskPath, fmt.Sprintf("%d_%d", node.handle, node.block.StartIndex))
+	err := os.WriteFile(fileName, node.block.Data, 0600)
+	if err != nil {
+		log.Err("BlockCache::spill : Failed to spill block to %s [%s]", fileName, err.Error())
+		if !node.block.Dirty() {
+			bs.drop(node)
+		}
+		return
+	}
+
+	bs.lru.Remove(node.elem)
+	node.elem = nil
+	node.spill = fileName
+	node.disk = bs.spilled.PushBack(node)
+	node.block.Data = nil
+	bs.memUsed -= node.size
+	bs.diskUsed += node.size
+}
@@ -0,0 +1,820 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+)
+
+/* NOTES:
+   - Compression sits above the storage component, and above encryption when both are engaged, so that every component
+     above it sees uncompressed data and sizes
+   - Files matching the configured patterns are compressed as a whole when they are uploaded, which is what file_cache does on close.
+     Files which do not get smaller are uploaded as they are.
+   - Reads at any offset are served by decompressing just the frames covering the range, so stream and block_cache can read
+   - Writes at an offset of a compressed blob are refused, files which are not compressed are written as usual
+*/
+
+// Common structure for Compression Component
+type Compression struct {
+	internal.BaseComponent
+	codec     codec
+	codecName string
+	frameSize int64
+	include   []string
+	exclude   []string
+	tmpPath   string
+}
+
+// Structure defining your config parameters
+type CompressionOptions struct {
+	Codec       string   `config:"codec" yaml:"codec,omitempty"`
+	Level       int      `config:"level" yaml:"level,omitempty"`
+	FrameSizeKB uint64   `config:"frame-size-kb" yaml:"frame-size-kb,omitempty"`
+	Include     []string `config:"include" yaml:"include,omitempty"`
+	Exclude     []string `config:"exclude" yaml:"exclude,omitempty"`
+	TmpPath     string   `config:"tmp-path" yaml:"tmp-path,omitempty"`
+}
+
+const compName = "compression"
+
+const (
+	defaultCodec       = "gzip"
+	defaultFrameSizeKB = 256
+	maxFrameSize       = 16 * 1024 * 1024
+
+	// Ranges are read from storage in batches of this size while downloading a whole file
+	readBatchSize = 4 * 1024 * 1024
+
+	// Key of the state of a compressed file stored in its handle
+	handleKey = "compression"
+)
+
+// openFile : state of an open compressed file
+type openFile struct {
+	layout *frameLayout
+	codec  codec
+	index  []int64
+	lower  *handlemap.Handle // handle of the compressed data, opened from the next component
+}
+
+//  Verification to check satisfaction criteria with Component Interface
+var _ internal.Component = &Compression{}
+
+func (c *Compression) Name() string {
+	return compName
+}
+
+func (c *Compression) SetName(name string) {
+	c.BaseComponent.SetName(name)
+}
+
+func (c *Compression) SetNextComponent(nc internal.Component) {
+	c.BaseComponent.SetNextComponent(nc)
+}
+
+func (c *Compression) Priority() internal.ComponentPriority {
+	return internal.EComponentPriority.LevelThree()
+}
+
+// Start : Pipeline calls this method to start the component functionality
+//  this shall not block the call otherwise pipeline will not start
+func (c *Compression) Start(ctx context.Context) error {
+	log.Trace("Compression::Start : Starting component %s", c.Name())
+	return nil
+}
+
+// Stop : Stop the component functionality and kill all threads started
+func (c *Compression) Stop() error {
+	log.Trace("Compression::Stop : Stopping component %s", c.Name())
+	return nil
+}
+
+// Configure : Pipeline will call this method after constructor so that you can read config and initialize yourself
+//  Return failure if any config is not valid to exit the process
+func (c *Compression) Configure(_ bool) error {
+	log.Trace("Compression::Configure : %s", c.Name())
+
+	conf := CompressionOptions{}
+	err := config.UnmarshalKey(c.Name(), &conf)
+	if err != nil {
+		log.Err("Compression::Configure : config error [invalid config attributes]")
+		return fmt.Errorf("config error in %s [%s]", c.Name(), err.Error())
+	}
+
+	c.codecName = defaultCodec
+	if conf.Codec != "" {
+		c.codecName = strings.ToLower(conf.Codec)
+	}
+
+	c.codec, err = newCodec(c.codecName, conf.Level)
+	if err != nil {
+		log.Err("Compression::Configure : config error [%s]", err.Error())
+		return fmt.Errorf("config error in %s [%s]", c.Name(), err.Error())
+	}
+
+	c.frameSize = defaultFrameSizeKB * 1024
+	if config.IsSet(compName + ".frame-size-kb") {
+		c.frameSize = int64(conf.FrameSizeKB * 1024)
+		if c.frameSize <= 0 || c.frameSize > maxFrameSize {
+			log.Err("Compression::Configure : config error [invalid frame-size-kb %d]", conf.FrameSizeKB)
+			return fmt.Errorf("config error in %s [frame-size-kb shall be between 1 and %d]", c.Name(), maxFrameSize/1024)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, conf.Include...), conf.Exclude...) {
+		if !validPattern(pattern) {
+			log.Err("Compression::Configure : config error [invalid pattern %s]", pattern)
+			return fmt.Errorf("config error in %s [invalid pattern %s]", c.Name(), pattern)
+		}
+	}
+	c.include = conf.Include
+	c.exclude = conf.Exclude
+
+	c.tmpPath = ""
+	if conf.TmpPath != "" {
+		c.tmpPath = common.ExpandPath(conf.TmpPath)
+		err = os.MkdirAll(c.tmpPath, 0700)
+		if err != nil {
+			log.Err("Compression::Configure : config error [failed to create directory for %s]", c.tmpPath)
+			return fmt.Errorf("config error in %s [%s]", c.Name(), err.Error())
+		}
+	}
+
+	log.Info("Compression::Configure : codec %s, frame-size %d, include %v, exclude %v, tmp-path %s",
+		c.codecName, c.frameSize, c.include, c.exclude, c.tmpPath)
+
+	return nil
+}
+
+// OnConfigChange : If component has registered, on config file change this method is called
+func (c *Compression) OnConfigChange() {
+	log.Trace("Compression::OnConfigChange : %s", c.Name())
+	_ = c.Configure(true)
+}
+
+// shallCompress : File matches an include pattern, or there are none, and no exclude pattern
+func (c *Compression) shallCompress(name string) bool {
+	for _, pattern := range c.exclude {
+		if matchPattern(pattern, name) {
+			return false
+		}
+	}
+
+	if len(c.include) == 0 {
+		return true
+	}
+	for _, pattern := range c.include {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------- Attributes -------------------------------------------
+
+// logicalAttr : Report the uncompressed size instead of the size of the blob for compressed files
+func (c *Compression) logicalAttr(attr *internal.ObjAttr) {
+	if attr.IsDir() || attr.IsSymlink() || !isCompressed(attr) {
+		return
+	}
+
+	layout, err := layoutOf(attr)
+	if err != nil {
+		log.Err("Compression::logicalAttr : Can not tell size of %s [%s]", attr.Path, err.Error())
+		return
+	}
+	attr.Size = layout.size
+}
+
+// hideMetadata : Drop the metadata describing the compression from attributes handed to the layers above,
+// attr_cache answers xattrs from the metadata it caches
+func hideMetadata(attr *internal.ObjAttr) {
+	if len(attr.Metadata) == 0 {
+		return
+	}
+
+	visible := make(map[string]string, len(attr.Metadata))
+	for k, v := range attr.Metadata {
+		if !isCompressionMetadataKey(strings.ToLower(k)) {
+			visible[k] = v
+		}
+	}
+	attr.Metadata = visible
+}
+
+// logicalList : Fix up sizes of the listed files, fetching the metadata of the ones the listing did not bring it for
+func (c *Compression) logicalList(ctx context.Context, attrs []*internal.ObjAttr) {
+	for _, attr := range attrs {
+		if !attr.IsDir() && !attr.IsMetadataRetrieved() {
+			full, err := c.NextComponent().GetAttr(internal.GetAttrOptions{Name: attr.Path, RetrieveMetadata: true, Ctx: ctx})
+			if err != nil {
+				log.Warn("Compression::logicalList : Failed to get metadata of %s [%s]", attr.Path, err.Error())
+				continue
+			}
+			attr.Size = full.Size
+			attr.Metadata = full.Metadata
+			attr.Flags = full.Flags
+		}
+		c.logicalAttr(attr)
+		hideMetadata(attr)
+	}
+}
+
+func (c *Compression) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr, error) {
+	attr, err := c.NextComponent().GetAttr(options)
+	if err != nil {
+		return attr, err
+	}
+
+	c.logicalAttr(attr)
+	hideMetadata(attr)
+	return attr, nil
+}
+
+func (c *Compression) ReadDir(options internal.ReadDirOptions) ([]*internal.ObjAttr, error) {
+	attrs, err := c.NextComponent().ReadDir(options)
+	if err != nil {
+		return attrs, err
+	}
+
+	c.logicalList(options.Ctx, attrs)
+	return attrs, nil
+}
+
+func (c *Compression) StreamDir(options internal.StreamDirOptions) ([]*internal.ObjAttr, string, error) {
+	attrs, token, err := c.NextComponent().StreamDir(options)
+	if err != nil {
+		return attrs, token, err
+	}
+
+	c.logicalList(options.Ctx, attrs)
+	return attrs, token, nil
+}
+
+// ------------------------- Reads -------------------------------------------
+
+// openCompressed : Open the compressed data of the blob and load its index
+func (c *Compression) openCompressed(ctx context.Context, attr *internal.ObjAttr) (*openFile, error) {
+	layout, err := layoutOf(attr)
+	if err != nil {
+		log.Err("Compression::openCompressed : Invalid layout of %s [%s]", attr.Path, err.Error())
+		return nil, syscall.EIO
+	}
+
+	fileCodec, err := newCodec(layout.codec, 0)
+	if err != nil {
+		log.Err("Compression::openCompressed : Can not decompress %s [%s]", attr.Path, err.Error())
+		return nil, syscall.EIO
+	}
+
+	lower, err := c.NextComponent().OpenFile(internal.OpenFileOptions{Name: attr.Path, Flags: os.O_RDONLY, Ctx: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, layout.indexSize())
+	if len(data) > 0 {
+		_, err = c.NextComponent().ReadInBuffer(internal.ReadInBufferOptions{Handle: lower, Offset: layout.indexOffset, Data: data, Ctx: ctx})
+	}
+
+	var index []int64
+	if err == nil {
+		index, err = layout.parseIndex(data)
+	}
+	if err != nil {
+		log.Err("Compression::openCompressed : Failed to read index of %s [%s]", attr.Path, err.Error())
+		_ = c.NextComponent().CloseFile(internal.CloseFileOptions{Handle: lower, Ctx: ctx})
+		return nil, syscall.EIO
+	}
+
+	return &openFile{layout: layout, codec: fileCodec, index: index, lower: lower}, nil
+}
+
+func (c *Compression) closeCompressed(ctx context.Context, of *openFile) {
+	_ = c.NextComponent().CloseFile(internal.CloseFileOptions{Handle: of.lower, Ctx: ctx})
+}
+
+func (c *Compression) OpenFile(options internal.OpenFileOptions) (*handlemap.Handle, error) {
+	log.Trace("Compression::OpenFile : %s", options.Name)
+
+	handle, err := c.NextComponent().OpenFile(options)
+	if err != nil {
+		return handle, err
+	}
+
+	attr, err := c.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err == nil && isCompressed(attr) {
+		var of *openFile
+		of, err = c.openCompressed(options.Ctx, attr)
+		if err == nil {
+			handle.Size = of.layout.size
+			handle.SetValue(handleKey, of)
+		}
+	}
+
+	if err != nil {
+		log.Err("Compression::OpenFile : Failed to open %s [%s]", options.Name, err.Error())
+		_ = c.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle, Ctx: options.Ctx})
+		return nil, err
+	}
+	return handle, nil
+}
+
+func (c *Compression) CloseFile(options internal.CloseFileOptions) error {
+	if of := compressedHandle(options.Handle); of != nil {
+		c.closeCompressed(options.Ctx, of)
+		options.Handle.RemoveValue(handleKey)
+	}
+	return c.NextComponent().CloseFile(options)
+}
+
+// compressedHandle : State of the handle if it is of a compressed file
+func compressedHandle(handle *handlemap.Handle) *openFile {
+	value, found := handle.GetValue(handleKey)
+	if !found {
+		return nil
+	}
+	return value.(*openFile)
+}
+
+// readLogical : Fill data with the uncompressed data at offset, reading only the frames covering the range.
+// Range shall lie within the uncompressed size of the file.
+func (c *Compression) readLogical(ctx context.Context, of *openFile, offset int64, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	frameSize := of.layout.frameSize
+	first := offset / frameSize
+	last := (offset + int64(len(data)) - 1) / frameSize
+
+	start := int64(0)
+	if first > 0 {
+		start = of.index[first-1]
+	}
+	raw := make([]byte, of.index[last]-start)
+	_, err := c.NextComponent().ReadInBuffer(internal.ReadInBufferOptions{Handle: of.lower, Offset: start, Data: raw, Ctx: ctx})
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, frameSize)
+	for i := first; i <= last; i++ {
+		frameStart := int64(0)
+		if i > 0 {
+			frameStart = of.index[i-1]
+		}
+
+		length := of.layout.frameLength(i)
+		n, err := of.codec.decompress(frame[:length], raw[frameStart-start:of.index[i]-start])
+		if err != nil || int64(n) != length {
+			log.Err("Compression::readLogical : Frame %d of %s is corrupt", i, of.lower.Path)
+			return syscall.EIO
+		}
+
+		// Copy the part of the frame which overlaps the requested range
+		logicalStart := i * frameSize
+		from := int64(0)
+		if offset > logicalStart {
+			from = offset - logicalStart
+		}
+		copy(data[logicalStart+from-offset:], frame[from:length])
+	}
+
+	return nil
+}
+
+func (c *Compression) ReadInBuffer(options internal.ReadInBufferOptions) (int, error) {
+	of := compressedHandle(options.Handle)
+	if of == nil {
+		return c.NextComponent().ReadInBuffer(options)
+	}
+
+	size := atomic.LoadInt64(&options.Handle.Size)
+	if options.Offset > size {
+		return 0, syscall.ERANGE
+	}
+
+	length := int64(len(options.Data))
+	if options.Offset+length > size {
+		length = size - options.Offset
+	}
+
+	err := c.readLogical(options.Ctx, of, options.Offset, options.Data[:length])
+	if err != nil {
+		log.Err("Compression::ReadInBuffer : Failed to read %s [%s]", options.Handle.Path, err.Error())
+		return 0, err
+	}
+	return int(length), nil
+}
+
+func (c *Compression) ReadFile(options internal.ReadFileOptions) ([]byte, error) {
+	of := compressedHandle(options.Handle)
+	if of == nil {
+		return c.NextComponent().ReadFile(options)
+	}
+
+	data := make([]byte, atomic.LoadInt64(&options.Handle.Size))
+	err := c.readLogical(options.Ctx, of, 0, data)
+	if err != nil {
+		log.Err("Compression::ReadFile : Failed to read %s [%s]", options.Handle.Path, err.Error())
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetFileBlockOffsets : Blocks of a compressed blob do not line up with the data, so layers above are told to treat it
+// as a single blob and read it by uncompressed offsets
+func (c *Compression) GetFileBlockOffsets(options internal.GetFileBlockOffsetsOptions) (*common.BlockOffsetList, error) {
+	attr, err := c.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	if !isCompressed(attr) {
+		return c.NextComponent().GetFileBlockOffsets(options)
+	}
+
+	offsets := &common.BlockOffsetList{}
+	offsets.Flags.Set(common.SmallFile)
+	return offsets, nil
+}
+
+// CopyToFile : Download and decompress the range of the file, data is written from the start of the local file
+func (c *Compression) CopyToFile(options internal.CopyToFileOptions) error {
+	log.Trace("Compression::CopyToFile : Read file %s", options.Name)
+
+	attr, err := c.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return err
+	}
+
+	if !isCompressed(attr) {
+		return c.NextComponent().CopyToFile(options)
+	}
+
+	return c.download(options.Ctx, attr, options.Offset, options.Count, options.File)
+}
+
+func (c *Compression) download(ctx context.Context, attr *internal.ObjAttr, offset int64, count int64, f *os.File) error {
+	of, err := c.openCompressed(ctx, attr)
+	if err != nil {
+		return err
+	}
+	defer c.closeCompressed(ctx, of)
+
+	size := of.layout.size
+	if offset > size {
+		offset = size
+	}
+	if count == 0 || offset+count > size {
+		count = size - offset
+	}
+
+	err = f.Truncate(count)
+	if err != nil {
+		log.Err("Compression::download : Failed to truncate local file for %s [%s]", attr.Path, err.Error())
+		return err
+	}
+
+	batch := (readBatchSize / of.layout.frameSize) * of.layout.frameSize
+	if batch == 0 {
+		batch = of.layout.frameSize
+	}
+
+	buf := make([]byte, batch)
+	for done := int64(0); done < count; {
+		length := count - done
+		if length > batch {
+			length = batch
+		}
+
+		err = c.readLogical(ctx, of, offset+done, buf[:length])
+		if err != nil {
+			log.Err("Compression::download : Failed to read %s [%s]", attr.Path, err.Error())
+			return err
+		}
+
+		_, err = f.WriteAt(buf[:length], done)
+		if err != nil {
+			log.Err("Compression::download : Failed to write local file for %s [%s]", attr.Path, err.Error())
+			return err
+		}
+		done += length
+	}
+
+	return nil
+}
+
+// ------------------------- Writes -------------------------------------------
+
+// CopyFromFile : Compress the local file if it matches the configured patterns and gets smaller, otherwise upload it as is
+func (c *Compression) CopyFromFile(options internal.CopyFromFileOptions) error {
+	log.Trace("Compression::CopyFromFile : Upload file %s", options.Name)
+	src, size, err := options.UploadSource()
+	if err != nil {
+		log.Err("Compression::CopyFromFile : Failed to get size of local file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+	return c.upload(options.Ctx, options.Name, src, size, options.Metadata, options.ETag, options.Handle)
+}
+
+func (c *Compression) upload(ctx context.Context, name string, src io.ReaderAt, size int64, metadata map[string]string, etag string, handle *handlemap.Handle) error {
+	// Metadata of a previous compressed upload must not describe the new data
+	userMetadata := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if !isCompressionMetadataKey(strings.ToLower(k)) {
+			userMetadata[k] = v
+		}
+	}
+
+	if size > 0 && c.shallCompress(name) {
+		tmp, layout, err := c.compressFile(name, src, size)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}()
+
+		if layout != nil {
+			for k, v := range layout.metadata() {
+				userMetadata[k] = v
+			}
+
+			log.Debug("Compression::upload : %s compressed from %d to %d bytes", name, size, layout.indexOffset+layout.indexSize())
+			return c.NextComponent().CopyFromFile(internal.CopyFromFileOptions{
+				Name:     name,
+				File:     tmp,
+				Metadata: userMetadata,
+				ETag:     etag,
+				Handle:   handle,
+				Ctx:      ctx,
+			})
+		}
+	}
+
+	next := internal.CopyFromFileOptions{
+		Name:     name,
+		Metadata: userMetadata,
+		ETag:     etag,
+		Handle:   handle,
+		Ctx:      ctx,
+	}
+	if f, ok := src.(*os.File); ok {
+		_, err := f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		next.File = f
+	} else {
+		next.Reader, next.Size = src, size
+	}
+
+	return c.NextComponent().CopyFromFile(next)
+}
+
+// compressFile : Write the frames and the index of the file to a temporary file rewound for upload.
+// Layout is nil if compression did not make the file smaller.
+func (c *Compression) compressFile(name string, src io.ReaderAt, size int64) (*os.File, *frameLayout, error) {
+	tmp, err := ioutil.TempFile(c.tmpPath, "blobfuse2-compression-")
+	if err != nil {
+		log.Err("Compression::compressFile : Failed to create temporary file for %s [%s]", name, err.Error())
+		return nil, nil, err
+	}
+
+	layout := &frameLayout{codec: c.codecName, size: size, frameSize: c.frameSize}
+	index, err := writeFrames(c.codec, io.NewSectionReader(src, 0, size), layout, tmp)
+	if err == nil {
+		_, err = tmp.Write(index)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Err("Compression::compressFile : Failed to compress %s [%s]", name, err.Error())
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+
+	if layout.indexOffset+layout.indexSize() >= size {
+		log.Debug("Compression::compressFile : %s does not compress, uploading as is", name)
+		return tmp, nil, nil
+	}
+	return tmp, layout, nil
+}
+
+// writeFrames : Compress the data frame by frame into dst, returning the encoded index and recording where it starts
+func writeFrames(fc codec, src io.Reader, layout *frameLayout, dst io.Writer) ([]byte, error) {
+	w := bufio.NewWriterSize(dst, int(layout.frameSize))
+	plain := make([]byte, layout.frameSize)
+	index := make([]byte, 0, layout.indexSize())
+	var frame bytes.Buffer
+
+	offset := int64(0)
+	for i := int64(0); i < layout.frames(); i++ {
+		length := layout.frameLength(i)
+		_, err := io.ReadFull(src, plain[:length])
+		if err != nil {
+			return nil, err
+		}
+
+		frame.Reset()
+		err = fc.compress(&frame, plain[:length])
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = w.Write(frame.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		offset += int64(frame.Len())
+		var entry [indexEntrySize]byte
+		binary.BigEndian.PutUint64(entry[:], uint64(offset))
+		index = append(index, entry[:]...)
+	}
+
+	layout.indexOffset = offset
+	return index, w.Flush()
+}
+
+// TruncateFile : Compressed files are rebuilt at the new size, others are truncated by the next component
+func (c *Compression) TruncateFile(options internal.TruncateFileOptions) error {
+	log.Trace("Compression::TruncateFile : %s to %d bytes", options.Name, options.Size)
+
+	attr, err := c.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return err
+	}
+
+	if !isCompressed(attr) {
+		return c.NextComponent().TruncateFile(options)
+	}
+
+	tmp, err := ioutil.TempFile(c.tmpPath, "blobfuse2-compression-")
+	if err != nil {
+		log.Err("Compression::TruncateFile : Failed to create temporary file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if options.Size > 0 {
+		err = c.download(options.Ctx, attr, 0, options.Size, tmp)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tmp.Truncate(options.Size)
+	if err != nil {
+		log.Err("Compression::TruncateFile : Failed to truncate local file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+
+	return c.upload(options.Ctx, options.Name, tmp, options.Size, attr.Metadata, attr.ETag, nil)
+}
+
+// WriteFile : Writes at an offset of a compressed blob would have to rebuild its frames, data has to be uploaded through CopyFromFile
+func (c *Compression) WriteFile(options internal.WriteFileOptions) (int, error) {
+	if compressedHandle(options.Handle) != nil {
+		log.Err("Compression::WriteFile : Partial write of compressed file %s is not supported, use file_cache to write it", options.Handle.Path)
+		return 0, syscall.ENOTSUP
+	}
+	return c.NextComponent().WriteFile(options)
+}
+
+// FlushFile : Blocks cached by the layers above hold uncompressed data which can not be committed to a compressed blob
+func (c *Compression) FlushFile(options internal.FlushFileOptions) error {
+	if compressedHandle(options.Handle) != nil && options.Handle.CacheObj != nil && options.Handle.CacheObj.BlockOffsetList != nil {
+		for _, block := range options.Handle.CacheObj.BlockList {
+			if block.Dirty() {
+				log.Err("Compression::FlushFile : Partial write of compressed file %s is not supported, use file_cache to write it", options.Handle.Path)
+				return syscall.ENOTSUP
+			}
+		}
+	}
+	return c.NextComponent().FlushFile(options)
+}
+
+// CopyFileRange : Copies on the service decide on blob sizes, which differ from the data sizes of compressed files
+func (c *Compression) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	if compressedHandle(options.SrcHandle) != nil || compressedHandle(options.DstHandle) != nil {
+		return 0, syscall.ENOTSUP
+	}
+	return c.NextComponent().CopyFileRange(options)
+}
+
+// ------------------------- Extended attributes -------------------------------------------
+
+// isCompressionXattr : Attribute maps to the metadata describing the compression of the file
+func isCompressionXattr(name string) bool {
+	return strings.HasPrefix(name, internal.XattrUserPrefix) &&
+		isCompressionMetadataKey(strings.ToLower(strings.TrimPrefix(name, internal.XattrUserPrefix)))
+}
+
+func (c *Compression) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	if isCompressionXattr(options.Attr) {
+		return nil, syscall.ENODATA
+	}
+	return c.NextComponent().GetXattr(options)
+}
+
+func (c *Compression) ListXattr(options internal.ListXattrOptions) ([]string, error) {
+	names, err := c.NextComponent().ListXattr(options)
+	if err != nil {
+		return names, err
+	}
+
+	visible := names[:0]
+	for _, name := range names {
+		if !isCompressionXattr(name) {
+			visible = append(visible, name)
+		}
+	}
+	return visible, nil
+}
+
+func (c *Compression) SetXattr(options internal.SetXattrOptions) error {
+	if isCompressionXattr(options.Attr) {
+		return syscall.EPERM
+	}
+	return c.NextComponent().SetXattr(options)
+}
+
+func (c *Compression) RemoveXattr(options internal.RemoveXattrOptions) error {
+	if isCompressionXattr(options.Attr) {
+		return syscall.EPERM
+	}
+	return c.NextComponent().RemoveXattr(options)
+}
+
+// ------------------------- Factory -------------------------------------------
+
+// Pipeline will call this method to create your object, initialize your variables here
+// << DO NOT DELETE ANY AUTO GENERATED CODE HERE >>
+func NewCompressionComponent() internal.Component {
+	comp := &Compression{}
+	comp.SetName(compName)
+	return comp
+}
+
+// On init register this component to pipeline and supply your constructor
+func init() {
+	internal.AddComponent(compName, NewCompressionComponent)
+}
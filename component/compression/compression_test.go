@@ -0,0 +1,485 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package compression
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/component/azstorage"
+	"github.com/Azure/azure-storage-fuse/v2/component/encryption"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type compressionTestSuite struct {
+	suite.Suite
+	assert      *assert.Assertions
+	compression *Compression
+	storage     internal.Component
+	tmpPath     string
+}
+
+// getCompressibleData : lines of text, compresses well but not to nothing
+func getCompressibleData(size int) []byte {
+	var buf bytes.Buffer
+	random := make([]byte, 8)
+	for buf.Len() < size {
+		_, _ = rand.Read(random)
+		buf.WriteString("2023-01-01T00:00:00Z INFO request served id=" + base64.StdEncoding.EncodeToString(random) + "\n")
+	}
+	return buf.Bytes()[:size]
+}
+
+func getRandomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func newTestCompression(next internal.Component, configuration string) (*Compression, error) {
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader(configuration))
+	c := NewCompressionComponent()
+	c.SetNextComponent(next)
+	err := c.Configure(true)
+	return c.(*Compression), err
+}
+
+func (suite *compressionTestSuite) SetupTest() {
+	err := log.SetDefaultLogger("silent", common.LogConfig{})
+	if err != nil {
+		panic("Unable to set silent logger as default.")
+	}
+	suite.assert = assert.New(suite.T())
+
+	suite.tmpPath, err = ioutil.TempDir("", "compression_test")
+	suite.assert.Nil(err)
+
+	suite.storage = azstorage.NewazstorageComponent()
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader("azstorage:\n  type: memory\n"))
+	suite.assert.Nil(suite.storage.Configure(true))
+	suite.assert.Nil(suite.storage.Start(context.Background()))
+
+	suite.setupTestHelper("compression:\n  frame-size-kb: 4\n")
+}
+
+func (suite *compressionTestSuite) setupTestHelper(configuration string) {
+	var err error
+	suite.compression, err = newTestCompression(suite.storage, configuration)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.compression.Start(context.Background()))
+}
+
+func (suite *compressionTestSuite) TearDownTest() {
+	_ = suite.compression.Stop()
+	_ = suite.storage.Stop()
+	_ = os.RemoveAll(suite.tmpPath)
+}
+
+// upload : write data to a local file and upload it through the component under test
+func (suite *compressionTestSuite) upload(name string, data []byte) {
+	f, err := ioutil.TempFile(suite.tmpPath, "upload")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.compression.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f}))
+}
+
+// blobAttr : attributes of the blob as held by storage
+func (suite *compressionTestSuite) blobAttr(name string) *internal.ObjAttr {
+	attr, err := suite.storage.GetAttr(internal.GetAttrOptions{Name: name})
+	suite.assert.Nil(err)
+	return attr
+}
+
+// download : read the whole file through the component under test
+func (suite *compressionTestSuite) download(name string) ([]byte, error) {
+	f, err := ioutil.TempFile(suite.tmpPath, "download")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	err = suite.compression.CopyToFile(internal.CopyToFileOptions{Name: name, File: f})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+func (suite *compressionTestSuite) TestDefaultConfig() {
+	suite.setupTestHelper("compression:\n")
+	suite.assert.Equal(compName, suite.compression.Name())
+	suite.assert.Equal(defaultCodec, suite.compression.codecName)
+	suite.assert.EqualValues(defaultFrameSizeKB*1024, suite.compression.frameSize)
+	suite.assert.Empty(suite.compression.include)
+	suite.assert.Equal(internal.EComponentPriority.LevelThree(), suite.compression.Priority())
+	suite.assert.True(suite.compression.Priority() > encryption.NewEncryptionComponent().Priority())
+}
+
+func (suite *compressionTestSuite) TestInvalidConfig() {
+	configs := []string{
+		"compression:\n  codec: lz4\n",
+		"compression:\n  level: 12\n",
+		"compression:\n  codec: zstd\n  level: 23\n",
+		"compression:\n  frame-size-kb: 0\n",
+		"compression:\n  frame-size-kb: 32768\n",
+		"compression:\n  include:\n    - \"[a-\"\n",
+	}
+	for _, configuration := range configs {
+		_, err := newTestCompression(suite.storage, configuration)
+		suite.assert.NotNil(err, configuration)
+	}
+}
+
+func (suite *compressionTestSuite) TestMatchPattern() {
+	suite.assert.True(matchPattern("*.log", "app.log"))
+	suite.assert.True(matchPattern("*.log", "dir/sub/app.log"))
+	suite.assert.False(matchPattern("*.log", "app.log.gz"))
+	suite.assert.True(matchPattern("logs/*.txt", "logs/a.txt"))
+	suite.assert.False(matchPattern("logs/*.txt", "other/logs/a.txt"))
+	suite.assert.True(matchPattern("archive/**", "archive/2023/01/a.bin"))
+	suite.assert.True(matchPattern("/archive/**", "archive/a"))
+	suite.assert.False(matchPattern("archive/**", "archive"))
+	suite.assert.False(matchPattern("archive/**", "archives/a"))
+	suite.assert.True(matchPattern("data-*/**", "data-1/a"))
+}
+
+func (suite *compressionTestSuite) TestShallCompress() {
+	suite.setupTestHelper("compression:\n  include:\n    - \"*.log\"\n    - logs/**\n  exclude:\n    - \"*.gz\"\n")
+	suite.assert.True(suite.compression.shallCompress("a.log"))
+	suite.assert.True(suite.compression.shallCompress("logs/a.txt"))
+	suite.assert.False(suite.compression.shallCompress("logs/a.gz"))
+	suite.assert.False(suite.compression.shallCompress("image.jpg"))
+}
+
+func (suite *compressionTestSuite) TestUploadDownload() {
+	for _, size := range []int{1, 100, 4096, 4097, 50000} {
+		data := getCompressibleData(size)
+		suite.upload("file.log", data)
+
+		attr := suite.blobAttr("file.log")
+		if isCompressed(attr) {
+			suite.assert.Less(attr.Size, int64(size))
+		}
+
+		attr, err := suite.compression.GetAttr(internal.GetAttrOptions{Name: "file.log"})
+		suite.assert.Nil(err)
+		suite.assert.EqualValues(size, attr.Size)
+
+		output, err := suite.download("file.log")
+		suite.assert.Nil(err)
+		suite.assert.True(bytes.Equal(data, output))
+	}
+
+	// large enough to be compressed for sure
+	suite.assert.True(isCompressed(suite.blobAttr("file.log")))
+}
+
+func (suite *compressionTestSuite) TestCodecRoundTrip() {
+	for name := range codecs {
+		fc, err := newCodec(name, 0)
+		suite.assert.Nil(err, name)
+
+		for _, size := range []int{1, 4096, 50000} {
+			data := getCompressibleData(size)
+			var frame bytes.Buffer
+			suite.assert.Nil(fc.compress(&frame, data), name)
+
+			output := make([]byte, size)
+			n, err := fc.decompress(output, frame.Bytes())
+			suite.assert.Nil(err, name)
+			suite.assert.Equal(size, n, name)
+			suite.assert.True(bytes.Equal(data, output), name)
+		}
+	}
+}
+
+func (suite *compressionTestSuite) TestZstdUploadDownload() {
+	suite.setupTestHelper("compression:\n  codec: zstd\n  level: 3\n  frame-size-kb: 4\n")
+	data := getCompressibleData(10*4096 + 300)
+	suite.upload("file.log", data)
+
+	attr := suite.blobAttr("file.log")
+	suite.assert.True(isCompressed(attr))
+	suite.assert.Less(attr.Size, int64(len(data)))
+	codecName, _ := attr.GetMetadata(metaCodec)
+	suite.assert.Equal("zstd", codecName)
+
+	output, err := suite.download("file.log")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+
+	// Codec of a file comes from its metadata, not from the configuration
+	suite.setupTestHelper("compression:\n  frame-size-kb: 4\n")
+	handle, err := suite.compression.OpenFile(internal.OpenFileOptions{Name: "file.log", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	output = make([]byte, 4096)
+	n, err := suite.compression.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 4000, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(4096, n)
+	suite.assert.True(bytes.Equal(data[4000:8096], output))
+	suite.assert.Nil(suite.compression.CloseFile(internal.CloseFileOptions{Handle: handle}))
+}
+
+func (suite *compressionTestSuite) TestIncompressibleLeftAlone() {
+	data := getRandomData(20000)
+	suite.upload("image.jpg", data)
+
+	attr := suite.blobAttr("image.jpg")
+	suite.assert.False(isCompressed(attr))
+	suite.assert.EqualValues(len(data), attr.Size)
+
+	output, err := suite.download("image.jpg")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+}
+
+func (suite *compressionTestSuite) TestExcludedLeftAlone() {
+	suite.setupTestHelper("compression:\n  include:\n    - \"*.log\"\n")
+	data := getCompressibleData(20000)
+	suite.upload("file.txt", data)
+
+	attr := suite.blobAttr("file.txt")
+	suite.assert.False(isCompressed(attr))
+	suite.assert.EqualValues(len(data), attr.Size)
+
+	// compressed before, left alone now, metadata shall not describe it as compressed anymore
+	suite.setupTestHelper("compression:\n  frame-size-kb: 4\n")
+	suite.upload("file.txt", data)
+	suite.assert.True(isCompressed(suite.blobAttr("file.txt")))
+
+	suite.setupTestHelper("compression:\n  include:\n    - \"*.log\"\n")
+	f, err := ioutil.TempFile(suite.tmpPath, "upload")
+	suite.assert.Nil(err)
+	defer f.Close()
+	_, _ = f.Write(data)
+	err = suite.compression.CopyFromFile(internal.CopyFromFileOptions{Name: "file.txt", File: f, Metadata: suite.blobAttr("file.txt").Metadata})
+	suite.assert.Nil(err)
+	suite.assert.False(isCompressed(suite.blobAttr("file.txt")))
+}
+
+func (suite *compressionTestSuite) TestRangeRead() {
+	data := getCompressibleData(10*4096 + 300)
+	suite.upload("file.log", data)
+
+	handle, err := suite.compression.OpenFile(internal.OpenFileOptions{Name: "file.log", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), handle.Size)
+
+	ranges := []struct {
+		offset int64
+		length int
+	}{
+		{0, 10}, {4000, 200}, {4096, 4096}, {100, 20000}, {10 * 4096, 300}, {10*4096 + 250, 100},
+	}
+	for _, r := range ranges {
+		output := make([]byte, r.length)
+		n, err := suite.compression.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: r.offset, Data: output})
+		suite.assert.Nil(err)
+
+		expected := data[r.offset:]
+		if len(expected) > r.length {
+			expected = expected[:r.length]
+		}
+		suite.assert.Equal(len(expected), n)
+		suite.assert.True(bytes.Equal(expected, output[:n]))
+	}
+
+	output, err := suite.compression.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+
+	offsets, err := suite.compression.GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file.log"})
+	suite.assert.Nil(err)
+	suite.assert.True(offsets.SmallFile())
+
+	_, err = suite.compression.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: []byte("x")})
+	suite.assert.Equal(syscall.ENOTSUP, err)
+
+	suite.assert.Nil(suite.compression.CloseFile(internal.CloseFileOptions{Handle: handle}))
+}
+
+func (suite *compressionTestSuite) TestCorruptIndex() {
+	data := getCompressibleData(20000)
+	suite.upload("file.log", data)
+
+	// cutting the blob leaves the index offset in metadata pointing past the end
+	attr := suite.blobAttr("file.log")
+	handle, err := suite.storage.OpenFile(internal.OpenFileOptions{Name: "file.log", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	blob, err := suite.storage.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+
+	f, err := ioutil.TempFile(suite.tmpPath, "blob")
+	suite.assert.Nil(err)
+	defer f.Close()
+	_, _ = f.Write(blob[:len(blob)-8])
+	_, _ = f.Seek(0, 0)
+	suite.assert.Nil(suite.storage.CopyFromFile(internal.CopyFromFileOptions{Name: "file.log", File: f, Metadata: attr.Metadata}))
+
+	_, err = suite.download("file.log")
+	suite.assert.Equal(syscall.EIO, err)
+}
+
+func (suite *compressionTestSuite) TestTruncateFile() {
+	data := getCompressibleData(20000)
+	suite.upload("file.log", data)
+
+	suite.assert.Nil(suite.compression.TruncateFile(internal.TruncateFileOptions{Name: "file.log", Size: 10000}))
+	output, err := suite.download("file.log")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data[:10000], output))
+
+	suite.assert.Nil(suite.compression.TruncateFile(internal.TruncateFileOptions{Name: "file.log", Size: 0}))
+	attr, err := suite.compression.GetAttr(internal.GetAttrOptions{Name: "file.log"})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(0, attr.Size)
+	suite.assert.False(isCompressed(suite.blobAttr("file.log")))
+}
+
+func (suite *compressionTestSuite) TestListSizes() {
+	suite.upload("dir/a.log", getCompressibleData(10000))
+	suite.upload("dir/b.log", getCompressibleData(30000))
+
+	entries, err := suite.compression.ReadDir(internal.ReadDirOptions{Name: "dir"})
+	suite.assert.Nil(err)
+	suite.assert.Len(entries, 2)
+	suite.assert.EqualValues(10000, entries[0].Size)
+	suite.assert.EqualValues(30000, entries[1].Size)
+
+	entries, _, err = suite.compression.StreamDir(internal.StreamDirOptions{Name: "dir"})
+	suite.assert.Nil(err)
+	suite.assert.Len(entries, 2)
+	suite.assert.EqualValues(10000, entries[0].Size)
+	suite.assert.EqualValues(30000, entries[1].Size)
+	for _, entry := range entries {
+		_, found := entry.GetMetadata(metaCodec)
+		suite.assert.False(found)
+	}
+}
+
+func (suite *compressionTestSuite) TestCompressionXattrHidden() {
+	suite.upload("file.log", getCompressibleData(10000))
+
+	names, err := suite.compression.ListXattr(internal.ListXattrOptions{Name: "file.log"})
+	suite.assert.Nil(err)
+	for _, name := range names {
+		suite.assert.False(strings.Contains(name, "blobfuse2_compression"), name)
+	}
+
+	_, err = suite.compression.GetXattr(internal.GetXattrOptions{Name: "file.log", Attr: internal.XattrUserPrefix + metaSize})
+	suite.assert.Equal(syscall.ENODATA, err)
+
+	err = suite.compression.SetXattr(internal.SetXattrOptions{Name: "file.log", Attr: internal.XattrUserPrefix + metaSize, Value: []byte("1")})
+	suite.assert.Equal(syscall.EPERM, err)
+
+	err = suite.compression.RemoveXattr(internal.RemoveXattrOptions{Name: "file.log", Attr: internal.XattrUserPrefix + metaCodec})
+	suite.assert.Equal(syscall.EPERM, err)
+
+	// attr_cache serves xattrs from the metadata of cached attributes, so it must not carry the layout either
+	attr, err := suite.compression.GetAttr(internal.GetAttrOptions{Name: "file.log", RetrieveMetadata: true})
+	suite.assert.Nil(err)
+	for _, key := range []string{metaCodec, metaSize, metaFrameSize, metaIndex} {
+		_, found := attr.GetMetadata(key)
+		suite.assert.False(found, key)
+	}
+	suite.assert.True(isCompressed(suite.blobAttr("file.log")))
+}
+
+func (suite *compressionTestSuite) TestOverEncryption() {
+	keyFile := filepath.Join(suite.tmpPath, "master.key")
+	suite.assert.Nil(ioutil.WriteFile(keyFile, getRandomData(32), 0600))
+
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader("encryption:\n  key-file: " + keyFile + "\n  chunk-size-kb: 1\n"))
+	enc := encryption.NewEncryptionComponent()
+	enc.SetNextComponent(suite.storage)
+	suite.assert.Nil(enc.Configure(true))
+
+	suite.setupTestHelperWithNext(enc, "compression:\n  frame-size-kb: 4\n")
+
+	data := getCompressibleData(30000)
+	suite.upload("file.log", data)
+
+	// compressed size as seen through encryption, blob is bigger by the overhead of the chunks
+	encAttr, err := enc.GetAttr(internal.GetAttrOptions{Name: "file.log"})
+	suite.assert.Nil(err)
+	suite.assert.True(isCompressed(encAttr))
+	suite.assert.Less(encAttr.Size, int64(len(data)))
+	suite.assert.Greater(suite.blobAttr("file.log").Size, encAttr.Size)
+
+	attr, err := suite.compression.GetAttr(internal.GetAttrOptions{Name: "file.log"})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), attr.Size)
+
+	output, err := suite.download("file.log")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+
+	handle, err := suite.compression.OpenFile(internal.OpenFileOptions{Name: "file.log", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	part := make([]byte, 5000)
+	n, err := suite.compression.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 12345, Data: part})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(part), n)
+	suite.assert.True(bytes.Equal(data[12345:12345+5000], part))
+	suite.assert.Nil(suite.compression.CloseFile(internal.CloseFileOptions{Handle: handle}))
+}
+
+func (suite *compressionTestSuite) setupTestHelperWithNext(next internal.Component, configuration string) {
+	var err error
+	suite.compression, err = newTestCompression(next, configuration)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.compression.Start(context.Background()))
+}
+
+func TestCompressionTestSuite(t *testing.T) {
+	suite.Run(t, new(compressionTestSuite))
+}
@@ -0,0 +1,327 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/* Layout of a compressed blob
+   - Data is split in frames of a fixed uncompressed size, only the last frame may be shorter
+   - Each frame is compressed on its own, so any frame can be decompressed without reading the ones before it
+   - Frames are followed by the index, the end offset of every frame in the blob as big endian uint64
+   - Codec, uncompressed size, frame size and offset of the index are stored in the blob metadata
+*/
+
+// Metadata keys describing the compression of a blob
+const (
+	metaCodec     = "blobfuse2_compression"
+	metaSize      = "blobfuse2_compression_size"
+	metaFrameSize = "blobfuse2_compression_frame"
+	metaIndex     = "blobfuse2_compression_index"
+)
+
+const indexEntrySize = 8
+
+var errCorrupt = errors.New("compressed data is corrupt")
+
+// isCompressionMetadataKey : Key is one of the metadata keys owned by this component
+func isCompressionMetadataKey(key string) bool {
+	switch key {
+	case metaCodec, metaSize, metaFrameSize, metaIndex:
+		return true
+	}
+	return false
+}
+
+// codec : compression algorithm applied to each frame
+type codec interface {
+	// compress : append the compressed form of src to dst
+	compress(dst *bytes.Buffer, src []byte) error
+	// decompress : fill dst with the data of the compressed frame, returns the number of bytes produced
+	decompress(dst []byte, src []byte) (int, error)
+}
+
+// Codecs by name, each constructor takes the configured compression level
+var codecs = map[string]func(level int) (codec, error){
+	"gzip": newGzipCodec,
+	"zstd": newZstdCodec,
+}
+
+func newCodec(name string, level int) (codec, error) {
+	constructor, found := codecs[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("unsupported codec %s", name)
+	}
+	return constructor(level)
+}
+
+type gzipCodec struct {
+	level int
+}
+
+func newGzipCodec(level int) (codec, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	} else if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid gzip level %d, shall be between %d and %d", level, gzip.BestSpeed, gzip.BestCompression)
+	}
+	return &gzipCodec{level: level}, nil
+}
+
+func (c *gzipCodec) compress(dst *bytes.Buffer, src []byte) error {
+	w, err := gzip.NewWriterLevel(dst, c.level)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(src)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (c *gzipCodec) decompress(dst []byte, src []byte) (int, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, dst)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// zstd levels as defined by the reference implementation, mapped to the closest level of the encoder
+const (
+	zstdMinLevel = 1
+	zstdMaxLevel = 22
+)
+
+type zstdCodec struct {
+	level   int
+	once    sync.Once
+	encoder *zstd.Encoder
+	err     error
+}
+
+// zstdDecoder : shared by all files, decoding of whole frames is safe for concurrent use
+var zstdDecoder struct {
+	once    sync.Once
+	decoder *zstd.Decoder
+	err     error
+}
+
+func newZstdCodec(level int) (codec, error) {
+	if level != 0 && (level < zstdMinLevel || level > zstdMaxLevel) {
+		return nil, fmt.Errorf("invalid zstd level %d, shall be between %d and %d", level, zstdMinLevel, zstdMaxLevel)
+	}
+	return &zstdCodec{level: level}, nil
+}
+
+func (c *zstdCodec) compress(dst *bytes.Buffer, src []byte) error {
+	// Codecs opened to read a file never compress, so the encoder is only created on first use
+	c.once.Do(func() {
+		level := zstd.SpeedDefault
+		if c.level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.level)
+		}
+		c.encoder, c.err = zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	})
+	if c.err != nil {
+		return c.err
+	}
+
+	_, err := dst.Write(c.encoder.EncodeAll(src, nil))
+	return err
+}
+
+func (c *zstdCodec) decompress(dst []byte, src []byte) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	} else if len(src) == 0 {
+		return 0, errCorrupt
+	}
+
+	zstdDecoder.once.Do(func() {
+		zstdDecoder.decoder, zstdDecoder.err = zstd.NewReader(nil)
+	})
+	if zstdDecoder.err != nil {
+		return 0, zstdDecoder.err
+	}
+
+	// Uncompressed length of every frame is known, so the frame is decoded in place
+	out, err := zstdDecoder.decoder.DecodeAll(src, dst[:0])
+	if err != nil {
+		return 0, err
+	} else if len(out) > len(dst) {
+		return 0, errCorrupt
+	}
+	return copy(dst, out), nil
+}
+
+// frameLayout : how the data of a compressed blob is laid out
+type frameLayout struct {
+	codec       string
+	size        int64 // uncompressed size of the file
+	frameSize   int64
+	indexOffset int64 // where the frames end and the index starts
+}
+
+// isCompressed : Blob carries the metadata of a compressed file
+func isCompressed(attr *internal.ObjAttr) bool {
+	_, found := attr.GetMetadata(metaCodec)
+	return found
+}
+
+// layoutOf : read the layout of a compressed blob from its metadata
+func layoutOf(attr *internal.ObjAttr) (*frameLayout, error) {
+	layout := &frameLayout{}
+	layout.codec, _ = attr.GetMetadata(metaCodec)
+
+	var err error
+	value, _ := attr.GetMetadata(metaSize)
+	layout.size, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || layout.size < 0 {
+		return nil, fmt.Errorf("invalid size %s", value)
+	}
+
+	value, _ = attr.GetMetadata(metaFrameSize)
+	layout.frameSize, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || layout.frameSize <= 0 || layout.frameSize > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame size %s", value)
+	}
+
+	value, _ = attr.GetMetadata(metaIndex)
+	layout.indexOffset, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || layout.indexOffset < 0 || layout.indexOffset+layout.indexSize() != attr.Size {
+		return nil, fmt.Errorf("invalid index offset %s", value)
+	}
+
+	return layout, nil
+}
+
+func (l *frameLayout) metadata() map[string]string {
+	return map[string]string{
+		metaCodec:     l.codec,
+		metaSize:      strconv.FormatInt(l.size, 10),
+		metaFrameSize: strconv.FormatInt(l.frameSize, 10),
+		metaIndex:     strconv.FormatInt(l.indexOffset, 10),
+	}
+}
+
+func (l *frameLayout) frames() int64 {
+	return (l.size + l.frameSize - 1) / l.frameSize
+}
+
+func (l *frameLayout) indexSize() int64 {
+	return l.frames() * indexEntrySize
+}
+
+// frameLength : uncompressed length of the frame
+func (l *frameLayout) frameLength(frame int64) int64 {
+	if rem := l.size - frame*l.frameSize; rem < l.frameSize {
+		return rem
+	}
+	return l.frameSize
+}
+
+// parseIndex : end offsets of the frames, which shall grow and stay within the frames area
+func (l *frameLayout) parseIndex(data []byte) ([]int64, error) {
+	if int64(len(data)) != l.indexSize() {
+		return nil, errCorrupt
+	}
+
+	index := make([]int64, l.frames())
+	last := int64(0)
+	for i := range index {
+		index[i] = int64(binary.BigEndian.Uint64(data[i*indexEntrySize:]))
+		if index[i] <= last || index[i] > l.indexOffset {
+			return nil, errCorrupt
+		}
+		last = index[i]
+	}
+
+	if len(index) > 0 && last != l.indexOffset {
+		return nil, errCorrupt
+	}
+	return index, nil
+}
+
+// matchPattern : Patterns holding a '/' are matched against the whole path, others against the base name.
+// A pattern ending in "/**" matches everything under the directories it matches.
+func matchPattern(pattern string, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	name = strings.Trim(name, "/")
+
+	if strings.HasSuffix(pattern, "/**") {
+		dir := strings.TrimSuffix(pattern, "/**")
+		parts := strings.Split(name, "/")
+		depth := strings.Count(dir, "/") + 1
+		if len(parts) <= depth {
+			return false
+		}
+		matched, _ := path.Match(dir, strings.Join(parts[:depth], "/"))
+		return matched
+	}
+
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// validPattern : Pattern has the syntax accepted by matchPattern
+func validPattern(pattern string) bool {
+	_, err := path.Match(strings.TrimSuffix(strings.Trim(pattern, "/"), "/**"), "")
+	return err == nil
+}
@@ -0,0 +1,772 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package encryption
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+)
+
+/* NOTES:
+   - Encryption sits right above the storage component so that every component above it sees plain text data and sizes
+   - Files are encrypted as a whole when they are uploaded, which is what file_cache does on close.
+     Writes at an offset of the blob, as done by stream and block_cache, are refused so no plain text ever reaches storage
+   - Reads at any offset are served by decrypting just the chunks covering the range, so stream and block_cache can read
+*/
+
+// Common structure for Encryption Component
+type Encryption struct {
+	internal.BaseComponent
+	key              *masterKey
+	chunkSize        int64
+	allowUnencrypted bool
+	tmpPath          string
+}
+
+// Structure defining your config parameters
+type EncryptionOptions struct {
+	KeyFile          string `config:"key-file" yaml:"key-file,omitempty"`
+	ChunkSizeKB      uint64 `config:"chunk-size-kb" yaml:"chunk-size-kb,omitempty"`
+	AllowUnencrypted bool   `config:"allow-unencrypted" yaml:"allow-unencrypted,omitempty"`
+	TmpPath          string `config:"tmp-path" yaml:"tmp-path,omitempty"`
+}
+
+const compName = "encryption"
+
+// Master key is read from this environment variable when no key file is configured
+const EncryptionKeyEnv = "BLOBFUSE2_ENCRYPTION_KEY"
+
+const (
+	defaultChunkSizeKB = 64
+	maxChunkSize       = 16 * 1024 * 1024
+
+	// Ranges are read from storage in batches of this size while downloading a whole file
+	readBatchSize = 4 * 1024 * 1024
+
+	// Key of the state of an encrypted file stored in its handle
+	handleKey = "encryption"
+)
+
+// openFile : state of an open encrypted file
+type openFile struct {
+	key   *fileKey
+	lower *handlemap.Handle // handle with the size of the blob, used to read the cipher text from storage
+}
+
+// Verification to check satisfaction criteria with Component Interface
+var _ internal.Component = &Encryption{}
+
+func (e *Encryption) Name() string {
+	return compName
+}
+
+func (e *Encryption) SetName(name string) {
+	e.BaseComponent.SetName(name)
+}
+
+func (e *Encryption) SetNextComponent(nc internal.Component) {
+	e.BaseComponent.SetNextComponent(nc)
+}
+
+func (e *Encryption) Priority() internal.ComponentPriority {
+	return internal.EComponentPriority.LevelFour()
+}
+
+// Start : Pipeline calls this method to start the component functionality
+//
+//	this shall not block the call otherwise pipeline will not start
+func (e *Encryption) Start(ctx context.Context) error {
+	log.Trace("Encryption::Start : Starting component %s", e.Name())
+	return nil
+}
+
+// Stop : Stop the component functionality and kill all threads started
+func (e *Encryption) Stop() error {
+	log.Trace("Encryption::Stop : Stopping component %s", e.Name())
+	return nil
+}
+
+// Configure : Pipeline will call this method after constructor so that you can read config and initialize yourself
+//
+//	Return failure if any config is not valid to exit the process
+func (e *Encryption) Configure(_ bool) error {
+	log.Trace("Encryption::Configure : %s", e.Name())
+
+	conf := EncryptionOptions{}
+	err := config.UnmarshalKey(e.Name(), &conf)
+	if err != nil {
+		log.Err("Encryption::Configure : config error [invalid config attributes]")
+		return fmt.Errorf("config error in %s [%s]", e.Name(), err.Error())
+	}
+
+	key, err := readMasterKey(common.ExpandPath(conf.KeyFile))
+	if err != nil {
+		log.Err("Encryption::Configure : config error [%s]", err.Error())
+		return fmt.Errorf("config error in %s [%s]", e.Name(), err.Error())
+	}
+
+	e.key, err = newMasterKey(key)
+	if err != nil {
+		log.Err("Encryption::Configure : config error [%s]", err.Error())
+		return fmt.Errorf("config error in %s [%s]", e.Name(), err.Error())
+	}
+
+	e.chunkSize = defaultChunkSizeKB * 1024
+	if config.IsSet(compName + ".chunk-size-kb") {
+		e.chunkSize = int64(conf.ChunkSizeKB * 1024)
+		if e.chunkSize <= 0 || e.chunkSize > maxChunkSize {
+			log.Err("Encryption::Configure : config error [invalid chunk-size-kb %d]", conf.ChunkSizeKB)
+			return fmt.Errorf("config error in %s [chunk-size-kb shall be between 1 and %d]", e.Name(), maxChunkSize/1024)
+		}
+	}
+
+	e.allowUnencrypted = conf.AllowUnencrypted
+
+	e.tmpPath = ""
+	if conf.TmpPath != "" {
+		e.tmpPath = common.ExpandPath(conf.TmpPath)
+		err = os.MkdirAll(e.tmpPath, 0700)
+		if err != nil {
+			log.Err("Encryption::Configure : config error [failed to create directory for %s]", e.tmpPath)
+			return fmt.Errorf("config error in %s [%s]", e.Name(), err.Error())
+		}
+	}
+
+	log.Info("Encryption::Configure : master key %s, chunk-size %d, allow-unencrypted %t, tmp-path %s",
+		e.key.id, e.chunkSize, e.allowUnencrypted, e.tmpPath)
+
+	return nil
+}
+
+// readMasterKey : Master key is taken from the key file or the environment, either as 32 raw bytes or base64 encoded
+func readMasterKey(path string) ([]byte, error) {
+	var data []byte
+	if path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key-file %s [%s]", path, err.Error())
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			log.Warn("Encryption::readMasterKey : key-file %s is accessible by other users", path)
+		}
+
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key-file %s [%s]", path, err.Error())
+		}
+	} else {
+		data = []byte(os.Getenv(EncryptionKeyEnv))
+		if len(data) == 0 {
+			return nil, fmt.Errorf("master key not provided, set key-file or %s", EncryptionKeyEnv)
+		}
+	}
+
+	if len(data) == keySize {
+		return data, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("master key is neither %d bytes nor base64 encoded", keySize)
+	}
+	return key, nil
+}
+
+// ------------------------- Attributes -------------------------------------------
+
+// plainAttr : Report the size of the data instead of the size of the blob for encrypted files
+func (e *Encryption) plainAttr(attr *internal.ObjAttr) {
+	if attr.IsDir() || attr.IsSymlink() || !isEncrypted(attr) {
+		return
+	}
+
+	chunkSize, err := chunkSizeOf(attr)
+	if err == nil {
+		var size int64
+		size, err = plainSize(attr.Size, chunkSize)
+		if err == nil {
+			attr.Size = size
+			return
+		}
+	}
+	log.Err("Encryption::plainAttr : Can not tell size of %s [%s]", attr.Path, err.Error())
+}
+
+// hideMetadata : Drop the metadata holding the wrapped key from attributes handed to the layers above,
+// attr_cache answers xattrs from the metadata it caches
+func hideMetadata(attr *internal.ObjAttr) {
+	if len(attr.Metadata) == 0 {
+		return
+	}
+
+	visible := make(map[string]string, len(attr.Metadata))
+	for k, v := range attr.Metadata {
+		if !isEncryptionMetadataKey(strings.ToLower(k)) {
+			visible[k] = v
+		}
+	}
+	attr.Metadata = visible
+}
+
+// plainList : Fix up sizes of the listed files, fetching the metadata of the ones the listing did not bring it for
+func (e *Encryption) plainList(ctx context.Context, attrs []*internal.ObjAttr) {
+	for _, attr := range attrs {
+		if !attr.IsDir() && !attr.IsMetadataRetrieved() {
+			full, err := e.NextComponent().GetAttr(internal.GetAttrOptions{Name: attr.Path, RetrieveMetadata: true, Ctx: ctx})
+			if err != nil {
+				log.Warn("Encryption::plainList : Failed to get metadata of %s [%s]", attr.Path, err.Error())
+				continue
+			}
+			attr.Size = full.Size
+			attr.Metadata = full.Metadata
+			attr.Flags = full.Flags
+		}
+		e.plainAttr(attr)
+		hideMetadata(attr)
+	}
+}
+
+func (e *Encryption) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr, error) {
+	attr, err := e.NextComponent().GetAttr(options)
+	if err != nil {
+		return attr, err
+	}
+
+	e.plainAttr(attr)
+	hideMetadata(attr)
+	return attr, nil
+}
+
+func (e *Encryption) ReadDir(options internal.ReadDirOptions) ([]*internal.ObjAttr, error) {
+	attrs, err := e.NextComponent().ReadDir(options)
+	if err != nil {
+		return attrs, err
+	}
+
+	e.plainList(options.Ctx, attrs)
+	return attrs, nil
+}
+
+func (e *Encryption) StreamDir(options internal.StreamDirOptions) ([]*internal.ObjAttr, string, error) {
+	attrs, token, err := e.NextComponent().StreamDir(options)
+	if err != nil {
+		return attrs, token, err
+	}
+
+	e.plainList(options.Ctx, attrs)
+	return attrs, token, nil
+}
+
+// fileKey : Data key of the blob, nil for a blob which is not encrypted.
+// Blobs holding plain text data are refused unless allowed by config, empty blobs are just created files.
+func (e *Encryption) fileKey(attr *internal.ObjAttr) (*fileKey, error) {
+	if !isEncrypted(attr) {
+		if attr.Size > 0 && !attr.IsSymlink() && !e.allowUnencrypted {
+			log.Err("Encryption::fileKey : %s is not encrypted", attr.Path)
+			return nil, syscall.EACCES
+		}
+		return nil, nil
+	}
+
+	key, err := e.key.fileKey(attr)
+	if err != nil {
+		log.Err("Encryption::fileKey : Failed to get data key of %s [%s]", attr.Path, err.Error())
+		return nil, syscall.EIO
+	}
+	return key, nil
+}
+
+// ------------------------- Reads -------------------------------------------
+
+func (e *Encryption) OpenFile(options internal.OpenFileOptions) (*handlemap.Handle, error) {
+	log.Trace("Encryption::OpenFile : %s", options.Name)
+
+	handle, err := e.NextComponent().OpenFile(options)
+	if err != nil {
+		return handle, err
+	}
+
+	attr, err := e.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	var key *fileKey
+	if err == nil {
+		key, err = e.fileKey(attr)
+	}
+	if err == nil && key != nil {
+		var size int64
+		size, err = plainSize(attr.Size, key.chunkSize)
+		if err == nil {
+			lower := handlemap.NewHandle(options.Name)
+			lower.Size = attr.Size
+			handle.Size = size
+			handle.SetValue(handleKey, &openFile{key: key, lower: lower})
+		}
+	}
+
+	if err != nil {
+		log.Err("Encryption::OpenFile : Failed to open %s [%s]", options.Name, err.Error())
+		_ = e.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle, Ctx: options.Ctx})
+		return nil, err
+	}
+	return handle, nil
+}
+
+func (e *Encryption) CloseFile(options internal.CloseFileOptions) error {
+	options.Handle.RemoveValue(handleKey)
+	return e.NextComponent().CloseFile(options)
+}
+
+// encryptedHandle : State of the handle if it is of an encrypted file
+func encryptedHandle(handle *handlemap.Handle) *openFile {
+	value, found := handle.GetValue(handleKey)
+	if !found {
+		return nil
+	}
+	return value.(*openFile)
+}
+
+// readPlain : Fill data with the plain text at offset, reading only the chunks covering the range.
+// Range shall lie within the plain text of the file.
+func (e *Encryption) readPlain(ctx context.Context, key *fileKey, lower *handlemap.Handle, offset int64, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	blobSize := atomic.LoadInt64(&lower.Size)
+	stored := key.chunkSize + chunkOverhead
+	lastChunk := (blobSize - 1) / stored
+	first := offset / key.chunkSize
+	last := (offset + int64(len(data)) - 1) / key.chunkSize
+
+	start := first * stored
+	end := (last + 1) * stored
+	if end > blobSize {
+		end = blobSize
+	}
+
+	raw := make([]byte, end-start)
+	_, err := e.NextComponent().ReadInBuffer(internal.ReadInBufferOptions{Handle: lower, Offset: start, Data: raw, Ctx: ctx})
+	if err != nil {
+		return err
+	}
+
+	plain := make([]byte, 0, key.chunkSize)
+	for index := first; index <= last; index++ {
+		chunkStart := (index - first) * stored
+		chunkEnd := chunkStart + stored
+		if chunkEnd > int64(len(raw)) {
+			chunkEnd = int64(len(raw))
+		}
+
+		plain, err = key.openChunk(plain[:0], raw[chunkStart:chunkEnd], index, index == lastChunk)
+		if err != nil {
+			log.Err("Encryption::readPlain : Chunk %d of %s failed authentication", index, lower.Path)
+			return syscall.EIO
+		}
+
+		// Copy the part of the chunk which overlaps the requested range
+		plainStart := index * key.chunkSize
+		from := int64(0)
+		if offset > plainStart {
+			from = offset - plainStart
+		}
+		if from > int64(len(plain)) {
+			return syscall.EIO
+		}
+		copy(data[plainStart+from-offset:], plain[from:])
+	}
+
+	return nil
+}
+
+func (e *Encryption) ReadInBuffer(options internal.ReadInBufferOptions) (int, error) {
+	of := encryptedHandle(options.Handle)
+	if of == nil {
+		return e.NextComponent().ReadInBuffer(options)
+	}
+
+	size := atomic.LoadInt64(&options.Handle.Size)
+	if options.Offset > size {
+		return 0, syscall.ERANGE
+	}
+
+	length := int64(len(options.Data))
+	if options.Offset+length > size {
+		length = size - options.Offset
+	}
+
+	err := e.readPlain(options.Ctx, of.key, of.lower, options.Offset, options.Data[:length])
+	if err != nil {
+		log.Err("Encryption::ReadInBuffer : Failed to read %s [%s]", options.Handle.Path, err.Error())
+		return 0, err
+	}
+	return int(length), nil
+}
+
+func (e *Encryption) ReadFile(options internal.ReadFileOptions) ([]byte, error) {
+	of := encryptedHandle(options.Handle)
+	if of == nil {
+		return e.NextComponent().ReadFile(options)
+	}
+
+	data := make([]byte, atomic.LoadInt64(&options.Handle.Size))
+	err := e.readPlain(options.Ctx, of.key, of.lower, 0, data)
+	if err != nil {
+		log.Err("Encryption::ReadFile : Failed to read %s [%s]", options.Handle.Path, err.Error())
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetFileBlockOffsets : Blocks of an encrypted blob hold cipher text, so layers above are told to treat it as a single blob
+// and read it by plain text offsets
+func (e *Encryption) GetFileBlockOffsets(options internal.GetFileBlockOffsetsOptions) (*common.BlockOffsetList, error) {
+	attr, err := e.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncrypted(attr) {
+		return e.NextComponent().GetFileBlockOffsets(options)
+	}
+
+	offsets := &common.BlockOffsetList{}
+	offsets.Flags.Set(common.SmallFile)
+	return offsets, nil
+}
+
+// CopyToFile : Download and decrypt the range of the file, plain text is written from the start of the local file
+func (e *Encryption) CopyToFile(options internal.CopyToFileOptions) error {
+	log.Trace("Encryption::CopyToFile : Read file %s", options.Name)
+
+	attr, err := e.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return err
+	}
+
+	key, err := e.fileKey(attr)
+	if err != nil {
+		return err
+	} else if key == nil {
+		return e.NextComponent().CopyToFile(options)
+	}
+
+	return e.download(options.Ctx, attr, key, options.Offset, options.Count, options.File)
+}
+
+func (e *Encryption) download(ctx context.Context, attr *internal.ObjAttr, key *fileKey, offset int64, count int64, f *os.File) error {
+	size, err := plainSize(attr.Size, key.chunkSize)
+	if err != nil {
+		log.Err("Encryption::download : Can not tell size of %s [%s]", attr.Path, err.Error())
+		return syscall.EIO
+	}
+
+	if offset > size {
+		offset = size
+	}
+	if count == 0 || offset+count > size {
+		count = size - offset
+	}
+
+	err = f.Truncate(count)
+	if err != nil {
+		log.Err("Encryption::download : Failed to truncate local file for %s [%s]", attr.Path, err.Error())
+		return err
+	}
+
+	lower := handlemap.NewHandle(attr.Path)
+	lower.Size = attr.Size
+
+	batch := (readBatchSize / key.chunkSize) * key.chunkSize
+	if batch == 0 {
+		batch = key.chunkSize
+	}
+
+	buf := make([]byte, batch)
+	for done := int64(0); done < count; {
+		length := count - done
+		if length > batch {
+			length = batch
+		}
+
+		err = e.readPlain(ctx, key, lower, offset+done, buf[:length])
+		if err != nil {
+			log.Err("Encryption::download : Failed to read %s [%s]", attr.Path, err.Error())
+			return err
+		}
+
+		_, err = f.WriteAt(buf[:length], done)
+		if err != nil {
+			log.Err("Encryption::download : Failed to write local file for %s [%s]", attr.Path, err.Error())
+			return err
+		}
+		done += length
+	}
+
+	return nil
+}
+
+// ------------------------- Writes -------------------------------------------
+
+// CopyFromFile : Encrypt the whole local file with a fresh data key and upload it along with the wrapped key
+func (e *Encryption) CopyFromFile(options internal.CopyFromFileOptions) error {
+	log.Trace("Encryption::CopyFromFile : Upload file %s", options.Name)
+	src, size, err := options.UploadSource()
+	if err != nil {
+		log.Err("Encryption::CopyFromFile : Failed to get size of local file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+	return e.upload(options.Ctx, options.Name, src, size, options.Metadata, options.ETag, options.Handle)
+}
+
+func (e *Encryption) upload(ctx context.Context, name string, src io.ReaderAt, size int64, metadata map[string]string, etag string, handle *handlemap.Handle) error {
+
+	key, encMetadata, err := e.key.newFileKey(e.chunkSize)
+	if err != nil {
+		log.Err("Encryption::upload : Failed to generate data key for %s [%s]", name, err.Error())
+		return err
+	}
+
+	// Only cipher text is ever written to the temporary file
+	tmp, err := ioutil.TempFile(e.tmpPath, "blobfuse2-encryption-")
+	if err != nil {
+		log.Err("Encryption::upload : Failed to create temporary file for %s [%s]", name, err.Error())
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	err = encryptFile(key, io.NewSectionReader(src, 0, size), size, tmp)
+	if err != nil {
+		log.Err("Encryption::upload : Failed to encrypt %s [%s]", name, err.Error())
+		return err
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range metadata {
+		if !isEncryptionMetadataKey(strings.ToLower(k)) {
+			encMetadata[k] = v
+		}
+	}
+
+	return e.NextComponent().CopyFromFile(internal.CopyFromFileOptions{
+		Name:     name,
+		File:     tmp,
+		Metadata: encMetadata,
+		ETag:     etag,
+		Handle:   handle,
+		Ctx:      ctx,
+	})
+}
+
+// encryptFile : Write size bytes of plain text from src to dst as a sequence of encrypted chunks
+func encryptFile(key *fileKey, src io.Reader, size int64, dst io.Writer) error {
+	w := bufio.NewWriterSize(dst, int(key.chunkSize+chunkOverhead))
+	plain := make([]byte, key.chunkSize)
+	sealed := make([]byte, 0, key.chunkSize+chunkOverhead)
+
+	for index, done := int64(0), int64(0); done < size; index++ {
+		length := size - done
+		if length > key.chunkSize {
+			length = key.chunkSize
+		}
+
+		_, err := io.ReadFull(src, plain[:length])
+		if err != nil {
+			return err
+		}
+		done += length
+
+		sealed, err = key.sealChunk(sealed[:0], plain[:length], index, done == size)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(sealed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// TruncateFile : Re-encrypt the file at its new size, chunks are chained to the end of the file so it can not be cut in place
+func (e *Encryption) TruncateFile(options internal.TruncateFileOptions) error {
+	log.Trace("Encryption::TruncateFile : %s to %d bytes", options.Name, options.Size)
+
+	attr, err := e.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, RetrieveMetadata: true, Ctx: options.Ctx})
+	if err != nil {
+		return err
+	}
+
+	key, err := e.fileKey(attr)
+	if err != nil {
+		return err
+	} else if key == nil && attr.Size > 0 {
+		// Plain text blob which config allows to keep as is
+		return e.NextComponent().TruncateFile(options)
+	}
+
+	tmp, err := ioutil.TempFile(e.tmpPath, "blobfuse2-encryption-")
+	if err != nil {
+		log.Err("Encryption::TruncateFile : Failed to create temporary file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	// Temporary file holds plain text here, it lives only till the upload is done
+	if key != nil && options.Size > 0 {
+		err = e.download(options.Ctx, attr, key, 0, options.Size, tmp)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tmp.Truncate(options.Size)
+	if err != nil {
+		log.Err("Encryption::TruncateFile : Failed to truncate local file for %s [%s]", options.Name, err.Error())
+		return err
+	}
+
+	return e.upload(options.Ctx, options.Name, tmp, options.Size, attr.Metadata, attr.ETag, nil)
+}
+
+// WriteFile : Writes at an offset would put plain text blocks in the blob, data has to be uploaded through CopyFromFile
+func (e *Encryption) WriteFile(options internal.WriteFileOptions) (int, error) {
+	log.Err("Encryption::WriteFile : Partial write of %s is not supported, use file_cache to write encrypted files", options.Handle.Path)
+	return 0, syscall.ENOTSUP
+}
+
+// FlushFile : Blocks cached by the layers above hold plain text and are never committed to storage
+func (e *Encryption) FlushFile(options internal.FlushFileOptions) error {
+	if options.Handle.CacheObj != nil && options.Handle.CacheObj.BlockOffsetList != nil {
+		for _, block := range options.Handle.CacheObj.BlockList {
+			if block.Dirty() {
+				log.Err("Encryption::FlushFile : Partial write of %s is not supported, use file_cache to write encrypted files", options.Handle.Path)
+				return syscall.ENOTSUP
+			}
+		}
+	}
+	return e.NextComponent().FlushFile(options)
+}
+
+// CopyFileRange : Copies on the service would mix sizes of blob and data, let them go through the regular data path
+func (e *Encryption) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	return 0, syscall.ENOTSUP
+}
+
+// ------------------------- Extended attributes -------------------------------------------
+
+// isEncryptionXattr : Attribute maps to the metadata holding the wrapped key of the file
+func isEncryptionXattr(name string) bool {
+	return strings.HasPrefix(name, internal.XattrUserPrefix) &&
+		isEncryptionMetadataKey(strings.ToLower(strings.TrimPrefix(name, internal.XattrUserPrefix)))
+}
+
+func (e *Encryption) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	if isEncryptionXattr(options.Attr) {
+		return nil, syscall.ENODATA
+	}
+	return e.NextComponent().GetXattr(options)
+}
+
+func (e *Encryption) ListXattr(options internal.ListXattrOptions) ([]string, error) {
+	names, err := e.NextComponent().ListXattr(options)
+	if err != nil {
+		return names, err
+	}
+
+	visible := names[:0]
+	for _, name := range names {
+		if !isEncryptionXattr(name) {
+			visible = append(visible, name)
+		}
+	}
+	return visible, nil
+}
+
+func (e *Encryption) SetXattr(options internal.SetXattrOptions) error {
+	if isEncryptionXattr(options.Attr) {
+		return syscall.EPERM
+	}
+	return e.NextComponent().SetXattr(options)
+}
+
+func (e *Encryption) RemoveXattr(options internal.RemoveXattrOptions) error {
+	if isEncryptionXattr(options.Attr) {
+		return syscall.EPERM
+	}
+	return e.NextComponent().RemoveXattr(options)
+}
+
+// ------------------------- Factory -------------------------------------------
+
+// Pipeline will call this method to create your object, initialize your variables here
+// << DO NOT DELETE ANY AUTO GENERATED CODE HERE >>
+func NewEncryptionComponent() internal.Component {
+	comp := &Encryption{}
+	comp.SetName(compName)
+	return comp
+}
+
+// On init register this component to pipeline and supply your constructor
+func init() {
+	internal.AddComponent(compName, NewEncryptionComponent)
+
+	keyFile := config.AddStringFlag("encryption-key-file", "", "File holding the master key for client side encryption.")
+	config.BindPFlag(compName+".key-file", keyFile)
+}
@@ -0,0 +1,498 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/config"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/component/azstorage"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type encryptionTestSuite struct {
+	suite.Suite
+	assert     *assert.Assertions
+	encryption *Encryption
+	storage    internal.Component
+	tmpPath    string
+	keyFile    string
+}
+
+func getRandomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func newTestEncryption(next internal.Component, configuration string) (*Encryption, error) {
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader(configuration))
+	e := NewEncryptionComponent()
+	e.SetNextComponent(next)
+	err := e.Configure(true)
+	return e.(*Encryption), err
+}
+
+func (suite *encryptionTestSuite) SetupTest() {
+	err := log.SetDefaultLogger("silent", common.LogConfig{})
+	if err != nil {
+		panic("Unable to set silent logger as default.")
+	}
+	suite.assert = assert.New(suite.T())
+
+	suite.tmpPath, err = ioutil.TempDir("", "encryption_test")
+	suite.assert.Nil(err)
+
+	suite.keyFile = filepath.Join(suite.tmpPath, "master.key")
+	key := base64.StdEncoding.EncodeToString(getRandomData(keySize))
+	suite.assert.Nil(ioutil.WriteFile(suite.keyFile, []byte(key+"\n"), 0600))
+
+	suite.storage = azstorage.NewazstorageComponent()
+	config.ResetConfig()
+	_ = config.ReadConfigFromReader(strings.NewReader("azstorage:\n  type: memory\n"))
+	suite.assert.Nil(suite.storage.Configure(true))
+	suite.assert.Nil(suite.storage.Start(context.Background()))
+
+	suite.setupTestHelper("encryption:\n  key-file: " + suite.keyFile + "\n  chunk-size-kb: 1\n")
+}
+
+func (suite *encryptionTestSuite) setupTestHelper(configuration string) {
+	var err error
+	suite.encryption, err = newTestEncryption(suite.storage, configuration)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.encryption.Start(context.Background()))
+}
+
+func (suite *encryptionTestSuite) TearDownTest() {
+	_ = suite.encryption.Stop()
+	_ = suite.storage.Stop()
+	_ = os.RemoveAll(suite.tmpPath)
+}
+
+// upload : write data to a local file and upload it through the component under test
+func (suite *encryptionTestSuite) upload(name string, data []byte) {
+	f, err := ioutil.TempFile(suite.tmpPath, "upload")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.encryption.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f}))
+}
+
+// readBlob : raw content and attributes of the blob as held by storage
+func (suite *encryptionTestSuite) readBlob(name string) ([]byte, *internal.ObjAttr) {
+	attr, err := suite.storage.GetAttr(internal.GetAttrOptions{Name: name})
+	suite.assert.Nil(err)
+
+	handle, err := suite.storage.OpenFile(internal.OpenFileOptions{Name: name, Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	defer func() { _ = suite.storage.CloseFile(internal.CloseFileOptions{Handle: handle}) }()
+
+	data, err := suite.storage.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	return data, attr
+}
+
+// writeBlob : replace the blob in storage, bypassing encryption
+func (suite *encryptionTestSuite) writeBlob(name string, data []byte, metadata map[string]string) {
+	f, err := ioutil.TempFile(suite.tmpPath, "blob")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	_, err = f.Write(data)
+	suite.assert.Nil(err)
+	_, err = f.Seek(0, 0)
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.storage.CopyFromFile(internal.CopyFromFileOptions{Name: name, File: f, Metadata: metadata}))
+}
+
+// download : read the whole file through the component under test
+func (suite *encryptionTestSuite) download(name string) ([]byte, error) {
+	f, err := ioutil.TempFile(suite.tmpPath, "download")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	err = suite.encryption.CopyToFile(internal.CopyToFileOptions{Name: name, File: f})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+func (suite *encryptionTestSuite) TestDefaultConfig() {
+	suite.setupTestHelper("encryption:\n  key-file: " + suite.keyFile + "\n")
+	suite.assert.Equal(compName, suite.encryption.Name())
+	suite.assert.EqualValues(defaultChunkSizeKB*1024, suite.encryption.chunkSize)
+	suite.assert.False(suite.encryption.allowUnencrypted)
+	suite.assert.Equal(internal.EComponentPriority.LevelFour(), suite.encryption.Priority())
+}
+
+func (suite *encryptionTestSuite) TestConfigureKey() {
+	os.Unsetenv(EncryptionKeyEnv)
+	_, err := newTestEncryption(suite.storage, "encryption:\n  chunk-size-kb: 1\n")
+	suite.assert.NotNil(err)
+
+	// raw key from the environment
+	raw := []byte("0123456789abcdef0123456789abcdef")
+	os.Setenv(EncryptionKeyEnv, string(raw))
+	defer os.Unsetenv(EncryptionKeyEnv)
+	e, err := newTestEncryption(suite.storage, "encryption:\n  chunk-size-kb: 1\n")
+	suite.assert.Nil(err)
+	expected, _ := newMasterKey(raw)
+	suite.assert.Equal(expected.id, e.key.id)
+
+	// key of the wrong size
+	suite.assert.Nil(ioutil.WriteFile(suite.keyFile, []byte(base64.StdEncoding.EncodeToString(getRandomData(16))), 0600))
+	_, err = newTestEncryption(suite.storage, "encryption:\n  key-file: "+suite.keyFile+"\n")
+	suite.assert.NotNil(err)
+
+	_, err = newTestEncryption(suite.storage, "encryption:\n  key-file: "+filepath.Join(suite.tmpPath, "missing")+"\n")
+	suite.assert.NotNil(err)
+}
+
+func (suite *encryptionTestSuite) TestConfigureChunkSize() {
+	_, err := newTestEncryption(suite.storage, "encryption:\n  key-file: "+suite.keyFile+"\n  chunk-size-kb: 0\n")
+	suite.assert.NotNil(err)
+
+	_, err = newTestEncryption(suite.storage, "encryption:\n  key-file: "+suite.keyFile+"\n  chunk-size-kb: 32768\n")
+	suite.assert.NotNil(err)
+}
+
+func (suite *encryptionTestSuite) TestSizes() {
+	chunkSize := int64(1024)
+	for _, size := range []int64{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 10 * chunkSize, 10*chunkSize + 7} {
+		plain, err := plainSize(cipherSize(size, chunkSize), chunkSize)
+		suite.assert.Nil(err)
+		suite.assert.Equal(size, plain)
+	}
+
+	// a chunk can not be shorter than its nonce and tag
+	_, err := plainSize(chunkSize+chunkOverhead+chunkOverhead, chunkSize)
+	suite.assert.Equal(errCorrupt, err)
+}
+
+func (suite *encryptionTestSuite) TestUploadDownload() {
+	for _, size := range []int{0, 100, 1024, 5000} {
+		data := getRandomData(size)
+		suite.upload("file", data)
+
+		// storage holds cipher text and the wrapped key
+		blob, attr := suite.readBlob("file")
+		suite.assert.EqualValues(cipherSize(int64(size), 1024), len(blob))
+		suite.assert.True(isEncrypted(attr))
+		if size > 0 {
+			suite.assert.False(bytes.Contains(blob, data[:16]))
+		}
+
+		attr, err := suite.encryption.GetAttr(internal.GetAttrOptions{Name: "file"})
+		suite.assert.Nil(err)
+		suite.assert.EqualValues(size, attr.Size)
+
+		output, err := suite.download("file")
+		suite.assert.Nil(err)
+		suite.assert.True(bytes.Equal(data, output))
+	}
+}
+
+func (suite *encryptionTestSuite) TestFreshKeyPerUpload() {
+	data := getRandomData(2000)
+	suite.upload("file", data)
+	first, firstAttr := suite.readBlob("file")
+
+	suite.upload("file", data)
+	second, secondAttr := suite.readBlob("file")
+
+	suite.assert.False(bytes.Equal(first, second))
+	suite.assert.NotEqual(firstAttr.Metadata[metaKey], secondAttr.Metadata[metaKey])
+}
+
+func (suite *encryptionTestSuite) TestUploadKeepsMetadata() {
+	f, err := ioutil.TempFile(suite.tmpPath, "upload")
+	suite.assert.Nil(err)
+	defer f.Close()
+
+	metadata := map[string]string{"owner": "me", metaKeyID: "forged"}
+	err = suite.encryption.CopyFromFile(internal.CopyFromFileOptions{Name: "file", File: f, Metadata: metadata})
+	suite.assert.Nil(err)
+
+	_, attr := suite.readBlob("file")
+	owner, _ := attr.GetMetadata("owner")
+	suite.assert.Equal("me", owner)
+	id, _ := attr.GetMetadata(metaKeyID)
+	suite.assert.Equal(suite.encryption.key.id, id)
+}
+
+func (suite *encryptionTestSuite) TestRangeRead() {
+	data := getRandomData(10*1024 + 300)
+	suite.upload("file", data)
+
+	handle, err := suite.encryption.OpenFile(internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), handle.Size)
+
+	ranges := []struct {
+		offset int64
+		length int
+	}{
+		{0, 10}, {1000, 100}, {1020, 10}, {2048, 1024}, {500, 5000}, {10 * 1024, 300}, {10*1024 + 250, 100},
+	}
+	for _, r := range ranges {
+		output := make([]byte, r.length)
+		n, err := suite.encryption.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: r.offset, Data: output})
+		suite.assert.Nil(err)
+
+		expected := data[r.offset:]
+		if len(expected) > r.length {
+			expected = expected[:r.length]
+		}
+		suite.assert.Equal(len(expected), n)
+		suite.assert.True(bytes.Equal(expected, output[:n]))
+	}
+
+	n, err := suite.encryption.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: int64(len(data)), Data: make([]byte, 10)})
+	suite.assert.Nil(err)
+	suite.assert.Equal(0, n)
+
+	output, err := suite.encryption.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+
+	offsets, err := suite.encryption.GetFileBlockOffsets(internal.GetFileBlockOffsetsOptions{Name: "file"})
+	suite.assert.Nil(err)
+	suite.assert.True(offsets.SmallFile())
+
+	suite.assert.Nil(suite.encryption.CloseFile(internal.CloseFileOptions{Handle: handle}))
+}
+
+func (suite *encryptionTestSuite) TestTamperedChunk() {
+	data := getRandomData(3000)
+	suite.upload("file", data)
+
+	blob, attr := suite.readBlob("file")
+	blob[1500] ^= 0x1
+	suite.writeBlob("file", blob, attr.Metadata)
+
+	_, err := suite.download("file")
+	suite.assert.Equal(syscall.EIO, err)
+
+	// chunks not covering the modified byte can still be read
+	handle, err := suite.encryption.OpenFile(internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY})
+	suite.assert.Nil(err)
+	output := make([]byte, 100)
+	_, err = suite.encryption.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data[:100], output))
+}
+
+func (suite *encryptionTestSuite) TestTruncatedBlob() {
+	data := getRandomData(3000)
+	suite.upload("file", data)
+
+	// dropping whole chunks from the end leaves a valid size, the new last chunk is not marked as last though
+	blob, attr := suite.readBlob("file")
+	suite.writeBlob("file", blob[:2*(1024+chunkOverhead)], attr.Metadata)
+
+	attr, err := suite.encryption.GetAttr(internal.GetAttrOptions{Name: "file"})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(2048, attr.Size)
+
+	_, err = suite.download("file")
+	suite.assert.Equal(syscall.EIO, err)
+}
+
+func (suite *encryptionTestSuite) TestWrongMasterKey() {
+	suite.upload("file", getRandomData(100))
+
+	suite.assert.Nil(ioutil.WriteFile(suite.keyFile, getRandomData(keySize), 0600))
+	suite.setupTestHelper("encryption:\n  key-file: " + suite.keyFile + "\n")
+
+	_, err := suite.download("file")
+	suite.assert.Equal(syscall.EIO, err)
+
+	_, err = suite.encryption.OpenFile(internal.OpenFileOptions{Name: "file", Flags: os.O_RDONLY})
+	suite.assert.Equal(syscall.EIO, err)
+}
+
+func (suite *encryptionTestSuite) TestUnencryptedBlob() {
+	data := getRandomData(100)
+	suite.writeBlob("plain", data, nil)
+
+	_, err := suite.download("plain")
+	suite.assert.Equal(syscall.EACCES, err)
+	_, err = suite.encryption.OpenFile(internal.OpenFileOptions{Name: "plain", Flags: os.O_RDONLY})
+	suite.assert.Equal(syscall.EACCES, err)
+
+	// empty blobs are files created but not written yet
+	suite.writeBlob("empty", []byte{}, nil)
+	output, err := suite.download("empty")
+	suite.assert.Nil(err)
+	suite.assert.Empty(output)
+
+	suite.setupTestHelper("encryption:\n  key-file: " + suite.keyFile + "\n  allow-unencrypted: true\n")
+	output, err = suite.download("plain")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data, output))
+
+	attr, err := suite.encryption.GetAttr(internal.GetAttrOptions{Name: "plain"})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), attr.Size)
+}
+
+func (suite *encryptionTestSuite) TestTruncateFile() {
+	data := getRandomData(3000)
+	suite.upload("file", data)
+
+	suite.assert.Nil(suite.encryption.TruncateFile(internal.TruncateFileOptions{Name: "file", Size: 1500}))
+	output, err := suite.download("file")
+	suite.assert.Nil(err)
+	suite.assert.True(bytes.Equal(data[:1500], output))
+
+	suite.assert.Nil(suite.encryption.TruncateFile(internal.TruncateFileOptions{Name: "file", Size: 2500}))
+	output, err = suite.download("file")
+	suite.assert.Nil(err)
+	suite.assert.Len(output, 2500)
+	suite.assert.True(bytes.Equal(data[:1500], output[:1500]))
+	suite.assert.True(bytes.Equal(make([]byte, 1000), output[1500:]))
+
+	suite.assert.Nil(suite.encryption.TruncateFile(internal.TruncateFileOptions{Name: "file", Size: 0}))
+	blob, attr := suite.readBlob("file")
+	suite.assert.Empty(blob)
+	suite.assert.True(isEncrypted(attr))
+
+	// file created empty gets encrypted once it has data
+	_, err = suite.storage.CreateFile(internal.CreateFileOptions{Name: "new", Mode: 0644})
+	suite.assert.Nil(err)
+	suite.assert.Nil(suite.encryption.TruncateFile(internal.TruncateFileOptions{Name: "new", Size: 10}))
+	_, attr = suite.readBlob("new")
+	suite.assert.True(isEncrypted(attr))
+}
+
+func (suite *encryptionTestSuite) TestListSizes() {
+	suite.upload("dir/a", getRandomData(100))
+	suite.upload("dir/b", getRandomData(5000))
+
+	entries, err := suite.encryption.ReadDir(internal.ReadDirOptions{Name: "dir"})
+	suite.assert.Nil(err)
+	suite.assert.Len(entries, 2)
+	suite.assert.EqualValues(100, entries[0].Size)
+	suite.assert.EqualValues(5000, entries[1].Size)
+
+	entries, _, err = suite.encryption.StreamDir(internal.StreamDirOptions{Name: "dir"})
+	suite.assert.Nil(err)
+	suite.assert.Len(entries, 2)
+	suite.assert.EqualValues(100, entries[0].Size)
+	suite.assert.EqualValues(5000, entries[1].Size)
+	for _, entry := range entries {
+		_, found := entry.GetMetadata(metaKey)
+		suite.assert.False(found)
+	}
+}
+
+func (suite *encryptionTestSuite) TestPartialWriteRefused() {
+	handle, err := suite.storage.CreateFile(internal.CreateFileOptions{Name: "file", Mode: 0644})
+	suite.assert.Nil(err)
+
+	_, err = suite.encryption.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: []byte("plain")})
+	suite.assert.Equal(syscall.ENOTSUP, err)
+
+	_, err = suite.encryption.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: handle, DstHandle: handle, Size: 10})
+	suite.assert.Equal(syscall.ENOTSUP, err)
+
+	handle.CacheObj = &handlemap.Cache{BlockOffsetList: &common.BlockOffsetList{}}
+	block := &common.Block{StartIndex: 0, EndIndex: 5, Data: []byte("plain")}
+	block.Flags.Set(common.DirtyBlock)
+	handle.CacheObj.BlockList = append(handle.CacheObj.BlockList, block)
+	suite.assert.Equal(syscall.ENOTSUP, suite.encryption.FlushFile(internal.FlushFileOptions{Handle: handle}))
+}
+
+func (suite *encryptionTestSuite) TestEncryptionXattrHidden() {
+	suite.upload("file", getRandomData(100))
+
+	names, err := suite.encryption.ListXattr(internal.ListXattrOptions{Name: "file"})
+	suite.assert.Nil(err)
+	for _, name := range names {
+		suite.assert.False(strings.HasPrefix(name, internal.XattrUserPrefix+metaVersion))
+	}
+
+	_, err = suite.encryption.GetXattr(internal.GetXattrOptions{Name: "file", Attr: internal.XattrUserPrefix + metaKey})
+	suite.assert.Equal(syscall.ENODATA, err)
+
+	err = suite.encryption.SetXattr(internal.SetXattrOptions{Name: "file", Attr: internal.XattrUserPrefix + metaKey, Value: []byte("x")})
+	suite.assert.Equal(syscall.EPERM, err)
+
+	err = suite.encryption.RemoveXattr(internal.RemoveXattrOptions{Name: "file", Attr: internal.XattrUserPrefix + metaIV})
+	suite.assert.Equal(syscall.EPERM, err)
+
+	// attr_cache serves xattrs from the metadata of cached attributes, so it must not carry the wrapped key either
+	attr, err := suite.encryption.GetAttr(internal.GetAttrOptions{Name: "file", RetrieveMetadata: true})
+	suite.assert.Nil(err)
+	for _, key := range []string{metaVersion, metaKey, metaIV, metaChunkSize, metaKeyID} {
+		_, found := attr.GetMetadata(key)
+		suite.assert.False(found, key)
+	}
+	_, blobAttr := suite.readBlob("file")
+	suite.assert.True(isEncrypted(blobAttr))
+
+	// other attributes still reach storage
+	err = suite.encryption.SetXattr(internal.SetXattrOptions{Name: "file", Attr: "user.owner", Value: []byte("me")})
+	suite.assert.Nil(err)
+	value, err := suite.encryption.GetXattr(internal.GetXattrOptions{Name: "file", Attr: "user.owner"})
+	suite.assert.Nil(err)
+	suite.assert.Equal("me", string(value))
+
+	output, err := suite.download("file")
+	suite.assert.Nil(err)
+	suite.assert.Len(output, 100)
+}
+
+func TestEncryptionTestSuite(t *testing.T) {
+	suite.Run(t, new(encryptionTestSuite))
+}
@@ -0,0 +1,266 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+)
+
+/* Layout of an encrypted blob
+   - Data is split in chunks of a fixed plain text size, only the last chunk may be shorter
+   - Each chunk is stored as : nonce (12 bytes) | AES-256-GCM cipher text | tag (16 bytes)
+   - Chunk index and whether it is the last chunk are authenticated with each chunk, so chunks can not be
+     reordered or dropped from the end without the read failing
+   - Every chunk gets a fresh random nonce and every upload of a file a fresh data key
+   - Data key is random per file, wrapped with the master key and stored in the blob metadata along with the
+     nonce used to wrap it, the chunk size and the id of the master key
+*/
+
+// Metadata keys describing the encryption of a blob
+const (
+	metaVersion   = "blobfuse2_encryption"
+	metaKey       = "blobfuse2_encryption_key"
+	metaIV        = "blobfuse2_encryption_iv"
+	metaChunkSize = "blobfuse2_encryption_chunk"
+	metaKeyID     = "blobfuse2_encryption_kid"
+)
+
+const (
+	formatVersion = "1"
+	keySize       = 32
+	nonceSize     = 12
+	tagSize       = 16
+	chunkOverhead = nonceSize + tagSize
+)
+
+var errCorrupt = errors.New("encrypted data is corrupt")
+
+// isEncryptionMetadataKey : Key is one of the metadata keys owned by this component
+func isEncryptionMetadataKey(key string) bool {
+	switch key {
+	case metaVersion, metaKey, metaIV, metaChunkSize, metaKeyID:
+		return true
+	}
+	return false
+}
+
+// masterKey : key encrypting the data keys of all the files
+type masterKey struct {
+	aead cipher.AEAD
+	id   string // fingerprint of the key, tells which master key a blob was encrypted with
+}
+
+func newMasterKey(key []byte) (*masterKey, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("master key shall be %d bytes, got %d", keySize, len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &masterKey{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileKey : data key of one file along with the layout of its chunks
+type fileKey struct {
+	aead      cipher.AEAD
+	chunkSize int64
+}
+
+// wrapAAD : authenticated with the wrapped key so the chunk size can not be changed in metadata
+func wrapAAD(chunkSize int64) []byte {
+	return []byte(metaVersion + ":" + formatVersion + ":" + strconv.FormatInt(chunkSize, 10))
+}
+
+// newFileKey : generate a data key for a file and the metadata holding it wrapped by the master key
+func (mk *masterKey) newFileKey(chunkSize int64) (*fileKey, map[string]string, error) {
+	key := make([]byte, keySize)
+	iv := make([]byte, nonceSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped := mk.aead.Seal(nil, iv, key, wrapAAD(chunkSize))
+	metadata := map[string]string{
+		metaVersion:   formatVersion,
+		metaKey:       base64.StdEncoding.EncodeToString(wrapped),
+		metaIV:        base64.StdEncoding.EncodeToString(iv),
+		metaChunkSize: strconv.FormatInt(chunkSize, 10),
+		metaKeyID:     mk.id,
+	}
+
+	return &fileKey{aead: aead, chunkSize: chunkSize}, metadata, nil
+}
+
+// isEncrypted : Blob carries the metadata of an encrypted file
+func isEncrypted(attr *internal.ObjAttr) bool {
+	_, found := attr.GetMetadata(metaVersion)
+	return found
+}
+
+// chunkSizeOf : plain text size of the chunks of an encrypted blob
+func chunkSizeOf(attr *internal.ObjAttr) (int64, error) {
+	value, _ := attr.GetMetadata(metaChunkSize)
+	chunkSize, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || chunkSize <= 0 || chunkSize > maxChunkSize {
+		return 0, fmt.Errorf("invalid chunk size %s", value)
+	}
+	return chunkSize, nil
+}
+
+// fileKey : unwrap the data key of an encrypted blob
+func (mk *masterKey) fileKey(attr *internal.ObjAttr) (*fileKey, error) {
+	version, _ := attr.GetMetadata(metaVersion)
+	if version != formatVersion {
+		return nil, fmt.Errorf("unsupported encryption format version %s", version)
+	}
+
+	if id, found := attr.GetMetadata(metaKeyID); found && id != mk.id {
+		return nil, fmt.Errorf("encrypted with master key %s, configured key is %s", id, mk.id)
+	}
+
+	chunkSize, err := chunkSizeOf(attr)
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := attr.GetMetadata(metaKey)
+	wrapped, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key [%s]", err.Error())
+	}
+
+	value, _ = attr.GetMetadata(metaIV)
+	iv, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(iv) != nonceSize {
+		return nil, fmt.Errorf("invalid key iv %s", value)
+	}
+
+	key, err := mk.aead.Open(nil, iv, wrapped, wrapAAD(chunkSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key [%s]", err.Error())
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKey{aead: aead, chunkSize: chunkSize}, nil
+}
+
+// cipherSize : size of the blob holding plainSize bytes of data
+func cipherSize(plainSize int64, chunkSize int64) int64 {
+	size := (plainSize / chunkSize) * (chunkSize + chunkOverhead)
+	if rem := plainSize % chunkSize; rem > 0 {
+		size += rem + chunkOverhead
+	}
+	return size
+}
+
+// plainSize : size of the data held by a blob of cipherSize bytes
+func plainSize(cipherSize int64, chunkSize int64) (int64, error) {
+	stored := chunkSize + chunkOverhead
+	size := (cipherSize / stored) * chunkSize
+	if rem := cipherSize % stored; rem > 0 {
+		if rem <= chunkOverhead {
+			return 0, errCorrupt
+		}
+		size += rem - chunkOverhead
+	}
+	return size, nil
+}
+
+// chunkAAD : index of the chunk and whether it is the last one of the file
+func chunkAAD(index int64, last bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, uint64(index))
+	if last {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// sealChunk : encrypt one chunk of plain text, appending the stored form to dst
+func (fk *fileKey) sealChunk(dst []byte, plain []byte, index int64, last bool) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	dst = append(dst, nonce...)
+	return fk.aead.Seal(dst, nonce, plain, chunkAAD(index, last)), nil
+}
+
+// openChunk : decrypt the stored form of one chunk, appending the plain text to dst
+func (fk *fileKey) openChunk(dst []byte, stored []byte, index int64, last bool) ([]byte, error) {
+	if len(stored) <= chunkOverhead {
+		return nil, errCorrupt
+	}
+
+	plain, err := fk.aead.Open(dst, stored[:nonceSize], stored[nonceSize:], chunkAAD(index, last))
+	if err != nil {
+		return nil, errCorrupt
+	}
+	return plain, nil
+}
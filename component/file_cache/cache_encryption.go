@@ -0,0 +1,434 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package file_cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+)
+
+/* Encryption of the local cache
+   - A random AES-256 key is generated when the component is configured and is held in memory only,
+     files left in tmp-path can not be read once the process is gone
+   - Files are encrypted with AES-CTR under an IV picked every time the cached file is created or downloaded,
+     so the cached file keeps the size of the blob and any range of it can be read or written on its own
+   - Rewriting a range reuses the key stream of the file, this protects the cache at rest and not against
+     someone taking several copies of the disk while it is mounted
+   - Data moving from and to storage is encrypted or decrypted one chunk at a time, the plain text never reaches tmp-path
+     and memory use does not grow with the size of the file
+*/
+
+const cipherBufferSize = 1024 * 1024
+
+// cachedFileKey : IV of one cached file, the lock orders writes which grow the file
+type cachedFileKey struct {
+	sync.Mutex
+	iv []byte
+}
+
+// cacheCipher : encrypts the files held in tmp-path
+type cacheCipher struct {
+	block cipher.Block
+	files sync.Map // local path -> *cachedFileKey
+}
+
+func newCacheCipher() (*cacheCipher, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheCipher{block: block}, nil
+}
+
+// newFile : pick a new IV for a cached file which is created or replaced
+func (c *cacheCipher) newFile(localPath string) error {
+	iv := make([]byte, aes.BlockSize)
+	_, err := rand.Read(iv)
+	if err != nil {
+		return err
+	}
+
+	c.files.Store(localPath, &cachedFileKey{iv: iv})
+	return nil
+}
+
+func (c *cacheCipher) fileKey(localPath string) (*cachedFileKey, error) {
+	key, found := c.files.Load(localPath)
+	if !found {
+		// File was not written by this mount, its content is unknown
+		log.Err("cacheCipher::fileKey : No key for cached file %s", localPath)
+		return nil, syscall.EIO
+	}
+	return key.(*cachedFileKey), nil
+}
+
+// known : Cached file was written by this mount and can be decrypted
+func (c *cacheCipher) known(localPath string) bool {
+	_, found := c.files.Load(localPath)
+	return found
+}
+
+// rename : cached file was moved to a new path
+func (c *cacheCipher) rename(src string, dst string) {
+	if key, found := c.files.LoadAndDelete(src); found {
+		c.files.Store(dst, key)
+	} else {
+		c.files.Delete(dst)
+	}
+}
+
+// forget : cached file was removed
+func (c *cacheCipher) forget(localPath string) {
+	c.files.Delete(localPath)
+}
+
+// xorAt : apply the key stream of the file at offset to data, which encrypts as well as decrypts
+func (c *cacheCipher) xorAt(key *cachedFileKey, data []byte, offset int64) {
+	// Counter of the block holding offset is the IV plus the block number
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, key.iv)
+	carry := uint64(offset / aes.BlockSize)
+	for i := aes.BlockSize - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(c.block, counter)
+	if skip := offset % aes.BlockSize; skip > 0 {
+		pad := make([]byte, skip)
+		stream.XORKeyStream(pad, pad)
+	}
+	stream.XORKeyStream(data, data)
+}
+
+// decrypt : decrypt data read from offset of the cached file in place
+func (c *cacheCipher) decrypt(localPath string, data []byte, offset int64) error {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return err
+	}
+
+	c.xorAt(key, data, offset)
+	return nil
+}
+
+// readAt : read and decrypt a range of the cached file
+func (c *cacheCipher) readAt(localPath string, fd int, data []byte, offset int64) (int, error) {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := syscall.Pread(fd, data, offset)
+	if n > 0 {
+		c.xorAt(key, data[:n], offset)
+	}
+	return n, err
+}
+
+// writeAt : encrypt and write a range of the cached file
+func (c *cacheCipher) writeAt(localPath string, fd int, data []byte, offset int64) (int, error) {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return 0, err
+	}
+
+	key.Lock()
+	defer key.Unlock()
+
+	// A hole left by writing past the end reads back as zeros on disk, which is not what zeros encrypt to
+	err = c.fill(key, fd, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	c.xorAt(key, buf, offset)
+	return syscall.Pwrite(fd, buf, offset)
+}
+
+// fill : grow the cached file up to size with encrypted zeros, caller holds the lock of the key
+func (c *cacheCipher) fill(key *cachedFileKey, fd int, size int64) error {
+	var stat syscall.Stat_t
+	err := syscall.Fstat(fd, &stat)
+	if err != nil {
+		return err
+	}
+
+	for offset := stat.Size; offset < size; {
+		length := size - offset
+		if length > cipherBufferSize {
+			length = cipherBufferSize
+		}
+
+		buf := make([]byte, length)
+		c.xorAt(key, buf, offset)
+		n, err := syscall.Pwrite(fd, buf, offset)
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+
+	return nil
+}
+
+// truncate : change the size of the cached file, growing it with encrypted zeros
+func (c *cacheCipher) truncate(localPath string, size int64) error {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(localPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	key.Lock()
+	defer key.Unlock()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if size < info.Size() {
+		return f.Truncate(size)
+	}
+	return c.fill(key, int(f.Fd()), size)
+}
+
+// encryptFrom : write the encrypted content of src to the cached file
+func (c *cacheCipher) encryptFrom(localPath string, dst *os.File, src io.Reader) error {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, cipherBufferSize)
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			c.xorAt(key, buf[:n], offset)
+			_, werr := dst.WriteAt(buf[:n], offset)
+			if werr != nil {
+				return werr
+			}
+			offset += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return dst.Truncate(offset)
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// decryptTo : write the decrypted content of the cached file to dst
+func (c *cacheCipher) decryptTo(localPath string, dst io.Writer, src *os.File) error {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, cipherBufferSize)
+	offset := int64(0)
+	for {
+		n, err := src.ReadAt(buf, offset)
+		if n > 0 {
+			c.xorAt(key, buf[:n], offset)
+			_, werr := dst.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+			offset += int64(n)
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// copyRange : copy count bytes of one cached file at srcOffset to another at dstOffset
+func (c *cacheCipher) copyRange(dstPath string, dst *os.File, dstOffset int64, srcPath string, src *os.File, srcOffset int64, count int64) error {
+	buf := make([]byte, cipherBufferSize)
+	for offset := int64(0); offset < count; {
+		length := count - offset
+		if length > cipherBufferSize {
+			length = cipherBufferSize
+		}
+
+		n, err := c.readAt(srcPath, int(src.Fd()), buf[:length], srcOffset+offset)
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+
+		_, err = c.writeAt(dstPath, int(dst.Fd()), buf[:n], dstOffset+offset)
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+
+	return nil
+}
+
+// plainReader : reads the cached file decrypted, used as the source of uploads
+type plainReader struct {
+	c   *cacheCipher
+	key *cachedFileKey
+	f   *os.File
+}
+
+func (r *plainReader) ReadAt(data []byte, offset int64) (int, error) {
+	n, err := r.f.ReadAt(data, offset)
+	if n > 0 {
+		r.c.xorAt(r.key, data[:n], offset)
+	}
+	return n, err
+}
+
+// reader : decrypting view of the cached file
+func (c *cacheCipher) reader(localPath string, f *os.File) (io.ReaderAt, error) {
+	key, err := c.fileKey(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return &plainReader{c: c, key: key, f: f}, nil
+}
+
+// downloadFile : Download the blob to the cached file, a chunk at a time when the cache is encrypted
+func (fc *FileCache) downloadFile(ctx context.Context, name string, size int64, f *os.File) error {
+	if fc.cipher == nil {
+		return fc.NextComponent().CopyToFile(
+			internal.CopyToFileOptions{
+				Name:   name,
+				Offset: 0,
+				Count:  size,
+				File:   f,
+				Ctx:    ctx,
+			})
+	}
+
+	key, err := fc.cipher.fileKey(filepath.Join(fc.tmpPath, name))
+	if err != nil {
+		return err
+	}
+
+	handle, err := fc.NextComponent().OpenFile(internal.OpenFileOptions{Name: name, Flags: os.O_RDONLY, Ctx: ctx})
+	if err != nil {
+		log.Err("FileCache::downloadFile : Failed to open %s in storage [%s]", name, err.Error())
+		return err
+	}
+	defer func() {
+		_ = fc.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle, Ctx: ctx})
+	}()
+
+	buf := make([]byte, cipherBufferSize)
+	for offset := int64(0); offset < size; {
+		length := size - offset
+		if length > cipherBufferSize {
+			length = cipherBufferSize
+		}
+
+		n, err := fc.NextComponent().ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: buf[:length], Ctx: ctx})
+		if err != nil {
+			log.Err("FileCache::downloadFile : Failed to read %s at %d [%s]", name, offset, err.Error())
+			return err
+		} else if n == 0 {
+			log.Err("FileCache::downloadFile : %s ended at %d while %d bytes were expected", name, offset, size)
+			return io.ErrUnexpectedEOF
+		}
+
+		fc.cipher.xorAt(key, buf[:n], offset)
+		_, err = f.WriteAt(buf[:n], offset)
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+
+	return nil
+}
+
+// uploadOptions : Options to upload the cached file, decrypted as it is read when the cache is encrypted
+func (fc *FileCache) uploadOptions(name string, f *os.File) (internal.CopyFromFileOptions, error) {
+	options := internal.CopyFromFileOptions{Name: name, File: f}
+	if fc.cipher == nil {
+		return options, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return options, err
+	}
+
+	reader, err := fc.cipher.reader(filepath.Join(fc.tmpPath, name), f)
+	if err != nil {
+		return options, err
+	}
+
+	options.File = nil
+	options.Reader = reader
+	options.Size = info.Size()
+	return options, nil
+}
@@ -0,0 +1,190 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package file_cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/internal"
+	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
+)
+
+// Policies applied when an upload finds that the blob was changed by another writer after it was downloaded
+const (
+	conflictPolicyFail           = "fail"             // Fail the flush with ESTALE, local changes stay in the cache
+	conflictPolicyKeepCopy       = "keep-copy"        // Upload local changes next to the blob as <name>.conflict-<host>
+	conflictPolicyLastWriterWins = "last-writer-wins" // Overwrite the changes of the other writer
+)
+
+const conflictCopySuffix = ".conflict-"
+
+// parseConflictPolicy : validate the configured conflict policy, last writer wins unless something else is asked for
+func parseConflictPolicy(policy string) (string, error) {
+	switch strings.ToLower(policy) {
+	case "":
+		return conflictPolicyLastWriterWins, nil
+	case conflictPolicyFail, conflictPolicyKeepCopy, conflictPolicyLastWriterWins:
+		return strings.ToLower(policy), nil
+	default:
+		return "", fmt.Errorf("invalid conflict-policy %s", policy)
+	}
+}
+
+// trackETag : remember the etag of the blob the cached copy of this path was downloaded from or uploaded to
+func (fc *FileCache) trackETag(name string, etag string) {
+	fc.etagList.Store(name, etag)
+}
+
+// untrackETag : this mount changed the blob without learning its new etag, next upload of the path is not checked
+func (fc *FileCache) untrackETag(name string) {
+	if _, found := fc.etagList.Load(name); found {
+		fc.etagList.Store(name, "")
+	}
+}
+
+// expectedETag : etag the blob shall still have for the cached copy to be uploaded over it.
+// Uploads through other handles of this mount move the tracked etag ahead of the one this handle was opened with.
+func (fc *FileCache) expectedETag(handle *handlemap.Handle) string {
+	if etag, found := fc.etagList.Load(handle.Path); found {
+		return etag.(string)
+	}
+	return handle.ETag
+}
+
+// refreshETag : read back the etag of the blob after this mount has updated it
+func (fc *FileCache) refreshETag(handle *handlemap.Handle) {
+	attr, err := fc.NextComponent().GetAttr(internal.GetAttrOptions{Name: handle.Path, Refresh: true})
+	if err != nil {
+		log.Warn("FileCache::refreshETag : Failed to get attr of %s, next upload will not be checked [%s]", handle.Path, err.Error())
+		fc.trackETag(handle.Path, "")
+		return
+	}
+
+	fc.trackETag(handle.Path, attr.ETag)
+	handle.ETag = attr.ETag
+}
+
+// uploadFile : Upload the cached file unless the blob was changed by another writer since it was downloaded.
+// On such a conflict the configured policy decides what happens to local changes, returns false if the blob was left as is.
+// Etag of the uploaded blob is tracked for the next upload of the path.
+func (fc *FileCache) uploadFile(ctx context.Context, handle *handlemap.Handle, f *os.File) (bool, error) {
+	options, err := fc.uploadOptions(handle.Path, f)
+	if err != nil {
+		log.Err("FileCache::uploadFile : Failed to read cached %s [%s]", handle.Path, err.Error())
+		return false, err
+	}
+	options.Ctx = ctx
+
+	etag := fc.expectedETag(handle)
+	if fc.conflictPolicy == conflictPolicyLastWriterWins {
+		// Blob is overwritten either way so the upload is not conditional, conflict is only counted
+		fc.checkConflict(handle.Path, etag)
+	} else {
+		options.ETag = etag
+	}
+
+	err = fc.copyFromFile(handle, options)
+	if err != syscall.ESTALE || options.ETag == "" {
+		return true, err
+	}
+
+	fileCacheStatsCollector.UpdateStats(stats_manager.Increment, writeConflicts, (int64)(1))
+	log.Warn("FileCache::uploadFile : %s was modified by another writer after it was opened, applying %s policy", handle.Path, fc.conflictPolicy)
+
+	if fc.conflictPolicy == conflictPolicyFail {
+		return false, syscall.ESTALE
+	}
+
+	// First attempt may have read the file already
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		log.Err("FileCache::uploadFile : Failed to rewind %s [%s]", handle.Path, err.Error())
+		return false, err
+	}
+
+	copyName := handle.Path + conflictCopySuffix + fc.hostname
+	options.Name = copyName
+	options.ETag = ""
+	err = fc.NextComponent().CopyFromFile(options)
+	if err != nil {
+		log.Err("FileCache::uploadFile : Failed to save local changes of %s as %s [%s]", handle.Path, copyName, err.Error())
+		return false, err
+	}
+
+	// Cached copy does not match the blob anymore, drop it on close so the next open gets the other writer's version
+	log.Warn("FileCache::uploadFile : Local changes of %s saved as %s", handle.Path, copyName)
+	handle.Flags.Set(handlemap.HandleFlagFSynced)
+	return false, nil
+}
+
+// checkConflict : count the upload as a conflict if the attributes known to the mount show another version of the blob.
+// Attributes are not refreshed for this, so a conflict hidden by the attribute cache is not counted.
+func (fc *FileCache) checkConflict(name string, etag string) {
+	if etag == "" {
+		return
+	}
+
+	attr, err := fc.NextComponent().GetAttr(internal.GetAttrOptions{Name: name})
+	if err == nil && attr.ETag != "" && attr.ETag != etag {
+		fileCacheStatsCollector.UpdateStats(stats_manager.Increment, writeConflicts, (int64)(1))
+		log.Warn("FileCache::uploadFile : %s was modified by another writer after it was opened, overwriting it", name)
+	}
+}
+
+// copyFromFile : upload the cached file and track the etag of the new blob, read back only if storage did not return it
+func (fc *FileCache) copyFromFile(handle *handlemap.Handle, options internal.CopyFromFileOptions) error {
+	prevETag := handle.ETag
+	handle.ETag = ""
+	options.Handle = handle
+
+	err := fc.NextComponent().CopyFromFile(options)
+	if err != nil {
+		handle.ETag = prevETag
+		return err
+	}
+
+	if handle.ETag == "" {
+		fc.refreshETag(handle)
+	} else {
+		fc.trackETag(handle.Path, handle.ETag)
+	}
+	return nil
+}
@@ -41,6 +41,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -49,6 +50,7 @@ import (
 	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/common/tracing"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
 	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
@@ -70,10 +72,15 @@ type FileCache struct {
 	cleanupOnStart  bool
 	policyTrace     bool
 	missedChmodList sync.Map
+	missedXattrList sync.Map
+	etagList        sync.Map
+	conflictPolicy  string
+	hostname        string
 	mountPath       string
 	allowOther      bool
 	offloadIO       bool
 	maxCacheSize    float64
+	cipher          *cacheCipher // encrypts cached files, nil unless encrypt-cache is set
 
 	defaultPermission os.FileMode
 }
@@ -97,6 +104,9 @@ type FileCacheOptions struct {
 
 	EnablePolicyTrace bool `config:"policy-trace" yaml:"policy-trace,omitempty"`
 	OffloadIO         bool `config:"offload-io" yaml:"offload-io,omitempty"`
+	EncryptCache      bool `config:"encrypt-cache" yaml:"encrypt-cache,omitempty"`
+
+	ConflictPolicy string `config:"conflict-policy" yaml:"conflict-policy,omitempty"`
 
 	// v1 support
 	V1Timeout     uint32 `config:"file-cache-timeout-in-seconds" yaml:"-"`
@@ -139,7 +149,8 @@ func (c *FileCache) Priority() internal.ComponentPriority {
 func (c *FileCache) Start(ctx context.Context) error {
 	log.Trace("Starting component : %s", c.Name())
 
-	if c.cleanupOnStart {
+	// Files left by an earlier mount were encrypted with a key which is gone
+	if c.cleanupOnStart || c.cipher != nil {
 		err := c.TempCacheCleanup()
 		if err != nil {
 			return fmt.Errorf("error in %s error [fail to cleanup temp cache]", c.Name())
@@ -221,6 +232,31 @@ func (c *FileCache) Configure(_ bool) error {
 	c.offloadIO = conf.OffloadIO
 	c.maxCacheSize = conf.MaxSizeMB
 
+	if conf.EncryptCache {
+		c.cipher, err = newCacheCipher()
+		if err != nil {
+			log.Err("FileCache::Configure : failed to generate cache key [%s]", err.Error())
+			return fmt.Errorf("config error in %s [%s]", c.Name(), err.Error())
+		}
+
+		// libfuse would read the cipher text if it was given the cached file
+		if !c.offloadIO {
+			log.Info("FileCache::Configure : encrypt-cache is set, reads and writes are served by file-cache")
+		}
+	}
+
+	c.conflictPolicy, err = parseConflictPolicy(conf.ConflictPolicy)
+	if err != nil {
+		log.Err("FileCache::Configure : config error [%s]", err.Error())
+		return fmt.Errorf("config error in %s [%s]", c.Name(), err.Error())
+	}
+
+	c.hostname, err = os.Hostname()
+	if err != nil {
+		log.Warn("FileCache::Configure : Failed to get hostname for conflict copies [%s]", err.Error())
+		c.hostname = "unknown"
+	}
+
 	c.tmpPath = common.ExpandPath(conf.TmpPath)
 	if c.tmpPath == "" {
 		log.Err("FileCache: config error [tmp-path not set]")
@@ -288,8 +324,8 @@ func (c *FileCache) Configure(_ bool) error {
 		log.Warn("unsupported v1 CLI parameter: upload-modified-only is always true in blobfuse2.")
 	}
 
-	log.Info("FileCache::Configure : create-empty %t, cache-timeout %d, tmp-path %s, max-size-mb %d, high-mark %d, low-mark %d",
-		c.createEmptyFile, int(c.cacheTimeout), c.tmpPath, int(cacheConfig.maxSizeMB), int(cacheConfig.highThreshold), int(cacheConfig.lowThreshold))
+	log.Info("FileCache::Configure : create-empty %t, cache-timeout %d, tmp-path %s, max-size-mb %d, high-mark %d, low-mark %d, conflict-policy %s, encrypt-cache %t",
+		c.createEmptyFile, int(c.cacheTimeout), c.tmpPath, int(cacheConfig.maxSizeMB), int(cacheConfig.highThreshold), int(cacheConfig.lowThreshold), c.conflictPolicy, c.cipher != nil)
 
 	return nil
 }
@@ -307,6 +343,9 @@ func (c *FileCache) OnConfigChange() {
 	c.policyTrace = conf.EnablePolicyTrace
 	c.offloadIO = conf.OffloadIO
 	c.maxCacheSize = conf.MaxSizeMB
+	if policy, err := parseConflictPolicy(conf.ConflictPolicy); err == nil {
+		c.conflictPolicy = policy
+	}
 	_ = c.policy.UpdateConfig(c.GetPolicyConfig(conf))
 }
 
@@ -635,6 +674,16 @@ func (fc *FileCache) CreateFile(options internal.CreateFileOptions) (*handlemap.
 		log.Err("FileCache::CreateFile : error opening local file %s [%s]", options.Name, err.Error())
 		return nil, err
 	}
+
+	if fc.cipher != nil {
+		err = fc.cipher.newFile(localPath)
+		if err != nil {
+			log.Err("FileCache::CreateFile : error generating key for local file %s [%s]", options.Name, err.Error())
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
 	// The user might change permissions WHILE creating the file therefore we need to account for that
 	if options.Mode != common.DefaultFilePermissionBits {
 		fc.missedChmodList.LoadOrStore(options.Name, true)
@@ -646,7 +695,7 @@ func (fc *FileCache) CreateFile(options internal.CreateFileOptions) (*handlemap.
 	handle := handlemap.NewHandle(options.Name)
 	handle.UnixFD = uint64(f.Fd())
 
-	if !fc.offloadIO {
+	if !fc.offloadIO && fc.cipher == nil {
 		handle.Flags.Set(handlemap.HandleFlagCached)
 	}
 	log.Info("FileCache::CreateFile : file=%s, fd=%d", options.Name, f.Fd())
@@ -719,6 +768,11 @@ func (fc *FileCache) DeleteFile(options internal.DeleteFileOptions) error {
 	}
 
 	fc.policy.CachePurge(localPath)
+	if fc.cipher != nil {
+		fc.cipher.forget(localPath)
+	}
+	fc.missedXattrList.Delete(options.Name)
+	fc.etagList.Delete(options.Name)
 
 	return nil
 }
@@ -734,6 +788,12 @@ func (fc *FileCache) isDownloadRequired(localPath string) (bool, bool) {
 		downloadRequired = true
 	}
 
+	// Cached file can not be decrypted
+	if fc.cipher != nil && !fc.cipher.known(localPath) {
+		log.Debug("FileCache::isDownloadRequired : %s has no key in local cache", localPath)
+		downloadRequired = true
+	}
+
 	finfo, err := os.Stat(localPath)
 	if err == nil {
 		// The file exists in local cache
@@ -792,6 +852,9 @@ func (fc *FileCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 	if downloadRequired {
 		log.Debug("FileCache::OpenFile : Need to re-download %s", options.Name)
 
+		ctx, span := tracing.StartSpan(options.Ctx, "file_cache.download", tracing.Attribute{Key: "path", Value: options.Name})
+		defer span.End()
+
 		if fileExists {
 			log.Debug("FileCache::OpenFile : Delete cached file %s", options.Name)
 
@@ -815,10 +878,21 @@ func (fc *FileCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 			return nil, err
 		}
 
+		if fc.cipher != nil {
+			err = fc.cipher.newFile(localPath)
+			if err != nil {
+				log.Err("FileCache::OpenFile : error generating key for new file %s [%s]", options.Name, err.Error())
+				_ = f.Close()
+				_ = os.Remove(localPath)
+				return nil, err
+			}
+		}
+
 		attrReceived := false
 		fileSize := int64(0)
 
-		attr, err := fc.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name})
+		// Attributes cached below may predate the blob about to be downloaded, its etag would then flag our own upload as a conflict
+		attr, err := fc.NextComponent().GetAttr(internal.GetAttrOptions{Name: options.Name, Refresh: true, Ctx: ctx})
 		if err != nil {
 			log.Err("FileCache::OpenFile : Failed to get attr of %s [%s]", options.Name, err.Error())
 		} else {
@@ -826,18 +900,20 @@ func (fc *FileCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 			fileSize = int64(attr.Size)
 		}
 
+		// Remember which version of the blob gets cached so that uploads can detect other writers
+		if attrReceived {
+			fc.trackETag(options.Name, attr.ETag)
+		} else {
+			fc.etagList.Delete(options.Name)
+		}
+
 		if !attrReceived || fileSize > 0 {
 			// Download/Copy the file from storage to the local file.
-			err = fc.NextComponent().CopyToFile(
-				internal.CopyToFileOptions{
-					Name:   options.Name,
-					Offset: 0,
-					Count:  fileSize,
-					File:   f,
-				})
+			err = fc.downloadFile(ctx, options.Name, fileSize, f)
 			if err != nil {
 				// File was created locally and now download has failed so we need to delete it back from local cache
 				log.Err("FileCache::OpenFile : error downloading file from storage %s [%s]", options.Name, err.Error())
+				span.SetError(err)
 				_ = f.Close()
 				_ = os.Remove(localPath)
 				return nil, err
@@ -880,6 +956,16 @@ func (fc *FileCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 		return nil, err
 	}
 
+	// Content of the file is gone, nothing is left encrypted under the old key stream
+	if fc.cipher != nil && options.Flags&os.O_TRUNC != 0 && flock.Count() == 0 {
+		err = fc.cipher.newFile(localPath)
+		if err != nil {
+			log.Err("FileCache::OpenFile : error generating key for truncated file %s [%s]", options.Name, err.Error())
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
 	// Increment the handle count in this lock item as there is one handle open for this now
 	flock.Inc()
 
@@ -890,10 +976,14 @@ func (fc *FileCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Hand
 	}
 
 	handle.UnixFD = uint64(f.Fd())
-	if !fc.offloadIO {
+	if !fc.offloadIO && fc.cipher == nil {
 		handle.Flags.Set(handlemap.HandleFlagCached)
 	}
 
+	if etag, found := fc.etagList.Load(options.Name); found {
+		handle.ETag = etag.(string)
+	}
+
 	log.Info("FileCache::OpenFile : file=%s, fd=%d", options.Name, f.Fd())
 	handle.SetFileObject(f)
 
@@ -944,6 +1034,9 @@ func (fc *FileCache) CloseFile(options internal.CloseFileOptions) error {
 		}
 
 		fc.policy.CachePurge(localPath)
+		if fc.cipher != nil {
+			fc.cipher.forget(localPath)
+		}
 		return nil
 	}
 
@@ -977,6 +1070,13 @@ func (fc *FileCache) ReadFile(options internal.ReadFileOptions) ([]byte, error)
 		return nil, syscall.EIO
 	}
 
+	if fc.cipher != nil {
+		err = fc.cipher.decrypt(localPath, data, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return data, err
 }
 
@@ -998,6 +1098,10 @@ func (fc *FileCache) ReadInBuffer(options internal.ReadInBufferOptions) (int, er
 		fc.policy.CacheValid(localPath)
 	}
 
+	if fc.cipher != nil {
+		return fc.cipher.readAt(filepath.Join(fc.tmpPath, options.Handle.Path), options.Handle.FD(), options.Data, options.Offset)
+	}
+
 	// Removing f.ReadAt as it involves lot of house keeping and then calls syscall.Pread
 	// Instead we will call syscall directly for better perf
 	return syscall.Pread(options.Handle.FD(), options.Data, options.Offset)
@@ -1021,9 +1125,15 @@ func (fc *FileCache) WriteFile(options internal.WriteFileOptions) (int, error) {
 		fc.policy.CacheValid(localPath)
 	}
 
-	// Removing f.WriteAt as it involves lot of house keeping and then calls syscall.Pwrite
-	// Instead we will call syscall directly for better perf
-	bytesWritten, err := syscall.Pwrite(options.Handle.FD(), options.Data, options.Offset)
+	var bytesWritten int
+	var err error
+	if fc.cipher != nil {
+		bytesWritten, err = fc.cipher.writeAt(filepath.Join(fc.tmpPath, options.Handle.Path), options.Handle.FD(), options.Data, options.Offset)
+	} else {
+		// Removing f.WriteAt as it involves lot of house keeping and then calls syscall.Pwrite
+		// Instead we will call syscall directly for better perf
+		bytesWritten, err = syscall.Pwrite(options.Handle.FD(), options.Data, options.Offset)
+	}
 
 	if err == nil {
 		// Mark the handle dirty so the file is written back to storage on FlushFile.
@@ -1104,11 +1214,10 @@ func (fc *FileCache) FlushFile(options internal.FlushFileOptions) error {
 			return nil
 		}
 
-		err = fc.NextComponent().CopyFromFile(
-			internal.CopyFromFileOptions{
-				Name: options.Handle.Path,
-				File: uploadHandle,
-			})
+		ctx, span := tracing.StartSpan(options.Ctx, "file_cache.upload", tracing.Attribute{Key: "path", Value: options.Handle.Path})
+		uploaded, err := fc.uploadFile(ctx, options.Handle, uploadHandle)
+		span.SetError(err)
+		span.End()
 
 		uploadHandle.Close()
 		if err != nil {
@@ -1117,33 +1226,111 @@ func (fc *FileCache) FlushFile(options internal.FlushFileOptions) error {
 		}
 
 		options.Handle.Flags.Clear(handlemap.HandleFlagDirty)
+		if !uploaded {
+			return nil
+		}
 
-		// If chmod was done on the file before it was uploaded to container then setting up mode would have been missed
-		// Such file names are added to this map and here post upload we try to set the mode correctly
-		_, found := fc.missedChmodList.Load(options.Handle.Path)
-		if found {
-			// If file is found in map it means last chmod was missed on this
-			// Delete the entry from map so that any further flush do not try to update the mode again
-			fc.missedChmodList.Delete(options.Handle.Path)
-
-			// When chmod on container was missed, local file was updated with correct mode
-			// Here take the mode from local cache and update the container accordingly
-			localPath := filepath.Join(fc.tmpPath, options.Handle.Path)
-			info, err := os.Lstat(localPath)
-			if err == nil {
-				err = fc.Chmod(internal.ChmodOptions{Name: options.Handle.Path, Mode: info.Mode()})
-				if err != nil {
-					// chmod was missed earlier for this file and doing it now also
-					// resulted in error so ignore this one and proceed for flush handling
-					log.Err("FileCache::FlushFile : %s chmod failed [%s]", options.Handle.Path, err.Error())
-				}
-			}
+		chmodApplied := fc.applyMissedChmod(options.Handle.Path)
+
+		// Extended attributes set before the file was uploaded are applied now that it exists in storage
+		xattrsApplied := fc.applyMissedXattrs(options.Handle.Path)
+
+		// Chmod and xattrs change the etag as well so it is read back once everything is applied
+		if chmodApplied || xattrsApplied {
+			fc.refreshETag(options.Handle)
 		}
 	}
 
 	return nil
 }
 
+// CopyFileRange : Copy the range on the service when storage already holds what the source handle sees.
+// Cached copy of the target gets the same range from the cached source, so the target matches storage without an upload.
+func (fc *FileCache) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	srcName := options.SrcHandle.Path
+	dstName := options.DstHandle.Path
+	log.Trace("FileCache::CopyFileRange : %s offset %d -> %s offset %d, size %d", srcName, options.SrcOffset, dstName, options.DstOffset, options.Size)
+
+	srcFile := options.SrcHandle.GetFileObject()
+	dstFile := options.DstHandle.GetFileObject()
+	if srcFile == nil || dstFile == nil {
+		log.Err("FileCache::CopyFileRange : error [missing fd in handle object] %s -> %s", srcName, dstName)
+		return 0, syscall.EBADF
+	}
+
+	if srcName == dstName {
+		return 0, syscall.ENOTSUP
+	}
+
+	flock := fc.fileLocks.Get(srcName)
+	flock.Lock()
+	defer flock.Unlock()
+
+	// Local changes of the source, made through this or any other handle, are not in storage yet
+	if options.SrcHandle.Dirty() || flock.Count() > 1 {
+		log.Debug("FileCache::CopyFileRange : %s may have local changes, copying through the cache", srcName)
+		return 0, syscall.ENOTSUP
+	}
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	dstInfo, err := dstFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if options.SrcOffset >= srcInfo.Size() {
+		return 0, nil
+	}
+
+	// Unless the whole target is replaced, storage merges the range into its copy of the target,
+	// which misses local changes of the target just like it would for the source
+	replaced := options.SrcOffset == 0 && options.DstOffset == 0 && options.Size >= srcInfo.Size() && dstInfo.Size() <= srcInfo.Size()
+	if !replaced && (options.DstHandle.Dirty() || fc.fileLocks.Get(dstName).Count() > 1) {
+		log.Debug("FileCache::CopyFileRange : %s may have local changes, copying through the cache", dstName)
+		return 0, syscall.ENOTSUP
+	}
+
+	copied, err := fc.NextComponent().CopyFileRange(options)
+	if err != nil || copied == 0 {
+		return copied, err
+	}
+
+	fc.untrackETag(dstName)
+
+	if fc.cipher != nil {
+		err = fc.cipher.copyRange(filepath.Join(fc.tmpPath, dstName), dstFile, options.DstOffset, filepath.Join(fc.tmpPath, srcName), srcFile, options.SrcOffset, copied)
+	} else {
+		_, err = dstFile.Seek(options.DstOffset, io.SeekStart)
+		if err == nil {
+			_, err = io.Copy(dstFile, io.NewSectionReader(srcFile, options.SrcOffset, copied))
+		}
+	}
+	if err != nil {
+		// Storage has the copy but the cached target does not, it is dropped on close so the next open downloads it.
+		// Handle must not upload the stale cached file over the copy, and the caller must not take its data as current.
+		log.Err("FileCache::CopyFileRange : Failed to update cached %s [%s]", dstName, err.Error())
+		options.DstHandle.Flags.Clear(handlemap.HandleFlagDirty)
+		options.DstHandle.Flags.Set(handlemap.HandleFlagFSynced)
+		return 0, err
+	}
+
+	options.DstHandle.Size = dstInfo.Size()
+	if end := options.DstOffset + copied; end > options.DstHandle.Size {
+		options.DstHandle.Size = end
+	}
+	options.DstHandle.Flags.Clear(handlemap.HandleFlagDirty)
+	fc.policy.CacheValid(filepath.Join(fc.tmpPath, dstName))
+
+	// Same as after an upload, changes made while the target was not in storage are applied now
+	fc.applyMissedChmod(dstName)
+	fc.applyMissedXattrs(dstName)
+
+	return copied, nil
+}
+
 // GetAttr: Consolidate attributes from storage and local cache
 func (fc *FileCache) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr, error) {
 	log.Trace("FileCache::GetAttr : %s", options.Name)
@@ -1233,6 +1420,15 @@ func (fc *FileCache) RenameFile(options internal.RenameFileOptions) error {
 		log.Err("FileCache::RenameFile : %s failed to rename local file %s [%s]", localSrcPath, err.Error())
 	}
 
+	if fc.cipher != nil {
+		if err == nil {
+			fc.cipher.rename(localSrcPath, localDstPath)
+		} else {
+			fc.cipher.forget(localSrcPath)
+			fc.cipher.forget(localDstPath)
+		}
+	}
+
 	if err != nil {
 		// If there was a problem in local rename then delete the destination file
 		// it might happen that dest file was already there and local rename failed
@@ -1251,6 +1447,8 @@ func (fc *FileCache) RenameFile(options internal.RenameFileOptions) error {
 	}
 
 	fc.policy.CachePurge(localSrcPath)
+	fc.etagList.Delete(options.Src)
+	fc.etagList.Delete(options.Dst)
 	return nil
 }
 
@@ -1268,6 +1466,7 @@ func (fc *FileCache) TruncateFile(options internal.TruncateFileOptions) error {
 		log.Err("FileCache::TruncateFile : %s failed to truncate [%s]", options.Name, err.Error())
 		return err
 	}
+	fc.untrackETag(options.Name)
 
 	// Update the size of the file in the local cache
 	localPath := filepath.Join(fc.tmpPath, options.Name)
@@ -1276,7 +1475,11 @@ func (fc *FileCache) TruncateFile(options internal.TruncateFileOptions) error {
 		fc.policy.CacheValid(localPath)
 
 		if info.Size() != options.Size {
-			err = os.Truncate(localPath, options.Size)
+			if fc.cipher != nil {
+				err = fc.cipher.truncate(localPath, options.Size)
+			} else {
+				err = os.Truncate(localPath, options.Size)
+			}
 			if err != nil {
 				log.Err("FileCache::TruncateFile : error truncating cached file %s [%s]", localPath, err.Error())
 				return err
@@ -1349,6 +1552,169 @@ func (fc *FileCache) Chown(options internal.ChownOptions) error {
 	return nil
 }
 
+// isPendingUpload : Check whether the path is a new file which exists only in the local cache till it is flushed
+func (fc *FileCache) isPendingUpload(name string) bool {
+	if fc.createEmptyFile {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(fc.tmpPath, name))
+	return err == nil
+}
+
+// applyMissedChmod : Set the mode which could not be set while the file was not in storage, returns true if it was missed
+func (fc *FileCache) applyMissedChmod(name string) bool {
+	// If chmod was done on the file before it was uploaded to container then setting up mode would have been missed
+	// Such file names are added to this map and here post upload we try to set the mode correctly
+	_, found := fc.missedChmodList.Load(name)
+	if found {
+		// If file is found in map it means last chmod was missed on this
+		// Delete the entry from map so that any further flush do not try to update the mode again
+		fc.missedChmodList.Delete(name)
+
+		// When chmod on container was missed, local file was updated with correct mode
+		// Here take the mode from local cache and update the container accordingly
+		localPath := filepath.Join(fc.tmpPath, name)
+		info, err := os.Lstat(localPath)
+		if err == nil {
+			err = fc.Chmod(internal.ChmodOptions{Name: name, Mode: info.Mode()})
+			if err != nil {
+				// chmod was missed earlier for this file and doing it now also
+				// resulted in error so ignore this one and proceed for flush handling
+				log.Err("FileCache::applyMissedChmod : %s chmod failed [%s]", name, err.Error())
+			}
+		}
+	}
+	return found
+}
+
+// missedXattrs : Extended attributes set on a path which is yet to be uploaded
+func (fc *FileCache) missedXattrs(name string) map[string][]byte {
+	value, found := fc.missedXattrList.Load(name)
+	if !found {
+		return map[string][]byte{}
+	}
+	return value.(map[string][]byte)
+}
+
+// applyMissedXattrs : Set the extended attributes which could not be set while the file was not in storage,
+// returns true if there were any
+func (fc *FileCache) applyMissedXattrs(name string) bool {
+	value, found := fc.missedXattrList.LoadAndDelete(name)
+	if !found {
+		return false
+	}
+
+	for attr, data := range value.(map[string][]byte) {
+		err := fc.NextComponent().SetXattr(internal.SetXattrOptions{Name: name, Attr: attr, Value: data})
+		if err != nil {
+			log.Err("FileCache::applyMissedXattrs : %s failed to set %s [%s]", name, attr, err.Error())
+		}
+	}
+	return true
+}
+
+// GetXattr : Get an extended attribute from storage, or from the pending list if the file is not uploaded yet
+func (fc *FileCache) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	log.Trace("FileCache::GetXattr : Get %s of %s", options.Attr, options.Name)
+
+	data, err := fc.NextComponent().GetXattr(options)
+	if err == syscall.ENOENT && fc.isPendingUpload(options.Name) {
+		value, found := fc.missedXattrs(options.Name)[options.Attr]
+		if !found {
+			return nil, syscall.ENODATA
+		}
+		return value, nil
+	}
+
+	return data, err
+}
+
+// ListXattr : List extended attributes from storage, or from the pending list if the file is not uploaded yet
+func (fc *FileCache) ListXattr(options internal.ListXattrOptions) ([]string, error) {
+	log.Trace("FileCache::ListXattr : List attributes of %s", options.Name)
+
+	names, err := fc.NextComponent().ListXattr(options)
+	if err == syscall.ENOENT && fc.isPendingUpload(options.Name) {
+		names = []string{}
+		for attr := range fc.missedXattrs(options.Name) {
+			names = append(names, attr)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	return names, err
+}
+
+// SetXattr : Set an extended attribute in storage.
+// If the file is not uploaded yet the attribute is remembered and set once the file is flushed.
+func (fc *FileCache) SetXattr(options internal.SetXattrOptions) error {
+	log.Trace("FileCache::SetXattr : Set %s of %s", options.Attr, options.Name)
+
+	flock := fc.fileLocks.Get(options.Name)
+	flock.Lock()
+	defer flock.Unlock()
+
+	err := fc.NextComponent().SetXattr(options)
+	if err == nil {
+		fc.untrackETag(options.Name)
+	}
+	if err != syscall.ENOENT || !fc.isPendingUpload(options.Name) {
+		return err
+	}
+
+	// Copy on write so that a concurrent flush never sees a partially updated list
+	missed := fc.missedXattrs(options.Name)
+	_, found := missed[options.Attr]
+	if found && options.Flags&internal.XattrCreate != 0 {
+		return syscall.EEXIST
+	} else if !found && options.Flags&internal.XattrReplace != 0 {
+		return syscall.ENODATA
+	}
+
+	updated := make(map[string][]byte, len(missed)+1)
+	for k, v := range missed {
+		updated[k] = v
+	}
+	updated[options.Attr] = append([]byte{}, options.Value...)
+	fc.missedXattrList.Store(options.Name, updated)
+
+	log.Info("FileCache::SetXattr : %s is not uploaded yet, %s will be set on flush", options.Name, options.Attr)
+	return nil
+}
+
+// RemoveXattr : Remove an extended attribute from storage, or from the pending list if the file is not uploaded yet
+func (fc *FileCache) RemoveXattr(options internal.RemoveXattrOptions) error {
+	log.Trace("FileCache::RemoveXattr : Remove %s of %s", options.Attr, options.Name)
+
+	flock := fc.fileLocks.Get(options.Name)
+	flock.Lock()
+	defer flock.Unlock()
+
+	err := fc.NextComponent().RemoveXattr(options)
+	if err == nil {
+		fc.untrackETag(options.Name)
+	}
+	if err != syscall.ENOENT || !fc.isPendingUpload(options.Name) {
+		return err
+	}
+
+	missed := fc.missedXattrs(options.Name)
+	if _, found := missed[options.Attr]; !found {
+		return syscall.ENODATA
+	}
+
+	updated := make(map[string][]byte, len(missed))
+	for k, v := range missed {
+		if k != options.Attr {
+			updated[k] = v
+		}
+	}
+	fc.missedXattrList.Store(options.Name, updated)
+
+	return nil
+}
+
 func (fc *FileCache) FileUsed(name string) error {
 	// Update the owner and group of the file in the local cache
 	localPath := filepath.Join(fc.tmpPath, name)
@@ -1412,6 +1778,9 @@ func init() {
 	config.BindPFlag(compName+".upload-modified-only", uploadModifiedOnly)
 	uploadModifiedOnly.Hidden = true
 
+	encryptCache := config.AddBoolFlag("encrypt-cache", false, "Encrypt files in the file cache with a key held in memory for the lifetime of the mount.")
+	config.BindPFlag(compName+".encrypt-cache", encryptCache)
+
 	config.RegisterFlagCompletionFunc("tmp-path", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return nil, cobra.ShellCompDirectiveDefault
 	})
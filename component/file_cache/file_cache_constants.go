@@ -38,4 +38,6 @@ const (
 	usgPer      = "Usage Percent"
 	dlFiles     = "Files Downloaded"
 	cacheServed = "Files served from cache"
+
+	writeConflicts = "Write Conflicts"
 )
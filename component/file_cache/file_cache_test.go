@@ -34,6 +34,7 @@
 package file_cache
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
@@ -47,6 +48,7 @@ import (
 	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/component/attr_cache"
 	"github.com/Azure/azure-storage-fuse/v2/component/loopback"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
@@ -952,6 +954,106 @@ func (suite *fileCacheTestSuite) TestFlushFileEmpty() {
 	suite.assert.True(err == nil || os.IsExist(err))
 }
 
+func (suite *fileCacheTestSuite) TestCopyFileRange() {
+	defer suite.cleanupTest()
+	// Setup
+	src := "src"
+	dst := "dst"
+	data := []byte("test data")
+	handle, _ := suite.fileCache.CreateFile(internal.CreateFileOptions{Name: src, Mode: 0777})
+	suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+
+	// Source with local changes is copied through the cache
+	dstHandle, _ := suite.fileCache.CreateFile(internal.CreateFileOptions{Name: dst, Mode: 0777})
+	options := internal.CopyFileRangeOptions{SrcHandle: handle, DstHandle: dstHandle, Size: 1 << 20}
+	_, err := suite.fileCache.CopyFileRange(options)
+	suite.assert.Equal(syscall.ENOTSUP, err)
+
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+	handle, _ = suite.fileCache.OpenFile(internal.OpenFileOptions{Name: src, Flags: os.O_RDONLY, Mode: 0777})
+	options.SrcHandle = handle
+
+	copied, err := suite.fileCache.CopyFileRange(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), copied)
+	suite.assert.False(dstHandle.Dirty())
+
+	// Both storage and the cached target have the data
+	output, err := os.ReadFile(suite.fake_storage_path + "/" + dst)
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, output)
+	output = make([]byte, len(data))
+	n, err := suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: dstHandle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.Equal(data, output)
+
+	// Past the end of the source there is nothing to copy
+	options.SrcOffset = int64(len(data))
+	copied, err = suite.fileCache.CopyFileRange(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(0, copied)
+}
+
+func (suite *fileCacheTestSuite) TestCopyFileRangePartial() {
+	defer suite.cleanupTest()
+	// Setup
+	src := "src"
+	dst := "dst"
+	os.WriteFile(suite.fake_storage_path+"/"+src, []byte("0123456789"), 0777)
+	os.WriteFile(suite.fake_storage_path+"/"+dst, []byte("abcdefgh"), 0777)
+	handle, _ := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: src, Flags: os.O_RDONLY, Mode: 0777})
+	dstHandle, _ := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: dst, Flags: os.O_RDWR, Mode: 0777})
+
+	// Target with local changes can not be merged on the service
+	suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: dstHandle, Offset: 0, Data: []byte("A")})
+	options := internal.CopyFileRangeOptions{SrcHandle: handle, SrcOffset: 2, DstHandle: dstHandle, DstOffset: 6, Size: 6}
+	_, err := suite.fileCache.CopyFileRange(options)
+	suite.assert.Equal(syscall.ENOTSUP, err)
+	suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: dstHandle})
+
+	copied, err := suite.fileCache.CopyFileRange(options)
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(6, copied)
+	suite.assert.EqualValues(12, dstHandle.Size)
+	suite.assert.False(dstHandle.Dirty())
+
+	// Both storage and the cached target keep the head of the target
+	data := []byte("Abcdef234567")
+	output, err := os.ReadFile(suite.fake_storage_path + "/" + dst)
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, output)
+	output = make([]byte, len(data))
+	n, err := suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: dstHandle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.Equal(data, output)
+}
+
+func (suite *fileCacheTestSuite) TestCopyFileRangeLocalFailure() {
+	defer suite.cleanupTest()
+	// Setup
+	src := "src"
+	dst := "dst"
+	data := []byte("test data")
+	os.WriteFile(suite.fake_storage_path+"/"+src, data, 0777)
+	os.WriteFile(suite.fake_storage_path+"/"+dst, []byte("old"), 0777)
+	handle, _ := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: src, Flags: os.O_RDONLY, Mode: 0777})
+	// Cached target can not be written through a read only handle
+	dstHandle, _ := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: dst, Flags: os.O_RDONLY, Mode: 0777})
+
+	copied, err := suite.fileCache.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: handle, DstHandle: dstHandle, Size: 1 << 20})
+	suite.assert.NotNil(err)
+	suite.assert.EqualValues(0, copied)
+
+	// Storage has the copy, the stale cached target is not uploaded and is dropped on close
+	output, err := os.ReadFile(suite.fake_storage_path + "/" + dst)
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, output)
+	suite.assert.False(dstHandle.Dirty())
+	suite.assert.True(dstHandle.Flags.IsSet(handlemap.HandleFlagFSynced))
+}
+
 func (suite *fileCacheTestSuite) TestFlushFile() {
 	defer suite.cleanupTest()
 	// Setup
@@ -978,6 +1080,179 @@ func (suite *fileCacheTestSuite) TestFlushFile() {
 	suite.assert.EqualValues(data, d)
 }
 
+// openConflictingFile : open a file through the cache and then change it in storage behind its back
+func (suite *fileCacheTestSuite) openConflictingFile(file string, local []byte) *handlemap.Handle {
+	os.WriteFile(suite.fake_storage_path+"/"+file, []byte("original"), 0777)
+	handle, err := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: file, Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Nil(err)
+	suite.assert.NotEmpty(handle.ETag)
+
+	os.WriteFile(suite.fake_storage_path+"/"+file, []byte("other writer"), 0777)
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: local})
+	suite.assert.Nil(err)
+	return handle
+}
+
+func (suite *fileCacheTestSuite) TestFlushFileConflictFail() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := fmt.Sprintf("file_cache:\n  path: %s\n  offload-io: true\n  conflict-policy: fail\n\nloopbackfs:\n  path: %s", suite.cache_path, suite.fake_storage_path)
+	suite.setupTestHelper(config)
+	suite.assert.Equal(conflictPolicyFail, suite.fileCache.conflictPolicy)
+
+	file := "file"
+	handle := suite.openConflictingFile(file, []byte("local changes!!"))
+
+	err := suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Equal(syscall.ESTALE, err)
+	suite.assert.True(handle.Dirty())
+
+	// Changes of the other writer survive
+	d, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal("other writer", string(d))
+}
+
+func (suite *fileCacheTestSuite) TestFlushFileConflictKeepCopy() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := fmt.Sprintf("file_cache:\n  path: %s\n  offload-io: true\n  conflict-policy: keep-copy\n\nloopbackfs:\n  path: %s", suite.cache_path, suite.fake_storage_path)
+	suite.setupTestHelper(config)
+
+	file := "file"
+	data := []byte("local changes!!")
+	handle := suite.openConflictingFile(file, data)
+
+	err := suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Dirty())
+	suite.assert.True(handle.Fsynced())
+
+	d, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal("other writer", string(d))
+	d, err = os.ReadFile(suite.fake_storage_path + "/" + file + ".conflict-" + suite.fileCache.hostname)
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, d)
+
+	// Cached copy is dropped on close so the next open gets the version of the other writer
+	err = suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	_, err = os.Stat(suite.cache_path + "/" + file)
+	suite.assert.True(os.IsNotExist(err))
+}
+
+func (suite *fileCacheTestSuite) TestFlushFileConflictLastWriterWins() {
+	defer suite.cleanupTest()
+	suite.assert.Equal(conflictPolicyLastWriterWins, suite.fileCache.conflictPolicy)
+
+	file := "file"
+	data := []byte("local changes!!")
+	handle := suite.openConflictingFile(file, data)
+
+	err := suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Dirty())
+
+	d, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal(data, d)
+
+	// Etag of the upload is tracked so further flushes of this handle are not conflicts
+	etag := handle.ETag
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: int64(len(data)), Data: data})
+	suite.assert.Nil(err)
+	suite.assert.Equal(etag, suite.fileCache.expectedETag(handle))
+	err = suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.NotEqual(etag, handle.ETag)
+}
+
+// countingStorage : count the uploads and the attribute refreshes the cache asks storage for
+type countingStorage struct {
+	internal.Component
+	uploads   int
+	refreshes int
+}
+
+func (c *countingStorage) CopyFromFile(options internal.CopyFromFileOptions) error {
+	c.uploads++
+	return c.Component.CopyFromFile(options)
+}
+
+func (c *countingStorage) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr, error) {
+	if options.Refresh {
+		c.refreshes++
+	}
+	return c.Component.GetAttr(options)
+}
+
+func (suite *fileCacheTestSuite) TestFlushFileConflictLastWriterWinsSingleUpload() {
+	defer suite.cleanupTest()
+	storage := &countingStorage{Component: suite.loopback}
+	suite.fileCache.Stop()
+	suite.fileCache = newTestFileCache(storage)
+	suite.assert.Nil(suite.fileCache.Start(context.Background()))
+
+	file := "file"
+	data := []byte("local changes!!")
+	handle := suite.openConflictingFile(file, data)
+	storage.uploads, storage.refreshes = 0, 0
+
+	err := suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+
+	// Conflict does not upload the file twice and the etag comes with the upload
+	suite.assert.Equal(1, storage.uploads)
+	suite.assert.Equal(0, storage.refreshes)
+	attr, err := suite.loopback.GetAttr(internal.GetAttrOptions{Name: file})
+	suite.assert.Nil(err)
+	suite.assert.Equal(attr.ETag, handle.ETag)
+	suite.assert.Equal(handle.ETag, suite.fileCache.expectedETag(handle))
+}
+
+func (suite *fileCacheTestSuite) TestFlushFileConflictStaleAttrCache() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config.ReadConfigFromReader(strings.NewReader(fmt.Sprintf("file_cache:\n  path: %s\n  offload-io: true\n  conflict-policy: fail\n\nattr_cache:\n  timeout: 120\n\nloopbackfs:\n  path: %s", suite.cache_path, suite.fake_storage_path)))
+	suite.loopback = newLoopbackFS()
+	attrCache := attr_cache.NewAttrCacheComponent()
+	attrCache.SetNextComponent(suite.loopback)
+	suite.assert.Nil(attrCache.Configure(true))
+	suite.fileCache = newTestFileCache(attrCache)
+	suite.loopback.Start(context.Background())
+	suite.assert.Nil(attrCache.Start(context.Background()))
+	suite.assert.Nil(suite.fileCache.Start(context.Background()))
+	defer attrCache.Stop()
+
+	// Attributes of the first version stay cached after another writer replaces the blob
+	file := "file"
+	os.WriteFile(suite.fake_storage_path+"/"+file, []byte("original"), 0777)
+	_, err := suite.fileCache.GetAttr(internal.GetAttrOptions{Name: file})
+	suite.assert.Nil(err)
+	os.WriteFile(suite.fake_storage_path+"/"+file, []byte("other writer"), 0777)
+	os.Chtimes(suite.fake_storage_path+"/"+file, time.Now(), time.Now().Add(time.Minute))
+
+	// Etag of the downloaded version is tracked, so flushing it is not a conflict
+	handle, err := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: file, Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Nil(err)
+	data := []byte("local changes!!")
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	err = suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+
+	d, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal(data, d)
+}
+
+func (suite *fileCacheTestSuite) TestConflictPolicyInvalid() {
+	defer suite.cleanupTest()
+	config.ReadConfigFromReader(strings.NewReader(fmt.Sprintf("file_cache:\n  path: %s\n  conflict-policy: merge", suite.cache_path)))
+
+	fileCache := NewFileCacheComponent()
+	err := fileCache.Configure(true)
+	suite.assert.NotNil(err)
+	suite.assert.Contains(err.Error(), "conflict-policy")
+}
+
 func (suite *fileCacheTestSuite) TestFlushFileErrorBadFd() {
 	defer suite.cleanupTest()
 	// Setup
@@ -1340,6 +1615,48 @@ func (suite *fileCacheTestSuite) TestChmodCase2() {
 	suite.assert.EqualValues(attr.Mode, newMode)
 }
 
+func (suite *fileCacheTestSuite) TestXattrBeforeUpload() {
+	defer suite.cleanupTest()
+	// Default is to not create empty files on create file, so the file is not in storage till it is flushed
+	path := "file"
+	createHandle, err := suite.fileCache.CreateFile(internal.CreateFileOptions{Name: path, Mode: 0777})
+	suite.assert.Nil(err)
+
+	err = suite.fileCache.SetXattr(internal.SetXattrOptions{Name: path, Attr: "user.source", Value: []byte("pipeline")})
+	suite.assert.Nil(err)
+	err = suite.fileCache.SetXattr(internal.SetXattrOptions{Name: path, Attr: "user.temp", Value: []byte("x")})
+	suite.assert.Nil(err)
+	err = suite.fileCache.SetXattr(internal.SetXattrOptions{Name: path, Attr: "user.temp", Value: []byte("y"), Flags: internal.XattrCreate})
+	suite.assert.Equal(syscall.EEXIST, err)
+	err = suite.fileCache.RemoveXattr(internal.RemoveXattrOptions{Name: path, Attr: "user.temp"})
+	suite.assert.Nil(err)
+
+	// Served from the pending list till the file is uploaded
+	value, err := suite.fileCache.GetXattr(internal.GetXattrOptions{Name: path, Attr: "user.source"})
+	suite.assert.Nil(err)
+	suite.assert.Equal([]byte("pipeline"), value)
+	names, err := suite.fileCache.ListXattr(internal.ListXattrOptions{Name: path})
+	suite.assert.Nil(err)
+	suite.assert.Equal([]string{"user.source"}, names)
+
+	err = suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: createHandle})
+	suite.assert.Nil(err)
+
+	// Attributes are in storage once flushed
+	value, err = suite.loopback.GetXattr(internal.GetXattrOptions{Name: path, Attr: "user.source"})
+	suite.assert.Nil(err)
+	suite.assert.Equal([]byte("pipeline"), value)
+	_, err = suite.loopback.GetXattr(internal.GetXattrOptions{Name: path, Attr: "user.temp"})
+	suite.assert.Equal(syscall.ENODATA, err)
+
+	err = suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: createHandle})
+	suite.assert.Nil(err)
+
+	// A path which is neither in storage nor in the local cache does not exist
+	err = suite.fileCache.SetXattr(internal.SetXattrOptions{Name: "missing", Attr: "user.source", Value: []byte("x")})
+	suite.assert.Equal(syscall.ENOENT, err)
+}
+
 func (suite *fileCacheTestSuite) TestChownNotInCache() {
 	defer suite.cleanupTest()
 	// Setup
@@ -1494,6 +1811,202 @@ func (suite *fileCacheTestSuite) TestZZOffloadIO() {
 	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
 }
 
+// setupEncryptedCache : file cache encrypting its files, libfuse would have served reads and writes without encryption
+func (suite *fileCacheTestSuite) setupEncryptedCache() {
+	configuration := fmt.Sprintf("file_cache:\n  path: %s\n  encrypt-cache: true\n\nloopbackfs:\n  path: %s",
+		suite.cache_path, suite.fake_storage_path)
+	suite.setupTestHelper(configuration)
+	suite.assert.NotNil(suite.fileCache.cipher)
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheOffsets() {
+	defer suite.cleanupTest()
+	suite.setupEncryptedCache()
+
+	c := suite.fileCache.cipher
+	suite.assert.Nil(c.newFile("file"))
+	key, err := c.fileKey("file")
+	suite.assert.Nil(err)
+	key.iv = bytes.Repeat([]byte{0xff}, 16) // counter wraps within the first blocks
+
+	data := make([]byte, 1000)
+	c.xorAt(key, data, 0)
+
+	// Key stream of any range is the matching part of the key stream of the whole file
+	for _, offset := range []int{1, 15, 16, 17, 100, 511, 999} {
+		part := make([]byte, len(data)-offset)
+		c.xorAt(key, part, int64(offset))
+		suite.assert.Equal(data[offset:], part)
+	}
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheWrite() {
+	defer suite.cleanupTest()
+	suite.setupEncryptedCache()
+
+	file := "file"
+	handle, err := suite.fileCache.CreateFile(internal.CreateFileOptions{Name: file, Mode: 0777})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Cached())
+
+	data := []byte("plain text which shall not reach the disk")
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 0, Data: data})
+	suite.assert.Nil(err)
+	// Leaves a hole which has to read back as zeros
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: 5000, Data: data})
+	suite.assert.Nil(err)
+
+	expected := make([]byte, 5000+len(data))
+	copy(expected, data)
+	copy(expected[5000:], data)
+
+	cached, err := os.ReadFile(suite.cache_path + "/" + file)
+	suite.assert.Nil(err)
+	suite.assert.Len(cached, len(expected))
+	suite.assert.False(bytes.Contains(cached, data))
+	suite.assert.False(bytes.Contains(cached, make([]byte, 64)))
+
+	output := make([]byte, 100)
+	n, err := suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 4950, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(expected)-4950, n)
+	suite.assert.Equal(expected[4950:], output[:n])
+
+	// Storage gets the plain text
+	err = suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	stored, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal(expected, stored)
+
+	attr, err := suite.fileCache.GetAttr(internal.GetAttrOptions{Name: file})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(expected), attr.Size)
+
+	// Growing the file fills it with zeros as well
+	err = suite.fileCache.TruncateFile(internal.TruncateFileOptions{Name: file, Size: 6000})
+	suite.assert.Nil(err)
+	output = make([]byte, 6000)
+	n, err = suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(6000, n)
+	suite.assert.Equal(expected, output[:len(expected)])
+	suite.assert.Equal(make([]byte, 6000-len(expected)), output[len(expected):])
+
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheDownload() {
+	defer suite.cleanupTest()
+	suite.setupEncryptedCache()
+
+	file := "file"
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	os.WriteFile(suite.fake_storage_path+"/"+file, data, 0777)
+
+	handle, err := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: file, Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Nil(err)
+	suite.assert.False(handle.Cached())
+	suite.assert.EqualValues(len(data), handle.Size)
+
+	cached, err := os.ReadFile(suite.cache_path + "/" + file)
+	suite.assert.Nil(err)
+	suite.assert.Len(cached, len(data))
+	suite.assert.False(bytes.Contains(cached, []byte("0123456789")))
+
+	output, err := suite.fileCache.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, output)
+
+	output = make([]byte, 7)
+	n, err := suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 9993, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(7, n)
+	suite.assert.Equal(data[9993:], output)
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+
+	// Served from the cache after a rename
+	err = suite.fileCache.RenameFile(internal.RenameFileOptions{Src: file, Dst: "renamed"})
+	suite.assert.Nil(err)
+	handle, err = suite.fileCache.OpenFile(internal.OpenFileOptions{Name: "renamed", Flags: os.O_RDONLY, Mode: 0777})
+	suite.assert.Nil(err)
+	output = make([]byte, 10)
+	_, err = suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 10, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal([]byte("0123456789"), output)
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheLargeFile() {
+	defer suite.cleanupTest()
+	suite.setupEncryptedCache()
+
+	// Spans several chunks, the last one partly
+	file := "file"
+	data := make([]byte, 2*cipherBufferSize+12345)
+	rand.Read(data)
+	os.WriteFile(suite.fake_storage_path+"/"+file, data, 0777)
+
+	handle, err := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: file, Flags: os.O_RDWR, Mode: 0777})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), handle.Size)
+
+	output, err := suite.fileCache.ReadFile(internal.ReadFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	suite.assert.Equal(data, output)
+
+	// Change a range crossing a chunk boundary and upload it again
+	change := bytes.Repeat([]byte{0xaa}, 100)
+	_, err = suite.fileCache.WriteFile(internal.WriteFileOptions{Handle: handle, Offset: cipherBufferSize - 50, Data: change})
+	suite.assert.Nil(err)
+	copy(data[cipherBufferSize-50:], change)
+
+	err = suite.fileCache.FlushFile(internal.FlushFileOptions{Handle: handle})
+	suite.assert.Nil(err)
+	stored, _ := os.ReadFile(suite.fake_storage_path + "/" + file)
+	suite.assert.Equal(data, stored)
+
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: handle})
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheCopyFileRange() {
+	defer suite.cleanupTest()
+	suite.setupEncryptedCache()
+
+	data := []byte("test data")
+	os.WriteFile(suite.fake_storage_path+"/src", data, 0777)
+
+	srcHandle, _ := suite.fileCache.OpenFile(internal.OpenFileOptions{Name: "src", Flags: os.O_RDONLY, Mode: 0777})
+	dstHandle, _ := suite.fileCache.CreateFile(internal.CreateFileOptions{Name: "dst", Mode: 0777})
+	copied, err := suite.fileCache.CopyFileRange(internal.CopyFileRangeOptions{SrcHandle: srcHandle, DstHandle: dstHandle, Size: 1 << 20})
+	suite.assert.Nil(err)
+	suite.assert.EqualValues(len(data), copied)
+
+	output := make([]byte, len(data))
+	n, err := suite.fileCache.ReadInBuffer(internal.ReadInBufferOptions{Handle: dstHandle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(data), n)
+	suite.assert.Equal(data, output)
+
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: srcHandle})
+	suite.fileCache.CloseFile(internal.CloseFileOptions{Handle: dstHandle})
+}
+
+func (suite *fileCacheTestSuite) TestEncryptCacheCleanupOnStart() {
+	defer suite.cleanupTest()
+	suite.loopback.Stop()
+	suite.fileCache.Stop()
+
+	// Files cached by an earlier mount can not be decrypted anymore
+	os.MkdirAll(suite.cache_path, 0777)
+	os.WriteFile(suite.cache_path+"/file", []byte("left over"), 0777)
+	configuration := fmt.Sprintf("file_cache:\n  path: %s\n  encrypt-cache: true\n  allow-non-empty-temp: true\n\nloopbackfs:\n  path: %s",
+		suite.cache_path, suite.fake_storage_path)
+	suite.setupTestHelper(configuration)
+
+	_, err := os.Stat(suite.cache_path + "/file")
+	suite.assert.True(os.IsNotExist(err))
+}
+
 func (suite *fileCacheTestSuite) TestStatFS() {
 	defer suite.cleanupTest()
 	cacheTimeout := 5
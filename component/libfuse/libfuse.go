@@ -36,10 +36,12 @@ package libfuse
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	"github.com/Azure/azure-storage-fuse/v2/common/tracing"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 )
@@ -69,6 +71,7 @@ type Libfuse struct {
 	disableWritebackCache bool
 	ignoreOpenFlags       bool
 	nonEmptyMount         bool
+	fileLocks             bool
 	lsFlags               common.BitMap16
 }
 
@@ -95,6 +98,7 @@ type LibfuseOptions struct {
 	DisableWritebackCache   bool   `config:"disable-writeback-cache" yaml:"-"`
 	IgnoreOpenFlags         bool   `config:"ignore-open-flags" yaml:"ignore-open-flags,omitempty"`
 	nonEmptyMount           bool   `config:"nonempty" yaml:"nonempty,omitempty"`
+	FileLocks               bool   `config:"file-locks" yaml:"file-locks,omitempty"`
 }
 
 const compName = "libfuse"
@@ -137,6 +141,8 @@ func (lf *Libfuse) Start(ctx context.Context) error {
 
 	// create stats collector for libfuse
 	libfuseStatsCollector = stats_manager.NewStatsCollector(lf.Name())
+	// Open handles go down as well, which makes the stat a gauge from the start
+	libfuseStatsCollector.UpdateStats(stats_manager.Replace, openHandles, (int64)(0))
 
 	lf.lsFlags = internal.NewDirBitMap()
 	lf.lsFlags.Set(internal.PropFlagModeDefault)
@@ -154,6 +160,27 @@ func (lf *Libfuse) Start(ctx context.Context) error {
 	return nil
 }
 
+// fuseOperation : a fuse callback in progress
+type fuseOperation struct {
+	name  string
+	start time.Time
+	span  *tracing.Span
+}
+
+// startOperation : Start the span of a fuse callback, returned context is passed down the pipeline in the options.
+// Called as ctx, fuseOp := startOperation(op) followed by defer fuseOp.end()
+func startOperation(op string) (context.Context, *fuseOperation) {
+	// ctx is nil when the operation is not picked by the sampler
+	ctx, span := tracing.StartTrace("libfuse." + op)
+	return ctx, &fuseOperation{name: op, start: time.Now(), span: span}
+}
+
+// end : record the time taken by the callback and end its span
+func (op *fuseOperation) end() {
+	libfuseStatsCollector.ObserveLatency(op.name, time.Since(op.start))
+	op.span.End()
+}
+
 // Stop : Stop the component functionality and kill all threads started
 func (lf *Libfuse) Stop() error {
 	log.Trace("Libfuse::Stop : Stopping component %s", lf.Name())
@@ -172,6 +199,7 @@ func (lf *Libfuse) Validate(opt *LibfuseOptions) error {
 	lf.disableWritebackCache = opt.DisableWritebackCache
 	lf.ignoreOpenFlags = opt.IgnoreOpenFlags
 	lf.nonEmptyMount = opt.nonEmptyMount
+	lf.fileLocks = opt.FileLocks
 
 	if opt.allowOther {
 		lf.dirPermission = uint(common.DefaultAllowOtherPermissionBits)
@@ -257,8 +285,8 @@ func (lf *Libfuse) Configure(_ bool) error {
 		return fmt.Errorf("config error in %s [invalid config settings]", lf.Name())
 	}
 
-	log.Info("Libfuse::Configure : read-only %t, allow-other %t, default-perm %d, entry-timeout %d, attr-time %d, negative-timeout %d, ignore-open-flags: %t, nonempty %t",
-		lf.readOnly, lf.allowOther, lf.filePermission, lf.entryExpiration, lf.attributeExpiration, lf.negativeTimeout, lf.ignoreOpenFlags, lf.nonEmptyMount)
+	log.Info("Libfuse::Configure : read-only %t, allow-other %t, default-perm %d, entry-timeout %d, attr-time %d, negative-timeout %d, ignore-open-flags: %t, nonempty %t, file-locks %t",
+		lf.readOnly, lf.allowOther, lf.filePermission, lf.entryExpiration, lf.attributeExpiration, lf.negativeTimeout, lf.ignoreOpenFlags, lf.nonEmptyMount, lf.fileLocks)
 
 	return nil
 }
@@ -49,10 +49,12 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"strconv"
 	"syscall"
 	"unsafe"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/audit"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
@@ -90,6 +92,69 @@ func trimFusePath(path *C.char) string {
 	return str
 }
 
+// auditOperation records a mutating operation along with the process which asked for it.
+// Deferred by the handlers so that ret holds the result returned to the kernel.
+func auditOperation(ev audit.Event, ret *C.int) {
+	if !audit.Enabled() {
+		return
+	}
+
+	// Still running on the FUSE thread, so the context is the one of this request
+	if caller := C.fuse_get_context(); caller != nil {
+		ev.UID = uint32(caller.uid)
+		ev.GID = uint32(caller.gid)
+		ev.PID = int32(caller.pid)
+	}
+
+	recordAudit(ev, ret)
+}
+
+// Handle value holding the process which opened the file.
+// Release is sent by the kernel once the last reference to the file goes away, its context carries no caller.
+const auditCallerKey = "audit-caller"
+
+type auditCaller struct {
+	uid uint32
+	gid uint32
+	pid int32
+}
+
+// rememberAuditCaller keeps the process opening a file on its handle, to audit the operations done when it is closed.
+func rememberAuditCaller(handle *handlemap.Handle) {
+	if !audit.Enabled() {
+		return
+	}
+
+	if caller := C.fuse_get_context(); caller != nil {
+		handle.SetValue(auditCallerKey, auditCaller{uid: uint32(caller.uid), gid: uint32(caller.gid), pid: int32(caller.pid)})
+	}
+}
+
+// auditHandleOperation records an operation done on behalf of the process which opened the handle.
+func auditHandleOperation(ev audit.Event, handle *handlemap.Handle, ret *C.int) {
+	if !audit.Enabled() {
+		return
+	}
+
+	if val, ok := handle.GetValue(auditCallerKey); ok {
+		caller := val.(auditCaller)
+		ev.UID = caller.uid
+		ev.GID = caller.gid
+		ev.PID = caller.pid
+	}
+
+	recordAudit(ev, ret)
+}
+
+// recordAudit fills in the result of the operation and hands the event to the audit log.
+func recordAudit(ev audit.Event, ret *C.int) {
+	if *ret != 0 {
+		ev.Result = audit.ResultFailure
+		ev.Error = syscall.Errno(-*ret).Error()
+	}
+	audit.Record(ev)
+}
+
 var fuse_opts C.fuse_options_t // nolint
 
 // convertConfig converts the config options from Go to C
@@ -145,6 +210,9 @@ func (lf *Libfuse) initFuse() error {
 		// Get our callback table
 		my_operations := C.fuse_operations_t{}
 		C.populate_callbacks(&my_operations)
+		if lf.fileLocks {
+			C.populate_lock_callbacks(&my_operations)
+		}
 
 		// Send our callback table to the extension
 		errc = C.register_callback_to_extension(&my_operations)
@@ -158,6 +226,10 @@ func (lf *Libfuse) initFuse() error {
 		// Populate our methods to be registered to libfuse
 		log.Trace("Libfuse::initFuse : Registering fuse callbacks")
 		C.populate_callbacks(&operations)
+		if lf.fileLocks {
+			log.Trace("Libfuse::initFuse : Registering lock callbacks")
+			C.populate_lock_callbacks(&operations)
+		}
 	}
 
 	log.Trace("Libfuse::initFuse : Populating fuse arguments")
@@ -322,6 +394,9 @@ func (lf *Libfuse) fillStat(attr *internal.ObjAttr, stbuf *C.stat_t) {
 // libfuse2_getattr gets file attributes
 //export libfuse2_getattr
 func libfuse2_getattr(path *C.char, stbuf *C.stat_t) C.int {
+	ctx, fuseOp := startOperation("getattr")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	//log.Trace("Libfuse::libfuse2_getattr : %s", name)
@@ -338,7 +413,7 @@ func libfuse2_getattr(path *C.char, stbuf *C.stat_t) C.int {
 	}
 
 	// Get attributes
-	attr, err := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: name})
+	attr, err := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		//log.Err("Libfuse::libfuse2_getattr : Failed to get attributes of %s [%s]", name, err.Error())
 		return -C.ENOENT
@@ -352,6 +427,9 @@ func libfuse2_getattr(path *C.char, stbuf *C.stat_t) C.int {
 // File Operations
 //export libfuse_statfs
 func libfuse_statfs(path *C.char, buf *C.statvfs_t) C.int {
+	_, fuseOp := startOperation("statfs")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_statfs : %s", name)
@@ -385,11 +463,14 @@ func libfuse_statfs(path *C.char, buf *C.statvfs_t) C.int {
 // libfuse_mkdir creates a directory
 //export libfuse_mkdir
 func libfuse_mkdir(path *C.char, mode C.mode_t) C.int {
+	ctx, fuseOp := startOperation("mkdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_mkdir : %s", name)
 
-	err := fuseFS.NextComponent().CreateDir(internal.CreateDirOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff)})
+	err := fuseFS.NextComponent().CreateDir(internal.CreateDirOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_mkdir : Failed to create %s [%s]", name, err.Error())
 		return -C.EIO
@@ -404,6 +485,9 @@ func libfuse_mkdir(path *C.char, mode C.mode_t) C.int {
 // libfuse_opendir opens handle to given directory
 //export libfuse_opendir
 func libfuse_opendir(path *C.char, fi *C.fuse_file_info_t) C.int {
+	_, fuseOp := startOperation("opendir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	if name != "" {
@@ -432,6 +516,9 @@ func libfuse_opendir(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse_releasedir opens handle to given directory
 //export libfuse_releasedir
 func libfuse_releasedir(path *C.char, fi *C.fuse_file_info_t) C.int {
+	_, fuseOp := startOperation("releasedir")
+	defer fuseOp.end()
+
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fi.fh)))
 	log.Trace("Libfuse::libfuse_releasedir : %s, handle: %d", handle.Path, handle.ID)
 
@@ -443,6 +530,9 @@ func libfuse_releasedir(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse2_readdir reads a directory
 //export libfuse2_readdir
 func libfuse2_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, off C.off_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("readdir")
+	defer fuseOp.end()
+
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fi.fh)))
 	val, found := handle.GetValue("cache")
 	if !found {
@@ -458,6 +548,7 @@ func libfuse2_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, o
 			Offset: off_64,
 			Token:  cacheInfo.token,
 			Count:  common.MaxDirListCount,
+			Ctx:    ctx,
 		})
 
 		if err != nil {
@@ -508,17 +599,21 @@ func libfuse2_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, o
 
 // libfuse_rmdir deletes a directory, which must be empty.
 //export libfuse_rmdir
-func libfuse_rmdir(path *C.char) C.int {
+func libfuse_rmdir(path *C.char) (ret C.int) {
+	ctx, fuseOp := startOperation("rmdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_rmdir : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpRmdir, Path: name}, &ret)
 
-	empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: name})
+	empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: name, Ctx: ctx})
 	if !empty {
 		return -C.ENOTEMPTY
 	}
 
-	err := fuseFS.NextComponent().DeleteDir(internal.DeleteDirOptions{Name: name})
+	err := fuseFS.NextComponent().DeleteDir(internal.DeleteDirOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_rmdir : Failed to delete %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -538,12 +633,16 @@ func libfuse_rmdir(path *C.char) C.int {
 
 // libfuse_create creates a file with the specified mode and then opens it.
 //export libfuse_create
-func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
+func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("create")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_create : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpCreate, Path: name, Mode: fmt.Sprintf("%04o", uint32(mode)&07777)}, &ret)
 
-	handle, err := fuseFS.NextComponent().CreateFile(internal.CreateFileOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff)})
+	handle, err := fuseFS.NextComponent().CreateFile(internal.CreateFileOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_create : Failed to create %s [%s]", name, err.Error())
 		if os.IsExist(err) {
@@ -554,6 +653,7 @@ func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
 	}
 
 	handlemap.Add(handle)
+	rememberAuditCaller(handle)
 	ret_val := C.allocate_native_file_object(C.ulong(handle.UnixFD), C.ulong(uintptr(unsafe.Pointer(handle))), 0)
 	if !handle.Cached() {
 		ret_val.fd = 0
@@ -572,6 +672,9 @@ func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
 // libfuse_open opens a file
 //export libfuse_open
 func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("open")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_open : %s", name)
@@ -592,6 +695,7 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 			Name:  name,
 			Flags: int(int(fi.flags) & 0xffffffff),
 			Mode:  fs.FileMode(fuseFS.filePermission),
+			Ctx:   ctx,
 		})
 
 	if err != nil {
@@ -604,6 +708,7 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 	}
 
 	handlemap.Add(handle)
+	rememberAuditCaller(handle)
 	ret_val := C.allocate_native_file_object(C.ulong(handle.UnixFD), C.ulong(uintptr(unsafe.Pointer(handle))), C.ulong(handle.Size))
 	if !handle.Cached() {
 		ret_val.fd = 0
@@ -620,6 +725,9 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse_read reads data from an open file
 //export libfuse_read
 func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("read")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -638,6 +746,7 @@ func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.f
 				Handle: handle,
 				Offset: int64(offset),
 				Data:   data[:size],
+				Ctx:    ctx,
 			})
 	}
 
@@ -655,6 +764,9 @@ func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.f
 // libfuse_write writes data to an open file
 //export libfuse_write
 func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("write")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -666,6 +778,7 @@ func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.
 			Offset:   int64(offset),
 			Data:     data[:size],
 			Metadata: nil,
+			Ctx:      ctx,
 		})
 
 	if err != nil {
@@ -679,6 +792,9 @@ func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.
 // libfuse_flush possibly flushes cached data
 //export libfuse_flush
 func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("flush")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -693,9 +809,13 @@ func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
 		return 0
 	}
 
-	err := fuseFS.NextComponent().FlushFile(internal.FlushFileOptions{Handle: handle})
+	err := fuseFS.NextComponent().FlushFile(internal.FlushFileOptions{Handle: handle, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_flush : error flushing file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ESTALE {
+			// File was changed by another writer and conflict policy asked to fail the upload
+			return -C.ESTALE
+		}
 		return -C.EIO
 	}
 
@@ -704,13 +824,17 @@ func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
 
 // libfuse2_truncate changes the size of a file
 //export libfuse2_truncate
-func libfuse2_truncate(path *C.char, off C.off_t) C.int {
+func libfuse2_truncate(path *C.char, off C.off_t) (ret C.int) {
+	ctx, fuseOp := startOperation("truncate")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
+	defer auditOperation(audit.Event{Operation: audit.OpTruncate, Path: name, Size: strconv.FormatInt(int64(off), 10)}, &ret)
 
 	log.Trace("Libfuse::libfuse2_truncate : %s size %d", name, off)
 
-	err := fuseFS.NextComponent().TruncateFile(internal.TruncateFileOptions{Name: name, Size: int64(off)})
+	err := fuseFS.NextComponent().TruncateFile(internal.TruncateFileOptions{Name: name, Size: int64(off), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse2_truncate : error truncating file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -727,7 +851,10 @@ func libfuse2_truncate(path *C.char, off C.off_t) C.int {
 
 // libfuse_release releases an open file
 //export libfuse_release
-func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
+func libfuse_release(path *C.char, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("release")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 	log.Trace("Libfuse::libfuse_release : %s, handle: %d", handle.Path, handle.ID)
@@ -737,9 +864,24 @@ func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
 		handle.Flags.Set(handlemap.HandleFlagDirty)
 	}
 
-	err := fuseFS.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle})
+	// Data written through the handle goes to storage on close
+	if handle.Dirty() {
+		defer auditHandleOperation(audit.Event{Operation: audit.OpWriteClose, Path: handle.Path}, handle, &ret)
+	}
+
+	err := fuseFS.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle, Ctx: ctx})
+
+	// Locks die with the handle, the lease behind an exclusive one has to be given up as well
+	if fuseFS.fileLocks {
+		_ = fuseFS.NextComponent().LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock, Ctx: ctx})
+	}
+
 	if err != nil {
 		log.Err("Libfuse::libfuse_release : error closing file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ESTALE {
+			// File was changed by another writer and conflict policy asked to fail the upload
+			return -C.ESTALE
+		}
 		return -C.EIO
 	}
 
@@ -752,14 +894,136 @@ func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
 	return 0
 }
 
+// lockInterrupted reports a blocking lock request was interrupted by a signal to the process waiting on it.
+// Lock requests wait in the callback itself, which stays on the FUSE thread serving the request as libfuse looks it up from there.
+func lockInterrupted() bool {
+	return C.fuse_interrupted() != 0
+}
+
+// libfuse_flock applies a flock(2) request on an open file
+//export libfuse_flock
+func libfuse_flock(path *C.char, fi *C.fuse_file_info_t, op C.int) C.int {
+	ctx, fuseOp := startOperation("flock")
+	defer fuseOp.end()
+
+	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
+	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
+
+	options := internal.LockFileOptions{
+		Handle:      handle,
+		Wait:        int(op)&syscall.LOCK_NB == 0,
+		Ctx:         ctx,
+		Interrupted: lockInterrupted,
+	}
+
+	switch int(op) &^ syscall.LOCK_NB {
+	case syscall.LOCK_SH:
+		options.Type = internal.LockShared
+	case syscall.LOCK_EX:
+		options.Type = internal.LockExclusive
+	case syscall.LOCK_UN:
+		options.Type = internal.LockUnlock
+	default:
+		return -C.EINVAL
+	}
+
+	log.Trace("Libfuse::libfuse_flock : %s, handle: %d, op %d", handle.Path, handle.ID, op)
+
+	err := fuseFS.NextComponent().LockFile(options)
+	if err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return -C.EWOULDBLOCK
+		}
+		if err == syscall.EINTR {
+			return -C.EINTR
+		}
+		log.Err("Libfuse::libfuse_flock : error locking file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ENOTSUP {
+			return -C.EOPNOTSUPP
+		}
+		return -C.EIO
+	}
+
+	return 0
+}
+
+// libfuse_lock applies a fcntl(2) record lock request on an open file.
+// Record locks are taken on the whole file as the lease backing them covers the whole blob.
+//export libfuse_lock
+func libfuse_lock(path *C.char, fi *C.fuse_file_info_t, cmd C.int, lock *C.struct_flock) C.int {
+	ctx, fuseOp := startOperation("lock")
+	defer fuseOp.end()
+
+	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
+	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
+
+	options := internal.LockFileOptions{Handle: handle, Ctx: ctx, Interrupted: lockInterrupted}
+
+	switch cmd {
+	case C.F_GETLK:
+		options.Test = true
+	case C.F_SETLK:
+	case C.F_SETLKW:
+		options.Wait = true
+	default:
+		return -C.EINVAL
+	}
+
+	switch lock.l_type {
+	case C.F_RDLCK:
+		options.Type = internal.LockShared
+	case C.F_WRLCK:
+		options.Type = internal.LockExclusive
+	case C.F_UNLCK:
+		options.Type = internal.LockUnlock
+	default:
+		return -C.EINVAL
+	}
+
+	log.Trace("Libfuse::libfuse_lock : %s, handle: %d, cmd %d, type %d", handle.Path, handle.ID, cmd, lock.l_type)
+
+	err := fuseFS.NextComponent().LockFile(options)
+	if options.Test {
+		// F_GETLK reports the conflicting lock in place of the requested one, the holder is not known here
+		if err == nil {
+			lock.l_type = C.F_UNLCK
+			return 0
+		} else if err == syscall.EWOULDBLOCK {
+			lock.l_type = C.F_WRLCK
+			lock.l_pid = 0
+			return 0
+		}
+	}
+
+	if err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return -C.EAGAIN
+		}
+		if err == syscall.EINTR {
+			return -C.EINTR
+		}
+		log.Err("Libfuse::libfuse_lock : error locking file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ENOTSUP {
+			return -C.EOPNOTSUPP
+		}
+		return -C.EIO
+	}
+
+	return 0
+}
+
 // libfuse_unlink removes a file
 //export libfuse_unlink
-func libfuse_unlink(path *C.char) C.int {
+func libfuse_unlink(path *C.char) (ret C.int) {
+	ctx, fuseOp := startOperation("unlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_unlink : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpUnlink, Path: name}, &ret)
 
-	err := fuseFS.NextComponent().DeleteFile(internal.DeleteFileOptions{Name: name})
+	err := fuseFS.NextComponent().DeleteFile(internal.DeleteFileOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_unlink : error deleting file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -779,12 +1043,16 @@ func libfuse_unlink(path *C.char) C.int {
 // errors handled: EISDIR, ENOENT, ENOTDIR, ENOTEMPTY, EEXIST
 // TODO: handle EACCESS, EINVAL?
 //export libfuse2_rename
-func libfuse2_rename(src *C.char, dst *C.char) C.int {
+func libfuse2_rename(src *C.char, dst *C.char) (ret C.int) {
+	ctx, fuseOp := startOperation("rename")
+	defer fuseOp.end()
+
 	srcPath := trimFusePath(src)
 	srcPath = common.NormalizeObjectName(srcPath)
 	dstPath := trimFusePath(dst)
 	dstPath = common.NormalizeObjectName(dstPath)
 	log.Trace("Libfuse::libfuse2_rename : %s -> %s", srcPath, dstPath)
+	defer auditOperation(audit.Event{Operation: audit.OpRename, Path: srcPath, Target: dstPath}, &ret)
 	// Note: When running other commands from the command line, a lot of them seemed to handle some cases like ENOENT themselves.
 	// Rename did not, so we manually check here.
 
@@ -794,12 +1062,12 @@ func libfuse2_rename(src *C.char, dst *C.char) C.int {
 		return -C.ENOENT
 	}
 
-	srcAttr, srcErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: srcPath})
+	srcAttr, srcErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: srcPath, Ctx: ctx})
 	if os.IsNotExist(srcErr) {
 		log.Err("Libfuse::libfuse2_rename : Failed to get attributes of %s [%s]", srcPath, srcErr.Error())
 		return -C.ENOENT
 	}
-	dstAttr, dstErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: dstPath})
+	dstAttr, dstErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: dstPath, Ctx: ctx})
 
 	// EISDIR
 	if (dstErr == nil || os.IsExist(dstErr)) && dstAttr.IsDir() && !srcAttr.IsDir() {
@@ -816,13 +1084,13 @@ func libfuse2_rename(src *C.char, dst *C.char) C.int {
 	if srcAttr.IsDir() {
 		// ENOTEMPTY
 		if dstErr == nil || os.IsExist(dstErr) {
-			empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: dstPath})
+			empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: dstPath, Ctx: ctx})
 			if !empty {
 				return -C.ENOTEMPTY
 			}
 		}
 
-		err := fuseFS.NextComponent().RenameDir(internal.RenameDirOptions{Src: srcPath, Dst: dstPath})
+		err := fuseFS.NextComponent().RenameDir(internal.RenameDirOptions{Src: srcPath, Dst: dstPath, Ctx: ctx})
 		if err != nil {
 			log.Err("Libfuse::libfuse2_rename : error renaming directory %s -> %s [%s]", srcPath, dstPath, err.Error())
 			return -C.EIO
@@ -832,7 +1100,7 @@ func libfuse2_rename(src *C.char, dst *C.char) C.int {
 		libfuseStatsCollector.UpdateStats(stats_manager.Increment, renameDir, (int64)(1))
 
 	} else {
-		err := fuseFS.NextComponent().RenameFile(internal.RenameFileOptions{Src: srcPath, Dst: dstPath})
+		err := fuseFS.NextComponent().RenameFile(internal.RenameFileOptions{Src: srcPath, Dst: dstPath, Ctx: ctx})
 		if err != nil {
 			log.Err("Libfuse::libfuse2_rename : error renaming file %s -> %s [%s]", srcPath, dstPath, err.Error())
 			return -C.EIO
@@ -851,13 +1119,16 @@ func libfuse2_rename(src *C.char, dst *C.char) C.int {
 // libfuse_symlink creates a symbolic link
 //export libfuse_symlink
 func libfuse_symlink(target *C.char, link *C.char) C.int {
+	ctx, fuseOp := startOperation("symlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(link)
 	name = common.NormalizeObjectName(name)
 	targetPath := C.GoString(target)
 	targetPath = common.NormalizeObjectName(targetPath)
 	log.Trace("Libfuse::libfuse_symlink : Received for %s -> %s", name, targetPath)
 
-	err := fuseFS.NextComponent().CreateLink(internal.CreateLinkOptions{Name: name, Target: targetPath})
+	err := fuseFS.NextComponent().CreateLink(internal.CreateLinkOptions{Name: name, Target: targetPath, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_symlink : error linking file %s -> %s [%s]", name, targetPath, err.Error())
 		return -C.EIO
@@ -872,11 +1143,14 @@ func libfuse_symlink(target *C.char, link *C.char) C.int {
 // libfuse_readlink reads the target of a symbolic link
 //export libfuse_readlink
 func libfuse_readlink(path *C.char, buf *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("readlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	//log.Trace("Libfuse::libfuse_readlink : Received for %s", name)
 
-	targetPath, err := fuseFS.NextComponent().ReadLink(internal.ReadLinkOptions{Name: name})
+	targetPath, err := fuseFS.NextComponent().ReadLink(internal.ReadLinkOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_readlink : error reading link file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -897,6 +1171,9 @@ func libfuse_readlink(path *C.char, buf *C.char, size C.size_t) C.int {
 // libfuse_fsync synchronizes file contents
 //export libfuse_fsync
 func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("fsync")
+	defer fuseOp.end()
+
 	if fi.fh == 0 {
 		return C.int(-C.EIO)
 	}
@@ -905,7 +1182,7 @@ func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 	log.Trace("Libfuse::libfuse_fsync : %s, handle: %d", handle.Path, handle.ID)
 
-	options := internal.SyncFileOptions{Handle: handle}
+	options := internal.SyncFileOptions{Handle: handle, Ctx: ctx}
 	// If the datasync parameter is non-zero, then only the user data should be flushed, not the metadata.
 	// TODO : Should we support this?
 
@@ -924,11 +1201,14 @@ func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
 // libfuse_fsyncdir synchronizes directory contents
 //export libfuse_fsyncdir
 func libfuse_fsyncdir(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("fsyncdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_fsyncdir : %s", name)
 
-	options := internal.SyncDirOptions{Name: name}
+	options := internal.SyncDirOptions{Name: name, Ctx: ctx}
 	// If the datasync parameter is non-zero, then only the user data should be flushed, not the metadata.
 	// TODO : Should we support this?
 
@@ -946,15 +1226,20 @@ func libfuse_fsyncdir(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.in
 
 // libfuse2_chmod changes permission bits of a file
 //export libfuse2_chmod
-func libfuse2_chmod(path *C.char, mode C.mode_t) C.int {
+func libfuse2_chmod(path *C.char, mode C.mode_t) (ret C.int) {
+	ctx, fuseOp := startOperation("chmod")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse2_chmod : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpChmod, Path: name, Mode: fmt.Sprintf("%04o", uint32(mode)&07777)}, &ret)
 
 	err := fuseFS.NextComponent().Chmod(
 		internal.ChmodOptions{
 			Name: name,
 			Mode: fs.FileMode(uint32(mode) & 0xffffffff),
+			Ctx:  ctx,
 		})
 	if err != nil {
 		log.Err("Libfuse::libfuse2_chmod : error in chmod of %s [%s]", name, err.Error())
@@ -972,10 +1257,14 @@ func libfuse2_chmod(path *C.char, mode C.mode_t) C.int {
 
 // libfuse2_chown changes the owner and group of a file
 //export libfuse2_chown
-func libfuse2_chown(path *C.char, uid C.uid_t, gid C.gid_t) C.int {
+func libfuse2_chown(path *C.char, uid C.uid_t, gid C.gid_t) (ret C.int) {
+	_, fuseOp := startOperation("chown")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse2_chown : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpChown, Path: name, Owner: fmt.Sprintf("%d:%d", uint32(uid), uint32(gid))}, &ret)
 	// TODO: Implement
 	return 0
 }
@@ -983,6 +1272,9 @@ func libfuse2_chown(path *C.char, uid C.uid_t, gid C.gid_t) C.int {
 // libfuse2_utimens changes the access and modification times of a file
 //export libfuse2_utimens
 func libfuse2_utimens(path *C.char, tv *C.timespec_t) C.int {
+	_, fuseOp := startOperation("utimens")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse2_utimens : %s", name)
@@ -992,6 +1284,165 @@ func libfuse2_utimens(path *C.char, tv *C.timespec_t) C.int {
 	return 0
 }
 
+// xattrErrorCode maps the error of an extended attribute operation to the errno returned to the kernel
+func xattrErrorCode(err error) C.int {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ENOENT, syscall.ENODATA, syscall.ENOTSUP, syscall.EEXIST,
+			syscall.EPERM, syscall.EINVAL, syscall.ERANGE, syscall.E2BIG, syscall.ENOSPC:
+			return -C.int(errno)
+		}
+	}
+
+	if os.IsNotExist(err) {
+		return -C.ENOENT
+	}
+	return -C.EIO
+}
+
+// libfuse_getxattr reads the value of an extended attribute
+//export libfuse_getxattr
+func libfuse_getxattr(path *C.char, name *C.char, value *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("getxattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_getxattr : %s of %s", attr, objName)
+
+	// Root of the mount does not map to any object in storage
+	if objName == "" {
+		return -C.ENODATA
+	}
+
+	data, err := fuseFS.NextComponent().GetXattr(internal.GetXattrOptions{Name: objName, Attr: attr, Ctx: ctx})
+	if err != nil {
+		code := xattrErrorCode(err)
+		if code == -C.EIO {
+			log.Err("Libfuse::libfuse_getxattr : error getting %s of %s [%s]", attr, objName, err.Error())
+		}
+		return code
+	}
+
+	// Zero size is a query for the size of the buffer required to hold the value
+	if size == 0 {
+		return C.int(len(data))
+	}
+	if len(data) > int(size) {
+		return -C.ERANGE
+	}
+	if len(data) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(value))[:len(data):len(data)], data)
+	}
+
+	return C.int(len(data))
+}
+
+// libfuse_listxattr lists the names of extended attributes as a sequence of null terminated strings
+//export libfuse_listxattr
+func libfuse_listxattr(path *C.char, list *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("listxattr")
+	defer fuseOp.end()
+
+	name := trimFusePath(path)
+	name = common.NormalizeObjectName(name)
+	log.Trace("Libfuse::libfuse_listxattr : %s", name)
+
+	if name == "" {
+		return 0
+	}
+
+	attrs, err := fuseFS.NextComponent().ListXattr(internal.ListXattrOptions{Name: name, Ctx: ctx})
+	if err != nil {
+		code := xattrErrorCode(err)
+		if code == -C.EIO {
+			log.Err("Libfuse::libfuse_listxattr : error listing attributes of %s [%s]", name, err.Error())
+		}
+		return code
+	}
+
+	data := make([]byte, 0)
+	for _, attr := range attrs {
+		data = append(data, attr...)
+		data = append(data, 0)
+	}
+
+	if size == 0 {
+		return C.int(len(data))
+	}
+	if len(data) > int(size) {
+		return -C.ERANGE
+	}
+	if len(data) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(list))[:len(data):len(data)], data)
+	}
+
+	return C.int(len(data))
+}
+
+// libfuse_setxattr sets the value of an extended attribute
+//export libfuse_setxattr
+func libfuse_setxattr(path *C.char, name *C.char, value *C.char, size C.size_t, flags C.int) C.int {
+	ctx, fuseOp := startOperation("setxattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_setxattr : %s of %s", attr, objName)
+
+	if objName == "" {
+		return -C.ENOTSUP
+	}
+
+	err := fuseFS.NextComponent().SetXattr(
+		internal.SetXattrOptions{
+			Name:  objName,
+			Attr:  attr,
+			Value: C.GoBytes(unsafe.Pointer(value), C.int(size)),
+			Flags: int(flags),
+			Ctx:   ctx,
+		})
+	if err != nil {
+		log.Err("Libfuse::libfuse_setxattr : error setting %s of %s [%s]", attr, objName, err.Error())
+		return xattrErrorCode(err)
+	}
+
+	libfuseStatsCollector.PushEvents(setXattr, objName, map[string]interface{}{xattr: attr})
+	libfuseStatsCollector.UpdateStats(stats_manager.Increment, setXattr, (int64)(1))
+
+	return 0
+}
+
+// libfuse_removexattr removes an extended attribute
+//export libfuse_removexattr
+func libfuse_removexattr(path *C.char, name *C.char) C.int {
+	ctx, fuseOp := startOperation("removexattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_removexattr : %s of %s", attr, objName)
+
+	if objName == "" {
+		return -C.ENOTSUP
+	}
+
+	err := fuseFS.NextComponent().RemoveXattr(internal.RemoveXattrOptions{Name: objName, Attr: attr, Ctx: ctx})
+	if err != nil {
+		log.Err("Libfuse::libfuse_removexattr : error removing %s of %s [%s]", attr, objName, err.Error())
+		return xattrErrorCode(err)
+	}
+
+	libfuseStatsCollector.PushEvents(removeXattr, objName, map[string]interface{}{xattr: attr})
+	libfuseStatsCollector.UpdateStats(stats_manager.Increment, removeXattr, (int64)(1))
+
+	return 0
+}
+
 // blobfuse_cache_update refresh the file-cache policy for this file
 //export blobfuse_cache_update
 func blobfuse_cache_update(path *C.char) C.int {
@@ -41,7 +41,9 @@ package libfuse
 import "C"
 import (
 	"errors"
+	"fmt"
 	"io/fs"
+	"reflect"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -668,3 +670,192 @@ func testUtimens(suite *libfuseTestSuite) {
 	err := libfuse2_utimens(path, nil)
 	suite.assert.Equal(C.int(0), err)
 }
+
+func testGetXattr(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	attr := C.CString("user.source")
+	defer C.free(unsafe.Pointer(attr))
+	options := internal.GetXattrOptions{Name: name, Attr: "user.source"}
+	suite.mock.EXPECT().GetXattr(options).Return([]byte("pipeline"), nil).Times(3)
+
+	// Query the size first as getxattr(2) callers do
+	err := libfuse_getxattr(path, attr, nil, 0)
+	suite.assert.Equal(C.int(8), err)
+
+	buf := (*C.char)(C.malloc(8))
+	defer C.free(unsafe.Pointer(buf))
+	err = libfuse_getxattr(path, attr, buf, 8)
+	suite.assert.Equal(C.int(8), err)
+	suite.assert.Equal([]byte("pipeline"), C.GoBytes(unsafe.Pointer(buf), 8))
+
+	err = libfuse_getxattr(path, attr, buf, 4)
+	suite.assert.Equal(C.int(-C.ERANGE), err)
+}
+
+func testGetXattrNotExists(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	attr := C.CString("user.source")
+	defer C.free(unsafe.Pointer(attr))
+	options := internal.GetXattrOptions{Name: name, Attr: "user.source"}
+	suite.mock.EXPECT().GetXattr(options).Return(nil, syscall.ENODATA)
+
+	err := libfuse_getxattr(path, attr, nil, 0)
+	suite.assert.Equal(C.int(-C.ENODATA), err)
+
+	suite.mock.EXPECT().GetXattr(options).Return(nil, syscall.ENOENT)
+	err = libfuse_getxattr(path, attr, nil, 0)
+	suite.assert.Equal(C.int(-C.ENOENT), err)
+
+	suite.mock.EXPECT().GetXattr(options).Return(nil, errors.New("failed to get attribute"))
+	err = libfuse_getxattr(path, attr, nil, 0)
+	suite.assert.Equal(C.int(-C.EIO), err)
+}
+
+func testListXattr(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	options := internal.ListXattrOptions{Name: name}
+	suite.mock.EXPECT().ListXattr(options).Return([]string{"user.a", "user.bc"}, nil).Times(2)
+
+	err := libfuse_listxattr(path, nil, 0)
+	suite.assert.Equal(C.int(15), err)
+
+	buf := (*C.char)(C.malloc(15))
+	defer C.free(unsafe.Pointer(buf))
+	err = libfuse_listxattr(path, buf, 15)
+	suite.assert.Equal(C.int(15), err)
+	suite.assert.Equal([]byte("user.a\x00user.bc\x00"), C.GoBytes(unsafe.Pointer(buf), 15))
+}
+
+func testSetXattr(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	attr := C.CString("user.source")
+	defer C.free(unsafe.Pointer(attr))
+	value := C.CString("pipeline")
+	defer C.free(unsafe.Pointer(value))
+	options := internal.SetXattrOptions{Name: name, Attr: "user.source", Value: []byte("pipeline"), Flags: internal.XattrCreate}
+	suite.mock.EXPECT().SetXattr(options).Return(nil)
+
+	err := libfuse_setxattr(path, attr, value, 8, internal.XattrCreate)
+	suite.assert.Equal(C.int(0), err)
+
+	suite.mock.EXPECT().SetXattr(options).Return(syscall.EEXIST)
+	err = libfuse_setxattr(path, attr, value, 8, internal.XattrCreate)
+	suite.assert.Equal(C.int(-C.EEXIST), err)
+}
+
+func testRemoveXattr(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	attr := C.CString("security.selinux")
+	defer C.free(unsafe.Pointer(attr))
+	options := internal.RemoveXattrOptions{Name: name, Attr: "security.selinux"}
+	suite.mock.EXPECT().RemoveXattr(options).Return(syscall.ENOTSUP)
+
+	err := libfuse_removexattr(path, attr)
+	suite.assert.Equal(C.int(-C.ENOTSUP), err)
+}
+
+// testCopyFileRange : fuse2 has no copy_file_range, the kernel always copies through read and write
+func testCopyFileRange(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+}
+
+// lockRequestMatcher : lock request handed down by flock and fcntl, those carry a check for interrupts which can not be compared
+type lockRequestMatcher struct {
+	options internal.LockFileOptions
+}
+
+func lockRequest(options internal.LockFileOptions) gomock.Matcher {
+	return lockRequestMatcher{options: options}
+}
+
+func (m lockRequestMatcher) Matches(x interface{}) bool {
+	options, ok := x.(internal.LockFileOptions)
+	if !ok || options.Interrupted == nil {
+		return false
+	}
+	options.Interrupted = nil
+	return reflect.DeepEqual(options, m.options)
+}
+
+func (m lockRequestMatcher) String() string {
+	return fmt.Sprintf("is lock request %v with interrupt check", m.options)
+}
+
+func testFileLock(suite *libfuseTestSuite) {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	suite.setupTestHelper("libfuse:\n  file-locks: true\n")
+	suite.assert.True(suite.libfuse.fileLocks)
+
+	name := "path"
+	path := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(path))
+	mode := fs.FileMode(fuseFS.filePermission)
+	info := &C.fuse_file_info_t{}
+	info.flags = C.O_RDWR
+	options := internal.OpenFileOptions{Name: name, Flags: C.O_RDWR & 0xffffffff, Mode: mode}
+	suite.mock.EXPECT().OpenFile(options).Return(handlemap.NewHandle(name), nil)
+	libfuse_open(path, info)
+	fobj := (*C.file_handle_t)(unsafe.Pointer(uintptr(info.fh)))
+	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fobj.obj)))
+
+	// flock
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true})).Return(nil)
+	suite.assert.Equal(C.int(0), libfuse_flock(path, info, C.int(syscall.LOCK_EX)))
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockShared})).Return(syscall.EWOULDBLOCK)
+	suite.assert.Equal(C.int(-C.EWOULDBLOCK), libfuse_flock(path, info, C.int(syscall.LOCK_SH|syscall.LOCK_NB)))
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock, Wait: true})).Return(nil)
+	suite.assert.Equal(C.int(0), libfuse_flock(path, info, C.int(syscall.LOCK_UN)))
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive})).Return(syscall.ENOTSUP)
+	suite.assert.Equal(C.int(-C.EOPNOTSUPP), libfuse_flock(path, info, C.int(syscall.LOCK_EX|syscall.LOCK_NB)))
+
+	// fcntl
+	lock := &C.struct_flock{l_type: C.F_WRLCK}
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true})).Return(nil)
+	suite.assert.Equal(C.int(0), libfuse_lock(path, info, C.F_SETLKW, lock))
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive})).Return(syscall.EWOULDBLOCK)
+	suite.assert.Equal(C.int(-C.EAGAIN), libfuse_lock(path, info, C.F_SETLK, lock))
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive})).Return(errors.New("failed"))
+	suite.assert.Equal(C.int(-C.EIO), libfuse_lock(path, info, C.F_SETLK, lock))
+
+	// Signal to the waiting process ends the wait
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true})).Return(syscall.EINTR)
+	suite.assert.Equal(C.int(-C.EINTR), libfuse_lock(path, info, C.F_SETLKW, lock))
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Wait: true})).Return(syscall.EINTR)
+	suite.assert.Equal(C.int(-C.EINTR), libfuse_flock(path, info, C.int(syscall.LOCK_EX)))
+
+	// F_GETLK reports whether the lock could be taken
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockShared, Test: true})).Return(syscall.EWOULDBLOCK)
+	lock.l_type = C.F_RDLCK
+	suite.assert.Equal(C.int(0), libfuse_lock(path, info, C.F_GETLK, lock))
+	suite.assert.EqualValues(C.F_WRLCK, lock.l_type)
+
+	suite.mock.EXPECT().LockFile(lockRequest(internal.LockFileOptions{Handle: handle, Type: internal.LockExclusive, Test: true})).Return(nil)
+	suite.assert.Equal(C.int(0), libfuse_lock(path, info, C.F_GETLK, lock))
+	suite.assert.EqualValues(C.F_UNLCK, lock.l_type)
+
+	// Locks go away on release
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	suite.mock.EXPECT().LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock}).Return(nil)
+	suite.assert.Equal(C.int(0), libfuse_release(path, info))
+}
@@ -41,11 +41,14 @@ const (
 	deleteFile   = "DeleteFile"
 	renameDir    = "RenameDir"
 	renameFile   = "RenameFile"
+	copyFile     = "CopyFileRange"
 	createLink   = "CreateLink"
 	readLink     = "ReadLink"
 	syncFile     = "SyncFile"
 	syncDir      = "SyncDir"
 	chmod        = "Chmod"
+	setXattr     = "SetXattr"
+	removeXattr  = "RemoveXattr"
 
 	openHandles = "OpenFileHandles"
 	md          = "Mode"
@@ -53,4 +56,5 @@ const (
 	source      = "Src"
 	dest        = "Dest"
 	trgt        = "Target"
+	xattr       = "Xattr"
 )
@@ -114,6 +114,15 @@ extern int libfuse_readlink(char *path, char *buf, size_t size);
 extern int libfuse_fsync(char *path, int, fuse_file_info_t *fi);
 extern int libfuse_fsyncdir(char *path, int, fuse_file_info_t *);
 
+extern int libfuse_getxattr(char *path, char *name, char *value, size_t size);
+extern int libfuse_listxattr(char *path, char *list, size_t size);
+extern int libfuse_setxattr(char *path, char *name, char *value, size_t size, int flags);
+extern int libfuse_removexattr(char *path, char *name);
+
+// Registered only when file locks are shared with other mounts, else the kernel keeps locks local
+extern int libfuse_lock(char *path, fuse_file_info_t *fi, int cmd, struct flock *lock);
+extern int libfuse_flock(char *path, fuse_file_info_t *fi, int op);
+
 // chmod, chown and utimens are lib version specific so defined later
 
 #ifdef __FUSE2__
@@ -134,6 +143,8 @@ extern int libfuse_rename(char *src, char *dst, unsigned int flags);
 extern int libfuse_chmod(char *path, mode_t mode, fuse_file_info_t *fi);
 extern int libfuse_chown(char *path, uid_t uid, gid_t gid, fuse_file_info_t *fi);
 extern int libfuse_utimens(char *path, timespec_t tv[2], fuse_file_info_t *fi);
+extern ssize_t libfuse_copy_file_range(char *path_in, fuse_file_info_t *fi_in, off_t off_in,
+                                       char *path_out, fuse_file_info_t *fi_out, off_t off_out, size_t size, int flags);
 #endif
 
 // Methods that needs handling in the CGo wrapper for better performance
@@ -148,10 +159,6 @@ static int native_flush_file(char *path, fuse_file_info_t *fi);
 
 // extern int libfuse_mknod(char *path, mode_t mode, dev_t dev);
 // extern int libfuse_link(char *from, char *to);
-// extern int libfuse_setxattr(char *path, char *name, char *value, size_t size, int flags);
-// extern int libfuse_getxattr(char *path, char *name, char *value, size_t size);
-// extern int libfuse_listxattr(char* path, char *list, size_t size);
-// extern int libfuse_removexattr(char *path, char *name);
 // extern int libfuse_access(char *path, int mask);
 // extern int libfuse_lock
 // extern int libfuse_bmap
@@ -161,7 +168,6 @@ static int native_flush_file(char *path, fuse_file_info_t *fi);
 // extern int libfuse_read_buf
 // extern int libfuse_flock
 // extern int libfuse_fallocate
-// extern int libfuse_copyfilerange
 // extern int libfuse_lseek
 // -------------------------------------------------------------------------------------------------------------
 
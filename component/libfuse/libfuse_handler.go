@@ -50,10 +50,12 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"strconv"
 	"syscall"
 	"unsafe"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/audit"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
@@ -90,6 +92,69 @@ func trimFusePath(path *C.char) string {
 	return str
 }
 
+// auditOperation records a mutating operation along with the process which asked for it.
+// Deferred by the handlers so that ret holds the result returned to the kernel.
+func auditOperation(ev audit.Event, ret *C.int) {
+	if !audit.Enabled() {
+		return
+	}
+
+	// Still running on the FUSE thread, so the context is the one of this request
+	if caller := C.fuse_get_context(); caller != nil {
+		ev.UID = uint32(caller.uid)
+		ev.GID = uint32(caller.gid)
+		ev.PID = int32(caller.pid)
+	}
+
+	recordAudit(ev, ret)
+}
+
+// Handle value holding the process which opened the file.
+// Release is sent by the kernel once the last reference to the file goes away, its context carries no caller.
+const auditCallerKey = "audit-caller"
+
+type auditCaller struct {
+	uid uint32
+	gid uint32
+	pid int32
+}
+
+// rememberAuditCaller keeps the process opening a file on its handle, to audit the operations done when it is closed.
+func rememberAuditCaller(handle *handlemap.Handle) {
+	if !audit.Enabled() {
+		return
+	}
+
+	if caller := C.fuse_get_context(); caller != nil {
+		handle.SetValue(auditCallerKey, auditCaller{uid: uint32(caller.uid), gid: uint32(caller.gid), pid: int32(caller.pid)})
+	}
+}
+
+// auditHandleOperation records an operation done on behalf of the process which opened the handle.
+func auditHandleOperation(ev audit.Event, handle *handlemap.Handle, ret *C.int) {
+	if !audit.Enabled() {
+		return
+	}
+
+	if val, ok := handle.GetValue(auditCallerKey); ok {
+		caller := val.(auditCaller)
+		ev.UID = caller.uid
+		ev.GID = caller.gid
+		ev.PID = caller.pid
+	}
+
+	recordAudit(ev, ret)
+}
+
+// recordAudit fills in the result of the operation and hands the event to the audit log.
+func recordAudit(ev audit.Event, ret *C.int) {
+	if *ret != 0 {
+		ev.Result = audit.ResultFailure
+		ev.Error = syscall.Errno(-*ret).Error()
+	}
+	audit.Record(ev)
+}
+
 var fuse_opts C.fuse_options_t // nolint
 
 // convertConfig converts the config options from Go to C
@@ -145,6 +210,9 @@ func (lf *Libfuse) initFuse() error {
 		// Get our callback table
 		my_operations := C.fuse_operations_t{}
 		C.populate_callbacks(&my_operations)
+		if lf.fileLocks {
+			C.populate_lock_callbacks(&my_operations)
+		}
 
 		// Send our callback table to the extension
 		errc = C.register_callback_to_extension(&my_operations)
@@ -158,6 +226,10 @@ func (lf *Libfuse) initFuse() error {
 		// Populate our methods to be registered to libfuse
 		log.Trace("Libfuse::initFuse : Registering fuse callbacks")
 		C.populate_callbacks(&operations)
+		if lf.fileLocks {
+			log.Trace("Libfuse::initFuse : Registering lock callbacks")
+			C.populate_lock_callbacks(&operations)
+		}
 	}
 
 	log.Trace("Libfuse::initFuse : Populating fuse arguments")
@@ -355,6 +427,9 @@ func (lf *Libfuse) fillStat(attr *internal.ObjAttr, stbuf *C.stat_t) {
 // libfuse_getattr gets file attributes
 //export libfuse_getattr
 func libfuse_getattr(path *C.char, stbuf *C.stat_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("getattr")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	// log.Trace("Libfuse::libfuse_getattr : %s", name)
@@ -371,7 +446,7 @@ func libfuse_getattr(path *C.char, stbuf *C.stat_t, fi *C.fuse_file_info_t) C.in
 	}
 
 	// Get attributes
-	attr, err := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: name})
+	attr, err := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		//log.Err("Libfuse::libfuse_getattr : Failed to get attributes of %s [%s]", name, err.Error())
 		return -C.ENOENT
@@ -387,11 +462,14 @@ func libfuse_getattr(path *C.char, stbuf *C.stat_t, fi *C.fuse_file_info_t) C.in
 // libfuse_mkdir creates a directory
 //export libfuse_mkdir
 func libfuse_mkdir(path *C.char, mode C.mode_t) C.int {
+	ctx, fuseOp := startOperation("mkdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_mkdir : %s", name)
 
-	err := fuseFS.NextComponent().CreateDir(internal.CreateDirOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff)})
+	err := fuseFS.NextComponent().CreateDir(internal.CreateDirOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_mkdir : Failed to create %s [%s]", name, err.Error())
 		return -C.EIO
@@ -406,6 +484,9 @@ func libfuse_mkdir(path *C.char, mode C.mode_t) C.int {
 // libfuse_opendir opens handle to given directory
 //export libfuse_opendir
 func libfuse_opendir(path *C.char, fi *C.fuse_file_info_t) C.int {
+	_, fuseOp := startOperation("opendir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	if name != "" {
@@ -435,6 +516,9 @@ func libfuse_opendir(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse_releasedir opens handle to given directory
 //export libfuse_releasedir
 func libfuse_releasedir(path *C.char, fi *C.fuse_file_info_t) C.int {
+	_, fuseOp := startOperation("releasedir")
+	defer fuseOp.end()
+
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fi.fh)))
 
 	log.Trace("Libfuse::libfuse_releasedir : %s, handle: %d", handle.Path, handle.ID)
@@ -447,6 +531,9 @@ func libfuse_releasedir(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse_readdir reads a directory
 //export libfuse_readdir
 func libfuse_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, off C.off_t, fi *C.fuse_file_info_t, flag C.fuse_readdir_flags_t) C.int {
+	ctx, fuseOp := startOperation("readdir")
+	defer fuseOp.end()
+
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fi.fh)))
 
 	val, found := handle.GetValue("cache")
@@ -463,6 +550,7 @@ func libfuse_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, of
 			Offset: off_64,
 			Token:  cacheInfo.token,
 			Count:  common.MaxDirListCount,
+			Ctx:    ctx,
 		})
 
 		if err != nil {
@@ -514,17 +602,21 @@ func libfuse_readdir(_ *C.char, buf unsafe.Pointer, filler C.fuse_fill_dir_t, of
 
 // libfuse_rmdir deletes a directory, which must be empty.
 //export libfuse_rmdir
-func libfuse_rmdir(path *C.char) C.int {
+func libfuse_rmdir(path *C.char) (ret C.int) {
+	ctx, fuseOp := startOperation("rmdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_rmdir : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpRmdir, Path: name}, &ret)
 
-	empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: name})
+	empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: name, Ctx: ctx})
 	if !empty {
 		return -C.ENOTEMPTY
 	}
 
-	err := fuseFS.NextComponent().DeleteDir(internal.DeleteDirOptions{Name: name})
+	err := fuseFS.NextComponent().DeleteDir(internal.DeleteDirOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_rmdir : Failed to delete %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -543,6 +635,9 @@ func libfuse_rmdir(path *C.char) C.int {
 // File Operations
 //export libfuse_statfs
 func libfuse_statfs(path *C.char, buf *C.statvfs_t) C.int {
+	_, fuseOp := startOperation("statfs")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_statfs : %s", name)
@@ -573,12 +668,16 @@ func libfuse_statfs(path *C.char, buf *C.statvfs_t) C.int {
 
 // libfuse_create creates a file with the specified mode and then opens it.
 //export libfuse_create
-func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
+func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("create")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_create : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpCreate, Path: name, Mode: fmt.Sprintf("%04o", uint32(mode)&07777)}, &ret)
 
-	handle, err := fuseFS.NextComponent().CreateFile(internal.CreateFileOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff)})
+	handle, err := fuseFS.NextComponent().CreateFile(internal.CreateFileOptions{Name: name, Mode: fs.FileMode(uint32(mode) & 0xffffffff), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_create : Failed to create %s [%s]", name, err.Error())
 		if os.IsExist(err) {
@@ -589,6 +688,7 @@ func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
 	}
 
 	handlemap.Add(handle)
+	rememberAuditCaller(handle)
 	ret_val := C.allocate_native_file_object(0, C.ulong(uintptr(unsafe.Pointer(handle))), 0)
 	if !handle.Cached() {
 		ret_val.fd = 0
@@ -608,6 +708,9 @@ func libfuse_create(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
 // libfuse_open opens a file
 //export libfuse_open
 func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("open")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_open : %s", name)
@@ -641,6 +744,7 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 			Name:  name,
 			Flags: int(int(fi.flags) & 0xffffffff),
 			Mode:  fs.FileMode(fuseFS.filePermission),
+			Ctx:   ctx,
 		})
 
 	if err != nil {
@@ -653,6 +757,7 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 	}
 
 	handlemap.Add(handle)
+	rememberAuditCaller(handle)
 	//fi.fh = C.ulong(uintptr(unsafe.Pointer(handle)))
 	ret_val := C.allocate_native_file_object(C.ulong(handle.UnixFD), C.ulong(uintptr(unsafe.Pointer(handle))), C.ulong(handle.Size))
 	if !handle.Cached() {
@@ -670,6 +775,9 @@ func libfuse_open(path *C.char, fi *C.fuse_file_info_t) C.int {
 // libfuse_read reads data from an open file
 //export libfuse_read
 func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("read")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -688,6 +796,7 @@ func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.f
 				Handle: handle,
 				Offset: int64(offset),
 				Data:   data[:size],
+				Ctx:    ctx,
 			})
 	}
 
@@ -705,6 +814,9 @@ func libfuse_read(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.f
 // libfuse_write writes data to an open file
 //export libfuse_write
 func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("write")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -716,6 +828,7 @@ func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.
 			Offset:   int64(offset),
 			Data:     data[:size],
 			Metadata: nil,
+			Ctx:      ctx,
 		})
 
 	if err != nil {
@@ -729,6 +842,9 @@ func libfuse_write(path *C.char, buf *C.char, size C.size_t, off C.off_t, fi *C.
 // libfuse_flush possibly flushes cached data
 //export libfuse_flush
 func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("flush")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 	log.Trace("Libfuse::libfuse_flush : %s, handle: %d", handle.Path, handle.ID)
@@ -743,9 +859,13 @@ func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
 		return 0
 	}
 
-	err := fuseFS.NextComponent().FlushFile(internal.FlushFileOptions{Handle: handle})
+	err := fuseFS.NextComponent().FlushFile(internal.FlushFileOptions{Handle: handle, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_flush : error flushing file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ESTALE {
+			// File was changed by another writer and conflict policy asked to fail the upload
+			return -C.ESTALE
+		}
 		return -C.EIO
 	}
 
@@ -754,12 +874,16 @@ func libfuse_flush(path *C.char, fi *C.fuse_file_info_t) C.int {
 
 // libfuse_truncate changes the size of a file
 //export libfuse_truncate
-func libfuse_truncate(path *C.char, off C.off_t, fi *C.fuse_file_info_t) C.int {
+func libfuse_truncate(path *C.char, off C.off_t, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("truncate")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
+	defer auditOperation(audit.Event{Operation: audit.OpTruncate, Path: name, Size: strconv.FormatInt(int64(off), 10)}, &ret)
 	log.Trace("Libfuse::libfuse_truncate : %s size %d", name, off)
 
-	err := fuseFS.NextComponent().TruncateFile(internal.TruncateFileOptions{Name: name, Size: int64(off)})
+	err := fuseFS.NextComponent().TruncateFile(internal.TruncateFileOptions{Name: name, Size: int64(off), Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_truncate : error truncating file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -776,7 +900,10 @@ func libfuse_truncate(path *C.char, off C.off_t, fi *C.fuse_file_info_t) C.int {
 
 // libfuse_release releases an open file
 //export libfuse_release
-func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
+func libfuse_release(path *C.char, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("release")
+	defer fuseOp.end()
+
 	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 
@@ -787,9 +914,24 @@ func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
 		handle.Flags.Set(handlemap.HandleFlagDirty)
 	}
 
-	err := fuseFS.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle})
+	// Data written through the handle goes to storage on close
+	if handle.Dirty() {
+		defer auditHandleOperation(audit.Event{Operation: audit.OpWriteClose, Path: handle.Path}, handle, &ret)
+	}
+
+	err := fuseFS.NextComponent().CloseFile(internal.CloseFileOptions{Handle: handle, Ctx: ctx})
+
+	// Locks die with the handle, the lease behind an exclusive one has to be given up as well
+	if fuseFS.fileLocks {
+		_ = fuseFS.NextComponent().LockFile(internal.LockFileOptions{Handle: handle, Type: internal.LockUnlock, Ctx: ctx})
+	}
+
 	if err != nil {
 		log.Err("Libfuse::libfuse_release : error closing file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ESTALE {
+			// File was changed by another writer and conflict policy asked to fail the upload
+			return -C.ESTALE
+		}
 		return -C.EIO
 	}
 
@@ -802,14 +944,136 @@ func libfuse_release(path *C.char, fi *C.fuse_file_info_t) C.int {
 	return 0
 }
 
+// lockInterrupted reports a blocking lock request was interrupted by a signal to the process waiting on it.
+// Lock requests wait in the callback itself, which stays on the FUSE thread serving the request as libfuse looks it up from there.
+func lockInterrupted() bool {
+	return C.fuse_interrupted() != 0
+}
+
+// libfuse_flock applies a flock(2) request on an open file
+//export libfuse_flock
+func libfuse_flock(path *C.char, fi *C.fuse_file_info_t, op C.int) C.int {
+	ctx, fuseOp := startOperation("flock")
+	defer fuseOp.end()
+
+	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
+	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
+
+	options := internal.LockFileOptions{
+		Handle:      handle,
+		Wait:        int(op)&syscall.LOCK_NB == 0,
+		Ctx:         ctx,
+		Interrupted: lockInterrupted,
+	}
+
+	switch int(op) &^ syscall.LOCK_NB {
+	case syscall.LOCK_SH:
+		options.Type = internal.LockShared
+	case syscall.LOCK_EX:
+		options.Type = internal.LockExclusive
+	case syscall.LOCK_UN:
+		options.Type = internal.LockUnlock
+	default:
+		return -C.EINVAL
+	}
+
+	log.Trace("Libfuse::libfuse_flock : %s, handle: %d, op %d", handle.Path, handle.ID, op)
+
+	err := fuseFS.NextComponent().LockFile(options)
+	if err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return -C.EWOULDBLOCK
+		}
+		if err == syscall.EINTR {
+			return -C.EINTR
+		}
+		log.Err("Libfuse::libfuse_flock : error locking file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ENOTSUP {
+			return -C.EOPNOTSUPP
+		}
+		return -C.EIO
+	}
+
+	return 0
+}
+
+// libfuse_lock applies a fcntl(2) record lock request on an open file.
+// Record locks are taken on the whole file as the lease backing them covers the whole blob.
+//export libfuse_lock
+func libfuse_lock(path *C.char, fi *C.fuse_file_info_t, cmd C.int, lock *C.struct_flock) C.int {
+	ctx, fuseOp := startOperation("lock")
+	defer fuseOp.end()
+
+	fileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fi.fh)))
+	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
+
+	options := internal.LockFileOptions{Handle: handle, Ctx: ctx, Interrupted: lockInterrupted}
+
+	switch cmd {
+	case C.F_GETLK:
+		options.Test = true
+	case C.F_SETLK:
+	case C.F_SETLKW:
+		options.Wait = true
+	default:
+		return -C.EINVAL
+	}
+
+	switch lock.l_type {
+	case C.F_RDLCK:
+		options.Type = internal.LockShared
+	case C.F_WRLCK:
+		options.Type = internal.LockExclusive
+	case C.F_UNLCK:
+		options.Type = internal.LockUnlock
+	default:
+		return -C.EINVAL
+	}
+
+	log.Trace("Libfuse::libfuse_lock : %s, handle: %d, cmd %d, type %d", handle.Path, handle.ID, cmd, lock.l_type)
+
+	err := fuseFS.NextComponent().LockFile(options)
+	if options.Test {
+		// F_GETLK reports the conflicting lock in place of the requested one, the holder is not known here
+		if err == nil {
+			lock.l_type = C.F_UNLCK
+			return 0
+		} else if err == syscall.EWOULDBLOCK {
+			lock.l_type = C.F_WRLCK
+			lock.l_pid = 0
+			return 0
+		}
+	}
+
+	if err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return -C.EAGAIN
+		}
+		if err == syscall.EINTR {
+			return -C.EINTR
+		}
+		log.Err("Libfuse::libfuse_lock : error locking file %s, handle: %d [%s]", handle.Path, handle.ID, err.Error())
+		if err == syscall.ENOTSUP {
+			return -C.EOPNOTSUPP
+		}
+		return -C.EIO
+	}
+
+	return 0
+}
+
 // libfuse_unlink removes a file
 //export libfuse_unlink
-func libfuse_unlink(path *C.char) C.int {
+func libfuse_unlink(path *C.char) (ret C.int) {
+	ctx, fuseOp := startOperation("unlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_unlink : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpUnlink, Path: name}, &ret)
 
-	err := fuseFS.NextComponent().DeleteFile(internal.DeleteFileOptions{Name: name})
+	err := fuseFS.NextComponent().DeleteFile(internal.DeleteFileOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_unlink : error deleting file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -829,12 +1093,16 @@ func libfuse_unlink(path *C.char) C.int {
 // errors handled: EISDIR, ENOENT, ENOTDIR, ENOTEMPTY, EEXIST
 // TODO: handle EACCESS, EINVAL?
 //export libfuse_rename
-func libfuse_rename(src *C.char, dst *C.char, flags C.uint) C.int {
+func libfuse_rename(src *C.char, dst *C.char, flags C.uint) (ret C.int) {
+	ctx, fuseOp := startOperation("rename")
+	defer fuseOp.end()
+
 	srcPath := trimFusePath(src)
 	srcPath = common.NormalizeObjectName(srcPath)
 	dstPath := trimFusePath(dst)
 	dstPath = common.NormalizeObjectName(dstPath)
 	log.Trace("Libfuse::libfuse_rename : %s -> %s", srcPath, dstPath)
+	defer auditOperation(audit.Event{Operation: audit.OpRename, Path: srcPath, Target: dstPath}, &ret)
 	// Note: When running other commands from the command line, a lot of them seemed to handle some cases like ENOENT themselves.
 	// Rename did not, so we manually check here.
 
@@ -849,12 +1117,12 @@ func libfuse_rename(src *C.char, dst *C.char, flags C.uint) C.int {
 		return -C.ENOENT
 	}
 
-	srcAttr, srcErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: srcPath})
+	srcAttr, srcErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: srcPath, Ctx: ctx})
 	if os.IsNotExist(srcErr) {
 		log.Err("Libfuse::libfuse_rename : Failed to get attributes of %s [%s]", srcPath, srcErr.Error())
 		return -C.ENOENT
 	}
-	dstAttr, dstErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: dstPath})
+	dstAttr, dstErr := fuseFS.NextComponent().GetAttr(internal.GetAttrOptions{Name: dstPath, Ctx: ctx})
 
 	// EEXIST
 	if flags&C.RENAME_NOREPLACE != 0 && (dstErr == nil || os.IsExist(dstErr)) {
@@ -876,13 +1144,13 @@ func libfuse_rename(src *C.char, dst *C.char, flags C.uint) C.int {
 	if srcAttr.IsDir() {
 		// ENOTEMPTY
 		if dstErr == nil || os.IsExist(dstErr) {
-			empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: dstPath})
+			empty := fuseFS.NextComponent().IsDirEmpty(internal.IsDirEmptyOptions{Name: dstPath, Ctx: ctx})
 			if !empty {
 				return -C.ENOTEMPTY
 			}
 		}
 
-		err := fuseFS.NextComponent().RenameDir(internal.RenameDirOptions{Src: srcPath, Dst: dstPath})
+		err := fuseFS.NextComponent().RenameDir(internal.RenameDirOptions{Src: srcPath, Dst: dstPath, Ctx: ctx})
 		if err != nil {
 			log.Err("Libfuse::libfuse_rename : error renaming directory %s -> %s [%s]", srcPath, dstPath, err.Error())
 			return -C.EIO
@@ -892,7 +1160,7 @@ func libfuse_rename(src *C.char, dst *C.char, flags C.uint) C.int {
 		libfuseStatsCollector.UpdateStats(stats_manager.Increment, renameDir, (int64)(1))
 
 	} else {
-		err := fuseFS.NextComponent().RenameFile(internal.RenameFileOptions{Src: srcPath, Dst: dstPath})
+		err := fuseFS.NextComponent().RenameFile(internal.RenameFileOptions{Src: srcPath, Dst: dstPath, Ctx: ctx})
 		if err != nil {
 			log.Err("Libfuse::libfuse_rename : error renaming file %s -> %s [%s]", srcPath, dstPath, err.Error())
 			return -C.EIO
@@ -911,13 +1179,16 @@ func libfuse_rename(src *C.char, dst *C.char, flags C.uint) C.int {
 // libfuse_symlink creates a symbolic link
 //export libfuse_symlink
 func libfuse_symlink(target *C.char, link *C.char) C.int {
+	ctx, fuseOp := startOperation("symlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(link)
 	name = common.NormalizeObjectName(name)
 	targetPath := C.GoString(target)
 	targetPath = common.NormalizeObjectName(targetPath)
 	log.Trace("Libfuse::libfuse_symlink : Received for %s -> %s", name, targetPath)
 
-	err := fuseFS.NextComponent().CreateLink(internal.CreateLinkOptions{Name: name, Target: targetPath})
+	err := fuseFS.NextComponent().CreateLink(internal.CreateLinkOptions{Name: name, Target: targetPath, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_symlink : error linking file %s -> %s [%s]", name, targetPath, err.Error())
 		return -C.EIO
@@ -932,11 +1203,14 @@ func libfuse_symlink(target *C.char, link *C.char) C.int {
 // libfuse_readlink reads the target of a symbolic link
 //export libfuse_readlink
 func libfuse_readlink(path *C.char, buf *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("readlink")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	//log.Trace("Libfuse::libfuse_readlink : Received for %s", name)
 
-	targetPath, err := fuseFS.NextComponent().ReadLink(internal.ReadLinkOptions{Name: name})
+	targetPath, err := fuseFS.NextComponent().ReadLink(internal.ReadLinkOptions{Name: name, Ctx: ctx})
 	if err != nil {
 		log.Err("Libfuse::libfuse_readlink : error reading link file %s [%s]", name, err.Error())
 		if os.IsNotExist(err) {
@@ -957,6 +1231,9 @@ func libfuse_readlink(path *C.char, buf *C.char, size C.size_t) C.int {
 // libfuse_fsync synchronizes file contents
 //export libfuse_fsync
 func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("fsync")
+	defer fuseOp.end()
+
 	if fi.fh == 0 {
 		return C.int(-C.EIO)
 	}
@@ -965,7 +1242,7 @@ func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
 	handle := (*handlemap.Handle)(unsafe.Pointer(uintptr(fileHandle.obj)))
 	log.Trace("Libfuse::libfuse_fsync : %s, handle: %d", handle.Path, handle.ID)
 
-	options := internal.SyncFileOptions{Handle: handle}
+	options := internal.SyncFileOptions{Handle: handle, Ctx: ctx}
 	// If the datasync parameter is non-zero, then only the user data should be flushed, not the metadata.
 	// TODO : Should we support this?
 
@@ -984,11 +1261,14 @@ func libfuse_fsync(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
 // libfuse_fsyncdir synchronizes directory contents
 //export libfuse_fsyncdir
 func libfuse_fsyncdir(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.int {
+	ctx, fuseOp := startOperation("fsyncdir")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_fsyncdir : %s", name)
 
-	options := internal.SyncDirOptions{Name: name}
+	options := internal.SyncDirOptions{Name: name, Ctx: ctx}
 	// If the datasync parameter is non-zero, then only the user data should be flushed, not the metadata.
 	// TODO : Should we support this?
 
@@ -1006,15 +1286,20 @@ func libfuse_fsyncdir(path *C.char, datasync C.int, fi *C.fuse_file_info_t) C.in
 
 // libfuse_chmod changes permission bits of a file
 //export libfuse_chmod
-func libfuse_chmod(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
+func libfuse_chmod(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) (ret C.int) {
+	ctx, fuseOp := startOperation("chmod")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_chmod : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpChmod, Path: name, Mode: fmt.Sprintf("%04o", uint32(mode)&07777)}, &ret)
 
 	err := fuseFS.NextComponent().Chmod(
 		internal.ChmodOptions{
 			Name: name,
 			Mode: fs.FileMode(uint32(mode) & 0xffffffff),
+			Ctx:  ctx,
 		})
 	if err != nil {
 		log.Err("Libfuse::libfuse_chmod : error in chmod of %s [%s]", name, err.Error())
@@ -1032,10 +1317,14 @@ func libfuse_chmod(path *C.char, mode C.mode_t, fi *C.fuse_file_info_t) C.int {
 
 // libfuse_chown changes the owner and group of a file
 //export libfuse_chown
-func libfuse_chown(path *C.char, uid C.uid_t, gid C.gid_t, fi *C.fuse_file_info_t) C.int {
+func libfuse_chown(path *C.char, uid C.uid_t, gid C.gid_t, fi *C.fuse_file_info_t) (ret C.int) {
+	_, fuseOp := startOperation("chown")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_chown : %s", name)
+	defer auditOperation(audit.Event{Operation: audit.OpChown, Path: name, Owner: fmt.Sprintf("%d:%d", uint32(uid), uint32(gid))}, &ret)
 	// TODO: Implement
 	return 0
 }
@@ -1043,6 +1332,9 @@ func libfuse_chown(path *C.char, uid C.uid_t, gid C.gid_t, fi *C.fuse_file_info_
 // libfuse_utimens changes the access and modification times of a file
 //export libfuse_utimens
 func libfuse_utimens(path *C.char, tv *C.timespec_t, fi *C.fuse_file_info_t) C.int {
+	_, fuseOp := startOperation("utimens")
+	defer fuseOp.end()
+
 	name := trimFusePath(path)
 	name = common.NormalizeObjectName(name)
 	log.Trace("Libfuse::libfuse_utimens : %s", name)
@@ -1052,6 +1344,238 @@ func libfuse_utimens(path *C.char, tv *C.timespec_t, fi *C.fuse_file_info_t) C.i
 	return 0
 }
 
+// xattrErrorCode maps the error of an extended attribute operation to the errno returned to the kernel
+func xattrErrorCode(err error) C.int {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ENOENT, syscall.ENODATA, syscall.ENOTSUP, syscall.EEXIST,
+			syscall.EPERM, syscall.EINVAL, syscall.ERANGE, syscall.E2BIG, syscall.ENOSPC:
+			return -C.int(errno)
+		}
+	}
+
+	if os.IsNotExist(err) {
+		return -C.ENOENT
+	}
+	return -C.EIO
+}
+
+// libfuse_getxattr reads the value of an extended attribute
+//export libfuse_getxattr
+func libfuse_getxattr(path *C.char, name *C.char, value *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("getxattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_getxattr : %s of %s", attr, objName)
+
+	// Root of the mount does not map to any object in storage
+	if objName == "" {
+		return -C.ENODATA
+	}
+
+	data, err := fuseFS.NextComponent().GetXattr(internal.GetXattrOptions{Name: objName, Attr: attr, Ctx: ctx})
+	if err != nil {
+		code := xattrErrorCode(err)
+		if code == -C.EIO {
+			log.Err("Libfuse::libfuse_getxattr : error getting %s of %s [%s]", attr, objName, err.Error())
+		}
+		return code
+	}
+
+	// Zero size is a query for the size of the buffer required to hold the value
+	if size == 0 {
+		return C.int(len(data))
+	}
+	if len(data) > int(size) {
+		return -C.ERANGE
+	}
+	if len(data) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(value))[:len(data):len(data)], data)
+	}
+
+	return C.int(len(data))
+}
+
+// libfuse_listxattr lists the names of extended attributes as a sequence of null terminated strings
+//export libfuse_listxattr
+func libfuse_listxattr(path *C.char, list *C.char, size C.size_t) C.int {
+	ctx, fuseOp := startOperation("listxattr")
+	defer fuseOp.end()
+
+	name := trimFusePath(path)
+	name = common.NormalizeObjectName(name)
+	log.Trace("Libfuse::libfuse_listxattr : %s", name)
+
+	if name == "" {
+		return 0
+	}
+
+	attrs, err := fuseFS.NextComponent().ListXattr(internal.ListXattrOptions{Name: name, Ctx: ctx})
+	if err != nil {
+		code := xattrErrorCode(err)
+		if code == -C.EIO {
+			log.Err("Libfuse::libfuse_listxattr : error listing attributes of %s [%s]", name, err.Error())
+		}
+		return code
+	}
+
+	data := make([]byte, 0)
+	for _, attr := range attrs {
+		data = append(data, attr...)
+		data = append(data, 0)
+	}
+
+	if size == 0 {
+		return C.int(len(data))
+	}
+	if len(data) > int(size) {
+		return -C.ERANGE
+	}
+	if len(data) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(list))[:len(data):len(data)], data)
+	}
+
+	return C.int(len(data))
+}
+
+// libfuse_setxattr sets the value of an extended attribute
+//export libfuse_setxattr
+func libfuse_setxattr(path *C.char, name *C.char, value *C.char, size C.size_t, flags C.int) C.int {
+	ctx, fuseOp := startOperation("setxattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_setxattr : %s of %s", attr, objName)
+
+	if objName == "" {
+		return -C.ENOTSUP
+	}
+
+	err := fuseFS.NextComponent().SetXattr(
+		internal.SetXattrOptions{
+			Name:  objName,
+			Attr:  attr,
+			Value: C.GoBytes(unsafe.Pointer(value), C.int(size)),
+			Flags: int(flags),
+			Ctx:   ctx,
+		})
+	if err != nil {
+		log.Err("Libfuse::libfuse_setxattr : error setting %s of %s [%s]", attr, objName, err.Error())
+		return xattrErrorCode(err)
+	}
+
+	libfuseStatsCollector.PushEvents(setXattr, objName, map[string]interface{}{xattr: attr})
+	libfuseStatsCollector.UpdateStats(stats_manager.Increment, setXattr, (int64)(1))
+
+	return 0
+}
+
+// libfuse_removexattr removes an extended attribute
+//export libfuse_removexattr
+func libfuse_removexattr(path *C.char, name *C.char) C.int {
+	ctx, fuseOp := startOperation("removexattr")
+	defer fuseOp.end()
+
+	objName := trimFusePath(path)
+	objName = common.NormalizeObjectName(objName)
+	attr := C.GoString(name)
+	log.Trace("Libfuse::libfuse_removexattr : %s of %s", attr, objName)
+
+	if objName == "" {
+		return -C.ENOTSUP
+	}
+
+	err := fuseFS.NextComponent().RemoveXattr(internal.RemoveXattrOptions{Name: objName, Attr: attr, Ctx: ctx})
+	if err != nil {
+		log.Err("Libfuse::libfuse_removexattr : error removing %s of %s [%s]", attr, objName, err.Error())
+		return xattrErrorCode(err)
+	}
+
+	libfuseStatsCollector.PushEvents(removeXattr, objName, map[string]interface{}{xattr: attr})
+	libfuseStatsCollector.UpdateStats(stats_manager.Increment, removeXattr, (int64)(1))
+
+	return 0
+}
+
+// libfuse_copy_file_range copies data between two open files without passing it through user space.
+// Returning EOPNOTSUPP makes the kernel fall back to reading and writing the data.
+//export libfuse_copy_file_range
+func libfuse_copy_file_range(pathIn *C.char, fiIn *C.fuse_file_info_t, offIn C.off_t,
+	pathOut *C.char, fiOut *C.fuse_file_info_t, offOut C.off_t, length C.size_t, flags C.int) (res C.ssize_t) {
+	ctx, fuseOp := startOperation("copy_file_range")
+	defer fuseOp.end()
+
+	srcFileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fiIn.fh)))
+	srcHandle := (*handlemap.Handle)(unsafe.Pointer(uintptr(srcFileHandle.obj)))
+	dstFileHandle := (*C.file_handle_t)(unsafe.Pointer(uintptr(fiOut.fh)))
+	dstHandle := (*handlemap.Handle)(unsafe.Pointer(uintptr(dstFileHandle.obj)))
+	log.Trace("Libfuse::libfuse_copy_file_range : %s offset %d -> %s offset %d, size %d", srcHandle.Path, offIn, dstHandle.Path, offOut, length)
+
+	// Writes done natively are known only to the C handle till now
+	if srcFileHandle.dirty != 0 {
+		srcHandle.Flags.Set(handlemap.HandleFlagDirty)
+	}
+	if dstFileHandle.dirty != 0 {
+		dstHandle.Flags.Set(handlemap.HandleFlagDirty)
+	}
+
+	// Copies the server can not do fall back to writes, which are audited on release of the target
+	defer func() {
+		if res == -C.EOPNOTSUPP {
+			return
+		}
+		ret, copied := C.int(0), int64(0)
+		if res < 0 {
+			ret = C.int(res)
+		} else {
+			copied = int64(res)
+		}
+		auditOperation(audit.Event{Operation: audit.OpCopyRange, Path: srcHandle.Path, Target: dstHandle.Path,
+			Offset: strconv.FormatInt(int64(offOut), 10), Size: strconv.FormatInt(copied, 10)}, &ret)
+	}()
+
+	copied, err := fuseFS.NextComponent().CopyFileRange(
+		internal.CopyFileRangeOptions{
+			SrcHandle: srcHandle,
+			SrcOffset: int64(offIn),
+			DstHandle: dstHandle,
+			DstOffset: int64(offOut),
+			Size:      int64(length),
+			Ctx:       ctx,
+		})
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			log.Debug("Libfuse::libfuse_copy_file_range : %s -> %s can not be copied on the server", srcHandle.Path, dstHandle.Path)
+			return -C.EOPNOTSUPP
+		}
+		log.Err("Libfuse::libfuse_copy_file_range : error copying %s to %s [%s]", srcHandle.Path, dstHandle.Path, err.Error())
+		if os.IsNotExist(err) {
+			return -C.ENOENT
+		} else if err == syscall.EROFS {
+			return -C.EROFS
+		}
+		return -C.EIO
+	}
+
+	// Storage holds the target now, there is nothing left for release to upload
+	if !dstHandle.Dirty() {
+		dstFileHandle.dirty = 0
+	}
+
+	if copied > 0 {
+		libfuseStatsCollector.PushEvents(copyFile, srcHandle.Path, map[string]interface{}{dest: dstHandle.Path, size: copied})
+		libfuseStatsCollector.UpdateStats(stats_manager.Increment, copyFile, (int64)(1))
+	}
+
+	return C.ssize_t(copied)
+}
+
 // blobfuse_cache_update refresh the file-cache policy for this file
 //export blobfuse_cache_update
 func blobfuse_cache_update(path *C.char) C.int {
@@ -299,6 +299,34 @@ func (suite *libfuseTestSuite) TestUtimens() {
 	testUtimens(suite)
 }
 
+func (suite *libfuseTestSuite) TestGetXattr() {
+	testGetXattr(suite)
+}
+
+func (suite *libfuseTestSuite) TestGetXattrNotExists() {
+	testGetXattrNotExists(suite)
+}
+
+func (suite *libfuseTestSuite) TestListXattr() {
+	testListXattr(suite)
+}
+
+func (suite *libfuseTestSuite) TestSetXattr() {
+	testSetXattr(suite)
+}
+
+func (suite *libfuseTestSuite) TestRemoveXattr() {
+	testRemoveXattr(suite)
+}
+
+func (suite *libfuseTestSuite) TestCopyFileRange() {
+	testCopyFileRange(suite)
+}
+
+func (suite *libfuseTestSuite) TestFileLock() {
+	testFileLock(suite)
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestLibfuseTestSuite(t *testing.T) {
@@ -390,19 +390,64 @@ func (lfs *LoopbackFS) CopyToFile(options internal.CopyToFileOptions) error {
 func (lfs *LoopbackFS) CopyFromFile(options internal.CopyFromFileOptions) error {
 	log.Trace("LoopbackFS::CopyFromFile : name=%s", options.Name)
 	path := filepath.Join(lfs.path, options.Name)
+	if options.ETag != "" {
+		info, err := os.Stat(path)
+		if err != nil || fileETag(info) != options.ETag {
+			log.Err("LoopbackFS::CopyFromFile : %s was modified since %s", options.Name, options.ETag)
+			return syscall.ESTALE
+		}
+	}
+	src, size, err := options.UploadSource()
+	if err != nil {
+		log.Err("LoopbackFS::CopyFromFile : error reading source [%s]", err)
+		return err
+	}
 	fdst, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
 	if err != nil {
 		log.Err("LoopbackFS::CopyFromFile : error opening [%s]", err)
 		return err
 	}
-	_, err = io.Copy(fdst, options.File)
+	_, err = io.Copy(fdst, io.NewSectionReader(src, 0, size))
 	if err != nil {
 		log.Err("LoopbackFS::CopyFromFile : error copying [%s]", err)
 		return err
 	}
+	if options.Handle != nil {
+		info, err := fdst.Stat()
+		if err == nil {
+			options.Handle.ETag = fileETag(info)
+		}
+	}
 	return nil
 }
 
+func (lfs *LoopbackFS) CopyFileRange(options internal.CopyFileRangeOptions) (int64, error) {
+	log.Trace("LoopbackFS::CopyFileRange : %s -> %s", options.SrcHandle.Path, options.DstHandle.Path)
+	fsrc, err := os.Open(filepath.Join(lfs.path, options.SrcHandle.Path))
+	if err != nil {
+		log.Err("LoopbackFS::CopyFileRange : error opening source [%s]", err)
+		return 0, err
+	}
+	defer fsrc.Close()
+
+	fdst, err := os.OpenFile(filepath.Join(lfs.path, options.DstHandle.Path), os.O_WRONLY|os.O_CREATE, os.FileMode(0666))
+	if err != nil {
+		log.Err("LoopbackFS::CopyFileRange : error opening target [%s]", err)
+		return 0, err
+	}
+	defer fdst.Close()
+
+	_, err = fdst.Seek(options.DstOffset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(fdst, io.NewSectionReader(fsrc, options.SrcOffset, options.Size))
+	if err != nil {
+		log.Err("LoopbackFS::CopyFileRange : error copying [%s]", err)
+	}
+	return n, err
+}
+
 func (lfs *LoopbackFS) GetAttr(options internal.GetAttrOptions) (*internal.ObjAttr, error) {
 	log.Trace("LoopbackFS::GetAttr : name=%s", options.Name)
 	path := filepath.Join(lfs.path, options.Name)
@@ -417,6 +462,7 @@ func (lfs *LoopbackFS) GetAttr(options internal.GetAttrOptions) (*internal.ObjAt
 		Size:  info.Size(),
 		Mode:  info.Mode(),
 		Mtime: info.ModTime(),
+		ETag:  fileETag(info),
 	}
 	attr.Flags.Set(internal.PropFlagMetadataRetrieved)
 	attr.Flags.Set(internal.PropFlagModeDefault)
@@ -446,9 +492,67 @@ func (lfs *LoopbackFS) Chown(options internal.ChownOptions) error {
 	return os.Chown(path, options.Owner, options.Group)
 }
 
+func (lfs *LoopbackFS) GetXattr(options internal.GetXattrOptions) ([]byte, error) {
+	log.Trace("LoopbackFS::GetXattr : name=%s, attr=%s", options.Name, options.Attr)
+	path := filepath.Join(lfs.path, options.Name)
+
+	size, err := syscall.Getxattr(path, options.Attr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	size, err = syscall.Getxattr(path, options.Attr, data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+func (lfs *LoopbackFS) ListXattr(options internal.ListXattrOptions) ([]string, error) {
+	log.Trace("LoopbackFS::ListXattr : name=%s", options.Name)
+	path := filepath.Join(lfs.path, options.Name)
+
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	size, err = syscall.Listxattr(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(string(data[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (lfs *LoopbackFS) SetXattr(options internal.SetXattrOptions) error {
+	log.Trace("LoopbackFS::SetXattr : name=%s, attr=%s", options.Name, options.Attr)
+	path := filepath.Join(lfs.path, options.Name)
+	return syscall.Setxattr(path, options.Attr, options.Value, options.Flags)
+}
+
+func (lfs *LoopbackFS) RemoveXattr(options internal.RemoveXattrOptions) error {
+	log.Trace("LoopbackFS::RemoveXattr : name=%s, attr=%s", options.Name, options.Attr)
+	path := filepath.Join(lfs.path, options.Name)
+	return syscall.Removexattr(path, options.Attr)
+}
+
 func (lfs *LoopbackFS) InvalidateObject(_ string) {
 }
 
+// fileETag : local files have no etag, one is derived from size and modification time so that writes change it
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
+
 func NewLoopbackFSComponent() internal.Component {
 	lfs := &LoopbackFS{}
 	lfs.SetName(compName)
@@ -38,6 +38,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/Azure/azure-storage-fuse/v2/internal"
@@ -283,6 +284,28 @@ func (suite *LoopbackFSTestSuite) TestGetAttr() {
 	assert.Equal(attr.IsDir(), info.IsDir())
 }
 
+func (suite *LoopbackFSTestSuite) TestXattr() {
+	defer suite.cleanupTest()
+	assert := assert.New(suite.T())
+
+	err := suite.lfs.SetXattr(internal.SetXattrOptions{Name: fileHello, Attr: "user.source", Value: []byte("pipeline")})
+	assert.Nil(err)
+
+	value, err := suite.lfs.GetXattr(internal.GetXattrOptions{Name: fileHello, Attr: "user.source"})
+	assert.Nil(err)
+	assert.Equal([]byte("pipeline"), value)
+
+	names, err := suite.lfs.ListXattr(internal.ListXattrOptions{Name: fileHello})
+	assert.Nil(err)
+	assert.Contains(names, "user.source")
+
+	err = suite.lfs.RemoveXattr(internal.RemoveXattrOptions{Name: fileHello, Attr: "user.source"})
+	assert.Nil(err)
+
+	_, err = suite.lfs.GetXattr(internal.GetXattrOptions{Name: fileHello, Attr: "user.source"})
+	assert.Equal(syscall.ENODATA, err)
+}
+
 func TestLoopbackFSTestSuite(t *testing.T) {
 	suite.Run(t, new(LoopbackFSTestSuite))
 }
@@ -35,6 +35,7 @@ package stream
 
 import (
 	"io"
+	"sync"
 	"sync/atomic"
 	"syscall"
 
@@ -42,6 +43,7 @@ import (
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 )
 
 type ReadCache struct {
@@ -49,6 +51,26 @@ type ReadCache struct {
 	StreamConnection
 }
 
+const readAheadKey = "read_ahead"
+
+// readAhead : tracks the access pattern of a handle to decide how many blocks to prefetch
+type readAhead struct {
+	sync.Mutex
+	nextOffset   int64          // offset where the next read is expected if access is sequential
+	lastBlock    int64          // start offset of the block served by the last read
+	window       int64          // number of blocks to be prefetched ahead of the current block
+	prefetchedTo int64          // end offset of the last block scheduled for prefetch
+	pending      map[int64]bool // prefetched blocks which are not yet consumed by any read
+	wg           sync.WaitGroup // prefetch requests in flight
+}
+
+func newReadAhead() *readAhead {
+	return &readAhead{
+		lastBlock: -1,
+		pending:   make(map[int64]bool),
+	}
+}
+
 func (r *ReadCache) Configure(conf StreamOptions) error {
 	if conf.BufferSize <= 0 || conf.BlockSize <= 0 || conf.CachedObjLimit <= 0 {
 		r.StreamOnly = true
@@ -58,6 +80,16 @@ func (r *ReadCache) Configure(conf StreamOptions) error {
 	r.BufferSize = conf.BufferSize * mb
 	r.CachedObjLimit = int32(conf.CachedObjLimit)
 	r.CachedObjects = 0
+
+	// prefetched blocks share the handle buffer, so always leave room for the block being read
+	r.ReadAhead = int64(conf.ReadAhead)
+	if r.ReadAhead > 0 && !r.StreamOnly {
+		maxBlocks := int64(r.BufferSize)/r.BlockSize - 1
+		if r.ReadAhead > maxBlocks {
+			log.Warn("ReadCache::Configure : Read ahead reduced to %d blocks to fit in buffer", maxBlocks)
+			r.ReadAhead = maxBlocks
+		}
+	}
 	return nil
 }
 
@@ -103,6 +135,9 @@ func (r *ReadCache) OpenFile(options internal.OpenFileOptions) (*handlemap.Handl
 			return handle, nil
 		}
 		atomic.AddInt32(&r.CachedObjects, 1)
+		if r.ReadAhead > 0 {
+			handle.SetValue(readAheadKey, newReadAhead())
+		}
 		block, exists, err := r.getBlock(handle, 0)
 		if err != nil {
 			log.Err("Stream::OpenFile : error failed to get block on open %s [%s]", options.Name, err.Error())
@@ -139,16 +174,37 @@ func (r *ReadCache) getBlock(handle *handlemap.Handle, offset int64) (*common.Bl
 		}
 		_, err := r.NextComponent().ReadInBuffer(options)
 		if err != nil && err != io.EOF {
-			return nil, false, err
+			// mark the block before unlocking it so readers already waiting on it do not copy its data
+			block.Flags.Set(common.FailedBlock)
+			block.Unlock()
+			handle.CacheObj.Lock()
+			r.removeFailedBlock(handle, block)
+			handle.CacheObj.Unlock()
+			return block, false, err
 		}
 		return block, false, nil
 	} else {
 		block.RLock()
+		if block.Failed() {
+			// the download this reader waited on failed, drop the block and fetch it again
+			block.RUnlock()
+			r.removeFailedBlock(handle, block)
+			handle.CacheObj.Unlock()
+			return r.getBlock(handle, offset)
+		}
 		handle.CacheObj.Unlock()
 		return block, true, nil
 	}
 }
 
+// removeFailedBlock : remove a block whose download failed unless the cache already holds a newer one for its offset,
+// caller must hold the lock on the handle cache
+func (r *ReadCache) removeFailedBlock(handle *handlemap.Handle, block *common.Block) {
+	if cached, ok := handle.CacheObj.Get(block.StartIndex); ok && cached == block {
+		handle.CacheObj.Remove(block.StartIndex)
+	}
+}
+
 func (r *ReadCache) copyCachedBlock(handle *handlemap.Handle, offset int64, data []byte) (int, error) {
 	dataLeft := int64(len(data))
 	// counter to track how much we have copied into our request buffer thus far
@@ -160,12 +216,17 @@ func (r *ReadCache) copyCachedBlock(handle *handlemap.Handle, offset int64, data
 		// Lock on requested block and fileName to ensure it is not being rerequested or manipulated
 		block, exists, err := r.getBlock(handle, cachedBlockStartIndex)
 		if err != nil {
-			r.unlockBlock(block, exists)
 			log.Err("Stream::ReadInBuffer : failed to download block of %s with offset %d: [%s]", handle.Path, block.StartIndex, err.Error())
 			return dataRead, err
 		}
 		dataCopied := int64(copy(data[dataRead:], block.Data[offset-cachedBlockStartIndex:]))
 		r.unlockBlock(block, exists)
+		if exists {
+			streamStatsCollector.UpdateStats(stats_manager.Increment, cacheHits, (int64)(1))
+		} else {
+			streamStatsCollector.UpdateStats(stats_manager.Increment, cacheMisses, (int64)(1))
+		}
+		r.consumePrefetched(handle, cachedBlockStartIndex)
 		dataLeft -= dataCopied
 		offset += dataCopied
 		dataRead += int(dataCopied)
@@ -182,11 +243,111 @@ func (r *ReadCache) ReadInBuffer(options internal.ReadInBufferOptions) (int, err
 		}
 		return data, err
 	}
-	return r.copyCachedBlock(options.Handle, options.Offset, options.Data)
+	dataRead, err := r.copyCachedBlock(options.Handle, options.Offset, options.Data)
+	if err == nil && r.ReadAhead > 0 {
+		r.scheduleReadAhead(options.Handle, options.Offset, int64(dataRead))
+	}
+	return dataRead, err
+}
+
+// scheduleReadAhead : adapt the read ahead window to the access pattern and prefetch blocks in background
+func (r *ReadCache) scheduleReadAhead(handle *handlemap.Handle, offset int64, length int64) {
+	val, found := handle.GetValue(readAheadKey)
+	if !found {
+		return
+	}
+	ra := val.(*readAhead)
+	ra.Lock()
+	defer ra.Unlock()
+
+	currentBlock := offset - (offset % r.BlockSize)
+	if offset == ra.nextOffset {
+		// grow the window each time a sequential reader moves on to the next block
+		if currentBlock != ra.lastBlock {
+			ra.window = ra.window*2 + 1
+			if ra.window > r.ReadAhead {
+				ra.window = r.ReadAhead
+			}
+		}
+	} else {
+		// random access, shrink the window and restart prefetching from the new position
+		ra.window /= 2
+		ra.prefetchedTo = 0
+	}
+	ra.nextOffset = offset + length
+	ra.lastBlock = currentBlock
+
+	start := currentBlock + r.BlockSize
+	if ra.prefetchedTo > start {
+		start = ra.prefetchedTo
+	}
+	end := currentBlock + (ra.window+1)*r.BlockSize
+	size := atomic.LoadInt64(&handle.Size)
+
+	for ; start < end && start < size; start += r.BlockSize {
+		ra.wg.Add(1)
+		go r.prefetch(handle, ra, start)
+		ra.prefetchedTo = start + r.BlockSize
+	}
+}
+
+// prefetch : download the block at given offset into the handle cache
+func (r *ReadCache) prefetch(handle *handlemap.Handle, ra *readAhead, offset int64) {
+	defer ra.wg.Done()
+
+	block, exists, err := r.getBlock(handle, offset)
+	if err != nil {
+		log.Warn("Stream::prefetch : failed to prefetch block of %s with offset %d [%s]", handle.Path, offset, err.Error())
+		return
+	}
+
+	if !exists {
+		// mark the block before unlocking it so a reader waiting on this block sees it as prefetched
+		ra.Lock()
+		if ra.pending[offset] {
+			// block was prefetched earlier but got evicted before anyone read it
+			streamStatsCollector.UpdateStats(stats_manager.Increment, prefetchWaste, (int64)(1))
+		}
+		ra.pending[offset] = true
+		ra.Unlock()
+		streamStatsCollector.UpdateStats(stats_manager.Increment, prefetchBlocks, (int64)(1))
+	}
+	r.unlockBlock(block, exists)
+}
+
+// consumePrefetched : account a read served from a prefetched block
+func (r *ReadCache) consumePrefetched(handle *handlemap.Handle, offset int64) {
+	val, found := handle.GetValue(readAheadKey)
+	if !found {
+		return
+	}
+	ra := val.(*readAhead)
+	ra.Lock()
+	if ra.pending[offset] {
+		delete(ra.pending, offset)
+		streamStatsCollector.UpdateStats(stats_manager.Increment, prefetchHits, (int64)(1))
+	}
+	ra.Unlock()
+}
+
+// stopReadAhead : wait for prefetch requests in flight and account blocks which were never read
+func (r *ReadCache) stopReadAhead(handle *handlemap.Handle) {
+	val, found := handle.GetValue(readAheadKey)
+	if !found {
+		return
+	}
+	ra := val.(*readAhead)
+	ra.wg.Wait()
+	ra.Lock()
+	streamStatsCollector.UpdateStats(stats_manager.Increment, prefetchWaste, int64(len(ra.pending)))
+	ra.pending = make(map[int64]bool)
+	ra.Unlock()
+	handle.RemoveValue(readAheadKey)
 }
 
 func (r *ReadCache) CloseFile(options internal.CloseFileOptions) error {
 	// log.Trace("Stream::CloseFile : name=%s, handle=%d", options.Handle.Path, options.Handle.ID)
+	r.stopReadAhead(options.Handle)
 	err := r.NextComponent().CloseFile(options)
 	if err != nil {
 		log.Err("Stream::CloseFile : error closing file %s [%s]", options.Handle.Path, err.Error())
@@ -38,6 +38,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -698,6 +699,151 @@ func (suite *streamTestSuite) TestAsyncClose() {
 	wg.Wait()
 }
 
+func (suite *streamTestSuite) TestReadAheadConfig() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := "stream:\n  block-size-mb: 4\n  buffer-size-mb: 16\n  max-buffers: 4\n  read-ahead-blocks: 10\n"
+	suite.setupTestHelper(config, true)
+
+	// read ahead is capped so that prefetched blocks do not evict the block being read
+	suite.assert.EqualValues(3, suite.stream.ReadAhead)
+
+	suite.cleanupTest()
+	config = "stream:\n  block-size-mb: 4\n  buffer-size-mb: 16\n  max-buffers: 4\n"
+	suite.setupTestHelper(config, true)
+	suite.assert.EqualValues(0, suite.stream.ReadAhead)
+}
+
+func (suite *streamTestSuite) TestReadAheadSequential() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := "stream:\n  block-size-mb: 1\n  buffer-size-mb: 8\n  max-buffers: 2\n  read-ahead-blocks: 4\n"
+	suite.setupTestHelper(config, true)
+
+	fileSize := 8 * MB
+	data := *getBlockData(suite, fileSize)
+	handle := handlemap.NewHandle(fileNames[0])
+	handle.Size = int64(fileSize)
+	openFileOptions := internal.OpenFileOptions{Name: fileNames[0], Flags: os.O_RDONLY, Mode: os.FileMode(0777)}
+
+	var downloads int32
+	suite.mock.EXPECT().OpenFile(openFileOptions).Return(handle, nil)
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		atomic.AddInt32(&downloads, 1)
+		return copy(options.Data, data[options.Offset:]), nil
+	}).AnyTimes()
+
+	_, _ = suite.stream.OpenFile(openFileOptions)
+
+	// first sequential read opens the window by one block
+	output := make([]byte, 64*1024)
+	n, err := suite.stream.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(len(output), n)
+	val, _ := handle.GetValue(readAheadKey)
+	ra := val.(*readAhead)
+	ra.wg.Wait()
+	suite.assert.EqualValues(1, ra.window)
+	assertBlockCached(suite, int64(MB), handle)
+
+	for offset := int64(len(output)); offset < int64(fileSize); offset += int64(len(output)) {
+		n, err = suite.stream.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: output})
+		suite.assert.Nil(err)
+		suite.assert.Equal(len(output), n)
+		suite.assert.Equal(data[offset:offset+int64(n)], output)
+	}
+	ra.wg.Wait()
+
+	// window grows up to the configured limit and every block is downloaded exactly once
+	suite.assert.EqualValues(4, ra.window)
+	suite.assert.EqualValues(8, atomic.LoadInt32(&downloads))
+	suite.assert.Empty(ra.pending)
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	_ = suite.stream.CloseFile(internal.CloseFileOptions{Handle: handle})
+	_, found := handle.GetValue(readAheadKey)
+	suite.assert.False(found)
+}
+
+func (suite *streamTestSuite) TestReadAheadRandomAccess() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := "stream:\n  block-size-mb: 1\n  buffer-size-mb: 8\n  max-buffers: 2\n  read-ahead-blocks: 4\n"
+	suite.setupTestHelper(config, true)
+
+	fileSize := 8 * MB
+	data := *getBlockData(suite, fileSize)
+	handle := handlemap.NewHandle(fileNames[0])
+	handle.Size = int64(fileSize)
+	openFileOptions := internal.OpenFileOptions{Name: fileNames[0], Flags: os.O_RDONLY, Mode: os.FileMode(0777)}
+
+	suite.mock.EXPECT().OpenFile(openFileOptions).Return(handle, nil)
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		return copy(options.Data, data[options.Offset:]), nil
+	}).AnyTimes()
+
+	_, _ = suite.stream.OpenFile(openFileOptions)
+	val, _ := handle.GetValue(readAheadKey)
+	ra := val.(*readAhead)
+
+	// jumping around the file never opens the window
+	output := make([]byte, 1024)
+	for _, offset := range []int64{int64(5 * MB), int64(2 * MB), int64(7 * MB), int64(3 * MB)} {
+		_, err := suite.stream.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: offset, Data: output})
+		suite.assert.Nil(err)
+		suite.assert.Equal(data[offset:offset+1024], output)
+	}
+	ra.wg.Wait()
+	suite.assert.EqualValues(0, ra.window)
+	assertBlockNotCached(suite, int64(4*MB), handle)
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	_ = suite.stream.CloseFile(internal.CloseFileOptions{Handle: handle})
+}
+
+func (suite *streamTestSuite) TestReadAheadFailedPrefetch() {
+	defer suite.cleanupTest()
+	suite.cleanupTest()
+	config := "stream:\n  block-size-mb: 1\n  buffer-size-mb: 8\n  max-buffers: 2\n  read-ahead-blocks: 4\n"
+	suite.setupTestHelper(config, true)
+
+	fileSize := 4 * MB
+	data := *getBlockData(suite, fileSize)
+	handle := handlemap.NewHandle(fileNames[0])
+	handle.Size = int64(fileSize)
+	openFileOptions := internal.OpenFileOptions{Name: fileNames[0], Flags: os.O_RDONLY, Mode: os.FileMode(0777)}
+
+	var failed int32
+	prefetching := make(chan struct{})
+	suite.mock.EXPECT().OpenFile(openFileOptions).Return(handle, nil)
+	suite.mock.EXPECT().ReadInBuffer(gomock.Any()).DoAndReturn(func(options internal.ReadInBufferOptions) (int, error) {
+		if options.Offset == int64(MB) && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+			// the prefetch of the second block fails while the reader is waiting for it
+			close(prefetching)
+			time.Sleep(50 * time.Millisecond)
+			return 0, syscall.EIO
+		}
+		return copy(options.Data, data[options.Offset:]), nil
+	}).AnyTimes()
+
+	_, _ = suite.stream.OpenFile(openFileOptions)
+
+	output := make([]byte, MB)
+	_, err := suite.stream.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: 0, Data: output})
+	suite.assert.Nil(err)
+	<-prefetching
+
+	// the reader refetches the block instead of copying the data of the failed prefetch
+	n, err := suite.stream.ReadInBuffer(internal.ReadInBufferOptions{Handle: handle, Offset: int64(MB), Data: output})
+	suite.assert.Nil(err)
+	suite.assert.Equal(MB, n)
+	suite.assert.Equal(data[MB:2*MB], output)
+	suite.assert.EqualValues(1, atomic.LoadInt32(&failed))
+
+	suite.mock.EXPECT().CloseFile(internal.CloseFileOptions{Handle: handle}).Return(nil)
+	_ = suite.stream.CloseFile(internal.CloseFileOptions{Handle: handle})
+}
+
 func TestStreamTestSuite(t *testing.T) {
 	suite.Run(t, new(streamTestSuite))
 }
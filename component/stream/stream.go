@@ -37,11 +37,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"syscall"
 
 	"github.com/Azure/azure-storage-fuse/v2/common/config"
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 	"github.com/Azure/azure-storage-fuse/v2/internal"
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
+	"github.com/Azure/azure-storage-fuse/v2/internal/stats_manager"
 
 	"github.com/pbnjay/memory"
 )
@@ -53,7 +55,8 @@ type Stream struct {
 	BufferSize     uint64 // maximum number of blocks allowed to be stored for a file
 	CachedObjLimit int32
 	CachedObjects  int32
-	StreamOnly     bool // parameter used to check if its pure streaming
+	StreamOnly     bool  // parameter used to check if its pure streaming
+	ReadAhead      int64 // maximum number of blocks to be prefetched for sequential reads
 }
 
 type StreamOptions struct {
@@ -61,6 +64,7 @@ type StreamOptions struct {
 	BufferSize     uint64 `config:"buffer-size-mb" yaml:"buffer-size-mb,omitempty"`
 	CachedObjLimit uint64 `config:"max-buffers" yaml:"max-buffers,omitempty"`
 	FileCaching    bool   `config:"file-caching" yaml:"file-caching,omitempty"`
+	ReadAhead      uint64 `config:"read-ahead-blocks" yaml:"read-ahead-blocks,omitempty"`
 	readOnly       bool   `config:"read-only" yaml:"-"`
 
 	// v1 support
@@ -75,6 +79,8 @@ const (
 
 var _ internal.Component = &Stream{}
 
+var streamStatsCollector *stats_manager.StatsCollector
+
 func (st *Stream) Name() string {
 	return compName
 }
@@ -93,6 +99,10 @@ func (st *Stream) Priority() internal.ComponentPriority {
 
 func (st *Stream) Start(ctx context.Context) error {
 	log.Trace("Starting component : %s", st.Name())
+
+	// create stats collector for stream
+	streamStatsCollector = stats_manager.NewStatsCollector(st.Name())
+
 	return nil
 }
 
@@ -129,8 +139,8 @@ func (st *Stream) Configure(_ bool) error {
 	}
 	st.cache = NewStreamConnection(conf, st)
 
-	log.Info("Stream::Configure : Buffer size %v, Block size %v, Handle limit %v",
-		conf.BufferSize, conf.BlockSize, conf.CachedObjLimit)
+	log.Info("Stream::Configure : Buffer size %v, Block size %v, Handle limit %v, Read ahead %v",
+		conf.BufferSize, conf.BlockSize, conf.CachedObjLimit, conf.ReadAhead)
 
 	return nil
 }
@@ -138,7 +148,9 @@ func (st *Stream) Configure(_ bool) error {
 // Stop : Stop the component functionality and kill all threads started
 func (st *Stream) Stop() error {
 	log.Trace("Stopping component : %s", st.Name())
-	return st.cache.Stop()
+	err := st.cache.Stop()
+	streamStatsCollector.Destroy()
+	return err
 }
 
 func (st *Stream) CreateFile(options internal.CreateFileOptions) (*handlemap.Handle, error) {
@@ -153,6 +165,11 @@ func (st *Stream) ReadInBuffer(options internal.ReadInBufferOptions) (int, error
 	return st.cache.ReadInBuffer(options)
 }
 
+// CopyFileRange : Open handles may hold data in blocks not uploaded yet, so copies go through the regular data path
+func (st *Stream) CopyFileRange(_ internal.CopyFileRangeOptions) (int64, error) {
+	return 0, syscall.ENOTSUP
+}
+
 func (st *Stream) WriteFile(options internal.WriteFileOptions) (int, error) {
 	return st.cache.WriteFile(options)
 }
@@ -212,4 +229,7 @@ func init() {
 	streamCacheSize := config.AddUint64Flag("stream-cache-mb", 0, "Limit total amount of data being cached in memory to conserve memory footprint of blobfuse.")
 	config.BindPFlag(compName+".stream-cache-mb", streamCacheSize)
 	streamCacheSize.Hidden = true
+
+	readAhead := config.AddUint64Flag("read-ahead-blocks", 0, "Maximum number of blocks to be prefetched when a file is read sequentially.")
+	config.BindPFlag(compName+".read-ahead-blocks", readAhead)
 }
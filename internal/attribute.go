@@ -35,6 +35,7 @@ package internal
 
 import (
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common"
@@ -68,6 +69,18 @@ const (
 	PropFlagModeDefault // TODO: Does this sound better as ModeDefault or DefaultMode? The getter would be IsModeDefault or IsDefaultMode
 )
 
+// Extended attributes in the user namespace are mapped to the metadata of the object
+const XattrUserPrefix = "user."
+
+// Virtual extended attributes exposing properties of the object like its access tier, etag and index tags
+const XattrBlobfusePrefix = "system.blobfuse."
+
+// Flags of a set extended attribute call, same as XATTR_CREATE and XATTR_REPLACE of setxattr(2)
+const (
+	XattrCreate  = 0x1 // fail if the attribute already exists
+	XattrReplace = 0x2 // fail if the attribute does not exist
+)
+
 // ObjAttr : Attributes of any file/directory
 type ObjAttr struct {
 	Mtime    time.Time       // modified time
@@ -80,6 +93,7 @@ type ObjAttr struct {
 	Path     string          // full path
 	Name     string          // base name of the path
 	MD5      []byte
+	ETag     string            // entity tag, changes every time the object is modified
 	Metadata map[string]string // extra information to preserve
 }
 
@@ -104,3 +118,16 @@ func (attr *ObjAttr) IsMetadataRetrieved() bool {
 func (attr *ObjAttr) IsModeDefault() bool {
 	return attr.Flags.IsSet(PropFlagModeDefault)
 }
+
+// GetMetadata : Look up a metadata key, keys are matched case insensitively as storage does not preserve their case
+func (attr *ObjAttr) GetMetadata(key string) (string, bool) {
+	if value, found := attr.Metadata[key]; found {
+		return value, true
+	}
+	for k, v := range attr.Metadata {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -224,6 +224,13 @@ func (base *BaseComponent) CopyFromFile(options CopyFromFileOptions) error {
 	return nil
 }
 
+func (base *BaseComponent) CopyFileRange(options CopyFileRangeOptions) (int64, error) {
+	if base.next != nil {
+		return base.next.CopyFileRange(options)
+	}
+	return 0, syscall.ENOTSUP
+}
+
 func (base *BaseComponent) SyncFile(options SyncFileOptions) error {
 	if base.next != nil {
 		return base.next.SyncFile(options)
@@ -245,6 +252,13 @@ func (base *BaseComponent) FlushFile(options FlushFileOptions) error {
 	return nil
 }
 
+func (base *BaseComponent) LockFile(options LockFileOptions) error {
+	if base.next != nil {
+		return base.next.LockFile(options)
+	}
+	return syscall.ENOTSUP
+}
+
 func (base *BaseComponent) ReleaseFile(options ReleaseFileOptions) error {
 	if base.next != nil {
 		return base.next.ReleaseFile(options)
@@ -274,6 +288,35 @@ func (base *BaseComponent) ReadLink(options ReadLinkOptions) (string, error) {
 	return "", nil
 }
 
+// Extended attribute operations
+func (base *BaseComponent) GetXattr(options GetXattrOptions) ([]byte, error) {
+	if base.next != nil {
+		return base.next.GetXattr(options)
+	}
+	return nil, syscall.ENOTSUP
+}
+
+func (base *BaseComponent) SetXattr(options SetXattrOptions) error {
+	if base.next != nil {
+		return base.next.SetXattr(options)
+	}
+	return syscall.ENOTSUP
+}
+
+func (base *BaseComponent) ListXattr(options ListXattrOptions) ([]string, error) {
+	if base.next != nil {
+		return base.next.ListXattr(options)
+	}
+	return []string{}, nil
+}
+
+func (base *BaseComponent) RemoveXattr(options RemoveXattrOptions) error {
+	if base.next != nil {
+		return base.next.RemoveXattr(options)
+	}
+	return syscall.ENOTSUP
+}
+
 // Filesystem level operations
 func (base *BaseComponent) GetAttr(options GetAttrOptions) (*ObjAttr, error) {
 	if base.next != nil {
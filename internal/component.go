@@ -65,6 +65,14 @@ func (ComponentPriority) LevelTwo() ComponentPriority {
 	return ComponentPriority(300)
 }
 
+func (ComponentPriority) LevelThree() ComponentPriority {
+	return ComponentPriority(200)
+}
+
+func (ComponentPriority) LevelFour() ComponentPriority {
+	return ComponentPriority(150)
+}
+
 // Component : Base internal for every component to participate in pipeline
 type Component interface {
 	// Pipeline participation related methods
@@ -113,10 +121,17 @@ type Component interface {
 
 	CopyToFile(CopyToFileOptions) error
 	CopyFromFile(CopyFromFileOptions) error
+	//CopyFileRange: Implementation expectations:
+	//1. must return ENOTSUP when the copy can not be done without moving the data through this process
+	CopyFileRange(CopyFileRangeOptions) (int64, error)
 
 	SyncDir(SyncDirOptions) error
 	SyncFile(SyncFileOptions) error
 	FlushFile(FlushFileOptions) error
+	//LockFile: Implementation expectations:
+	//1. must return EWOULDBLOCK when the lock is held by someone else and Wait is not set
+	//2. must return ENOTSUP when locks can not be shared with other mounts
+	LockFile(LockFileOptions) error
 	ReleaseFile(ReleaseFileOptions) error
 	UnlinkFile(UnlinkFileOptions) error // TODO: What does this do? Not used anywhere
 
@@ -124,6 +139,15 @@ type Component interface {
 	CreateLink(CreateLinkOptions) error
 	ReadLink(ReadLinkOptions) (string, error)
 
+	// Extended attribute operations
+	//GetXattr: Implementation expectations:
+	//1. must return ENODATA for absence of the attribute
+	//2. must return ENOTSUP for a namespace which is not supported
+	GetXattr(GetXattrOptions) ([]byte, error)
+	SetXattr(SetXattrOptions) error
+	ListXattr(ListXattrOptions) ([]string, error)
+	RemoveXattr(RemoveXattrOptions) error
+
 	// Filesystem level operations
 	//GetAttr: Implementation expectations:
 	//1. must return ErrNotExist for absence of a file/directory/symlink
@@ -34,30 +34,40 @@
 package internal
 
 import (
+	"context"
+	"io"
 	"os"
 
 	"github.com/Azure/azure-storage-fuse/v2/internal/handlemap"
 )
 
+// Ctx in each of the options carries the span of the FUSE operation which led to the call, see common/tracing.
+// It is nil for calls which are not part of a traced FUSE operation.
+
 type CreateDirOptions struct {
 	Name string
 	Mode os.FileMode
+	Ctx  context.Context
 }
 
 type DeleteDirOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type IsDirEmptyOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type OpenDirOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type ReadDirOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type StreamDirOptions struct {
@@ -65,49 +75,59 @@ type StreamDirOptions struct {
 	Offset uint64
 	Token  string
 	Count  int32
+	Ctx    context.Context
 }
 
 type CloseDirOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type RenameDirOptions struct {
 	Src string
 	Dst string
+	Ctx context.Context
 }
 
 type CreateFileOptions struct {
 	Name string
 	Mode os.FileMode
+	Ctx  context.Context
 }
 
 type DeleteFileOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type OpenFileOptions struct {
 	Name  string
 	Flags int
 	Mode  os.FileMode
+	Ctx   context.Context
 }
 
 type CloseFileOptions struct {
 	Handle *handlemap.Handle
+	Ctx    context.Context
 }
 
 type RenameFileOptions struct {
 	Src string
 	Dst string
+	Ctx context.Context
 }
 
 type ReadFileOptions struct {
 	Handle *handlemap.Handle
+	Ctx    context.Context
 }
 
 type ReadInBufferOptions struct {
 	Handle *handlemap.Handle
 	Offset int64
 	Data   []byte
+	Ctx    context.Context
 }
 
 type WriteFileOptions struct {
@@ -115,15 +135,18 @@ type WriteFileOptions struct {
 	Offset   int64
 	Data     []byte
 	Metadata map[string]string
+	Ctx      context.Context
 }
 
 type GetFileBlockOffsetsOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type TruncateFileOptions struct {
 	Name string
 	Size int64
+	Ctx  context.Context
 }
 
 type CopyToFileOptions struct {
@@ -131,62 +154,145 @@ type CopyToFileOptions struct {
 	Offset int64
 	Count  int64
 	File   *os.File
+	Ctx    context.Context
 }
 
 type CopyFromFileOptions struct {
 	Name     string
 	File     *os.File
+	Reader   io.ReaderAt // Data to upload when it is not held in a local file as it is, File is not used when set
+	Size     int64       // Size of the data in Reader
 	Metadata map[string]string
+	ETag     string            // Upload only if the blob still has this ETag, empty to overwrite unconditionally
+	Handle   *handlemap.Handle // Handle the data is uploaded for, its ETag is set to the one of the new blob when given
+	Ctx      context.Context
+}
+
+type CopyFileRangeOptions struct {
+	SrcHandle *handlemap.Handle
+	SrcOffset int64
+	DstHandle *handlemap.Handle
+	DstOffset int64
+	Size      int64
+	Ctx       context.Context
 }
 
 type FlushFileOptions struct {
 	Handle *handlemap.Handle
+	Ctx    context.Context
+}
+
+// Kinds of lock handled by LockFile, same meaning as the operations of flock(2)
+const (
+	LockUnlock    = iota // release the lock held through the handle
+	LockShared           // other shared locks are allowed at the same time
+	LockExclusive        // one holder only, across every mount of the container
+)
+
+type LockFileOptions struct {
+	Handle *handlemap.Handle
+	Type   int
+	Wait   bool // block till the lock is granted instead of failing with EWOULDBLOCK
+	Test   bool // only report whether the lock could be granted, nothing gets locked
+	Ctx    context.Context
+
+	// Reports the caller gave up on a blocking request, checked between retries. Must be called on the thread of the request.
+	Interrupted func() bool
 }
 
 type SyncFileOptions struct {
 	Handle *handlemap.Handle
+	Ctx    context.Context
 }
 
 type SyncDirOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type ReleaseFileOptions struct {
 	Handle *handlemap.Handle
+	Ctx    context.Context
 }
 
 type UnlinkFileOptions struct {
 	Name string
+	Ctx  context.Context
 }
 
 type CreateLinkOptions struct {
 	Name   string
 	Target string
+	Ctx    context.Context
 }
 
 type ReadLinkOptions struct {
 	Name string
+	Ctx  context.Context
+}
+
+type GetXattrOptions struct {
+	Name string
+	Attr string
+	Ctx  context.Context
+}
+
+type SetXattrOptions struct {
+	Name  string
+	Attr  string
+	Value []byte
+	Flags int
+	Ctx   context.Context
+}
+
+type ListXattrOptions struct {
+	Name string
+	Ctx  context.Context
+}
+
+type RemoveXattrOptions struct {
+	Name string
+	Attr string
+	Ctx  context.Context
 }
 
 type GetAttrOptions struct {
 	Name             string
 	RetrieveMetadata bool
+	Refresh          bool // do not serve attributes cached by the components above storage
+	Ctx              context.Context
 }
 
 type SetAttrOptions struct {
 	Name string
 	Attr *ObjAttr
+	Ctx  context.Context
 }
 
 type ChmodOptions struct {
 	Name string
 	Mode os.FileMode
+	Ctx  context.Context
 }
 
 type ChownOptions struct {
 	Name  string
 	Owner int
 	Group int
+	Ctx   context.Context
+}
+
+// UploadSource : Data to upload and its size, read from Reader when it is set and from File otherwise
+func (options CopyFromFileOptions) UploadSource() (io.ReaderAt, int64, error) {
+	if options.Reader != nil {
+		return options.Reader, options.Size, nil
+	}
+
+	info, err := options.File.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return options.File, info.Size(), nil
 }
 
 func TruncateDirName(name string) string {
@@ -76,6 +76,7 @@ type Handle struct {
 	OptCnt   uint64                 // Number of operations done on this file
 	Flags    common.BitMap16        // Various states of the file
 	Path     string                 // Always holds path relative to mount dir
+	ETag     string                 // ETag of the blob seen when this handle was opened
 	values   map[string]interface{} // Map to hold other info if application wants to store
 }
 
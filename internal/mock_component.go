@@ -142,6 +142,21 @@ func (mr *MockComponentMockRecorder) Configure(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Configure", reflect.TypeOf((*MockComponent)(nil).Configure), arg0)
 }
 
+// CopyFileRange mocks base method.
+func (m *MockComponent) CopyFileRange(arg0 CopyFileRangeOptions) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyFileRange", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CopyFileRange indicates an expected call of CopyFileRange.
+func (mr *MockComponentMockRecorder) CopyFileRange(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyFileRange", reflect.TypeOf((*MockComponent)(nil).CopyFileRange), arg0)
+}
+
 // CopyFromFile mocks base method.
 func (m *MockComponent) CopyFromFile(arg0 CopyFromFileOptions) error {
 	m.ctrl.T.Helper()
@@ -325,6 +340,78 @@ func (mr *MockComponentMockRecorder) GetFileBlockOffsets(arg0 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileBlockOffsets", reflect.TypeOf((*MockComponent)(nil).GetFileBlockOffsets), arg0)
 }
 
+// GetXattr mocks base method.
+func (m *MockComponent) GetXattr(arg0 GetXattrOptions) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetXattr", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetXattr indicates an expected call of GetXattr.
+func (mr *MockComponentMockRecorder) GetXattr(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetXattr", reflect.TypeOf((*MockComponent)(nil).GetXattr), arg0)
+}
+
+// ListXattr mocks base method.
+func (m *MockComponent) ListXattr(arg0 ListXattrOptions) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListXattr", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListXattr indicates an expected call of ListXattr.
+func (mr *MockComponentMockRecorder) ListXattr(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListXattr", reflect.TypeOf((*MockComponent)(nil).ListXattr), arg0)
+}
+
+// RemoveXattr mocks base method.
+func (m *MockComponent) RemoveXattr(arg0 RemoveXattrOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveXattr", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveXattr indicates an expected call of RemoveXattr.
+func (mr *MockComponentMockRecorder) RemoveXattr(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveXattr", reflect.TypeOf((*MockComponent)(nil).RemoveXattr), arg0)
+}
+
+// SetXattr mocks base method.
+func (m *MockComponent) SetXattr(arg0 SetXattrOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetXattr", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetXattr indicates an expected call of SetXattr.
+func (mr *MockComponentMockRecorder) SetXattr(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetXattr", reflect.TypeOf((*MockComponent)(nil).SetXattr), arg0)
+}
+
+// LockFile mocks base method.
+func (m *MockComponent) LockFile(arg0 LockFileOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockFile", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockFile indicates an expected call of LockFile.
+func (mr *MockComponentMockRecorder) LockFile(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockFile", reflect.TypeOf((*MockComponent)(nil).LockFile), arg0)
+}
+
 // IsDirEmpty mocks base method.
 func (m *MockComponent) IsDirEmpty(arg0 IsDirEmptyOptions) bool {
 	m.ctrl.T.Helper()
@@ -0,0 +1,268 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package stats_manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+)
+
+const (
+	metricsPath              = "/metrics"
+	openMetricsContentType   = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusContentType    = "text/plain; version=0.0.4; charset=utf-8"
+	componentStatMetric      = "blobfuse2_component_stat"
+	componentCountMetric     = "blobfuse2_component_events"
+	operationLatencyMetric   = "blobfuse2_operation_latency_seconds"
+	DefaultMetricsListenAddr = "localhost:9464"
+)
+
+// Units of the sizes some components report as text, e.g. "12.5 MB"
+var sizeUnits = map[string]float64{"B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+
+// Upper bounds of the latency buckets in seconds, from a cached attribute lookup to a large blob transfer
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type latencyHistogram struct {
+	buckets []uint64 // observations per bucket, not cumulative
+	count   uint64
+	sum     float64
+}
+
+// latencies of each operation, keyed by component and then operation
+var latencies = struct {
+	sync.Mutex
+	ops map[string]map[string]*latencyHistogram
+}{ops: make(map[string]map[string]*latencyHistogram)}
+
+var metricsServer *http.Server
+
+// ObserveLatency : Record the time taken by an operation of the component, only kept while the metrics endpoint is enabled
+func (sc *StatsCollector) ObserveLatency(op string, d time.Duration) {
+	if sc == nil || !common.EnableMetrics {
+		return
+	}
+
+	latencies.Lock()
+	defer latencies.Unlock()
+
+	compOps, found := latencies.ops[sc.compName]
+	if !found {
+		compOps = make(map[string]*latencyHistogram)
+		latencies.ops[sc.compName] = compOps
+	}
+
+	h, found := compOps[op]
+	if !found {
+		h = &latencyHistogram{buckets: make([]uint64, len(latencyBuckets)+1)}
+		compOps[op] = h
+	}
+
+	secs := d.Seconds()
+	idx := sort.SearchFloat64s(latencyBuckets, secs)
+	h.buckets[idx]++
+	h.count++
+	h.sum += secs
+}
+
+// StartMetricsServer : Serve the stats of every component over http in OpenMetrics format
+func StartMetricsServer(addr string) {
+	if addr == "" {
+		addr = DefaultMetricsListenAddr
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, serveMetrics)
+	metricsServer = &http.Server{Addr: addr, Handler: mux}
+
+	log.Info("stats_manager::StartMetricsServer : Serving metrics on http://%s%s", addr, metricsPath)
+	go func() {
+		err := metricsServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Err("stats_manager::StartMetricsServer : Failed to serve metrics on %s [%s]", addr, err.Error())
+		}
+	}()
+}
+
+// StopMetricsServer : Stop serving the metrics
+func StopMetricsServer() {
+	if metricsServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = metricsServer.Shutdown(ctx)
+	metricsServer = nil
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+
+	writeMetrics(w, openMetrics)
+}
+
+// writeMetrics : Write the stats collected so far, the OpenMetrics format has to be terminated with an EOF marker
+func writeMetrics(w io.Writer, openMetrics bool) {
+	writeComponentStats(w, openMetrics)
+	writeLatencies(w)
+
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// writeComponentStats : Stats which only count up, like requests and errors, are counters, the rest are gauges.
+// A counter family is named without the _total suffix of its samples in OpenMetrics, and with it in Prometheus text format.
+func writeComponentStats(w io.Writer, openMetrics bool) {
+	var counters, gauges []string
+
+	stMgrOpt.statsMtx.Lock()
+	for idx, cmpSt := range stMgrOpt.statsList {
+		keys := make([]string, 0, len(cmpSt.Value))
+		for k := range cmpSt.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			val, ok := statValue(cmpSt.Value[k])
+			if !ok {
+				continue
+			}
+
+			labels := fmt.Sprintf("{component=\"%s\",stat=\"%s\"} %v\n", escapeLabel(cmpSt.ComponentName), escapeLabel(k), val)
+			if stMgrOpt.gaugeStats[idx][k] {
+				gauges = append(gauges, componentStatMetric+labels)
+			} else {
+				counters = append(counters, componentCountMetric+"_total"+labels)
+			}
+		}
+	}
+	stMgrOpt.statsMtx.Unlock()
+
+	counterFamily := componentCountMetric
+	if !openMetrics {
+		counterFamily += "_total"
+	}
+	fmt.Fprintf(w, "# HELP %s Events counted by the components of the mount, e.g. requests, retries and errors\n", counterFamily)
+	fmt.Fprintf(w, "# TYPE %s counter\n", counterFamily)
+	for _, sample := range counters {
+		fmt.Fprint(w, sample)
+	}
+
+	fmt.Fprintf(w, "# HELP %s Current values reported by the components of the mount, sizes are in bytes\n", componentStatMetric)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", componentStatMetric)
+	for _, sample := range gauges {
+		fmt.Fprint(w, sample)
+	}
+}
+
+func writeLatencies(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s Time taken by the operations of each component\n", operationLatencyMetric)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", operationLatencyMetric)
+
+	latencies.Lock()
+	defer latencies.Unlock()
+
+	comps := make([]string, 0, len(latencies.ops))
+	for comp := range latencies.ops {
+		comps = append(comps, comp)
+	}
+	sort.Strings(comps)
+
+	for _, comp := range comps {
+		ops := make([]string, 0, len(latencies.ops[comp]))
+		for op := range latencies.ops[comp] {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+
+		for _, op := range ops {
+			h := latencies.ops[comp][op]
+			labels := fmt.Sprintf("component=\"%s\",operation=\"%s\"", escapeLabel(comp), escapeLabel(op))
+
+			var cumulative uint64
+			for i, le := range latencyBuckets {
+				cumulative += h.buckets[i]
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%v\"} %d\n", operationLatencyMetric, labels, le, cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", operationLatencyMetric, labels, h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %v\n", operationLatencyMetric, labels, h.sum)
+			fmt.Fprintf(w, "%s_count{%s} %d\n", operationLatencyMetric, labels, h.count)
+		}
+	}
+}
+
+// statValue : numeric value of a stat, a size reported as text like "12.5 MB" is converted to bytes,
+// other text like "40%" reports its leading number
+func statValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case string:
+		var f float64
+		var unit string
+		n, _ := fmt.Sscanf(val, "%g%s", &f, &unit)
+		if n == 0 {
+			return 0, false
+		}
+		if scale, found := sizeUnits[strings.ToUpper(unit)]; found {
+			f *= scale
+		}
+		return f, true
+	default:
+		return 0, false
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s)
+}
@@ -0,0 +1,170 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package stats_manager
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type metricsTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+}
+
+func (suite *metricsTestSuite) SetupTest() {
+	suite.assert = assert.New(suite.T())
+	common.EnableMetrics = true
+}
+
+func (suite *metricsTestSuite) TearDownTest() {
+	common.EnableMetrics = false
+}
+
+func (suite *metricsTestSuite) TestComponentStats() {
+	sc := NewStatsCollector("metrics_comp")
+	sc.UpdateStats(Increment, "Requests", (int64)(1))
+	sc.UpdateStats(Increment, "Requests", (int64)(2))
+	sc.UpdateStats(Replace, "Usage", "12.5 MB")
+	sc.UpdateStats(Replace, "UsagePercent", "40.5%")
+	sc.UpdateStats(Replace, "Name", "not a number")
+	sc.UpdateStats(Increment, "Handles", (int64)(2))
+	sc.UpdateStats(Decrement, "Handles", (int64)(1))
+	sc.Destroy()
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, false)
+	out := buf.String()
+
+	// Stats which only count up are counters, the family carries the suffix in Prometheus text format
+	suite.assert.Contains(out, "# TYPE blobfuse2_component_events_total counter\n")
+	suite.assert.Contains(out, "blobfuse2_component_events_total{component=\"metrics_comp\",stat=\"Requests\"} 3\n")
+	suite.assert.NotContains(out, "blobfuse2_component_stat{component=\"metrics_comp\",stat=\"Requests\"}")
+
+	// Sizes are reported in bytes
+	suite.assert.Contains(out, "# TYPE blobfuse2_component_stat gauge\n")
+	suite.assert.Contains(out, "blobfuse2_component_stat{component=\"metrics_comp\",stat=\"Usage\"} 1.31072e+07\n")
+	suite.assert.Contains(out, "blobfuse2_component_stat{component=\"metrics_comp\",stat=\"UsagePercent\"} 40.5\n")
+	suite.assert.Contains(out, "blobfuse2_component_stat{component=\"metrics_comp\",stat=\"Handles\"} 1\n")
+	suite.assert.NotContains(out, "stat=\"Name\"")
+	suite.assert.NotContains(out, "# EOF")
+
+	buf.Reset()
+	writeMetrics(&buf, true)
+	out = buf.String()
+	suite.assert.Contains(out, "# TYPE blobfuse2_component_events counter\n")
+	suite.assert.Contains(out, "blobfuse2_component_events_total{component=\"metrics_comp\",stat=\"Requests\"} 3\n")
+}
+
+func (suite *metricsTestSuite) TestStatValue() {
+	values := []struct {
+		stat     interface{}
+		expected float64
+	}{
+		{(int64)(7), 7}, {2.5, 2.5}, {"512 B", 512}, {"1.5 KB", 1536}, {"2 GB", 2 << 30}, {"3MB", 3 << 20}, {"40%", 40},
+	}
+	for _, v := range values {
+		val, ok := statValue(v.stat)
+		suite.assert.True(ok, v.stat)
+		suite.assert.Equal(v.expected, val, v.stat)
+	}
+
+	_, ok := statValue("n/a")
+	suite.assert.False(ok)
+	_, ok = statValue(true)
+	suite.assert.False(ok)
+}
+
+func (suite *metricsTestSuite) TestLatencyHistogram() {
+	sc := &StatsCollector{compName: "latency_comp"}
+	sc.ObserveLatency("read", 2*time.Millisecond)
+	sc.ObserveLatency("read", 2*time.Second)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, true)
+	out := buf.String()
+
+	labels := "component=\"latency_comp\",operation=\"read\""
+	suite.assert.Contains(out, "# TYPE blobfuse2_operation_latency_seconds histogram\n")
+	suite.assert.Contains(out, "blobfuse2_operation_latency_seconds_bucket{"+labels+",le=\"0.001\"} 0\n")
+	suite.assert.Contains(out, "blobfuse2_operation_latency_seconds_bucket{"+labels+",le=\"0.0025\"} 1\n")
+	suite.assert.Contains(out, "blobfuse2_operation_latency_seconds_bucket{"+labels+",le=\"2.5\"} 2\n")
+	suite.assert.Contains(out, "blobfuse2_operation_latency_seconds_bucket{"+labels+",le=\"+Inf\"} 2\n")
+	suite.assert.Contains(out, "blobfuse2_operation_latency_seconds_count{"+labels+"} 2\n")
+	suite.assert.True(bytes.HasSuffix(buf.Bytes(), []byte("# EOF\n")))
+}
+
+func (suite *metricsTestSuite) TestLatencyDisabled() {
+	common.EnableMetrics = false
+	sc := &StatsCollector{compName: "disabled_comp"}
+	sc.ObserveLatency("read", time.Millisecond)
+
+	var nilCollector *StatsCollector
+	nilCollector.ObserveLatency("read", time.Millisecond)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, false)
+	suite.assert.NotContains(buf.String(), "disabled_comp")
+}
+
+func (suite *metricsTestSuite) TestContentNegotiation() {
+	req := httptest.NewRequest(http.MethodGet, metricsPath, nil)
+	rec := httptest.NewRecorder()
+	serveMetrics(rec, req)
+	suite.assert.Equal(prometheusContentType, rec.Header().Get("Content-Type"))
+	suite.assert.NotContains(rec.Body.String(), "# EOF")
+
+	req = httptest.NewRequest(http.MethodGet, metricsPath, nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec = httptest.NewRecorder()
+	serveMetrics(rec, req)
+	suite.assert.Equal(openMetricsContentType, rec.Header().Get("Content-Type"))
+	suite.assert.Contains(rec.Body.String(), "# EOF")
+}
+
+func (suite *metricsTestSuite) TestEscapeLabel() {
+	suite.assert.Equal("a\\\"b\\\\c\\nd", escapeLabel("a\"b\\c\nd"))
+}
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, new(metricsTestSuite))
+}
@@ -51,6 +51,7 @@ type StatsCollector struct {
 	channel    chan ChannelMsg
 	workerDone sync.WaitGroup
 	compIdx    int
+	compName   string
 }
 
 type PipeMsg struct {
@@ -82,6 +83,8 @@ type ChannelMsg struct {
 
 type statsManagerOpt struct {
 	statsList []*PipeMsg
+	// stats of each component which were decremented or replaced, the others only count up
+	gaugeStats []map[string]bool
 	// map to store the last updated timestamp of component's stats
 	// This way a component's stat which was not updated is not pushed to the transfer pipe
 	cmpTimeMap  map[string]string
@@ -94,9 +97,9 @@ type statsManagerOpt struct {
 var stMgrOpt statsManagerOpt
 
 func NewStatsCollector(componentName string) *StatsCollector {
-	sc := &StatsCollector{}
+	sc := &StatsCollector{compName: componentName}
 
-	if common.MonitorBfs() {
+	if common.CollectStats() {
 		sc.channel = make(chan ChannelMsg, 10000)
 
 		stMgrOpt.statsMtx.Lock()
@@ -109,6 +112,7 @@ func NewStatsCollector(componentName string) *StatsCollector {
 			Value:         make(map[string]interface{}),
 		}
 		stMgrOpt.statsList = append(stMgrOpt.statsList, &cmpSt)
+		stMgrOpt.gaugeStats = append(stMgrOpt.gaugeStats, make(map[string]bool))
 
 		stMgrOpt.cmpTimeMap[componentName] = cmpSt.Timestamp
 
@@ -125,6 +129,11 @@ func (sc *StatsCollector) Init() {
 	sc.workerDone.Add(1)
 	go sc.statsDumper()
 
+	// stats are polled over pipes only by the health monitor, the metrics endpoint reads them in place
+	if !common.MonitorBfs() {
+		return
+	}
+
 	stMgrOpt.pollMtx.Lock()
 	defer stMgrOpt.pollMtx.Unlock()
 	if !stMgrOpt.pollStarted {
@@ -134,7 +143,7 @@ func (sc *StatsCollector) Init() {
 }
 
 func (sc *StatsCollector) Destroy() {
-	if common.MonitorBfs() {
+	if sc.channel != nil {
 		close(sc.channel)
 		sc.workerDone.Wait()
 	}
@@ -169,7 +178,7 @@ func (sc *StatsCollector) PushEvents(op string, path string, mp map[string]inter
 }
 
 func (sc *StatsCollector) UpdateStats(op string, key string, val interface{}) {
-	if common.MonitorBfs() {
+	if common.CollectStats() && sc.channel != nil {
 		st := Stats{
 			Timestamp: time.Now().Format(time.RFC3339),
 			Operation: op,
@@ -193,28 +202,26 @@ func (sc *StatsCollector) UpdateStats(op string, key string, val interface{}) {
 func (sc *StatsCollector) statsDumper() {
 	defer sc.workerDone.Done()
 
-	err := createPipe(common.TransferPipe)
-	if err != nil {
-		log.Err("stats_manager::statsDumper : [%v]", err)
-		disableMonitoring()
+	f, err := openTransferPipe()
+	if err != nil && !common.EnableMetrics {
 		return
 	}
-
-	f, err := os.OpenFile(common.TransferPipe, os.O_CREATE|os.O_WRONLY, 0777)
-	if err != nil {
-		log.Err("stats_manager::statsDumper : unable to open pipe file [%v]", err)
-		disableMonitoring()
-		return
-	}
-	defer f.Close()
-
-	log.Info("stats_manager::statsDumper : opened transfer pipe file")
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
 
 	for st := range sc.channel {
 		// log.Debug("stats_manager::statsDumper : stats: %v", st)
 
 		idx := sc.compIdx
 		if st.IsEvent {
+			if f == nil {
+				// events are meant for the health monitor only
+				continue
+			}
+
 			event := st.CompMsg.(Events)
 			pipeMsg := PipeMsg{
 				Timestamp:     event.Timestamp,
@@ -238,7 +245,12 @@ func (sc *StatsCollector) statsDumper() {
 			if err != nil {
 				log.Err("stats_manager::statsDumper : Unable to write to pipe [%v]", err)
 				disableMonitoring()
-				break
+				if !common.EnableMetrics {
+					break
+				}
+				// keep collecting for the metrics endpoint
+				f.Close()
+				f = nil
 			}
 
 		} else {
@@ -258,6 +270,7 @@ func (sc *StatsCollector) statsDumper() {
 				stMgrOpt.statsList[idx].Value[stat.Key] = stMgrOpt.statsList[idx].Value[stat.Key].(int64) + stat.Value.(int64)
 
 			case Decrement:
+				stMgrOpt.gaugeStats[idx][stat.Key] = true
 				stMgrOpt.statsList[idx].Value[stat.Key] = stMgrOpt.statsList[idx].Value[stat.Key].(int64) - stat.Value.(int64)
 				if stMgrOpt.statsList[idx].Value[stat.Key].(int64) < 0 {
 					log.Err("stats_manager::statsDumper : Negative value %v after decrement of %v for component %v",
@@ -265,6 +278,7 @@ func (sc *StatsCollector) statsDumper() {
 				}
 
 			case Replace:
+				stMgrOpt.gaugeStats[idx][stat.Key] = true
 				stMgrOpt.statsList[idx].Value[stat.Key] = stat.Value
 
 			default:
@@ -279,6 +293,30 @@ func (sc *StatsCollector) statsDumper() {
 	}
 }
 
+// openTransferPipe : open the pipe to the health monitor, there is none to open when only the metrics endpoint needs stats
+func openTransferPipe() (*os.File, error) {
+	if !common.MonitorBfs() {
+		return nil, nil
+	}
+
+	err := createPipe(common.TransferPipe)
+	if err != nil {
+		log.Err("stats_manager::statsDumper : [%v]", err)
+		disableMonitoring()
+		return nil, err
+	}
+
+	f, err := os.OpenFile(common.TransferPipe, os.O_CREATE|os.O_WRONLY, 0777)
+	if err != nil {
+		log.Err("stats_manager::statsDumper : unable to open pipe file [%v]", err)
+		disableMonitoring()
+		return nil, err
+	}
+
+	log.Info("stats_manager::statsDumper : opened transfer pipe file")
+	return f, nil
+}
+
 func statsPolling() {
 	// create polling pipe
 	err := createPipe(common.PollingPipe)
@@ -0,0 +1,92 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package common
+
+import (
+	"sync"
+)
+
+// Events pushed by azstorage as uploads and downloads of a blob progress
+const (
+	UploadProgress   = "UploadProgress"
+	DownloadProgress = "DownloadProgress"
+	BytesTransferred = "Bytes Transferred"
+	TransferSize     = "Size"
+)
+
+// transferTracker : totals of the bytes moved to and from the container, built from the progress events of each blob
+type transferTracker struct {
+	sync.Mutex
+	inFlight   map[string]int64 // bytes already counted for each blob being transferred
+	uploaded   int64
+	downloaded int64
+}
+
+var tracker = transferTracker{inFlight: make(map[string]int64)}
+
+// TrackTransfer : add the progress reported for a blob since its last event to the upload or download total
+func TrackTransfer(op string, path string, bytesTransferred int64, size int64) {
+	if op != UploadProgress && op != DownloadProgress {
+		return
+	}
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	key := op + ":" + path
+	delta := bytesTransferred - tracker.inFlight[key]
+	if delta < 0 {
+		// a new transfer of the same blob has started
+		delta = bytesTransferred
+	}
+
+	if op == UploadProgress {
+		tracker.uploaded += delta
+	} else {
+		tracker.downloaded += delta
+	}
+
+	if bytesTransferred >= size {
+		delete(tracker.inFlight, key)
+	} else {
+		tracker.inFlight[key] = bytesTransferred
+	}
+}
+
+// TransferredBytes : bytes uploaded and downloaded since the monitor started
+func TransferredBytes() (int64, int64) {
+	tracker.Lock()
+	defer tracker.Unlock()
+	return tracker.uploaded, tracker.downloaded
+}
@@ -91,3 +91,16 @@ type CpuMemStat struct {
 	CpuUsage string
 	MemUsage string
 }
+
+type NetworkStat struct {
+	BytesReceived       uint64  `json:"bytesReceived"`
+	BytesSent           uint64  `json:"bytesSent"`
+	ReceiveRate         float64 `json:"receiveRateBytesPerSec"`
+	SendRate            float64 `json:"sendRateBytesPerSec"`
+	ProcessBytesRead    uint64  `json:"processBytesRead"`
+	ProcessBytesWritten uint64  `json:"processBytesWritten"`
+	Connections         int     `json:"connections"`
+	EstablishedConns    int     `json:"establishedConnections"`
+	UploadThroughput    float64 `json:"uploadThroughputBytesPerSec"`
+	DownloadThroughput  float64 `json:"downloadThroughputBytesPerSec"`
+}
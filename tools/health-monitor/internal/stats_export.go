@@ -66,7 +66,7 @@ type Output struct {
 	FcEvent   []*hmcommon.CacheEvent  `json:"FileCache,omitempty"`
 	Cpu       string                  `json:"CPUUsage,omitempty"`
 	Mem       string                  `json:"MemoryUsage,omitempty"`
-	Net       string                  `json:"NetworkUsage,omitempty"`
+	Net       *hmcommon.NetworkStat   `json:"NetworkUsage,omitempty"`
 }
 
 var expLock sync.Mutex
@@ -183,7 +183,7 @@ func (se *StatsExporter) addToList(st *ExportedStat, idx int) {
 	} else if st.MonitorName == hmcommon.MemoryProfiler {
 		se.outputList[idx].Mem = st.Stat.(string)
 	} else if st.MonitorName == hmcommon.NetworkProfiler {
-		se.outputList[idx].Net = st.Stat.(string)
+		se.outputList[idx].Net = st.Stat.(*hmcommon.NetworkStat)
 	}
 }
 
@@ -132,6 +132,7 @@ func (bfs *BlobfuseStats) statsReader() error {
 			log.Err("StatsReader::statsReader : Unable to unmarshal json [%v]", err)
 			continue
 		}
+		trackTransfer(st)
 		bfs.ExportStats(st.Timestamp, st)
 	}
 
@@ -164,6 +165,21 @@ func (bfs *BlobfuseStats) statsPoll() {
 	}
 }
 
+// feed upload and download progress to the network monitor which reports the throughput
+func trackTransfer(st stats_manager.PipeMsg) {
+	if st.Operation != hmcommon.UploadProgress && st.Operation != hmcommon.DownloadProgress {
+		return
+	}
+
+	transferred, ok := st.Value[hmcommon.BytesTransferred].(float64)
+	if !ok {
+		return
+	}
+	size, _ := st.Value[hmcommon.TransferSize].(float64)
+
+	hmcommon.TrackTransfer(st.Operation, st.Path, int64(transferred), int64(size))
+}
+
 func createPipe(pipe string) error {
 	_, err := os.Stat(pipe)
 	if os.IsNotExist(err) {
@@ -34,17 +34,33 @@
 package network_monitor
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-fuse/v2/common/log"
 	hmcommon "github.com/Azure/azure-storage-fuse/v2/tools/health-monitor/common"
 	hminternal "github.com/Azure/azure-storage-fuse/v2/tools/health-monitor/internal"
 )
 
+// state column of /proc/net/tcp for an established connection
+const tcpEstablished = "01"
+
 type NetworkProfiler struct {
 	name         string
 	pid          string
 	pollInterval int
+	procPath     string
+
+	// previous sample, rates are computed over the poll interval
+	last       *hmcommon.NetworkStat
+	lastTime   time.Time
+	uploaded   int64
+	downloaded int64
 }
 
 func (nw *NetworkProfiler) GetName() string {
@@ -61,6 +77,20 @@ func (nw *NetworkProfiler) Monitor() error {
 		log.Err("network_monitor::Monitor : [%v]", err)
 		return err
 	}
+	log.Debug("network_monitor::Monitor : started")
+
+	ticker := time.NewTicker(time.Duration(nw.pollInterval) * time.Second)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		n, err := nw.getNetworkUsage(t)
+		if err != nil {
+			log.Err("network_monitor::Monitor : [%v]", err)
+			return err
+		}
+
+		nw.ExportStats(t.Format(time.RFC3339), n)
+	}
 
 	return nil
 }
@@ -87,10 +117,177 @@ func (nw *NetworkProfiler) Validate() error {
 	return nil
 }
 
+// getNetworkUsage : collect the counters of the process and derive the rates since the previous sample
+func (nw *NetworkProfiler) getNetworkUsage(now time.Time) (*hmcommon.NetworkStat, error) {
+	procDir := filepath.Join(nw.procPath, nw.pid)
+
+	st := &hmcommon.NetworkStat{}
+	var err error
+
+	st.BytesReceived, st.BytesSent, err = readInterfaceBytes(filepath.Join(procDir, "net", "dev"))
+	if err != nil {
+		log.Err("network_monitor::getNetworkUsage : Blobfuse2 is not running on pid %v [%v]", nw.pid, err)
+		return nil, err
+	}
+
+	// io counters and open sockets are readable only by the owner of the process, report the rest without them
+	st.ProcessBytesRead, st.ProcessBytesWritten, err = readProcessIO(filepath.Join(procDir, "io"))
+	if err != nil {
+		log.Debug("network_monitor::getNetworkUsage : Unable to read io counters of pid %v [%v]", nw.pid, err)
+	}
+
+	st.Connections, st.EstablishedConns, err = countConnections(procDir)
+	if err != nil {
+		log.Debug("network_monitor::getNetworkUsage : Unable to count connections of pid %v [%v]", nw.pid, err)
+	}
+
+	uploaded, downloaded := hmcommon.TransferredBytes()
+
+	if nw.last != nil {
+		elapsed := now.Sub(nw.lastTime).Seconds()
+		if elapsed > 0 {
+			st.ReceiveRate = rate(nw.last.BytesReceived, st.BytesReceived, elapsed)
+			st.SendRate = rate(nw.last.BytesSent, st.BytesSent, elapsed)
+			st.UploadThroughput = float64(uploaded-nw.uploaded) / elapsed
+			st.DownloadThroughput = float64(downloaded-nw.downloaded) / elapsed
+		}
+	}
+
+	nw.last = st
+	nw.lastTime = now
+	nw.uploaded = uploaded
+	nw.downloaded = downloaded
+
+	return st, nil
+}
+
+// rate : bytes per second between two samples of a counter, a counter which went back was reset
+func rate(prev uint64, curr uint64, elapsed float64) float64 {
+	if curr < prev {
+		return 0
+	}
+	return float64(curr-prev) / elapsed
+}
+
+// readInterfaceBytes : bytes received and sent on the interfaces in the network namespace of the process, loopback excluded
+func readInterfaceBytes(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var received, sent uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		cols := strings.SplitN(scanner.Text(), ":", 2)
+		if len(cols) != 2 || strings.TrimSpace(cols[0]) == "lo" {
+			continue
+		}
+
+		// receive bytes is the first column, transmit bytes the ninth
+		fields := strings.Fields(cols[1])
+		if len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		received += rx
+		sent += tx
+	}
+
+	return received, sent, scanner.Err()
+}
+
+// readProcessIO : bytes the process has read and written through system calls, sockets included
+func readProcessIO(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var read, written uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		cols := strings.SplitN(scanner.Text(), ":", 2)
+		if len(cols) != 2 {
+			continue
+		}
+
+		switch cols[0] {
+		case "rchar":
+			read, _ = strconv.ParseUint(strings.TrimSpace(cols[1]), 10, 64)
+		case "wchar":
+			written, _ = strconv.ParseUint(strings.TrimSpace(cols[1]), 10, 64)
+		}
+	}
+
+	return read, written, scanner.Err()
+}
+
+// countConnections : TCP sockets held open by the process and how many of those are established
+func countConnections(procDir string) (int, int, error) {
+	fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sockets := make(map[string]bool)
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name()))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(target, "socket:[") {
+			sockets[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = true
+		}
+	}
+
+	total, established := 0, 0
+	for _, table := range []string{"tcp", "tcp6"} {
+		t, e, err := countSockets(filepath.Join(procDir, "net", table), sockets)
+		if err != nil {
+			continue
+		}
+		total += t
+		established += e
+	}
+
+	return total, established, nil
+}
+
+// countSockets : entries of a /proc/net/tcp table whose inode is one of the given sockets
+func countSockets(path string, sockets map[string]bool) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	total, established := 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !sockets[fields[9]] {
+			continue
+		}
+
+		total++
+		if fields[3] == tcpEstablished {
+			established++
+		}
+	}
+
+	return total, established, scanner.Err()
+}
+
 func NewNetworkMonitor() hminternal.Monitor {
 	nw := &NetworkProfiler{
 		pid:          hmcommon.Pid,
 		pollInterval: hmcommon.ProcMonInterval,
+		procPath:     "/proc",
 	}
 
 	nw.SetName(hmcommon.NetworkProfiler)
@@ -99,6 +296,5 @@ func NewNetworkMonitor() hminternal.Monitor {
 }
 
 func init() {
-	// commenting this for now
-	// hminternal.AddMonitor(hmcommon.NetworkProfiler, NewNetworkMonitor)
+	hminternal.AddMonitor(hmcommon.NetworkProfiler, NewNetworkMonitor)
 }
@@ -0,0 +1,125 @@
+/*
+    _____           _____   _____   ____          ______  _____  ------
+   |     |  |      |     | |     | |     |     | |       |            |
+   |     |  |      |     | |     | |     |     | |       |            |
+   | --- |  |      |     | |-----| |---- |     | |-----| |-----  ------
+   |     |  |      |     | |     | |     |     |       | |       |
+   | ____|  |_____ | ____| | ____| |     |_____|  _____| |_____  |_____
+
+
+   Licensed under the MIT License <http://opensource.org/licenses/MIT>.
+
+   Copyright © 2020-2023 Microsoft Corporation. All rights reserved.
+   Author : <blobfusedev@microsoft.com>
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package network_monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-fuse/v2/common"
+	"github.com/Azure/azure-storage-fuse/v2/common/log"
+	hmcommon "github.com/Azure/azure-storage-fuse/v2/tools/health-monitor/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type networkMonitorTestSuite struct {
+	suite.Suite
+	assert *assert.Assertions
+}
+
+func (suite *networkMonitorTestSuite) SetupTest() {
+	suite.assert = assert.New(suite.T())
+	err := log.SetDefaultLogger("silent", common.LogConfig{Level: common.ELogLevel.LOG_DEBUG()})
+	if err != nil {
+		panic("Unable to set silent logger as default.")
+	}
+}
+
+func newTestNetworkProfiler(pid string) *NetworkProfiler {
+	return &NetworkProfiler{
+		name:         hmcommon.NetworkProfiler,
+		pid:          pid,
+		pollInterval: 5,
+		procPath:     "/proc",
+	}
+}
+
+func (suite *networkMonitorTestSuite) TestGetNetworkUsage() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.assert.Nil(err)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	suite.assert.Nil(err)
+	defer conn.Close()
+
+	nw := newTestNetworkProfiler(fmt.Sprintf("%v", os.Getpid()))
+
+	n, err := nw.getNetworkUsage(time.Now())
+	suite.assert.Nil(err)
+	suite.assert.NotNil(n)
+	suite.assert.GreaterOrEqual(n.Connections, 2)
+	suite.assert.GreaterOrEqual(n.EstablishedConns, 1)
+	suite.assert.NotZero(n.ProcessBytesRead)
+}
+
+func (suite *networkMonitorTestSuite) TestGetNetworkUsageFailure() {
+	nw := newTestNetworkProfiler("abcd")
+
+	n, err := nw.getNetworkUsage(time.Now())
+	suite.assert.Nil(n)
+	suite.assert.NotNil(err)
+}
+
+func (suite *networkMonitorTestSuite) TestTransferThroughput() {
+	nw := newTestNetworkProfiler(fmt.Sprintf("%v", os.Getpid()))
+	start := time.Now()
+
+	_, err := nw.getNetworkUsage(start)
+	suite.assert.Nil(err)
+
+	// 100MB reported half way through a 200MB upload, then a whole 50MB download
+	hmcommon.TrackTransfer(hmcommon.UploadProgress, "a", 100*common.MbToBytes, 200*common.MbToBytes)
+	hmcommon.TrackTransfer(hmcommon.DownloadProgress, "b", 50*common.MbToBytes, 50*common.MbToBytes)
+
+	n, err := nw.getNetworkUsage(start.Add(10 * time.Second))
+	suite.assert.Nil(err)
+	suite.assert.InDelta(10*common.MbToBytes, n.UploadThroughput, 1)
+	suite.assert.InDelta(5*common.MbToBytes, n.DownloadThroughput, 1)
+
+	// rest of the upload completes
+	hmcommon.TrackTransfer(hmcommon.UploadProgress, "a", 200*common.MbToBytes, 200*common.MbToBytes)
+	n, err = nw.getNetworkUsage(start.Add(20 * time.Second))
+	suite.assert.Nil(err)
+	suite.assert.InDelta(10*common.MbToBytes, n.UploadThroughput, 1)
+	suite.assert.Zero(n.DownloadThroughput)
+}
+
+func TestNetworkMonitor(t *testing.T) {
+	suite.Run(t, new(networkMonitorTestSuite))
+}